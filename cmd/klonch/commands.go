@@ -0,0 +1,919 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dori/klonch/internal/app"
+	"github.com/dori/klonch/internal/db"
+	"github.com/dori/klonch/internal/model"
+	"github.com/dori/klonch/internal/parse"
+)
+
+// dbFlags are the --data-dir and --db flags shared by every subcommand
+type dbFlags struct {
+	dataDir *string
+	dbPath  *string
+}
+
+func addDBFlags(fs *flag.FlagSet) dbFlags {
+	return dbFlags{
+		dataDir: fs.String("data-dir", "", "Data directory"),
+		dbPath:  fs.String("db", "", "Database file"),
+	}
+}
+
+// open opens the selected database or exits
+func (f dbFlags) open() *db.DB {
+	database, err := db.Open(appConfig(*f.dataDir, *f.dbPath).DBPath)
+	if err != nil {
+		fatalf("opening database: %v", err)
+	}
+	app.CheckSettings(database)
+	return database
+}
+
+func fatalf(format string, args ...interface{}) {
+	exitWithError(fmt.Errorf(format, args...))
+}
+
+// newFlagSet creates a subcommand flag set with --json that reports errors
+// in the current output mode
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(flagOutput{})
+	fs.BoolVar(&jsonOutput, "json", jsonOutput, "Print JSON instead of text, one object per line")
+	return fs
+}
+
+// flagOutput shows flag errors and usage on stderr, and hides them in JSON
+// mode, which --json may turn on partway through parsing
+type flagOutput struct{}
+
+func (flagOutput) Write(p []byte) (int, error) {
+	if jsonOutput {
+		return io.Discard.Write(p)
+	}
+	return os.Stderr.Write(p)
+}
+
+// parseArgs parses flags that may appear before, after or between positional
+// arguments, so `klonch edit 1a2b --title x` works, and returns the positionals.
+// Everything after "--" is positional.
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	return parseFlags(fs, args, false)
+}
+
+// parseText is parseArgs for commands taking free text, such as a title:
+// after the first positional, --json is a word of the text, not the flag
+func parseText(fs *flag.FlagSet, args []string) []string {
+	return parseFlags(fs, args, true)
+}
+
+// jsonWord stands in for --json once parseText is in the text, putting the
+// word back among the positionals
+type jsonWord struct{ positional *[]string }
+
+func (w jsonWord) String() string   { return "false" }
+func (w jsonWord) IsBoolFlag() bool { return true }
+
+func (w jsonWord) Set(string) error {
+	*w.positional = append(*w.positional, "--json")
+	return nil
+}
+
+func parseFlags(fs *flag.FlagSet, args []string, text bool) []string {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err == flag.ErrHelp {
+			os.Exit(0)
+		} else if err != nil {
+			fatalf("%v", err)
+		}
+		rest := fs.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...)
+		}
+		if len(rest) == 0 {
+			return positional
+		}
+		positional = append(positional, rest[0])
+		if text {
+			fs.Lookup("json").Value = jsonWord{&positional}
+		}
+		args = rest[1:]
+	}
+}
+
+// flagGiven reports whether a flag was set on the command line
+func flagGiven(fs *flag.FlagSet, name string) bool {
+	given := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			given = true
+		}
+	})
+	return given
+}
+
+// resolveTask expands an ID prefix and loads the task, or exits
+func resolveTask(database *db.DB, prefix string) *model.Task {
+	id, err := database.ResolveTaskID(prefix)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	task, err := database.GetTask(id)
+	if err != nil {
+		fatalf("loading task: %v", err)
+	}
+	if task == nil {
+		fatalf("no task matches %q", prefix)
+	}
+	return task
+}
+
+// resolveProject finds a project by name, or by ID for the inbox
+func resolveProject(database *db.DB, name string) *model.Project {
+	project, err := database.GetProjectByName(strings.TrimPrefix(name, "#"))
+	if err == nil && project == nil {
+		project, err = database.GetProject(name)
+	}
+	if err != nil {
+		fatalf("loading project: %v", err)
+	}
+	if project == nil {
+		fatalf("no project named %q", name)
+	}
+	return project
+}
+
+var openStatuses = []model.Status{model.StatusBacklog, model.StatusPending, model.StatusInProgress}
+
+// parseStatuses reads a comma-separated --status value
+func parseStatuses(value string) ([]model.Status, error) {
+	var statuses []model.Status
+	for _, s := range strings.Split(value, ",") {
+		switch s = strings.ToLower(strings.TrimSpace(s)); s {
+		case "open":
+			statuses = append(statuses, openStatuses...)
+		case "all":
+			statuses = append(statuses, openStatuses...)
+			statuses = append(statuses, model.StatusDone, model.StatusArchived)
+		case "backlog", "pending", "in_progress", "done", "archived":
+			statuses = append(statuses, model.Status(s))
+		default:
+			return nil, fmt.Errorf("unknown status %q (want backlog, pending, in_progress, done, archived, open or all)", s)
+		}
+	}
+	return statuses, nil
+}
+
+// dueMatcher turns a --due value into a predicate over tasks
+func dueMatcher(value string) (func(*model.Task) bool, error) {
+	switch strings.ToLower(value) {
+	case "":
+		return func(*model.Task) bool { return true }, nil
+	case "overdue":
+		return func(t *model.Task) bool { return t.IsOverdue() }, nil
+	case "none":
+		return func(t *model.Task) bool { return t.DueDate == nil }, nil
+	}
+
+	// Due by the end of the span, as due<= reads it in a query
+	_, end, ok := parse.Span(value, time.Now())
+	if !ok {
+		return nil, fmt.Errorf("can't read due date %q", value)
+	}
+	return func(t *model.Task) bool {
+		return t.DueDate != nil && t.DueDate.Before(end)
+	}, nil
+}
+
+func handleList(args []string) {
+	fs := newFlagSet("list")
+	project := fs.String("project", "", "Only tasks in this project")
+	tag := fs.String("tag", "", "Only tasks with this tag")
+	status := fs.String("status", "open", "Comma-separated statuses, open or all")
+	due := fs.String("due", "", "Due by a date, overdue or none")
+	list := fs.String("list", "", "Only tasks in this smart list")
+	deferred := fs.Bool("deferred", false, "Include tasks whose start date is still ahead")
+	sortBy := fs.String("sort", "", "Order, e.g. \"due, priority\" (default: the order saved with :sort)")
+	dbf := addDBFlags(fs)
+	text := strings.Join(parseArgs(fs, args), " ")
+
+	matchDue, err := dueMatcher(*due)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	database := dbf.open()
+	defer database.Close()
+
+	// A smart list and a query on the command line must both match
+	if *list != "" {
+		l, err := database.GetSmartListByName(*list)
+		if err != nil {
+			fatalf("loading smart list: %v", err)
+		}
+		if l == nil {
+			fatalf("no smart list named %q", *list)
+		}
+		if text != "" {
+			text = "(" + l.Query + ") and (" + text + ")"
+		} else {
+			text = l.Query
+		}
+	}
+
+	var query *db.Query
+	if text != "" {
+		if query, err = db.ParseQuery(text); err != nil {
+			fatalf("query: %v", err)
+		}
+		// A query that picks statuses replaces the default of open tasks
+		if (query.Uses("status") || query.Uses("is")) && !flagGiven(fs, "status") {
+			*status = "all"
+		}
+	}
+
+	statuses, err := parseStatuses(*status)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	// Without --sort, use the order the TUI saved for the project or list
+	spec := *sortBy
+	if !flagGiven(fs, "sort") {
+		spec, _ = database.GetSetting(db.SettingListSort)
+	}
+
+	// Deferred tasks stay hidden unless asked for, as in the TUI
+	filter := db.TaskFilter{Statuses: statuses, Query: query}
+	if !*deferred && (query == nil || !query.Uses("start")) {
+		show, _ := database.GetBoolSetting(db.SettingShowDeferred)
+		filter.HideDeferred = !show
+	}
+	if *project != "" {
+		p := resolveProject(database, *project)
+		filter.ProjectID = p.ID
+		if !flagGiven(fs, "sort") && p.SortOrder != "" {
+			spec = p.SortOrder
+		}
+	}
+	order, err := model.ParseSortOrder(spec)
+	if err != nil {
+		fatalf("sort: %v", err)
+	}
+	if *tag != "" {
+		t, err := database.GetTagByName(*tag)
+		if err != nil {
+			fatalf("loading tag: %v", err)
+		}
+		if t == nil {
+			fatalf("no tag named %q", *tag)
+		}
+		filter.TagID = t.ID
+	}
+
+	tasks, err := database.ListTasks(filter)
+	if err != nil {
+		fatalf("listing tasks: %v", err)
+	}
+	tasks = model.SortTasks(tasks, order)
+
+	names := projectNames(database)
+	for i := range tasks {
+		if !matchDue(&tasks[i]) {
+			continue
+		}
+		if jsonOutput {
+			printJSON(newTaskOutput(database, &tasks[i], names))
+		} else {
+			fmt.Println(formatTaskLine(database, &tasks[i], names))
+		}
+	}
+}
+
+// projectNames maps project IDs to names for display
+func projectNames(database *db.DB) map[string]string {
+	projects, err := database.GetProjects()
+	if err != nil {
+		fatalf("loading projects: %v", err)
+	}
+	names := make(map[string]string, len(projects))
+	for _, p := range projects {
+		names[p.ID] = p.Name
+	}
+	return names
+}
+
+// statusMark is the checkbox shown before a task title
+func statusMark(s model.Status) string {
+	switch s {
+	case model.StatusDone:
+		return "[x]"
+	case model.StatusInProgress:
+		return "[~]"
+	case model.StatusBacklog:
+		return "[.]"
+	case model.StatusArchived:
+		return "[-]"
+	default:
+		return "[ ]"
+	}
+}
+
+// formatTaskLine renders a task on one line using the quick add notation
+func formatTaskLine(database *db.DB, t *model.Task, projects map[string]string) string {
+	parts := []string{t.ShortID(), statusMark(t.Status), t.Title}
+	if t.Priority != model.PriorityMedium {
+		parts = append(parts, "!"+string(t.Priority))
+	}
+	if t.ProjectID != nil && *t.ProjectID != "inbox" {
+		if name, ok := projects[*t.ProjectID]; ok {
+			parts = append(parts, "#"+name)
+		}
+	}
+	if tags, err := database.GetTaskTags(t.ID); err == nil {
+		for _, tag := range tags {
+			parts = append(parts, tag.DisplayName())
+		}
+	}
+	// Dates as single words, so that the line pastes back into klonch add
+	if t.DueDate != nil {
+		parts = append(parts, "due:"+parse.FormatToken(*t.DueDate))
+	}
+	if !t.IsVisible() {
+		parts = append(parts, "start:"+parse.FormatToken(*t.StartDate))
+	}
+	if t.TimeEstimate != nil {
+		parts = append(parts, "~"+model.FormatEstimate(*t.TimeEstimate))
+	}
+	if t.IsRecurring() {
+		parts = append(parts, "↻")
+	}
+	return strings.Join(parts, " ")
+}
+
+func handleShow(args []string) {
+	fs := newFlagSet("show")
+	dbf := addDBFlags(fs)
+	ids := parseArgs(fs, args)
+	if len(ids) != 1 {
+		fatalf("usage: klonch show <id>")
+	}
+
+	database := dbf.open()
+	defer database.Close()
+
+	t := resolveTask(database, ids[0])
+	names := projectNames(database)
+	comments, err := database.TaskComments(t.ID)
+	if err != nil {
+		fatalf("loading comments: %v", err)
+	}
+	activity, err := database.TaskActivity(t.ID)
+	if err != nil {
+		fatalf("loading activity: %v", err)
+	}
+	if jsonOutput {
+		printJSON(showOutput{newTaskOutput(database, t, names),
+			append([]model.Comment{}, comments...), append([]model.Activity{}, activity...)})
+		return
+	}
+
+	field := func(label, value string) {
+		fmt.Printf("%-12s %s\n", label+":", value)
+	}
+	field("ID", t.ID)
+	field("Title", t.Title)
+	field("Status", string(t.Status))
+	if w := taskWorkflow(database, t); !w.IsDefault() {
+		field("State", stateName(w, t))
+	}
+	field("Priority", string(t.Priority))
+	if t.ProjectID != nil {
+		field("Project", names[*t.ProjectID])
+	}
+	if tags, err := database.GetTaskTags(t.ID); err == nil && len(tags) > 0 {
+		var tagNames []string
+		for _, tag := range tags {
+			tagNames = append(tagNames, tag.DisplayName())
+		}
+		field("Tags", strings.Join(tagNames, " "))
+	}
+	if t.DueDate != nil {
+		field("Due", formatDueDate(*t.DueDate))
+	}
+	if t.StartDate != nil {
+		field("Starts", formatDueDate(*t.StartDate))
+	}
+	if t.DueDate != nil || t.Reminders != nil {
+		field("Reminders", formatReminders(database, t))
+	}
+	if t.TimeEstimate != nil {
+		field("Estimate", model.FormatEstimate(*t.TimeEstimate))
+	}
+	if rule := t.RecurrenceRule(); rule != nil {
+		field("Repeats", rule.String())
+	}
+	if t.ParentID != nil {
+		if parent, err := database.GetTask(*t.ParentID); err == nil && parent != nil {
+			field("Parent", parent.ShortID()+" "+parent.Title)
+		}
+	}
+	field("Created", t.CreatedAt.Local().Format("Jan 2, 2006 15:04"))
+	if t.CompletedAt != nil {
+		field("Completed", t.CompletedAt.Local().Format("Jan 2, 2006 15:04"))
+	}
+
+	if t.Description != "" {
+		fmt.Println()
+		fmt.Println(t.Description)
+	}
+
+	if subtasks, err := database.GetSubtasks(t.ID); err == nil && len(subtasks) > 0 {
+		fmt.Println("\nSubtasks:")
+		for i := range subtasks {
+			fmt.Println("  " + formatTaskLine(database, &subtasks[i], names))
+		}
+	}
+	if deps, err := database.GetTaskDependencies(t.ID); err == nil && len(deps) > 0 {
+		fmt.Println("\nDepends on:")
+		for i := range deps {
+			fmt.Println("  " + formatTaskLine(database, &deps[i], names))
+		}
+	}
+
+	const stamp = "Jan 2, 2006 15:04"
+	if len(comments) > 0 {
+		fmt.Println("\nComments:")
+		for _, c := range comments {
+			body := strings.ReplaceAll(c.Body, "\n", "\n"+strings.Repeat(" ", len(stamp)+4))
+			fmt.Printf("  %-*s  %s\n", len(stamp), c.CreatedAt.Format(stamp), body)
+		}
+	}
+	if len(activity) > 0 {
+		fmt.Println("\nActivity:")
+		for _, a := range activity {
+			fmt.Printf("  %-*s  %s\n", len(stamp), a.CreatedAt.Format(stamp), a.Summary())
+		}
+	}
+}
+
+func handleComment(args []string) {
+	fs := newFlagSet("comment")
+	dbf := addDBFlags(fs)
+	rest := parseText(fs, args)
+	if len(rest) < 2 {
+		fatalf("usage: klonch comment <id> <text>")
+	}
+
+	database := dbf.open()
+	defer database.Close()
+
+	t := resolveTask(database, rest[0])
+	c, err := database.AddComment(t.ID, strings.Join(rest[1:], " "))
+	if err != nil {
+		fatalf("adding comment: %v", err)
+	}
+	if jsonOutput {
+		printJSON(c)
+		return
+	}
+	fmt.Printf("Commented on: %s\n", t.Title)
+}
+
+func handleDone(args []string) {
+	fs := newFlagSet("done")
+	dbf := addDBFlags(fs)
+	ids := parseArgs(fs, args)
+	if len(ids) == 0 {
+		fatalf("usage: klonch done <id>...")
+	}
+
+	database := dbf.open()
+	defer database.Close()
+
+	// Resolve everything first so a typo doesn't leave half the work done
+	var tasks []*model.Task
+	for _, id := range ids {
+		tasks = append(tasks, resolveTask(database, id))
+	}
+
+	group := database.Group("Complete task")
+	for _, t := range tasks {
+		if t.Status == model.StatusDone {
+			printTask(database, "Already done", t)
+			continue
+		}
+		if err := group.SetTaskStatus(t.ID, model.StatusDone); err != nil {
+			fatalf("completing %s: %v", t.ShortID(), err)
+		}
+		printTask(database, "Completed", t)
+	}
+}
+
+func handleEdit(args []string) {
+	fs := newFlagSet("edit")
+	title := fs.String("title", "", "New title")
+	priority := fs.String("priority", "", "low, medium, high or urgent")
+	due := fs.String("due", "", "New due date with optional time, or none")
+	start := fs.String("start", "", "Hide the task until a date, or none")
+	estimate := fs.String("estimate", "", "Time estimate such as 45m or 2h, or none")
+	project := fs.String("project", "", "Move to a project, or none for the inbox")
+	remind := fs.String("remind", "", "Reminders before due such as 1d,1h, none, or default")
+	description := fs.String("description", "", "New description, or none")
+	dbf := addDBFlags(fs)
+	ids := parseArgs(fs, args)
+	if len(ids) != 1 {
+		fatalf("usage: klonch edit <id> [--title text] [--priority p] [--due date] [--start date] [--estimate time] [--project name] [--remind offsets] [--description text]")
+	}
+	if *title == "" && *priority == "" && *due == "" && *start == "" && *estimate == "" && *project == "" && *remind == "" &&
+		*description == "" {
+		editInEditor(dbf, ids[0])
+		return
+	}
+
+	// Validate before touching the database
+	var newPriority model.Priority
+	if *priority != "" {
+		var ok bool
+		if newPriority, ok = parse.Priority(*priority); !ok {
+			fatalf("unknown priority %q (want low, medium, high or urgent)", *priority)
+		}
+	}
+	var newDue *time.Time
+	if *due != "" && !strings.EqualFold(*due, "none") {
+		if newDue = parseNaturalDate(*due); newDue == nil {
+			fatalf("can't read due date %q", *due)
+		}
+	}
+	var newStart *time.Time
+	if *start != "" && !strings.EqualFold(*start, "none") {
+		parsed := parseNaturalDate(*start)
+		if parsed == nil {
+			fatalf("can't read start date %q", *start)
+		}
+		s := parse.StartOf(*parsed)
+		newStart = &s
+	}
+	var newEstimate *int
+	if *estimate != "" && !strings.EqualFold(*estimate, "none") {
+		minutes, err := model.ParseEstimate(*estimate)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		newEstimate = &minutes
+	}
+	var newReminders *string
+	if *remind != "" && !strings.EqualFold(*remind, "default") {
+		offsets, err := model.ParseReminders(*remind)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		formatted := model.FormatReminders(offsets)
+		newReminders = &formatted
+	}
+
+	database := dbf.open()
+	defer database.Close()
+
+	t := resolveTask(database, ids[0])
+	group := database.Group("Edit task")
+
+	if *title != "" {
+		if err := group.UpdateTaskTitle(t.ID, *title); err != nil {
+			fatalf("updating title: %v", err)
+		}
+		t.Title = *title
+	}
+	if *priority != "" {
+		if err := group.UpdateTaskPriority(t.ID, newPriority); err != nil {
+			fatalf("updating priority: %v", err)
+		}
+	}
+	if *due != "" {
+		if err := group.SetTaskDueDate(t.ID, newDue); err != nil {
+			fatalf("updating due date: %v", err)
+		}
+	}
+	if *start != "" {
+		if err := group.SetTaskStartDate(t.ID, newStart); err != nil {
+			fatalf("updating start date: %v", err)
+		}
+	}
+	if *estimate != "" {
+		if err := group.SetTaskEstimate(t.ID, newEstimate); err != nil {
+			fatalf("updating estimate: %v", err)
+		}
+	}
+	if *remind != "" {
+		if err := group.SetTaskReminders(t.ID, newReminders); err != nil {
+			fatalf("updating reminders: %v", err)
+		}
+	}
+	if *description != "" {
+		text := *description
+		if strings.EqualFold(text, "none") {
+			text = ""
+		}
+		if err := group.UpdateTaskDescription(t.ID, text); err != nil {
+			fatalf("updating description: %v", err)
+		}
+	}
+	if *project != "" {
+		projectID := "inbox"
+		if !strings.EqualFold(*project, "none") {
+			name := strings.TrimPrefix(*project, "#")
+			p, err := group.GetProjectByName(name)
+			if err == nil && p == nil {
+				p, err = group.CreateProject(name, "")
+			}
+			if err != nil {
+				fatalf("finding project: %v", err)
+			}
+			projectID = p.ID
+		}
+		if err := group.UpdateTaskProject(t.ID, projectID); err != nil {
+			fatalf("moving task: %v", err)
+		}
+	}
+
+	printTask(database, "Updated", t)
+}
+
+// editInEditor opens the task as a document in the user's editor and saves
+// what changed. If the document can't be saved it is left in place, so the
+// edits aren't lost.
+func editInEditor(dbf dbFlags, id string) {
+	database := dbf.open()
+	defer database.Close()
+
+	t := resolveTask(database, id)
+	doc, err := database.TaskDocument(t.ID)
+	if err != nil {
+		fatalf("reading task: %v", err)
+	}
+	path, err := app.WriteTempDocument(doc)
+	if err != nil {
+		fatalf("writing task: %v", err)
+	}
+
+	cmd := app.EditorCommand(path)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		fatalf("editor: %v (the task is in %s)", err, path)
+	}
+	edited, err := os.ReadFile(path)
+	if err != nil {
+		fatalf("reading edits: %v", err)
+	}
+	if string(edited) == doc {
+		os.Remove(path)
+		printTask(database, "Unchanged", t)
+		return
+	}
+	if err := database.ApplyTaskDocument(t.ID, string(edited)); err != nil {
+		fatalf("%v (your edits are in %s)", err, path)
+	}
+	os.Remove(path)
+
+	if t, err = database.GetTask(t.ID); err != nil {
+		fatalf("reading task: %v", err)
+	}
+	printTask(database, "Updated", t)
+}
+
+func handleRm(args []string) {
+	fs := newFlagSet("rm")
+	dbf := addDBFlags(fs)
+	ids := parseArgs(fs, args)
+	if len(ids) == 0 {
+		fatalf("usage: klonch rm <id>...")
+	}
+
+	database := dbf.open()
+	defer database.Close()
+
+	var tasks []*model.Task
+	for _, id := range ids {
+		tasks = append(tasks, resolveTask(database, id))
+	}
+
+	names := projectNames(database)
+	group := database.Group("Delete task")
+	for _, t := range tasks {
+		// Capture the JSON first, the subtasks and tags go with the task
+		var out taskOutput
+		if jsonOutput {
+			out = newTaskOutput(database, t, names)
+		}
+		if err := group.DeleteTask(t.ID); err != nil {
+			fatalf("deleting %s: %v", t.ShortID(), err)
+		}
+		if jsonOutput {
+			printJSON(out)
+		} else {
+			fmt.Printf("Deleted: %s\n", t.Title)
+		}
+	}
+}
+
+// handleTag adds tags to a task, or removes them for untag
+func handleTag(args []string, remove bool) {
+	name := "tag"
+	if remove {
+		name = "untag"
+	}
+	fs := newFlagSet(name)
+	dbf := addDBFlags(fs)
+	rest := parseArgs(fs, args)
+	if len(rest) < 2 {
+		fatalf("usage: klonch %s <id> <tag>...", name)
+	}
+
+	database := dbf.open()
+	defer database.Close()
+
+	t := resolveTask(database, rest[0])
+	if remove {
+		group := database.Group("Remove tag")
+		for _, tagName := range rest[1:] {
+			tag, err := group.GetTagByName(tagName)
+			if err != nil {
+				fatalf("loading tag: %v", err)
+			}
+			if tag == nil {
+				fatalf("no tag named %q", tagName)
+			}
+			if err := group.RemoveTagFromTask(t.ID, tag.ID); err != nil {
+				fatalf("removing tag: %v", err)
+			}
+			if !jsonOutput {
+				fmt.Printf("Untagged %s: %s\n", tag.DisplayName(), t.Title)
+			}
+		}
+		if jsonOutput {
+			printTask(database, "", t)
+		}
+		return
+	}
+
+	group := database.Group("Add tag")
+	for _, tagName := range rest[1:] {
+		tag, err := group.GetOrCreateTag(tagName, "")
+		if err != nil {
+			fatalf("creating tag: %v", err)
+		}
+		if err := group.AddTagToTask(t.ID, tag.ID); err != nil {
+			fatalf("adding tag: %v", err)
+		}
+		if !jsonOutput {
+			fmt.Printf("Tagged %s: %s\n", tag.DisplayName(), t.Title)
+		}
+	}
+	if jsonOutput {
+		printTask(database, "", t)
+	}
+}
+
+func handleProjects(args []string) {
+	fs := newFlagSet("projects")
+	dbf := addDBFlags(fs)
+	if rest := parseArgs(fs, args); len(rest) > 0 {
+		fatalf("unexpected argument %q", rest[0])
+	}
+
+	database := dbf.open()
+	defer database.Close()
+
+	projects, err := database.GetProjects()
+	if err != nil {
+		fatalf("loading projects: %v", err)
+	}
+
+	width := 0
+	for _, p := range projects {
+		if len(p.Name) > width {
+			width = len(p.Name)
+		}
+	}
+	for _, p := range projects {
+		open := p.TaskCount - p.CompletedCount
+		if jsonOutput {
+			printJSON(projectOutput{Project: p, OpenTasks: open, DoneTasks: p.CompletedCount})
+		} else {
+			fmt.Printf("%-*s  %d open, %d done\n", width, p.Name, open, p.CompletedCount)
+		}
+	}
+}
+
+// handleLists shows smart lists, or saves or deletes one:
+// klonch lists [save <name> <query>... | rm <name>]
+func handleLists(args []string) {
+	fs := newFlagSet("lists")
+	dbf := addDBFlags(fs)
+	rest := parseArgs(fs, args)
+
+	database := dbf.open()
+	defer database.Close()
+
+	if len(rest) > 0 {
+		switch rest[0] {
+		case "save":
+			if len(rest) < 3 {
+				fatalf("usage: klonch lists save <name> <query>")
+			}
+			l, err := database.SaveSmartList(rest[1], strings.Join(rest[2:], " "))
+			if err != nil {
+				fatalf("saving smart list: %v", err)
+			}
+			if jsonOutput {
+				printJSON(l)
+			} else {
+				fmt.Printf("Saved: %s\n", l.Name)
+			}
+			return
+		case "rm":
+			if len(rest) != 2 {
+				fatalf("usage: klonch lists rm <name>")
+			}
+			l, err := database.GetSmartListByName(rest[1])
+			if err != nil {
+				fatalf("loading smart list: %v", err)
+			}
+			if l == nil {
+				fatalf("no smart list named %q", rest[1])
+			}
+			if err := database.DeleteSmartList(l.ID); err != nil {
+				fatalf("deleting smart list: %v", err)
+			}
+			if jsonOutput {
+				printJSON(l)
+			} else {
+				fmt.Printf("Deleted: %s\n", l.Name)
+			}
+			return
+		default:
+			fatalf("unknown lists command %q (want save or rm)", rest[0])
+		}
+	}
+
+	lists, err := database.GetSmartLists()
+	if err != nil {
+		fatalf("loading smart lists: %v", err)
+	}
+
+	width := 0
+	for _, l := range lists {
+		if len(l.Name) > width {
+			width = len(l.Name)
+		}
+	}
+	for _, l := range lists {
+		if jsonOutput {
+			printJSON(l)
+		} else {
+			fmt.Printf("%-*s  %s\n", width, l.Name, l.Query)
+		}
+	}
+}
+
+func handleTags(args []string) {
+	fs := newFlagSet("tags")
+	dbf := addDBFlags(fs)
+	if rest := parseArgs(fs, args); len(rest) > 0 {
+		fatalf("unexpected argument %q", rest[0])
+	}
+
+	database := dbf.open()
+	defer database.Close()
+
+	tags, err := database.GetTags()
+	if err != nil {
+		fatalf("loading tags: %v", err)
+	}
+
+	width := 0
+	for _, t := range tags {
+		if len(t.DisplayName()) > width {
+			width = len(t.DisplayName())
+		}
+	}
+	for _, t := range tags {
+		open, err := database.ListTasks(db.TaskFilter{TagID: t.ID, Statuses: openStatuses})
+		if err != nil {
+			fatalf("counting tasks: %v", err)
+		}
+		if jsonOutput {
+			printJSON(tagOutput{Tag: t, OpenTasks: len(open)})
+		} else {
+			fmt.Printf("%-*s  %d open\n", width, t.DisplayName(), len(open))
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -11,8 +12,9 @@ import (
 	"github.com/dori/klonch/internal/app"
 	"github.com/dori/klonch/internal/db"
 	"github.com/dori/klonch/internal/model"
+	"github.com/dori/klonch/internal/parse"
 	"github.com/dori/klonch/internal/ui"
-	"github.com/google/uuid"
+	"github.com/dori/klonch/internal/ui/theme"
 )
 
 var (
@@ -21,10 +23,58 @@ var (
 
 func main() {
 	// Subcommand handling
-	if len(os.Args) > 1 {
-		switch os.Args[1] {
+	if args := stripJSONFlag(os.Args[1:]); len(args) > 0 {
+		switch args[0] {
 		case "add":
-			handleAdd(os.Args[2:])
+			handleAdd(args[1:])
+			return
+		case "list", "ls":
+			handleList(args[1:])
+			return
+		case "show":
+			handleShow(args[1:])
+			return
+		case "done":
+			handleDone(args[1:])
+			return
+		case "move":
+			handleMove(args[1:])
+			return
+		case "comment":
+			handleComment(args[1:])
+			return
+		case "edit":
+			handleEdit(args[1:])
+			return
+		case "rm":
+			handleRm(args[1:])
+			return
+		case "tag":
+			handleTag(args[1:], false)
+			return
+		case "untag":
+			handleTag(args[1:], true)
+			return
+		case "projects":
+			handleProjects(args[1:])
+			return
+		case "workflow":
+			handleWorkflow(args[1:])
+			return
+		case "tags":
+			handleTags(args[1:])
+			return
+		case "lists":
+			handleLists(args[1:])
+			return
+		case "remind":
+			handleRemind(args[1:])
+			return
+		case "notify":
+			handleNotify(args[1:])
+			return
+		case "timer":
+			handleTimer(args[1:])
 			return
 		case "version":
 			fmt.Printf("klonch v%s\n", version)
@@ -36,12 +86,15 @@ func main() {
 	}
 
 	// Parse flags for TUI mode
-	viewFlag := flag.String("view", "list", "Starting view (list, kanban, eisenhower, calendar, pomodoro)")
-	themeFlag := flag.String("theme", "", "Theme name (nord, dracula, gruvbox, catppuccin)")
+	viewFlag := flag.String("view", "", "Starting view ("+strings.Join(ui.ViewNames(), ", ")+"); focus takes focus:<task-id>")
+	themeFlag := flag.String("theme", "", "Theme name ("+strings.Join(themeNames(), ", ")+")")
+	dbFlag := flag.String("db", "", "Database file (default <data-dir>/klonch.db)")
+	dataDirFlag := flag.String("data-dir", "", "Data directory (default "+db.DefaultDataDir()+")")
 	flag.Parse()
 
 	// Run TUI
-	if err := runTUI(*viewFlag, *themeFlag); err != nil {
+	cfg := appConfig(*dataDirFlag, *dbFlag)
+	if err := runTUI(cfg, *viewFlag, *themeFlag); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
@@ -53,6 +106,34 @@ func printHelp() {
 Usage:
   klonch                    Start the TUI
   klonch add <task>         Quick add a task
+  klonch list [query]       List open tasks, or those matching a query
+  klonch show <id>          Show a task with its comments and activity
+  klonch done <id>...       Complete tasks
+  klonch move <id> <state>  Move a task to a column of its project's board
+  klonch edit <id> [flags]  Change title, priority, due date or project
+  klonch edit <id>          Edit the task and its notes in $EDITOR
+  klonch comment <id> text  Add a comment to a task
+  klonch rm <id>...         Delete tasks and their subtasks
+  klonch tag <id> <tag>...  Add tags to a task
+  klonch untag <id> <tag>.. Remove tags from a task
+  klonch projects           List projects
+  klonch workflow <project> Show a project's Kanban columns
+  klonch workflow <project> add <name> <open|active|done> [--at N]
+  klonch workflow <project> rename <state> <name>
+  klonch workflow <project> move <state> <N>
+  klonch workflow <project> limit <state> <N>  (0 for no WIP limit)
+  klonch workflow <project> rm <state>
+  klonch workflow <project> reset
+  klonch tags               List tags
+  klonch lists              List smart lists (saved queries)
+  klonch lists save <name> <query>
+  klonch lists rm <name>
+  klonch remind             List reminders due in the next week
+  klonch remind --daemon    Send reminders while the TUI isn't running
+  klonch notify             List the notification backends in use
+  klonch notify test        Send a test notification through each
+  klonch timer [status]     Show the running timer, e.g. for a status bar
+  klonch timer stop         Stop the running timer (--at 17:30 or 1h30m)
   klonch version            Show version
   klonch help               Show this help
 
@@ -63,12 +144,100 @@ Quick Add Syntax:
   Project:   #name         (e.g., #work, #personal, #inbox)
   Tags:      @tag          (e.g., @home, @urgent, @review)
   Priority:  !low !medium !high !urgent (or !l !m !h !u)
-  Due date:  due:tomorrow due:friday due:2024-01-15
-             due:today due:mon due:nextweek
+  Due date:  due:tomorrow due:friday due:2024-01-15 due:fri 14:00
+             due:in 3 days due:next mon due:eow due:eom due:+2w due:2025-W03
+  Start:     start:monday  (hidden until that day, see --deferred)
+  Estimate:  ~45m ~2h ~1h30m
+
+Task IDs:
+  Commands print the first 8 characters of each task ID. Any unique
+  prefix works wherever an <id> is expected. Every command also takes
+  --data-dir and --db, like the TUI.
+
+JSON Output:
+  --json            Print JSON instead of text, one object per line
+                    (tasks, projects or tags). Failures print
+                    {"error": "..."} and exit non-zero. See README.md
+                    for the fields.
+
+List Filters:
+  --project <name>  Tasks in a project
+  --tag <name>      Tasks with a tag
+  --status <s,...>  backlog, pending, in_progress, done, archived,
+                    open (default) or all
+  --due <when>      Due by a date as quick add reads it (today, fri,
+                    eow, +3d, 2024-01-15), by the end of week or
+                    month, or overdue / none
+  --list <name>     Tasks in a smart list
+  --deferred        Include tasks whose start date is still ahead
+                    (hidden by default, or by the show_deferred setting)
+  --sort <order>    Order by priority, due, title, status, created,
+                    updated, estimate or manual, each optionally asc
+                    or desc, e.g. "due, priority desc". Defaults to
+                    the order saved with :sort in the TUI
+
+Queries:
+  klonch list 'project:work and (tag:review or priority>=high) and due<+3d'
+
+  Fields:    project tag status state priority due start created
+             updated completed estimate title description text is has
+  Operators: : = != < <= > >=, and, or, not, ( ), comma for any of
+  Shorthand: #project @tag !priority; bare words search titles
+  Dates:     as in quick add (today fri eow +3d -2w 2024-01-15,
+             quoted "next fri"), the spans week month year lastweek
+             nextweek lastmonth nextmonth, or none
+  is:        open done overdue deferred subtask blocked recurring
+  has:       due start estimate project tags subtasks description
+
+  Queries that mention status or is: list every status unless --status
+  is given. Start negations with "not" rather than "-" on the shell.
+
+Edit Flags:
+  --title <text>    --priority <low|medium|high|urgent>
+  --due <date|none> --start <date|none>
+  --estimate <45m|2h|none>
+  --project <name|none>
+  --remind <1d,1h|none|default>
+  --description <text|none>
+
+  Without flags the task opens in $VISUAL or $EDITOR as a document:
+  the fields between --- lines, then the description in Markdown.
+  Changed fields are saved when the editor exits, as one undo step.
+
+Reminders:
+  Reminders go off before a task is due, at the offsets set with
+  --remind or :remind, or else reminders.default (1h,0: an hour
+  before and when it falls due). All-day due dates count back from
+  reminders.all_day (09:00). The TUI sends them while it runs;
+  klonch remind --daemon does the same without it, e.g. as a systemd
+  user service. Reminders that went off while neither was running
+  are reported on the next start. Both also warn once about a timer
+  running longer than timer.long_after (4h).
+
+Notifications:
+  Pomodoro alerts, reminders and timer warnings go to every backend
+  in notify.backends (set with :set in the TUI), comma-separated:
+    auto         D-Bus, else notify-send, else the terminal; the
+                 terminal first over SSH (the default)
+    dbus         org.freedesktop.Notifications on the session bus
+    notify-send  The notify-send command
+    terminal     OSC 9/777 escapes and the bell, TUI only
+    command      notify.command, run by sh with $KLONCH_TITLE,
+                 $KLONCH_BODY and $KLONCH_URGENCY set
+    ntfy         POST to the topic URL in notify.url
+    gotify       POST to the server in notify.url
+    none         No notifications
+  notify.token is sent to ntfy or Gotify. klonch notify test --backend
+  <names> tries backends without changing the setting.
 
 TUI Options:
-  --view <name>     Starting view (list, kanban, eisenhower, calendar, pomodoro)
+  --view <name>     Starting view (list, kanban, eisenhower, calendar, pomodoro,
+                    planning, review, stats, timesheet); defaults to the last
+                    one used
+  --view focus:<id> Start in focus mode on a task (an ID prefix will do)
   --theme <name>    Theme (nord, dracula, gruvbox, catppuccin)
+  --data-dir <dir>  Data directory (default ~/.local/share/klonch)
+  --db <file>       Database file (default <data-dir>/klonch.db)
 
 TUI Keybindings:
   Navigation:   j/k ↑/↓       Move cursor
@@ -94,7 +263,7 @@ TUI Keybindings:
                 A             Toggle Active/All
                 Esc           Clear filters
 
-  Views:        1-8           Switch views
+  Views:        1-9           Switch views
                 :             Command palette
                 ?             Help
                 q             Quit
@@ -105,14 +274,22 @@ For more: https://github.com/dori/klonch`
 }
 
 func handleAdd(args []string) {
+	fs := newFlagSet("add")
+	dbf := addDBFlags(fs)
+	args = parseText(fs, args)
 	if len(args) == 0 {
+		if jsonOutput {
+			fatalf("usage: klonch add <task>")
+		}
 		fmt.Fprintln(os.Stderr, "Usage: klonch add <task>")
 		fmt.Fprintln(os.Stderr, "")
 		fmt.Fprintln(os.Stderr, "Examples:")
 		fmt.Fprintln(os.Stderr, "  klonch add \"Buy groceries\"")
 		fmt.Fprintln(os.Stderr, "  klonch add \"Review PR #work @urgent !high due:tomorrow\"")
 		fmt.Fprintln(os.Stderr, "")
-		fmt.Fprintln(os.Stderr, "Syntax: #project @tag !priority due:date")
+		fmt.Fprintln(os.Stderr, "  klonch add \"Call Sam due:fri 14:00 ~15m\"")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Syntax: #project @tag !priority due:date start:date ~estimate")
 		os.Exit(1)
 	}
 
@@ -120,256 +297,158 @@ func handleAdd(args []string) {
 	text := strings.Join(args, " ")
 
 	// Parse the task text
-	task := parseQuickAdd(text)
+	parsed := parse.QuickAdd(text, time.Now())
 
 	// Open database (no lock needed for quick add - just insert)
-	database, err := db.Open(db.DefaultDBPath())
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
-		os.Exit(1)
-	}
+	database := dbf.open()
 	defer database.Close()
 
-	// Find or create project
-	projectID := "inbox"
-	projectName := "Inbox"
-	if task.parsedProject != "" {
-		// Try to find existing project by name (case-insensitive)
-		row := database.QueryRow(`
-			SELECT id, name FROM projects
-			WHERE LOWER(name) = LOWER(?) AND archived = 0
-		`, task.parsedProject)
-
-		var existingID, existingName string
-		if err := row.Scan(&existingID, &existingName); err == nil {
-			projectID = existingID
-			projectName = existingName
-		} else {
-			// Create new project
-			projectID = strings.ToLower(task.parsedProject)
-			projectName = task.parsedProject
-			now := time.Now()
-			database.Exec(`
-				INSERT OR IGNORE INTO projects (id, name, position, archived, created_at, updated_at)
-				VALUES (?, ?, 0, 0, ?, ?)
-			`, projectID, projectName, now, now)
-		}
-	}
-
-	// Insert task
-	now := time.Now()
-	var dueDate interface{}
-	if task.DueDate != nil {
-		dueDate = task.DueDate.Format(time.RFC3339)
-	}
-
-	_, err = database.Exec(`
-		INSERT INTO tasks (id, title, status, priority, project_id, due_date, created_at, updated_at)
-		VALUES (?, ?, 'pending', ?, ?, ?, ?, ?)
-	`, task.ID, task.Title, task.Priority, projectID, dueDate, now, now)
+	// Project, tags and task are undone together
+	database = database.Group("Add task")
 
+	task, err := database.AddQuickTask(parsed, model.Task{}, nil)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating task: %v\n", err)
-		os.Exit(1)
-	}
-
-	// Create tags and associations
-	for _, tagName := range task.parsedTags {
-		// Ensure tag exists
-		tagID := strings.ToLower(strings.TrimPrefix(tagName, "@"))
-		database.Exec(`
-			INSERT OR IGNORE INTO tags (id, name, created_at) VALUES (?, ?, ?)
-		`, tagID, tagName, now)
-
-		// Associate tag with task
-		database.Exec(`
-			INSERT OR IGNORE INTO task_tags (task_id, tag_id) VALUES (?, ?)
-		`, task.ID, tagID)
+		fatalf("creating task: %v", err)
 	}
 
 	// Output
+	if jsonOutput {
+		printTask(database, "Created", task)
+		return
+	}
 	fmt.Printf("Created: %s\n", task.Title)
-	if projectID != "inbox" {
-		fmt.Printf("Project: %s\n", projectName)
+	if task.Project != nil {
+		fmt.Printf("Project: %s\n", task.Project.Name)
 	}
 	if task.DueDate != nil {
 		fmt.Printf("Due: %s\n", formatDueDate(*task.DueDate))
 	}
+	if task.StartDate != nil {
+		fmt.Printf("Starts: %s\n", formatDueDate(*task.StartDate))
+	}
+	if task.TimeEstimate != nil {
+		fmt.Printf("Estimate: %s\n", model.FormatEstimate(*task.TimeEstimate))
+	}
 	if task.Priority != model.PriorityMedium {
 		fmt.Printf("Priority: %s\n", task.Priority)
 	}
-	if len(task.parsedTags) > 0 {
-		fmt.Printf("Tags: %s\n", strings.Join(task.parsedTags, ", "))
+	if len(parsed.Tags) > 0 {
+		fmt.Printf("Tags: %s\n", strings.Join(parsed.Tags, ", "))
 	}
 }
 
-type quickAddTask struct {
-	model.Task
-	parsedTags    []string
-	parsedProject string
-}
-
-func parseQuickAdd(text string) quickAddTask {
-	task := quickAddTask{
-		Task: model.Task{
-			ID:       uuid.New().String(),
-			Priority: model.PriorityMedium,
-		},
-	}
-
-	words := strings.Fields(text)
-	var titleParts []string
-
-	for _, word := range words {
-		switch {
-		// Project (#work, #personal, etc.)
-		case strings.HasPrefix(word, "#"):
-			task.parsedProject = strings.TrimPrefix(word, "#")
-
-		// Tags (@home, @work, etc.)
-		case strings.HasPrefix(word, "@"):
-			task.parsedTags = append(task.parsedTags, word)
-
-		// Priority (!low, !high, etc.)
-		case strings.HasPrefix(word, "!"):
-			priority := strings.ToLower(strings.TrimPrefix(word, "!"))
-			switch priority {
-			case "low", "l":
-				task.Priority = model.PriorityLow
-			case "medium", "med", "m":
-				task.Priority = model.PriorityMedium
-			case "high", "hi", "h":
-				task.Priority = model.PriorityHigh
-			case "urgent", "u":
-				task.Priority = model.PriorityUrgent
-			default:
-				titleParts = append(titleParts, word)
-			}
-
-		// Due date (due:tomorrow, due:friday, due:2024-01-15)
-		case strings.HasPrefix(strings.ToLower(word), "due:"):
-			dateStr := strings.TrimPrefix(strings.ToLower(word), "due:")
-			if parsed := parseNaturalDate(dateStr); parsed != nil {
-				task.DueDate = parsed
-			} else {
-				titleParts = append(titleParts, word)
-			}
-
-		default:
-			titleParts = append(titleParts, word)
-		}
+// parseNaturalDate reads a date with an optional time, e.g. "fri 14:00"
+func parseNaturalDate(s string) *time.Time {
+	t, ok := parse.Date(s, time.Now())
+	if !ok {
+		return nil
 	}
-
-	task.Title = strings.Join(titleParts, " ")
-	return task
+	return &t
 }
 
-func parseNaturalDate(s string) *time.Time {
+func formatDueDate(t time.Time) string {
 	now := time.Now()
-	today := time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 0, now.Location())
-
-	switch strings.ToLower(s) {
-	case "today":
-		return &today
-	case "tomorrow", "tom":
-		t := today.AddDate(0, 0, 1)
-		return &t
-	case "monday", "mon":
-		return nextWeekday(time.Monday)
-	case "tuesday", "tue":
-		return nextWeekday(time.Tuesday)
-	case "wednesday", "wed":
-		return nextWeekday(time.Wednesday)
-	case "thursday", "thu":
-		return nextWeekday(time.Thursday)
-	case "friday", "fri":
-		return nextWeekday(time.Friday)
-	case "saturday", "sat":
-		return nextWeekday(time.Saturday)
-	case "sunday", "sun":
-		return nextWeekday(time.Sunday)
-	case "nextweek":
-		t := today.AddDate(0, 0, 7)
-		return &t
-	}
 
-	// Try parsing as date
-	formats := []string{
-		"2006-01-02",
-		"01/02/2006",
-		"01-02-2006",
-		"Jan 2",
-		"Jan 2, 2006",
+	clock := ""
+	if model.HasClock(t) {
+		clock = t.Format(" 15:04")
 	}
 
-	for _, format := range formats {
-		if t, err := time.Parse(format, s); err == nil {
-			// If no year, use current year
-			if t.Year() == 0 {
-				t = time.Date(now.Year(), t.Month(), t.Day(), 23, 59, 59, 0, now.Location())
-			}
-			return &t
-		}
+	switch days := model.DaysBetween(now, t); {
+	case days == 0:
+		return "today" + clock
+	case days == 1:
+		return "tomorrow" + clock
+	case t.Year() == now.Year():
+		return t.Format("Mon, Jan 2") + clock
 	}
 
-	return nil
+	return t.Format("Jan 2, 2006") + clock
 }
 
-func nextWeekday(day time.Weekday) *time.Time {
-	now := time.Now()
-	today := time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 0, now.Location())
-
-	daysUntil := int(day - now.Weekday())
-	if daysUntil <= 0 {
-		daysUntil += 7
+// appConfig builds the app config from the --data-dir and --db flags.
+// A database given on its own keeps its lock file next to it.
+func appConfig(dataDir, dbPath string) *app.Config {
+	cfg := app.DefaultConfig()
+	if dataDir != "" {
+		cfg.DataDir = dataDir
+		cfg.DBPath = filepath.Join(dataDir, "klonch.db")
 	}
-
-	t := today.AddDate(0, 0, daysUntil)
-	return &t
+	if dbPath != "" {
+		cfg.DBPath = dbPath
+		if dataDir == "" {
+			cfg.DataDir = filepath.Dir(dbPath)
+		}
+	}
+	return cfg
 }
 
-func formatDueDate(t time.Time) string {
-	now := time.Now()
-
-	if t.Year() == now.Year() && t.YearDay() == now.YearDay() {
-		return "today"
+// themeNames lists the available theme names
+func themeNames() []string {
+	var names []string
+	for _, t := range theme.Available() {
+		names = append(names, t.Name)
 	}
+	return names
+}
 
-	tomorrow := now.AddDate(0, 0, 1)
-	if t.Year() == tomorrow.Year() && t.YearDay() == tomorrow.YearDay() {
-		return "tomorrow"
+func runTUI(cfg *app.Config, startView, themeName string) error {
+	// Check names before taking the lock so typos fail fast
+	if themeName != "" {
+		if _, ok := theme.ByName(themeName); !ok {
+			return fmt.Errorf("unknown theme %q (available: %s)", themeName, strings.Join(themeNames(), ", "))
+		}
 	}
 
-	if t.Year() == now.Year() {
-		return t.Format("Mon, Jan 2")
+	var focusTaskID string
+	if name, id, ok := strings.Cut(startView, ":"); ok && strings.EqualFold(name, "focus") {
+		focusTaskID = strings.TrimSpace(id)
+		if focusTaskID == "" {
+			return fmt.Errorf("focus view needs a task: --view focus:<task-id>")
+		}
+	} else if startView != "" {
+		v, err := ui.ParseView(startView)
+		if err != nil {
+			return err
+		}
+		if v == ui.ViewFocus {
+			return fmt.Errorf("focus view needs a task: --view focus:<task-id>")
+		}
 	}
 
-	return t.Format("Jan 2, 2006")
-}
-
-func runTUI(startView, themeName string) error {
 	// Create application
-	application, err := app.New(nil)
+	application, err := app.New(cfg)
 	if err != nil {
 		return err
 	}
 	defer application.Close()
 
-	// Set theme if specified
-	if themeName != "" {
-		// Theme setting would happen here
-		// For now, theme is set in the root model
+	opts := ui.Options{View: startView, Theme: themeName}
+	if focusTaskID != "" {
+		// A short ID prefix will do, as everywhere else on the command line
+		id, err := application.DB.ResolveTaskID(focusTaskID)
+		if err != nil {
+			return err
+		}
+		task, err := application.DB.GetTask(id)
+		if err != nil {
+			return err
+		}
+		if task == nil {
+			return fmt.Errorf("no task matches %q", focusTaskID)
+		}
+		opts.FocusTask = task
 	}
 
 	// Create root model
-	model := ui.NewRootModel(application)
+	model := ui.NewRootModel(application, opts)
 
 	// Create and run program
-	p := tea.NewProgram(
-		model,
-		tea.WithAltScreen(),
-		tea.WithMouseCellMotion(),
-	)
+	programOpts := []tea.ProgramOption{tea.WithAltScreen()}
+	if mouse, err := application.DB.GetBoolSetting(db.SettingMouse); err != nil || mouse {
+		programOpts = append(programOpts, tea.WithMouseCellMotion())
+	}
+	p := tea.NewProgram(model, programOpts...)
 
 	_, err = p.Run()
 	return err
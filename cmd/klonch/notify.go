@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dori/klonch/internal/app"
+	"github.com/dori/klonch/internal/notify"
+)
+
+// notifyTestOutput is the --json shape of one backend's test result
+type notifyTestOutput struct {
+	Backend string `json:"backend"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+}
+
+// handleNotify lists the configured notification backends, or with test
+// sends a notification through each of them and reports how it went
+func handleNotify(args []string) {
+	fs := newFlagSet("notify")
+	backends := fs.String("backend", "", "Backends to use instead of notify.backends, e.g. terminal,ntfy")
+	dbf := addDBFlags(fs)
+	rest := parseArgs(fs, args)
+	if len(rest) > 1 || (len(rest) == 1 && rest[0] != "test") {
+		fatalf("usage: klonch notify [test] [--backend <names>]")
+	}
+
+	database := dbf.open()
+	defer database.Close()
+
+	cfg := app.NotifyConfig(database, os.Stderr)
+	if *backends != "" {
+		names, err := notify.ParseBackends(*backends)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		cfg.Backends = names
+	}
+	chain, err := notify.New(cfg)
+	if err != nil {
+		fatalf("setting up notifications: %v", err)
+	}
+
+	if len(rest) == 0 {
+		for _, b := range chain.Backends() {
+			if jsonOutput {
+				printJSON(map[string]string{"backend": b.Name})
+			} else {
+				fmt.Println(b.Name)
+			}
+		}
+		return
+	}
+
+	if len(chain.Backends()) == 0 {
+		fatalf("no notification backends configured (notify.backends is %q)", strings.Join(cfg.Backends, ","))
+	}
+	failed := false
+	for _, b := range chain.Backends() {
+		err := b.Notifier.Send(notify.Simple("klonch", "Test notification through "+b.Name))
+		failed = failed || err != nil
+		if jsonOutput {
+			out := notifyTestOutput{Backend: b.Name, OK: err == nil}
+			if err != nil {
+				out.Error = err.Error()
+			}
+			printJSON(out)
+			continue
+		}
+		if err != nil {
+			fmt.Printf("%-12s failed: %v\n", b.Name, err)
+		} else {
+			fmt.Printf("%-12s sent\n", b.Name)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/dori/klonch/internal/db"
+	"github.com/dori/klonch/internal/model"
+)
+
+// jsonOutput is set by --json. Commands then print one JSON object per line
+// on stdout instead of text, and failures print {"error": "..."}.
+var jsonOutput bool
+
+// taskOutput is the --json shape of a task. It extends the model's own JSON
+// with resolved names and computed state; fields documented in README.md.
+type taskOutput struct {
+	model.Task
+	ShortID  string       `json:"short_id"`
+	Project  *projectRef  `json:"project"`
+	State    string       `json:"state"`
+	Tags     []string     `json:"tags"`
+	Repeats  string       `json:"repeats,omitempty"`
+	Blocked  bool         `json:"blocked"`
+	Subtasks []taskOutput `json:"subtasks"`
+}
+
+// showOutput is the --json shape of klonch show: the task with its
+// comments and activity
+type showOutput struct {
+	taskOutput
+	Comments []model.Comment  `json:"comments"`
+	Activity []model.Activity `json:"activity"`
+}
+
+type projectRef struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// tagOutput is the --json shape of a tag
+type tagOutput struct {
+	model.Tag
+	OpenTasks int `json:"open_tasks"`
+}
+
+// projectOutput is the --json shape of a project
+type projectOutput struct {
+	model.Project
+	OpenTasks int `json:"open_tasks"`
+	DoneTasks int `json:"done_tasks"`
+}
+
+// errorOutput is printed instead of text errors in JSON mode
+type errorOutput struct {
+	Error string `json:"error"`
+}
+
+// printJSON writes v as a single line of JSON
+func printJSON(v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(errorOutput{Error: err.Error()})
+	}
+	fmt.Println(string(data))
+}
+
+// newTaskOutput loads everything --json reports about a task. Subtasks are
+// included one level deep.
+func newTaskOutput(database *db.DB, t *model.Task, projects map[string]string) taskOutput {
+	out := taskOutput{
+		Task:     *t,
+		ShortID:  t.ShortID(),
+		Tags:     []string{},
+		Subtasks: []taskOutput{},
+	}
+	if t.ProjectID != nil {
+		out.Project = &projectRef{ID: *t.ProjectID, Name: projects[*t.ProjectID]}
+	}
+	out.State = stateName(taskWorkflow(database, t), t)
+	if tags, err := database.GetTaskTags(t.ID); err == nil {
+		for _, tag := range tags {
+			out.Tags = append(out.Tags, tag.DisplayName())
+		}
+	}
+	if rule := t.RecurrenceRule(); rule != nil {
+		out.Repeats = rule.String()
+	}
+	out.Blocked, _ = database.IsTaskBlocked(t.ID)
+
+	if t.ParentID == nil {
+		if subtasks, err := database.GetSubtasks(t.ID); err == nil {
+			for i := range subtasks {
+				out.Subtasks = append(out.Subtasks, newTaskOutput(database, &subtasks[i], projects))
+			}
+		}
+	}
+	return out
+}
+
+// printTask reports a task after a command acted on it, either as JSON or
+// with a short verb such as "Completed"
+func printTask(database *db.DB, verb string, t *model.Task) {
+	if !jsonOutput {
+		fmt.Printf("%s: %s\n", verb, t.Title)
+		return
+	}
+	if fresh, err := database.GetTask(t.ID); err == nil && fresh != nil {
+		t = fresh
+	}
+	printJSON(newTaskOutput(database, t, projectNames(database)))
+}
+
+// stripJSONFlag removes --json given before the subcommand, as in
+// klonch --json list, and turns on JSON output. After it each subcommand's
+// flags take --json, so it follows their rules, "--" included.
+func stripJSONFlag(args []string) []string {
+	for len(args) > 0 && (args[0] == "--json" || args[0] == "-json") {
+		jsonOutput = true
+		args = args[1:]
+	}
+	return args
+}
+
+// exitWithError reports a failure in the current output mode and exits
+func exitWithError(err error) {
+	if jsonOutput {
+		printJSON(errorOutput{Error: err.Error()})
+	} else {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	os.Exit(1)
+}
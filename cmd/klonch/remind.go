@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dori/klonch/internal/app"
+	"github.com/dori/klonch/internal/db"
+	"github.com/dori/klonch/internal/model"
+	"github.com/dori/klonch/internal/notify"
+)
+
+// reminderOutput is the --json shape of an upcoming reminder
+type reminderOutput struct {
+	At      time.Time  `json:"at"`
+	TaskID  string     `json:"task_id"`
+	ShortID string     `json:"short_id"`
+	Title   string     `json:"title"`
+	DueDate *time.Time `json:"due_date"`
+}
+
+// handleRemind lists the reminders coming up in the next week, or with
+// --daemon keeps running and sends them as they go off
+func handleRemind(args []string) {
+	fs := newFlagSet("remind")
+	daemon := fs.Bool("daemon", false, "Keep running and send reminders as they go off")
+	interval := fs.Duration("interval", 30*time.Second, "How often the daemon checks for reminders")
+	dbf := addDBFlags(fs)
+	if rest := parseArgs(fs, args); len(rest) > 0 {
+		fatalf("unexpected argument %q (set a task's reminders with klonch edit <id> --remind)", rest[0])
+	}
+	if *interval < time.Second {
+		fatalf("--interval must be at least a second")
+	}
+
+	database := dbf.open()
+	defer database.Close()
+
+	if *daemon {
+		runReminderDaemon(database, *interval)
+		return
+	}
+
+	now := time.Now()
+	upcoming, err := database.UpcomingReminders(now, now.AddDate(0, 0, 7))
+	if err != nil {
+		fatalf("loading reminders: %v", err)
+	}
+	for _, r := range upcoming {
+		if jsonOutput {
+			printJSON(reminderOutput{At: r.At, TaskID: r.Task.ID, ShortID: r.Task.ShortID(),
+				Title: r.Task.Title, DueDate: r.Task.DueDate})
+			continue
+		}
+		fmt.Printf("%-18s %s %s (due %s)\n", formatDueDate(r.At), r.Task.ShortID(), r.Task.Title,
+			formatDueDate(*r.Task.DueDate))
+	}
+}
+
+// runReminderDaemon sends reminders until interrupted. It takes no lock, so
+// it can run all the time alongside the TUI; each reminder is claimed in the
+// database by whichever of them notices it first. Missed reminders are
+// summed up in one notification. Timers left running longer than
+// timer.long_after are reported the same way.
+func runReminderDaemon(database *db.DB, interval time.Duration) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	notifier, err := notify.New(app.NotifyConfig(database, nil))
+	if err != nil {
+		fatalf("setting up notifications: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "klonch: sending reminders, checking every %s\n", interval)
+	for {
+		// Pick up notification settings changed since the last check
+		if err := notifier.Configure(app.NotifyConfig(database, nil)); err != nil {
+			fmt.Fprintf(os.Stderr, "klonch: notification settings: %v\n", err)
+		}
+		sendReminders(database, notifier, time.Now())
+		sendLongTimer(database, notifier, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// sendReminders claims and sends the reminders that have gone off by now,
+// logging failures rather than stopping
+func sendReminders(database *db.DB, notifier notify.Notifier, now time.Time) {
+	reminders, err := database.ClaimReminders(now)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "klonch: checking reminders: %v\n", err)
+		return
+	}
+
+	var missed []string
+	for _, r := range reminders {
+		if r.Missed {
+			missed = append(missed, r.Task.Title)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "klonch: reminder for %s %s\n", r.Task.ShortID(), r.Task.Title)
+		if err := notifier.Send(notify.DueReminder(r.Task.Title, r.Task.DueDate.Sub(now))); err != nil {
+			fmt.Fprintf(os.Stderr, "klonch: sending reminder: %v\n", err)
+		}
+	}
+	if len(missed) > 0 {
+		fmt.Fprintf(os.Stderr, "klonch: %d missed reminders\n", len(missed))
+		if err := notifier.Send(notify.MissedReminders(missed)); err != nil {
+			fmt.Fprintf(os.Stderr, "klonch: sending reminder: %v\n", err)
+		}
+	}
+}
+
+// sendLongTimer warns about a timer that has been running for longer than
+// timer.long_after, once
+func sendLongTimer(database *db.DB, notifier notify.Notifier, now time.Time) {
+	cfg, err := database.TimerConfig()
+	if err != nil || cfg.LongAfter == 0 {
+		return
+	}
+	e, err := database.ClaimLongTimer(cfg.LongAfter, now)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "klonch: checking timers: %v\n", err)
+		return
+	}
+	if e == nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "klonch: timer running for %s\n", model.FormatEstimate(int(e.Elapsed(now).Minutes())))
+	if err := notifier.Send(notify.LongTimer(e.TaskTitle, e.Elapsed(now))); err != nil {
+		fmt.Fprintf(os.Stderr, "klonch: sending timer alert: %v\n", err)
+	}
+}
+
+// formatReminders describes a task's reminders for klonch show
+func formatReminders(database *db.DB, t *model.Task) string {
+	policy, err := database.ReminderPolicy()
+	if err != nil {
+		return ""
+	}
+	text := model.FormatReminders(t.ReminderOffsets(policy.Default))
+	if t.Reminders == nil {
+		text += " (default)"
+	}
+	return text
+}
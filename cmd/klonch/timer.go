@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dori/klonch/internal/db"
+	"github.com/dori/klonch/internal/model"
+	"github.com/dori/klonch/internal/parse"
+)
+
+// timerOutput is the --json shape of klonch timer status
+type timerOutput struct {
+	Running          bool       `json:"running"`
+	TaskID           string     `json:"task_id,omitempty"`
+	ShortID          string     `json:"short_id,omitempty"`
+	Title            string     `json:"title,omitempty"`
+	StartedAt        *time.Time `json:"started_at,omitempty"`
+	ElapsedSeconds   int        `json:"elapsed_seconds"`
+	Pomodoro         bool       `json:"pomodoro"`
+	Paused           bool       `json:"paused"`
+	RemainingSeconds *int       `json:"remaining_seconds,omitempty"`
+}
+
+// timerStopOutput is the --json shape of klonch timer stop
+type timerStopOutput struct {
+	Minutes int    `json:"minutes"`
+	TaskID  string `json:"task_id,omitempty"`
+	Title   string `json:"title,omitempty"`
+}
+
+// handleTimer reports the running timer, in one short line for status bars,
+// or stops it
+func handleTimer(args []string) {
+	fs := newFlagSet("timer")
+	at := fs.String("at", "", "With stop: when it stopped, e.g. 17:30 or 1h30m after it started")
+	dbf := addDBFlags(fs)
+	rest := parseArgs(fs, args)
+	cmd := "status"
+	if len(rest) > 0 {
+		cmd = rest[0]
+	}
+	if len(rest) > 1 || (cmd != "status" && cmd != "stop") || (*at != "" && cmd != "stop") {
+		fatalf("usage: klonch timer [status | stop [--at <time>]]")
+	}
+
+	database := dbf.open()
+	defer database.Close()
+
+	entry, err := database.RunningTimer()
+	if err != nil {
+		fatalf("loading timer: %v", err)
+	}
+	var task *model.Task
+	if entry != nil && entry.TaskID != "" {
+		task, _ = database.GetTask(entry.TaskID)
+	}
+
+	if cmd == "stop" {
+		stopTimer(database, entry, task, *at)
+		return
+	}
+
+	if entry == nil {
+		// Status bars show nothing while no timer runs
+		if jsonOutput {
+			printJSON(timerOutput{})
+		}
+		return
+	}
+
+	now := time.Now()
+	elapsed := entry.Elapsed(now)
+	out := timerOutput{
+		Running:        true,
+		StartedAt:      &entry.StartedAt,
+		ElapsedSeconds: int(elapsed.Seconds()),
+		Pomodoro:       entry.IsPomodoro,
+		Paused:         entry.IsPaused(),
+	}
+	if task != nil {
+		out.TaskID, out.ShortID, out.Title = task.ID, task.ShortID(), task.Title
+	}
+	var reading string
+	if entry.IsPomodoro {
+		cfg, _ := database.PomodoroConfig()
+		remaining := cfg.Work - elapsed
+		if remaining < 0 {
+			remaining = 0
+		}
+		seconds := int(remaining.Seconds())
+		out.RemainingSeconds = &seconds
+		reading = fmt.Sprintf("🍅 %d:%02d", seconds/60, seconds%60)
+	} else {
+		minutes := int(elapsed.Minutes())
+		reading = fmt.Sprintf("%d:%02d", minutes/60, minutes%60)
+	}
+
+	if jsonOutput {
+		printJSON(out)
+		return
+	}
+	if out.Title != "" {
+		reading += " " + out.Title
+	}
+	if out.Paused {
+		reading += " (paused)"
+	}
+	fmt.Println(reading)
+}
+
+// stopTimer stops the running timer now or at the time given
+func stopTimer(database *db.DB, entry *model.TimeEntry, task *model.Task, at string) {
+	if entry == nil {
+		fatalf("no timer is running")
+	}
+	end := time.Now()
+	if at != "" {
+		var ok bool
+		if end, ok = parse.EndAt(at, entry.StartedAt, end); !ok {
+			fatalf("--at %q: want a time between %s and now, or how long it ran",
+				at, entry.StartedAt.Format("2006-01-02 15:04"))
+		}
+	}
+
+	minutes, err := database.StopTimer(entry.ID, end)
+	if err != nil {
+		fatalf("stopping timer: %v", err)
+	}
+	if jsonOutput {
+		out := timerStopOutput{Minutes: minutes}
+		if task != nil {
+			out.TaskID, out.Title = task.ID, task.Title
+		}
+		printJSON(out)
+		return
+	}
+	if task != nil {
+		fmt.Printf("Stopped timer: %d minutes logged to %s\n", minutes, task.Title)
+	} else {
+		fmt.Printf("Stopped timer: %d minutes logged\n", minutes)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dori/klonch/internal/db"
+	"github.com/dori/klonch/internal/model"
+)
+
+// handleWorkflow shows a project's Kanban columns, or changes them:
+// klonch workflow <project> [add <name> <category> [--at N] | rename <state> <name> |
+// move <state> <N> | limit <state> <N> | rm <state> | reset]
+func handleWorkflow(args []string) {
+	fs := newFlagSet("workflow")
+	at := fs.Int("at", 0, "With add: the position of the new state, counting from 1")
+	dbf := addDBFlags(fs)
+	rest := parseArgs(fs, args)
+	if len(rest) == 0 {
+		fatalf("usage: klonch workflow <project> [add <name> <open|active|done> [--at N] | rename <state> <name> | move <state> <N> | limit <state> <N> | rm <state> | reset]")
+	}
+
+	database := dbf.open()
+	defer database.Close()
+
+	project := resolveProject(database, rest[0])
+	w, err := database.GetWorkflow(project.ID)
+	if err != nil {
+		fatalf("loading workflow: %v", err)
+	}
+
+	if len(rest) > 1 {
+		cmd, rest := rest[1], rest[2:]
+		switch cmd {
+		case "add":
+			if len(rest) != 2 {
+				fatalf("usage: klonch workflow <project> add <name> <open|active|done> [--at N]")
+			}
+			category, err := model.ParseCategory(rest[1])
+			if err != nil {
+				fatalf("%v", err)
+			}
+			if _, err := database.AddWorkflowState(project.ID, rest[0], category, *at); err != nil {
+				fatalf("adding state: %v", err)
+			}
+		case "rename":
+			if len(rest) < 2 {
+				fatalf("usage: klonch workflow <project> rename <state> <name>")
+			}
+			state, name := resolveState(w, rest[0]), strings.Join(rest[1:], " ")
+			if i := w.Find(name); i >= 0 && w[i].Name != state.Name {
+				fatalf("the workflow already has a state named %q", name)
+			}
+			group := database.Group("Rename workflow state")
+			if err := group.RenameWorkflowState(ownStateID(group, project, state), name); err != nil {
+				fatalf("renaming state: %v", err)
+			}
+		case "move":
+			if len(rest) != 2 {
+				fatalf("usage: klonch workflow <project> move <state> <position>")
+			}
+			position, err := strconv.Atoi(rest[1])
+			if err != nil || position < 1 {
+				fatalf("invalid position %q (counting from 1)", rest[1])
+			}
+			state := resolveState(w, rest[0])
+			group := database.Group("Move workflow state")
+			if err := group.MoveWorkflowState(ownStateID(group, project, state), position); err != nil {
+				fatalf("moving state: %v", err)
+			}
+		case "limit":
+			if len(rest) != 2 {
+				fatalf("usage: klonch workflow <project> limit <state> <N> (0 for no limit)")
+			}
+			limit, err := strconv.Atoi(rest[1])
+			if err != nil || limit < 0 {
+				fatalf("invalid WIP limit %q (a whole number, 0 for none)", rest[1])
+			}
+			state := resolveState(w, rest[0])
+			group := database.Group("Set WIP limit")
+			if err := group.SetWorkflowStateLimit(ownStateID(group, project, state), limit); err != nil {
+				fatalf("setting WIP limit: %v", err)
+			}
+		case "rm":
+			if len(rest) != 1 {
+				fatalf("usage: klonch workflow <project> rm <state>")
+			}
+			state := resolveState(w, rest[0])
+			// Check before copying the default workflow for nothing
+			alone := true
+			for _, s := range w {
+				if s.Category == state.Category && s.Name != state.Name {
+					alone = false
+				}
+			}
+			if alone {
+				fatalf("%q is the only %s state; a workflow needs an open, an active and a done state", state.Name, state.Category)
+			}
+			group := database.Group("Remove workflow state")
+			if err := group.RemoveWorkflowState(ownStateID(group, project, state)); err != nil {
+				fatalf("removing state: %v", err)
+			}
+		case "reset":
+			if len(rest) != 0 {
+				fatalf("usage: klonch workflow <project> reset")
+			}
+			if err := database.ResetWorkflow(project.ID); err != nil {
+				fatalf("resetting workflow: %v", err)
+			}
+		default:
+			fatalf("unknown workflow command %q (want add, rename, move, limit, rm or reset)", cmd)
+		}
+		if w, err = database.GetWorkflow(project.ID); err != nil {
+			fatalf("loading workflow: %v", err)
+		}
+	}
+
+	width := 0
+	for _, s := range w {
+		if len(s.Name) > width {
+			width = len(s.Name)
+		}
+	}
+	for i, s := range w {
+		if jsonOutput {
+			printJSON(s)
+			continue
+		}
+		if s.WIPLimit > 0 {
+			fmt.Printf("%d. %-*s  %-6s  WIP %d\n", i+1, width, s.Name, s.Category, s.WIPLimit)
+			continue
+		}
+		fmt.Printf("%d. %-*s  %s\n", i+1, width, s.Name, s.Category)
+	}
+	if !jsonOutput && w.IsDefault() {
+		fmt.Println("(the default workflow)")
+	}
+}
+
+// handleMove puts a task in a column of its project's workflow
+func handleMove(args []string) {
+	fs := newFlagSet("move")
+	dbf := addDBFlags(fs)
+	rest := parseArgs(fs, args)
+	if len(rest) < 2 {
+		fatalf("usage: klonch move <id> <state>")
+	}
+
+	database := dbf.open()
+	defer database.Close()
+
+	t := resolveTask(database, rest[0])
+	w := taskWorkflow(database, t)
+	state := resolveState(w, strings.Join(rest[1:], " "))
+
+	// A state of the project's own workflow is on the project's board; one
+	// of the default workflow is on the board of every project
+	boardProjectID := ""
+	if state.ID != "" {
+		boardProjectID = state.ProjectID
+	}
+	if err := database.CheckWIPLimit(boardProjectID, t.ID, state); err != nil {
+		fatalf("moving %s: %v", t.ShortID(), err)
+	}
+	if err := database.SetTaskState(t.ID, state); err != nil {
+		fatalf("moving %s: %v", t.ShortID(), err)
+	}
+	printTask(database, "Moved to "+state.Name, t)
+}
+
+// resolveState finds a state of a workflow by name or position, or exits
+func resolveState(w model.Workflow, name string) model.WorkflowState {
+	if i := w.Find(name); i >= 0 {
+		return w[i]
+	}
+	if n, err := strconv.Atoi(name); err == nil && n >= 1 && n <= len(w) {
+		return w[n-1]
+	}
+	var names []string
+	for _, s := range w {
+		names = append(names, s.Name)
+	}
+	fatalf("no state named %q (want %s)", name, strings.Join(names, ", "))
+	return model.WorkflowState{}
+}
+
+// ownStateID returns the ID of a state in the project's own workflow,
+// copying the default workflow first when the state is one of its columns.
+// Pass a group so that the copy and the change to it undo together.
+func ownStateID(database *db.DB, project *model.Project, state model.WorkflowState) string {
+	if state.ID != "" {
+		return state.ID
+	}
+	if err := database.CustomizeWorkflow(project.ID); err != nil {
+		fatalf("copying the default workflow: %v", err)
+	}
+	w, err := database.GetWorkflow(project.ID)
+	if err != nil {
+		fatalf("loading workflow: %v", err)
+	}
+	return resolveState(w, state.Name).ID
+}
+
+// taskWorkflow loads the workflow of a task's project
+func taskWorkflow(database *db.DB, t *model.Task) model.Workflow {
+	projectID := ""
+	if t.ProjectID != nil {
+		projectID = *t.ProjectID
+	}
+	w, err := database.GetWorkflow(projectID)
+	if err != nil {
+		fatalf("loading workflow: %v", err)
+	}
+	return w
+}
+
+// stateName names the column a task is in on its project's board, or
+// returns "" for archived tasks
+func stateName(w model.Workflow, t *model.Task) string {
+	if i := w.StateOf(t.StateID, t.Status); i >= 0 {
+		return w[i].Name
+	}
+	return ""
+}
@@ -2,6 +2,7 @@ package app
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
@@ -13,9 +14,10 @@ import (
 // App holds the application state and dependencies
 type App struct {
 	DB       *db.DB
-	Notifier *notify.Notifier
+	Notifier *notify.Chain
 	DataDir  string
 	lockFile *flock.Flock
+	tty      *os.File // Where the terminal notification backend writes
 }
 
 // Config holds application configuration
@@ -45,8 +47,7 @@ func New(cfg *Config) (*App, error) {
 	}
 
 	app := &App{
-		DataDir:  cfg.DataDir,
-		Notifier: notify.NewNotifier(),
+		DataDir: cfg.DataDir,
 	}
 
 	// Acquire lock to ensure single instance
@@ -60,12 +61,53 @@ func New(cfg *Config) (*App, error) {
 		app.releaseLock()
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	CheckSettings(database)
 	app.DB = database
 
+	// Notifications go through the configured backends. A broken setting
+	// shouldn't keep klonch from starting, so fall back to the default.
+	var terminal io.Writer = os.Stderr
+	if tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0); err == nil {
+		app.tty = tty
+		terminal = tty
+	}
+	app.Notifier, err = notify.New(NotifyConfig(database, terminal))
+	if err != nil {
+		app.Notifier, _ = notify.New(notify.Config{Terminal: terminal})
+	}
+
 	return app, nil
 }
 
-// acquireLock acquires an exclusive file lock to prevent multiple instances
+// NotifyConfig reads the notification settings. terminal is where the
+// terminal backend writes, or nil where there is no terminal to write to.
+func NotifyConfig(database *db.DB, terminal io.Writer) notify.Config {
+	settings, err := database.Settings()
+	if err != nil {
+		return notify.Config{Terminal: terminal}
+	}
+	backends, _ := notify.ParseBackends(settings[db.SettingNotifyBackends])
+	return notify.Config{
+		Backends: backends,
+		Command:  settings[db.SettingNotifyCommand],
+		URL:      settings[db.SettingNotifyURL],
+		Token:    settings[db.SettingNotifyToken],
+		Terminal: terminal,
+	}
+}
+
+// Terminal returns where the terminal notification backend writes
+func (a *App) Terminal() io.Writer {
+	if a.tty != nil {
+		return a.tty
+	}
+	return os.Stderr
+}
+
+// acquireLock acquires an exclusive file lock so only one TUI runs per data
+// directory. CLI commands don't take the lock: they open the database directly
+// and rely on WAL mode and the busy timeout to share it with the TUI, which
+// notices their writes through DB.DataVersion.
 func (a *App) acquireLock() error {
 	lockPath := filepath.Join(a.DataDir, "klonch.lock")
 	a.lockFile = flock.New(lockPath)
@@ -76,7 +118,7 @@ func (a *App) acquireLock() error {
 	}
 
 	if !locked {
-		return fmt.Errorf("another instance of klonch is already running")
+		return fmt.Errorf("another instance of klonch is already running (CLI commands like 'klonch add' still work alongside it)")
 	}
 
 	return nil
@@ -99,6 +141,10 @@ func (a *App) Close() error {
 		}
 	}
 
+	if a.tty != nil {
+		a.tty.Close()
+	}
+
 	a.releaseLock()
 
 	if len(errs) > 0 {
@@ -0,0 +1,35 @@
+package app
+
+import (
+	"os"
+	"os/exec"
+)
+
+// EditorCommand returns the command that opens path in the user's editor:
+// $VISUAL, then $EDITOR, then vi. The variable may carry arguments, as in
+// "code --wait", so it runs through the shell.
+func EditorCommand(path string) *exec.Cmd {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	return exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+}
+
+// WriteTempDocument writes text to a new Markdown file for editing,
+// returning its path. The caller removes it once the edit is saved.
+func WriteTempDocument(text string) (string, error) {
+	f, err := os.CreateTemp("", "klonch-*.md")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dori/klonch/internal/db"
+	"github.com/dori/klonch/internal/notify"
+	"github.com/dori/klonch/internal/ui/theme"
+)
+
+// CheckSettings has a database vet the settings whose values belong to
+// other packages. Call it right after opening the database.
+func CheckSettings(database *db.DB) {
+	database.CheckSetting(db.SettingTheme, checkTheme)
+	database.CheckSetting(db.SettingNotifyBackends, checkBackends)
+}
+
+// checkTheme accepts the name of an available theme
+func checkTheme(value string) (string, error) {
+	if t, ok := theme.ByName(strings.ToLower(value)); ok {
+		return t.Name, nil
+	}
+	var names []string
+	for _, t := range theme.Available() {
+		names = append(names, t.Name)
+	}
+	return "", fmt.Errorf("unknown theme %q (want %s)", value, strings.Join(names, ", "))
+}
+
+// checkBackends accepts notification backends such as dbus,ntfy
+func checkBackends(value string) (string, error) {
+	names, err := notify.ParseBackends(value)
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("no backends given (use none to turn notifications off)")
+	}
+	return strings.Join(names, ","), nil
+}
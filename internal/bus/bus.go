@@ -0,0 +1,48 @@
+// Package bus connects to D-Bus for the desktop integrations, idle
+// detection and notifications, so that both find the buses the same way
+// and never start a session bus where there is none.
+package bus
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Timeout bounds a whole connection, from dialing to the last reply
+const Timeout = 5 * time.Second
+
+// ErrNoSession is returned when there is no session bus, e.g. over SSH
+var ErrNoSession = errors.New("no session bus")
+
+// SessionAddress finds the session bus, as libdbus would, or returns ""
+func SessionAddress() string {
+	if addr := os.Getenv("DBUS_SESSION_BUS_ADDRESS"); addr != "" {
+		return addr
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		if _, err := os.Stat(dir + "/bus"); err == nil {
+			return "unix:path=" + dir + "/bus"
+		}
+	}
+	return ""
+}
+
+// Session connects to the session bus. The connection closes when ctx is
+// done.
+func Session(ctx context.Context) (*dbus.Conn, error) {
+	addr := SessionAddress()
+	if addr == "" {
+		return nil, ErrNoSession
+	}
+	return dbus.Connect(addr, dbus.WithContext(ctx))
+}
+
+// System connects to the system bus. The connection closes when ctx is
+// done.
+func System(ctx context.Context) (*dbus.Conn, error) {
+	return dbus.ConnectSystemBus(dbus.WithContext(ctx))
+}
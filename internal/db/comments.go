@@ -0,0 +1,267 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+	"github.com/dori/klonch/internal/parse"
+	"github.com/google/uuid"
+)
+
+// AddComment adds a comment to a task
+func (db *DB) AddComment(taskID, body string) (*model.Comment, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, fmt.Errorf("comment can't be empty")
+	}
+	c := &model.Comment{
+		ID:        uuid.New().String(),
+		TaskID:    taskID,
+		Body:      body,
+		CreatedAt: time.Now(),
+	}
+	err := db.record("Add comment", func(j *journal) error {
+		if err := j.track("task_comment", c.ID); err != nil {
+			return err
+		}
+		_, err := j.Exec(`INSERT INTO task_comments (id, task_id, body, created_at) VALUES (?, ?, ?, ?)`,
+			c.ID, c.TaskID, c.Body, Timestamp(c.CreatedAt))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// TaskComments returns a task's comments, oldest first
+func (db *DB) TaskComments(taskID string) ([]model.Comment, error) {
+	rows, err := db.Query(`
+		SELECT id, task_id, body, created_at FROM task_comments
+		WHERE task_id = ? ORDER BY created_at, rowid
+	`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []model.Comment
+	for rows.Next() {
+		var c model.Comment
+		var created string
+		if err := rows.Scan(&c.ID, &c.TaskID, &c.Body, &created); err != nil {
+			return nil, err
+		}
+		c.CreatedAt, _ = ParseTimestamp(created)
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+// TaskActivity returns a task's activity stream, oldest first
+func (db *DB) TaskActivity(taskID string) ([]model.Activity, error) {
+	rows, err := db.Query(`
+		SELECT id, task_id, kind, old_value, new_value, created_at FROM task_activity
+		WHERE task_id = ? ORDER BY created_at, id
+	`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stream []model.Activity
+	for rows.Next() {
+		var a model.Activity
+		var id int64
+		var oldValue, newValue sql.NullString
+		var created string
+		if err := rows.Scan(&id, &a.TaskID, &a.Kind, &oldValue, &newValue, &created); err != nil {
+			return nil, err
+		}
+		a.ID = strconv.FormatInt(id, 10)
+		a.OldValue, a.NewValue = oldValue.String, newValue.String
+		if a.Kind == model.ActivityDue {
+			a.OldValue, a.NewValue = formatDueValue(a.OldValue), formatDueValue(a.NewValue)
+		}
+		a.CreatedAt, _ = ParseTimestamp(created)
+		stream = append(stream, a)
+	}
+	return stream, rows.Err()
+}
+
+// formatDueValue writes a stored due date as quick-add would
+func formatDueValue(s string) string {
+	if t, ok := ParseTimestamp(s); ok {
+		return parse.FormatDate(t)
+	}
+	return s
+}
+
+// logActivity adds the activity entries and status transitions a journaled
+// change calls for, comparing the row before and after it. The new rows are
+// returned for the journal, so that undoing the change removes them again.
+func (j *journal) logActivity(e journalEntry, after sql.NullString) ([]journalEntry, error) {
+	var before, now map[string]interface{}
+	if e.before.Valid {
+		if err := json.Unmarshal([]byte(e.before.String), &before); err != nil {
+			return nil, err
+		}
+	}
+	if after.Valid {
+		if err := json.Unmarshal([]byte(after.String), &now); err != nil {
+			return nil, err
+		}
+	}
+	if now == nil {
+		return nil, nil // Deleted rows take their activity with them
+	}
+
+	type entry struct {
+		kind     model.ActivityKind
+		from, to interface{}
+	}
+	var entries []entry
+	var fromState, toState interface{}
+	switch e.entity {
+	case "task":
+		var err error
+		if fromState, err = j.stateName(before); err != nil {
+			return nil, err
+		}
+		if toState, err = j.stateName(now); err != nil {
+			return nil, err
+		}
+		if before == nil {
+			entries = append(entries, entry{kind: model.ActivityCreated})
+			break
+		}
+
+		// Within a project's own workflow, moves are told by column, with
+		// the status only for completing, archiving and reopening
+		moved := now["state_id"] != nil && toState != nil && fromState != toState
+		if moved {
+			entries = append(entries, entry{model.ActivityState, fromState, toState})
+		}
+		milestone := func(status interface{}) bool {
+			return status == string(model.StatusDone) || status == string(model.StatusArchived)
+		}
+		quietStatus := moved && !milestone(before["status"]) && !milestone(now["status"])
+		for _, f := range []struct {
+			kind   model.ActivityKind
+			column string
+		}{
+			{model.ActivityStatus, "status"},
+			{model.ActivityPriority, "priority"},
+			{model.ActivityDue, "due_date"},
+			{model.ActivityProject, "project_id"},
+		} {
+			if before[f.column] == now[f.column] || (quietStatus && f.kind == model.ActivityStatus) {
+				continue
+			}
+			from, to := before[f.column], now[f.column]
+			if f.kind == model.ActivityProject {
+				var err error
+				if from, err = j.projectName(from); err != nil {
+					return nil, err
+				}
+				if to, err = j.projectName(to); err != nil {
+					return nil, err
+				}
+			}
+			entries = append(entries, entry{f.kind, from, to})
+		}
+
+	case "time_entry":
+		// Time counts once its entry is closed, and only against a task
+		if now["task_id"] == nil || now["ended_at"] == nil || (before != nil && before["ended_at"] != nil) {
+			break
+		}
+		if minutes, _ := now["duration"].(float64); minutes > 0 {
+			entries = append(entries, entry{kind: model.ActivityTime, to: strconv.Itoa(int(minutes))})
+		}
+	}
+
+	taskID, _ := now["id"].(string)
+	if e.entity == "time_entry" {
+		taskID, _ = now["task_id"].(string)
+	}
+	var journaled []journalEntry
+	if e.entity == "task" && (before == nil || before["status"] != now["status"] || fromState != toState) {
+		res, err := j.Exec(`
+			INSERT INTO status_transitions (task_id, from_status, to_status, from_state, to_state, changed_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, taskID, before["status"], now["status"], fromState, toState, Timestamp(time.Now()))
+		if err != nil {
+			return nil, err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		journaled = append(journaled, journalEntry{entity: "status_transition", key: []interface{}{id}})
+	}
+	for _, a := range entries {
+		res, err := j.Exec(`
+			INSERT INTO task_activity (task_id, kind, old_value, new_value, created_at)
+			VALUES (?, ?, ?, ?, ?)
+		`, taskID, a.kind, a.from, a.to, Timestamp(time.Now()))
+		if err != nil {
+			return nil, err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		journaled = append(journaled, journalEntry{entity: "task_activity", key: []interface{}{id}})
+	}
+	return journaled, nil
+}
+
+// projectName names a project for the activity stream
+func (j *journal) projectName(id interface{}) (interface{}, error) {
+	if id == nil {
+		return "Inbox", nil
+	}
+	return j.rowName("project", `SELECT name FROM projects WHERE id = ?`, id)
+}
+
+// stateName names the column a task row is in on its project's board, or
+// returns nil for an archived task
+func (j *journal) stateName(task map[string]interface{}) (interface{}, error) {
+	if task == nil || task["status"] == string(model.StatusArchived) {
+		return nil, nil
+	}
+	if id := task["state_id"]; id != nil {
+		return j.rowName("workflow_state", `SELECT name FROM workflow_states WHERE id = ?`, id)
+	}
+	status, _ := task["status"].(string)
+	return model.DefaultStateName(model.Status(status)), nil
+}
+
+// rowName looks up the name of a project or workflow state. One deleted in
+// the same change is named from the journal's copy of it.
+func (j *journal) rowName(entity, query string, id interface{}) (interface{}, error) {
+	var name string
+	err := j.QueryRow(query, id).Scan(&name)
+	if err == nil {
+		return name, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+	for _, e := range j.entries {
+		if e.entity != entity || entityID(e.key) != fmt.Sprint(id) || !e.before.Valid {
+			continue
+		}
+		var row struct{ Name string }
+		if err := json.Unmarshal([]byte(e.before.String), &row); err == nil {
+			return row.Name, nil
+		}
+	}
+	return id, nil
+}
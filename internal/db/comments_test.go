@@ -0,0 +1,87 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+)
+
+// TestTaskActivity checks that changes to a task write its activity stream,
+// and that undoing a change takes its entries back out
+func TestTaskActivity(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	task := &model.Task{Title: "Write report"}
+	if err := db.AddTask(task, nil); err != nil {
+		t.Fatalf("Failed to add task: %v", err)
+	}
+	work, _ := db.CreateProject("Work", "")
+
+	db.UpdateTaskTitle(task.ID, "Write the report") // Not part of the stream
+	db.UpdateTaskPriority(task.ID, model.PriorityHigh)
+	db.UpdateTaskProject(task.ID, work.ID)
+	due := time.Date(2025, 3, 7, 14, 0, 0, 0, time.Local)
+	db.SetTaskDueDate(task.ID, &due)
+	if _, err := db.AddTimeEntry(task.ID, time.Now(), 90, ""); err != nil {
+		t.Fatalf("Failed to log time: %v", err)
+	}
+	db.SetTaskStatus(task.ID, model.StatusDone)
+
+	want := []string{"Created", "Priority medium → high", "Moved from Inbox to Work",
+		"Due 2025-03-07 14:00", "Logged 1h30m", "Completed"}
+	checkStream := func(want []string) {
+		t.Helper()
+		stream, err := db.TaskActivity(task.ID)
+		if err != nil {
+			t.Fatalf("TaskActivity: %v", err)
+		}
+		var got []string
+		for _, a := range stream {
+			got = append(got, a.Summary())
+		}
+		if len(got) != len(want) {
+			t.Fatalf("Expected activity %q, got %q", want, got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("Entry %d: expected %q, got %q", i, want[i], got[i])
+			}
+		}
+	}
+	checkStream(want)
+
+	// Undoing the completion takes its entry with it, and redo brings it back
+	db.Undo()
+	checkStream(want[:5])
+	db.Redo()
+	checkStream(want)
+
+	if _, err := db.AddComment(task.ID, "  "); err == nil {
+		t.Error("Expected an empty comment to be refused")
+	}
+	if _, err := db.AddComment(task.ID, "Sent to Sam for review"); err != nil {
+		t.Fatalf("AddComment: %v", err)
+	}
+
+	// Deleting the task removes its comments and activity, and undo restores them
+	if err := db.DeleteTask(task.ID); err != nil {
+		t.Fatalf("DeleteTask: %v", err)
+	}
+	if stream, _ := db.TaskActivity(task.ID); len(stream) != 0 {
+		t.Errorf("Expected no activity for a deleted task, got %d entries", len(stream))
+	}
+	if label, err := db.Undo(); err != nil {
+		t.Fatalf("Undo %q: %v", label, err)
+	}
+	checkStream(want)
+	comments, err := db.TaskComments(task.ID)
+	if err != nil || len(comments) != 1 || comments[0].Body != "Sent to Sam for review" {
+		t.Errorf("Expected the comment back after undoing the delete, got %+v, %v", comments, err)
+	}
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+	"github.com/pressly/goose/v3"
+)
+
+// Timestamps are stored as UTC text with milliseconds, e.g.
+// 2024-01-15T09:30:00.000Z. The fixed width makes string order match time
+// order, julianday() reads it without guessing a zone, and a due date keeps
+// meaning the same instant when the machine's zone or DST changes.
+
+func init() {
+	goose.AddNamedMigrationContext("006_utc_timestamps.go", upUTCTimestamps, downUTCTimestamps)
+}
+
+const timestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// Timestamp formats t for storage or for comparing against stored times
+func Timestamp(t time.Time) string {
+	return t.UTC().Format(timestampLayout)
+}
+
+// timestampOrNil formats an optional time, leaving NULL for nil
+func timestampOrNil(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return Timestamp(*t)
+}
+
+// storedLayouts are the shapes timestamps have had in the database. The
+// driver hands DATETIME columns back as RFC 3339; the rest are raw text.
+var storedLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00", // Driver's encoding of time.Time
+	"2006-01-02T15:04:05.999999999",       // Zoneless values are UTC
+	"2006-01-02 15:04:05.999999999",       // CURRENT_TIMESTAMP
+}
+
+// ParseTimestamp reads a stored timestamp into local time
+func ParseTimestamp(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range storedLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Local(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseTimestampPtr reads an optional stored timestamp
+func parseTimestampPtr(s *string) *time.Time {
+	if s == nil {
+		return nil
+	}
+	if t, ok := ParseTimestamp(*s); ok {
+		return &t
+	}
+	return nil
+}
+
+// InRange is an SQL condition that holds when column falls in [from, to).
+// Pass the two bounds through Timestamp as arguments.
+func InRange(column string) string {
+	return "(julianday(" + column + ") >= julianday(?) AND julianday(" + column + ") < julianday(?))"
+}
+
+// timestampColumns lists every stored time that upUTCTimestamps rewrites
+var timestampColumns = map[string][]string{
+	"tasks":        {"due_date", "start_date", "completed_at", "created_at", "updated_at"},
+	"projects":     {"created_at", "updated_at"},
+	"tags":         {"created_at"},
+	"time_entries": {"started_at", "ended_at", "created_at"},
+	"smart_lists":  {"created_at", "updated_at"},
+}
+
+// upUTCTimestamps rewrites timestamps written before the UTC convention:
+// RFC 3339 with a local offset, the driver's own encoding and zoneless
+// CURRENT_TIMESTAMP values. A bare date becomes the end of that local day
+// for due dates and its start otherwise.
+func upUTCTimestamps(ctx context.Context, tx *sql.Tx) error {
+	for table, columns := range timestampColumns {
+		for _, column := range columns {
+			if err := normalizeColumn(ctx, tx, table, column); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func normalizeColumn(ctx context.Context, tx *sql.Tx, table, column string) error {
+	// CAST keeps the driver from parsing the values itself
+	rows, err := tx.QueryContext(ctx, `SELECT rowid, CAST(`+column+` AS TEXT) FROM `+table+
+		` WHERE `+column+` IS NOT NULL`)
+	if err != nil {
+		return err
+	}
+	updates := make(map[int64]string)
+	for rows.Next() {
+		var rowid int64
+		var value string
+		if err := rows.Scan(&rowid, &value); err != nil {
+			rows.Close()
+			return err
+		}
+		t, ok := ParseTimestamp(value)
+		if !ok {
+			day, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(value), time.Local)
+			if err != nil {
+				continue
+			}
+			if t = day; column == "due_date" {
+				t = model.EndOfDay(day)
+			}
+		}
+		if stored := Timestamp(t); stored != value {
+			updates[rowid] = stored
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for rowid, value := range updates {
+		if _, err := tx.ExecContext(ctx, `UPDATE `+table+` SET `+column+` = ? WHERE rowid = ?`, value, rowid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downUTCTimestamps leaves the rewritten values alone; they read the same
+// under every earlier version
+func downUTCTimestamps(ctx context.Context, tx *sql.Tx) error {
+	return nil
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+)
+
+// TestDayHelpersAcrossDST checks that day arithmetic follows the calendar
+// rather than 24-hour steps on the days clocks change
+func TestDayHelpersAcrossDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("No zone data: %v", err)
+	}
+
+	// Clocks went forward on 30 March 2025, a 23-hour day
+	before := time.Date(2025, 3, 29, 23, 30, 0, 0, berlin)
+	after := time.Date(2025, 3, 31, 0, 30, 0, 0, berlin)
+	if got := model.DaysBetween(before, after); got != 2 {
+		t.Errorf("DaysBetween across DST = %d, want 2", got)
+	}
+	if end := model.EndOfDay(time.Date(2025, 3, 30, 12, 0, 0, 0, berlin)); end.Hour() != 23 || end.Minute() != 59 {
+		t.Errorf("EndOfDay on DST day = %v", end)
+	}
+	if model.SameDay(before, after) || !model.SameDay(after, after.Add(-30*time.Minute)) {
+		t.Error("SameDay disagrees with the calendar")
+	}
+}
+
+func TestTimestampsStoredInUTC(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	// Due at 14:00 in New York, whatever zone the test runs in
+	newYork := time.FixedZone("EST", -5*3600)
+	due := time.Date(2025, 1, 10, 14, 0, 0, 0, newYork)
+	task := &model.Task{Title: "Call", DueDate: &due}
+	if err := db.AddTask(task, nil); err != nil {
+		t.Fatalf("Failed to add task: %v", err)
+	}
+
+	var stored string
+	db.QueryRow(`SELECT CAST(due_date AS TEXT) FROM tasks WHERE id = ?`, task.ID).Scan(&stored)
+	if stored != "2025-01-10T19:00:00.000Z" {
+		t.Errorf("Stored due date %q, want UTC", stored)
+	}
+
+	got, err := db.GetTask(task.ID)
+	if err != nil || got == nil || got.DueDate == nil {
+		t.Fatalf("Failed to load task: %v", err)
+	}
+	if !got.DueDate.Equal(due) || got.DueDate.Location() != time.Local {
+		t.Errorf("Loaded due date %v, want %v in local time", got.DueDate, due)
+	}
+
+	// The overdue query compares instants, not text
+	past := time.Now().Add(-time.Minute)
+	if err := db.SetTaskDueDate(task.ID, &past); err != nil {
+		t.Fatalf("Failed to set due date: %v", err)
+	}
+	q, err := ParseQuery("is:overdue")
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+	ids, err := db.MatchingTaskIDs(q)
+	if err != nil {
+		t.Fatalf("Failed to run query: %v", err)
+	}
+	if !ids[task.ID] {
+		t.Error("Task due a minute ago is not overdue")
+	}
+}
+
+// TestNormalizeTimestamps checks the migration that rewrites the mix of
+// formats older versions stored
+func TestNormalizeTimestamps(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	rfc := time.Date(2025, 2, 3, 23, 59, 59, 0, time.FixedZone("", 2*3600))
+	_, err = db.Exec(`
+		INSERT INTO tasks (id, title, due_date, start_date, completed_at, created_at, updated_at)
+		VALUES ('legacy', 'Legacy', ?, ?, ?, ?, ?)
+	`, rfc.Format(time.RFC3339), "2025-02-01", "2025-02-03 08:15:00.123456789+02:00",
+		"2025-01-30 12:00:00", "2025-01-30 12:00:00")
+	if err != nil {
+		t.Fatalf("Failed to insert legacy task: %v", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	if err := upUTCTimestamps(context.Background(), tx); err != nil {
+		tx.Rollback()
+		t.Fatalf("Migration failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	want := map[string]string{
+		"due_date":     "2025-02-03T21:59:59.000Z",
+		"start_date":   Timestamp(time.Date(2025, 2, 1, 0, 0, 0, 0, time.Local)),
+		"completed_at": "2025-02-03T06:15:00.123Z",
+		"created_at":   "2025-01-30T12:00:00.000Z",
+	}
+	for column, expected := range want {
+		var got string
+		db.QueryRow(`SELECT CAST(` + column + ` AS TEXT) FROM tasks WHERE id = 'legacy'`).Scan(&got)
+		if got != expected {
+			t.Errorf("%s = %q, want %q", column, got, expected)
+		}
+	}
+}
@@ -19,6 +19,15 @@ var migrations embed.FS
 // DB wraps the SQL database connection
 type DB struct {
 	*sql.DB
+
+	// batch and batchLabel are set on handles returned by Group so that
+	// every change made through them is undone as one step
+	batch      string
+	batchLabel string
+
+	settings *settingsHub
+	checks   map[string]SettingCheck
+	search   searchIndex
 }
 
 // DefaultDataDir returns the default data directory path
@@ -61,7 +70,7 @@ func Open(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	db := &DB{DB: sqlDB}
+	db := &DB{DB: sqlDB, settings: &settingsHub{}, checks: make(map[string]SettingCheck)}
 
 	// Run migrations
 	if err := db.migrate(); err != nil {
@@ -69,6 +78,11 @@ func Open(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to run migrations: %w", err)
 	}
 
+	if err := db.openSearchIndex(); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("failed to open search index: %w", err)
+	}
+
 	return db, nil
 }
 
@@ -94,6 +108,15 @@ func (db *DB) Close() error {
 	return db.DB.Close()
 }
 
+// DataVersion returns SQLite's data_version for this connection. It changes
+// whenever another process commits to the database, never for our own writes,
+// so polling it detects changes made by the CLI while the TUI is open.
+func (db *DB) DataVersion() (int64, error) {
+	var version int64
+	err := db.QueryRow(`PRAGMA data_version`).Scan(&version)
+	return version, err
+}
+
 // Transaction executes a function within a transaction
 func (db *DB) Transaction(fn func(*sql.Tx) error) error {
 	tx, err := db.Begin()
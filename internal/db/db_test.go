@@ -208,3 +208,37 @@ func TestDocumentDeadlockScenario(t *testing.T) {
 		t.Log("Confirmed: nested queries during iteration cause deadlock")
 	}
 }
+
+// TestDataVersionSeesOtherConnections checks that data_version moves for writes
+// from another connection, which is how the TUI notices CLI changes
+func TestDataVersionSeesOtherConnections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	tui, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer tui.Close()
+	cli, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open second connection: %v", err)
+	}
+	defer cli.Close()
+
+	before, err := tui.DataVersion()
+	if err != nil {
+		t.Fatalf("Failed to read data_version: %v", err)
+	}
+	if _, err := tui.CreateTask("Own write", nil); err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+	if v, _ := tui.DataVersion(); v != before {
+		t.Errorf("Expected own writes to leave data_version alone, got %d -> %d", before, v)
+	}
+
+	if _, err := cli.CreateTask("From the CLI", nil); err != nil {
+		t.Fatalf("Failed to create task from second connection: %v", err)
+	}
+	if v, _ := tui.DataVersion(); v == before {
+		t.Error("Expected data_version to change after another connection wrote")
+	}
+}
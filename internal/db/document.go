@@ -0,0 +1,308 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+	"github.com/dori/klonch/internal/parse"
+)
+
+// A task document is a task written out for editing in a text editor: the
+// fields as front matter between "---" lines, then the description.
+//
+//	---
+//	title: Write report
+//	status: pending
+//	priority: high
+//	project: Work
+//	tags: @docs @q3
+//	due: 2025-03-07 14:00
+//	---
+//
+//	Cover the **Q3** numbers.
+
+// documentKeys are the front matter keys, in the order they are written
+var documentKeys = []string{"title", "status", "priority", "project", "tags", "due", "start", "estimate", "remind", "repeat"}
+
+// applyOrder is the order changes are saved in. Status goes last, so that
+// completing a task repeats it with the rest of the document already saved.
+var applyOrder = []string{"title", "priority", "project", "tags", "due", "start", "estimate", "remind", "repeat", "status"}
+
+const documentFence = "---"
+
+// TaskDocument writes a task out as a document
+func (db *DB) TaskDocument(id string) (string, error) {
+	t, err := db.GetTask(id)
+	if err != nil {
+		return "", err
+	}
+	if t == nil {
+		return "", fmt.Errorf("task %s not found", id)
+	}
+	fields, err := db.documentFields(t)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString(documentFence + "\n")
+	for _, key := range documentKeys {
+		if v := fields[key]; v != "" {
+			fmt.Fprintf(&b, "%s: %s\n", key, v)
+		} else {
+			fmt.Fprintf(&b, "%s:\n", key)
+		}
+	}
+	b.WriteString(documentFence + "\n\n")
+	if t.Description != "" {
+		b.WriteString(t.Description + "\n")
+	}
+	return b.String(), nil
+}
+
+// documentFields formats a task's fields as the front matter values
+func (db *DB) documentFields(t *model.Task) (map[string]string, error) {
+	fields := map[string]string{
+		"title":    t.Title,
+		"status":   string(t.Status),
+		"priority": string(t.Priority),
+	}
+
+	if t.ProjectID != nil && *t.ProjectID != "inbox" {
+		p, err := db.GetProject(*t.ProjectID)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			fields["project"] = p.Name
+		}
+	}
+
+	tags, err := db.GetTaskTags(t.ID)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, tag := range tags {
+		names = append(names, tag.DisplayName())
+	}
+	fields["tags"] = strings.Join(names, " ")
+
+	if t.DueDate != nil {
+		fields["due"] = parse.FormatDate(t.DueDate.Local())
+	}
+	if t.StartDate != nil {
+		fields["start"] = parse.FormatDate(t.StartDate.Local())
+	}
+	if t.TimeEstimate != nil {
+		fields["estimate"] = model.FormatEstimate(*t.TimeEstimate)
+	}
+	if t.Reminders != nil {
+		fields["remind"] = *t.Reminders
+	}
+	if rule := t.RecurrenceRule(); rule != nil {
+		fields["repeat"] = rule.String()
+	}
+	return fields, nil
+}
+
+// splitDocument separates the front matter from the description. A
+// document without front matter is all description.
+func splitDocument(doc string) (map[string]string, string, error) {
+	doc = strings.ReplaceAll(doc, "\r\n", "\n")
+	lines := strings.Split(doc, "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != documentFence {
+		return nil, strings.TrimSpace(doc), nil
+	}
+
+	fields := make(map[string]string)
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == documentFence {
+			body := strings.Join(lines[i+1:], "\n")
+			return fields, strings.TrimSpace(body), nil
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, "", fmt.Errorf("line %d: expected key: value, got %q", i+1, line)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !slices.Contains(documentKeys, key) {
+			return nil, "", fmt.Errorf("line %d: unknown field %q (want %s)", i+1, key, strings.Join(documentKeys, ", "))
+		}
+		if _, dup := fields[key]; dup {
+			return nil, "", fmt.Errorf("line %d: %s given twice", i+1, key)
+		}
+		fields[key] = strings.TrimSpace(value)
+	}
+	return nil, "", fmt.Errorf("front matter has no closing %s", documentFence)
+}
+
+// ApplyTaskDocument saves the changes made to a task's document. Only the
+// fields that differ from the task are touched, keys left out are kept as
+// they are, and an empty value clears the field. Everything is read before
+// anything is saved, and a change that fails takes back the ones saved
+// before it, so a mistake changes nothing. The changes are one undo step.
+func (db *DB) ApplyTaskDocument(id, doc string) error {
+	t, err := db.GetTask(id)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return fmt.Errorf("task %s not found", id)
+	}
+	fields, body, err := splitDocument(doc)
+	if err != nil {
+		return err
+	}
+	current, err := db.documentFields(t)
+	if err != nil {
+		return err
+	}
+
+	// Work out each change first; it runs once the whole document checks out
+	var changes []func(group *DB) error
+	now := time.Now()
+	for _, key := range applyOrder {
+		value, ok := fields[key]
+		if !ok || value == current[key] {
+			continue
+		}
+		change, err := documentChange(key, value, id, now)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, change)
+	}
+	if body != strings.TrimSpace(t.Description) {
+		changes = append([]func(group *DB) error{func(group *DB) error {
+			return group.UpdateTaskDescription(id, body)
+		}}, changes...)
+	}
+
+	group := db.Group("Edit task")
+	for _, change := range changes {
+		if err := change(group); err != nil {
+			if discardErr := db.discard(group.batch); discardErr != nil {
+				return fmt.Errorf("%w (and taking back the changes saved: %v)", err, discardErr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// documentChange reads a changed front matter value
+func documentChange(key, value, id string, now time.Time) (func(group *DB) error, error) {
+	switch key {
+	case "title":
+		if value == "" {
+			return nil, fmt.Errorf("title can't be empty")
+		}
+		return func(group *DB) error { return group.UpdateTaskTitle(id, value) }, nil
+
+	case "status":
+		status := model.Status(strings.ToLower(value))
+		switch status {
+		case model.StatusBacklog, model.StatusPending, model.StatusInProgress, model.StatusDone, model.StatusArchived:
+		default:
+			return nil, fmt.Errorf("unknown status %q (want backlog, pending, in_progress, done or archived)", value)
+		}
+		return func(group *DB) error { return group.SetTaskStatus(id, status) }, nil
+
+	case "priority":
+		priority, ok := parse.Priority(value)
+		if !ok {
+			return nil, fmt.Errorf("unknown priority %q (want low, medium, high or urgent)", value)
+		}
+		return func(group *DB) error { return group.UpdateTaskPriority(id, priority) }, nil
+
+	case "project":
+		name := strings.TrimPrefix(value, "#")
+		return func(group *DB) error {
+			projectID := "inbox"
+			if name != "" && !strings.EqualFold(name, "none") {
+				p, err := group.GetOrCreateProject(name, "")
+				if err != nil {
+					return err
+				}
+				projectID = p.ID
+			}
+			return group.UpdateTaskProject(id, projectID)
+		}, nil
+
+	case "tags":
+		names := strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+		return func(group *DB) error {
+			var tagIDs []string
+			for _, name := range names {
+				tag, err := group.GetOrCreateTag(name, "")
+				if err != nil {
+					return err
+				}
+				if !slices.Contains(tagIDs, tag.ID) {
+					tagIDs = append(tagIDs, tag.ID)
+				}
+			}
+			return group.SetTaskTags(id, tagIDs)
+		}, nil
+
+	case "due", "start":
+		var date *time.Time
+		if value != "" {
+			d, ok := parse.Date(value, now)
+			if !ok {
+				return nil, fmt.Errorf("can't read %s date %q", key, value)
+			}
+			date = &d
+		}
+		if key == "due" {
+			return func(group *DB) error { return group.SetTaskDueDate(id, date) }, nil
+		}
+		if date != nil {
+			start := parse.StartOf(*date)
+			date = &start
+		}
+		return func(group *DB) error { return group.SetTaskStartDate(id, date) }, nil
+
+	case "estimate":
+		var minutes *int
+		if value != "" {
+			m, err := model.ParseEstimate(value)
+			if err != nil {
+				return nil, err
+			}
+			minutes = &m
+		}
+		return func(group *DB) error { return group.SetTaskEstimate(id, minutes) }, nil
+
+	case "remind":
+		var reminders *string
+		if value != "" && !strings.EqualFold(value, "default") {
+			offsets, err := model.ParseReminders(value)
+			if err != nil {
+				return nil, err
+			}
+			formatted := model.FormatReminders(offsets)
+			reminders = &formatted
+		}
+		return func(group *DB) error { return group.SetTaskReminders(id, reminders) }, nil
+
+	case "repeat":
+		var rule *model.Recurrence
+		if value != "" && !strings.EqualFold(value, "never") {
+			var err error
+			if rule, err = model.ParseRecurrenceSpec(value); err != nil {
+				return nil, err
+			}
+		}
+		return func(group *DB) error { return group.SetTaskRecurrence(id, rule) }, nil
+	}
+	return nil, fmt.Errorf("unknown field %q", key)
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+)
+
+// TestTaskDocument checks writing a task out as a document and saving the
+// changes made to it as one undo step
+func TestTaskDocument(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	task := &model.Task{Title: "Write report", Priority: model.PriorityHigh}
+	if err := db.AddTask(task, nil); err != nil {
+		t.Fatalf("Failed to add task: %v", err)
+	}
+	db.UpdateTaskDescription(task.ID, "Cover the **Q3** numbers.")
+	due := time.Date(2025, 3, 7, 14, 0, 0, 0, time.Local)
+	db.SetTaskDueDate(task.ID, &due)
+
+	doc, err := db.TaskDocument(task.ID)
+	if err != nil {
+		t.Fatalf("TaskDocument: %v", err)
+	}
+	for _, want := range []string{"---\ntitle: Write report\n", "priority: high\n", "due: 2025-03-07 14:00\n",
+		"project:\n", "---\n\nCover the **Q3** numbers.\n"} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("Expected the document to contain %q, got:\n%s", want, doc)
+		}
+	}
+
+	// Saving it untouched changes nothing
+	if err := db.ApplyTaskDocument(task.ID, doc); err != nil {
+		t.Fatalf("ApplyTaskDocument: %v", err)
+	}
+	if label, _ := db.Undo(); label != "Set due date" {
+		t.Errorf("Expected nothing new to undo, got %q", label)
+	}
+	db.Redo()
+
+	edited := strings.NewReplacer(
+		"title: Write report", "title: Write the report",
+		"project:", "project: Work",
+		"tags:", "tags: @docs, q3",
+		"due: 2025-03-07 14:00", "due:",
+		"estimate:", "estimate: 2h",
+		"Cover the **Q3** numbers.", "Cover the numbers.\n\n- [ ] Charts",
+	).Replace(doc)
+	if err := db.ApplyTaskDocument(task.ID, edited); err != nil {
+		t.Fatalf("ApplyTaskDocument: %v", err)
+	}
+	got, _ := db.GetTask(task.ID)
+	tags, _ := db.GetTaskTags(task.ID)
+	if got.Title != "Write the report" || got.DueDate != nil || got.TimeEstimate == nil || *got.TimeEstimate != 120 ||
+		got.Description != "Cover the numbers.\n\n- [ ] Charts" || got.Priority != model.PriorityHigh || len(tags) != 2 {
+		t.Errorf("Unexpected task after editing: %+v, tags %v", got, tags)
+	}
+	if p, _ := db.GetProject(*got.ProjectID); p == nil || p.Name != "Work" {
+		t.Errorf("Expected the task moved to a new Work project, got %+v", p)
+	}
+
+	if label, err := db.Undo(); err != nil || label != "Edit task" {
+		t.Errorf("Undo = %q, %v", label, err)
+	}
+	if got, _ = db.GetTask(task.ID); got.Title != "Write report" || got.DueDate == nil ||
+		got.Description != "Cover the **Q3** numbers." {
+		t.Errorf("Expected undo to restore the whole document, got %+v", got)
+	}
+
+	// A mistake anywhere saves nothing
+	for _, bad := range []string{
+		"---\ntitle: Renamed\nowner: me\n---\n",
+		"---\ntitle: Renamed\ndue: someday\n---\n",
+		"---\ntitle:\n---\n",
+		"---\ntitle: Renamed\n",
+	} {
+		if err := db.ApplyTaskDocument(task.ID, bad); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+	if got, _ = db.GetTask(task.ID); got.Title != "Write report" {
+		t.Errorf("Expected a bad document to change nothing, got %q", got.Title)
+	}
+
+	// Without front matter the whole text is the description
+	if err := db.ApplyTaskDocument(task.ID, "Just notes\n"); err != nil {
+		t.Fatalf("ApplyTaskDocument: %v", err)
+	}
+	if got, _ = db.GetTask(task.ID); got.Title != "Write report" || got.Description != "Just notes" {
+		t.Errorf("Expected only the description to change, got %+v", got)
+	}
+}
+
+// TestTaskDocumentFailure checks that a change failing partway takes back
+// the ones already saved and leaves no undo step behind
+func TestTaskDocumentFailure(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	task, _ := db.CreateTask("Write report", nil)
+	doc, _ := db.TaskDocument(task.ID)
+	db.Exec(`CREATE TRIGGER no_status BEFORE UPDATE OF status ON tasks WHEN NEW.status = 'done' BEGIN SELECT RAISE(ABORT, 'status is stuck'); END`)
+
+	edited := strings.NewReplacer(
+		"title: Write report", "title: Write the report",
+		"project:", "project: Work",
+		"status: pending", "status: done",
+	).Replace(doc)
+	if err := db.ApplyTaskDocument(task.ID, edited); err == nil || !strings.Contains(err.Error(), "status is stuck") {
+		t.Fatalf("Expected the status change to fail, got %v", err)
+	}
+	got, _ := db.GetTask(task.ID)
+	if got.Title != "Write report" || got.ProjectID == nil || *got.ProjectID != "inbox" {
+		t.Errorf("Expected the earlier changes to be taken back, got %q in %v", got.Title, got.ProjectID)
+	}
+	if label, _ := db.Undo(); label != "Add task" {
+		t.Errorf("Expected only adding the task to undo, got %q", label)
+	}
+}
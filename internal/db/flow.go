@@ -0,0 +1,241 @@
+package db
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+)
+
+// Flow metrics come from status_transitions, which records every change
+// of a task's status and column. Archived tasks leave the board: they count
+// towards no column in the cumulative flow, and archiving isn't finishing.
+
+// FlowStatuses are the statuses tracked on the board, in Kanban order
+var FlowStatuses = []model.Status{model.StatusBacklog, model.StatusPending, model.StatusInProgress, model.StatusDone}
+
+// DurationStats summarises a set of durations
+type DurationStats struct {
+	Count  int
+	Mean   time.Duration
+	Median time.Duration
+}
+
+// WeekCount is the number of tasks finished in the week starting Start
+type WeekCount struct {
+	Start time.Time
+	Count int
+}
+
+// FlowDay is how many tasks were in each status at the end of a day
+type FlowDay struct {
+	Day    time.Time
+	Counts map[model.Status]int
+}
+
+// ColumnTime is how long tasks stayed in a column, across every workflow
+// with a column of that name
+type ColumnTime struct {
+	Name     string
+	Category model.Category
+	DurationStats
+}
+
+// FlowMetrics describes how work moved through the board over a period
+type FlowMetrics struct {
+	LeadTime     DurationStats // Created to done, for tasks finished in the period
+	CycleTime    DurationStats // First started to done, for those that were started
+	TimeInColumn []ColumnTime  // Stays in each column that ended in the period, in board order
+	Throughput   []WeekCount   // Tasks finished per week, oldest first
+	Flow         []FlowDay     // Cumulative flow by status, a day at a time
+}
+
+type transition struct {
+	from, to model.Status
+	state    string // Column entered
+	at       time.Time
+}
+
+// GetFlowMetrics works out lead and cycle times, time in each status,
+// weekly throughput and the cumulative flow between since and until
+func (db *DB) GetFlowMetrics(since, until time.Time) (FlowMetrics, error) {
+	history, err := db.taskTransitions()
+	if err != nil {
+		return FlowMetrics{}, err
+	}
+
+	var m FlowMetrics
+	var lead, cycle []time.Duration
+	stays := make(map[string][]time.Duration)
+	categories := make(map[string]model.Category)
+	finished := make(map[time.Time]map[string]bool) // Week start to the tasks finished in it
+
+	inPeriod := func(t time.Time) bool { return !t.Before(since) && t.Before(until) }
+	for id, ts := range history {
+		created := ts[0].at
+		var started *time.Time
+		var leadTime, cycleTime time.Duration
+		done := false
+		for i, tr := range ts {
+			if tr.to == model.StatusInProgress && started == nil {
+				at := tr.at
+				started = &at
+			}
+			if i+1 < len(ts) && inPeriod(ts[i+1].at) && tr.state != "" {
+				stays[tr.state] = append(stays[tr.state], ts[i+1].at.Sub(tr.at))
+				categories[tr.state] = model.StatusCategory(tr.to)
+			}
+			if tr.to != model.StatusDone || !inPeriod(tr.at) {
+				continue
+			}
+
+			// A task finished more than once is timed to the last time
+			done = true
+			leadTime = tr.at.Sub(created)
+			cycleTime = -1
+			if started != nil {
+				cycleTime = tr.at.Sub(*started)
+			}
+			week := model.StartOfWeek(tr.at)
+			if finished[week] == nil {
+				finished[week] = make(map[string]bool)
+			}
+			finished[week][id] = true
+		}
+		if done {
+			lead = append(lead, leadTime)
+			if cycleTime >= 0 {
+				cycle = append(cycle, cycleTime)
+			}
+		}
+	}
+
+	m.LeadTime = summarise(lead)
+	m.CycleTime = summarise(cycle)
+	order, err := db.columnOrder()
+	if err != nil {
+		return FlowMetrics{}, err
+	}
+	for name, durations := range stays {
+		m.TimeInColumn = append(m.TimeInColumn, ColumnTime{Name: name, Category: categories[name], DurationStats: summarise(durations)})
+	}
+	sort.Slice(m.TimeInColumn, func(i, j int) bool {
+		a, b := m.TimeInColumn[i], m.TimeInColumn[j]
+		if a.Category != b.Category {
+			return categoryRank[a.Category] < categoryRank[b.Category]
+		}
+		if rankA, rankB := columnRank(order, a.Name), columnRank(order, b.Name); rankA != rankB {
+			return rankA < rankB
+		}
+		return a.Name < b.Name
+	})
+	for week := model.StartOfWeek(since); week.Before(until); week = week.AddDate(0, 0, 7) {
+		m.Throughput = append(m.Throughput, WeekCount{Start: week, Count: len(finished[week])})
+	}
+	m.Flow = cumulativeFlow(history, since, until)
+	return m, nil
+}
+
+var categoryRank = map[model.Category]int{model.CategoryOpen: 0, model.CategoryActive: 1, model.CategoryDone: 2}
+
+// columnOrder ranks column names by where they come on the boards, the
+// default workflow's first; names no board has any more come last
+func (db *DB) columnOrder() (map[string]int, error) {
+	workflows, err := db.GetWorkflows()
+	if err != nil {
+		return nil, err
+	}
+	order := make(map[string]int)
+	for _, s := range model.DefaultWorkflow() {
+		order[s.Name] = s.Position
+	}
+	for _, w := range workflows {
+		for _, s := range w {
+			if rank, ok := order[s.Name]; !ok || s.Position < rank {
+				order[s.Name] = s.Position
+			}
+		}
+	}
+	return order, nil
+}
+
+// columnRank returns a column name's rank from columnOrder, putting names
+// no board has any more last
+func columnRank(order map[string]int, name string) int {
+	if rank, ok := order[name]; ok {
+		return rank
+	}
+	return math.MaxInt
+}
+
+// taskTransitions loads every task's status transitions, oldest first
+func (db *DB) taskTransitions() (map[string][]transition, error) {
+	rows, err := db.Query(`
+		SELECT task_id, from_status, to_status, COALESCE(to_state, ''), changed_at FROM status_transitions
+		ORDER BY julianday(changed_at), id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make(map[string][]transition)
+	for rows.Next() {
+		var id, to, state, at string
+		var from sql.NullString
+		if err := rows.Scan(&id, &from, &to, &state, &at); err != nil {
+			return nil, err
+		}
+		tr := transition{from: model.Status(from.String), to: model.Status(to), state: state}
+		tr.at, _ = ParseTimestamp(at)
+		history[id] = append(history[id], tr)
+	}
+	return history, rows.Err()
+}
+
+// cumulativeFlow counts the tasks in each status at the end of every day
+// from since to until
+func cumulativeFlow(history map[string][]transition, since, until time.Time) []FlowDay {
+	var days []FlowDay
+	for day := model.StartOfDay(since); day.Before(until); day = day.AddDate(0, 0, 1) {
+		days = append(days, FlowDay{Day: day, Counts: make(map[model.Status]int)})
+	}
+	for _, ts := range history {
+		next := 0
+		var status model.Status
+		for i := range days {
+			end := days[i].Day.AddDate(0, 0, 1)
+			for next < len(ts) && ts[next].at.Before(end) {
+				status = ts[next].to
+				next++
+			}
+			if next > 0 && status != model.StatusArchived {
+				days[i].Counts[status]++
+			}
+		}
+	}
+	return days
+}
+
+// summarise works out the count, mean and median of durations
+func summarise(durations []time.Duration) DurationStats {
+	if len(durations) == 0 {
+		return DurationStats{}
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	median := durations[len(durations)/2]
+	if len(durations)%2 == 0 {
+		median = (durations[len(durations)/2-1] + median) / 2
+	}
+	return DurationStats{
+		Count:  len(durations),
+		Mean:   total / time.Duration(len(durations)),
+		Median: median,
+	}
+}
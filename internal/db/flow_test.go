@@ -0,0 +1,142 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+)
+
+// TestFlowMetrics checks that status changes are recorded as transitions
+// and the lead times, cycle times, throughput and cumulative flow read
+// from them
+func TestFlowMetrics(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	since := time.Date(2025, 3, 3, 0, 0, 0, 0, time.Local) // A Monday
+	at := func(day, hour int) time.Time { return since.AddDate(0, 0, day-3).Add(time.Duration(hour) * time.Hour) }
+
+	// Transitions are stamped with the time of the change; move them back
+	retime := func(task *model.Task, times ...time.Time) {
+		t.Helper()
+		ids, err := queryStrings(db, `SELECT id FROM status_transitions WHERE task_id = ? ORDER BY id`, task.ID)
+		if err != nil || len(ids) != len(times) {
+			t.Fatalf("Expected %d transitions for %q, got %v (%v)", len(times), task.Title, ids, err)
+		}
+		for i, id := range ids {
+			db.Exec(`UPDATE status_transitions SET changed_at = ? WHERE id = ?`, Timestamp(times[i]), id)
+		}
+	}
+
+	started := &model.Task{Title: "Started then done"}
+	db.AddTask(started, nil)
+	db.SetTaskStatus(started.ID, model.StatusInProgress)
+	db.SetTaskStatus(started.ID, model.StatusDone)
+	retime(started, at(3, 9), at(4, 9), at(6, 9))
+
+	straight := &model.Task{Title: "Done without starting"}
+	db.AddTask(straight, nil)
+	db.SetTaskStatus(straight.ID, model.StatusDone)
+	retime(straight, at(3, 9), at(11, 9))
+
+	parked := &model.Task{Title: "Parked", Status: model.StatusBacklog}
+	db.AddTask(parked, nil)
+	retime(parked, at(5, 9))
+
+	// Undone changes leave no transitions behind
+	undone := &model.Task{Title: "Undone"}
+	db.AddTask(undone, nil)
+	db.SetTaskStatus(undone.ID, model.StatusDone)
+	db.Undo()
+	retime(undone, at(12, 9))
+	db.DeleteTask(undone.ID)
+
+	m, err := db.GetFlowMetrics(since, since.AddDate(0, 0, 14))
+	if err != nil {
+		t.Fatalf("GetFlowMetrics: %v", err)
+	}
+
+	day := 24 * time.Hour
+	if m.LeadTime.Count != 2 || m.LeadTime.Mean != 5*day+12*time.Hour || m.LeadTime.Median != m.LeadTime.Mean {
+		t.Errorf("Unexpected lead time: %+v", m.LeadTime)
+	}
+	if m.CycleTime.Count != 1 || m.CycleTime.Mean != 2*day {
+		t.Errorf("Unexpected cycle time: %+v", m.CycleTime)
+	}
+	if len(m.TimeInColumn) != 2 {
+		t.Fatalf("Expected time in two columns, got %+v", m.TimeInColumn)
+	}
+	if got := m.TimeInColumn[0]; got.Name != "Todo" || got.Count != 2 || got.Mean != 4*day+12*time.Hour {
+		t.Errorf("Unexpected time in Todo: %+v", got)
+	}
+	if got := m.TimeInColumn[1]; got.Name != "In Progress" || got.Count != 1 || got.Mean != 2*day {
+		t.Errorf("Unexpected time in progress: %+v", got)
+	}
+	if len(m.Throughput) != 2 || m.Throughput[0].Count != 1 || m.Throughput[1].Count != 1 {
+		t.Errorf("Unexpected throughput: %+v", m.Throughput)
+	}
+
+	if len(m.Flow) != 14 {
+		t.Fatalf("Expected 14 days of flow, got %d", len(m.Flow))
+	}
+	for _, c := range []struct {
+		day                                    int
+		backlog, pending, inProgress, finished int
+	}{
+		{3, 0, 2, 0, 0},
+		{4, 0, 1, 1, 0},
+		{5, 1, 1, 1, 0},
+		{6, 1, 1, 0, 1},
+		{11, 1, 0, 0, 2},
+	} {
+		got := m.Flow[c.day-3].Counts
+		if got[model.StatusBacklog] != c.backlog || got[model.StatusPending] != c.pending ||
+			got[model.StatusInProgress] != c.inProgress || got[model.StatusDone] != c.finished {
+			t.Errorf("March %d: unexpected counts %v", c.day, got)
+		}
+	}
+}
+
+// TestFlowMetricsRenamedColumn checks that time in a column since renamed
+// is listed after the columns the boards still have
+func TestFlowMetricsRenamedColumn(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	project, _ := db.CreateProject("Site", "")
+	review, err := db.AddWorkflowState(project.ID, "Review", model.CategoryActive, 0)
+	if err != nil {
+		t.Fatalf("AddWorkflowState: %v", err)
+	}
+	w, _ := db.GetWorkflow(project.ID)
+	task, _ := db.CreateTask("Landing page", &project.ID)
+	for _, name := range []string{"In Progress", "Review", "Done"} {
+		if err := db.SetTaskState(task.ID, w[w.Find(name)]); err != nil {
+			t.Fatalf("Moving to %s: %v", name, err)
+		}
+	}
+	if err := db.RenameWorkflowState(review.ID, "Code review"); err != nil {
+		t.Fatalf("RenameWorkflowState: %v", err)
+	}
+
+	now := time.Now()
+	m, err := db.GetFlowMetrics(now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetFlowMetrics: %v", err)
+	}
+	var names []string
+	for _, c := range m.TimeInColumn {
+		names = append(names, c.Name)
+	}
+	if len(names) != 3 || names[0] != "Todo" || names[1] != "In Progress" || names[2] != "Review" {
+		t.Errorf("Expected Todo, In Progress, then the renamed Review, got %v", names)
+	}
+}
@@ -0,0 +1,468 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// The history table doubles as an undo/redo journal. Every mutating method
+// runs inside record, which snapshots the rows it touches before and after the
+// change and stores both as JSON. Rows sharing a batch_id are one undo step.
+
+var (
+	// ErrNothingToUndo is returned by Undo when the journal is empty
+	ErrNothingToUndo = errors.New("nothing to undo")
+	// ErrNothingToRedo is returned by Redo when nothing has been undone
+	ErrNothingToRedo = errors.New("nothing to redo")
+)
+
+// maxHistoryBatches is how many undo steps are kept
+const maxHistoryBatches = 200
+
+// journalTables maps history entity types to their table and primary key
+var journalTables = map[string]struct {
+	table string
+	keys  []string
+}{
+	"task":              {"tasks", []string{"id"}},
+	"project":           {"projects", []string{"id"}},
+	"tag":               {"tags", []string{"id"}},
+	"task_tag":          {"task_tags", []string{"task_id", "tag_id"}},
+	"task_dependency":   {"task_dependencies", []string{"task_id", "depends_on_id"}},
+	"time_entry":        {"time_entries", []string{"id"}},
+	"smart_list":        {"smart_lists", []string{"id"}},
+	"task_comment":      {"task_comments", []string{"id"}},
+	"task_activity":     {"task_activity", []string{"id"}},
+	"status_transition": {"status_transitions", []string{"id"}},
+	"workflow_state":    {"workflow_states", []string{"id"}},
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type journalEntry struct {
+	entity string
+	key    []interface{}
+	before sql.NullString
+}
+
+// journal is the transaction a recorded change runs in
+type journal struct {
+	*sql.Tx
+	entries []journalEntry
+	seen    map[string]bool
+}
+
+// track snapshots a row before it is changed. Tracking the same row twice
+// keeps the first snapshot.
+func (j *journal) track(entity string, key ...interface{}) error {
+	id := entity + "/" + entityID(key)
+	if j.seen[id] {
+		return nil
+	}
+	before, err := snapshot(j.Tx, entity, key)
+	if err != nil {
+		return err
+	}
+	j.seen[id] = true
+	j.entries = append(j.entries, journalEntry{entity: entity, key: key, before: before})
+	return nil
+}
+
+// Group returns a handle whose changes are journaled as a single undo step
+// with the given label, e.g. for operations applied to a whole selection.
+func (db *DB) Group(label string) *DB {
+	group := *db
+	group.batch = uuid.New().String()
+	group.batchLabel = label
+	return &group
+}
+
+// record runs fn in a transaction and journals every row it tracked
+func (db *DB) record(label string, fn func(j *journal) error) error {
+	return db.Transaction(func(tx *sql.Tx) error {
+		j := &journal{Tx: tx, seen: make(map[string]bool)}
+		if err := fn(j); err != nil {
+			return err
+		}
+		return db.writeJournal(j, label)
+	})
+}
+
+func (db *DB) writeJournal(j *journal, label string) error {
+	batch := db.batch
+	if batch == "" {
+		batch = uuid.New().String()
+	}
+	if db.batchLabel != "" {
+		label = db.batchLabel
+	}
+
+	// The activity entries a change adds are journaled after it
+	entries := j.entries
+	wrote := false
+	for i := 0; i < len(entries); i++ {
+		e := entries[i]
+		if i < len(j.entries) && e.entity == "task" {
+			if err := j.settleState(e.key[0]); err != nil {
+				return err
+			}
+		}
+		after, err := snapshot(j.Tx, e.entity, e.key)
+		if err != nil {
+			return err
+		}
+		if after == e.before {
+			continue
+		}
+		if i < len(j.entries) {
+			activity, err := j.logActivity(e, after)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, activity...)
+		}
+
+		action := "update"
+		if !e.before.Valid {
+			action = "create"
+		} else if !after.Valid {
+			action = "delete"
+		}
+
+		if _, err := j.Exec(`
+			INSERT INTO history (action, entity_type, entity_id, previous_state, new_state, batch_id, label)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, action, e.entity, entityID(e.key), e.before, after, batch, label); err != nil {
+			return err
+		}
+		wrote = true
+	}
+	if !wrote {
+		return nil
+	}
+
+	// A new change makes anything previously undone unreachable
+	if _, err := j.Exec(`DELETE FROM history WHERE undone = 1 AND batch_id != ?`, batch); err != nil {
+		return err
+	}
+
+	_, err := j.Exec(`
+		DELETE FROM history WHERE id < (
+			SELECT MIN(first_id) FROM (
+				SELECT MIN(id) AS first_id FROM history
+				GROUP BY batch_id ORDER BY first_id DESC LIMIT ?
+			)
+		)
+	`, maxHistoryBatches)
+	return err
+}
+
+// Undo reverts the most recent change and returns its label
+func (db *DB) Undo() (string, error) {
+	var batch, label sql.NullString
+	err := db.QueryRow(`
+		SELECT batch_id, label FROM history
+		WHERE undone = 0 AND batch_id IS NOT NULL
+		ORDER BY id DESC LIMIT 1
+	`).Scan(&batch, &label)
+	if err == sql.ErrNoRows {
+		return "", ErrNothingToUndo
+	}
+	if err != nil {
+		return "", err
+	}
+	return label.String, db.replay(batch.String, true)
+}
+
+// Redo reapplies the most recently undone change and returns its label
+func (db *DB) Redo() (string, error) {
+	var batch, label sql.NullString
+	err := db.QueryRow(`
+		SELECT batch_id, label FROM history
+		WHERE undone = 1
+		ORDER BY id ASC LIMIT 1
+	`).Scan(&batch, &label)
+	if err == sql.ErrNoRows {
+		return "", ErrNothingToRedo
+	}
+	if err != nil {
+		return "", err
+	}
+	return label.String, db.replay(batch.String, false)
+}
+
+// discard reverts a batch and forgets it, for a group of changes that
+// failed partway
+func (db *DB) discard(batch string) error {
+	if err := db.replay(batch, true); err != nil {
+		return err
+	}
+	_, err := db.Exec(`DELETE FROM history WHERE batch_id = ?`, batch)
+	return err
+}
+
+// replay restores every row in a batch to its previous (undo) or new (redo) state
+func (db *DB) replay(batch string, undo bool) error {
+	return db.Transaction(func(tx *sql.Tx) error {
+		// Rows are restored one at a time, so references may dangle briefly
+		if _, err := tx.Exec(`PRAGMA defer_foreign_keys = ON`); err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(`
+			SELECT entity_type, previous_state, new_state FROM history
+			WHERE batch_id = ? ORDER BY id
+		`, batch)
+		if err != nil {
+			return err
+		}
+		type change struct {
+			entity     string
+			prev, next sql.NullString
+		}
+		var changes []change
+		for rows.Next() {
+			var c change
+			if err := rows.Scan(&c.entity, &c.prev, &c.next); err != nil {
+				rows.Close()
+				return err
+			}
+			changes = append(changes, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if undo {
+			for i := len(changes) - 1; i >= 0; i-- {
+				if err := restoreRow(tx, changes[i].entity, changes[i].prev, changes[i].next); err != nil {
+					return err
+				}
+			}
+		} else {
+			for _, c := range changes {
+				if err := restoreRow(tx, c.entity, c.next, c.prev); err != nil {
+					return err
+				}
+			}
+		}
+
+		_, err = tx.Exec(`UPDATE history SET undone = ? WHERE batch_id = ?`, undo, batch)
+		return err
+	})
+}
+
+// snapshot returns a row as a JSON object, or NULL if it doesn't exist
+func snapshot(q querier, entity string, key []interface{}) (sql.NullString, error) {
+	t, ok := journalTables[entity]
+	if !ok {
+		return sql.NullString{}, fmt.Errorf("unknown history entity %q", entity)
+	}
+	cols, err := tableColumns(q, t.table)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+
+	pairs := make([]string, len(cols))
+	for i, c := range cols {
+		pairs[i] = fmt.Sprintf(`'%s', "%s"`, c, c)
+	}
+	where := make([]string, len(t.keys))
+	for i, k := range t.keys {
+		where[i] = fmt.Sprintf(`"%s" = ?`, k)
+	}
+
+	var state sql.NullString
+	err = q.QueryRow(fmt.Sprintf(`SELECT json_object(%s) FROM %s WHERE %s`,
+		strings.Join(pairs, ", "), t.table, strings.Join(where, " AND ")), key...).Scan(&state)
+	if err == sql.ErrNoRows {
+		return sql.NullString{}, nil
+	}
+	return state, err
+}
+
+// restoreRow puts a row back into state. A NULL state means the row didn't
+// exist, so it is deleted using the key found in other.
+func restoreRow(q querier, entity string, state, other sql.NullString) error {
+	t, ok := journalTables[entity]
+	if !ok {
+		return fmt.Errorf("unknown history entity %q", entity)
+	}
+
+	if !state.Valid {
+		where := make([]string, len(t.keys))
+		for i, k := range t.keys {
+			where[i] = fmt.Sprintf(`"%s" = json_extract(?1, '$.%s')`, k, k)
+		}
+		_, err := q.Exec(fmt.Sprintf(`DELETE FROM %s WHERE %s`, t.table, strings.Join(where, " AND ")), other.String)
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(state.String), &fields); err != nil {
+		return err
+	}
+	all, err := tableColumns(q, t.table)
+	if err != nil {
+		return err
+	}
+
+	// Columns added after the snapshot was taken keep their current value
+	isKey := make(map[string]bool)
+	for _, k := range t.keys {
+		isKey[k] = true
+	}
+	var cols, values, updates []string
+	for _, c := range all {
+		if _, ok := fields[c]; !ok {
+			continue
+		}
+		cols = append(cols, fmt.Sprintf(`"%s"`, c))
+		values = append(values, fmt.Sprintf(`json_extract(?1, '$.%s')`, c))
+		if !isKey[c] {
+			updates = append(updates, fmt.Sprintf(`"%s" = excluded."%s"`, c, c))
+		}
+	}
+
+	// An upsert rather than INSERT OR REPLACE, which would fire ON DELETE cascades
+	conflict := "DO NOTHING"
+	if len(updates) > 0 {
+		conflict = "DO UPDATE SET " + strings.Join(updates, ", ")
+	}
+	_, err = q.Exec(fmt.Sprintf(`INSERT INTO %s (%s) SELECT %s WHERE true ON CONFLICT (%s) %s`,
+		t.table, strings.Join(cols, ", "), strings.Join(values, ", "),
+		strings.Join(t.keys, ", "), conflict), state.String)
+	return err
+}
+
+// tableColumns lists a table's columns in declaration order
+func tableColumns(q querier, table string) ([]string, error) {
+	rows, err := q.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		cols = append(cols, name)
+	}
+	return cols, rows.Err()
+}
+
+func entityID(key []interface{}) string {
+	parts := make([]string, len(key))
+	for i, k := range key {
+		parts[i] = fmt.Sprint(k)
+	}
+	return strings.Join(parts, ":")
+}
+
+// trackTaskTree tracks a task, its subtasks and everything that references
+// them, i.e. every row a cascading delete of the task would remove.
+func (j *journal) trackTaskTree(id string) error {
+	rows, err := j.Query(`
+		WITH RECURSIVE tree(id, depth) AS (
+			SELECT id, 0 FROM tasks WHERE id = ?
+			UNION ALL
+			SELECT t.id, tree.depth + 1 FROM tasks t JOIN tree ON t.parent_id = tree.id
+		)
+		SELECT id FROM tree ORDER BY depth
+	`, id)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var tid string
+		if err := rows.Scan(&tid); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, tid)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Tasks first, then the rows that point at them
+	for _, tid := range ids {
+		if err := j.track("task", tid); err != nil {
+			return err
+		}
+	}
+	for _, tid := range ids {
+		if err := j.trackTaskRefs(tid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trackTaskRefs tracks the tag links, dependencies, time entries, comments,
+// activity and status transitions of a task
+func (j *journal) trackTaskRefs(id string) error {
+	type ref struct {
+		entity string
+		key    []interface{}
+	}
+	var refs []ref
+
+	queries := []struct {
+		entity string
+		query  string
+	}{
+		{"task_tag", `SELECT task_id, tag_id FROM task_tags WHERE task_id = ?1`},
+		{"task_dependency", `SELECT task_id, depends_on_id FROM task_dependencies WHERE task_id = ?1 OR depends_on_id = ?1`},
+		{"time_entry", `SELECT id, NULL FROM time_entries WHERE task_id = ?1`},
+		{"task_comment", `SELECT id, NULL FROM task_comments WHERE task_id = ?1`},
+		{"task_activity", `SELECT id, NULL FROM task_activity WHERE task_id = ?1`},
+		{"status_transition", `SELECT id, NULL FROM status_transitions WHERE task_id = ?1`},
+	}
+	for _, qq := range queries {
+		rows, err := j.Query(qq.query, id)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var a string
+			var b sql.NullString
+			if err := rows.Scan(&a, &b); err != nil {
+				rows.Close()
+				return err
+			}
+			key := []interface{}{a}
+			if b.Valid {
+				key = append(key, b.String)
+			}
+			refs = append(refs, ref{qq.entity, key})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range refs {
+		if err := j.track(r.entity, r.key...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestUndoRedoSurvivesReopen deletes a task with a subtask and tag, then undoes
+// and redoes the delete through a fresh connection to the same file.
+func TestUndoRedoSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	task, err := db.CreateTask("Write report", nil)
+	if err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+	sub, err := db.CreateSubtask("Outline", task.ID)
+	if err != nil {
+		t.Fatalf("Failed to create subtask: %v", err)
+	}
+	tag, err := db.CreateTag("work", "")
+	if err != nil {
+		t.Fatalf("Failed to create tag: %v", err)
+	}
+	if err := db.AddTagToTask(task.ID, tag.ID); err != nil {
+		t.Fatalf("Failed to tag task: %v", err)
+	}
+	if err := db.DeleteTask(task.ID); err != nil {
+		t.Fatalf("Failed to delete task: %v", err)
+	}
+	db.Close()
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	label, err := db.Undo()
+	if err != nil {
+		t.Fatalf("Failed to undo: %v", err)
+	}
+	if label != "Delete task" {
+		t.Errorf("Expected label %q, got %q", "Delete task", label)
+	}
+
+	if got, _ := db.GetTask(sub.ID); got == nil || got.ParentID == nil || *got.ParentID != task.ID {
+		t.Fatalf("Expected subtask to be restored under its parent, got %+v", got)
+	}
+	if tags, _ := db.GetTaskTags(task.ID); len(tags) != 1 || tags[0].ID != tag.ID {
+		t.Errorf("Expected tag to be restored, got %+v", tags)
+	}
+
+	if _, err := db.Redo(); err != nil {
+		t.Fatalf("Failed to redo: %v", err)
+	}
+	if got, _ := db.GetTask(task.ID); got != nil {
+		t.Errorf("Expected task to be deleted again after redo")
+	}
+	if _, err := db.Redo(); err != ErrNothingToRedo {
+		t.Errorf("Expected ErrNothingToRedo, got %v", err)
+	}
+
+	// Undo the delete again, then walk back through the tag and task creation
+	for i := 0; i < 5; i++ {
+		if _, err := db.Undo(); err != nil {
+			t.Fatalf("Undo %d failed: %v", i, err)
+		}
+	}
+	var count int
+	db.QueryRow(`SELECT COUNT(*) FROM tasks WHERE id IN (?, ?)`, task.ID, sub.ID).Scan(&count)
+	if count != 0 {
+		t.Errorf("Expected both tasks gone after undoing their creation, got %d", count)
+	}
+	if _, err := db.Undo(); err != ErrNothingToUndo {
+		t.Errorf("Expected ErrNothingToUndo, got %v", err)
+	}
+}
+
+// TestGroupUndoesAsOneStep checks that changes made through a Group share a batch
+func TestGroupUndoesAsOneStep(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	a, _ := db.CreateTask("A", nil)
+	b, _ := db.CreateTask("B", nil)
+
+	group := db.Group("Toggle done")
+	for _, id := range []string{a.ID, b.ID} {
+		if err := group.ToggleTaskStatus(id); err != nil {
+			t.Fatalf("Failed to toggle: %v", err)
+		}
+	}
+
+	label, err := db.Undo()
+	if err != nil || label != "Toggle done" {
+		t.Fatalf("Expected to undo %q, got %q (%v)", "Toggle done", label, err)
+	}
+	for _, id := range []string{a.ID, b.ID} {
+		task, _ := db.GetTask(id)
+		if task.Status != "pending" || task.CompletedAt != nil {
+			t.Errorf("Expected %s to be pending again, got %s", task.Title, task.Status)
+		}
+	}
+}
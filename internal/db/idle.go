@@ -0,0 +1,173 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+	"github.com/google/uuid"
+)
+
+// Ways of noticing time away, for the timer.idle_source setting
+const (
+	IdleSourceAuto  = "auto"  // The desktop's idle time, or klonch input where there is none
+	IdleSourceInput = "input" // Only input to klonch itself
+)
+
+// TimerConfig holds the settings for timers left running
+type TimerConfig struct {
+	IdleAfter  time.Duration // Time without input that counts as away; 0 never asks
+	IdleSource string        // IdleSourceAuto or IdleSourceInput
+	LongAfter  time.Duration // Running time that sends a notification; 0 never does
+}
+
+// TimerConfig reads the timer settings
+func (db *DB) TimerConfig() (TimerConfig, error) {
+	var c TimerConfig
+	for _, d := range []struct {
+		key string
+		dst *time.Duration
+	}{
+		{SettingTimerIdleAfter, &c.IdleAfter},
+		{SettingTimerLongAfter, &c.LongAfter},
+	} {
+		minutes, err := db.GetDurationSetting(d.key)
+		if err != nil {
+			return c, err
+		}
+		*d.dst = time.Duration(minutes) * time.Minute
+	}
+
+	var err error
+	c.IdleSource, err = db.GetSetting(SettingTimerIdleSource)
+	return c, err
+}
+
+// DiscardIdle takes the time between from and to out of a running timer, as
+// if it had been paused then. The period is clamped to when the timer
+// started and, for a paused timer, when it was paused.
+func (db *DB) DiscardIdle(id string, from, to time.Time) error {
+	return db.record("Discard idle time", func(j *journal) error {
+		e, err := runningEntry(j, id)
+		if err != nil {
+			return err
+		}
+		from, to = clampIdle(e, from, to)
+		if err := j.track("time_entry", id); err != nil {
+			return err
+		}
+		_, err = j.Exec(`UPDATE time_entries SET paused_seconds = paused_seconds + ? WHERE id = ?`,
+			int(to.Sub(from).Seconds()), id)
+		return err
+	})
+}
+
+// SplitIdle stops a running timer at from, logs the time until to as an
+// entry of its own for the same task, described as "Away", and starts the
+// timer again at to. It returns the ID of the away entry, which can then be
+// moved to another task or deleted from the timesheet.
+func (db *DB) SplitIdle(id string, from, to time.Time) (string, error) {
+	awayID := uuid.New().String()
+	runID := uuid.New().String()
+	err := db.record("Split idle time", func(j *journal) error {
+		e, err := runningEntry(j, id)
+		if err != nil {
+			return err
+		}
+		from, to = clampIdle(e, from, to)
+		if _, err := endTimer(j, e, from); err != nil {
+			return err
+		}
+
+		if err := j.track("time_entry", awayID); err != nil {
+			return err
+		}
+		if err := j.track("time_entry", runID); err != nil {
+			return err
+		}
+		now := Timestamp(time.Now())
+		_, err = j.Exec(`
+			INSERT INTO time_entries (id, task_id, description, started_at, ended_at, duration, is_pomodoro, created_at)
+			VALUES (?, ?, 'Away', ?, ?, ?, 0, ?)
+		`, awayID, nullIfEmpty(e.TaskID), Timestamp(from), Timestamp(to), int(to.Sub(from).Minutes()), now)
+		if err != nil {
+			return err
+		}
+		_, err = j.Exec(`
+			INSERT INTO time_entries (id, task_id, description, started_at, is_pomodoro, created_at)
+			VALUES (?, ?, ?, ?, 0, ?)
+		`, runID, nullIfEmpty(e.TaskID), nullIfEmpty(e.Description), Timestamp(to), now)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return awayID, nil
+}
+
+// runningEntry reads a timer that is still running
+func runningEntry(j *journal, id string) (*model.TimeEntry, error) {
+	e, err := scanTimeEntry(j.QueryRow(`SELECT `+timeEntryColumns+` FROM time_entries WHERE id = ?`, id))
+	if err == sql.ErrNoRows || (err == nil && !e.IsRunning()) {
+		return nil, ErrTimerNotRunning
+	}
+	return e, err
+}
+
+// clampIdle keeps an idle period within the time a timer was counting
+func clampIdle(e *model.TimeEntry, from, to time.Time) (time.Time, time.Time) {
+	if now := time.Now(); to.After(now) {
+		to = now
+	}
+	if e.PausedAt != nil && to.After(*e.PausedAt) {
+		to = *e.PausedAt
+	}
+	if from.Before(e.StartedAt) {
+		from = e.StartedAt
+	}
+	if to.Before(from) {
+		to = from
+	}
+	return from, to
+}
+
+// ClaimLongTimer returns the running timer if it has counted for at least
+// the given time and no one has been told yet, marking it told. The TUI and
+// the reminder daemon both check, and whichever notices first sends the
+// notification. It returns nil when there is nothing to send.
+func (db *DB) ClaimLongTimer(after time.Duration, now time.Time) (*TimesheetEntry, error) {
+	var e TimesheetEntry
+	var endedAt, pausedAt *string
+	err := db.QueryRow(`
+		SELECT te.id, COALESCE(te.task_id, ''), COALESCE(te.description, ''), te.started_at, te.ended_at,
+		       te.duration, te.is_pomodoro, te.paused_at, te.paused_seconds, te.created_at,
+		       COALESCE(t.title, '')
+		FROM time_entries te
+		LEFT JOIN tasks t ON t.id = te.task_id
+		WHERE te.ended_at IS NULL AND te.alerted_at IS NULL
+		ORDER BY julianday(te.started_at) DESC LIMIT 1
+	`).Scan(&e.ID, &e.TaskID, &e.Description, &e.StartedAt, &endedAt,
+		&e.Duration, &e.IsPomodoro, &pausedAt, &e.PausedSeconds, &e.CreatedAt, &e.TaskTitle)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	e.StartedAt = e.StartedAt.Local()
+	e.CreatedAt = e.CreatedAt.Local()
+	e.PausedAt = parseTimestampPtr(pausedAt)
+	if e.Elapsed(now) < after {
+		return nil, nil
+	}
+
+	res, err := db.Exec(`UPDATE time_entries SET alerted_at = ? WHERE id = ? AND alerted_at IS NULL`,
+		Timestamp(now), e.ID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, nil
+	}
+	return &e, nil
+}
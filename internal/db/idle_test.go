@@ -0,0 +1,110 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+)
+
+// TestIdleTime checks discarding and splitting off time away from a running
+// timer
+func TestIdleTime(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	task := &model.Task{Title: "Write report"}
+	if err := db.AddTask(task, nil); err != nil {
+		t.Fatalf("Failed to add task: %v", err)
+	}
+	start := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	id, err := db.StartTimeEntry(task.ID, start, false)
+	if err != nil {
+		t.Fatalf("Failed to start timer: %v", err)
+	}
+
+	// Time away from before the timer started only counts from its start
+	if err := db.DiscardIdle(id, start.Add(-time.Hour), start.Add(30*time.Minute)); err != nil {
+		t.Fatalf("DiscardIdle: %v", err)
+	}
+	e, _ := db.RunningTimer()
+	if e.PausedSeconds != 30*60 {
+		t.Errorf("Expected 30 minutes discarded, got %ds", e.PausedSeconds)
+	}
+	if label, err := db.Undo(); err != nil || label != "Discard idle time" {
+		t.Errorf("Undo = %q, %v", label, err)
+	}
+	if e, _ = db.RunningTimer(); e.PausedSeconds != 0 {
+		t.Errorf("Expected undo to restore the time, got %ds paused", e.PausedSeconds)
+	}
+
+	db.UpdateTimeEntry(id, start, nil, "Draft")
+	awayID, err := db.SplitIdle(id, start.Add(time.Hour), start.Add(90*time.Minute))
+	if err != nil {
+		t.Fatalf("SplitIdle: %v", err)
+	}
+	entries, _ := db.GetTimesheet(start, time.Now().Add(time.Minute))
+	if len(entries) != 3 {
+		t.Fatalf("Expected the timer split in three, got %d entries", len(entries))
+	}
+	before, away, after := entries[0], entries[1], entries[2]
+	if before.ID != id || before.IsRunning() || before.CalculatedDuration() != 60 {
+		t.Errorf("Unexpected entry before going away: %+v", before)
+	}
+	if away.ID != awayID || away.CalculatedDuration() != 30 || away.Description != "Away" || away.TaskID != task.ID {
+		t.Errorf("Unexpected away entry: %+v", away)
+	}
+	if !after.IsRunning() || after.TaskID != task.ID || after.Description != "Draft" ||
+		!after.StartedAt.Equal(start.Add(90*time.Minute)) {
+		t.Errorf("Unexpected entry after coming back: %+v", after)
+	}
+
+	if err := db.DiscardIdle(id, start, start.Add(time.Minute)); err != ErrTimerNotRunning {
+		t.Errorf("Expected a stopped timer to be refused, got %v", err)
+	}
+}
+
+// TestClaimLongTimer checks that a long-running timer is reported once
+func TestClaimLongTimer(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if c, _ := db.TimerConfig(); c.IdleAfter != 10*time.Minute || c.LongAfter != 4*time.Hour ||
+		c.IdleSource != IdleSourceAuto {
+		t.Errorf("Unexpected default timer settings: %+v", c)
+	}
+	if err := db.SetSetting(SettingTimerIdleAfter, "OFF"); err != nil {
+		t.Fatalf("Failed to turn off idle detection: %v", err)
+	}
+	if c, _ := db.TimerConfig(); c.IdleAfter != 0 {
+		t.Errorf("Expected idle detection off, got %v", c.IdleAfter)
+	}
+	if err := db.SetSetting(SettingPomodoroWork, "off"); err == nil {
+		t.Errorf("Expected a Pomodoro session that can't be turned off to refuse off")
+	}
+
+	task := &model.Task{Title: "Write report"}
+	if err := db.AddTask(task, nil); err != nil {
+		t.Fatalf("Failed to add task: %v", err)
+	}
+	now := time.Now().Truncate(time.Second)
+	id, _ := db.StartTimeEntry(task.ID, now.Add(-3*time.Hour), false)
+
+	if e, err := db.ClaimLongTimer(4*time.Hour, now); err != nil || e != nil {
+		t.Fatalf("Expected nothing to report yet, got %+v (%v)", e, err)
+	}
+	e, err := db.ClaimLongTimer(4*time.Hour, now.Add(time.Hour))
+	if err != nil || e == nil || e.ID != id || e.TaskTitle != "Write report" {
+		t.Fatalf("Expected the timer to be reported, got %+v (%v)", e, err)
+	}
+	if e, _ := db.ClaimLongTimer(4*time.Hour, now.Add(2*time.Hour)); e != nil {
+		t.Errorf("Expected the timer to be reported only once")
+	}
+}
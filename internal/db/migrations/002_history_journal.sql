@@ -0,0 +1,16 @@
+-- +goose Up
+-- Turn the history table into an undo/redo journal. Every row is one entity
+-- change; rows sharing a batch_id form a single undoable action.
+ALTER TABLE history ADD COLUMN new_state TEXT;
+ALTER TABLE history ADD COLUMN batch_id TEXT;
+ALTER TABLE history ADD COLUMN label TEXT;
+ALTER TABLE history ADD COLUMN undone INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_history_batch ON history(batch_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_history_batch;
+ALTER TABLE history DROP COLUMN undone;
+ALTER TABLE history DROP COLUMN label;
+ALTER TABLE history DROP COLUMN batch_id;
+ALTER TABLE history DROP COLUMN new_state;
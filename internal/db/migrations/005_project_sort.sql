@@ -0,0 +1,6 @@
+-- +goose Up
+-- Task order chosen with :sort while the list shows this project
+ALTER TABLE projects ADD COLUMN sort_order TEXT;
+
+-- +goose Down
+ALTER TABLE projects DROP COLUMN sort_order;
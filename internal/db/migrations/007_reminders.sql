@@ -0,0 +1,19 @@
+-- +goose Up
+-- Reminder offsets before the due date, e.g. "1d,1h" or "none". NULL follows
+-- the reminders.default setting.
+ALTER TABLE tasks ADD COLUMN reminders TEXT;
+
+-- Reminders that have gone off, so each one is sent once. No foreign key:
+-- rows outlive deleted tasks, so undoing a delete doesn't repeat them, and
+-- are pruned once they are too old to matter.
+CREATE TABLE reminders (
+    task_id TEXT NOT NULL,
+    remind_at DATETIME NOT NULL,
+    sent_at DATETIME NOT NULL,
+    missed INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (task_id, remind_at)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS reminders;
+ALTER TABLE tasks DROP COLUMN reminders;
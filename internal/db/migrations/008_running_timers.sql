@@ -0,0 +1,22 @@
+-- +goose Up
+-- Timers run in the database rather than in a view, so they survive
+-- restarts: a running entry has no ended_at, and a paused one records when
+-- it was paused and the time spent paused before that.
+ALTER TABLE time_entries ADD COLUMN paused_at DATETIME;
+ALTER TABLE time_entries ADD COLUMN paused_seconds INTEGER NOT NULL DEFAULT 0;
+
+-- Only one timer runs at a time. Earlier versions left entries running when
+-- klonch quit; keep the latest for klonch to ask about and close the rest
+-- without adding time, as they never counted towards any total.
+UPDATE time_entries SET ended_at = started_at, duration = 0
+WHERE ended_at IS NULL AND id != (
+    SELECT id FROM time_entries WHERE ended_at IS NULL
+    ORDER BY julianday(started_at) DESC LIMIT 1
+);
+
+CREATE INDEX idx_time_entries_running ON time_entries(ended_at) WHERE ended_at IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_time_entries_running;
+ALTER TABLE time_entries DROP COLUMN paused_seconds;
+ALTER TABLE time_entries DROP COLUMN paused_at;
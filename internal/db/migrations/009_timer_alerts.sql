@@ -0,0 +1,7 @@
+-- +goose Up
+-- When klonch last warned that a timer had been running for a long time,
+-- so the TUI and the reminder daemon warn only once between them
+ALTER TABLE time_entries ADD COLUMN alerted_at DATETIME;
+
+-- +goose Down
+ALTER TABLE time_entries DROP COLUMN alerted_at;
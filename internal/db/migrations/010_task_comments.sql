@@ -0,0 +1,38 @@
+-- +goose Up
+-- Comments are notes added to a task over time, each with its own timestamp
+CREATE TABLE task_comments (
+    id TEXT PRIMARY KEY,
+    task_id TEXT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_task_comments_task ON task_comments(task_id, created_at);
+
+-- The activity stream is what happened to a task: it was created, its
+-- status, priority, due date or project changed, or time was logged on it.
+-- Entries are written with the change that caused them and undone with it.
+CREATE TABLE task_activity (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    task_id TEXT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    old_value TEXT,
+    new_value TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_task_activity_task ON task_activity(task_id, created_at);
+
+-- Tasks that predate the stream start it with what is known about them
+INSERT INTO task_activity (task_id, kind, created_at)
+SELECT id, 'created', created_at FROM tasks;
+
+INSERT INTO task_activity (task_id, kind, new_value, created_at)
+SELECT id, 'status', 'done', completed_at FROM tasks
+WHERE completed_at IS NOT NULL AND status IN ('done', 'archived');
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_task_activity_task;
+DROP TABLE IF EXISTS task_activity;
+DROP INDEX IF EXISTS idx_task_comments_task;
+DROP TABLE IF EXISTS task_comments;
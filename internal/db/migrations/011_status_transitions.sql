@@ -0,0 +1,37 @@
+-- +goose Up
+-- Every change of a task's status, for lead and cycle times and the
+-- cumulative flow diagram. A task's first transition, from NULL, is its
+-- creation. Rows are written with the change that caused them and undone
+-- with it.
+CREATE TABLE status_transitions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    task_id TEXT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    from_status TEXT,
+    to_status TEXT NOT NULL,
+    changed_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_status_transitions_task ON status_transitions(task_id, changed_at);
+CREATE INDEX idx_status_transitions_changed ON status_transitions(changed_at);
+
+-- Earlier changes are known only from the activity stream. A task starts in
+-- the status its first recorded change left, or, failing that, pending if it
+-- has been completed and its current status otherwise.
+INSERT INTO status_transitions (task_id, from_status, to_status, changed_at)
+SELECT t.id, NULL, COALESCE(
+    (SELECT a.old_value FROM task_activity a
+     WHERE a.task_id = t.id AND a.kind = 'status'
+     ORDER BY a.created_at, a.id LIMIT 1),
+    CASE WHEN t.completed_at IS NOT NULL THEN 'pending' ELSE t.status END
+), t.created_at
+FROM tasks t;
+
+INSERT INTO status_transitions (task_id, from_status, to_status, changed_at)
+SELECT task_id, COALESCE(old_value, 'pending'), new_value, created_at
+FROM task_activity WHERE kind = 'status'
+ORDER BY created_at, id;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_status_transitions_changed;
+DROP INDEX IF EXISTS idx_status_transitions_task;
+DROP TABLE IF EXISTS status_transitions;
@@ -0,0 +1,37 @@
+-- +goose Up
+-- A project's own Kanban columns, in order. Projects without any use the
+-- default workflow, a column for each status. The category says what a
+-- state means elsewhere: tasks in open, active and done states are pending,
+-- in progress and done.
+CREATE TABLE workflow_states (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    category TEXT NOT NULL CHECK (category IN ('open', 'active', 'done')),
+    position INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_workflow_states_project ON workflow_states(project_id, position);
+
+-- The column a task is in on its project's own board; NULL on the default one
+ALTER TABLE tasks ADD COLUMN state_id TEXT REFERENCES workflow_states(id) ON DELETE SET NULL;
+
+-- Transitions also name the columns a task left and entered
+ALTER TABLE status_transitions ADD COLUMN from_state TEXT;
+ALTER TABLE status_transitions ADD COLUMN to_state TEXT;
+
+UPDATE status_transitions SET
+    from_state = CASE from_status
+        WHEN 'backlog' THEN 'Backlog' WHEN 'pending' THEN 'Todo'
+        WHEN 'in_progress' THEN 'In Progress' WHEN 'done' THEN 'Done' END,
+    to_state = CASE to_status
+        WHEN 'backlog' THEN 'Backlog' WHEN 'pending' THEN 'Todo'
+        WHEN 'in_progress' THEN 'In Progress' WHEN 'done' THEN 'Done' END;
+
+-- +goose Down
+ALTER TABLE status_transitions DROP COLUMN to_state;
+ALTER TABLE status_transitions DROP COLUMN from_state;
+ALTER TABLE tasks DROP COLUMN state_id;
+DROP INDEX IF EXISTS idx_workflow_states_project;
+DROP TABLE IF EXISTS workflow_states;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- The most tasks a Kanban column should hold, 0 for no limit. Columns of
+-- the default workflow take theirs from the kanban.wip_* settings.
+ALTER TABLE workflow_states ADD COLUMN wip_limit INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE workflow_states DROP COLUMN wip_limit;
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"time"
+)
+
+// PomodoroConfig holds the Pomodoro timer settings
+type PomodoroConfig struct {
+	Work           time.Duration
+	ShortBreak     time.Duration
+	LongBreak      time.Duration
+	LongBreakEvery int  // Work sessions before a long break; 0 means never
+	AutoBreak      bool // Start the break when a work session ends
+	AutoWork       bool // Start the next work session when a break ends
+	DailyGoal      int  // Work sessions to complete each day; 0 means no goal
+}
+
+// PomodoroConfig reads the Pomodoro settings, falling back to the defaults
+// for values that no longer parse
+func (db *DB) PomodoroConfig() (PomodoroConfig, error) {
+	var c PomodoroConfig
+	for _, d := range []struct {
+		key string
+		dst *time.Duration
+	}{
+		{SettingPomodoroWork, &c.Work},
+		{SettingPomodoroShortBreak, &c.ShortBreak},
+		{SettingPomodoroLongBreak, &c.LongBreak},
+	} {
+		minutes, err := db.GetDurationSetting(d.key)
+		if err != nil {
+			return c, err
+		}
+		*d.dst = time.Duration(minutes) * time.Minute
+	}
+
+	var err error
+	if c.LongBreakEvery, err = db.GetCountSetting(SettingPomodoroLongBreakEvery); err != nil {
+		return c, err
+	}
+	if c.DailyGoal, err = db.GetCountSetting(SettingPomodoroDailyGoal); err != nil {
+		return c, err
+	}
+	if c.AutoBreak, err = db.GetBoolSetting(SettingPomodoroAutoBreak); err != nil {
+		return c, err
+	}
+	if c.AutoWork, err = db.GetBoolSetting(SettingPomodoroAutoWork); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// LongBreakDue reports whether the break after the given number of work
+// sessions since the last long break should be a long one
+func (c PomodoroConfig) LongBreakDue(sessions int) bool {
+	return c.LongBreakEvery > 0 && sessions >= c.LongBreakEvery
+}
+
+// CountPomodoros counts the Pomodoro sessions completed since a moment
+func (db *DB) CountPomodoros(since time.Time) (int, error) {
+	var n int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM time_entries
+		WHERE is_pomodoro = 1 AND ended_at IS NOT NULL AND julianday(ended_at) >= julianday(?)
+	`, Timestamp(since)).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestPomodoroConfig checks the defaults, custom cycles and when long
+// breaks fall due
+func TestPomodoroConfig(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	cfg, err := db.PomodoroConfig()
+	if err != nil {
+		t.Fatalf("PomodoroConfig: %v", err)
+	}
+	if cfg.Work != 25*time.Minute || cfg.ShortBreak != 5*time.Minute || cfg.LongBreak != 15*time.Minute {
+		t.Errorf("Unexpected default lengths: %+v", cfg)
+	}
+	if cfg.LongBreakEvery != 4 || cfg.DailyGoal != 8 || cfg.AutoBreak || cfg.AutoWork {
+		t.Errorf("Unexpected default cycle: %+v", cfg)
+	}
+
+	for key, value := range map[string]string{
+		SettingPomodoroWork:           "50m",
+		SettingPomodoroShortBreak:     "10",
+		SettingPomodoroLongBreakEvery: "3",
+		SettingPomodoroAutoBreak:      "yes",
+		SettingPomodoroDailyGoal:      "0",
+	} {
+		if err := db.SetSetting(key, value); err != nil {
+			t.Fatalf("Failed to set %s: %v", key, err)
+		}
+	}
+	if err := db.SetSetting(SettingPomodoroLongBreakEvery, "-1"); err == nil {
+		t.Errorf("Expected a negative count to be rejected")
+	}
+	if err := db.SetSetting(SettingPomodoroWork, "0"); err == nil {
+		t.Errorf("Expected an empty work session to be rejected")
+	}
+
+	cfg, _ = db.PomodoroConfig()
+	if cfg.Work != 50*time.Minute || cfg.ShortBreak != 10*time.Minute || cfg.LongBreakEvery != 3 ||
+		!cfg.AutoBreak || cfg.DailyGoal != 0 {
+		t.Errorf("Settings not applied: %+v", cfg)
+	}
+	if cfg.LongBreakDue(2) || !cfg.LongBreakDue(3) {
+		t.Errorf("Expected a long break after every third session")
+	}
+	cfg.LongBreakEvery = 0
+	if cfg.LongBreakDue(10) {
+		t.Errorf("Expected no long breaks when turned off")
+	}
+}
+
+// TestCountPomodoros checks that finished sessions count, with or without
+// a task, and running ones don't
+func TestCountPomodoros(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	id, err := db.StartTimeEntry("", now.Add(-25*time.Minute), true)
+	if err != nil {
+		t.Fatalf("Failed to start a session without a task: %v", err)
+	}
+	if _, err := db.StopTimer(id, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.StartTimeEntry("", now, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := db.CountPomodoros(now.Add(-time.Hour)); err != nil || n != 1 {
+		t.Errorf("Expected 1 finished session, got %d (%v)", n, err)
+	}
+	if n, _ := db.CountPomodoros(now.Add(time.Minute)); n != 0 {
+		t.Errorf("Expected no sessions after now, got %d", n)
+	}
+}
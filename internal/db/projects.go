@@ -11,7 +11,7 @@ import (
 // GetProjects returns all non-archived projects
 func (db *DB) GetProjects() ([]model.Project, error) {
 	rows, err := db.Query(`
-		SELECT p.id, p.name, p.color, p.archived, p.position, p.created_at, p.updated_at,
+		SELECT p.id, p.name, p.color, p.archived, p.position, COALESCE(p.sort_order, ''), p.created_at, p.updated_at,
 		       (SELECT COUNT(*) FROM tasks WHERE project_id = p.id AND status != 'archived') as task_count,
 		       (SELECT COUNT(*) FROM tasks WHERE project_id = p.id AND status = 'done') as completed_count
 		FROM projects p
@@ -29,7 +29,7 @@ func (db *DB) GetProjects() ([]model.Project, error) {
 		var archived int
 		var color *string
 		err := rows.Scan(
-			&p.ID, &p.Name, &color, &archived, &p.Position,
+			&p.ID, &p.Name, &color, &archived, &p.Position, &p.SortOrder,
 			&p.CreatedAt, &p.UpdatedAt, &p.TaskCount, &p.CompletedCount,
 		)
 		if err != nil {
@@ -52,9 +52,9 @@ func (db *DB) GetProject(id string) (*model.Project, error) {
 	var color *string
 
 	err := db.QueryRow(`
-		SELECT id, name, color, archived, position, created_at, updated_at
+		SELECT id, name, color, archived, position, COALESCE(sort_order, ''), created_at, updated_at
 		FROM projects WHERE id = ?
-	`, id).Scan(&p.ID, &p.Name, &color, &archived, &p.Position, &p.CreatedAt, &p.UpdatedAt)
+	`, id).Scan(&p.ID, &p.Name, &color, &archived, &p.Position, &p.SortOrder, &p.CreatedAt, &p.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -71,6 +71,34 @@ func (db *DB) GetProject(id string) (*model.Project, error) {
 	return &p, nil
 }
 
+// GetProjectByName returns a non-archived project by name, ignoring case
+func (db *DB) GetProjectByName(name string) (*model.Project, error) {
+	var id string
+	err := db.QueryRow(`
+		SELECT id FROM projects
+		WHERE LOWER(name) = LOWER(?) AND archived = 0
+	`, name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return db.GetProject(id)
+}
+
+// GetOrCreateProject gets a project by name or creates it if it doesn't exist
+func (db *DB) GetOrCreateProject(name, color string) (*model.Project, error) {
+	project, err := db.GetProjectByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if project != nil {
+		return project, nil
+	}
+	return db.CreateProject(name, color)
+}
+
 // CreateProject creates a new project
 func (db *DB) CreateProject(name, color string) (*model.Project, error) {
 	id := uuid.New().String()
@@ -84,11 +112,16 @@ func (db *DB) CreateProject(name, color string) (*model.Project, error) {
 		position = int(maxPos.Int64) + 1
 	}
 
-	_, err := db.Exec(`
-		INSERT INTO projects (id, name, color, position, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, id, name, color, position, now, now)
-
+	err := db.record("Create project", func(j *journal) error {
+		if err := j.track("project", id); err != nil {
+			return err
+		}
+		_, err := j.Exec(`
+			INSERT INTO projects (id, name, color, position, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, id, name, color, position, Timestamp(now), Timestamp(now))
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -105,33 +138,71 @@ func (db *DB) CreateProject(name, color string) (*model.Project, error) {
 
 // UpdateProject updates a project
 func (db *DB) UpdateProject(id, name, color string) error {
-	now := time.Now()
-	_, err := db.Exec(`
-		UPDATE projects SET name = ?, color = ?, updated_at = ? WHERE id = ?
-	`, name, color, now, id)
-	return err
+	return db.updateProject("Edit project", id, `name = ?, color = ?`, name, color)
 }
 
 // ArchiveProject archives a project
 func (db *DB) ArchiveProject(id string) error {
-	now := time.Now()
-	_, err := db.Exec(`
-		UPDATE projects SET archived = 1, updated_at = ? WHERE id = ?
-	`, now, id)
-	return err
+	return db.updateProject("Archive project", id, `archived = 1`)
+}
+
+// SetProjectSortOrder saves the task order used while the list shows a
+// project; an empty order falls back to the list.sort setting
+func (db *DB) SetProjectSortOrder(id string, order model.SortOrder) error {
+	var value interface{}
+	if len(order) > 0 {
+		value = order.String()
+	}
+	return db.updateProject("Sort project", id, `sort_order = ?`, value)
+}
+
+// updateProject journals a single-row UPDATE of a project
+func (db *DB) updateProject(label, id, set string, args ...interface{}) error {
+	return db.record(label, func(j *journal) error {
+		if err := j.track("project", id); err != nil {
+			return err
+		}
+		args = append(args, Timestamp(time.Now()), id)
+		_, err := j.Exec(`UPDATE projects SET `+set+`, updated_at = ? WHERE id = ?`, args...)
+		return err
+	})
 }
 
 // DeleteProject deletes a project (moves tasks to inbox)
 func (db *DB) DeleteProject(id string) error {
-	return db.Transaction(func(tx *sql.Tx) error {
+	return db.record("Delete project", func(j *journal) error {
+		taskIDs, err := queryStrings(j, `SELECT id FROM tasks WHERE project_id = ?`, id)
+		if err != nil {
+			return err
+		}
+		for _, taskID := range taskIDs {
+			if err := j.track("task", taskID); err != nil {
+				return err
+			}
+		}
+		if err := j.track("project", id); err != nil {
+			return err
+		}
+
+		// Its workflow goes with it
+		stateIDs, err := queryStrings(j, `SELECT id FROM workflow_states WHERE project_id = ?`, id)
+		if err != nil {
+			return err
+		}
+		for _, stateID := range stateIDs {
+			if err := j.track("workflow_state", stateID); err != nil {
+				return err
+			}
+		}
+
 		// Move tasks to inbox
-		_, err := tx.Exec(`UPDATE tasks SET project_id = 'inbox' WHERE project_id = ?`, id)
+		_, err = j.Exec(`UPDATE tasks SET project_id = 'inbox' WHERE project_id = ?`, id)
 		if err != nil {
 			return err
 		}
 
 		// Delete project
-		_, err = tx.Exec(`DELETE FROM projects WHERE id = ?`, id)
+		_, err = j.Exec(`DELETE FROM projects WHERE id = ?`, id)
 		return err
 	})
 }
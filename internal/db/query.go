@@ -0,0 +1,668 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/dori/klonch/internal/model"
+	"github.com/dori/klonch/internal/parse"
+)
+
+// A query is a small filter language compiled to SQL over the tasks table:
+//
+//	project:work and (tag:review or priority>=high) and due<+3d and not status:done
+//
+// Terms are field:value or field<op>value, with ops = != < <= > >=. Terms
+// next to each other are ANDed; "or", "not", "-" and parentheses combine
+// them. Comma-separated values match any of them (status:pending,in_progress).
+// state:review matches tasks in a Kanban column by name.
+// #name, @name and !name are shorthand for project, tag and priority, the
+// same as in quick add. Bare words match the title or description.
+//
+// Dates are read as quick add reads them (today, fri, eow, +3d, -2w,
+// 2024-01-15), so a word means the same day in both, plus the spans week,
+// month, year, lastweek, nextweek, lastmonth and nextmonth. due<today
+// means due before today began; due:week means due some time this week.
+
+// Query is a parsed filter expression
+type Query struct {
+	src    string
+	root   queryNode
+	fields map[string]bool
+}
+
+// ParseQuery parses a filter expression
+func ParseQuery(src string) (*Query, error) {
+	tokens, err := lexQuery(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+
+	p := &queryParser{tokens: tokens, fields: make(map[string]bool)}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok != nil {
+		return nil, fmt.Errorf("unexpected %q", tok.text)
+	}
+	return &Query{src: strings.TrimSpace(src), root: root, fields: p.fields}, nil
+}
+
+// String returns the query as it was written
+func (q *Query) String() string {
+	return q.src
+}
+
+// Uses reports whether the query mentions a field, e.g. so callers can skip
+// their default status filter when the query picks statuses itself. Shorthand
+// counts as its field, is: counts as "is", and is:deferred also as "start".
+func (q *Query) Uses(field string) bool {
+	return q.fields[field]
+}
+
+// Condition returns an SQL condition that holds when idColumn is the ID of a
+// matching task, e.g. Condition("t.id") for a query that aliases tasks as t.
+// Relative dates are resolved against the current time.
+func (q *Query) Condition(idColumn string) (string, []interface{}) {
+	c := &queryCompiler{now: time.Now()}
+	where := q.root.compile(c)
+	return fmt.Sprintf("%s IN (SELECT tasks.id FROM tasks WHERE %s)", idColumn, where), c.args
+}
+
+// MatchingTaskIDs returns the IDs of every task the query matches, subtasks
+// and finished tasks included
+func (db *DB) MatchingTaskIDs(q *Query) (map[string]bool, error) {
+	cond, args := q.Condition("id")
+	ids, err := queryStrings(db.DB, `SELECT id FROM tasks WHERE `+cond, args...)
+	if err != nil {
+		return nil, err
+	}
+	matches := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		matches[id] = true
+	}
+	return matches, nil
+}
+
+// Tokens
+
+type queryTokenKind int
+
+const (
+	tokenWord queryTokenKind = iota
+	tokenLParen
+	tokenRParen
+	tokenMinus
+)
+
+type queryToken struct {
+	kind   queryTokenKind
+	text   string // As written, for error messages
+	value  string // Unquoted
+	quoted bool   // Wholly quoted, so never a keyword or a field
+}
+
+// lexQuery splits a query into words and parentheses. Quotes may appear
+// anywhere in a word, e.g. project:"Side projects".
+func lexQuery(src string) ([]queryToken, error) {
+	var tokens []queryToken
+	runes := []rune(src)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokenLParen, text: "("})
+			i++
+			continue
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokenRParen, text: ")"})
+			i++
+			continue
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			tokens = append(tokens, queryToken{kind: tokenMinus, text: "-"})
+			i++
+			continue
+		}
+
+		start := i
+		var value strings.Builder
+		quoted := r == '"'
+		for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' {
+			if runes[i] != '"' {
+				value.WriteRune(runes[i])
+				i++
+				continue
+			}
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated quote in %q", string(runes[start:]))
+			}
+			value.WriteString(string(runes[i+1 : end]))
+			i = end + 1
+		}
+		text := string(runes[start:i])
+		quoted = quoted && strings.HasSuffix(text, `"`)
+		tokens = append(tokens, queryToken{kind: tokenWord, text: text, value: value.String(), quoted: quoted})
+	}
+	return tokens, nil
+}
+
+// Parser
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+	fields map[string]bool
+}
+
+func (p *queryParser) peek() *queryToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+// keyword reports whether the next token is the given unquoted keyword
+func (p *queryParser) keyword(word string) bool {
+	tok := p.peek()
+	return tok != nil && tok.kind == tokenWord && !tok.quoted && strings.EqualFold(tok.value, word)
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = boolNode{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if tok == nil || tok.kind == tokenRParen || p.keyword("or") {
+			return left, nil
+		}
+		if p.keyword("and") {
+			p.pos++
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = boolNode{op: "AND", left: left, right: right}
+	}
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	tok := p.peek()
+	if tok == nil {
+		return nil, fmt.Errorf("query ends too early")
+	}
+	if tok.kind == tokenMinus || p.keyword("not") {
+		p.pos++
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner: inner}, nil
+	}
+	if tok.kind == tokenLParen {
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.peek(); tok == nil || tok.kind != tokenRParen {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return inner, nil
+	}
+	if tok.kind == tokenRParen {
+		return nil, fmt.Errorf("unexpected )")
+	}
+	if p.keyword("and") || p.keyword("or") {
+		return nil, fmt.Errorf("%q needs something on both sides", tok.value)
+	}
+	p.pos++
+	return p.parseTerm(*tok)
+}
+
+// queryOps lists comparison operators, longest first so <= wins over <
+var queryOps = []string{"!=", "<=", ">=", ":", "=", "<", ">"}
+
+// parseTerm turns a word into a field comparison or a text match
+func (p *queryParser) parseTerm(tok queryToken) (queryNode, error) {
+	if tok.quoted {
+		return textNode{columns: []string{"title", "description"}, value: tok.value}, nil
+	}
+
+	word := tok.value
+	switch {
+	case len(word) > 1 && word[0] == '#':
+		return p.newTerm("project", ":", word[1:])
+	case len(word) > 1 && word[0] == '@':
+		return p.newTerm("tag", ":", word[1:])
+	case len(word) > 1 && word[0] == '!':
+		return p.newTerm("priority", ":", word[1:])
+	}
+
+	// A field is a run of letters before the first operator
+	for i, r := range word {
+		if unicode.IsLetter(r) || r == '_' {
+			continue
+		}
+		for _, op := range queryOps {
+			if i > 0 && strings.HasPrefix(word[i:], op) {
+				return p.newTerm(strings.ToLower(word[:i]), op, word[i+len(op):])
+			}
+		}
+		break
+	}
+	return textNode{columns: []string{"title", "description"}, value: word}, nil
+}
+
+// newTerm validates a field comparison
+func (p *queryParser) newTerm(field, op, value string) (queryNode, error) {
+	if alias, ok := fieldAliases[field]; ok {
+		field = alias
+	}
+	p.fields[field] = true
+	if value == "" {
+		return nil, fmt.Errorf("%s%s needs a value", field, op)
+	}
+	equality := op == ":" || op == "=" || op == "!="
+	negate := op == "!="
+	values := strings.Split(value, ",")
+
+	var node queryNode
+	switch field {
+	case "project":
+		if !equality {
+			return nil, fmt.Errorf("project only supports : and !=")
+		}
+		node = projectNode{names: values}
+
+	case "tag":
+		if !equality {
+			return nil, fmt.Errorf("tag only supports : and !=")
+		}
+		node = tagNode{names: values}
+
+	case "status":
+		if !equality {
+			return nil, fmt.Errorf("status only supports : and !=")
+		}
+		var statuses []string
+		for _, v := range values {
+			switch v = strings.ToLower(v); v {
+			case "open":
+				statuses = append(statuses, string(model.StatusBacklog), string(model.StatusPending), string(model.StatusInProgress))
+			case "todo":
+				statuses = append(statuses, string(model.StatusPending))
+			case "backlog", "pending", "in_progress", "done", "archived":
+				statuses = append(statuses, v)
+			default:
+				return nil, fmt.Errorf("unknown status %q (want backlog, pending, in_progress, done, archived or open)", v)
+			}
+		}
+		node = statusNode{statuses: statuses}
+
+	case "state":
+		if !equality {
+			return nil, fmt.Errorf("state only supports : and !=")
+		}
+		node = stateNode{names: values}
+
+	case "priority":
+		var ranks []int
+		for _, v := range values {
+			rank, ok := priorityRanks[strings.ToLower(v)]
+			if !ok {
+				return nil, fmt.Errorf("unknown priority %q (want low, medium, high or urgent)", v)
+			}
+			ranks = append(ranks, rank)
+		}
+		if !equality && len(ranks) > 1 {
+			return nil, fmt.Errorf("priority%s takes a single value", op)
+		}
+		if equality {
+			node = priorityNode{op: "IN", ranks: ranks}
+		} else {
+			node = priorityNode{op: op, ranks: ranks}
+		}
+
+	case "due", "start", "created", "updated", "completed":
+		if len(values) > 1 {
+			return nil, fmt.Errorf("%s takes a single date", field)
+		}
+		if strings.EqualFold(value, "none") {
+			if !equality {
+				return nil, fmt.Errorf("%s%snone makes no sense", field, op)
+			}
+			node = nullNode{column: dateColumns[field]}
+			break
+		}
+		if _, _, err := resolveQueryDate(value, time.Now()); err != nil {
+			return nil, fmt.Errorf("%s: %w", field, err)
+		}
+		if negate {
+			op = ":"
+		}
+		node = dateNode{column: dateColumns[field], op: op, value: value}
+
+	case "estimate":
+		if len(values) > 1 {
+			return nil, fmt.Errorf("estimate takes a single length, e.g. estimate<=30m")
+		}
+		if strings.EqualFold(value, "none") {
+			if !equality {
+				return nil, fmt.Errorf("estimate%snone makes no sense", op)
+			}
+			node = nullNode{column: "tasks.time_estimate"}
+			break
+		}
+		minutes, err := model.ParseEstimate(value)
+		if err != nil {
+			return nil, fmt.Errorf("estimate: %w", err)
+		}
+		if equality {
+			op = "="
+		}
+		node = estimateNode{op: op, minutes: minutes}
+
+	case "title", "description", "text":
+		if !equality {
+			return nil, fmt.Errorf("%s only supports : and !=", field)
+		}
+		columns := []string{"title", "description"}
+		switch field {
+		case "title":
+			columns = []string{"title"}
+		case "description":
+			columns = []string{"description"}
+		}
+		node = textNode{columns: columns, value: value}
+
+	case "is":
+		if op != ":" && op != "=" {
+			return nil, fmt.Errorf("use is:%s or not is:%s", value, value)
+		}
+		cond, ok := isConditions[strings.ToLower(value)]
+		if !ok {
+			return nil, fmt.Errorf("unknown is:%s (want %s)", value, strings.Join(isNames, ", "))
+		}
+		node = rawNode{cond: cond}
+		if strings.EqualFold(value, "deferred") {
+			p.fields["start"] = true
+		}
+
+	case "has":
+		if op != ":" && op != "=" {
+			return nil, fmt.Errorf("use has:%s or not has:%s", value, value)
+		}
+		cond, ok := hasConditions[strings.ToLower(value)]
+		if !ok {
+			return nil, fmt.Errorf("unknown has:%s (want %s)", value, strings.Join(hasNames, ", "))
+		}
+		node = rawNode{cond: cond}
+
+	default:
+		return nil, fmt.Errorf("unknown field %q", field)
+	}
+
+	if negate {
+		node = notNode{inner: node}
+	}
+	return node, nil
+}
+
+// fieldAliases maps short field names to the ones they stand for
+var fieldAliases = map[string]string{"proj": "project", "pri": "priority", "desc": "description", "est": "estimate"}
+
+// priorityRanks orders priorities for < and > comparisons
+var priorityRanks = map[string]int{"low": 1, "medium": 2, "high": 3, "urgent": 4}
+
+var dateColumns = map[string]string{
+	"due":       "tasks.due_date",
+	"start":     "tasks.start_date",
+	"created":   "tasks.created_at",
+	"updated":   "tasks.updated_at",
+	"completed": "tasks.completed_at",
+}
+
+var isNames = []string{"open", "done", "overdue", "deferred", "subtask", "blocked", "recurring"}
+
+var isConditions = map[string]string{
+	"open":     `tasks.status IN ('backlog', 'pending', 'in_progress')`,
+	"done":     `tasks.status = 'done'`,
+	"overdue":  `(tasks.status NOT IN ('done', 'archived') AND tasks.due_date IS NOT NULL AND julianday(tasks.due_date) < julianday('now'))`,
+	"deferred": "NOT " + NotDeferred("tasks."),
+	"subtask":  `tasks.parent_id IS NOT NULL`,
+	"blocked": `EXISTS (SELECT 1 FROM task_dependencies d JOIN tasks dt ON dt.id = d.depends_on_id
+		WHERE d.task_id = tasks.id AND dt.status NOT IN ('done', 'archived'))`,
+	"recurring": `COALESCE(tasks.recurrence, '') != ''`,
+}
+
+var hasNames = []string{"due", "start", "estimate", "project", "tags", "subtasks", "description"}
+
+var hasConditions = map[string]string{
+	"due":         `tasks.due_date IS NOT NULL`,
+	"start":       `tasks.start_date IS NOT NULL`,
+	"estimate":    `tasks.time_estimate IS NOT NULL`,
+	"project":     `COALESCE(tasks.project_id, 'inbox') != 'inbox'`,
+	"tags":        `EXISTS (SELECT 1 FROM task_tags tt WHERE tt.task_id = tasks.id)`,
+	"subtasks":    `EXISTS (SELECT 1 FROM tasks st WHERE st.parent_id = tasks.id)`,
+	"description": `COALESCE(tasks.description, '') != ''`,
+}
+
+// resolveQueryDate turns a date into the span [start, end) it covers, the
+// same day quick add reads from the same words
+func resolveQueryDate(value string, now time.Time) (time.Time, time.Time, error) {
+	start, end, ok := parse.Span(value, now)
+	if !ok {
+		return time.Time{}, time.Time{}, fmt.Errorf("can't read date %q (try today, fri, eow, week, +3d, -2w or 2024-01-15)", value)
+	}
+	return start, end, nil
+}
+
+// Compilation. Every node compiles to a condition that is never NULL, so
+// "not" behaves as expected for tasks missing a date or project.
+
+type queryCompiler struct {
+	now  time.Time
+	args []interface{}
+}
+
+func (c *queryCompiler) arg(v interface{}) string {
+	c.args = append(c.args, v)
+	return "?"
+}
+
+type queryNode interface {
+	compile(c *queryCompiler) string
+}
+
+type boolNode struct {
+	op          string
+	left, right queryNode
+}
+
+func (n boolNode) compile(c *queryCompiler) string {
+	return "(" + n.left.compile(c) + " " + n.op + " " + n.right.compile(c) + ")"
+}
+
+type notNode struct{ inner queryNode }
+
+func (n notNode) compile(c *queryCompiler) string {
+	return "NOT " + n.inner.compile(c)
+}
+
+type rawNode struct{ cond string }
+
+func (n rawNode) compile(c *queryCompiler) string {
+	return "(" + n.cond + ")"
+}
+
+type projectNode struct{ names []string }
+
+func (n projectNode) compile(c *queryCompiler) string {
+	var parts []string
+	for _, name := range n.names {
+		switch strings.ToLower(name) {
+		case "none", "inbox":
+			parts = append(parts, "COALESCE(tasks.project_id, 'inbox') = 'inbox'")
+		default:
+			parts = append(parts, `EXISTS (SELECT 1 FROM projects p
+				WHERE p.id = tasks.project_id AND LOWER(p.name) = LOWER(`+c.arg(name)+`))`)
+		}
+	}
+	return "(" + strings.Join(parts, " OR ") + ")"
+}
+
+type tagNode struct{ names []string }
+
+func (n tagNode) compile(c *queryCompiler) string {
+	var parts []string
+	for _, name := range n.names {
+		name = strings.TrimPrefix(name, "@")
+		if strings.EqualFold(name, "none") {
+			parts = append(parts, `NOT EXISTS (SELECT 1 FROM task_tags tt WHERE tt.task_id = tasks.id)`)
+			continue
+		}
+		parts = append(parts, `EXISTS (SELECT 1 FROM task_tags tt JOIN tags g ON g.id = tt.tag_id
+			WHERE tt.task_id = tasks.id AND LOWER(g.name) = LOWER(`+c.arg("@"+name)+`))`)
+	}
+	return "(" + strings.Join(parts, " OR ") + ")"
+}
+
+type statusNode struct{ statuses []string }
+
+func (n statusNode) compile(c *queryCompiler) string {
+	var marks []string
+	for _, s := range n.statuses {
+		marks = append(marks, c.arg(s))
+	}
+	return "tasks.status IN (" + strings.Join(marks, ", ") + ")"
+}
+
+// stateNode matches tasks in a Kanban column of a given name, on their
+// project's own board or on the default one
+type stateNode struct{ names []string }
+
+func (n stateNode) compile(c *queryCompiler) string {
+	var parts []string
+	for _, name := range n.names {
+		parts = append(parts, `(tasks.status != 'archived' AND EXISTS (SELECT 1 FROM workflow_states ws
+			WHERE ws.id = tasks.state_id AND LOWER(ws.name) = LOWER(`+c.arg(name)+`)))`)
+		for _, state := range model.DefaultWorkflow() {
+			if strings.EqualFold(state.Name, name) {
+				parts = append(parts, `(tasks.status = `+c.arg(string(state.Status))+` AND NOT EXISTS (SELECT 1 FROM workflow_states ws
+					WHERE ws.project_id = COALESCE(tasks.project_id, 'inbox')))`)
+			}
+		}
+	}
+	return "(" + strings.Join(parts, " OR ") + ")"
+}
+
+type priorityNode struct {
+	op    string // IN or a comparison
+	ranks []int
+}
+
+func (n priorityNode) compile(c *queryCompiler) string {
+	rank := `CASE tasks.priority WHEN 'low' THEN 1 WHEN 'medium' THEN 2 WHEN 'high' THEN 3 WHEN 'urgent' THEN 4 ELSE 0 END`
+	if n.op != "IN" {
+		return "(" + rank + " " + n.op + " " + c.arg(n.ranks[0]) + ")"
+	}
+	var marks []string
+	for _, r := range n.ranks {
+		marks = append(marks, c.arg(r))
+	}
+	return "(" + rank + " IN (" + strings.Join(marks, ", ") + "))"
+}
+
+type nullNode struct{ column string }
+
+func (n nullNode) compile(c *queryCompiler) string {
+	return "(" + n.column + " IS NULL)"
+}
+
+// estimateNode compares time estimates in minutes; tasks without one never match
+type estimateNode struct {
+	op      string
+	minutes int
+}
+
+func (n estimateNode) compile(c *queryCompiler) string {
+	return "(tasks.time_estimate IS NOT NULL AND tasks.time_estimate " + n.op + " " + c.arg(n.minutes) + ")"
+}
+
+type dateNode struct {
+	column string
+	op     string
+	value  string
+}
+
+func (n dateNode) compile(c *queryCompiler) string {
+	start, end, _ := resolveQueryDate(n.value, c.now)
+	col := "julianday(" + n.column + ")"
+	at := func(t time.Time) string {
+		return "julianday(" + c.arg(Timestamp(t)) + ")"
+	}
+
+	var cond string
+	switch n.op {
+	case "<":
+		cond = col + " < " + at(start)
+	case "<=":
+		cond = col + " < " + at(end)
+	case ">":
+		cond = col + " >= " + at(end)
+	case ">=":
+		cond = col + " >= " + at(start)
+	default:
+		cond = col + " >= " + at(start) + " AND " + col + " < " + at(end)
+	}
+	return "(" + n.column + " IS NOT NULL AND " + cond + ")"
+}
+
+type textNode struct {
+	columns []string
+	value   string
+}
+
+func (n textNode) compile(c *queryCompiler) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(n.value)
+	pattern := "%" + escaped + "%"
+	var parts []string
+	for _, col := range n.columns {
+		parts = append(parts, "COALESCE(tasks."+col+", '') LIKE "+c.arg(pattern)+` ESCAPE '\'`)
+	}
+	return "(" + strings.Join(parts, " OR ") + ")"
+}
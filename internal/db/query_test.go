@@ -0,0 +1,250 @@
+package db
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+	"github.com/dori/klonch/internal/parse"
+)
+
+// TestQueryTasks checks each kind of term against a small set of tasks
+func TestQueryTasks(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	work, _ := db.CreateProject("Work", "")
+	review, _ := db.CreateTag("review", "")
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 12, 0, 0, 0, time.Local)
+	add := func(title string, project *model.Project, priority model.Priority, due *time.Time) *model.Task {
+		t.Helper()
+		inbox := "inbox"
+		task := model.Task{Title: title, Priority: priority, DueDate: due, ProjectID: &inbox}
+		if project != nil {
+			task.ProjectID = &project.ID
+		}
+		if err := db.AddTask(&task, nil); err != nil {
+			t.Fatalf("Failed to add %q: %v", title, err)
+		}
+		return &task
+	}
+
+	yesterday := today.AddDate(0, 0, -1)
+	inTwoDays := today.AddDate(0, 0, 2)
+	nextMonth := today.AddDate(0, 1, 0)
+
+	report := add("Quarterly report", work, model.PriorityHigh, &inTwoDays)
+	deploy := add("Deploy release", work, model.PriorityLow, &yesterday)
+	slides := add("Review slides", work, model.PriorityMedium, &nextMonth)
+	milk := add("Buy milk", nil, model.PriorityUrgent, nil)
+	db.AddTagToTask(slides.ID, review.ID)
+	db.SetTaskStatus(deploy.ID, model.StatusDone)
+	quick, long := 20, 150
+	db.SetTaskEstimate(milk.ID, &quick)
+	db.SetTaskEstimate(report.ID, &long)
+
+	tests := []struct {
+		query string
+		want  []*model.Task
+	}{
+		{"project:work and (tag:review or priority>=high) and due<+3d and not status:done", []*model.Task{report}},
+		{"#work @review", []*model.Task{slides}},
+		{"project:none", []*model.Task{milk}},
+		{"!urgent", []*model.Task{milk}},
+		{"priority<medium", []*model.Task{deploy}},
+		{"status:pending,in_progress and due<today", nil},
+		{"due<today", []*model.Task{deploy}},
+		{"due:none", []*model.Task{milk}},
+		{"not due<today", []*model.Task{report, slides, milk}},
+		{"due>=today due<=+2d", []*model.Task{report}},
+		{"is:done", []*model.Task{deploy}},
+		{"has:tags", []*model.Task{slides}},
+		{"-has:project", []*model.Task{milk}},
+		{"report or milk", []*model.Task{report, milk}},
+		{`title:"quarterly rep"`, []*model.Task{report}},
+		{"tag!=review and project:work", []*model.Task{report, deploy}},
+		{"estimate<=30m", []*model.Task{milk}},
+		{"estimate>1h and has:estimate", []*model.Task{report}},
+		{"estimate:none", []*model.Task{deploy, slides}},
+		{"50%", nil},
+	}
+
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) failed: %v", tt.query, err)
+			continue
+		}
+		matches, err := db.MatchingTaskIDs(q)
+		if err != nil {
+			t.Errorf("%q failed: %v", tt.query, err)
+			continue
+		}
+		var got, want []string
+		for id := range matches {
+			got = append(got, id)
+		}
+		for _, task := range tt.want {
+			want = append(want, task.ID)
+		}
+		sort.Strings(got)
+		sort.Strings(want)
+		if len(got) != len(want) || (len(got) > 0 && !equalStrings(got, want)) {
+			t.Errorf("%q matched %d tasks, want %d", tt.query, len(got), len(want))
+		}
+	}
+
+	// ListTasks combines the query with its other filters
+	q, _ := ParseQuery("project:work")
+	tasks, err := db.ListTasks(TaskFilter{Query: q})
+	if err != nil {
+		t.Fatalf("ListTasks failed: %v", err)
+	}
+	if len(tasks) != 3 {
+		t.Errorf("Expected 3 work tasks, got %d", len(tasks))
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestQueryDatesMatchQuickAdd checks that a date word in a query means the
+// day quick add gives a task for the same word
+func TestQueryDatesMatchQuickAdd(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	for _, word := range []string{"today", "tomorrow", "fri", "next fri", "eow", "eom", "+3d", "in 2 weeks", "w52"} {
+		for _, clock := range []string{"", " 14:00"} {
+			task, err := db.AddQuickTask(parse.QuickAdd("Call back due:"+word+clock, time.Now()), model.Task{}, nil)
+			if err != nil {
+				t.Fatalf("AddQuickTask(due:%s%s): %v", word, clock, err)
+			}
+			if task.DueDate == nil {
+				t.Fatalf("Expected due:%s%s to set a due date", word, clock)
+			}
+			for query, want := range map[string]bool{
+				`due:"` + word + `"`:  true,
+				`due<="` + word + `"`: true,
+				`due>="` + word + `"`: true,
+				`due<"` + word + `"`:  false,
+				`due>"` + word + `"`:  false,
+			} {
+				q, err := ParseQuery(query)
+				if err != nil {
+					t.Fatalf("ParseQuery(%q): %v", query, err)
+				}
+				if ids, _ := db.MatchingTaskIDs(q); ids[task.ID] != want {
+					t.Errorf("Expected %s to match a task added with due:%s%s: %v (due %v)", query, word, clock, want, task.DueDate)
+				}
+			}
+			db.DeleteTask(task.ID)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, query := range []string{
+		"",
+		"(project:work",
+		"project:work)",
+		"and tag:x",
+		"colour:red",
+		"priority:huge",
+		"due<someday",
+		"status:sleeping",
+		"project>work",
+		`title:"unterminated`,
+		"due<none",
+	} {
+		if _, err := ParseQuery(query); err == nil {
+			t.Errorf("Expected ParseQuery(%q) to fail", query)
+		}
+	}
+
+	q, err := ParseQuery("not status:done and due<today")
+	if err != nil {
+		t.Fatalf("ParseQuery failed: %v", err)
+	}
+	if !q.Uses("status") || !q.Uses("due") || q.Uses("tag") {
+		t.Errorf("Uses reports the wrong fields")
+	}
+}
+
+func TestSmartLists(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.SaveSmartList("Broken", "due<someday"); err == nil {
+		t.Error("Expected an invalid query to be rejected")
+	}
+
+	first, err := db.SaveSmartList("Due soon", "due<+3d and is:open")
+	if err != nil {
+		t.Fatalf("SaveSmartList failed: %v", err)
+	}
+	db.SaveSmartList("Waiting", "@waiting")
+
+	// Saving under an existing name, in any case, replaces its query
+	updated, err := db.SaveSmartList("due SOON", "due<+7d")
+	if err != nil {
+		t.Fatalf("SaveSmartList failed: %v", err)
+	}
+	if updated.ID != first.ID || updated.Query != "due<+7d" {
+		t.Errorf("Expected the existing list to be updated, got %+v", updated)
+	}
+
+	lists, _ := db.GetSmartLists()
+	if len(lists) != 2 || lists[0].Name != "Due soon" || lists[1].Name != "Waiting" {
+		t.Fatalf("Expected lists in creation order, got %+v", lists)
+	}
+
+	if err := db.DeleteSmartList(first.ID); err != nil {
+		t.Fatalf("DeleteSmartList failed: %v", err)
+	}
+	if l, _ := db.GetSmartListByName("Due soon"); l != nil {
+		t.Error("Expected the list to be deleted")
+	}
+	db.Undo()
+	if l, _ := db.GetSmartListByName("due soon"); l == nil || l.Query != "due<+7d" {
+		t.Errorf("Expected undo to restore the list, got %+v", l)
+	}
+}
+
+func TestQuerySettings(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.SetSetting(SettingPlanningToday, "due:today and ("); err == nil {
+		t.Error("Expected an invalid section query to be rejected")
+	}
+	if err := db.SetSetting(SettingPlanningToday, "due:today @work"); err != nil {
+		t.Fatalf("SetSetting failed: %v", err)
+	}
+	q, err := db.GetQuerySetting(SettingPlanningToday)
+	if err != nil || q.String() != "due:today @work" {
+		t.Errorf("Expected the saved query, got %v (%v)", q, err)
+	}
+}
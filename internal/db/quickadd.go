@@ -0,0 +1,116 @@
+package db
+
+import (
+	"github.com/dori/klonch/internal/model"
+	"github.com/dori/klonch/internal/parse"
+)
+
+// AddQuickTask inserts a task from a parsed quick-add line. base supplies
+// what the line can't say, such as status, parent or a default project,
+// and tagIDs are added alongside the line's own tags. Projects and tags the
+// line names are created when missing, so call it on a Group handle to
+// undo everything as one step.
+func (db *DB) AddQuickTask(q parse.Task, base model.Task, tagIDs []string) (*model.Task, error) {
+	t := base
+	t.Title = q.Title
+	if q.Project != "" {
+		project, err := db.GetOrCreateProject(q.Project, "")
+		if err != nil {
+			return nil, err
+		}
+		t.ProjectID = &project.ID
+		t.Project = project
+	}
+	if t.ProjectID == nil {
+		inbox := "inbox"
+		t.ProjectID = &inbox
+	}
+	if q.Priority != "" {
+		t.Priority = q.Priority
+	}
+	if q.Due != nil {
+		t.DueDate = q.Due
+	}
+	if q.Start != nil {
+		t.StartDate = q.Start
+	}
+	if q.Estimate != nil {
+		t.TimeEstimate = q.Estimate
+	}
+
+	tags, err := db.quickTags(q)
+	if err != nil {
+		return nil, err
+	}
+	ids := append([]string(nil), tagIDs...)
+	for _, tag := range tags {
+		ids = append(ids, tag.ID)
+	}
+	t.Tags = tags
+
+	if err := db.AddTask(&t, ids); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// EditQuickTask retitles a task and changes the fields a quick-add line
+// names, leaving the rest alone. Tags are added, never removed.
+func (db *DB) EditQuickTask(id string, q parse.Task) error {
+	if err := db.UpdateTaskTitle(id, q.Title); err != nil {
+		return err
+	}
+	if q.Project != "" {
+		project, err := db.GetOrCreateProject(q.Project, "")
+		if err != nil {
+			return err
+		}
+		if err := db.UpdateTaskProject(id, project.ID); err != nil {
+			return err
+		}
+	}
+	if q.Priority != "" {
+		if err := db.UpdateTaskPriority(id, q.Priority); err != nil {
+			return err
+		}
+	}
+	if q.Due != nil {
+		if err := db.SetTaskDueDate(id, q.Due); err != nil {
+			return err
+		}
+	}
+	if q.Start != nil {
+		if err := db.SetTaskStartDate(id, q.Start); err != nil {
+			return err
+		}
+	}
+	if q.Estimate != nil {
+		if err := db.SetTaskEstimate(id, q.Estimate); err != nil {
+			return err
+		}
+	}
+
+	tags, err := db.quickTags(q)
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if err := db.AddTagToTask(id, tag.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quickTags finds or creates the tags a quick-add line names
+func (db *DB) quickTags(q parse.Task) ([]model.Tag, error) {
+	var tags []model.Tag
+	for _, name := range q.Tags {
+		tag, err := db.GetOrCreateTag(name, "")
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, *tag)
+	}
+	return tags, nil
+}
@@ -0,0 +1,191 @@
+package db
+
+import (
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+)
+
+// SetTaskRecurrence sets or clears (nil rule) a task's recurrence rule
+func (db *DB) SetTaskRecurrence(id string, rule *model.Recurrence) error {
+	if rule == nil {
+		return db.updateTask("Clear recurrence", id, `recurrence = NULL`)
+	}
+
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	if rule.Occurrence < 1 {
+		rule.Occurrence = 1
+	}
+	encoded, err := rule.Encode()
+	if err != nil {
+		return err
+	}
+	return db.updateTask("Set recurrence", id, `recurrence = ?`, encoded)
+}
+
+// SpawnNextOccurrence creates the next instance of a recurring task that was just completed.
+// It returns nil when the task doesn't repeat, the series has ended, or the next
+// instance already exists (e.g. the task was un-done and done again).
+func (db *DB) SpawnNextOccurrence(id string) (*model.Task, error) {
+	var next *model.Task
+	err := db.record("Repeat task", func(j *journal) error {
+		var err error
+		next, err = db.spawnNextOccurrence(j, id)
+		return err
+	})
+	return next, err
+}
+
+func (db *DB) spawnNextOccurrence(j *journal, id string) (*model.Task, error) {
+	task, err := db.getTask(j.Tx, id)
+	if err != nil || task == nil {
+		return nil, err
+	}
+	rule := task.RecurrenceRule()
+	if rule == nil {
+		return nil, nil
+	}
+
+	if rule.SpawnedID != "" {
+		var exists int
+		j.QueryRow(`SELECT COUNT(*) FROM tasks WHERE id = ?`, rule.SpawnedID).Scan(&exists)
+		if exists > 0 {
+			return nil, nil
+		}
+	}
+
+	from := recurrenceBase(task, rule)
+	nextDue, ok := rule.Next(from)
+	if !ok {
+		return nil, nil
+	}
+
+	var nextStart *time.Time
+	if task.StartDate != nil {
+		s := task.StartDate.Add(nextDue.Sub(from))
+		if task.DueDate != nil {
+			s = nextDue.Add(-task.DueDate.Sub(*task.StartDate))
+		}
+		nextStart = &s
+	}
+
+	nextRule := rule.Advance(from)
+	nextRecurrence, err := nextRule.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	next := &model.Task{
+		Title:        task.Title,
+		Description:  task.Description,
+		Status:       model.StatusPending,
+		Priority:     task.Priority,
+		Urgency:      task.Urgency,
+		Importance:   task.Importance,
+		ProjectID:    task.ProjectID,
+		ParentID:     task.ParentID,
+		DueDate:      &nextDue,
+		StartDate:    nextStart,
+		TimeEstimate: task.TimeEstimate,
+		Recurrence:   &nextRecurrence,
+		Reminders:    task.Reminders,
+		Position:     task.Position,
+	}
+
+	tagIDs, err := queryStrings(j, `SELECT tag_id FROM task_tags WHERE task_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.addTask(j, next, tagIDs); err != nil {
+		return nil, err
+	}
+
+	rows, err := j.Query(`
+		SELECT id, title, description, status, priority, urgency, importance,
+		       project_id, parent_id, due_date, start_date, completed_at,
+		       time_estimate, recurrence, reminders, position, gcal_event_id, state_id,
+		       created_at, updated_at
+		FROM tasks WHERE parent_id = ? ORDER BY position, created_at
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	subtasks, err := db.scanTasks(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, st := range subtasks {
+		sub := &model.Task{
+			Title:        st.Title,
+			Description:  st.Description,
+			Priority:     st.Priority,
+			ProjectID:    st.ProjectID,
+			ParentID:     &next.ID,
+			TimeEstimate: st.TimeEstimate,
+			Position:     st.Position,
+		}
+		if err := db.addTask(j, sub, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if rule.Occurrence < 1 {
+		rule.Occurrence = 1
+	}
+	rule.SpawnedID = next.ID
+	updatedRecurrence, err := rule.Encode()
+	if err != nil {
+		return nil, err
+	}
+	if err := j.track("task", id); err != nil {
+		return nil, err
+	}
+	if _, err := j.Exec(`UPDATE tasks SET recurrence = ? WHERE id = ?`, updatedRecurrence, id); err != nil {
+		return nil, err
+	}
+
+	return next, nil
+}
+
+// queryStrings returns the first column of every row
+func queryStrings(q querier, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// recurrenceBase returns the date the next occurrence is calculated from.
+// Fixed schedules follow the due date; after-completion rules (and undated
+// tasks) follow the completion date, keeping the due date's time of day.
+func recurrenceBase(task *model.Task, rule *model.Recurrence) time.Time {
+	completed := time.Now()
+	if task.CompletedAt != nil {
+		completed = *task.CompletedAt
+	}
+
+	if task.DueDate != nil && !rule.AfterCompletion() {
+		return *task.DueDate
+	}
+
+	hour, min, sec := 23, 59, 59
+	if task.DueDate != nil {
+		hour, min, sec = task.DueDate.Hour(), task.DueDate.Minute(), task.DueDate.Second()
+	}
+	return time.Date(completed.Year(), completed.Month(), completed.Day(), hour, min, sec, 0, time.Local)
+}
@@ -0,0 +1,148 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+)
+
+// TestRecurringTaskSpawnsNextOccurrence checks that completing a recurring task
+// creates exactly one next instance, even if the task is toggled done twice.
+func TestRecurringTaskSpawnsNextOccurrence(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	task, err := db.CreateTask("Weekly review", nil)
+	if err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+
+	due := time.Date(2025, 3, 7, 23, 59, 59, 0, time.Local) // Friday
+	if _, err := db.Exec(`UPDATE tasks SET due_date = ? WHERE id = ?`, due.Format(time.RFC3339), task.ID); err != nil {
+		t.Fatalf("Failed to set due date: %v", err)
+	}
+
+	rule, err := model.ParseRecurrenceSpec("weekly on fri")
+	if err != nil {
+		t.Fatalf("Failed to parse rule: %v", err)
+	}
+	if err := db.SetTaskRecurrence(task.ID, rule); err != nil {
+		t.Fatalf("Failed to set recurrence: %v", err)
+	}
+
+	// done -> pending -> done must still only produce one new instance
+	for i := 0; i < 3; i++ {
+		if err := db.ToggleTaskStatus(task.ID); err != nil {
+			t.Fatalf("Failed to toggle task: %v", err)
+		}
+	}
+
+	var count int
+	db.QueryRow(`SELECT COUNT(*) FROM tasks WHERE title = ? AND status = 'pending'`, "Weekly review").Scan(&count)
+	if count != 1 {
+		t.Fatalf("Expected 1 pending occurrence, got %d", count)
+	}
+
+	var nextID string
+	db.QueryRow(`SELECT id FROM tasks WHERE title = ? AND status = 'pending'`, "Weekly review").Scan(&nextID)
+	next, err := db.GetTask(nextID)
+	if err != nil || next == nil {
+		t.Fatalf("Failed to load next occurrence: %v", err)
+	}
+	if next.DueDate == nil || !next.DueDate.Equal(due.AddDate(0, 0, 7)) {
+		t.Errorf("Expected next due %v, got %v", due.AddDate(0, 0, 7), next.DueDate)
+	}
+	if r := next.RecurrenceRule(); r == nil || r.Occurrence != 2 {
+		t.Errorf("Expected next occurrence to carry the rule with occurrence 2, got %+v", r)
+	}
+}
+
+// TestMonthlyRecurrenceKeepsItsDay checks that a series due on the 31st
+// falls back to the end of short months without staying there
+func TestMonthlyRecurrenceKeepsItsDay(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	task, err := db.CreateTask("Pay rent", nil)
+	if err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+	due := time.Date(2025, 1, 31, 23, 59, 59, 0, time.Local)
+	if _, err := db.Exec(`UPDATE tasks SET due_date = ? WHERE id = ?`, due.Format(time.RFC3339), task.ID); err != nil {
+		t.Fatalf("Failed to set due date: %v", err)
+	}
+	rule, _ := model.ParseRecurrenceSpec("monthly")
+	if err := db.SetTaskRecurrence(task.ID, rule); err != nil {
+		t.Fatalf("Failed to set recurrence: %v", err)
+	}
+
+	id := task.ID
+	for _, want := range []time.Time{
+		time.Date(2025, 2, 28, 23, 59, 59, 0, time.Local),
+		time.Date(2025, 3, 31, 23, 59, 59, 0, time.Local),
+		time.Date(2025, 4, 30, 23, 59, 59, 0, time.Local),
+		time.Date(2025, 5, 31, 23, 59, 59, 0, time.Local),
+	} {
+		if err := db.SetTaskStatus(id, model.StatusDone); err != nil {
+			t.Fatalf("Failed to complete task: %v", err)
+		}
+		done, _ := db.GetTask(id)
+		id = done.RecurrenceRule().SpawnedID
+		next, err := db.GetTask(id)
+		if err != nil || next == nil {
+			t.Fatalf("Failed to load the next occurrence: %v", err)
+		}
+		if next.DueDate == nil || !next.DueDate.Equal(want) {
+			t.Fatalf("Expected the next one due %v, got %v", want, next.DueDate)
+		}
+	}
+}
+
+// TestRecurrenceNext covers the date arithmetic for each rule shape
+func TestRecurrenceNext(t *testing.T) {
+	from := time.Date(2025, 1, 31, 9, 0, 0, 0, time.Local) // Friday
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"daily", time.Date(2025, 2, 1, 9, 0, 0, 0, time.Local)},
+		{"every 3 days", time.Date(2025, 2, 3, 9, 0, 0, 0, time.Local)},
+		{"weekly on mon,wed", time.Date(2025, 2, 3, 9, 0, 0, 0, time.Local)},
+		{"every 2 weeks on mon", time.Date(2025, 2, 10, 9, 0, 0, 0, time.Local)},
+		{"monthly", time.Date(2025, 2, 28, 9, 0, 0, 0, time.Local)},
+		{"monthly on the 15th", time.Date(2025, 2, 15, 9, 0, 0, 0, time.Local)},
+		{"monthly on the 2nd tue", time.Date(2025, 2, 11, 9, 0, 0, 0, time.Local)},
+		{"monthly on the last fri", time.Date(2025, 2, 28, 9, 0, 0, 0, time.Local)},
+		{"yearly", time.Date(2026, 1, 31, 9, 0, 0, 0, time.Local)},
+	}
+
+	for _, tt := range tests {
+		rule, err := model.ParseRecurrenceSpec(tt.spec)
+		if err != nil {
+			t.Fatalf("%q: failed to parse: %v", tt.spec, err)
+		}
+		got, ok := rule.Next(from)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("%q: expected %v, got %v (ok=%v)", tt.spec, tt.want, got, ok)
+		}
+
+		again, err := model.ParseRecurrenceSpec(rule.String())
+		if err != nil || again.String() != rule.String() {
+			t.Errorf("%q: String() %q does not round-trip", tt.spec, rule.String())
+		}
+	}
+
+	rule, _ := model.ParseRecurrenceSpec("daily for 2 times")
+	rule.Occurrence = 2
+	if _, ok := rule.Next(from); ok {
+		t.Errorf("Expected series to end after count is reached")
+	}
+}
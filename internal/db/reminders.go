@@ -0,0 +1,180 @@
+package db
+
+import (
+	"sort"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+	"github.com/dori/klonch/internal/parse"
+)
+
+// Reminders go off at offsets before a task's due date. Each one that goes
+// off is recorded in the reminders table under its task and moment, so the
+// TUI and `klonch remind --daemon` can run side by side: whichever claims a
+// reminder first sends it. Moving a due date makes new moments, so a
+// rescheduled task is reminded again.
+
+const (
+	// ReminderGrace is how late a reminder can be noticed and still be sent.
+	// Older ones went off while nothing was running and count as missed.
+	ReminderGrace = 10 * time.Minute
+
+	// reminderHorizon is how far back reminders are still looked for
+	reminderHorizon = 7 * 24 * time.Hour
+)
+
+// Reminder is one reminder for a task
+type Reminder struct {
+	Task   model.Task
+	At     time.Time // When it goes off
+	Missed bool      // It went off while nothing was running to send it
+}
+
+// ReminderPolicy holds the reminder settings
+type ReminderPolicy struct {
+	Default    []int // Offsets for tasks that don't set their own
+	AllDayHour int   // All-day due dates are reminded as if due at this time
+	AllDayMin  int
+}
+
+// ReminderPolicy reads the reminder settings, falling back to the defaults
+// for values that no longer parse
+func (db *DB) ReminderPolicy() (ReminderPolicy, error) {
+	var p ReminderPolicy
+	value, err := db.GetSetting(SettingRemindersDefault)
+	if err != nil {
+		return p, err
+	}
+	if p.Default, err = model.ParseReminders(value); err != nil {
+		def, _ := LookupSetting(SettingRemindersDefault)
+		p.Default, _ = model.ParseReminders(def.Default)
+	}
+
+	value, err = db.GetSetting(SettingRemindersAllDay)
+	if err != nil {
+		return p, err
+	}
+	var ok bool
+	if p.AllDayHour, p.AllDayMin, ok = parse.Clock(value); !ok {
+		def, _ := LookupSetting(SettingRemindersAllDay)
+		p.AllDayHour, p.AllDayMin, _ = parse.Clock(def.Default)
+	}
+	return p, nil
+}
+
+// Times lists when a task's reminders go off, earliest first. Reminders for
+// a due date without a time count back from the all-day time on that day.
+func (p ReminderPolicy) Times(t *model.Task) []time.Time {
+	if t.DueDate == nil {
+		return nil
+	}
+	anchor := *t.DueDate
+	if !model.HasClock(anchor) {
+		anchor = time.Date(anchor.Year(), anchor.Month(), anchor.Day(), p.AllDayHour, p.AllDayMin, 0, 0, anchor.Location())
+	}
+
+	var times []time.Time
+	for _, minutes := range t.ReminderOffsets(p.Default) {
+		times = append(times, anchor.Add(-time.Duration(minutes)*time.Minute))
+	}
+	return times
+}
+
+// reminderTasks returns the open tasks that have a due date
+func (db *DB) reminderTasks() ([]model.Task, error) {
+	tasks, err := db.ListTasks(TaskFilter{Statuses: []model.Status{model.StatusPending, model.StatusInProgress}})
+	if err != nil {
+		return nil, err
+	}
+	var dated []model.Task
+	for _, t := range tasks {
+		if t.DueDate != nil {
+			dated = append(dated, t)
+		}
+	}
+	return dated, nil
+}
+
+// ClaimReminders records the reminders that have gone off by now and not
+// been claimed yet, and returns them for the caller to send. Only a task's
+// latest reminder counts: one that is an hour late is overtaken by the next.
+// Reminders that went off before the task was last changed are skipped,
+// since a due date set ten minutes ahead shouldn't report the hour-before
+// reminder as missed.
+func (db *DB) ClaimReminders(now time.Time) ([]Reminder, error) {
+	policy, err := db.ReminderPolicy()
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := db.reminderTasks()
+	if err != nil {
+		return nil, err
+	}
+
+	// Forget reminders too old to come up again
+	horizon := now.Add(-reminderHorizon)
+	if _, err := db.Exec(`DELETE FROM reminders WHERE julianday(remind_at) < julianday(?)`, Timestamp(horizon)); err != nil {
+		return nil, err
+	}
+
+	var claimed []Reminder
+	for _, t := range tasks {
+		var latest time.Time
+		for _, at := range policy.Times(&t) {
+			if !at.After(now) {
+				latest = at
+			}
+		}
+		if latest.IsZero() || latest.Before(horizon) || latest.Before(t.UpdatedAt) {
+			continue
+		}
+
+		missed := now.Sub(latest) > ReminderGrace
+		res, err := db.Exec(`
+			INSERT OR IGNORE INTO reminders (task_id, remind_at, sent_at, missed) VALUES (?, ?, ?, ?)
+		`, t.ID, Timestamp(latest), Timestamp(now), missed)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			claimed = append(claimed, Reminder{Task: t, At: latest, Missed: missed})
+		}
+	}
+	return claimed, nil
+}
+
+// UpcomingReminders lists the reminders that go off between now and until,
+// in order
+func (db *DB) UpcomingReminders(now, until time.Time) ([]Reminder, error) {
+	policy, err := db.ReminderPolicy()
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := db.reminderTasks()
+	if err != nil {
+		return nil, err
+	}
+
+	var upcoming []Reminder
+	for _, t := range tasks {
+		for _, at := range policy.Times(&t) {
+			if at.After(now) && !at.After(until) {
+				upcoming = append(upcoming, Reminder{Task: t, At: at})
+			}
+		}
+	}
+	sort.SliceStable(upcoming, func(i, j int) bool {
+		return upcoming[i].At.Before(upcoming[j].At)
+	})
+	return upcoming, nil
+}
+
+// SetTaskReminders sets a task's reminder offsets, formatted with
+// model.FormatReminders, or makes it follow the default (nil)
+func (db *DB) SetTaskReminders(id string, reminders *string) error {
+	label := "Reset reminders"
+	if reminders != nil {
+		label = "Set reminders"
+	}
+	return db.updateTask(label, id, `reminders = ?`, reminders)
+}
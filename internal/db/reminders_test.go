@@ -0,0 +1,116 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+)
+
+func TestParseReminders(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"1h, 1d", "1d,1h"},
+		{"0 30m 30m", "30m,0"},
+		{"1d12h", "1d12h"},
+		{"2w", "2w"},
+		{"none", "none"},
+	}
+	for _, tt := range tests {
+		offsets, err := model.ParseReminders(tt.in)
+		if err != nil {
+			t.Errorf("ParseReminders(%q): %v", tt.in, err)
+			continue
+		}
+		if got := model.FormatReminders(offsets); got != tt.want {
+			t.Errorf("ParseReminders(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "soon", "1x", "-1h"} {
+		if _, err := model.ParseReminders(bad); err == nil {
+			t.Errorf("ParseReminders(%q) should fail", bad)
+		}
+	}
+}
+
+// TestClaimReminders checks that each reminder is claimed once, that late
+// ones count as missed, and how all-day and per-task reminders are timed
+func TestClaimReminders(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	base := time.Now().Truncate(time.Minute)
+	due := base.Add(2 * time.Hour)
+	call := &model.Task{Title: "Call", DueDate: &due}
+	if err := db.AddTask(call, nil); err != nil {
+		t.Fatalf("Failed to add task: %v", err)
+	}
+	quiet := &model.Task{Title: "Quiet", DueDate: &due}
+	db.AddTask(quiet, nil)
+	none := "none"
+	db.SetTaskReminders(quiet.ID, &none)
+
+	claim := func(now time.Time) []Reminder {
+		t.Helper()
+		reminders, err := db.ClaimReminders(now)
+		if err != nil {
+			t.Fatalf("ClaimReminders: %v", err)
+		}
+		return reminders
+	}
+
+	// Nothing before the hour-before reminder, then it goes off once
+	if got := claim(base.Add(30 * time.Minute)); len(got) != 0 {
+		t.Errorf("Claimed %d reminders early", len(got))
+	}
+	got := claim(base.Add(61 * time.Minute))
+	if len(got) != 1 || got[0].Task.ID != call.ID || got[0].Missed {
+		t.Fatalf("Claimed %+v, want the hour-before reminder", got)
+	}
+	if again := claim(base.Add(62 * time.Minute)); len(again) != 0 {
+		t.Errorf("Reminder claimed twice")
+	}
+
+	// Half an hour after it's due, the due-time reminder was missed
+	got = claim(due.Add(30 * time.Minute))
+	if len(got) != 1 || !got[0].Missed || !got[0].At.Equal(due) {
+		t.Errorf("Claimed %+v, want a missed reminder at %v", got, due)
+	}
+
+	// All-day due dates count back from reminders.all_day
+	if err := db.SetSetting(SettingRemindersAllDay, "8am"); err != nil {
+		t.Fatalf("Failed to set all-day time: %v", err)
+	}
+	if value, _ := db.GetSetting(SettingRemindersAllDay); value != "08:00" {
+		t.Errorf("reminders.all_day stored as %q", value)
+	}
+	tomorrow := model.EndOfDay(base.AddDate(0, 0, 1))
+	db.SetTaskDueDate(call.ID, &tomorrow)
+	policy, err := db.ReminderPolicy()
+	if err != nil {
+		t.Fatalf("ReminderPolicy: %v", err)
+	}
+	times := policy.Times(&model.Task{DueDate: &tomorrow})
+	eight := time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 8, 0, 0, 0, time.Local)
+	if len(times) != 2 || !times[0].Equal(eight.Add(-time.Hour)) || !times[1].Equal(eight) {
+		t.Errorf("All-day reminder times = %v", times)
+	}
+	got = claim(eight.Add(time.Minute))
+	if len(got) != 1 || got[0].Task.ID != call.ID || got[0].Missed {
+		t.Errorf("Claimed %+v, want the all-day reminder", got)
+	}
+
+	upcoming, err := db.UpcomingReminders(base, base.AddDate(0, 0, 2))
+	if err != nil {
+		t.Fatalf("UpcomingReminders: %v", err)
+	}
+	if len(upcoming) != 2 || !upcoming[1].At.Equal(eight) {
+		t.Errorf("Upcoming reminders = %+v", upcoming)
+	}
+}
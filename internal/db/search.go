@@ -0,0 +1,449 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/dori/klonch/internal/model"
+	"github.com/pressly/goose/v3"
+)
+
+// The search index is the tasks_fts virtual table, one row per task with its
+// title, description and tag names, kept in sync by triggers. It uses FTS5,
+// which the Makefile builds into the SQLite driver (-tags sqlite_fts5), and
+// falls back to FTS4, which is always compiled in, in builds without it.
+
+func init() {
+	goose.AddNamedMigrationContext("003_search_index.go", upSearchIndex, downSearchIndex)
+}
+
+// searchIndex is the kind of full-text table behind SearchTasks
+type searchIndex int
+
+const (
+	searchNone searchIndex = iota // No usable index, SearchTasks falls back to LIKE
+	searchFTS4
+	searchFTS5
+)
+
+const (
+	// SearchMarkStart and SearchMarkEnd wrap matched terms in search highlights
+	SearchMarkStart = "\x02"
+	SearchMarkEnd   = "\x03"
+
+	searchLimit = 50
+)
+
+const createFTS5 = `
+	CREATE VIRTUAL TABLE tasks_fts USING fts5(
+		task_id UNINDEXED, title, description, tags,
+		tokenize = 'unicode61 remove_diacritics 2', prefix = '2 3'
+	)`
+
+const createFTS4 = `
+	CREATE VIRTUAL TABLE tasks_fts USING fts4(
+		task_id, title, description, tags,
+		notindexed=task_id, tokenize=unicode61, prefix="2,3"
+	)`
+
+// tagNamesOf selects the space-separated tag names of a task
+func tagNamesOf(taskID string) string {
+	return `(
+		SELECT COALESCE(group_concat(tg.name, ' '), '')
+		FROM task_tags tt JOIN tags tg ON tg.id = tt.tag_id
+		WHERE tt.task_id = ` + taskID + `
+	)`
+}
+
+// searchTriggers keep tasks_fts in step with tasks, task_tags and tags
+var searchTriggers = map[string]string{
+	"tasks_fts_insert": `
+		CREATE TRIGGER tasks_fts_insert AFTER INSERT ON tasks BEGIN
+			INSERT INTO tasks_fts (task_id, title, description, tags)
+			VALUES (NEW.id, NEW.title, COALESCE(NEW.description, ''), ` + tagNamesOf("NEW.id") + `);
+		END`,
+	"tasks_fts_update": `
+		CREATE TRIGGER tasks_fts_update AFTER UPDATE OF id, title, description ON tasks BEGIN
+			UPDATE tasks_fts SET task_id = NEW.id, title = NEW.title, description = COALESCE(NEW.description, '')
+			WHERE task_id = OLD.id;
+		END`,
+	"tasks_fts_delete": `
+		CREATE TRIGGER tasks_fts_delete AFTER DELETE ON tasks BEGIN
+			DELETE FROM tasks_fts WHERE task_id = OLD.id;
+		END`,
+	"task_tags_fts_insert": `
+		CREATE TRIGGER task_tags_fts_insert AFTER INSERT ON task_tags BEGIN
+			UPDATE tasks_fts SET tags = ` + tagNamesOf("NEW.task_id") + ` WHERE task_id = NEW.task_id;
+		END`,
+	"task_tags_fts_delete": `
+		CREATE TRIGGER task_tags_fts_delete AFTER DELETE ON task_tags BEGIN
+			UPDATE tasks_fts SET tags = ` + tagNamesOf("OLD.task_id") + ` WHERE task_id = OLD.task_id;
+		END`,
+	"tags_fts_update": `
+		CREATE TRIGGER tags_fts_update AFTER UPDATE OF name ON tags BEGIN
+			UPDATE tasks_fts SET tags = ` + tagNamesOf("tasks_fts.task_id") + `
+			WHERE task_id IN (SELECT task_id FROM task_tags WHERE tag_id = NEW.id);
+		END`,
+}
+
+// upSearchIndex creates and fills the index, preferring FTS5
+func upSearchIndex(ctx context.Context, tx *sql.Tx) error {
+	if _, err := tx.ExecContext(ctx, createFTS5); err != nil {
+		if !isMissingModule(err) {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, createFTS4); err != nil {
+			return err
+		}
+	}
+	if err := createSearchTriggers(ctx, tx); err != nil {
+		return err
+	}
+	return fillSearchIndex(ctx, tx)
+}
+
+func downSearchIndex(ctx context.Context, tx *sql.Tx) error {
+	if err := dropSearchTriggers(ctx, tx); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `DROP TABLE IF EXISTS tasks_fts`)
+	return err
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func createSearchTriggers(ctx context.Context, e execer) error {
+	for _, stmt := range searchTriggers {
+		if _, err := e.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dropSearchTriggers(ctx context.Context, e execer) error {
+	for name := range searchTriggers {
+		if _, err := e.ExecContext(ctx, `DROP TRIGGER IF EXISTS `+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fillSearchIndex(ctx context.Context, e execer) error {
+	if _, err := e.ExecContext(ctx, `DELETE FROM tasks_fts`); err != nil {
+		return err
+	}
+	_, err := e.ExecContext(ctx, `
+		INSERT INTO tasks_fts (task_id, title, description, tags)
+		SELECT id, title, COALESCE(description, ''), `+tagNamesOf("tasks.id")+`
+		FROM tasks
+	`)
+	return err
+}
+
+func isMissingModule(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "no such module")
+}
+
+// openSearchIndex works out which index the database has. An FTS5 index
+// opened by a build without FTS5 can't be written, so its triggers are
+// dropped to keep task writes working and search falls back to LIKE; the
+// next build with FTS5 puts them back and rebuilds the index. An FTS4 index
+// opened by a build with FTS5 is replaced by an FTS5 one.
+func (db *DB) openSearchIndex() error {
+	var schema string
+	err := db.QueryRow(`SELECT sql FROM sqlite_master WHERE name = 'tasks_fts'`).Scan(&schema)
+	if err == sql.ErrNoRows {
+		db.search = searchNone
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	kind := searchFTS4
+	if strings.Contains(strings.ToLower(schema), "fts5") {
+		kind = searchFTS5
+	}
+
+	ctx := context.Background()
+	if _, err := db.Exec(`SELECT 1 FROM tasks_fts LIMIT 0`); isMissingModule(err) {
+		db.search = searchNone
+		return dropSearchTriggers(ctx, db.DB)
+	} else if err != nil {
+		return err
+	}
+
+	if kind == searchFTS4 {
+		err := db.Transaction(func(tx *sql.Tx) error {
+			if err := downSearchIndex(ctx, tx); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, createFTS5); err != nil {
+				return err
+			}
+			if err := createSearchTriggers(ctx, tx); err != nil {
+				return err
+			}
+			return fillSearchIndex(ctx, tx)
+		})
+		if err == nil {
+			db.search = searchFTS5
+			return nil
+		}
+		if !isMissingModule(err) {
+			return err
+		}
+	}
+
+	var triggers int
+	err = db.QueryRow(`
+		SELECT COUNT(*) FROM sqlite_master
+		WHERE type = 'trigger' AND tbl_name IN ('tasks', 'task_tags', 'tags') AND name LIKE '%fts%'
+	`).Scan(&triggers)
+	if err != nil {
+		return err
+	}
+	if triggers < len(searchTriggers) {
+		err := db.Transaction(func(tx *sql.Tx) error {
+			if err := dropSearchTriggers(ctx, tx); err != nil {
+				return err
+			}
+			if err := createSearchTriggers(ctx, tx); err != nil {
+				return err
+			}
+			return fillSearchIndex(ctx, tx)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	db.search = kind
+	return nil
+}
+
+// SearchResult is a task found by SearchTasks
+type SearchResult struct {
+	Task      model.Task
+	Ancestors []model.Task // Parent chain, outermost first
+	Title     string       // Title with matches between SearchMarkStart and SearchMarkEnd
+	Snippet   string       // Best matching excerpt from any field, marked the same way
+	Score     float64      // Higher is more relevant
+}
+
+// SearchTasks finds tasks whose title, description or tags contain every word
+// of the query, matching word prefixes. Open tasks come first, then the most
+// relevant; done, archived and nested tasks are all included.
+func (db *DB) SearchTasks(query string) ([]SearchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	var results []SearchResult
+	var err error
+	switch db.search {
+	case searchFTS5, searchFTS4:
+		results, err = db.searchIndex(terms)
+	default:
+		results, err = db.searchLike(terms)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Rows are closed, so the follow-up queries are safe
+	for i := range results {
+		if results[i].Ancestors, err = db.GetTaskAncestors(results[i].Task.ID); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// searchTerms lowercases the query and splits it into words, dropping
+// punctuation so FTS operators and tag @ signs can't leak into MATCH
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// searchColumnWeights weights hits in task_id, title, description and tags
+var searchColumnWeights = []float64{0, 10, 3, 5}
+
+func (db *DB) searchIndex(terms []string) ([]SearchResult, error) {
+	match := strings.Join(terms, "* ") + "*"
+
+	// Arguments to snippet() and the ranking expression differ between versions
+	var title, snippet, rank string
+	if db.search == searchFTS5 {
+		title = `snippet(tasks_fts, 1, ?1, ?2, '', 64)`
+		snippet = `snippet(tasks_fts, -1, ?1, ?2, '…', 12)`
+		rank = `-bm25(tasks_fts, 0.0, 10.0, 3.0, 5.0)`
+	} else {
+		title = `snippet(tasks_fts, ?1, ?2, '', 1, 64)`
+		snippet = `snippet(tasks_fts, ?1, ?2, '…', -1, 12)`
+		rank = `matchinfo(tasks_fts, 'pcx')`
+	}
+
+	rows, err := db.Query(`
+		SELECT t.id, t.title, t.description, t.status, t.priority, t.urgency, t.importance,
+		       t.project_id, t.parent_id, t.due_date, t.start_date, t.completed_at,
+		       t.time_estimate, t.recurrence, t.reminders, t.position, t.gcal_event_id, t.state_id,
+		       t.created_at, t.updated_at,
+		       `+title+`, `+snippet+`, `+rank+`
+		FROM tasks_fts
+		JOIN tasks t ON t.id = tasks_fts.task_id
+		WHERE tasks_fts MATCH ?3
+	`, SearchMarkStart, SearchMarkEnd, match)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		var rankValue interface{}
+		t, err := db.scanTaskRow(scanFunc(func(dest ...interface{}) error {
+			return rows.Scan(append(dest, &r.Title, &r.Snippet, &rankValue)...)
+		}))
+		if err != nil {
+			return nil, err
+		}
+		r.Task = *t
+		switch v := rankValue.(type) {
+		case float64:
+			r.Score = v
+		case []byte:
+			r.Score = matchinfoScore(v)
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sortSearchResults(results)
+	if len(results) > searchLimit {
+		results = results[:searchLimit]
+	}
+	return results, nil
+}
+
+// matchinfoScore ranks an FTS4 row from matchinfo 'pcx': for each phrase and
+// column, hits in this row weighted by column and scaled down for common terms
+func matchinfoScore(blob []byte) float64 {
+	values := make([]uint32, len(blob)/4)
+	for i := range values {
+		values[i] = binary.NativeEndian.Uint32(blob[i*4:])
+	}
+	if len(values) < 2 {
+		return 0
+	}
+
+	phrases, cols := int(values[0]), int(values[1])
+	score := 0.0
+	for p := 0; p < phrases; p++ {
+		for c := 0; c < cols && c < len(searchColumnWeights); c++ {
+			i := 2 + 3*(p*cols+c)
+			if i+2 >= len(values) || values[i] == 0 {
+				continue
+			}
+			hits, docs := float64(values[i]), float64(values[i+2])
+			score += searchColumnWeights[c] * hits / math.Max(docs, 1)
+		}
+	}
+	return score
+}
+
+// searchLike is the fallback when there is no usable index
+func (db *DB) searchLike(terms []string) ([]SearchResult, error) {
+	query := `
+		SELECT id, title, description, status, priority, urgency, importance,
+		       project_id, parent_id, due_date, start_date, completed_at,
+		       time_estimate, recurrence, reminders, position, gcal_event_id, state_id,
+		       created_at, updated_at
+		FROM tasks WHERE 1 = 1`
+	var args []interface{}
+	for _, term := range terms {
+		query += ` AND (title LIKE ? OR description LIKE ? OR id IN (
+			SELECT tt.task_id FROM task_tags tt JOIN tags tg ON tg.id = tt.tag_id WHERE tg.name LIKE ?))`
+		pattern := "%" + term + "%"
+		args = append(args, pattern, pattern, pattern)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks, err := db.scanTasks(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(tasks))
+	for _, t := range tasks {
+		results = append(results, SearchResult{Task: t, Title: t.Title})
+	}
+	sortSearchResults(results)
+	if len(results) > searchLimit {
+		results = results[:searchLimit]
+	}
+	return results, nil
+}
+
+// sortSearchResults puts open tasks first, then orders by score
+func sortSearchResults(results []SearchResult) {
+	closed := func(r SearchResult) bool {
+		return r.Task.Status == model.StatusDone || r.Task.Status == model.StatusArchived
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if ci, cj := closed(results[i]), closed(results[j]); ci != cj {
+			return cj
+		}
+		return results[i].Score > results[j].Score
+	})
+}
+
+// scanFunc adapts a function to the scanner interface
+type scanFunc func(dest ...interface{}) error
+
+func (f scanFunc) Scan(dest ...interface{}) error { return f(dest...) }
+
+// GetTaskAncestors returns a task's parent chain, outermost first
+func (db *DB) GetTaskAncestors(id string) ([]model.Task, error) {
+	rows, err := db.Query(`
+		WITH RECURSIVE chain(id, depth) AS (
+			SELECT parent_id, 1 FROM tasks WHERE id = ? AND parent_id IS NOT NULL
+			UNION ALL
+			SELECT t.parent_id, chain.depth + 1 FROM tasks t
+			JOIN chain ON t.id = chain.id
+			WHERE t.parent_id IS NOT NULL
+		)
+		SELECT t.id, t.title, t.description, t.status, t.priority, t.urgency, t.importance,
+		       t.project_id, t.parent_id, t.due_date, t.start_date, t.completed_at,
+		       t.time_estimate, t.recurrence, t.reminders, t.position, t.gcal_event_id, t.state_id,
+		       t.created_at, t.updated_at
+		FROM chain JOIN tasks t ON t.id = chain.id
+		ORDER BY chain.depth DESC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return db.scanTasks(rows)
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dori/klonch/internal/model"
+)
+
+// TestSearchTasks covers prefix matching across titles, descriptions and tags,
+// nested and finished tasks, highlighting, and the triggers that keep the
+// index current. make test runs it with and without -tags sqlite_fts5, to
+// cover both indexes.
+func TestSearchTasks(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	report, _ := db.CreateTask("Quarterly report", nil)
+	draft, _ := db.CreateSubtask("Draft summary", report.ID)
+	figures, _ := db.CreateSubtask("Gather figures", draft.ID)
+	db.Exec(`UPDATE tasks SET description = 'numbers from the finance dashboard' WHERE id = ?`, figures.ID)
+	milk, _ := db.CreateTask("Buy milk", nil)
+	tag, _ := db.CreateTag("errands", "")
+	db.AddTagToTask(milk.ID, tag.ID)
+	db.SetTaskStatus(report.ID, model.StatusDone)
+
+	ids := func(query string) []string {
+		t.Helper()
+		results, err := db.SearchTasks(query)
+		if err != nil {
+			t.Fatalf("Search %q failed: %v", query, err)
+		}
+		var out []string
+		for _, r := range results {
+			out = append(out, r.Task.ID)
+		}
+		return out
+	}
+
+	if got := ids("quart rep"); len(got) != 1 || got[0] != report.ID {
+		t.Errorf("Expected prefix search to find the done report, got %v", got)
+	}
+	if got := ids("finance"); len(got) != 1 || got[0] != figures.ID {
+		t.Errorf("Expected description search to find the nested subtask, got %v", got)
+	}
+	if got := ids("@errands"); len(got) != 1 || got[0] != milk.ID {
+		t.Errorf("Expected tag search to find the tagged task, got %v", got)
+	}
+	if got := ids(`"OR" NOT*`); len(got) != 0 {
+		t.Errorf("Expected operators to be treated as words, got %v", got)
+	}
+
+	results, _ := db.SearchTasks("gather")
+	if len(results) != 1 {
+		t.Fatalf("Expected one result, got %d", len(results))
+	}
+	if !strings.Contains(results[0].Title, SearchMarkStart+"Gather"+SearchMarkEnd) {
+		t.Errorf("Expected the match to be highlighted, got %q", results[0].Title)
+	}
+	if len(results[0].Ancestors) != 2 || results[0].Ancestors[0].ID != report.ID {
+		t.Errorf("Expected ancestors report > draft, got %+v", results[0].Ancestors)
+	}
+
+	// Renames, tag changes and deletes flow through the triggers
+	db.UpdateTaskTitle(milk.ID, "Buy oat drink")
+	if got := ids("milk"); len(got) != 0 {
+		t.Errorf("Expected the old title to be gone from the index, got %v", got)
+	}
+	db.UpdateTag(tag.ID, "shopping", "")
+	if got := ids("shopping"); len(got) != 1 {
+		t.Errorf("Expected renamed tag to be searchable, got %v", got)
+	}
+	db.DeleteTask(report.ID)
+	if got := ids("gather"); len(got) != 0 {
+		t.Errorf("Expected deleted subtasks to leave the index, got %v", got)
+	}
+	db.Undo()
+	if got := ids("gather"); len(got) != 1 {
+		t.Errorf("Expected undo to restore the index entry, got %v", got)
+	}
+}
+
+// TestSearchIndexUpgrade checks that an FTS4 index, as left by a build
+// without FTS5, becomes an FTS5 one when a build with FTS5 opens it
+func TestSearchIndexUpgrade(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	db.CreateTask("Quarterly report", nil)
+
+	ctx := context.Background()
+	dropSearchTriggers(ctx, db.DB)
+	db.Exec(`DROP TABLE tasks_fts`)
+	if _, err := db.Exec(createFTS4); err != nil {
+		t.Fatalf("Failed to create an FTS4 index: %v", err)
+	}
+	createSearchTriggers(ctx, db.DB)
+	fillSearchIndex(ctx, db.DB)
+	_, probe := db.Exec(`CREATE VIRTUAL TABLE temp.fts5_probe USING fts5(x)`)
+	fts5 := probe == nil
+	db.Close()
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	var schema string
+	db.QueryRow(`SELECT sql FROM sqlite_master WHERE name = 'tasks_fts'`).Scan(&schema)
+	want := "fts4"
+	if fts5 {
+		want = "fts5"
+	}
+	if !strings.Contains(schema, "USING "+want) {
+		t.Errorf("Expected the index to use %s, got %q", want, schema)
+	}
+	if results, err := db.SearchTasks("quart"); err != nil || len(results) != 1 {
+		t.Errorf("Expected the reopened index to find the task, got %d results, %v", len(results), err)
+	}
+}
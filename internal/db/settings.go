@@ -0,0 +1,449 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dori/klonch/internal/model"
+	"github.com/dori/klonch/internal/parse"
+)
+
+// Setting keys
+const (
+	SettingTheme        = "theme"
+	SettingLastView     = "last_view"
+	SettingMouse        = "mouse"
+	SettingShowDeferred = "show_deferred"
+	SettingListViewMode = "list.view_mode"
+	SettingListWrap     = "list.wrap"
+	SettingListSort     = "list.sort"
+	SettingListDetails  = "list.details"
+
+	// Queries behind the planning and review sections
+	SettingPlanningOverdue = "planning.overdue"
+	SettingPlanningUndated = "planning.undated"
+	SettingPlanningToday   = "planning.today"
+	SettingReviewCompleted = "review.completed"
+	SettingReviewOverdue   = "review.overdue"
+	SettingReviewStale     = "review.stale"
+
+	// Kanban's swimlanes, whether a full column refuses more tasks, and the
+	// WIP limits of the default workflow's columns
+	SettingKanbanSwimlanes     = "kanban.swimlanes"
+	SettingKanbanWIPBlock      = "kanban.wip_block"
+	SettingKanbanWIPBacklog    = "kanban.wip_backlog"
+	SettingKanbanWIPTodo       = "kanban.wip_todo"
+	SettingKanbanWIPInProgress = "kanban.wip_in_progress"
+	SettingKanbanWIPDone       = "kanban.wip_done"
+
+	// Estimated work that fits in a day, compared against Planning's today
+	SettingPlanningCapacity = "planning.capacity"
+
+	// Reminders for tasks that don't set their own, and the time of day that
+	// reminders for all-day due dates count back from
+	SettingRemindersDefault = "reminders.default"
+	SettingRemindersAllDay  = "reminders.all_day"
+
+	// Pomodoro timer lengths and cycle: a long break replaces every Nth
+	// short one, breaks and work sessions can start on their own, and a
+	// daily goal counts completed sessions
+	SettingPomodoroWork           = "pomodoro.work"
+	SettingPomodoroShortBreak     = "pomodoro.short_break"
+	SettingPomodoroLongBreak      = "pomodoro.long_break"
+	SettingPomodoroLongBreakEvery = "pomodoro.long_break_every"
+	SettingPomodoroAutoBreak      = "pomodoro.auto_break"
+	SettingPomodoroAutoWork       = "pomodoro.auto_work"
+	SettingPomodoroDailyGoal      = "pomodoro.daily_goal"
+
+	// When a running timer asks about time spent away, how klonch notices
+	// being away, and when a long-running timer sends a notification
+	SettingTimerIdleAfter  = "timer.idle_after"
+	SettingTimerIdleSource = "timer.idle_source"
+	SettingTimerLongAfter  = "timer.long_after"
+
+	// How the timesheet rounds each entry for billing
+	SettingTimesheetRoundTo  = "timesheet.round_to"
+	SettingTimesheetRounding = "timesheet.rounding"
+
+	// Where notifications go, and what the command, ntfy and Gotify
+	// backends need
+	SettingNotifyBackends = "notify.backends"
+	SettingNotifyCommand  = "notify.command"
+	SettingNotifyURL      = "notify.url"
+	SettingNotifyToken    = "notify.token"
+)
+
+// SettingDef describes a known setting
+type SettingDef struct {
+	Key         string
+	Default     string
+	Description string
+	Choices     []string // Allowed values; empty means free-form
+	Bool        bool     // Stored as on/off, accepts true/false, yes/no, 1/0
+	Query       bool     // A filter query, checked with ParseQuery
+	Sort        bool     // A sort order, checked with model.ParseSortOrder
+	Duration    bool     // A length of time such as 6h, checked with model.ParseEstimate
+	Off         bool     // A Duration that also accepts off, read as 0
+	Reminders   bool     // Reminder offsets such as 1d,1h, checked with model.ParseReminders
+	Clock       bool     // A time of day such as 09:00, checked with parse.Clock
+	Count       bool     // A whole number, 0 or more
+	Secret      bool     // Never shown back, such as access tokens
+}
+
+// SettingDefs lists every known setting in display order
+var SettingDefs = []SettingDef{
+	{Key: SettingTheme, Default: "nord", Description: "Color theme"},
+	{Key: SettingLastView, Default: "list", Description: "View shown on startup",
+		Choices: []string{"list", "kanban", "eisenhower", "calendar", "pomodoro", "planning", "review", "stats", "timesheet"}},
+	{Key: SettingMouse, Default: "on", Description: "Mouse capture", Bool: true},
+	{Key: SettingShowDeferred, Default: "off", Description: "Show tasks whose start date is still ahead", Bool: true},
+	{Key: SettingListViewMode, Default: "all", Description: "Tasks shown in the list",
+		Choices: []string{"all", "active", "recent"}},
+	{Key: SettingListWrap, Default: "off", Description: "Wrap long task titles", Bool: true},
+	{Key: SettingListDetails, Default: "off", Description: "Show the detail pane beside the list", Bool: true},
+	{Key: SettingListSort, Default: "", Description: "Task order when no project is chosen (empty for the default)",
+		Sort: true},
+	{Key: SettingKanbanSwimlanes, Default: SwimlanesNone, Description: "Kanban: group tasks into swimlanes by",
+		Choices: []string{SwimlanesNone, SwimlanesProject, SwimlanesPriority, SwimlanesTag, SwimlanesParent}},
+	{Key: SettingKanbanWIPBlock, Default: "off",
+		Description: "Kanban: refuse to move tasks into a column at its WIP limit, rather than warn", Bool: true},
+	{Key: SettingKanbanWIPBacklog, Default: "0", Description: "Kanban: WIP limit of the default Backlog column (0 for none)",
+		Count: true},
+	{Key: SettingKanbanWIPTodo, Default: "0", Description: "Kanban: WIP limit of the default Todo column (0 for none)",
+		Count: true},
+	{Key: SettingKanbanWIPInProgress, Default: "0",
+		Description: "Kanban: WIP limit of the default In Progress column (0 for none)", Count: true},
+	{Key: SettingKanbanWIPDone, Default: "0", Description: "Kanban: WIP limit of the default Done column (0 for none)",
+		Count: true},
+	{Key: SettingPlanningOverdue, Default: "status:pending,in_progress and due<today",
+		Description: "Planning: overdue section", Query: true},
+	{Key: SettingPlanningUndated, Default: "status:pending,in_progress and due:none and not start:today",
+		Description: "Planning: undated section", Query: true},
+	{Key: SettingPlanningToday, Default: "status:pending,in_progress and (due:today or start:today)",
+		Description: "Planning: today section", Query: true},
+	{Key: SettingPlanningCapacity, Default: "6h", Description: "Planning: estimated work that fits in a day",
+		Duration: true},
+	{Key: SettingRemindersDefault, Default: "1h,0",
+		Description: "Reminders before a task is due, unless it sets its own (none to turn off)", Reminders: true},
+	{Key: SettingRemindersAllDay, Default: "09:00",
+		Description: "Time of day that reminders for all-day due dates count back from", Clock: true},
+	{Key: SettingPomodoroWork, Default: "25m", Description: "Pomodoro: length of a work session", Duration: true},
+	{Key: SettingPomodoroShortBreak, Default: "5m", Description: "Pomodoro: length of a short break", Duration: true},
+	{Key: SettingPomodoroLongBreak, Default: "15m", Description: "Pomodoro: length of a long break", Duration: true},
+	{Key: SettingPomodoroLongBreakEvery, Default: "4",
+		Description: "Pomodoro: work sessions before a long break (0 for short breaks only)", Count: true},
+	{Key: SettingPomodoroAutoBreak, Default: "off", Description: "Pomodoro: start breaks when a session ends", Bool: true},
+	{Key: SettingPomodoroAutoWork, Default: "off", Description: "Pomodoro: start the next session when a break ends",
+		Bool: true},
+	{Key: SettingPomodoroDailyGoal, Default: "8", Description: "Pomodoro: sessions to complete each day (0 for no goal)",
+		Count: true},
+	{Key: SettingTimerIdleAfter, Default: "10m",
+		Description: "Timers: ask about time away after this long without input (off to never ask)", Duration: true,
+		Off: true},
+	{Key: SettingTimerIdleSource, Default: IdleSourceAuto, Description: "Timers: how to notice time away",
+		Choices: []string{IdleSourceAuto, IdleSourceInput}},
+	{Key: SettingTimerLongAfter, Default: "4h",
+		Description: "Timers: notify when a timer has run this long (off to never notify)", Duration: true, Off: true},
+	{Key: SettingTimesheetRoundTo, Default: "0",
+		Description: "Timesheet: round each entry to this many minutes (0 for no rounding)", Count: true},
+	{Key: SettingTimesheetRounding, Default: RoundNearest, Description: "Timesheet: which way entries round",
+		Choices: []string{RoundUp, RoundNearest, RoundDown}},
+	{Key: SettingNotifyBackends, Default: "auto",
+		Description: "Where notifications go, comma-separated backends such as dbus,ntfy (auto to pick, none for nowhere)"},
+	{Key: SettingNotifyCommand, Default: "",
+		Description: "Shell command for the command backend ($KLONCH_TITLE, $KLONCH_BODY, $KLONCH_URGENCY)"},
+	{Key: SettingNotifyURL, Default: "", Description: "ntfy topic URL or Gotify server URL"},
+	{Key: SettingNotifyToken, Default: "", Description: "Access token for ntfy or Gotify", Secret: true},
+	{Key: SettingReviewCompleted, Default: "status:done and completed:week",
+		Description: "Review: completed section", Query: true},
+	{Key: SettingReviewOverdue, Default: "status:pending,in_progress and due<today",
+		Description: "Review: overdue section", Query: true},
+	{Key: SettingReviewStale, Default: "status:pending,in_progress and created<-2w and updated<-2w",
+		Description: "Review: stale section", Query: true},
+}
+
+// SettingCheck vets a setting's value for a package the db doesn't depend
+// on, such as the themes and notification backends, returning the value to
+// store or why the value won't do
+type SettingCheck func(value string) (string, error)
+
+// CheckSetting has SetSetting vet a setting's values with check, on this
+// database and the handles Group returns from it. Call it right after Open.
+func (db *DB) CheckSetting(key string, check SettingCheck) {
+	db.checks[key] = check
+}
+
+// SettingChange is sent to subscribers whenever a setting is written
+type SettingChange struct {
+	Key   string
+	Value string
+}
+
+// settingsHub fans out setting changes; it is shared by every handle to a DB
+type settingsHub struct {
+	mu   sync.Mutex
+	subs []chan SettingChange
+}
+
+// LookupSetting returns the definition for a key
+func LookupSetting(key string) (SettingDef, bool) {
+	for _, def := range SettingDefs {
+		if def.Key == key {
+			return def, true
+		}
+	}
+	return SettingDef{}, false
+}
+
+// GetSetting returns a setting's value, or its default if it was never set
+func (db *DB) GetSetting(key string) (string, error) {
+	var value sql.NullString
+	err := db.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows || (err == nil && !value.Valid) {
+		def, _ := LookupSetting(key)
+		return def.Default, nil
+	}
+	return value.String, err
+}
+
+// GetQuerySetting returns a query setting parsed, falling back to the default
+// if the stored query no longer parses
+func (db *DB) GetQuerySetting(key string) (*Query, error) {
+	value, err := db.GetSetting(key)
+	if err != nil {
+		return nil, err
+	}
+	if q, err := ParseQuery(value); err == nil {
+		return q, nil
+	}
+	def, _ := LookupSetting(key)
+	return ParseQuery(def.Default)
+}
+
+// GetBoolSetting returns an on/off setting as a bool
+func (db *DB) GetBoolSetting(key string) (bool, error) {
+	value, err := db.GetSetting(key)
+	if err != nil {
+		return false, err
+	}
+	return ParseBoolSetting(value)
+}
+
+// GetDurationSetting returns a length-of-time setting in minutes, or 0 for
+// one turned off, falling back to the default if the stored value no longer
+// parses
+func (db *DB) GetDurationSetting(key string) (int, error) {
+	value, err := db.GetSetting(key)
+	if err != nil {
+		return 0, err
+	}
+	def, _ := LookupSetting(key)
+	if def.Off && value == "off" {
+		return 0, nil
+	}
+	if minutes, err := model.ParseEstimate(value); err == nil {
+		return minutes, nil
+	}
+	return model.ParseEstimate(def.Default)
+}
+
+// GetCountSetting returns a whole-number setting, falling back to the
+// default if the stored value no longer parses
+func (db *DB) GetCountSetting(key string) (int, error) {
+	value, err := db.GetSetting(key)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := parseCount(value); err == nil {
+		return n, nil
+	}
+	def, _ := LookupSetting(key)
+	return parseCount(def.Default)
+}
+
+// parseCount reads a whole number, 0 or more
+func parseCount(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("expected a whole number, got %q", value)
+	}
+	return n, nil
+}
+
+// ParseBoolSetting accepts on/off, true/false, yes/no and 1/0
+func ParseBoolSetting(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "on", "yes":
+		return true, nil
+	case "off", "no":
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("expected on or off, got %q", value)
+	}
+	return b, nil
+}
+
+// SetSetting validates and stores a setting, then notifies subscribers
+func (db *DB) SetSetting(key, value string) error {
+	def, ok := LookupSetting(key)
+	if !ok {
+		return fmt.Errorf("unknown setting: %s", key)
+	}
+
+	value = strings.TrimSpace(value)
+	if def.Bool {
+		b, err := ParseBoolSetting(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		value = FormatBoolSetting(b)
+	}
+	if def.Query {
+		if _, err := ParseQuery(value); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	if def.Sort {
+		order, err := model.ParseSortOrder(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		value = order.String()
+	}
+	if def.Duration {
+		if def.Off && strings.EqualFold(value, "off") {
+			value = "off"
+		} else {
+			minutes, err := model.ParseEstimate(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			value = model.FormatEstimate(minutes)
+		}
+	}
+	if def.Reminders {
+		offsets, err := model.ParseReminders(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		value = model.FormatReminders(offsets)
+	}
+	if def.Clock {
+		hour, min, ok := parse.Clock(value)
+		if !ok {
+			return fmt.Errorf("%s: expected a time of day such as 09:00, got %q", key, value)
+		}
+		value = fmt.Sprintf("%02d:%02d", hour, min)
+	}
+	if def.Count {
+		n, err := parseCount(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		value = strconv.Itoa(n)
+	}
+	if check := db.checks[key]; check != nil {
+		checked, err := check(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		value = checked
+	}
+	if len(def.Choices) > 0 {
+		value = strings.ToLower(value)
+		valid := false
+		for _, c := range def.Choices {
+			if c == value {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("%s must be one of: %s", key, strings.Join(def.Choices, ", "))
+		}
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO settings (key, value) VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value
+	`, key, value)
+	if err != nil {
+		return err
+	}
+
+	db.settings.notify(SettingChange{Key: key, Value: value})
+	return nil
+}
+
+// DisplaySetting returns a setting's value as it may be shown, masking
+// secrets that are set
+func DisplaySetting(key, value string) string {
+	if def, ok := LookupSetting(key); ok && def.Secret && value != "" {
+		return "********"
+	}
+	return value
+}
+
+// SetBoolSetting stores an on/off setting
+func (db *DB) SetBoolSetting(key string, value bool) error {
+	return db.SetSetting(key, FormatBoolSetting(value))
+}
+
+// FormatBoolSetting renders a bool the way on/off settings are stored
+func FormatBoolSetting(value bool) string {
+	if value {
+		return "on"
+	}
+	return "off"
+}
+
+// Settings returns the current value of every known setting
+func (db *DB) Settings() (map[string]string, error) {
+	values := make(map[string]string, len(SettingDefs))
+	for _, def := range SettingDefs {
+		values[def.Key] = def.Default
+	}
+
+	rows, err := db.Query(`SELECT key, value FROM settings WHERE value IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		if _, ok := LookupSetting(key); ok {
+			values[key] = value
+		}
+	}
+	return values, rows.Err()
+}
+
+// SubscribeSettings returns a channel that receives every setting change.
+// Slow subscribers miss changes rather than blocking writers.
+func (db *DB) SubscribeSettings() <-chan SettingChange {
+	ch := make(chan SettingChange, 16)
+	db.settings.mu.Lock()
+	db.settings.subs = append(db.settings.subs, ch)
+	db.settings.mu.Unlock()
+	return ch
+}
+
+func (h *settingsHub) notify(change SettingChange) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ch := range h.subs {
+		select {
+		case ch <- change:
+		default:
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// TestSettingsDefaultsAndValidation checks defaults, normalization and change notification
+func TestSettingsDefaultsAndValidation(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if wrap, err := db.GetBoolSetting(SettingListWrap); err != nil || wrap {
+		t.Errorf("Expected list.wrap to default to off, got %v (%v)", wrap, err)
+	}
+
+	changes := db.SubscribeSettings()
+	if err := db.SetSetting(SettingListWrap, "true"); err != nil {
+		t.Fatalf("Failed to set list.wrap: %v", err)
+	}
+	if got, _ := db.GetSetting(SettingListWrap); got != "on" {
+		t.Errorf("Expected list.wrap to be stored as on, got %q", got)
+	}
+	select {
+	case change := <-changes:
+		if change.Key != SettingListWrap || change.Value != "on" {
+			t.Errorf("Unexpected change notification: %+v", change)
+		}
+	default:
+		t.Errorf("Expected a change notification")
+	}
+
+	if err := db.SetSetting(SettingListViewMode, "sideways"); err == nil {
+		t.Errorf("Expected an invalid view mode to be rejected")
+	}
+	if err := db.SetSetting(SettingListSort, "colour"); err == nil {
+		t.Errorf("Expected an unknown sort field to be rejected")
+	}
+	if err := db.SetSetting(SettingListSort, "Due,PRIORITY:asc"); err != nil {
+		t.Fatalf("Failed to set list.sort: %v", err)
+	}
+	if got, _ := db.GetSetting(SettingListSort); got != "due, priority asc" {
+		t.Errorf("Expected list.sort to be normalized, got %q", got)
+	}
+	if err := db.SetSetting(SettingPlanningCapacity, "soon"); err == nil {
+		t.Errorf("Expected an unreadable capacity to be rejected")
+	}
+	if err := db.SetSetting(SettingPlanningCapacity, "90"); err != nil {
+		t.Fatalf("Failed to set planning.capacity: %v", err)
+	}
+	if got, _ := db.GetDurationSetting(SettingPlanningCapacity); got != 90 {
+		t.Errorf("Expected a capacity of 90 minutes, got %d", got)
+	}
+	if got, _ := db.GetSetting(SettingPlanningCapacity); got != "1h30m" {
+		t.Errorf("Expected planning.capacity to be normalized, got %q", got)
+	}
+
+	// Packages the db doesn't depend on vet their own settings
+	db.CheckSetting(SettingTheme, func(value string) (string, error) {
+		if value != "nord" {
+			return "", fmt.Errorf("unknown theme %q", value)
+		}
+		return value, nil
+	})
+	if err := db.SetSetting(SettingTheme, "bogus"); err == nil {
+		t.Errorf("Expected an unknown theme to be rejected")
+	}
+	if err := db.SetSetting(SettingTheme, "nord"); err != nil {
+		t.Errorf("Failed to set theme: %v", err)
+	}
+	if got := DisplaySetting(SettingNotifyToken, "tk_secret"); got == "tk_secret" {
+		t.Errorf("Expected notify.token to be masked, got %q", got)
+	}
+	if got := DisplaySetting(SettingNotifyURL, "https://ntfy.sh/x"); got != "https://ntfy.sh/x" {
+		t.Errorf("Expected notify.url to be shown, got %q", got)
+	}
+	if err := db.SetSetting("no.such.setting", "1"); err == nil {
+		t.Errorf("Expected an unknown key to be rejected")
+	}
+
+	all, err := db.Settings()
+	if err != nil {
+		t.Fatalf("Failed to list settings: %v", err)
+	}
+	if all[SettingListWrap] != "on" || all[SettingLastView] != "list" {
+		t.Errorf("Unexpected settings: %v", all)
+	}
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+	"github.com/google/uuid"
+)
+
+// GetSmartLists returns every saved query in display order
+func (db *DB) GetSmartLists() ([]model.SmartList, error) {
+	rows, err := db.Query(`
+		SELECT id, name, query, COALESCE(position, 0), created_at, updated_at
+		FROM smart_lists
+		ORDER BY position, name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lists []model.SmartList
+	for rows.Next() {
+		var l model.SmartList
+		if err := rows.Scan(&l.ID, &l.Name, &l.Query, &l.Position, &l.CreatedAt, &l.UpdatedAt); err != nil {
+			return nil, err
+		}
+		lists = append(lists, l)
+	}
+	return lists, rows.Err()
+}
+
+// GetSmartListByName returns a saved query by name, ignoring case
+func (db *DB) GetSmartListByName(name string) (*model.SmartList, error) {
+	var l model.SmartList
+	err := db.QueryRow(`
+		SELECT id, name, query, COALESCE(position, 0), created_at, updated_at
+		FROM smart_lists WHERE name = ?
+	`, name).Scan(&l.ID, &l.Name, &l.Query, &l.Position, &l.CreatedAt, &l.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// SaveSmartList stores a query under a name, replacing the query of an
+// existing list with the same name
+func (db *DB) SaveSmartList(name, query string) (*model.SmartList, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("smart list needs a name")
+	}
+	q, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := db.GetSmartListByName(name)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	if existing != nil {
+		err := db.record("Edit smart list", func(j *journal) error {
+			if err := j.track("smart_list", existing.ID); err != nil {
+				return err
+			}
+			_, err := j.Exec(`UPDATE smart_lists SET query = ?, updated_at = ? WHERE id = ?`,
+				q.String(), Timestamp(now), existing.ID)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		existing.Query = q.String()
+		existing.UpdatedAt = now
+		return existing, nil
+	}
+
+	l := model.SmartList{ID: uuid.New().String(), Name: name, Query: q.String(), CreatedAt: now, UpdatedAt: now}
+	err = db.record("Save smart list", func(j *journal) error {
+		if err := j.track("smart_list", l.ID); err != nil {
+			return err
+		}
+		if err := j.QueryRow(`SELECT COALESCE(MAX(position), 0) + 1 FROM smart_lists`).Scan(&l.Position); err != nil {
+			return err
+		}
+		_, err := j.Exec(`
+			INSERT INTO smart_lists (id, name, query, position, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, l.ID, l.Name, l.Query, l.Position, Timestamp(now), Timestamp(now))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// DeleteSmartList removes a saved query
+func (db *DB) DeleteSmartList(id string) error {
+	return db.record("Delete smart list", func(j *journal) error {
+		if err := j.track("smart_list", id); err != nil {
+			return err
+		}
+		_, err := j.Exec(`DELETE FROM smart_lists WHERE id = ?`, id)
+		return err
+	})
+}
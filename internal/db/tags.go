@@ -101,11 +101,16 @@ func (db *DB) CreateTag(name, color string) (*model.Tag, error) {
 	id := uuid.New().String()
 	now := time.Now()
 
-	_, err := db.Exec(`
-		INSERT INTO tags (id, name, color, created_at)
-		VALUES (?, ?, ?, ?)
-	`, id, name, color, now)
-
+	err := db.record("Create tag", func(j *journal) error {
+		if err := j.track("tag", id); err != nil {
+			return err
+		}
+		_, err := j.Exec(`
+			INSERT INTO tags (id, name, color, created_at)
+			VALUES (?, ?, ?, ?)
+		`, id, name, color, Timestamp(now))
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -137,23 +142,41 @@ func (db *DB) UpdateTag(id, name, color string) error {
 		name = "@" + name
 	}
 
-	_, err := db.Exec(`
-		UPDATE tags SET name = ?, color = ? WHERE id = ?
-	`, name, color, id)
-	return err
+	return db.record("Edit tag", func(j *journal) error {
+		if err := j.track("tag", id); err != nil {
+			return err
+		}
+		_, err := j.Exec(`
+			UPDATE tags SET name = ?, color = ? WHERE id = ?
+		`, name, color, id)
+		return err
+	})
 }
 
 // DeleteTag deletes a tag
 func (db *DB) DeleteTag(id string) error {
-	return db.Transaction(func(tx *sql.Tx) error {
+	return db.record("Delete tag", func(j *journal) error {
+		if err := j.track("tag", id); err != nil {
+			return err
+		}
+		taskIDs, err := queryStrings(j, `SELECT task_id FROM task_tags WHERE tag_id = ?`, id)
+		if err != nil {
+			return err
+		}
+		for _, taskID := range taskIDs {
+			if err := j.track("task_tag", taskID, id); err != nil {
+				return err
+			}
+		}
+
 		// Remove tag associations
-		_, err := tx.Exec(`DELETE FROM task_tags WHERE tag_id = ?`, id)
+		_, err = j.Exec(`DELETE FROM task_tags WHERE tag_id = ?`, id)
 		if err != nil {
 			return err
 		}
 
 		// Delete tag
-		_, err = tx.Exec(`DELETE FROM tags WHERE id = ?`, id)
+		_, err = j.Exec(`DELETE FROM tags WHERE id = ?`, id)
 		return err
 	})
 }
@@ -191,32 +214,52 @@ func (db *DB) GetTaskTags(taskID string) ([]model.Tag, error) {
 
 // AddTagToTask adds a tag to a task
 func (db *DB) AddTagToTask(taskID, tagID string) error {
-	_, err := db.Exec(`
-		INSERT OR IGNORE INTO task_tags (task_id, tag_id) VALUES (?, ?)
-	`, taskID, tagID)
-	return err
+	return db.record("Add tag", func(j *journal) error {
+		if err := j.track("task_tag", taskID, tagID); err != nil {
+			return err
+		}
+		_, err := j.Exec(`
+			INSERT OR IGNORE INTO task_tags (task_id, tag_id) VALUES (?, ?)
+		`, taskID, tagID)
+		return err
+	})
 }
 
 // RemoveTagFromTask removes a tag from a task
 func (db *DB) RemoveTagFromTask(taskID, tagID string) error {
-	_, err := db.Exec(`
-		DELETE FROM task_tags WHERE task_id = ? AND tag_id = ?
-	`, taskID, tagID)
-	return err
+	return db.record("Remove tag", func(j *journal) error {
+		if err := j.track("task_tag", taskID, tagID); err != nil {
+			return err
+		}
+		_, err := j.Exec(`
+			DELETE FROM task_tags WHERE task_id = ? AND tag_id = ?
+		`, taskID, tagID)
+		return err
+	})
 }
 
 // SetTaskTags replaces all tags on a task
 func (db *DB) SetTaskTags(taskID string, tagIDs []string) error {
-	return db.Transaction(func(tx *sql.Tx) error {
+	return db.record("Set tags", func(j *journal) error {
+		existing, err := queryStrings(j, `SELECT tag_id FROM task_tags WHERE task_id = ?`, taskID)
+		if err != nil {
+			return err
+		}
+		for _, tagID := range append(existing, tagIDs...) {
+			if err := j.track("task_tag", taskID, tagID); err != nil {
+				return err
+			}
+		}
+
 		// Remove existing tags
-		_, err := tx.Exec(`DELETE FROM task_tags WHERE task_id = ?`, taskID)
+		_, err = j.Exec(`DELETE FROM task_tags WHERE task_id = ?`, taskID)
 		if err != nil {
 			return err
 		}
 
 		// Add new tags
 		for _, tagID := range tagIDs {
-			_, err = tx.Exec(`INSERT INTO task_tags (task_id, tag_id) VALUES (?, ?)`, taskID, tagID)
+			_, err = j.Exec(`INSERT INTO task_tags (task_id, tag_id) VALUES (?, ?)`, taskID, tagID)
 			if err != nil {
 				return err
 			}
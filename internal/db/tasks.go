@@ -2,6 +2,8 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/dori/klonch/internal/model"
@@ -13,7 +15,7 @@ func (db *DB) GetTasks() ([]model.Task, error) {
 	rows, err := db.Query(`
 		SELECT id, title, description, status, priority, urgency, importance,
 		       project_id, parent_id, due_date, start_date, completed_at,
-		       time_estimate, recurrence, position, gcal_event_id,
+		       time_estimate, recurrence, reminders, position, gcal_event_id, state_id,
 		       created_at, updated_at
 		FROM tasks
 		WHERE status != 'archived' AND parent_id IS NULL
@@ -41,7 +43,7 @@ func (db *DB) GetTasksByProject(projectID string) ([]model.Task, error) {
 	rows, err := db.Query(`
 		SELECT id, title, description, status, priority, urgency, importance,
 		       project_id, parent_id, due_date, start_date, completed_at,
-		       time_estimate, recurrence, position, gcal_event_id,
+		       time_estimate, recurrence, reminders, position, gcal_event_id, state_id,
 		       created_at, updated_at
 		FROM tasks
 		WHERE status != 'archived' AND parent_id IS NULL AND project_id = ?
@@ -63,7 +65,7 @@ func (db *DB) GetSubtasks(parentID string) ([]model.Task, error) {
 	rows, err := db.Query(`
 		SELECT id, title, description, status, priority, urgency, importance,
 		       project_id, parent_id, due_date, start_date, completed_at,
-		       time_estimate, recurrence, position, gcal_event_id,
+		       time_estimate, recurrence, reminders, position, gcal_event_id, state_id,
 		       created_at, updated_at
 		FROM tasks
 		WHERE parent_id = ?
@@ -86,12 +88,113 @@ func (db *DB) GetSubtasks(parentID string) ([]model.Task, error) {
 	return db.scanTasks(rows)
 }
 
+// TaskFilter narrows ListTasks. Zero values match everything.
+type TaskFilter struct {
+	ProjectID    string
+	TagID        string
+	Statuses     []model.Status // Empty means everything but archived
+	TopLevel     bool           // Skip subtasks
+	Query        *Query         // Only tasks the query matches
+	HideDeferred bool           // Skip tasks whose start date is still ahead
+}
+
+// NotDeferred is an SQL condition that holds for tasks without a start date
+// or whose start date has arrived. prefix qualifies the column, e.g. "t.".
+func NotDeferred(prefix string) string {
+	return "(" + prefix + "start_date IS NULL OR julianday(" + prefix + "start_date) <= julianday('now'))"
+}
+
+// ListTasks returns tasks matching a filter, subtasks included unless TopLevel is set
+func (db *DB) ListTasks(f TaskFilter) ([]model.Task, error) {
+	query := `
+		SELECT id, title, description, status, priority, urgency, importance,
+		       project_id, parent_id, due_date, start_date, completed_at,
+		       time_estimate, recurrence, reminders, position, gcal_event_id, state_id,
+		       created_at, updated_at
+		FROM tasks WHERE 1 = 1`
+	var args []interface{}
+
+	if len(f.Statuses) == 0 {
+		query += ` AND status != 'archived'`
+	} else {
+		query += ` AND status IN (?` + strings.Repeat(`, ?`, len(f.Statuses)-1) + `)`
+		for _, s := range f.Statuses {
+			args = append(args, s)
+		}
+	}
+	if f.ProjectID != "" {
+		query += ` AND project_id = ?`
+		args = append(args, f.ProjectID)
+	}
+	if f.TagID != "" {
+		query += ` AND id IN (SELECT task_id FROM task_tags WHERE tag_id = ?)`
+		args = append(args, f.TagID)
+	}
+	if f.TopLevel {
+		query += ` AND parent_id IS NULL`
+	}
+	if f.HideDeferred {
+		query += ` AND ` + NotDeferred("")
+	}
+	if f.Query != nil {
+		cond, condArgs := f.Query.Condition("id")
+		query += ` AND ` + cond
+		args = append(args, condArgs...)
+	}
+	query += `
+		ORDER BY
+			CASE status WHEN 'done' THEN 1 ELSE 0 END,
+			CASE priority
+				WHEN 'urgent' THEN 0
+				WHEN 'high' THEN 1
+				WHEN 'medium' THEN 2
+				WHEN 'low' THEN 3
+			END,
+			position,
+			created_at DESC`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return db.scanTasks(rows)
+}
+
+// ResolveTaskID expands a unique ID prefix to the full task ID
+func (db *DB) ResolveTaskID(prefix string) (string, error) {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	if prefix == "" {
+		return "", fmt.Errorf("empty task id")
+	}
+
+	ids, err := queryStrings(db.DB, `
+		SELECT id FROM tasks WHERE substr(id, 1, ?) = ? LIMIT 2
+	`, len(prefix), prefix)
+	if err != nil {
+		return "", err
+	}
+	switch len(ids) {
+	case 0:
+		return "", fmt.Errorf("no task matches %q", prefix)
+	case 1:
+		return ids[0], nil
+	default:
+		return "", fmt.Errorf("task id %q is ambiguous, use more characters", prefix)
+	}
+}
+
 // GetTask returns a single task by ID
 func (db *DB) GetTask(id string) (*model.Task, error) {
-	row := db.QueryRow(`
+	return db.getTask(db.DB, id)
+}
+
+func (db *DB) getTask(q querier, id string) (*model.Task, error) {
+	row := q.QueryRow(`
 		SELECT id, title, description, status, priority, urgency, importance,
 		       project_id, parent_id, due_date, start_date, completed_at,
-		       time_estimate, recurrence, position, gcal_event_id,
+		       time_estimate, recurrence, reminders, position, gcal_event_id, state_id,
 		       created_at, updated_at
 		FROM tasks WHERE id = ?
 	`, id)
@@ -105,89 +208,123 @@ func (db *DB) GetTask(id string) (*model.Task, error) {
 
 // CreateTask creates a new task
 func (db *DB) CreateTask(title string, projectID *string) (*model.Task, error) {
-	id := uuid.New().String()
-	now := time.Now()
-
 	// Use inbox as default project
 	if projectID == nil {
 		inbox := "inbox"
 		projectID = &inbox
 	}
 
-	_, err := db.Exec(`
-		INSERT INTO tasks (id, title, status, priority, project_id, created_at, updated_at)
-		VALUES (?, ?, 'pending', 'medium', ?, ?, ?)
-	`, id, title, *projectID, now, now)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &model.Task{
-		ID:        id,
+	t := &model.Task{
 		Title:     title,
-		Status:    model.StatusPending,
-		Priority:  model.PriorityMedium,
 		ProjectID: projectID,
-		CreatedAt: now,
-		UpdatedAt: now,
-	}, nil
+	}
+	if err := db.AddTask(t, nil); err != nil {
+		return nil, err
+	}
+	return t, nil
 }
 
 // CreateSubtask creates a subtask under a parent task
 func (db *DB) CreateSubtask(title, parentID string) (*model.Task, error) {
-	id := uuid.New().String()
-	now := time.Now()
-
 	// Get parent's project
 	var projectID *string
 	db.QueryRow("SELECT project_id FROM tasks WHERE id = ?", parentID).Scan(&projectID)
 
-	_, err := db.Exec(`
-		INSERT INTO tasks (id, title, status, priority, project_id, parent_id, created_at, updated_at)
-		VALUES (?, ?, 'pending', 'medium', ?, ?, ?, ?)
-	`, id, title, projectID, parentID, now, now)
+	t := &model.Task{
+		Title:     title,
+		ProjectID: projectID,
+		ParentID:  &parentID,
+	}
+	if err := db.AddTask(t, nil); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// AddTask inserts a fully populated task and links it to the given tags.
+// ID, status, priority and timestamps are filled in when empty.
+func (db *DB) AddTask(t *model.Task, tagIDs []string) error {
+	return db.record("Add task", func(j *journal) error {
+		return db.addTask(j, t, tagIDs)
+	})
+}
+
+func (db *DB) addTask(j *journal, t *model.Task, tagIDs []string) error {
+	now := time.Now()
+	if t.ID == "" {
+		t.ID = uuid.New().String()
+	}
+	if t.Status == "" {
+		t.Status = model.StatusPending
+	}
+	if t.Priority == "" {
+		t.Priority = model.PriorityMedium
+	}
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = now
+	}
+	t.UpdatedAt = now
 
+	if err := j.track("task", t.ID); err != nil {
+		return err
+	}
+	_, err := j.Exec(`
+		INSERT INTO tasks (id, title, description, status, priority, urgency, importance,
+		                   project_id, parent_id, due_date, start_date, time_estimate,
+		                   recurrence, reminders, position, state_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, t.ID, t.Title, t.Description, t.Status, t.Priority, t.Urgency, t.Importance,
+		t.ProjectID, t.ParentID, timestampOrNil(t.DueDate), timestampOrNil(t.StartDate), t.TimeEstimate,
+		t.Recurrence, t.Reminders, t.Position, t.StateID, Timestamp(t.CreatedAt), Timestamp(t.UpdatedAt))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return &model.Task{
-		ID:        id,
-		Title:     title,
-		Status:    model.StatusPending,
-		Priority:  model.PriorityMedium,
-		ProjectID: projectID,
-		ParentID:  &parentID,
-		CreatedAt: now,
-		UpdatedAt: now,
-	}, nil
+	for _, tagID := range tagIDs {
+		if err := j.track("task_tag", t.ID, tagID); err != nil {
+			return err
+		}
+		if _, err := j.Exec(`INSERT OR IGNORE INTO task_tags (task_id, tag_id) VALUES (?, ?)`, t.ID, tagID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateTask journals a single-row UPDATE of a task
+func (db *DB) updateTask(label, id, set string, args ...interface{}) error {
+	return db.record(label, func(j *journal) error {
+		if err := j.track("task", id); err != nil {
+			return err
+		}
+		args = append(args, Timestamp(time.Now()), id)
+		_, err := j.Exec(`UPDATE tasks SET `+set+`, updated_at = ? WHERE id = ?`, args...)
+		return err
+	})
 }
 
 // UpdateTaskTitle updates a task's title
 func (db *DB) UpdateTaskTitle(id, title string) error {
-	now := time.Now()
-	_, err := db.Exec(`UPDATE tasks SET title = ?, updated_at = ? WHERE id = ?`, title, now, id)
-	return err
+	return db.updateTask("Rename task", id, `title = ?`, title)
+}
+
+// UpdateTaskDescription replaces a task's description; an empty one clears it
+func (db *DB) UpdateTaskDescription(id, description string) error {
+	return db.updateTask("Edit description", id, `description = ?`, nullIfEmpty(description))
 }
 
 // UpdateTaskProject moves a task to a different project
 func (db *DB) UpdateTaskProject(id, projectID string) error {
-	now := time.Now()
-	_, err := db.Exec(`UPDATE tasks SET project_id = ?, updated_at = ? WHERE id = ?`, projectID, now, id)
-	return err
+	return db.updateTask("Move task", id, `project_id = ?`, projectID)
 }
 
 // UpdateTaskPriority updates a task's priority
 func (db *DB) UpdateTaskPriority(id string, priority model.Priority) error {
-	now := time.Now()
-	_, err := db.Exec(`UPDATE tasks SET priority = ?, updated_at = ? WHERE id = ?`, priority, now, id)
-	return err
+	return db.updateTask("Change priority", id, `priority = ?`, priority)
 }
 
 // UpdateTaskEisenhower updates a task's Eisenhower matrix values
 func (db *DB) UpdateTaskEisenhower(id string, urgent, important bool) error {
-	now := time.Now()
 	urgency := 0
 	importance := 0
 	if urgent {
@@ -196,41 +333,125 @@ func (db *DB) UpdateTaskEisenhower(id string, urgent, important bool) error {
 	if important {
 		importance = 1
 	}
-	_, err := db.Exec(`UPDATE tasks SET urgency = ?, importance = ?, updated_at = ? WHERE id = ?`,
-		urgency, importance, now, id)
-	return err
+	return db.updateTask("Move task", id, `urgency = ?, importance = ?`, urgency, importance)
 }
 
-// ToggleTaskStatus toggles a task between pending and done
-func (db *DB) ToggleTaskStatus(id string) error {
-	now := time.Now()
+// SetTaskDueDate sets or clears (nil) a task's due date
+func (db *DB) SetTaskDueDate(id string, due *time.Time) error {
+	return db.updateTask("Set due date", id, `due_date = ?`, timestampOrNil(due))
+}
+
+// SetTaskStartDate defers a task until start, or clears its start date (nil)
+func (db *DB) SetTaskStartDate(id string, start *time.Time) error {
+	label := "Clear start date"
+	if start != nil {
+		label = "Defer task"
+	}
+	return db.updateTask(label, id, `start_date = ?`, timestampOrNil(start))
+}
+
+// SetTaskEstimate sets or clears (nil) a task's time estimate in minutes
+func (db *DB) SetTaskEstimate(id string, minutes *int) error {
+	label := "Clear estimate"
+	if minutes != nil {
+		label = "Set estimate"
+	}
+	return db.updateTask(label, id, `time_estimate = ?`, minutes)
+}
+
+// SetTaskParent makes a task a subtask of parentID, or top-level if parentID is nil
+func (db *DB) SetTaskParent(id string, parentID *string) error {
+	return db.updateTask("Change parent", id, `parent_id = ?`, parentID)
+}
 
+// SetTaskPositions numbers tasks from 1 in the given order, for sorting by
+// manual position. Tasks added later keep position 0 and so come first.
+func (db *DB) SetTaskPositions(ids []string) error {
+	return db.record("Reorder tasks", func(j *journal) error {
+		for i, id := range ids {
+			if err := j.track("task", id); err != nil {
+				return err
+			}
+			if _, err := j.Exec(`UPDATE tasks SET position = ? WHERE id = ?`, i+1, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ToggleTaskStatus toggles a task between pending and done.
+// Completing a recurring task creates its next occurrence.
+func (db *DB) ToggleTaskStatus(id string) error {
 	var status string
 	err := db.QueryRow("SELECT status FROM tasks WHERE id = ?", id).Scan(&status)
 	if err != nil {
 		return err
 	}
 
-	var newStatus string
-	var completedAt interface{}
 	if status == string(model.StatusDone) {
-		newStatus = string(model.StatusPending)
-		completedAt = nil
-	} else {
-		newStatus = string(model.StatusDone)
-		completedAt = now
+		return db.SetTaskStatus(id, model.StatusPending)
+	}
+	return db.SetTaskStatus(id, model.StatusDone)
+}
+
+// SetTaskStatus changes a task's status, keeping completed_at in step.
+// Completing a recurring task creates its next occurrence.
+func (db *DB) SetTaskStatus(id string, status model.Status) error {
+	return db.record(statusLabel(status), func(j *journal) error {
+		return db.setTaskStatus(j, id, status)
+	})
+}
+
+// statusLabel is the undo label for moving a task to a status
+func statusLabel(status model.Status) string {
+	switch status {
+	case model.StatusDone:
+		return "Complete task"
+	case model.StatusPending:
+		return "Reopen task"
+	case model.StatusArchived:
+		return "Archive task"
+	}
+	return "Change status"
+}
+
+func (db *DB) setTaskStatus(j *journal, id string, status model.Status) error {
+	if err := j.track("task", id); err != nil {
+		return err
 	}
 
-	_, err = db.Exec(`UPDATE tasks SET status = ?, completed_at = ?, updated_at = ? WHERE id = ?`,
-		newStatus, completedAt, now, id)
+	now := Timestamp(time.Now())
+	var err error
+	switch status {
+	case model.StatusDone:
+		_, err = j.Exec(`UPDATE tasks SET status = ?, completed_at = ?, updated_at = ? WHERE id = ?`,
+			status, now, now, id)
+	case model.StatusArchived:
+		_, err = j.Exec(`UPDATE tasks SET status = ?, updated_at = ? WHERE id = ?`, status, now, id)
+	default:
+		_, err = j.Exec(`UPDATE tasks SET status = ?, completed_at = NULL, updated_at = ? WHERE id = ?`, status, now, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	if status == model.StatusDone {
+		_, err = db.spawnNextOccurrence(j, id)
+	}
 	return err
 }
 
 // DeleteTask deletes a task and its subtasks
 func (db *DB) DeleteTask(id string) error {
-	// SQLite cascade will handle subtasks
-	_, err := db.Exec(`DELETE FROM tasks WHERE id = ?`, id)
-	return err
+	return db.record("Delete task", func(j *journal) error {
+		// Track everything the cascade will remove so undo can restore it
+		if err := j.trackTaskTree(id); err != nil {
+			return err
+		}
+		_, err := j.Exec(`DELETE FROM tasks WHERE id = ?`, id)
+		return err
+	})
 }
 
 // Helper functions
@@ -257,7 +478,7 @@ func (db *DB) scanTask(row *sql.Row) (*model.Task, error) {
 
 func (db *DB) scanTaskRow(s scanner) (*model.Task, error) {
 	var t model.Task
-	var description, projectID, parentID, dueDate, startDate, completedAt, recurrence, gcalID *string
+	var description, projectID, parentID, dueDate, startDate, completedAt, recurrence, reminders, gcalID, stateID *string
 	var timeEstimate, position *int
 	var urgency, importance int
 
@@ -265,7 +486,7 @@ func (db *DB) scanTaskRow(s scanner) (*model.Task, error) {
 		&t.ID, &t.Title, &description, &t.Status, &t.Priority,
 		&urgency, &importance, &projectID, &parentID,
 		&dueDate, &startDate, &completedAt, &timeEstimate,
-		&recurrence, &position, &gcalID, &t.CreatedAt, &t.UpdatedAt,
+		&recurrence, &reminders, &position, &gcalID, &stateID, &t.CreatedAt, &t.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -280,26 +501,18 @@ func (db *DB) scanTaskRow(s scanner) (*model.Task, error) {
 	t.ParentID = parentID
 	t.TimeEstimate = timeEstimate
 	t.Recurrence = recurrence
+	t.Reminders = reminders
 	t.GCalEventID = gcalID
+	t.StateID = stateID
 	if position != nil {
 		t.Position = *position
 	}
 
-	if dueDate != nil {
-		if parsed, err := time.Parse(time.RFC3339, *dueDate); err == nil {
-			t.DueDate = &parsed
-		}
-	}
-	if startDate != nil {
-		if parsed, err := time.Parse(time.RFC3339, *startDate); err == nil {
-			t.StartDate = &parsed
-		}
-	}
-	if completedAt != nil {
-		if parsed, err := time.Parse(time.RFC3339, *completedAt); err == nil {
-			t.CompletedAt = &parsed
-		}
-	}
+	t.DueDate = parseTimestampPtr(dueDate)
+	t.StartDate = parseTimestampPtr(startDate)
+	t.CompletedAt = parseTimestampPtr(completedAt)
+	t.CreatedAt = t.CreatedAt.Local()
+	t.UpdatedAt = t.UpdatedAt.Local()
 
 	return &t, nil
 }
@@ -309,7 +522,7 @@ func (db *DB) GetTaskDependencies(taskID string) ([]model.Task, error) {
 	rows, err := db.Query(`
 		SELECT t.id, t.title, t.description, t.status, t.priority, t.urgency, t.importance,
 		       t.project_id, t.parent_id, t.due_date, t.start_date, t.completed_at,
-		       t.time_estimate, t.recurrence, t.position, t.gcal_event_id,
+		       t.time_estimate, t.recurrence, t.reminders, t.position, t.gcal_event_id, t.state_id,
 		       t.created_at, t.updated_at
 		FROM tasks t
 		JOIN task_dependencies td ON t.id = td.depends_on_id
@@ -325,18 +538,28 @@ func (db *DB) GetTaskDependencies(taskID string) ([]model.Task, error) {
 
 // AddTaskDependency adds a dependency
 func (db *DB) AddTaskDependency(taskID, dependsOnID string) error {
-	_, err := db.Exec(`
-		INSERT OR IGNORE INTO task_dependencies (task_id, depends_on_id) VALUES (?, ?)
-	`, taskID, dependsOnID)
-	return err
+	return db.record("Add dependency", func(j *journal) error {
+		if err := j.track("task_dependency", taskID, dependsOnID); err != nil {
+			return err
+		}
+		_, err := j.Exec(`
+			INSERT OR IGNORE INTO task_dependencies (task_id, depends_on_id) VALUES (?, ?)
+		`, taskID, dependsOnID)
+		return err
+	})
 }
 
 // RemoveTaskDependency removes a dependency
 func (db *DB) RemoveTaskDependency(taskID, dependsOnID string) error {
-	_, err := db.Exec(`
-		DELETE FROM task_dependencies WHERE task_id = ? AND depends_on_id = ?
-	`, taskID, dependsOnID)
-	return err
+	return db.record("Remove dependency", func(j *journal) error {
+		if err := j.track("task_dependency", taskID, dependsOnID); err != nil {
+			return err
+		}
+		_, err := j.Exec(`
+			DELETE FROM task_dependencies WHERE task_id = ? AND depends_on_id = ?
+		`, taskID, dependsOnID)
+		return err
+	})
 }
 
 // IsTaskBlocked returns true if any dependencies are not done
@@ -0,0 +1,275 @@
+package db
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+)
+
+// TestListTasksFilters checks project, tag and status filtering, and that
+// subtasks are listed alongside their parents
+func TestListTasksFilters(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	project, _ := db.CreateProject("Work", "")
+	report, _ := db.CreateTask("Report", &project.ID)
+	outline, _ := db.CreateSubtask("Outline", report.ID)
+	milk, _ := db.CreateTask("Milk", nil)
+	tag, _ := db.CreateTag("shop", "")
+	db.AddTagToTask(milk.ID, tag.ID)
+	db.SetTaskStatus(outline.ID, model.StatusDone)
+
+	tests := []struct {
+		name   string
+		filter TaskFilter
+		want   []string
+	}{
+		{"everything", TaskFilter{}, []string{report.ID, milk.ID, outline.ID}},
+		{"project", TaskFilter{ProjectID: project.ID}, []string{report.ID, outline.ID}},
+		{"tag", TaskFilter{TagID: tag.ID}, []string{milk.ID}},
+		{"done", TaskFilter{Statuses: []model.Status{model.StatusDone}}, []string{outline.ID}},
+		{"top level", TaskFilter{TopLevel: true, ProjectID: project.ID}, []string{report.ID}},
+	}
+	for _, tt := range tests {
+		tasks, err := db.ListTasks(tt.filter)
+		if err != nil {
+			t.Fatalf("%s: ListTasks failed: %v", tt.name, err)
+		}
+		got := map[string]bool{}
+		for _, task := range tasks {
+			got[task.ID] = true
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: expected %d tasks, got %d", tt.name, len(tt.want), len(got))
+		}
+		for _, id := range tt.want {
+			if !got[id] {
+				t.Errorf("%s: missing task %s", tt.name, id)
+			}
+		}
+	}
+}
+
+// TestResolveTaskID checks unique, ambiguous and unknown prefixes
+func TestResolveTaskID(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	for _, id := range []string{"abc123", "abd456"} {
+		if err := db.AddTask(&model.Task{ID: id, Title: id}, nil); err != nil {
+			t.Fatalf("Failed to add task: %v", err)
+		}
+	}
+
+	if id, err := db.ResolveTaskID("ABC"); err != nil || id != "abc123" {
+		t.Errorf("Expected abc123, got %q (%v)", id, err)
+	}
+	if _, err := db.ResolveTaskID("ab"); err == nil {
+		t.Error("Expected an error for an ambiguous prefix")
+	}
+	if _, err := db.ResolveTaskID("zz"); err == nil {
+		t.Error("Expected an error for an unknown prefix")
+	}
+}
+
+// TestSortOrders checks multi-key sorting, manual positions and the order
+// saved on a project
+func TestSortOrders(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	project, _ := db.CreateProject("Sprint", "")
+	add := func(title string, priority model.Priority, due *time.Time) *model.Task {
+		task := model.Task{Title: title, Priority: priority, DueDate: due, ProjectID: &project.ID}
+		if err := db.AddTask(&task, nil); err != nil {
+			t.Fatalf("Failed to add %q: %v", title, err)
+		}
+		return &task
+	}
+	soon := time.Now().AddDate(0, 0, 1)
+	later := time.Now().AddDate(0, 0, 5)
+	a := add("Alpha", model.PriorityLow, &later)
+	b := add("Bravo", model.PriorityHigh, nil)
+	c := add("Charlie", model.PriorityHigh, &soon)
+
+	titles := func(order string) string {
+		t.Helper()
+		o, err := model.ParseSortOrder(order)
+		if err != nil {
+			t.Fatalf("ParseSortOrder(%q) failed: %v", order, err)
+		}
+		tasks, err := db.ListTasks(TaskFilter{ProjectID: project.ID})
+		if err != nil {
+			t.Fatalf("ListTasks failed: %v", err)
+		}
+		var names []string
+		for _, task := range model.SortTasks(tasks, o) {
+			names = append(names, task.Title)
+		}
+		return strings.Join(names, " ")
+	}
+
+	tests := []struct{ order, want string }{
+		{"priority, due", "Charlie Bravo Alpha"},
+		{"priority asc, title desc", "Alpha Charlie Bravo"},
+		{"due", "Charlie Alpha Bravo"},
+		{"-due", "Alpha Charlie Bravo"},
+		{"title", "Alpha Bravo Charlie"},
+	}
+	for _, tt := range tests {
+		if got := titles(tt.order); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.order, got, tt.want)
+		}
+	}
+
+	if err := db.SetTaskPositions([]string{b.ID, a.ID, c.ID}); err != nil {
+		t.Fatalf("SetTaskPositions failed: %v", err)
+	}
+	if got := titles("manual"); got != "Bravo Alpha Charlie" {
+		t.Errorf("manual: got %s", got)
+	}
+	db.Undo()
+	if got := titles("manual, title"); got != "Alpha Bravo Charlie" {
+		t.Errorf("Expected undo to restore positions, got %s", got)
+	}
+
+	order, _ := model.ParseSortOrder("due desc,priority")
+	if err := db.SetProjectSortOrder(project.ID, order); err != nil {
+		t.Fatalf("SetProjectSortOrder failed: %v", err)
+	}
+	saved, _ := db.GetProject(project.ID)
+	if saved.SortOrder != "due desc, priority" {
+		t.Errorf("Expected the order to be saved, got %q", saved.SortOrder)
+	}
+
+	for _, bad := range []string{"colour", "due sideways", "desc", "due, due"} {
+		if _, err := model.ParseSortOrder(bad); err == nil {
+			t.Errorf("Expected ParseSortOrder(%q) to fail", bad)
+		}
+	}
+}
+
+// TestDeferredTasks checks that tasks starting in the future are hidden
+// until their start date, and that clearing the date brings them back
+func TestDeferredTasks(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	later, _ := db.CreateTask("Later", nil)
+	started, _ := db.CreateTask("Started", nil)
+	plain, _ := db.CreateTask("Plain", nil)
+	tomorrow := time.Now().AddDate(0, 0, 1)
+	yesterday := time.Now().AddDate(0, 0, -1)
+	if err := db.SetTaskStartDate(later.ID, &tomorrow); err != nil {
+		t.Fatalf("SetTaskStartDate failed: %v", err)
+	}
+	db.SetTaskStartDate(started.ID, &yesterday)
+
+	listed := func() map[string]bool {
+		tasks, err := db.ListTasks(TaskFilter{HideDeferred: true})
+		if err != nil {
+			t.Fatalf("ListTasks failed: %v", err)
+		}
+		ids := map[string]bool{}
+		for _, task := range tasks {
+			ids[task.ID] = true
+		}
+		return ids
+	}
+	ids := listed()
+	if ids[later.ID] || !ids[started.ID] || !ids[plain.ID] {
+		t.Errorf("Expected only the deferred task hidden, got %v", ids)
+	}
+
+	q, err := ParseQuery("is:deferred")
+	if err != nil {
+		t.Fatalf("ParseQuery failed: %v", err)
+	}
+	if !q.Uses("start") {
+		t.Error("Expected is:deferred to count as a start query")
+	}
+	matched, err := db.MatchingTaskIDs(q)
+	if err != nil {
+		t.Fatalf("MatchingTaskIDs failed: %v", err)
+	}
+	if len(matched) != 1 || !matched[later.ID] {
+		t.Errorf("Expected is:deferred to match only %s, got %v", later.ID, matched)
+	}
+
+	if err := db.SetTaskStartDate(later.ID, nil); err != nil {
+		t.Fatalf("Clearing the start date failed: %v", err)
+	}
+	if !listed()[later.ID] {
+		t.Error("Expected the task back once its start date was cleared")
+	}
+	if _, err := db.Undo(); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	if listed()[later.ID] {
+		t.Error("Expected undo to defer the task again")
+	}
+}
+
+// TestEstimateAccuracy checks setting estimates and comparing them with the
+// time tracked on finished tasks
+func TestEstimateAccuracy(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	quick, _ := db.CreateTask("Quick", nil)
+	slow, _ := db.CreateTask("Slow", nil)
+	open, _ := db.CreateTask("Still open", nil)
+	untracked, _ := db.CreateTask("Untracked", nil)
+	thirty, hour := 30, 60
+	for _, id := range []string{quick.ID, open.ID, untracked.ID} {
+		if err := db.SetTaskEstimate(id, &thirty); err != nil {
+			t.Fatalf("SetTaskEstimate failed: %v", err)
+		}
+	}
+	db.SetTaskEstimate(slow.ID, &hour)
+
+	now := time.Now()
+	db.AddTimeEntry(quick.ID, now, 20, "")
+	db.AddTimeEntry(slow.ID, now, 50, "")
+	db.AddTimeEntry(slow.ID, now, 40, "")
+	db.AddTimeEntry(open.ID, now, 45, "")
+	for _, id := range []string{quick.ID, slow.ID, untracked.ID} {
+		db.SetTaskStatus(id, model.StatusDone)
+	}
+
+	got, err := db.GetEstimateAccuracy(now.AddDate(0, 0, -7))
+	if err != nil {
+		t.Fatalf("GetEstimateAccuracy failed: %v", err)
+	}
+	want := EstimateAccuracy{Tasks: 2, Estimated: 90, Actual: 110, Over: 1}
+	if got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	if err := db.SetTaskEstimate(quick.ID, nil); err != nil {
+		t.Fatalf("Clearing the estimate failed: %v", err)
+	}
+	task, _ := db.GetTask(quick.ID)
+	if task.TimeEstimate != nil {
+		t.Errorf("Expected the estimate cleared, got %d", *task.TimeEstimate)
+	}
+}
@@ -0,0 +1,245 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+	"github.com/google/uuid"
+)
+
+// Timers are time entries without an end. Only one runs at a time, across
+// the list, focus mode and the Pomodoro timer, and it lives in the database
+// so it carries on when klonch is restarted.
+
+// timeEntryColumns are the columns scanTimeEntry reads
+const timeEntryColumns = `id, COALESCE(task_id, ''), COALESCE(description, ''), started_at, ended_at,
+	duration, is_pomodoro, paused_at, paused_seconds, created_at`
+
+func scanTimeEntry(s scanner) (*model.TimeEntry, error) {
+	var e model.TimeEntry
+	var endedAt, pausedAt *string
+	err := s.Scan(&e.ID, &e.TaskID, &e.Description, &e.StartedAt, &endedAt,
+		&e.Duration, &e.IsPomodoro, &pausedAt, &e.PausedSeconds, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	e.StartedAt = e.StartedAt.Local()
+	e.CreatedAt = e.CreatedAt.Local()
+	e.EndedAt = parseTimestampPtr(endedAt)
+	e.PausedAt = parseTimestampPtr(pausedAt)
+	return &e, nil
+}
+
+// RunningTimer returns the running time entry, or nil if no timer runs
+func (db *DB) RunningTimer() (*model.TimeEntry, error) {
+	e, err := scanTimeEntry(db.QueryRow(`
+		SELECT ` + timeEntryColumns + ` FROM time_entries
+		WHERE ended_at IS NULL
+		ORDER BY julianday(started_at) DESC LIMIT 1
+	`))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return e, err
+}
+
+// StartTimeEntry opens a running time entry for a task and returns its ID.
+// Any timer already running stops at startedAt. An empty taskID tracks time
+// against no task, as a Pomodoro session started without choosing one does.
+func (db *DB) StartTimeEntry(taskID string, startedAt time.Time, pomodoro bool) (string, error) {
+	id := uuid.New().String()
+	isPomodoro := 0
+	if pomodoro {
+		isPomodoro = 1
+	}
+	var task interface{} = taskID
+	if taskID == "" {
+		task = nil
+	}
+
+	err := db.record("Start timer", func(j *journal) error {
+		if err := stopRunningTimers(j, startedAt); err != nil {
+			return err
+		}
+		if err := j.track("time_entry", id); err != nil {
+			return err
+		}
+		_, err := j.Exec(`
+			INSERT INTO time_entries (id, task_id, started_at, is_pomodoro, created_at)
+			VALUES (?, ?, ?, ?, ?)
+		`, id, task, Timestamp(startedAt), isPomodoro, Timestamp(time.Now()))
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// StopTimer ends a running timer at the given moment, clamped to when it
+// started, and returns the minutes it tracked, leaving out pauses. A paused
+// timer ends when it was paused.
+func (db *DB) StopTimer(id string, at time.Time) (int, error) {
+	var minutes int
+	err := db.record("Stop timer", func(j *journal) error {
+		e, err := scanTimeEntry(j.QueryRow(`SELECT `+timeEntryColumns+` FROM time_entries WHERE id = ?`, id))
+		if err == sql.ErrNoRows || (err == nil && !e.IsRunning()) {
+			return ErrTimerNotRunning
+		}
+		if err != nil {
+			return err
+		}
+		minutes, err = endTimer(j, e, at)
+		return err
+	})
+	return minutes, err
+}
+
+// ErrTimerNotRunning is returned when stopping, pausing or resuming a timer
+// that has already stopped, e.g. from another view or klonch timer stop
+var ErrTimerNotRunning = errors.New("timer is not running")
+
+// stopRunningTimers ends every running timer at the given moment
+func stopRunningTimers(j *journal, at time.Time) error {
+	rows, err := j.Query(`SELECT ` + timeEntryColumns + ` FROM time_entries WHERE ended_at IS NULL`)
+	if err != nil {
+		return err
+	}
+	var running []*model.TimeEntry
+	for rows.Next() {
+		e, err := scanTimeEntry(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		running = append(running, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, e := range running {
+		if _, err := endTimer(j, e, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// endTimer closes a running entry, returning the minutes it tracked
+func endTimer(j *journal, e *model.TimeEntry, at time.Time) (int, error) {
+	if e.PausedAt != nil && at.After(*e.PausedAt) {
+		at = *e.PausedAt
+	}
+	if at.Before(e.StartedAt) {
+		at = e.StartedAt
+	}
+	minutes := int(e.Elapsed(at).Minutes())
+	if err := j.track("time_entry", e.ID); err != nil {
+		return 0, err
+	}
+	_, err := j.Exec(`
+		UPDATE time_entries SET ended_at = ?, duration = ?, paused_at = NULL
+		WHERE id = ?
+	`, Timestamp(at), minutes, e.ID)
+	return minutes, err
+}
+
+// PauseTimer pauses a running timer. Pauses aren't undoable steps of their
+// own; undoing the timer's start or stop covers them.
+func (db *DB) PauseTimer(id string, at time.Time) error {
+	res, err := db.Exec(`
+		UPDATE time_entries SET paused_at = ?
+		WHERE id = ? AND ended_at IS NULL AND paused_at IS NULL
+	`, Timestamp(at), id)
+	return timerUpdated(res, err)
+}
+
+// ResumeTimer resumes a paused timer, adding the pause to its paused time
+func (db *DB) ResumeTimer(id string, at time.Time) error {
+	res, err := db.Exec(`
+		UPDATE time_entries
+		SET paused_seconds = paused_seconds + MAX(0, CAST(ROUND((julianday(?) - julianday(paused_at)) * 86400) AS INTEGER)),
+		    paused_at = NULL
+		WHERE id = ? AND ended_at IS NULL AND paused_at IS NOT NULL
+	`, Timestamp(at), id)
+	return timerUpdated(res, err)
+}
+
+// DiscardTimer deletes a running timer without logging its time
+func (db *DB) DiscardTimer(id string) error {
+	return db.record("Discard timer", func(j *journal) error {
+		if err := j.track("time_entry", id); err != nil {
+			return err
+		}
+		res, err := j.Exec(`DELETE FROM time_entries WHERE id = ? AND ended_at IS NULL`, id)
+		return timerUpdated(res, err)
+	})
+}
+
+// timerUpdated turns an update that matched no running timer into
+// ErrTimerNotRunning
+func timerUpdated(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTimerNotRunning
+	}
+	return nil
+}
+
+// AddTimeEntry records a finished block of manually tracked time ending at
+// endedAt, with an optional description, and returns its ID. An empty
+// taskID logs it against no task.
+func (db *DB) AddTimeEntry(taskID string, endedAt time.Time, duration int, description string) (string, error) {
+	id := uuid.New().String()
+	startedAt := endedAt.Add(-time.Duration(duration) * time.Minute)
+
+	err := db.record("Add time", func(j *journal) error {
+		if err := j.track("time_entry", id); err != nil {
+			return err
+		}
+		_, err := j.Exec(`
+			INSERT INTO time_entries (id, task_id, description, started_at, ended_at, duration, is_pomodoro, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, 0, ?)
+		`, id, nullIfEmpty(taskID), nullIfEmpty(description), Timestamp(startedAt), Timestamp(endedAt), duration,
+			Timestamp(time.Now()))
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// EstimateAccuracy compares estimates with tracked time for finished tasks
+type EstimateAccuracy struct {
+	Tasks     int // Done tasks with both an estimate and tracked time
+	Estimated int // Minutes estimated across those tasks
+	Actual    int // Minutes tracked across those tasks
+	Over      int // Tasks that took longer than estimated
+}
+
+// GetEstimateAccuracy sums estimates against tracked time for tasks
+// completed since the given time
+func (db *DB) GetEstimateAccuracy(since time.Time) (EstimateAccuracy, error) {
+	var a EstimateAccuracy
+	err := db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(estimate), 0), COALESCE(SUM(actual), 0),
+		       COALESCE(SUM(actual > estimate), 0)
+		FROM (
+			SELECT t.time_estimate AS estimate, SUM(te.duration) AS actual
+			FROM tasks t
+			JOIN time_entries te ON te.task_id = t.id
+			WHERE t.status = 'done' AND t.time_estimate IS NOT NULL
+			  AND julianday(t.completed_at) >= julianday(?)
+			GROUP BY t.id
+			HAVING actual > 0
+		)
+	`, Timestamp(since)).Scan(&a.Tasks, &a.Estimated, &a.Actual, &a.Over)
+	return a, err
+}
@@ -0,0 +1,148 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+)
+
+// TestSingleRunningTimer checks that starting a timer stops the one that
+// was running, and that RunningTimer finds it again after reopening
+func TestSingleRunningTimer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	if e, err := db.RunningTimer(); err != nil || e != nil {
+		t.Fatalf("Expected no running timer, got %+v (%v)", e, err)
+	}
+
+	task := &model.Task{Title: "Write report"}
+	if err := db.AddTask(task, nil); err != nil {
+		t.Fatalf("Failed to add task: %v", err)
+	}
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	first, err := db.StartTimeEntry(task.ID, start, false)
+	if err != nil {
+		t.Fatalf("Failed to start timer: %v", err)
+	}
+	second, err := db.StartTimeEntry("", start.Add(40*time.Minute), true)
+	if err != nil {
+		t.Fatalf("Failed to start second timer: %v", err)
+	}
+	db.Close()
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	e, err := db.RunningTimer()
+	if err != nil || e == nil {
+		t.Fatalf("Expected a running timer after reopening, got %v", err)
+	}
+	if e.ID != second || !e.IsPomodoro || e.TaskID != "" {
+		t.Errorf("Expected the pomodoro to be running, got %+v", e)
+	}
+	if !e.StartedAt.Equal(start.Add(40 * time.Minute)) {
+		t.Errorf("StartedAt = %v, want %v", e.StartedAt, start.Add(40*time.Minute))
+	}
+
+	stopped, err := scanTimeEntry(db.QueryRow(`SELECT `+timeEntryColumns+` FROM time_entries WHERE id = ?`, first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stopped.IsRunning() || stopped.TaskID != task.ID {
+		t.Fatalf("Expected the first timer to have stopped, got %+v", stopped)
+	}
+	if d := stopped.CalculatedDuration(); d != 40 {
+		t.Errorf("Expected the first timer to track 40 minutes, got %d", d)
+	}
+}
+
+// TestPauseResumeStopTimer checks that pauses are left out of the time a
+// timer tracks
+func TestPauseResumeStopTimer(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	start := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	id, err := db.StartTimeEntry("", start, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PauseTimer(id, start.Add(30*time.Minute)); err != nil {
+		t.Fatalf("Failed to pause: %v", err)
+	}
+	if err := db.PauseTimer(id, start.Add(31*time.Minute)); err != ErrTimerNotRunning {
+		t.Errorf("Expected pausing twice to fail, got %v", err)
+	}
+
+	e, _ := db.RunningTimer()
+	if e == nil || !e.IsPaused() {
+		t.Fatalf("Expected a paused timer, got %+v", e)
+	}
+	if got := e.Elapsed(start.Add(time.Hour)); got != 30*time.Minute {
+		t.Errorf("Elapsed while paused = %v, want 30m", got)
+	}
+
+	if err := db.ResumeTimer(id, start.Add(50*time.Minute)); err != nil {
+		t.Fatalf("Failed to resume: %v", err)
+	}
+	e, _ = db.RunningTimer()
+	if e.IsPaused() || e.PausedSeconds != 20*60 {
+		t.Errorf("Expected 20 paused minutes after resuming, got %+v", e)
+	}
+
+	minutes, err := db.StopTimer(id, start.Add(70*time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to stop: %v", err)
+	}
+	if minutes != 50 {
+		t.Errorf("Expected 50 tracked minutes, got %d", minutes)
+	}
+	if _, err := db.StopTimer(id, time.Now()); err != ErrTimerNotRunning {
+		t.Errorf("Expected stopping twice to fail, got %v", err)
+	}
+	if e, _ := db.RunningTimer(); e != nil {
+		t.Errorf("Expected no running timer, got %+v", e)
+	}
+}
+
+// TestStopPausedTimer checks that a paused timer stops when it was paused
+// and that stopping before the start tracks nothing
+func TestStopPausedTimer(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	start := time.Now().Add(-3 * time.Hour).Truncate(time.Second)
+	id, _ := db.StartTimeEntry("", start, false)
+	db.PauseTimer(id, start.Add(45*time.Minute))
+	if minutes, err := db.StopTimer(id, time.Now()); err != nil || minutes != 45 {
+		t.Errorf("Expected 45 minutes, got %d (%v)", minutes, err)
+	}
+
+	id, _ = db.StartTimeEntry("", start, false)
+	if minutes, err := db.StopTimer(id, start.Add(-time.Hour)); err != nil || minutes != 0 {
+		t.Errorf("Expected 0 minutes, got %d (%v)", minutes, err)
+	}
+
+	id, _ = db.StartTimeEntry("", start, false)
+	if err := db.DiscardTimer(id); err != nil {
+		t.Fatalf("Failed to discard: %v", err)
+	}
+	if e, _ := db.RunningTimer(); e != nil {
+		t.Errorf("Expected the discarded timer to be gone, got %+v", e)
+	}
+}
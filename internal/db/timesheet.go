@@ -0,0 +1,243 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+	"github.com/google/uuid"
+)
+
+// TimesheetEntry is a time entry with the task and project it is logged
+// against
+type TimesheetEntry struct {
+	model.TimeEntry
+	TaskTitle   string
+	ProjectID   string
+	ProjectName string
+}
+
+// GetTimesheet returns the entries that started in [from, to), oldest first
+func (db *DB) GetTimesheet(from, to time.Time) ([]TimesheetEntry, error) {
+	rows, err := db.Query(`
+		SELECT te.id, COALESCE(te.task_id, ''), COALESCE(te.description, ''), te.started_at, te.ended_at,
+		       te.duration, te.is_pomodoro, te.paused_at, te.paused_seconds, te.created_at,
+		       COALESCE(t.title, ''), COALESCE(p.id, ''), COALESCE(p.name, '')
+		FROM time_entries te
+		LEFT JOIN tasks t ON t.id = te.task_id
+		LEFT JOIN projects p ON p.id = t.project_id
+		WHERE `+InRange("te.started_at")+`
+		ORDER BY julianday(te.started_at), te.created_at
+	`, Timestamp(from), Timestamp(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []TimesheetEntry
+	for rows.Next() {
+		var e TimesheetEntry
+		var endedAt, pausedAt *string
+		err := rows.Scan(&e.ID, &e.TaskID, &e.Description, &e.StartedAt, &endedAt,
+			&e.Duration, &e.IsPomodoro, &pausedAt, &e.PausedSeconds, &e.CreatedAt,
+			&e.TaskTitle, &e.ProjectID, &e.ProjectName)
+		if err != nil {
+			return nil, err
+		}
+		e.StartedAt = e.StartedAt.Local()
+		e.CreatedAt = e.CreatedAt.Local()
+		e.EndedAt = parseTimestampPtr(endedAt)
+		e.PausedAt = parseTimestampPtr(pausedAt)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// ErrEntryRunning is returned when changing the end of a running timer,
+// which only stopping it can set
+var ErrEntryRunning = errors.New("time entry is still running")
+
+// UpdateTimeEntry changes when an entry started and, for a stopped one, when
+// it ended, and its description. A stopped entry's duration becomes the time
+// between its start and end.
+func (db *DB) UpdateTimeEntry(id string, startedAt time.Time, endedAt *time.Time, description string) error {
+	return db.record("Edit time entry", func(j *journal) error {
+		e, err := scanTimeEntry(j.QueryRow(`SELECT `+timeEntryColumns+` FROM time_entries WHERE id = ?`, id))
+		if err != nil {
+			return err
+		}
+		if err := j.track("time_entry", id); err != nil {
+			return err
+		}
+
+		if e.IsRunning() {
+			if endedAt != nil {
+				return ErrEntryRunning
+			}
+			if startedAt.After(time.Now()) {
+				return fmt.Errorf("a running timer can't start in the future")
+			}
+			_, err = j.Exec(`UPDATE time_entries SET started_at = ?, description = ? WHERE id = ?`,
+				Timestamp(startedAt), nullIfEmpty(description), id)
+			return err
+		}
+
+		if endedAt == nil {
+			return fmt.Errorf("a stopped entry needs an end")
+		}
+		if endedAt.Before(startedAt) {
+			return fmt.Errorf("the entry ends before it starts")
+		}
+		_, err = j.Exec(`
+			UPDATE time_entries
+			SET started_at = ?, ended_at = ?, duration = ?, paused_seconds = 0, description = ?
+			WHERE id = ?
+		`, Timestamp(startedAt), Timestamp(*endedAt), int(endedAt.Sub(startedAt).Minutes()),
+			nullIfEmpty(description), id)
+		return err
+	})
+}
+
+// MoveTimeEntry logs an entry against another task, or none for an empty
+// taskID
+func (db *DB) MoveTimeEntry(id, taskID string) error {
+	return db.record("Move time entry", func(j *journal) error {
+		if err := j.track("time_entry", id); err != nil {
+			return err
+		}
+		res, err := j.Exec(`UPDATE time_entries SET task_id = ? WHERE id = ?`, nullIfEmpty(taskID), id)
+		return entryUpdated(res, err)
+	})
+}
+
+// SplitTimeEntry cuts a stopped entry in two at the given moment and returns
+// the ID of the second part, which keeps the task and description. Where in
+// the entry it was paused isn't kept, so the paused time is shared out in
+// proportion to each part's length, and the two durations add up to the
+// entry's.
+func (db *DB) SplitTimeEntry(id string, at time.Time) (string, error) {
+	newID := uuid.New().String()
+	err := db.record("Split time entry", func(j *journal) error {
+		e, err := scanTimeEntry(j.QueryRow(`SELECT `+timeEntryColumns+` FROM time_entries WHERE id = ?`, id))
+		if err != nil {
+			return err
+		}
+		if e.IsRunning() {
+			return ErrEntryRunning
+		}
+		if !at.After(e.StartedAt) || !at.Before(*e.EndedAt) {
+			return fmt.Errorf("split between %s and %s", e.StartedAt.Format("15:04"), e.EndedAt.Format("15:04"))
+		}
+
+		if err := j.track("time_entry", id); err != nil {
+			return err
+		}
+		if err := j.track("time_entry", newID); err != nil {
+			return err
+		}
+		wall := e.EndedAt.Sub(e.StartedAt)
+		firstWall := at.Sub(e.StartedAt)
+		firstPaused := int(int64(e.PausedSeconds) * int64(firstWall) / int64(wall))
+		first := int((firstWall - time.Duration(firstPaused)*time.Second).Minutes())
+		total := e.CalculatedDuration()
+		first = max(min(first, total), 0)
+
+		_, err = j.Exec(`
+			UPDATE time_entries SET ended_at = ?, duration = ?, paused_seconds = ? WHERE id = ?
+		`, Timestamp(at), first, firstPaused, id)
+		if err != nil {
+			return err
+		}
+		_, err = j.Exec(`
+			INSERT INTO time_entries (id, task_id, description, started_at, ended_at, duration, paused_seconds, is_pomodoro, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, newID, nullIfEmpty(e.TaskID), nullIfEmpty(e.Description), Timestamp(at), Timestamp(*e.EndedAt),
+			total-first, e.PausedSeconds-firstPaused, e.IsPomodoro, Timestamp(time.Now()))
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return newID, nil
+}
+
+// DeleteTimeEntry removes an entry
+func (db *DB) DeleteTimeEntry(id string) error {
+	return db.record("Delete time entry", func(j *journal) error {
+		if err := j.track("time_entry", id); err != nil {
+			return err
+		}
+		res, err := j.Exec(`DELETE FROM time_entries WHERE id = ?`, id)
+		return entryUpdated(res, err)
+	})
+}
+
+// entryUpdated turns an update that matched no entry into sql.ErrNoRows
+func entryUpdated(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// Rounding rounds each entry's minutes for billing, as set by the
+// timesheet.round_to and timesheet.rounding settings
+type Rounding struct {
+	To   int    // Minutes to round to; 0 leaves entries as they are
+	Mode string // RoundUp, RoundNearest or RoundDown
+}
+
+// Rounding modes
+const (
+	RoundUp      = "up"
+	RoundNearest = "nearest"
+	RoundDown    = "down"
+)
+
+// Apply rounds a number of minutes
+func (r Rounding) Apply(minutes int) int {
+	if r.To <= 1 || minutes <= 0 {
+		return minutes
+	}
+	switch r.Mode {
+	case RoundUp:
+		return (minutes + r.To - 1) / r.To * r.To
+	case RoundDown:
+		return minutes / r.To * r.To
+	default:
+		return (minutes + r.To/2) / r.To * r.To
+	}
+}
+
+// String describes the rule, e.g. "up to 15m"
+func (r Rounding) String() string {
+	if r.To <= 1 {
+		return "none"
+	}
+	return r.Mode + " to " + model.FormatEstimate(r.To)
+}
+
+// TimesheetRounding reads the rounding settings
+func (db *DB) TimesheetRounding() (Rounding, error) {
+	to, err := db.GetCountSetting(SettingTimesheetRoundTo)
+	if err != nil {
+		return Rounding{}, err
+	}
+	mode, err := db.GetSetting(SettingTimesheetRounding)
+	if err != nil {
+		return Rounding{}, err
+	}
+	return Rounding{To: to, Mode: mode}, nil
+}
@@ -0,0 +1,218 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+)
+
+// TestTimesheetEditing checks listing, editing, moving, splitting and
+// deleting entries
+func TestTimesheetEditing(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	report := &model.Task{Title: "Write report"}
+	review := &model.Task{Title: "Review PR"}
+	for _, task := range []*model.Task{report, review} {
+		if err := db.AddTask(task, nil); err != nil {
+			t.Fatalf("Failed to add task: %v", err)
+		}
+	}
+
+	day := time.Date(2025, 3, 4, 0, 0, 0, 0, time.Local)
+	at := func(hour, min int) time.Time {
+		return day.Add(time.Duration(hour)*time.Hour + time.Duration(min)*time.Minute)
+	}
+
+	id, err := db.AddTimeEntry(report.ID, at(10, 30), 90, "Draft")
+	if err != nil {
+		t.Fatalf("Failed to add time: %v", err)
+	}
+	if _, err := db.AddTimeEntry(review.ID, at(8, 0), 30, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AddTimeEntry(review.ID, day.AddDate(0, 0, 1).Add(9*time.Hour), 30, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := db.GetTimesheet(day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("GetTimesheet: %v", err)
+	}
+	if len(entries) != 2 || entries[0].TaskTitle != "Review PR" || entries[1].ID != id {
+		t.Fatalf("Expected the day's two entries in order, got %+v", entries)
+	}
+	if e := entries[1]; e.Description != "Draft" || !e.StartedAt.Equal(at(9, 0)) || e.ProjectName != "" {
+		t.Errorf("Unexpected entry: %+v", e)
+	}
+
+	end := at(11, 15)
+	if err := db.UpdateTimeEntry(id, at(9, 15), &end, "Final draft"); err != nil {
+		t.Fatalf("UpdateTimeEntry: %v", err)
+	}
+	if err := db.UpdateTimeEntry(id, at(12, 0), &end, ""); err == nil {
+		t.Errorf("Expected an entry ending before it starts to be rejected")
+	}
+
+	newID, err := db.SplitTimeEntry(id, at(10, 0))
+	if err != nil {
+		t.Fatalf("SplitTimeEntry: %v", err)
+	}
+	if _, err := db.SplitTimeEntry(id, at(11, 0)); err == nil {
+		t.Errorf("Expected a split outside the entry to be rejected")
+	}
+	if err := db.MoveTimeEntry(newID, review.ID); err != nil {
+		t.Fatalf("MoveTimeEntry: %v", err)
+	}
+
+	entries, _ = db.GetTimesheet(day, day.AddDate(0, 0, 1))
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries after the split, got %d", len(entries))
+	}
+	first, second := entries[1], entries[2]
+	if first.ID != id || first.CalculatedDuration() != 45 || first.Description != "Final draft" {
+		t.Errorf("Unexpected first part: %+v", first)
+	}
+	if second.ID != newID || second.CalculatedDuration() != 75 || second.TaskID != review.ID ||
+		second.Description != "Final draft" || !second.StartedAt.Equal(at(10, 0)) {
+		t.Errorf("Unexpected second part: %+v", second)
+	}
+
+	if err := db.DeleteTimeEntry(newID); err != nil {
+		t.Fatalf("DeleteTimeEntry: %v", err)
+	}
+	if label, err := db.Undo(); err != nil || label != "Delete time entry" {
+		t.Errorf("Undo = %q, %v", label, err)
+	}
+	if entries, _ = db.GetTimesheet(day, day.AddDate(0, 0, 1)); len(entries) != 3 {
+		t.Errorf("Expected undo to bring the entry back, got %d entries", len(entries))
+	}
+}
+
+// TestSplitPausedEntry checks that splitting an entry shares out its paused
+// time, so the parts add up to what was tracked
+func TestSplitPausedEntry(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	start := time.Date(2025, 3, 4, 9, 0, 0, 0, time.Local)
+	id, _ := db.AddTimeEntry("", start.Add(2*time.Hour), 120, "")
+	db.Exec(`UPDATE time_entries SET duration = 95, paused_seconds = 1500 WHERE id = ?`, id)
+
+	newID, err := db.SplitTimeEntry(id, start.Add(50*time.Minute))
+	if err != nil {
+		t.Fatalf("SplitTimeEntry: %v", err)
+	}
+	entries, _ := db.GetTimesheet(start, start.Add(3*time.Hour))
+	if len(entries) != 2 || entries[0].ID != id || entries[1].ID != newID {
+		t.Fatalf("Expected the two parts in order, got %+v", entries)
+	}
+	first, second := entries[0], entries[1]
+	if first.CalculatedDuration()+second.CalculatedDuration() != 95 {
+		t.Errorf("Expected the parts to add up to 95 minutes, got %d and %d",
+			first.CalculatedDuration(), second.CalculatedDuration())
+	}
+	if first.PausedSeconds != 625 || second.PausedSeconds != 875 {
+		t.Errorf("Expected the pause shared 625/875 seconds, got %d/%d", first.PausedSeconds, second.PausedSeconds)
+	}
+	if first.CalculatedDuration() != 39 {
+		t.Errorf("Expected 39 minutes in the first part, got %d", first.CalculatedDuration())
+	}
+}
+
+// TestTimesheetRunningEntry checks that a running timer keeps running when
+// its start or description is edited
+func TestTimesheetRunningEntry(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	id, _ := db.StartTimeEntry("", start, false)
+	end := time.Now()
+	if err := db.UpdateTimeEntry(id, start, &end, ""); err != ErrEntryRunning {
+		t.Errorf("Expected setting a running timer's end to fail, got %v", err)
+	}
+	if err := db.UpdateTimeEntry(id, start.Add(-time.Hour), nil, "Support call"); err != nil {
+		t.Fatalf("UpdateTimeEntry: %v", err)
+	}
+	e, _ := db.RunningTimer()
+	if e == nil || e.Description != "Support call" || !e.StartedAt.Equal(start.Add(-time.Hour)) {
+		t.Errorf("Unexpected running timer: %+v", e)
+	}
+	if _, err := db.SplitTimeEntry(id, start); err != ErrEntryRunning {
+		t.Errorf("Expected splitting a running timer to fail, got %v", err)
+	}
+}
+
+// TestRoundingAndOverlaps checks billing rounding and overlap detection
+func TestRoundingAndOverlaps(t *testing.T) {
+	for _, tt := range []struct {
+		rule    Rounding
+		minutes int
+		want    int
+	}{
+		{Rounding{To: 0}, 7, 7},
+		{Rounding{To: 15, Mode: RoundUp}, 1, 15},
+		{Rounding{To: 15, Mode: RoundUp}, 15, 15},
+		{Rounding{To: 15, Mode: RoundDown}, 29, 15},
+		{Rounding{To: 15, Mode: RoundNearest}, 22, 15},
+		{Rounding{To: 15, Mode: RoundNearest}, 23, 30},
+		{Rounding{To: 6, Mode: RoundUp}, 0, 0},
+	} {
+		if got := tt.rule.Apply(tt.minutes); got != tt.want {
+			t.Errorf("%v.Apply(%d) = %d, want %d", tt.rule, tt.minutes, got, tt.want)
+		}
+	}
+
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	if r, _ := db.TimesheetRounding(); r.To != 0 || r.Mode != RoundNearest {
+		t.Errorf("Unexpected default rounding: %+v", r)
+	}
+	db.SetSetting(SettingTimesheetRoundTo, "6")
+	db.SetSetting(SettingTimesheetRounding, "up")
+	if r, _ := db.TimesheetRounding(); r.To != 6 || r.Mode != RoundUp {
+		t.Errorf("Rounding settings not applied: %+v", r)
+	}
+	if err := db.SetSetting(SettingTimesheetRounding, "sideways"); err == nil {
+		t.Errorf("Expected an unknown rounding mode to be rejected")
+	}
+
+	base := time.Date(2025, 3, 4, 9, 0, 0, 0, time.Local)
+	entry := func(id string, from, to int) *model.TimeEntry {
+		e := &model.TimeEntry{ID: id, StartedAt: base.Add(time.Duration(from) * time.Minute)}
+		if to >= 0 {
+			end := base.Add(time.Duration(to) * time.Minute)
+			e.EndedAt = &end
+		}
+		return e
+	}
+	overlaps := model.Overlapping([]*model.TimeEntry{
+		entry("a", 0, 60),
+		entry("b", 60, 90), // touches a
+		entry("c", 100, 200),
+		entry("d", 120, 130), // inside c
+		entry("e", 300, -1),  // running
+		entry("f", 310, 320),
+	}, base.Add(6*time.Hour))
+	for id, want := range map[string]bool{"a": false, "b": false, "c": true, "d": true, "e": true, "f": true} {
+		if overlaps[id] != want {
+			t.Errorf("overlaps[%s] = %v, want %v", id, overlaps[id], want)
+		}
+	}
+}
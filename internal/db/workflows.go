@@ -0,0 +1,568 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+	"github.com/google/uuid"
+)
+
+// A project's workflow is the columns of its Kanban board. Until a state is
+// added the project uses the default workflow, which has no rows and keeps
+// tasks in the column for their status. Every journaled change to a task
+// settles its state_id (see settleState), so it always names a state of the
+// task's project that fits its status, or is NULL on the default workflow.
+
+// Ways of grouping Kanban tasks into swimlanes, for the kanban.swimlanes
+// setting
+const (
+	SwimlanesNone     = "none"
+	SwimlanesProject  = "project"
+	SwimlanesPriority = "priority"
+	SwimlanesTag      = "tag"
+	SwimlanesParent   = "parent"
+)
+
+// WIPSettings names the settings holding the WIP limits of the default
+// workflow's columns, by status
+var WIPSettings = map[model.Status]string{
+	model.StatusBacklog:    SettingKanbanWIPBacklog,
+	model.StatusPending:    SettingKanbanWIPTodo,
+	model.StatusInProgress: SettingKanbanWIPInProgress,
+	model.StatusDone:       SettingKanbanWIPDone,
+}
+
+// GetWorkflow returns a project's workflow, or the default one for a
+// project without its own
+func (db *DB) GetWorkflow(projectID string) (model.Workflow, error) {
+	return workflow(db.DB, projectID)
+}
+
+// DefaultWorkflow returns the default workflow with the WIP limits set
+// for its columns
+func (db *DB) DefaultWorkflow() (model.Workflow, error) {
+	return defaultWorkflow(db.DB)
+}
+
+// defaultWorkflow reads the default workflow's WIP limits from settings,
+// which a transaction can't do through GetCountSetting
+func defaultWorkflow(q querier) (model.Workflow, error) {
+	w := model.DefaultWorkflow()
+	for i, state := range w {
+		var value sql.NullString
+		err := q.QueryRow(`SELECT value FROM settings WHERE key = ?`, WIPSettings[state.Status]).Scan(&value)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		w[i].WIPLimit, _ = parseCount(value.String)
+	}
+	return w, nil
+}
+
+// workflow loads a project's workflow; no project means the inbox
+func workflow(q querier, projectID string) (model.Workflow, error) {
+	if projectID == "" {
+		projectID = "inbox"
+	}
+	rows, err := q.Query(`
+		SELECT id, project_id, name, category, position, wip_limit FROM workflow_states
+		WHERE project_id = ? ORDER BY position, created_at
+	`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	w, err := scanStates(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(w) == 0 {
+		return defaultWorkflow(q)
+	}
+	return w, nil
+}
+
+// GetWorkflows returns the workflows of projects that have their own, by
+// project ID
+func (db *DB) GetWorkflows() (map[string]model.Workflow, error) {
+	rows, err := db.Query(`
+		SELECT id, project_id, name, category, position, wip_limit FROM workflow_states
+		ORDER BY project_id, position, created_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states, err := scanStates(rows)
+	if err != nil {
+		return nil, err
+	}
+	workflows := make(map[string]model.Workflow)
+	for _, s := range states {
+		workflows[s.ProjectID] = append(workflows[s.ProjectID], s)
+	}
+	return workflows, nil
+}
+
+func scanStates(rows *sql.Rows) (model.Workflow, error) {
+	var w model.Workflow
+	for rows.Next() {
+		var s model.WorkflowState
+		if err := rows.Scan(&s.ID, &s.ProjectID, &s.Name, &s.Category, &s.Position, &s.WIPLimit); err != nil {
+			return nil, err
+		}
+		s.Status = s.Category.Status()
+		w = append(w, s)
+	}
+	return w, rows.Err()
+}
+
+// GetWorkflowState returns a state of a project's own workflow by ID
+func (db *DB) GetWorkflowState(id string) (*model.WorkflowState, error) {
+	rows, err := db.Query(`
+		SELECT id, project_id, name, category, position, wip_limit FROM workflow_states WHERE id = ?
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	w, err := scanStates(rows)
+	if err != nil || len(w) == 0 {
+		return nil, err
+	}
+	return &w[0], nil
+}
+
+// AddWorkflowState adds a state to a project's workflow at position,
+// counting from 1, or after the last state of its category for 0. A
+// project on the default workflow first gets a copy of it to change.
+func (db *DB) AddWorkflowState(projectID, name string, category model.Category, position int) (*model.WorkflowState, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("state name can't be empty")
+	}
+
+	state := model.WorkflowState{
+		ID:        uuid.New().String(),
+		ProjectID: projectID,
+		Name:      name,
+		Category:  category,
+		Status:    category.Status(),
+	}
+	err := db.record("Add workflow state", func(j *journal) error {
+		w, err := j.ownWorkflow(projectID)
+		if err != nil {
+			return err
+		}
+		if w.Find(name) >= 0 {
+			return fmt.Errorf("the workflow already has a state named %q", name)
+		}
+
+		at := len(w)
+		if position > 0 && position-1 < len(w) {
+			at = position - 1
+		} else if position <= 0 {
+			for i, s := range w {
+				if s.Category == category {
+					at = i + 1
+				}
+			}
+		}
+
+		if err := j.track("workflow_state", state.ID); err != nil {
+			return err
+		}
+		if _, err := j.Exec(`
+			INSERT INTO workflow_states (id, project_id, name, category, position, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, state.ID, projectID, name, category, at, Timestamp(time.Now())); err != nil {
+			return err
+		}
+		state.Position = at
+
+		w = append(w[:at], append(model.Workflow{state}, w[at:]...)...)
+		return j.renumberStates(w)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// CustomizeWorkflow gives a project on the default workflow a copy of it
+// to change; its tasks stay in the same columns
+func (db *DB) CustomizeWorkflow(projectID string) error {
+	return db.record("Customize workflow", func(j *journal) error {
+		_, err := j.ownWorkflow(projectID)
+		return err
+	})
+}
+
+// RenameWorkflowState renames a state. Status transitions keep the name
+// the state had at the time.
+func (db *DB) RenameWorkflowState(id, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("state name can't be empty")
+	}
+	return db.record("Rename workflow state", func(j *journal) error {
+		state, w, err := j.stateWorkflow(id)
+		if err != nil {
+			return err
+		}
+		if i := w.Find(name); i >= 0 && w[i].ID != id {
+			return fmt.Errorf("the workflow already has a state named %q", name)
+		}
+		if err := j.track("workflow_state", state.ID); err != nil {
+			return err
+		}
+		_, err = j.Exec(`UPDATE workflow_states SET name = ? WHERE id = ?`, name, id)
+		return err
+	})
+}
+
+// SetWorkflowStateLimit sets the most tasks a state's column should hold,
+// 0 for no limit
+func (db *DB) SetWorkflowStateLimit(id string, limit int) error {
+	if limit < 0 {
+		return fmt.Errorf("a WIP limit can't be negative")
+	}
+	return db.record("Set WIP limit", func(j *journal) error {
+		state, _, err := j.stateWorkflow(id)
+		if err != nil {
+			return err
+		}
+		if err := j.track("workflow_state", state.ID); err != nil {
+			return err
+		}
+		_, err = j.Exec(`UPDATE workflow_states SET wip_limit = ? WHERE id = ?`, limit, id)
+		return err
+	})
+}
+
+// WIPLimitError refuses a move into a column at its WIP limit
+type WIPLimitError struct {
+	State string
+	Limit int
+}
+
+func (e *WIPLimitError) Error() string {
+	return fmt.Sprintf("%s is at its WIP limit of %d", e.State, e.Limit)
+}
+
+// CheckWIPLimit returns a *WIPLimitError if kanban.wip_block is on and
+// moving a task into a state would take its column past the WIP limit.
+// The column is the one on the board of projectID, or on the board of
+// every project for "". Subtasks don't count towards limits.
+func (db *DB) CheckWIPLimit(projectID, taskID string, state model.WorkflowState) error {
+	if state.WIPLimit <= 0 {
+		return nil
+	}
+	if block, err := db.GetBoolSetting(SettingKanbanWIPBlock); err != nil || !block {
+		return err
+	}
+	var parentID sql.NullString
+	if err := db.QueryRow(`SELECT parent_id FROM tasks WHERE id = ?`, taskID).Scan(&parentID); err != nil {
+		return err
+	}
+	if parentID.Valid {
+		return nil
+	}
+	count, err := db.WIPCount(projectID, state, taskID)
+	if err != nil {
+		return err
+	}
+	if count >= state.WIPLimit {
+		return &WIPLimitError{State: state.Name, Limit: state.WIPLimit}
+	}
+	return nil
+}
+
+// WIPCount counts the tasks in a state's column towards its WIP limit, as
+// the board of projectID (or of every project, for "") shows them: the
+// started, unarchived top-level tasks, leaving out exceptID
+func (db *DB) WIPCount(projectID string, state model.WorkflowState, exceptID string) (int, error) {
+	w, err := db.DefaultWorkflow()
+	if projectID != "" {
+		w, err = db.GetWorkflow(projectID)
+	}
+	if err != nil {
+		return 0, err
+	}
+	col := w.Index(state.ID)
+	if state.ID == "" {
+		col = w.Find(state.Name)
+	}
+	if col < 0 {
+		return 0, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT state_id, status FROM tasks t
+		WHERE parent_id IS NULL AND status != 'archived' AND id != ? AND `+NotDeferred("t.")+`
+		  AND (? = '' OR project_id = ?)
+	`, exceptID, projectID, projectID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var stateID *string
+		var status model.Status
+		if err := rows.Scan(&stateID, &status); err != nil {
+			return 0, err
+		}
+		if w.StateOf(stateID, status) == col {
+			count++
+		}
+	}
+	return count, rows.Err()
+}
+
+// MoveWorkflowState moves a state to position, counting from 1
+func (db *DB) MoveWorkflowState(id string, position int) error {
+	return db.record("Move workflow state", func(j *journal) error {
+		state, w, err := j.stateWorkflow(id)
+		if err != nil {
+			return err
+		}
+		if position < 1 {
+			position = 1
+		}
+		if position > len(w) {
+			position = len(w)
+		}
+
+		from := w.Index(state.ID)
+		rest := append(append(model.Workflow{}, w[:from]...), w[from+1:]...)
+		moved := append(append(append(model.Workflow{}, rest[:position-1]...), *state), rest[position-1:]...)
+		return j.renumberStates(moved)
+	})
+}
+
+// RemoveWorkflowState removes a state from its workflow. Its tasks move to
+// the first state left of the same category, so each category must keep
+// at least one state.
+func (db *DB) RemoveWorkflowState(id string) error {
+	return db.record("Remove workflow state", func(j *journal) error {
+		state, w, err := j.stateWorkflow(id)
+		if err != nil {
+			return err
+		}
+		others := 0
+		for _, s := range w {
+			if s.Category == state.Category && s.ID != id {
+				others++
+			}
+		}
+		if others == 0 {
+			return fmt.Errorf("%q is the only %s state; a workflow needs an open, an active and a done state", state.Name, state.Category)
+		}
+
+		// Settling the tasks moves them on once the state is gone
+		if err := j.trackProjectTasks(state.ProjectID); err != nil {
+			return err
+		}
+		if err := j.track("workflow_state", id); err != nil {
+			return err
+		}
+		if _, err := j.Exec(`DELETE FROM workflow_states WHERE id = ?`, id); err != nil {
+			return err
+		}
+		return j.renumberStates(append(append(model.Workflow{}, w[:w.Index(id)]...), w[w.Index(id)+1:]...))
+	})
+}
+
+// ResetWorkflow puts a project back on the default workflow, its tasks in
+// the columns for their status
+func (db *DB) ResetWorkflow(projectID string) error {
+	return db.record("Reset workflow", func(j *journal) error {
+		if err := j.trackProjectTasks(projectID); err != nil {
+			return err
+		}
+		ids, err := queryStrings(j, `SELECT id FROM workflow_states WHERE project_id = ?`, projectID)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := j.track("workflow_state", id); err != nil {
+				return err
+			}
+		}
+		_, err = j.Exec(`DELETE FROM workflow_states WHERE project_id = ?`, projectID)
+		return err
+	})
+}
+
+// SetTaskState moves a task to a state of its project's workflow. Moving
+// to a state of another category changes the task's status as
+// SetTaskStatus does; a state of the default workflow only sets the status.
+func (db *DB) SetTaskState(taskID string, state model.WorkflowState) error {
+	if state.ID == "" {
+		return db.SetTaskStatus(taskID, state.Status)
+	}
+
+	return db.record(statusLabel(state.Status), func(j *journal) error {
+		var projectID sql.NullString
+		var status model.Status
+		if err := j.QueryRow(`SELECT project_id, status FROM tasks WHERE id = ?`, taskID).Scan(&projectID, &status); err != nil {
+			return err
+		}
+		w, err := workflow(j, projectID.String)
+		if err != nil {
+			return err
+		}
+		if w.Index(state.ID) < 0 {
+			return fmt.Errorf("%q isn't a state of the task's project", state.Name)
+		}
+
+		if err := j.track("task", taskID); err != nil {
+			return err
+		}
+		if model.StatusCategory(status) != state.Category {
+			if err := db.setTaskStatus(j, taskID, state.Status); err != nil {
+				return err
+			}
+		}
+		_, err = j.Exec(`UPDATE tasks SET state_id = ?, updated_at = ? WHERE id = ?`,
+			state.ID, Timestamp(time.Now()), taskID)
+		return err
+	})
+}
+
+// ownWorkflow returns a project's own workflow, copying the default one
+// for the project to change if it has none yet
+func (j *journal) ownWorkflow(projectID string) (model.Workflow, error) {
+	var exists int
+	if err := j.QueryRow(`SELECT COUNT(*) FROM projects WHERE id = ?`, projectID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, fmt.Errorf("no such project")
+	}
+
+	w, err := workflow(j, projectID)
+	if err != nil || !w.IsDefault() {
+		return w, err
+	}
+
+	// The copy takes over the project's tasks as they settle, and the
+	// default columns' WIP limits
+	if err := j.trackProjectTasks(projectID); err != nil {
+		return nil, err
+	}
+	now := Timestamp(time.Now())
+	for i := range w {
+		w[i].ID = uuid.New().String()
+		w[i].ProjectID = projectID
+		w[i].Status = w[i].Category.Status()
+		if err := j.track("workflow_state", w[i].ID); err != nil {
+			return nil, err
+		}
+		if _, err := j.Exec(`
+			INSERT INTO workflow_states (id, project_id, name, category, position, wip_limit, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, w[i].ID, projectID, w[i].Name, w[i].Category, i, w[i].WIPLimit, now); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// stateWorkflow loads a state and the workflow it belongs to
+func (j *journal) stateWorkflow(id string) (*model.WorkflowState, model.Workflow, error) {
+	var projectID string
+	err := j.QueryRow(`SELECT project_id FROM workflow_states WHERE id = ?`, id).Scan(&projectID)
+	if err == sql.ErrNoRows {
+		return nil, nil, fmt.Errorf("no such workflow state")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	w, err := workflow(j, projectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	state := w[w.Index(id)]
+	return &state, w, nil
+}
+
+// renumberStates stores the states' positions in the given order
+func (j *journal) renumberStates(w model.Workflow) error {
+	for i, s := range w {
+		if s.Position == i {
+			continue
+		}
+		if err := j.track("workflow_state", s.ID); err != nil {
+			return err
+		}
+		if _, err := j.Exec(`UPDATE workflow_states SET position = ? WHERE id = ?`, i, s.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trackProjectTasks tracks every task of a project, so that they settle
+// into its changed workflow
+func (j *journal) trackProjectTasks(projectID string) error {
+	ids, err := queryStrings(j, `SELECT id FROM tasks WHERE COALESCE(project_id, 'inbox') = ?`, projectID)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := j.track("task", id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// settleState keeps a task's state in its project's workflow and in step
+// with its status. It runs on every task a change touched, before the
+// change is journaled.
+func (j *journal) settleState(taskID interface{}) error {
+	var projectID, stateID sql.NullString
+	var status model.Status
+	err := j.QueryRow(`SELECT project_id, status, state_id FROM tasks WHERE id = ?`, taskID).
+		Scan(&projectID, &status, &stateID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	w, err := workflow(j, projectID.String)
+	if err != nil {
+		return err
+	}
+
+	var want sql.NullString
+	if !w.IsDefault() {
+		var current *string
+		if stateID.Valid {
+			current = &stateID.String
+		}
+		if i := w.StateOf(current, status); i >= 0 {
+			want = sql.NullString{String: w[i].ID, Valid: true}
+		} else if current != nil && w.Index(*current) >= 0 {
+			want = stateID // Archived tasks keep their column for when they come back
+		}
+	}
+	if want == stateID {
+		return nil
+	}
+	_, err = j.Exec(`UPDATE tasks SET state_id = ? WHERE id = ?`, want, taskID)
+	return err
+}
@@ -0,0 +1,250 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/dori/klonch/internal/model"
+)
+
+// TestWorkflows checks that a project's own workflow takes over its tasks,
+// that moving tasks between states keeps their status in step and the
+// other way round, and that changes to the workflow undo
+func TestWorkflows(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	work, _ := db.CreateProject("Work", "")
+	task := &model.Task{Title: "Review PR", ProjectID: &work.ID, Status: model.StatusInProgress}
+	if err := db.AddTask(task, nil); err != nil {
+		t.Fatalf("Failed to add task: %v", err)
+	}
+
+	stateOf := func() (string, model.Status) {
+		t.Helper()
+		got, err := db.GetTask(task.ID)
+		if err != nil || got == nil {
+			t.Fatalf("GetTask: %v", err)
+		}
+		w, err := db.GetWorkflow(work.ID)
+		if err != nil {
+			t.Fatalf("GetWorkflow: %v", err)
+		}
+		if w.IsDefault() != (got.StateID == nil) {
+			t.Fatalf("Unexpected state ID %v on workflow %+v", got.StateID, w)
+		}
+		i := w.StateOf(got.StateID, got.Status)
+		if i < 0 {
+			return "", got.Status
+		}
+		return w[i].Name, got.Status
+	}
+
+	// Adding a state copies the default workflow first, keeping tasks in
+	// their columns
+	review, err := db.AddWorkflowState(work.ID, "Review", model.CategoryActive, 0)
+	if err != nil {
+		t.Fatalf("AddWorkflowState: %v", err)
+	}
+	w, _ := db.GetWorkflow(work.ID)
+	var names []string
+	for _, s := range w {
+		names = append(names, s.Name)
+	}
+	if want := "Backlog Todo In Progress Review Done"; fmt.Sprint(names) != "["+want+"]" {
+		t.Errorf("Expected states %s, got %v", want, names)
+	}
+	if name, _ := stateOf(); name != "In Progress" {
+		t.Errorf("Expected the task in In Progress, got %q", name)
+	}
+	if _, err := db.AddWorkflowState(work.ID, "review", model.CategoryDone, 0); err == nil {
+		t.Error("Expected a second state named review to be refused")
+	}
+
+	// States of the same category leave the status alone; others change it
+	if err := db.SetTaskState(task.ID, *review); err != nil {
+		t.Fatalf("SetTaskState: %v", err)
+	}
+	if name, status := stateOf(); name != "Review" || status != model.StatusInProgress {
+		t.Errorf("Expected Review and in progress, got %q and %s", name, status)
+	}
+	if err := db.SetTaskState(task.ID, w[w.Find("Done")]); err != nil {
+		t.Fatalf("SetTaskState: %v", err)
+	}
+	if name, status := stateOf(); name != "Done" || status != model.StatusDone {
+		t.Errorf("Expected Done and done, got %q and %s", name, status)
+	}
+
+	// Reopening puts the task in the last open state, before work starts
+	db.SetTaskStatus(task.ID, model.StatusPending)
+	if name, _ := stateOf(); name != "Todo" {
+		t.Errorf("Expected the reopened task in Todo, got %q", name)
+	}
+
+	// States of other projects are refused
+	home, _ := db.CreateProject("Home", "")
+	other, _ := db.AddWorkflowState(home.ID, "Waiting", model.CategoryOpen, 0)
+	if err := db.SetTaskState(task.ID, *other); err == nil {
+		t.Error("Expected a state of another project to be refused")
+	}
+
+	// Removing a state moves its tasks on, but each category keeps one
+	db.SetTaskState(task.ID, *review)
+	if err := db.RemoveWorkflowState(review.ID); err != nil {
+		t.Fatalf("RemoveWorkflowState: %v", err)
+	}
+	if name, status := stateOf(); name != "In Progress" || status != model.StatusInProgress {
+		t.Errorf("Expected In Progress once Review was removed, got %q and %s", name, status)
+	}
+	w, _ = db.GetWorkflow(work.ID)
+	if err := db.RemoveWorkflowState(w[w.Find("Done")].ID); err == nil {
+		t.Error("Expected removing the only done state to be refused")
+	}
+
+	// Undo brings the state back with the task in it
+	if _, err := db.Undo(); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if name, _ := stateOf(); name != "Review" {
+		t.Errorf("Expected the task back in Review, got %q", name)
+	}
+
+	// The query language matches columns by name
+	q, _ := ParseQuery("state:review")
+	if ids, _ := db.MatchingTaskIDs(q); !ids[task.ID] {
+		t.Error("Expected state:review to match the task")
+	}
+	q, _ = ParseQuery(`state:"in progress"`)
+	if ids, _ := db.MatchingTaskIDs(q); ids[task.ID] {
+		t.Error(`Expected state:"in progress" not to match the task`)
+	}
+
+	// Moving to a project on the default workflow clears the state, and
+	// moving back starts over in the first state for the status
+	db.UpdateTaskProject(task.ID, "inbox")
+	if got, _ := db.GetTask(task.ID); got.StateID != nil || got.Status != model.StatusInProgress {
+		t.Errorf("Expected no state in the inbox, got %v and %s", got.StateID, got.Status)
+	}
+	db.UpdateTaskProject(task.ID, work.ID)
+	if name, _ := stateOf(); name != "In Progress" {
+		t.Errorf("Expected the task in In Progress, got %q", name)
+	}
+
+	// Transitions name the columns entered, undone ones left out
+	states, err := queryStrings(db, `SELECT COALESCE(to_state, '') FROM status_transitions WHERE task_id = ? ORDER BY id`, task.ID)
+	if err != nil {
+		t.Fatalf("Loading transitions: %v", err)
+	}
+	if want := "[In Progress Review Done Todo Review In Progress]"; fmt.Sprint(states) != want {
+		t.Errorf("Expected transitions to %s, got %v", want, states)
+	}
+
+	// Resetting puts the project back on the default workflow
+	if err := db.ResetWorkflow(work.ID); err != nil {
+		t.Fatalf("ResetWorkflow: %v", err)
+	}
+	if name, status := stateOf(); name != "In Progress" || status != model.StatusInProgress {
+		t.Errorf("Expected In Progress after a reset, got %q and %s", name, status)
+	}
+}
+
+// TestWIPLimits checks that the default columns take their WIP limits from
+// settings, that a project's copy keeps them, and that a state's own limit
+// can be set and undone
+func TestWIPLimits(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.SetSetting(SettingKanbanWIPInProgress, "3"); err != nil {
+		t.Fatalf("SetSetting: %v", err)
+	}
+	w, err := db.DefaultWorkflow()
+	if err != nil {
+		t.Fatalf("DefaultWorkflow: %v", err)
+	}
+	if got := w[w.Find("In Progress")].WIPLimit; got != 3 {
+		t.Errorf("Expected a limit of 3 on In Progress, got %d", got)
+	}
+	if got := w[w.Find("Todo")].WIPLimit; got != 0 {
+		t.Errorf("Expected no limit on Todo, got %d", got)
+	}
+
+	work, _ := db.CreateProject("Work", "")
+	review, err := db.AddWorkflowState(work.ID, "Review", model.CategoryActive, 0)
+	if err != nil {
+		t.Fatalf("AddWorkflowState: %v", err)
+	}
+	w, _ = db.GetWorkflow(work.ID)
+	if got := w[w.Find("In Progress")].WIPLimit; got != 3 {
+		t.Errorf("Expected the copy to keep the limit of 3, got %d", got)
+	}
+
+	if err := db.SetWorkflowStateLimit(review.ID, 2); err != nil {
+		t.Fatalf("SetWorkflowStateLimit: %v", err)
+	}
+	if got, _ := db.GetWorkflowState(review.ID); got.WIPLimit != 2 {
+		t.Errorf("Expected a limit of 2 on Review, got %d", got.WIPLimit)
+	}
+	if err := db.SetWorkflowStateLimit(review.ID, -1); err == nil {
+		t.Error("Expected a negative limit to be refused")
+	}
+	db.Undo()
+	if got, _ := db.GetWorkflowState(review.ID); got.WIPLimit != 0 {
+		t.Errorf("Expected undo to clear the limit, got %d", got.WIPLimit)
+	}
+}
+
+// TestCheckWIPLimit checks that with kanban.wip_block on a column at its
+// WIP limit refuses another top-level task, on a project's board and on
+// the board of every project
+func TestCheckWIPLimit(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	work, _ := db.CreateProject("Work", "")
+	review, _ := db.AddWorkflowState(work.ID, "Review", model.CategoryActive, 0)
+	db.SetWorkflowStateLimit(review.ID, 1)
+	review, _ = db.GetWorkflowState(review.ID)
+
+	first, _ := db.CreateTask("First", &work.ID)
+	second, _ := db.CreateTask("Second", &work.ID)
+	sub, _ := db.CreateSubtask("Sub", second.ID)
+	db.SetTaskState(first.ID, *review)
+
+	if err := db.CheckWIPLimit(work.ID, second.ID, *review); err != nil {
+		t.Errorf("Expected no check with wip_block off, got %v", err)
+	}
+	db.SetSetting(SettingKanbanWIPBlock, "on")
+	var wipErr *WIPLimitError
+	if err := db.CheckWIPLimit(work.ID, second.ID, *review); !errors.As(err, &wipErr) || wipErr.Limit != 1 {
+		t.Errorf("Expected Review to be at its limit, got %v", err)
+	}
+	if err := db.CheckWIPLimit(work.ID, first.ID, *review); err != nil {
+		t.Errorf("Expected the task already there not to count, got %v", err)
+	}
+	if err := db.CheckWIPLimit(work.ID, sub.ID, *review); err != nil {
+		t.Errorf("Expected subtasks not to be limited, got %v", err)
+	}
+
+	// On the board of every project, First is In Progress
+	db.SetSetting(SettingKanbanWIPInProgress, "1")
+	w, _ := db.DefaultWorkflow()
+	other, _ := db.CreateTask("Elsewhere", nil)
+	if err := db.CheckWIPLimit("", other.ID, w[w.Find("In Progress")]); !errors.As(err, &wipErr) {
+		t.Errorf("Expected In Progress to be at its limit, got %v", err)
+	}
+	if err := db.CheckWIPLimit("", first.ID, w[w.Find("In Progress")]); err != nil {
+		t.Errorf("Expected First not to count against itself, got %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+// Package idle notices when the user has been away, so a timer left running
+// can ask what to do with the time. The desktop knows best, through GNOME's
+// idle monitor, the freedesktop screen saver or logind; without one, input
+// to klonch itself is all there is to go on.
+package idle
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dori/klonch/internal/bus"
+)
+
+// ErrUnavailable is returned when the desktop can't tell how long it has
+// been idle, e.g. over SSH or on a desktop with none of the interfaces
+var ErrUnavailable = errors.New("idle time unavailable")
+
+// Source tells how long the desktop has gone without input
+type Source interface {
+	Idle() (time.Duration, error)
+}
+
+// Mutter asks GNOME Shell's idle monitor
+type Mutter struct{}
+
+// Idle returns the time since the last input, which Mutter counts in
+// milliseconds
+func (Mutter) Idle() (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), bus.Timeout)
+	defer cancel()
+	conn, err := bus.Session(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	var ms uint64
+	err = conn.Object("org.gnome.Mutter.IdleMonitor", "/org/gnome/Mutter/IdleMonitor/Core").
+		CallWithContext(ctx, "org.gnome.Mutter.IdleMonitor.GetIdletime", 0).Store(&ms)
+	return time.Duration(ms) * time.Millisecond, err
+}
+
+// ScreenSaver asks the freedesktop screen saver, which KDE Plasma provides
+type ScreenSaver struct{}
+
+// Idle returns the session's idle time, which KDE counts in milliseconds
+func (ScreenSaver) Idle() (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), bus.Timeout)
+	defer cancel()
+	conn, err := bus.Session(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	var ms uint32
+	err = conn.Object("org.freedesktop.ScreenSaver", "/org/freedesktop/ScreenSaver").
+		CallWithContext(ctx, "org.freedesktop.ScreenSaver.GetSessionIdleTime", 0).Store(&ms)
+	return time.Duration(ms) * time.Millisecond, err
+}
+
+// Logind reads the session's idle hint from systemd-logind. Desktops set it
+// some minutes after the last input or when the screen locks, and logind
+// works it out itself for text consoles, so it is coarser than the others
+// but reaches further.
+type Logind struct{}
+
+// Idle returns the time since the session went idle, or 0 while it isn't
+func (Logind) Idle() (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), bus.Timeout)
+	defer cancel()
+	conn, err := bus.System(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	const iface = "org.freedesktop.login1.Session"
+	session := conn.Object("org.freedesktop.login1", "/org/freedesktop/login1/session/auto")
+	var idle bool
+	if err := session.StoreProperty(iface+".IdleHint", &idle); err != nil || !idle {
+		return 0, err
+	}
+	var usec uint64
+	if err := session.StoreProperty(iface+".IdleSinceHint", &usec); err != nil || usec == 0 {
+		return 0, err
+	}
+	return max(time.Since(time.UnixMicro(int64(usec))), 0), nil
+}
+
+// Desktop tries each desktop source in turn and sticks with the first that
+// answers. If none does, it gives up and returns ErrUnavailable from then on
+// rather than asking again.
+type Desktop struct {
+	sources []Source
+	found   Source
+	failed  bool
+}
+
+// NewDesktop looks for GNOME's idle monitor, then the freedesktop screen
+// saver, then logind
+func NewDesktop() *Desktop {
+	return &Desktop{sources: []Source{Mutter{}, ScreenSaver{}, Logind{}}}
+}
+
+// Idle returns the desktop's idle time
+func (d *Desktop) Idle() (time.Duration, error) {
+	if d.found != nil {
+		return d.found.Idle()
+	}
+	if d.failed {
+		return 0, ErrUnavailable
+	}
+	for _, source := range d.sources {
+		if idle, err := source.Idle(); err == nil {
+			d.found = source
+			return idle, nil
+		}
+	}
+	d.failed = true
+	return 0, ErrUnavailable
+}
+
+// Away is a stretch of time without input
+type Away struct {
+	From, To time.Time
+}
+
+// Duration returns how long the user was away
+func (a Away) Duration() time.Duration {
+	return a.To.Sub(a.From)
+}
+
+// Watch notices the user coming back after at least After without input.
+// With Desktop set it follows the desktop's idle time, which counts input
+// to other windows; otherwise only input to klonch counts, and the time
+// between two key presses is the time away.
+type Watch struct {
+	After   time.Duration
+	Desktop bool
+
+	lastInput time.Time
+	awaySince time.Time // When the desktop went idle, while it is
+}
+
+// Input records input to klonch at now, returning the time away it ends
+func (w *Watch) Input(now time.Time) (Away, bool) {
+	last := w.lastInput
+	w.lastInput = now
+	if w.Desktop {
+		if w.awaySince.IsZero() {
+			return Away{}, false
+		}
+		away := Away{From: w.awaySince, To: now}
+		w.awaySince = time.Time{}
+		return away, true
+	}
+	if last.IsZero() || w.After <= 0 || now.Sub(last) < w.After {
+		return Away{}, false
+	}
+	return Away{From: last, To: now}, true
+}
+
+// Idle records the desktop's idle time at now, returning the time away it
+// ends once input comes back
+func (w *Watch) Idle(idle time.Duration, now time.Time) (Away, bool) {
+	lastActive := now.Add(-idle)
+	if w.After > 0 && idle >= w.After {
+		if w.awaySince.IsZero() {
+			w.awaySince = lastActive
+		}
+		return Away{}, false
+	}
+	if w.awaySince.IsZero() {
+		return Away{}, false
+	}
+	away := Away{From: w.awaySince, To: lastActive}
+	w.awaySince = time.Time{}
+	return away, away.To.After(away.From)
+}
+
+// Reset forgets any time away, as when a timer starts at now
+func (w *Watch) Reset(now time.Time) {
+	w.lastInput = now
+	w.awaySince = time.Time{}
+}
@@ -0,0 +1,66 @@
+package idle
+
+import (
+	"testing"
+	"time"
+)
+
+// TestWatchInput checks that a long enough gap between key presses counts
+// as time away when klonch has only its own input to go on
+func TestWatchInput(t *testing.T) {
+	start := time.Date(2025, 3, 4, 9, 0, 0, 0, time.Local)
+	w := &Watch{After: 10 * time.Minute}
+	w.Reset(start)
+
+	if _, ok := w.Input(start.Add(9 * time.Minute)); ok {
+		t.Errorf("Expected a 9 minute gap not to count")
+	}
+	away, ok := w.Input(start.Add(30 * time.Minute))
+	if !ok || !away.From.Equal(start.Add(9*time.Minute)) || away.Duration() != 21*time.Minute {
+		t.Errorf("Expected 21 minutes away, got %+v, %v", away, ok)
+	}
+	if _, ok := w.Input(start.Add(31 * time.Minute)); ok {
+		t.Errorf("Expected the time away to be reported once")
+	}
+
+	w.After = 0
+	if _, ok := w.Input(start.Add(5 * time.Hour)); ok {
+		t.Errorf("Expected no time away with the watch off")
+	}
+}
+
+// TestWatchDesktop checks following the desktop's idle time, and that input
+// to klonch ends time away the desktop noticed
+func TestWatchDesktop(t *testing.T) {
+	start := time.Date(2025, 3, 4, 9, 0, 0, 0, time.Local)
+	w := &Watch{After: 10 * time.Minute, Desktop: true}
+	w.Reset(start)
+
+	// Working in another window: klonch sees no input, but the desktop does
+	if _, ok := w.Idle(time.Minute, start.Add(30*time.Minute)); ok {
+		t.Errorf("Expected no time away while the desktop is busy")
+	}
+	if _, ok := w.Input(start.Add(40 * time.Minute)); ok {
+		t.Errorf("Expected a gap in klonch input not to count")
+	}
+
+	for _, idle := range []time.Duration{10, 20, 30} {
+		if _, ok := w.Idle(idle*time.Minute, start.Add(60*time.Minute+idle*time.Minute)); ok {
+			t.Errorf("Expected no time away reported while still idle")
+		}
+	}
+	away, ok := w.Idle(15*time.Second, start.Add(100*time.Minute))
+	want := Away{From: start.Add(60 * time.Minute), To: start.Add(100*time.Minute - 15*time.Second)}
+	if !ok || away != want {
+		t.Errorf("Idle = %+v, %v, want %+v", away, ok, want)
+	}
+
+	w.Idle(12*time.Minute, start.Add(200*time.Minute))
+	away, ok = w.Input(start.Add(201 * time.Minute))
+	if !ok || !away.From.Equal(start.Add(188*time.Minute)) || !away.To.Equal(start.Add(201*time.Minute)) {
+		t.Errorf("Expected input to end the time away, got %+v, %v", away, ok)
+	}
+	if _, ok := w.Idle(0, start.Add(202*time.Minute)); ok {
+		t.Errorf("Expected the time away to be reported once")
+	}
+}
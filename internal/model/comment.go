@@ -0,0 +1,92 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Comment is a timestamped note added to a task
+type Comment struct {
+	ID        string    `json:"id"`
+	TaskID    string    `json:"task_id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ActivityKind is what an activity entry records
+type ActivityKind string
+
+const (
+	ActivityCreated  ActivityKind = "created"
+	ActivityStatus   ActivityKind = "status"
+	ActivityPriority ActivityKind = "priority"
+	ActivityDue      ActivityKind = "due"
+	ActivityProject  ActivityKind = "project"
+	ActivityTime     ActivityKind = "time"  // NewValue is the minutes logged
+	ActivityState    ActivityKind = "state" // Values are columns of the project's own workflow
+)
+
+// Activity is an entry in a task's activity stream, written automatically
+// when the task changes. Values are ready to show: project names rather
+// than IDs, and due dates as written in quick-add.
+type Activity struct {
+	ID        string       `json:"id"`
+	TaskID    string       `json:"task_id"`
+	Kind      ActivityKind `json:"kind"`
+	OldValue  string       `json:"old_value,omitempty"`
+	NewValue  string       `json:"new_value,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// Summary describes the entry in a few words, e.g. "Completed" or
+// "Priority medium → high"
+func (a Activity) Summary() string {
+	from, to := a.OldValue, a.NewValue
+	switch a.Kind {
+	case ActivityCreated:
+		return "Created"
+
+	case ActivityStatus:
+		switch Status(to) {
+		case StatusDone:
+			return "Completed"
+		case StatusArchived:
+			return "Archived"
+		case StatusInProgress:
+			return "Started"
+		}
+		if Status(from) == StatusDone || Status(from) == StatusArchived {
+			return "Reopened"
+		}
+		return "Moved to " + statusName(to)
+
+	case ActivityPriority:
+		return "Priority " + from + " → " + to
+
+	case ActivityDue:
+		switch {
+		case to == "":
+			return "Due date removed"
+		case from == "":
+			return "Due " + to
+		}
+		return "Due " + from + " → " + to
+
+	case ActivityProject:
+		return "Moved from " + from + " to " + to
+
+	case ActivityState:
+		return "Moved to " + to
+
+	case ActivityTime:
+		minutes, _ := strconv.Atoi(to)
+		return "Logged " + FormatEstimate(minutes)
+	}
+	return string(a.Kind)
+}
+
+// statusName writes a status the way people say it
+func statusName(s string) string {
+	return strings.ReplaceAll(s, "_", " ")
+}
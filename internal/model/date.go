@@ -0,0 +1,48 @@
+package model
+
+import (
+	"time"
+)
+
+// Dates are instants. A due date without a time of day is the last second of
+// its day and a start date the first, so "due friday" stays due until Friday
+// is over. Day arithmetic goes through time.Date rather than adding hours,
+// which keeps it right across daylight saving changes.
+
+// StartOfDay returns midnight at the start of t's day
+func StartOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// StartOfWeek returns midnight on the Monday of t's week
+func StartOfWeek(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, t.Location())
+}
+
+// EndOfDay returns the last second of t's day, where all-day due dates sit
+func EndOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 23, 59, 59, 0, t.Location())
+}
+
+// SameDay reports whether b falls on the same calendar day as a, in a's zone
+func SameDay(a, b time.Time) bool {
+	b = b.In(a.Location())
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
+
+// DaysBetween counts calendar days from one date to another, negative when
+// to is earlier. Both are read in from's zone.
+func DaysBetween(from, to time.Time) int {
+	to = to.In(from.Location())
+	a := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	b := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(b.Sub(a).Hours() / 24)
+}
+
+// HasClock reports whether t carries a time of day, rather than being a
+// whole day pinned to its first or last second
+func HasClock(t time.Time) bool {
+	h, m, s := t.Clock()
+	return !(h == 0 && m == 0 && s == 0) && !(h == 23 && m == 59 && s == 59)
+}
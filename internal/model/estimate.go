@@ -0,0 +1,45 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseEstimate reads a length of time such as "45m", "2h", "1h30m" or
+// "1.5h" and returns it in minutes. A bare number is minutes, and a leading
+// "~" (as written in quick-add) is ignored.
+func ParseEstimate(s string) (int, error) {
+	s = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "~")
+	if s == "" {
+		return 0, fmt.Errorf("empty estimate")
+	}
+
+	var minutes int
+	if n, err := strconv.Atoi(s); err == nil {
+		minutes = n
+	} else if d, err := time.ParseDuration(s); err == nil && !strings.ContainsAny(s, "sµnu") {
+		minutes = int(d.Round(time.Minute) / time.Minute)
+	} else {
+		return 0, fmt.Errorf("invalid estimate %q (use e.g. 45m, 2h or 1h30m)", s)
+	}
+	if minutes <= 0 {
+		return 0, fmt.Errorf("estimate must be at least a minute")
+	}
+	return minutes, nil
+}
+
+// FormatEstimate renders minutes the way ParseEstimate reads them: "45m",
+// "2h" or "1h30m"
+func FormatEstimate(minutes int) string {
+	h, m := minutes/60, minutes%60
+	switch {
+	case h == 0:
+		return fmt.Sprintf("%dm", m)
+	case m == 0:
+		return fmt.Sprintf("%dh", h)
+	default:
+		return fmt.Sprintf("%dh%dm", h, m)
+	}
+}
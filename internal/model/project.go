@@ -11,6 +11,7 @@ type Project struct {
 	Color     string    `json:"color,omitempty"`
 	Archived  bool      `json:"archived"`
 	Position  int       `json:"position"`
+	SortOrder string    `json:"sort_order,omitempty"` // Task order in the list, see ParseSortOrder
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
@@ -0,0 +1,485 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is the unit a recurrence rule repeats in
+type Frequency string
+
+const (
+	FrequencyDaily   Frequency = "daily"
+	FrequencyWeekly  Frequency = "weekly"
+	FrequencyMonthly Frequency = "monthly"
+	FrequencyYearly  Frequency = "yearly"
+)
+
+// RecurrenceMode controls what the next occurrence is calculated from
+type RecurrenceMode string
+
+const (
+	// RecurFixed schedules the next occurrence from the previous due date
+	RecurFixed RecurrenceMode = "fixed"
+	// RecurAfterCompletion schedules the next occurrence from when the task was completed
+	RecurAfterCompletion RecurrenceMode = "after_completion"
+)
+
+// LastDayOfMonth is the MonthDay value for "the last day of the month"
+const LastDayOfMonth = -1
+
+// Recurrence is a repeat rule stored as JSON in tasks.recurrence
+type Recurrence struct {
+	Frequency Frequency      `json:"freq"`
+	Interval  int            `json:"interval,omitempty"`  // Every N units (default 1)
+	Weekdays  []time.Weekday `json:"weekdays,omitempty"`  // Weekly: days of the week
+	MonthDay  int            `json:"month_day,omitempty"` // Monthly: 1-31, or LastDayOfMonth
+	Week      int            `json:"week,omitempty"`      // Monthly: nth weekday (1-4, -1 = last)
+	Weekday   time.Weekday   `json:"weekday,omitempty"`   // Monthly: weekday used with Week
+	Mode      RecurrenceMode `json:"mode,omitempty"`
+	Until     *time.Time     `json:"until,omitempty"` // No occurrences after this date
+	Count     int            `json:"count,omitempty"` // Total occurrences (0 = unlimited)
+
+	// Bookkeeping carried between instances
+	Occurrence int    `json:"occurrence,omitempty"` // 1-based index of this instance
+	SpawnedID  string `json:"spawned_id,omitempty"` // Next instance, once generated
+	AnchorDay  int    `json:"anchor_day,omitempty"` // Monthly and yearly: the series' day of the month before short months clamped it
+}
+
+// ParseRecurrence decodes a recurrence rule from its JSON form
+func ParseRecurrence(data string) (*Recurrence, error) {
+	var r Recurrence
+	if err := json.Unmarshal([]byte(data), &r); err != nil {
+		return nil, fmt.Errorf("invalid recurrence: %w", err)
+	}
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Encode returns the JSON form of the rule for storage
+func (r *Recurrence) Encode() (string, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Validate checks that the rule is well formed
+func (r *Recurrence) Validate() error {
+	switch r.Frequency {
+	case FrequencyDaily, FrequencyWeekly, FrequencyMonthly, FrequencyYearly:
+	default:
+		return fmt.Errorf("unknown frequency %q", r.Frequency)
+	}
+	if r.Interval < 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	if r.MonthDay != 0 && r.MonthDay != LastDayOfMonth && (r.MonthDay < 1 || r.MonthDay > 31) {
+		return fmt.Errorf("day of month must be 1-31 or last")
+	}
+	if r.Week != 0 && r.Week != -1 && (r.Week < 1 || r.Week > 4) {
+		return fmt.Errorf("week of month must be 1-4 or last")
+	}
+	if r.Count < 0 {
+		return fmt.Errorf("count must be positive")
+	}
+	switch r.Mode {
+	case "", RecurFixed, RecurAfterCompletion:
+	default:
+		return fmt.Errorf("unknown recurrence mode %q", r.Mode)
+	}
+	return nil
+}
+
+// AfterCompletion returns true if the next occurrence is based on completion time
+func (r *Recurrence) AfterCompletion() bool {
+	return r.Mode == RecurAfterCompletion
+}
+
+func (r *Recurrence) interval() int {
+	if r.Interval < 1 {
+		return 1
+	}
+	return r.Interval
+}
+
+// Next returns the first occurrence strictly after from, keeping from's time of day.
+// ok is false when the rule has run out (count or until reached).
+func (r *Recurrence) Next(from time.Time) (next time.Time, ok bool) {
+	if r.Count > 0 && r.Occurrence >= r.Count {
+		return time.Time{}, false
+	}
+
+	n := r.interval()
+	switch r.Frequency {
+	case FrequencyDaily:
+		next = from.AddDate(0, 0, n)
+	case FrequencyWeekly:
+		next = r.nextWeekly(from, n)
+	case FrequencyMonthly:
+		next = r.nextMonthly(from, n)
+	case FrequencyYearly:
+		next = dateInMonth(from, from.Year()+n, from.Month(), r.anchorDay(from))
+	default:
+		return time.Time{}, false
+	}
+
+	if r.Until != nil {
+		until := time.Date(r.Until.Year(), r.Until.Month(), r.Until.Day(), 23, 59, 59, 0, from.Location())
+		if next.After(until) {
+			return time.Time{}, false
+		}
+	}
+	return next, true
+}
+
+func (r *Recurrence) nextWeekly(from time.Time, n int) time.Time {
+	if len(r.Weekdays) == 0 {
+		return from.AddDate(0, 0, 7*n)
+	}
+
+	days := make(map[time.Weekday]bool, len(r.Weekdays))
+	for _, d := range r.Weekdays {
+		days[d] = true
+	}
+
+	// Weeks start on Monday; only every nth week counted from the anchor is eligible
+	anchor := StartOfWeek(from)
+	for i := 1; i <= 7*n+7; i++ {
+		d := from.AddDate(0, 0, i)
+		weeks := int(StartOfWeek(d).Sub(anchor).Hours()+12) / (24 * 7)
+		if weeks%n == 0 && days[d.Weekday()] {
+			return d
+		}
+	}
+	return from.AddDate(0, 0, 7*n)
+}
+
+func (r *Recurrence) nextMonthly(from time.Time, n int) time.Time {
+	for k := 0; k <= 12*n; k += n {
+		first := time.Date(from.Year(), from.Month()+time.Month(k), 1, 0, 0, 0, 0, from.Location())
+
+		var candidate time.Time
+		switch {
+		case r.Week != 0:
+			candidate = nthWeekday(from, first.Year(), first.Month(), r.Week, r.Weekday)
+		case r.MonthDay == LastDayOfMonth:
+			candidate = dateInMonth(from, first.Year(), first.Month(), 31)
+		case r.MonthDay > 0:
+			candidate = dateInMonth(from, first.Year(), first.Month(), r.MonthDay)
+		default:
+			candidate = dateInMonth(from, first.Year(), first.Month(), r.anchorDay(from))
+		}
+
+		if candidate.After(from) {
+			return candidate
+		}
+	}
+	return from.AddDate(0, n, 0)
+}
+
+// anchorDay is the day of the month a fixed schedule repeats on: the one
+// the series started on, so that Jan 31 goes on to Feb 28 and then Mar 31
+func (r *Recurrence) anchorDay(from time.Time) int {
+	if r.AnchorDay > 0 && !r.AfterCompletion() {
+		return r.AnchorDay
+	}
+	return from.Day()
+}
+
+// dateInMonth builds a date with clock's time of day, clamping day to the month length
+func dateInMonth(clock time.Time, year int, month time.Month, day int) time.Time {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, clock.Location()).Day()
+	if day > last {
+		day = last
+	}
+	return time.Date(year, month, day, clock.Hour(), clock.Minute(), clock.Second(), 0, clock.Location())
+}
+
+// nthWeekday returns the nth (or last, for n = -1) given weekday of a month
+func nthWeekday(clock time.Time, year int, month time.Month, n int, weekday time.Weekday) time.Time {
+	if n < 0 {
+		last := dateInMonth(clock, year, month, 31)
+		back := (int(last.Weekday()) - int(weekday) + 7) % 7
+		return last.AddDate(0, 0, -back)
+	}
+	first := dateInMonth(clock, year, month, 1)
+	ahead := (int(weekday) - int(first.Weekday()) + 7) % 7
+	return first.AddDate(0, 0, ahead+7*(n-1))
+}
+
+// Advance returns a copy of the rule for the next instance in the series,
+// given the date the instance's occurrence was worked out from
+func (r *Recurrence) Advance(from time.Time) *Recurrence {
+	next := *r
+	next.Weekdays = append([]time.Weekday(nil), r.Weekdays...)
+	if next.Occurrence < 1 {
+		next.Occurrence = 1
+	}
+	monthly := r.Frequency == FrequencyMonthly && r.MonthDay == 0 && r.Week == 0
+	if (monthly || r.Frequency == FrequencyYearly) && next.AnchorDay == 0 && !r.AfterCompletion() {
+		next.AnchorDay = from.Day()
+	}
+	next.Occurrence++
+	next.SpawnedID = ""
+	return &next
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+var frequencyUnits = map[string]Frequency{
+	"day": FrequencyDaily, "days": FrequencyDaily,
+	"week": FrequencyWeekly, "weeks": FrequencyWeekly,
+	"month": FrequencyMonthly, "months": FrequencyMonthly,
+	"year": FrequencyYearly, "years": FrequencyYearly,
+}
+
+// ParseRecurrenceSpec parses a human-readable rule such as
+// "every 2 weeks on mon,fri", "monthly on the 2nd tue after completion",
+// "daily until 2025-12-31" or "yearly for 5 times".
+func ParseRecurrenceSpec(spec string) (*Recurrence, error) {
+	tokens := strings.Fields(strings.ToLower(strings.ReplaceAll(spec, ",", " ")))
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty recurrence")
+	}
+
+	r := &Recurrence{Mode: RecurFixed}
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch {
+		case tok == "daily":
+			r.Frequency = FrequencyDaily
+		case tok == "weekly":
+			r.Frequency = FrequencyWeekly
+		case tok == "monthly":
+			r.Frequency = FrequencyMonthly
+		case tok == "yearly" || tok == "annually":
+			r.Frequency = FrequencyYearly
+		case tok == "weekdays":
+			r.Frequency = FrequencyWeekly
+			r.Weekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+		case tok == "every" || tok == "on" || tok == "the" || tok == "and" || tok == "day":
+			// Filler words
+		case frequencyUnits[tok] != "":
+			r.Frequency = frequencyUnits[tok]
+		case tok == "after":
+			if i+1 < len(tokens) && (tokens[i+1] == "completion" || tokens[i+1] == "done") {
+				i++
+			}
+			r.Mode = RecurAfterCompletion
+		case tok == "fixed":
+			r.Mode = RecurFixed
+		case tok == "until":
+			if i+1 >= len(tokens) {
+				return nil, fmt.Errorf("until needs a date (YYYY-MM-DD)")
+			}
+			i++
+			until, err := time.ParseInLocation("2006-01-02", tokens[i], time.Local)
+			if err != nil {
+				return nil, fmt.Errorf("invalid until date %q (use YYYY-MM-DD)", tokens[i])
+			}
+			r.Until = &until
+		case tok == "for" || tok == "x":
+			if i+1 >= len(tokens) {
+				return nil, fmt.Errorf("%s needs a number of times", tok)
+			}
+			i++
+			count, err := strconv.Atoi(tokens[i])
+			if err != nil || count < 1 {
+				return nil, fmt.Errorf("invalid count %q", tokens[i])
+			}
+			r.Count = count
+			if i+1 < len(tokens) && (tokens[i+1] == "times" || tokens[i+1] == "time") {
+				i++
+			}
+		case strings.HasPrefix(tok, "x") && isNumber(tok[1:]):
+			r.Count, _ = strconv.Atoi(tok[1:])
+		case tok == "last":
+			if i+1 < len(tokens) {
+				if wd, ok := weekdayNames[tokens[i+1]]; ok {
+					r.Frequency = FrequencyMonthly
+					r.Week, r.Weekday = -1, wd
+					i++
+					continue
+				}
+			}
+			r.Frequency = FrequencyMonthly
+			r.MonthDay = LastDayOfMonth
+		case isNumber(tok):
+			// "every 3 days" or "for 3 times" handled above; a bare number before a unit is an interval
+			n, _ := strconv.Atoi(tok)
+			if i+1 < len(tokens) && (tokens[i+1] == "times" || tokens[i+1] == "time") {
+				r.Count = n
+				i++
+			} else if i+1 < len(tokens) && frequencyUnits[tokens[i+1]] != "" {
+				r.Interval = n
+			} else {
+				r.Frequency = FrequencyMonthly
+				r.MonthDay = n
+			}
+		case ordinal(tok) != 0:
+			n := ordinal(tok)
+			if i+1 < len(tokens) {
+				if wd, ok := weekdayNames[tokens[i+1]]; ok {
+					r.Frequency = FrequencyMonthly
+					r.Week, r.Weekday = n, wd
+					i++
+					continue
+				}
+			}
+			r.Frequency = FrequencyMonthly
+			r.MonthDay = n
+		default:
+			wd, ok := weekdayNames[tok]
+			if !ok {
+				return nil, fmt.Errorf("unknown recurrence word %q", tok)
+			}
+			if r.Frequency == "" {
+				r.Frequency = FrequencyWeekly
+			}
+			r.Weekdays = appendWeekday(r.Weekdays, wd)
+		}
+	}
+
+	if r.Frequency == "" {
+		return nil, fmt.Errorf("recurrence needs a frequency (daily, weekly, monthly, yearly)")
+	}
+	if r.Frequency != FrequencyWeekly {
+		r.Weekdays = nil
+	}
+	if r.Interval == 1 {
+		r.Interval = 0
+	}
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// ordinal parses "1st", "2nd", "3rd", "15th" and friends
+func ordinal(s string) int {
+	if len(s) < 3 {
+		return 0
+	}
+	switch s[len(s)-2:] {
+	case "st", "nd", "rd", "th":
+		n, err := strconv.Atoi(s[:len(s)-2])
+		if err != nil || n < 1 || n > 31 {
+			return 0
+		}
+		return n
+	}
+	return 0
+}
+
+func appendWeekday(days []time.Weekday, wd time.Weekday) []time.Weekday {
+	for _, d := range days {
+		if d == wd {
+			return days
+		}
+	}
+	return append(days, wd)
+}
+
+func ordinalSuffix(n int) string {
+	if n%100 >= 11 && n%100 <= 13 {
+		return fmt.Sprintf("%dth", n)
+	}
+	switch n % 10 {
+	case 1:
+		return fmt.Sprintf("%dst", n)
+	case 2:
+		return fmt.Sprintf("%dnd", n)
+	case 3:
+		return fmt.Sprintf("%drd", n)
+	}
+	return fmt.Sprintf("%dth", n)
+}
+
+// String returns the rule in the same form accepted by ParseRecurrenceSpec
+func (r *Recurrence) String() string {
+	var parts []string
+
+	n := r.interval()
+	if n == 1 {
+		parts = append(parts, string(r.Frequency))
+	} else {
+		unit := map[Frequency]string{
+			FrequencyDaily: "days", FrequencyWeekly: "weeks",
+			FrequencyMonthly: "months", FrequencyYearly: "years",
+		}[r.Frequency]
+		parts = append(parts, fmt.Sprintf("every %d %s", n, unit))
+	}
+
+	switch r.Frequency {
+	case FrequencyWeekly:
+		if len(r.Weekdays) > 0 {
+			names := make([]string, len(r.Weekdays))
+			for i, d := range r.Weekdays {
+				names[i] = strings.ToLower(d.String()[:3])
+			}
+			parts = append(parts, "on "+strings.Join(names, ","))
+		}
+	case FrequencyMonthly:
+		switch {
+		case r.Week == -1:
+			parts = append(parts, "on the last "+strings.ToLower(r.Weekday.String()[:3]))
+		case r.Week > 0:
+			parts = append(parts, fmt.Sprintf("on the %s %s", ordinalSuffix(r.Week), strings.ToLower(r.Weekday.String()[:3])))
+		case r.MonthDay == LastDayOfMonth:
+			parts = append(parts, "on the last day")
+		case r.MonthDay > 0:
+			parts = append(parts, "on the "+ordinalSuffix(r.MonthDay))
+		}
+	}
+
+	if r.AfterCompletion() {
+		parts = append(parts, "after completion")
+	}
+	if r.Until != nil {
+		parts = append(parts, "until "+r.Until.Format("2006-01-02"))
+	}
+	if r.Count > 0 {
+		parts = append(parts, fmt.Sprintf("for %d times", r.Count))
+	}
+	return strings.Join(parts, " ")
+}
+
+// RecurrenceRule returns the task's parsed recurrence rule, or nil if it doesn't repeat
+func (t *Task) RecurrenceRule() *Recurrence {
+	if t.Recurrence == nil || *t.Recurrence == "" {
+		return nil
+	}
+	r, err := ParseRecurrence(*t.Recurrence)
+	if err != nil {
+		return nil
+	}
+	return r
+}
+
+// IsRecurring returns true if the task has a valid recurrence rule
+func (t *Task) IsRecurring() bool {
+	return t.RecurrenceRule() != nil
+}
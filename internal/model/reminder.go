@@ -0,0 +1,118 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Reminders are offsets before a task's due date, in minutes. An offset of
+// 0 goes off when the task falls due.
+
+// ParseReminders reads offsets such as "1d, 1h", "2h 15m 0" or "1w". "none"
+// turns reminders off and gives an empty list. The result is sorted from
+// the earliest reminder to the latest, without repeats.
+func ParseReminders(s string) ([]int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "none" || s == "off" {
+		return []int{}, nil
+	}
+
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no reminders given (use e.g. 1d,1h or none)")
+	}
+
+	seen := make(map[int]bool)
+	offsets := []int{}
+	for _, field := range fields {
+		minutes, err := parseReminderOffset(field)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[minutes] {
+			seen[minutes] = true
+			offsets = append(offsets, minutes)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(offsets)))
+	return offsets, nil
+}
+
+// parseReminderOffset reads one offset: 0, a number of days or weeks, or
+// anything ParseEstimate accepts, as in "1d12h"
+func parseReminderOffset(s string) (int, error) {
+	if s == "0" || s == "due" {
+		return 0, nil
+	}
+
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i > 0 && i < len(s) && (s[i] == 'd' || s[i] == 'w') {
+		n, _ := strconv.Atoi(s[:i])
+		days := n
+		if s[i] == 'w' {
+			days *= 7
+		}
+		minutes := days * 24 * 60
+		if rest := s[i+1:]; rest != "" {
+			extra, err := ParseEstimate(rest)
+			if err != nil {
+				return 0, fmt.Errorf("invalid reminder %q (use e.g. 1d, 2h, 30m or 0)", s)
+			}
+			minutes += extra
+		}
+		return minutes, nil
+	}
+
+	minutes, err := ParseEstimate(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid reminder %q (use e.g. 1d, 2h, 30m or 0)", s)
+	}
+	return minutes, nil
+}
+
+// FormatReminders renders offsets the way ParseReminders reads them, e.g.
+// "1d,1h,0", or "none" for an empty list
+func FormatReminders(offsets []int) string {
+	if len(offsets) == 0 {
+		return "none"
+	}
+	parts := make([]string, len(offsets))
+	for i, minutes := range offsets {
+		parts[i] = FormatReminderOffset(minutes)
+	}
+	return strings.Join(parts, ",")
+}
+
+// FormatReminderOffset renders a single offset: "0", "1d", "2d3h" or "45m"
+func FormatReminderOffset(minutes int) string {
+	const day = 24 * 60
+	switch {
+	case minutes == 0:
+		return "0"
+	case minutes%(7*day) == 0:
+		return fmt.Sprintf("%dw", minutes/(7*day))
+	case minutes%day == 0:
+		return fmt.Sprintf("%dd", minutes/day)
+	case minutes > day:
+		return fmt.Sprintf("%dd%s", minutes/day, FormatEstimate(minutes%day))
+	}
+	return FormatEstimate(minutes)
+}
+
+// ReminderOffsets returns the task's own reminder offsets, or def if it
+// follows the default
+func (t *Task) ReminderOffsets(def []int) []int {
+	if t.Reminders == nil {
+		return def
+	}
+	offsets, err := ParseReminders(*t.Reminders)
+	if err != nil {
+		return def
+	}
+	return offsets
+}
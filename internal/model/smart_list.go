@@ -0,0 +1,15 @@
+package model
+
+import (
+	"time"
+)
+
+// SmartList is a saved filter query that shows up alongside projects
+type SmartList struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Query     string    `json:"query"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
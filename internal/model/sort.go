@@ -0,0 +1,219 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SortField is something tasks can be ordered by
+type SortField string
+
+const (
+	SortPriority SortField = "priority"
+	SortDue      SortField = "due"
+	SortTitle    SortField = "title"
+	SortStatus   SortField = "status"
+	SortCreated  SortField = "created"
+	SortUpdated  SortField = "updated"
+	SortEstimate SortField = "estimate"
+	SortManual   SortField = "manual" // The position set by moving tasks
+)
+
+// SortFields lists every field in the order help text shows them
+var SortFields = []SortField{
+	SortPriority, SortDue, SortTitle, SortStatus, SortCreated, SortUpdated, SortEstimate, SortManual,
+}
+
+var sortFieldAliases = map[string]SortField{
+	"pri":      SortPriority,
+	"date":     SortDue,
+	"name":     SortTitle,
+	"new":      SortCreated,
+	"modified": SortUpdated,
+	"est":      SortEstimate,
+	"position": SortManual,
+	"pos":      SortManual,
+}
+
+// SortKey is one field of a sort order
+type SortKey struct {
+	Field SortField
+	Desc  bool
+}
+
+// defaultDesc reports which fields read best descending: the most urgent,
+// newest and most recently touched tasks come first
+func defaultDesc(f SortField) bool {
+	return f == SortPriority || f == SortCreated || f == SortUpdated
+}
+
+// SortOrder is a list of keys, each breaking ties left by the one before.
+// An empty order keeps tasks as they were loaded.
+type SortOrder []SortKey
+
+// ParseSortOrder reads an order such as "priority, due desc" or
+// "status,-created". Fields take "asc" or "desc" after a space or colon, or a
+// leading "-" for descending.
+func ParseSortOrder(spec string) (SortOrder, error) {
+	words := strings.FieldsFunc(strings.ToLower(spec), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+
+	var order SortOrder
+	seen := make(map[SortField]bool)
+	for _, word := range words {
+		if word == "asc" || word == "desc" {
+			if len(order) == 0 {
+				return nil, fmt.Errorf("%s needs a field before it", word)
+			}
+			order[len(order)-1].Desc = word == "desc"
+			continue
+		}
+
+		name, dir, hasDir := strings.Cut(word, ":")
+		desc := false
+		if strings.HasPrefix(name, "-") {
+			name, desc, hasDir = name[1:], true, true
+		}
+		field, ok := lookupSortField(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown sort field %q (use %s)", name, joinSortFields())
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("%s appears twice", field)
+		}
+		seen[field] = true
+
+		if !hasDir {
+			desc = defaultDesc(field)
+		} else if dir != "" {
+			switch dir {
+			case "asc":
+				desc = false
+			case "desc":
+				desc = true
+			default:
+				return nil, fmt.Errorf("unknown direction %q (use asc or desc)", dir)
+			}
+		}
+		order = append(order, SortKey{Field: field, Desc: desc})
+	}
+	return order, nil
+}
+
+func lookupSortField(name string) (SortField, bool) {
+	for _, f := range SortFields {
+		if string(f) == name {
+			return f, true
+		}
+	}
+	f, ok := sortFieldAliases[name]
+	return f, ok
+}
+
+func joinSortFields() string {
+	names := make([]string, len(SortFields))
+	for i, f := range SortFields {
+		names[i] = string(f)
+	}
+	return strings.Join(names, ", ")
+}
+
+// String renders the order the way ParseSortOrder reads it, naming a
+// direction only where it differs from the field's default
+func (o SortOrder) String() string {
+	parts := make([]string, len(o))
+	for i, k := range o {
+		parts[i] = string(k.Field)
+		if k.Desc != defaultDesc(k.Field) {
+			if k.Desc {
+				parts[i] += " desc"
+			} else {
+				parts[i] += " asc"
+			}
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// IsManual reports whether the order starts with manual positions, the only
+// order in which moving a task by hand shows up
+func (o SortOrder) IsManual() bool {
+	return len(o) > 0 && o[0].Field == SortManual
+}
+
+var priorityRank = map[Priority]int{PriorityLow: 0, PriorityMedium: 1, PriorityHigh: 2, PriorityUrgent: 3}
+
+var statusRank = map[Status]int{
+	StatusInProgress: 0, StatusPending: 1, StatusBacklog: 2, StatusDone: 3, StatusArchived: 4,
+}
+
+// compare orders two tasks by one key. Tasks without a due date or estimate
+// sort last whichever way the key runs.
+func (k SortKey) compare(a, b *Task) int {
+	var c int
+	switch k.Field {
+	case SortPriority:
+		c = priorityRank[a.Priority] - priorityRank[b.Priority]
+	case SortDue:
+		if a.DueDate == nil || b.DueDate == nil {
+			return nilsLast(a.DueDate == nil, b.DueDate == nil)
+		}
+		c = a.DueDate.Compare(*b.DueDate)
+	case SortTitle:
+		c = strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+	case SortStatus:
+		c = statusRank[a.Status] - statusRank[b.Status]
+	case SortCreated:
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	case SortUpdated:
+		c = a.UpdatedAt.Compare(b.UpdatedAt)
+	case SortEstimate:
+		if a.TimeEstimate == nil || b.TimeEstimate == nil {
+			return nilsLast(a.TimeEstimate == nil, b.TimeEstimate == nil)
+		}
+		c = *a.TimeEstimate - *b.TimeEstimate
+	case SortManual:
+		c = a.Position - b.Position
+	}
+	if k.Desc {
+		return -c
+	}
+	return c
+}
+
+func nilsLast(aNil, bNil bool) int {
+	switch {
+	case aNil == bNil:
+		return 0
+	case aNil:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// SortTasks returns the tasks, and every level of their subtasks, in the
+// given order. Ties keep their loaded order. The input is left untouched.
+func SortTasks(tasks []Task, order SortOrder) []Task {
+	if len(order) == 0 {
+		return tasks
+	}
+	sorted := make([]Task, len(tasks))
+	copy(sorted, tasks)
+	for i := range sorted {
+		if len(sorted[i].Subtasks) > 0 {
+			sorted[i].Subtasks = SortTasks(sorted[i].Subtasks, order)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		for _, k := range order {
+			if c := k.compare(&sorted[i], &sorted[j]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	return sorted
+}
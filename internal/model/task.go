@@ -41,8 +41,10 @@ type Task struct {
 	CompletedAt  *time.Time `json:"completed_at,omitempty"`
 	TimeEstimate *int       `json:"time_estimate,omitempty"` // Minutes
 	Recurrence   *string    `json:"recurrence,omitempty"`    // JSON string
+	Reminders    *string    `json:"reminders,omitempty"`     // Offsets before due, e.g. "1d,1h"; nil follows the default
 	Position     int        `json:"position"`
 	GCalEventID  *string    `json:"gcal_event_id,omitempty"`
+	StateID      *string    `json:"state_id,omitempty"` // Column of the project's own workflow, nil on the default one
 	CreatedAt    time.Time  `json:"created_at"`
 	UpdatedAt    time.Time  `json:"updated_at"`
 
@@ -53,6 +55,17 @@ type Task struct {
 	Project      *Project `json:"project,omitempty"`
 }
 
+// ShortIDLen is how many ID characters the CLI prints
+const ShortIDLen = 8
+
+// ShortID returns the leading characters of the ID, enough to tell tasks apart
+func (t *Task) ShortID() string {
+	if len(t.ID) <= ShortIDLen {
+		return t.ID
+	}
+	return t.ID[:ShortIDLen]
+}
+
 // IsOverdue returns true if the task is past its due date
 func (t *Task) IsOverdue() bool {
 	if t.DueDate == nil || t.Status == StatusDone || t.Status == StatusArchived {
@@ -66,9 +79,7 @@ func (t *Task) IsDueToday() bool {
 	if t.DueDate == nil {
 		return false
 	}
-	now := time.Now()
-	return t.DueDate.Year() == now.Year() &&
-		t.DueDate.YearDay() == now.YearDay()
+	return SameDay(time.Now(), *t.DueDate)
 }
 
 // IsVisible returns true if the task should be shown based on start date
@@ -79,6 +90,14 @@ func (t *Task) IsVisible() bool {
 	return time.Now().After(*t.StartDate) || time.Now().Equal(*t.StartDate)
 }
 
+// StartsToday returns true if the task's start date is today
+func (t *Task) StartsToday() bool {
+	if t.StartDate == nil {
+		return false
+	}
+	return SameDay(time.Now(), *t.StartDate)
+}
+
 // EisenhowerQuadrant returns which quadrant the task belongs to
 // 1: Urgent + Important (Do First)
 // 2: Urgent + Not Important (Delegate)
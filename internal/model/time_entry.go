@@ -1,19 +1,22 @@
 package model
 
 import (
+	"sort"
 	"time"
 )
 
 // TimeEntry represents a time tracking entry (manual or pomodoro)
 type TimeEntry struct {
-	ID          string     `json:"id"`
-	TaskID      string     `json:"task_id"`
-	Description string     `json:"description,omitempty"`
-	StartedAt   time.Time  `json:"started_at"`
-	EndedAt     *time.Time `json:"ended_at,omitempty"`
-	Duration    *int       `json:"duration,omitempty"` // Minutes
-	IsPomodoro  bool       `json:"is_pomodoro"`
-	CreatedAt   time.Time  `json:"created_at"`
+	ID            string     `json:"id"`
+	TaskID        string     `json:"task_id"` // Empty for a pomodoro without a task
+	Description   string     `json:"description,omitempty"`
+	StartedAt     time.Time  `json:"started_at"`
+	EndedAt       *time.Time `json:"ended_at,omitempty"`
+	Duration      *int       `json:"duration,omitempty"` // Minutes
+	IsPomodoro    bool       `json:"is_pomodoro"`
+	PausedAt      *time.Time `json:"paused_at,omitempty"` // Set while a running entry is paused
+	PausedSeconds int        `json:"paused_seconds,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
 }
 
 // CalculatedDuration returns the duration in minutes
@@ -24,12 +27,57 @@ func (te *TimeEntry) CalculatedDuration() int {
 	}
 	if te.EndedAt == nil {
 		// Still running, calculate from now
-		return int(time.Since(te.StartedAt).Minutes())
+		return int(te.Elapsed(time.Now()).Minutes())
 	}
-	return int(te.EndedAt.Sub(te.StartedAt).Minutes())
+	return int(te.Elapsed(*te.EndedAt).Minutes())
+}
+
+// Elapsed returns the time tracked by the given moment, leaving out pauses
+func (te *TimeEntry) Elapsed(at time.Time) time.Duration {
+	if te.PausedAt != nil && at.After(*te.PausedAt) {
+		at = *te.PausedAt
+	}
+	elapsed := at.Sub(te.StartedAt) - time.Duration(te.PausedSeconds)*time.Second
+	if elapsed < 0 {
+		return 0
+	}
+	return elapsed
 }
 
 // IsRunning returns true if this time entry is still active
 func (te *TimeEntry) IsRunning() bool {
 	return te.EndedAt == nil
 }
+
+// IsPaused returns true if this running entry is paused
+func (te *TimeEntry) IsPaused() bool {
+	return te.EndedAt == nil && te.PausedAt != nil
+}
+
+// End returns when the entry ended, or now if it is still running
+func (te *TimeEntry) End(now time.Time) time.Time {
+	if te.EndedAt != nil {
+		return *te.EndedAt
+	}
+	return now
+}
+
+// Overlapping returns the IDs of entries whose time overlaps another's. An
+// entry that ends as the next one starts doesn't overlap it.
+func Overlapping(entries []*TimeEntry, now time.Time) map[string]bool {
+	sorted := append([]*TimeEntry(nil), entries...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].StartedAt.Before(sorted[j].StartedAt) })
+
+	overlaps := make(map[string]bool)
+	for i, a := range sorted {
+		end := a.End(now)
+		for _, b := range sorted[i+1:] {
+			if !b.StartedAt.Before(end) {
+				break
+			}
+			overlaps[a.ID] = true
+			overlaps[b.ID] = true
+		}
+	}
+	return overlaps
+}
@@ -0,0 +1,139 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Category is what a workflow state means to the rest of klonch: work not
+// yet started, under way or finished
+type Category string
+
+const (
+	CategoryOpen   Category = "open"
+	CategoryActive Category = "active"
+	CategoryDone   Category = "done"
+)
+
+// ParseCategory reads a category name
+func ParseCategory(s string) (Category, error) {
+	switch c := Category(strings.ToLower(strings.TrimSpace(s))); c {
+	case CategoryOpen, CategoryActive, CategoryDone:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown category %q (want open, active or done)", s)
+}
+
+// Status is the status tasks get when moved to a state of the category
+func (c Category) Status() Status {
+	switch c {
+	case CategoryActive:
+		return StatusInProgress
+	case CategoryDone:
+		return StatusDone
+	}
+	return StatusPending
+}
+
+// StatusCategory returns the category of a status, or "" for archived
+func StatusCategory(s Status) Category {
+	switch s {
+	case StatusBacklog, StatusPending:
+		return CategoryOpen
+	case StatusInProgress:
+		return CategoryActive
+	case StatusDone:
+		return CategoryDone
+	}
+	return ""
+}
+
+// WorkflowState is a column of a project's Kanban board
+type WorkflowState struct {
+	ID        string   `json:"id,omitempty"` // Empty for the states of the default workflow
+	ProjectID string   `json:"project_id,omitempty"`
+	Name      string   `json:"name"`
+	Category  Category `json:"category"`
+	Status    Status   `json:"status"` // Status of tasks moved here
+	Position  int      `json:"position"`
+	WIPLimit  int      `json:"wip_limit"` // Most tasks the column should hold, 0 for no limit
+}
+
+// Workflow is the states of a board in order
+type Workflow []WorkflowState
+
+// DefaultWorkflow is the board of projects without a workflow of their
+// own, with a state for each status
+func DefaultWorkflow() Workflow {
+	return Workflow{
+		{Name: "Backlog", Category: CategoryOpen, Status: StatusBacklog, Position: 0},
+		{Name: "Todo", Category: CategoryOpen, Status: StatusPending, Position: 1},
+		{Name: "In Progress", Category: CategoryActive, Status: StatusInProgress, Position: 2},
+		{Name: "Done", Category: CategoryDone, Status: StatusDone, Position: 3},
+	}
+}
+
+// DefaultStateName names the default workflow's state for a status, or
+// returns "" for archived
+func DefaultStateName(s Status) string {
+	for _, state := range DefaultWorkflow() {
+		if state.Status == s {
+			return state.Name
+		}
+	}
+	return ""
+}
+
+// IsDefault reports whether this is the default workflow
+func (w Workflow) IsDefault() bool {
+	return len(w) == 0 || w[0].ID == ""
+}
+
+// Index returns the position of the state with the given ID, or -1
+func (w Workflow) Index(id string) int {
+	for i, state := range w {
+		if state.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Find returns the position of the state with the given name, ignoring
+// case, or -1
+func (w Workflow) Find(name string) int {
+	for i, state := range w {
+		if strings.EqualFold(state.Name, strings.TrimSpace(name)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// StateOf returns the position of the state a task is in: the one it was
+// put in while that still fits its status, or else the first state of its
+// status's category. Pending tasks instead go to the last open state, the
+// one before work starts, so that on the default workflow they are in Todo
+// and backlog ones in Backlog. Archived tasks are in no state, -1.
+func (w Workflow) StateOf(stateID *string, status Status) int {
+	category := StatusCategory(status)
+	if category == "" {
+		return -1
+	}
+	if stateID != nil {
+		if i := w.Index(*stateID); i >= 0 && w[i].Category == category {
+			return i
+		}
+	}
+	found := -1
+	for i, state := range w {
+		if state.Category != category {
+			continue
+		}
+		found = i
+		if status != StatusPending {
+			break
+		}
+	}
+	return found
+}
@@ -0,0 +1,42 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// commandTimeout bounds how long a notification command may run
+const commandTimeout = 10 * time.Second
+
+// Command runs a shell command for each notification. The command reads
+// the notification from $KLONCH_TITLE, $KLONCH_BODY and $KLONCH_URGENCY
+// (low, normal or critical), e.g.
+//
+//	tmux display-message "$KLONCH_TITLE: $KLONCH_BODY"
+type Command struct {
+	Command string
+}
+
+// Send runs the command with sh -c
+func (c Command) Send(notification Notification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", c.Command)
+	cmd.Env = append(os.Environ(),
+		"KLONCH_TITLE="+notification.Title,
+		"KLONCH_BODY="+notification.Body,
+		"KLONCH_URGENCY="+notification.Urgency.String(),
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
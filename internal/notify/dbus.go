@@ -0,0 +1,42 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dori/klonch/internal/bus"
+	"github.com/godbus/dbus/v5"
+)
+
+// DBus calls org.freedesktop.Notifications on the session bus itself, so
+// desktop notifications work without notify-send installed
+type DBus struct{}
+
+// Send shows the notification through the desktop's notification server
+func (DBus) Send(notification Notification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), bus.Timeout)
+	defer cancel()
+	conn, err := bus.Session(ctx)
+	if errors.Is(err, bus.ErrNoSession) {
+		return fmt.Errorf("%w: %w", err, ErrUnavailable)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Object("org.freedesktop.Notifications", "/org/freedesktop/Notifications").
+		CallWithContext(ctx, "org.freedesktop.Notifications.Notify", 0, notifyArgs(notification)...).Err
+}
+
+// notifyArgs returns the arguments of Notify: app name, replaced ID, icon,
+// summary, body, actions, hints and timeout
+func notifyArgs(notification Notification) []any {
+	hints := map[string]dbus.Variant{"urgency": dbus.MakeVariant(byte(notification.Urgency))}
+	timeout := int32(-1)
+	if notification.Timeout > 0 {
+		timeout = int32(notification.Timeout.Milliseconds())
+	}
+	return []any{"klonch", uint32(0), notification.Icon, notification.Title, notification.Body, []string{}, hints, timeout}
+}
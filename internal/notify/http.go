@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// httpTimeout bounds a push request
+const httpTimeout = 10 * time.Second
+
+// HTTP pushes notifications to an ntfy topic or a Gotify server, so they
+// reach a phone or any machine subscribed to it
+type HTTP struct {
+	URL    string // ntfy: the topic URL, e.g. https://ntfy.sh/my-tasks; Gotify: the server URL
+	Token  string // ntfy access token or Gotify application token, if needed
+	Gotify bool   // Speak Gotify's API rather than ntfy's
+	Client *http.Client
+}
+
+// Send posts the notification
+func (h *HTTP) Send(notification Notification) error {
+	req, err := h.request(notification)
+	if err != nil {
+		return err
+	}
+
+	client := h.Client
+	if client == nil {
+		client = &http.Client{Timeout: httpTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func (h *HTTP) request(notification Notification) (*http.Request, error) {
+	if h.Gotify {
+		body, err := json.Marshal(map[string]interface{}{
+			"title":    notification.Title,
+			"message":  notification.Body,
+			"priority": gotifyPriority(notification.Urgency),
+		})
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(h.URL, "/")+"/message", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if h.Token != "" {
+			req.Header.Set("X-Gotify-Key", h.Token)
+		}
+		return req, nil
+	}
+
+	// ntfy takes the message as the body and the rest as headers
+	req, err := http.NewRequest(http.MethodPost, h.URL, strings.NewReader(notification.Body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Title", notification.Title)
+	req.Header.Set("Priority", ntfyPriority(notification.Urgency))
+	req.Header.Set("Tags", "klonch")
+	if h.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.Token)
+	}
+	return req, nil
+}
+
+// ntfyPriority maps urgency onto ntfy's 1 (min) to 5 (max) scale
+func ntfyPriority(u Urgency) string {
+	switch u {
+	case UrgencyLow:
+		return "2"
+	case UrgencyCritical:
+		return "5"
+	default:
+		return "3"
+	}
+}
+
+// gotifyPriority maps urgency onto Gotify's 0 to 10 scale
+func gotifyPriority(u Urgency) int {
+	switch u {
+	case UrgencyLow:
+		return 2
+	case UrgencyCritical:
+		return 8
+	default:
+		return 5
+	}
+}
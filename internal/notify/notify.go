@@ -1,9 +1,16 @@
 package notify
 
 import (
-	"os/exec"
+	"errors"
+	"fmt"
+	"io"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/dori/klonch/internal/bus"
+	"github.com/dori/klonch/internal/model"
 )
 
 // Urgency levels for notifications
@@ -15,6 +22,18 @@ const (
 	UrgencyCritical
 )
 
+// String names the urgency the way notify-send spells it
+func (u Urgency) String() string {
+	switch u {
+	case UrgencyLow:
+		return "low"
+	case UrgencyCritical:
+		return "critical"
+	default:
+		return "normal"
+	}
+}
+
 // Notification represents a desktop notification
 type Notification struct {
 	Title   string
@@ -24,104 +43,237 @@ type Notification struct {
 	Icon    string // Optional icon name
 }
 
-// Notifier handles sending desktop notifications
-type Notifier struct {
-	enabled bool
+// Notifier delivers notifications. Each backend is one, and so is a Chain
+// of them.
+type Notifier interface {
+	Send(notification Notification) error
 }
 
-// NewNotifier creates a new notifier
-func NewNotifier() *Notifier {
-	return &Notifier{
-		enabled: true,
-	}
+// ErrUnavailable is returned by backends that can't work here, such as
+// notify-send when it isn't installed
+var ErrUnavailable = errors.New("not available")
+
+// Backend names, as used in the notify.backends setting
+const (
+	BackendAuto       = "auto"
+	BackendDBus       = "dbus"
+	BackendNotifySend = "notify-send"
+	BackendTerminal   = "terminal"
+	BackendCommand    = "command"
+	BackendNtfy       = "ntfy"
+	BackendGotify     = "gotify"
+	BackendNone       = "none"
+)
+
+// BackendNames lists every backend name in the order they are documented
+var BackendNames = []string{
+	BackendAuto, BackendDBus, BackendNotifySend, BackendTerminal,
+	BackendCommand, BackendNtfy, BackendGotify, BackendNone,
+}
+
+// Config selects and sets up backends
+type Config struct {
+	Backends []string  // Names in order; empty means auto
+	Command  string    // Shell command for the command backend
+	URL      string    // ntfy topic URL or Gotify server
+	Token    string    // Access token for ntfy or Gotify
+	Terminal io.Writer // Where terminal escapes go; nil leaves the terminal out
 }
 
-// SetEnabled enables or disables notifications
-func (n *Notifier) SetEnabled(enabled bool) {
-	n.enabled = enabled
+// Backend is one named notifier in a chain
+type Backend struct {
+	Name     string
+	Notifier Notifier
 }
 
-// IsEnabled returns whether notifications are enabled
-func (n *Notifier) IsEnabled() bool {
-	return n.enabled
+// Chain sends every notification to each of its backends in turn. It is
+// safe to reconfigure while notifications are being sent.
+type Chain struct {
+	mu       sync.RWMutex
+	backends []Backend
 }
 
-// Send sends a desktop notification using notify-send
-func (n *Notifier) Send(notification Notification) error {
-	if !n.enabled {
-		return nil
+// New builds a chain from a configuration
+func New(cfg Config) (*Chain, error) {
+	c := &Chain{}
+	if err := c.Configure(cfg); err != nil {
+		return nil, err
 	}
+	return c, nil
+}
 
-	args := []string{}
+// Configure replaces the chain's backends. On error the old ones stay.
+func (c *Chain) Configure(cfg Config) error {
+	backends, err := buildBackends(cfg)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.backends = backends
+	c.mu.Unlock()
+	return nil
+}
 
-	// Add urgency
-	switch notification.Urgency {
-	case UrgencyLow:
-		args = append(args, "-u", "low")
-	case UrgencyCritical:
-		args = append(args, "-u", "critical")
-	default:
-		args = append(args, "-u", "normal")
+// Backends returns the backends notifications currently go to
+func (c *Chain) Backends() []Backend {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]Backend(nil), c.backends...)
+}
+
+// Send delivers a notification through every backend, reporting those
+// that failed
+func (c *Chain) Send(notification Notification) error {
+	var errs []error
+	for _, b := range c.Backends() {
+		if err := b.Notifier.Send(notification); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", b.Name, err))
+		}
 	}
+	return errors.Join(errs...)
+}
 
-	// Add timeout (in milliseconds)
-	if notification.Timeout > 0 {
-		args = append(args, "-t", strconv.Itoa(int(notification.Timeout.Milliseconds())))
+// ParseBackends reads a comma-separated list of backend names
+func ParseBackends(s string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		known := false
+		for _, n := range BackendNames {
+			known = known || n == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown notification backend %q (want %s)", name, strings.Join(BackendNames, ", "))
+		}
+		names = append(names, name)
 	}
+	return names, nil
+}
 
-	// Add icon if specified
-	if notification.Icon != "" {
-		args = append(args, "-i", notification.Icon)
+func buildBackends(cfg Config) ([]Backend, error) {
+	names := cfg.Backends
+	if len(names) == 0 {
+		names = []string{BackendAuto}
 	}
 
-	// Add app name
-	args = append(args, "-a", "klonch")
+	var backends []Backend
+	for _, name := range names {
+		var n Notifier
+		switch name {
+		case BackendAuto:
+			if b, ok := autoBackend(cfg); ok {
+				backends = append(backends, b)
+			}
+			continue
+		case BackendNone:
+			continue
+		case BackendDBus:
+			n = DBus{}
+		case BackendNotifySend:
+			n = NotifySend{}
+		case BackendTerminal:
+			if cfg.Terminal == nil {
+				// Headless, e.g. the reminder daemon: nowhere to print
+				continue
+			}
+			n = &Terminal{Out: cfg.Terminal}
+		case BackendCommand:
+			if strings.TrimSpace(cfg.Command) == "" {
+				return nil, fmt.Errorf("the command backend needs notify.command")
+			}
+			n = Command{Command: cfg.Command}
+		case BackendNtfy, BackendGotify:
+			if strings.TrimSpace(cfg.URL) == "" {
+				return nil, fmt.Errorf("the %s backend needs notify.url", name)
+			}
+			n = &HTTP{URL: cfg.URL, Token: cfg.Token, Gotify: name == BackendGotify}
+		default:
+			return nil, fmt.Errorf("unknown notification backend %q", name)
+		}
+		backends = append(backends, Backend{Name: name, Notifier: n})
+	}
+	return backends, nil
+}
 
-	// Add title and body
-	args = append(args, notification.Title)
-	if notification.Body != "" {
-		args = append(args, notification.Body)
+// autoBackend tries the backends most likely to reach the user until one
+// works: the terminal over SSH, where desktop notifications would pop up on
+// the remote machine if anywhere, otherwise D-Bus, then notify-send, then
+// the terminal anyway. A session bus without a notification server fails
+// its call, so it falls through rather than swallowing notifications.
+func autoBackend(cfg Config) (Backend, bool) {
+	var candidates fallback
+	if cfg.Terminal != nil && overSSH() {
+		candidates = append(candidates, Backend{Name: BackendTerminal, Notifier: &Terminal{Out: cfg.Terminal}})
+		return Backend{Name: BackendAuto, Notifier: candidates}, true
+	}
+	if bus.SessionAddress() != "" {
+		candidates = append(candidates, Backend{Name: BackendDBus, Notifier: DBus{}})
 	}
+	if notifySendInstalled() {
+		candidates = append(candidates, Backend{Name: BackendNotifySend, Notifier: NotifySend{}})
+	}
+	if cfg.Terminal != nil {
+		candidates = append(candidates, Backend{Name: BackendTerminal, Notifier: &Terminal{Out: cfg.Terminal}})
+	}
+	if len(candidates) == 0 {
+		return Backend{}, false
+	}
+	return Backend{Name: BackendAuto, Notifier: candidates}, true
+}
 
-	// Execute notify-send
-	cmd := exec.Command("notify-send", args...)
-	return cmd.Run()
+// fallback sends through the first of its backends that succeeds
+type fallback []Backend
+
+func (f fallback) Send(notification Notification) error {
+	var errs []error
+	for _, b := range f {
+		err := b.Notifier.Send(notification)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", b.Name, err))
+	}
+	return errors.Join(errs...)
 }
 
-// SendSimple sends a simple notification with title and body
-func (n *Notifier) SendSimple(title, body string) error {
-	return n.Send(Notification{
+// Simple is a plain notification with a title and body
+func Simple(title, body string) Notification {
+	return Notification{
 		Title:   title,
 		Body:    body,
 		Urgency: UrgencyNormal,
 		Timeout: 5 * time.Second,
-	})
+	}
 }
 
-// SendPomodoroComplete sends a pomodoro completion notification
-func (n *Notifier) SendPomodoroComplete(taskTitle string, duration int) error {
-	return n.Send(Notification{
+// PomodoroComplete announces the end of a pomodoro
+func PomodoroComplete(taskTitle string) Notification {
+	return Notification{
 		Title:   "Pomodoro Complete!",
 		Body:    taskTitle,
 		Urgency: UrgencyNormal,
 		Timeout: 10 * time.Second,
 		Icon:    "alarm-symbolic",
-	})
+	}
 }
 
-// SendBreakComplete sends a break completion notification
-func (n *Notifier) SendBreakComplete() error {
-	return n.Send(Notification{
+// BreakComplete announces the end of a break
+func BreakComplete() Notification {
+	return Notification{
 		Title:   "Break Over",
 		Body:    "Time to get back to work!",
 		Urgency: UrgencyNormal,
 		Timeout: 10 * time.Second,
 		Icon:    "appointment-soon-symbolic",
-	})
+	}
 }
 
-// SendDueReminder sends a task due reminder
-func (n *Notifier) SendDueReminder(taskTitle string, dueIn time.Duration) error {
+// DueReminder reminds about a task due in dueIn, or overdue if that's not
+// positive
+func DueReminder(taskTitle string, dueIn time.Duration) Notification {
 	var body string
 	if dueIn <= 0 {
 		body = "Task is now overdue!"
@@ -136,11 +288,42 @@ func (n *Notifier) SendDueReminder(taskTitle string, dueIn time.Duration) error
 		urgency = UrgencyCritical
 	}
 
-	return n.Send(Notification{
+	return Notification{
 		Title:   taskTitle,
 		Body:    body,
 		Urgency: urgency,
 		Timeout: 15 * time.Second,
 		Icon:    "emblem-important-symbolic",
-	})
+	}
+}
+
+// MissedReminders lists reminders that went off while klonch wasn't
+// running
+func MissedReminders(taskTitles []string) Notification {
+	title := "Missed reminder"
+	if len(taskTitles) > 1 {
+		title = strconv.Itoa(len(taskTitles)) + " missed reminders"
+	}
+	return Notification{
+		Title:   title,
+		Body:    strings.Join(taskTitles, "\n"),
+		Urgency: UrgencyNormal,
+		Timeout: 15 * time.Second,
+		Icon:    "emblem-important-symbolic",
+	}
+}
+
+// LongTimer warns that a timer has been running for a long time, in case it
+// was forgotten
+func LongTimer(taskTitle string, elapsed time.Duration) Notification {
+	if taskTitle == "" {
+		taskTitle = "Timer"
+	}
+	return Notification{
+		Title:   taskTitle,
+		Body:    "Timer running for " + model.FormatEstimate(int(elapsed.Minutes())) + " - still on it?",
+		Urgency: UrgencyNormal,
+		Timeout: 15 * time.Second,
+		Icon:    "alarm-symbolic",
+	}
 }
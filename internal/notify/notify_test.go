@@ -0,0 +1,281 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func TestHTTPNtfy(t *testing.T) {
+	var got *http.Request
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		got, body = r, string(data)
+	}))
+	defer srv.Close()
+
+	h := &HTTP{URL: srv.URL + "/my-tasks", Token: "tk_secret"}
+	if err := h.Send(DueReminder("Pay rent", 0)); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got.Method != http.MethodPost || got.URL.Path != "/my-tasks" {
+		t.Errorf("request = %s %s, want POST /my-tasks", got.Method, got.URL.Path)
+	}
+	if got.Header.Get("Title") != "Pay rent" || body != "Task is now overdue!" {
+		t.Errorf("title %q body %q", got.Header.Get("Title"), body)
+	}
+	if got.Header.Get("Priority") != "5" {
+		t.Errorf("priority = %q, want 5 for critical", got.Header.Get("Priority"))
+	}
+	if got.Header.Get("Authorization") != "Bearer tk_secret" {
+		t.Errorf("authorization = %q", got.Header.Get("Authorization"))
+	}
+}
+
+func TestHTTPGotify(t *testing.T) {
+	var path, key string
+	var msg map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, key = r.URL.Path, r.Header.Get("X-Gotify-Key")
+		json.NewDecoder(r.Body).Decode(&msg)
+	}))
+	defer srv.Close()
+
+	h := &HTTP{URL: srv.URL + "/", Token: "app-token", Gotify: true}
+	if err := h.Send(PomodoroComplete("Write report")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if path != "/message" || key != "app-token" {
+		t.Errorf("path %q key %q", path, key)
+	}
+	if msg["title"] != "Pomodoro Complete!" || msg["message"] != "Write report" || msg["priority"] != float64(5) {
+		t.Errorf("message = %v", msg)
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	err := (&HTTP{URL: srv.URL}).Send(Simple("a", "b"))
+	if err == nil || !strings.Contains(err.Error(), "401") || !strings.Contains(err.Error(), "unauthorized") {
+		t.Errorf("err = %v, want the status and message", err)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	c := Command{Command: `printf '%s|%s|%s' "$KLONCH_TITLE" "$KLONCH_BODY" "$KLONCH_URGENCY" > ` + out}
+	if err := c.Send(Notification{Title: "Break Over", Body: "Back to it; now", Urgency: UrgencyLow}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Break Over|Back to it; now|low"; string(data) != want {
+		t.Errorf("command saw %q, want %q", data, want)
+	}
+
+	err = Command{Command: "echo nope >&2; exit 3"}.Send(Simple("a", "b"))
+	if err == nil || !strings.Contains(err.Error(), "nope") {
+		t.Errorf("err = %v, want the command's output", err)
+	}
+}
+
+func TestTerminal(t *testing.T) {
+	t.Setenv("TMUX", "")
+	var buf bytes.Buffer
+	term := &Terminal{Out: &buf}
+	if err := term.Send(Simple("Done;now", "line\x1b]one\ntwo")); err != nil {
+		t.Fatal(err)
+	}
+	want := "\x1b]9;Donenow: line]one two\x07\x1b]777;notify;Donenow;line]one two\x07\a"
+	if buf.String() != want {
+		t.Errorf("wrote %q, want %q", buf.String(), want)
+	}
+}
+
+func TestParseBackends(t *testing.T) {
+	names, err := ParseBackends(" Terminal, ntfy ,,")
+	if err != nil || strings.Join(names, ",") != "terminal,ntfy" {
+		t.Errorf("ParseBackends = %v, %v", names, err)
+	}
+	if _, err := ParseBackends("dbus,pager"); err == nil {
+		t.Error("ParseBackends accepted an unknown backend")
+	}
+}
+
+func TestChain(t *testing.T) {
+	var buf bytes.Buffer
+	c, err := New(Config{Backends: []string{BackendTerminal, BackendCommand}, Command: "exit 1", Terminal: &buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Send(Simple("a", "b"))
+	if err == nil || !strings.HasPrefix(err.Error(), "command: ") {
+		t.Errorf("err = %v, want the command backend's failure", err)
+	}
+	if buf.Len() == 0 {
+		t.Error("the terminal backend wasn't sent to despite the command failing")
+	}
+
+	// Misconfigured backends are refused and the old ones kept
+	if err := c.Configure(Config{Backends: []string{BackendNtfy}}); err == nil {
+		t.Error("Configure accepted ntfy without a URL")
+	}
+	if got := len(c.Backends()); got != 2 {
+		t.Errorf("%d backends after a failed Configure, want 2", got)
+	}
+
+	// The terminal is left out where there is none
+	c, _ = New(Config{Backends: []string{BackendTerminal, BackendNone}})
+	if got := len(c.Backends()); got != 0 {
+		t.Errorf("%d backends without a terminal, want 0", got)
+	}
+}
+
+func TestAutoFallsThrough(t *testing.T) {
+	t.Setenv("SSH_CONNECTION", "")
+	t.Setenv("SSH_TTY", "")
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "unix:path="+filepath.Join(t.TempDir(), "missing"))
+	t.Setenv("PATH", t.TempDir())
+
+	var buf bytes.Buffer
+	c, err := New(Config{Terminal: &buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Send(Simple("a", "b")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if buf.Len() == 0 {
+		t.Error("auto didn't fall through to the terminal")
+	}
+}
+
+// fakeBus accepts one connection, answers Hello and Notify (or fails Notify
+// with errName) and reports the Notify arguments
+func fakeBus(t *testing.T, errName string) (addr string, notified chan []any) {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "bus")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	notified = make(chan []any, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		r := bufio.NewReader(conn)
+
+		if !fakeAuth(conn, r) {
+			return
+		}
+		for {
+			call, err := dbus.DecodeMessage(r)
+			if err != nil {
+				return
+			}
+			member, _ := call.Headers[dbus.FieldMember].Value().(string)
+			reply := &dbus.Message{
+				Type:    dbus.TypeMethodReply,
+				Headers: map[dbus.HeaderField]dbus.Variant{dbus.FieldReplySerial: dbus.MakeVariant(call.Serial())},
+			}
+			switch {
+			case member == "Hello":
+				reply.Headers[dbus.FieldSignature] = dbus.MakeVariant(dbus.SignatureOf(""))
+				reply.Body = []any{":1.1"}
+			case member == "Notify" && errName != "":
+				reply.Type = dbus.TypeError
+				reply.Headers[dbus.FieldErrorName] = dbus.MakeVariant(errName)
+				reply.Headers[dbus.FieldSignature] = dbus.MakeVariant(dbus.SignatureOf(""))
+				reply.Body = []any{"no server here"}
+			case member == "Notify":
+				notified <- call.Body
+				reply.Headers[dbus.FieldSignature] = dbus.MakeVariant(dbus.SignatureOf(uint32(0)))
+				reply.Body = []any{uint32(7)}
+			}
+			if err := reply.EncodeTo(conn, binary.LittleEndian); err != nil {
+				t.Errorf("replying to %s: %v", member, err)
+				return
+			}
+		}
+	}()
+	return "unix:path=" + socket, notified
+}
+
+// fakeAuth lets the client in with EXTERNAL after it asks for the mechanisms
+func fakeAuth(conn net.Conn, r *bufio.Reader) bool {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return false
+		}
+		switch line = strings.TrimPrefix(line, "\x00"); {
+		case line == "AUTH\r\n":
+			conn.Write([]byte("REJECTED EXTERNAL\r\n"))
+		case strings.HasPrefix(line, "AUTH EXTERNAL"):
+			conn.Write([]byte("OK 1234deadbeef1234deadbeef1234de\r\n"))
+		case line == "BEGIN\r\n":
+			return true
+		default:
+			conn.Write([]byte("ERROR\r\n"))
+		}
+	}
+}
+
+func TestDBus(t *testing.T) {
+	addr, notified := fakeBus(t, "")
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", addr)
+
+	if err := (DBus{}).Send(PomodoroComplete("Write report")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	got := <-notified
+	want := []any{"klonch", uint32(0), "alarm-symbolic", "Pomodoro Complete!", "Write report", []string{},
+		map[string]dbus.Variant{"urgency": dbus.MakeVariant(byte(UrgencyNormal))}, int32(10000)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Notify got %v, want %v", got, want)
+	}
+}
+
+func TestDBusError(t *testing.T) {
+	addr, _ := fakeBus(t, "org.freedesktop.DBus.Error.ServiceUnknown")
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", addr)
+
+	err := (DBus{}).Send(Simple("a", "b"))
+	var dbusErr dbus.Error
+	if !errors.As(err, &dbusErr) || dbusErr.Name != "org.freedesktop.DBus.Error.ServiceUnknown" || err.Error() != "no server here" {
+		t.Errorf("err = %v", err)
+	}
+
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "")
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	if err := (DBus{}).Send(Simple("a", "b")); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("err = %v without a bus, want ErrUnavailable", err)
+	}
+}
@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// NotifySend shows desktop notifications with the notify-send command
+type NotifySend struct{}
+
+func notifySendInstalled() bool {
+	_, err := exec.LookPath("notify-send")
+	return err == nil
+}
+
+// Send runs notify-send
+func (NotifySend) Send(notification Notification) error {
+	if !notifySendInstalled() {
+		return ErrUnavailable
+	}
+
+	args := []string{"-u", notification.Urgency.String()}
+
+	// Add timeout (in milliseconds)
+	if notification.Timeout > 0 {
+		args = append(args, "-t", strconv.Itoa(int(notification.Timeout.Milliseconds())))
+	}
+
+	// Add icon if specified
+	if notification.Icon != "" {
+		args = append(args, "-i", notification.Icon)
+	}
+
+	// Add app name
+	args = append(args, "-a", "klonch")
+
+	// Add title and body
+	args = append(args, notification.Title)
+	if notification.Body != "" {
+		args = append(args, notification.Body)
+	}
+
+	return exec.Command("notify-send", args...).Run()
+}
@@ -0,0 +1,64 @@
+package notify
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Terminal notifies through the terminal klonch runs in, which works over
+// SSH: it rings the bell and sends OSC 9 (iTerm2, WezTerm, Windows
+// Terminal) and OSC 777 (kitty, foot, VTE terminals) escape sequences.
+// Terminals ignore the ones they don't know. Inside tmux the sequences are
+// passed through to the outer terminal.
+type Terminal struct {
+	Out io.Writer
+	mu  sync.Mutex
+}
+
+// Send writes the escape sequences and the bell
+func (t *Terminal) Send(notification Notification) error {
+	title := sanitizeEscape(notification.Title)
+	body := sanitizeEscape(notification.Body)
+
+	osc9 := "\x1b]9;" + title
+	if body != "" {
+		osc9 += ": " + body
+	}
+	osc9 += "\x07"
+	osc777 := "\x1b]777;notify;" + title + ";" + body + "\x07"
+
+	seq := osc9 + osc777
+	if os.Getenv("TMUX") != "" {
+		seq = tmuxPassthrough(osc9) + tmuxPassthrough(osc777)
+	}
+
+	// One write, so the sequence doesn't interleave with screen updates
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := io.WriteString(t.Out, seq+"\a")
+	return err
+}
+
+// sanitizeEscape drops control characters, which would end the sequence
+// early, and semicolons, which separate OSC 777 fields
+func sanitizeEscape(s string) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == ';' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// tmuxPassthrough wraps a sequence so tmux hands it to the outer terminal
+func tmuxPassthrough(seq string) string {
+	return "\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + "\x1b\\"
+}
+
+// overSSH reports whether klonch runs in an SSH session
+func overSSH() bool {
+	return os.Getenv("SSH_CONNECTION") != "" || os.Getenv("SSH_TTY") != ""
+}
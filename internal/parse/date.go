@@ -0,0 +1,364 @@
+package parse
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+)
+
+// Clock reads a time of day: 14:00, 9am, 9:30pm or noon
+func Clock(s string) (hour, min int, ok bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "noon" {
+		return 12, 0, true
+	}
+
+	meridiem := ""
+	if strings.HasSuffix(s, "am") || strings.HasSuffix(s, "pm") {
+		meridiem = s[len(s)-2:]
+		s = strings.TrimSpace(s[:len(s)-2])
+	}
+
+	var t time.Time
+	var err error
+	switch {
+	case strings.Contains(s, ":"):
+		t, err = time.Parse("15:04", s)
+		if err != nil {
+			return 0, 0, false
+		}
+	case meridiem != "":
+		// A bare hour needs am/pm, or "jan 2" would read as two o'clock
+		t, err = time.Parse("15", s)
+		if err != nil {
+			return 0, 0, false
+		}
+	default:
+		return 0, 0, false
+	}
+
+	hour, min = t.Hour(), t.Minute()
+	if meridiem != "" {
+		if hour < 1 || hour > 12 {
+			return 0, 0, false
+		}
+		hour %= 12
+		if meridiem == "pm" {
+			hour += 12
+		}
+	}
+	return hour, min, true
+}
+
+// EndAt reads when a timer that ran from start stopped: a time of day, taken
+// as the last one before now, a date and time as Date reads them, or a
+// length from the start such as 1h30m, 90m or a bare number of minutes. The
+// moment must lie between start and now.
+func EndAt(s string, start, now time.Time) (time.Time, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	var end time.Time
+	if hour, min, ok := Clock(s); ok {
+		end = time.Date(now.Year(), now.Month(), now.Day(), hour, min, 0, 0, now.Location())
+		if end.After(now) {
+			end = end.AddDate(0, 0, -1)
+		}
+	} else if length, ok := timerLength(s); ok {
+		end = start.Add(length)
+	} else if end, ok = Date(s, now); !ok {
+		return time.Time{}, false
+	}
+	if end.Before(start) || end.After(now) {
+		return time.Time{}, false
+	}
+	return end, true
+}
+
+// timerLength reads 1h30m, +45m or a bare number of minutes
+func timerLength(s string) (time.Duration, bool) {
+	s = strings.TrimPrefix(s, "+")
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+		return time.Duration(n) * time.Minute, true
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+// Date reads a natural-language date with an optional time. The date can be
+// a name (today, tomorrow, yesterday, fri, next monday), relative (in 3
+// days, +2w, -1d), the end of a span (eow, end of month), an ISO week
+// (2025-W03, 2025-W03-5) or a calendar date (2024-01-15, Jan 2). A time such as "fri 14:00" or
+// "tomorrow at 9am" may follow; a time on its own means today. Dates
+// without a time fall at the end of the day.
+func Date(s string, now time.Time) (time.Time, bool) {
+	fields := strings.Fields(strings.ToLower(s))
+
+	// 2024-01-15T14:00 is a date and a time in one word
+	if n := len(fields); n > 0 {
+		if day, clock, ok := strings.Cut(fields[n-1], "t"); ok && clock != "" && len(day) == len("2006-01-02") {
+			if _, err := time.Parse("2006-01-02", day); err == nil {
+				fields = append(fields[:n-1], day, clock)
+			}
+		}
+	}
+
+	// The time is the last word, or the last two for "9 am"
+	hour, min, timed := 0, 0, false
+	for _, n := range []int{2, 1} {
+		if len(fields) < n {
+			continue
+		}
+		if h, m, ok := Clock(strings.Join(fields[len(fields)-n:], "")); ok {
+			hour, min, timed = h, m, true
+			fields = fields[:len(fields)-n]
+			break
+		}
+	}
+	if timed && len(fields) > 0 && fields[len(fields)-1] == "at" {
+		fields = fields[:len(fields)-1]
+	}
+
+	day := model.StartOfDay(now)
+	if len(fields) > 0 {
+		var ok bool
+		if day, ok = parseDay(strings.Join(fields, " "), now); !ok {
+			return time.Time{}, false
+		}
+	} else if !timed {
+		return time.Time{}, false
+	}
+
+	if !timed {
+		return model.EndOfDay(day), true
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, min, 0, 0, day.Location()), true
+}
+
+// Span reads a date in a filter as the stretch of time [start, end) it
+// covers. A day is the one Date reads, so a filter for "fri" finds the task
+// given "due:fri"; a date with a time covers that minute. week, month and
+// year, lastweek, nextweek, lastmonth and nextmonth cover the calendar span.
+func Span(s string, now time.Time) (start, end time.Time, ok bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	week := model.StartOfWeek(now)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	switch s {
+	case "week", "this week":
+		return week, week.AddDate(0, 0, 7), true
+	case "lastweek", "last week":
+		return week.AddDate(0, 0, -7), week, true
+	case "nextweek", "next week":
+		return week.AddDate(0, 0, 7), week.AddDate(0, 0, 14), true
+	case "month", "this month":
+		return month, month.AddDate(0, 1, 0), true
+	case "lastmonth", "last month":
+		return month.AddDate(0, -1, 0), month, true
+	case "nextmonth", "next month":
+		return month.AddDate(0, 1, 0), month.AddDate(0, 2, 0), true
+	case "year", "this year":
+		year := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, now.Location())
+		return year, year.AddDate(1, 0, 0), true
+	}
+
+	t, ok := Date(s, now)
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	if model.HasClock(t) {
+		return t, t.Add(time.Minute), true
+	}
+	day := model.StartOfDay(t)
+	return day, day.AddDate(0, 0, 1), true
+}
+
+// FormatDate writes t so that Date reads it back, for prefilling inputs
+func FormatDate(t time.Time) string {
+	if model.HasClock(t) {
+		return t.Format("2006-01-02 15:04")
+	}
+	return t.Format("2006-01-02")
+}
+
+// FormatToken writes t as one word that Date reads back, for quick add
+// notation such as due:2024-01-15T14:00
+func FormatToken(t time.Time) string {
+	if model.HasClock(t) {
+		return t.Format("2006-01-02T15:04")
+	}
+	return t.Format("2006-01-02")
+}
+
+// parseDay reads the date part of Date, returning the start of that day
+func parseDay(s string, now time.Time) (time.Time, bool) {
+	today := model.StartOfDay(now)
+
+	// Weeks start on Monday
+	weekStart := today.AddDate(0, 0, -(int(today.Weekday()+6) % 7))
+
+	switch s {
+	case "today", "eod", "end of day":
+		return today, true
+	case "tomorrow", "tom":
+		return today.AddDate(0, 0, 1), true
+	case "yesterday":
+		return today.AddDate(0, 0, -1), true
+	case "next week", "nextweek":
+		return today.AddDate(0, 0, 7), true
+	case "eow", "end of week", "end of the week":
+		return weekStart.AddDate(0, 0, 6), true
+	case "eom", "end of month", "end of the month":
+		return time.Date(today.Year(), today.Month()+1, 0, 0, 0, 0, 0, today.Location()), true
+	case "eoy", "end of year", "end of the year":
+		return time.Date(today.Year(), 12, 31, 0, 0, 0, 0, today.Location()), true
+	}
+
+	// "fri" is the next Friday, never today; "next fri" is Friday next week
+	next := strings.HasPrefix(s, "next ")
+	if d, ok := weekday(strings.TrimPrefix(s, "next ")); ok {
+		if next {
+			return weekStart.AddDate(0, 0, 7+int(d+6)%7), true
+		}
+		days := int(d - today.Weekday())
+		if days <= 0 {
+			days += 7
+		}
+		return today.AddDate(0, 0, days), true
+	}
+
+	// "in 3 days", "in 2w", "+1m", and back with "-2w"
+	if rest, ok := strings.CutPrefix(s, "in "); ok {
+		return offset(strings.ReplaceAll(rest, " ", ""), today)
+	}
+	if strings.HasPrefix(s, "+") {
+		return offset(s[1:], today)
+	}
+	if strings.HasPrefix(s, "-") {
+		return offset(s, today)
+	}
+
+	if t, ok := isoWeek(s, today); ok {
+		return t, true
+	}
+
+	formats := []string{
+		"2006-01-02",
+		"01/02/2006",
+		"01-02-2006",
+		"Jan 2",
+		"Jan 2, 2006",
+		"2 Jan",
+		"2 Jan 2006",
+	}
+	for _, format := range formats {
+		if t, err := time.ParseInLocation(format, s, now.Location()); err == nil {
+			// If no year, use current year
+			year := t.Year()
+			if year == 0 {
+				year = now.Year()
+			}
+			return time.Date(year, t.Month(), t.Day(), 0, 0, 0, 0, now.Location()), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// weekday reads a weekday name or its three-letter form
+func weekday(s string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if s == name || s == name[:3] {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// offsetUnits maps the unit words of relative dates to their letter
+var offsetUnits = map[string]byte{
+	"d": 'd', "day": 'd', "days": 'd',
+	"w": 'w', "wk": 'w', "week": 'w', "weeks": 'w',
+	"m": 'm', "mo": 'm', "month": 'm', "months": 'm',
+	"y": 'y', "yr": 'y', "year": 'y', "years": 'y',
+}
+
+// offset moves from by an amount such as 3d, 2weeks, 1m or -1w. Months
+// and years that land past the end of a month stop at its last day.
+func offset(s string, from time.Time) (time.Time, bool) {
+	i := 0
+	if strings.HasPrefix(s, "-") {
+		i++
+	}
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	n, err := strconv.Atoi(s[:i])
+	if err != nil {
+		return time.Time{}, false
+	}
+	unit, ok := offsetUnits[s[i:]]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	switch unit {
+	case 'd':
+		return from.AddDate(0, 0, n), true
+	case 'w':
+		return from.AddDate(0, 0, 7*n), true
+	case 'm':
+		return addMonths(from, n), true
+	default:
+		return addMonths(from, 12*n), true
+	}
+}
+
+// addMonths is AddDate for months without spilling Jan 31 into March
+func addMonths(t time.Time, n int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(n), 1, 0, 0, 0, 0, t.Location())
+	last := first.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > last {
+		day = last
+	}
+	return time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, t.Location())
+}
+
+// isoWeek reads 2025-W03 (that week's Sunday, when it ends), 2025-W03-5
+// (its Friday) or w3 (week 3 of this year)
+func isoWeek(s string, today time.Time) (time.Time, bool) {
+	year := today.Year()
+	if strings.HasPrefix(s, "w") {
+		s = strconv.Itoa(year) + "-" + s
+	}
+	parts := strings.Split(s, "-")
+	if len(parts) < 2 || len(parts) > 3 || !strings.HasPrefix(parts[1], "w") {
+		return time.Time{}, false
+	}
+	year, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return time.Time{}, false
+	}
+	week, err := strconv.Atoi(parts[1][1:])
+	if err != nil || week < 1 || week > 53 {
+		return time.Time{}, false
+	}
+	day := 7
+	if len(parts) == 3 {
+		if day, err = strconv.Atoi(parts[2]); err != nil || day < 1 || day > 7 {
+			return time.Time{}, false
+		}
+	}
+
+	// Week 1 is the one with the year's first Thursday, so it holds 4 January
+	jan4 := time.Date(year, 1, 4, 0, 0, 0, 0, today.Location())
+	monday := jan4.AddDate(0, 0, -(int(jan4.Weekday()+6) % 7))
+	t := monday.AddDate(0, 0, 7*(week-1)+day-1)
+	if _, w := t.ISOWeek(); w != week {
+		return time.Time{}, false
+	}
+	return t, true
+}
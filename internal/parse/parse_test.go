@@ -0,0 +1,197 @@
+package parse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+)
+
+func TestDate(t *testing.T) {
+	now := time.Date(2025, 3, 5, 10, 0, 0, 0, time.Local) // Wednesday
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2025, month, d, 23, 59, 59, 0, time.Local)
+	}
+	at := func(month time.Month, d, hour, min int) time.Time {
+		return time.Date(2025, month, d, hour, min, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"today", day(3, 5)},
+		{"tomorrow 9am", at(3, 6, 9, 0)},
+		{"fri 14:00", at(3, 7, 14, 0)},
+		{"friday at 9:30pm", at(3, 7, 21, 30)},
+		{"wed", day(3, 12)},
+		{"next monday", day(3, 10)},
+		{"next fri", day(3, 14)},
+		{"in 3 days", day(3, 8)},
+		{"in 2 weeks 8 am", at(3, 19, 8, 0)},
+		{"+2w", day(3, 19)},
+		{"+1m", day(4, 5)},
+		{"eow", day(3, 9)},
+		{"end of month", day(3, 31)},
+		{"eoy", day(12, 31)},
+		{"2025-W03", day(1, 19)},
+		{"2025-w03-5", day(1, 17)},
+		{"w12", day(3, 23)},
+		{"2025-04-01", day(4, 1)},
+		{"2025-04-01 8 am", at(4, 1, 8, 0)},
+		{"jan 2", day(1, 2)},
+		{"16:45", at(3, 5, 16, 45)},
+		{"noon", at(3, 5, 12, 0)},
+	}
+	for _, tt := range tests {
+		got, ok := Date(tt.in, now)
+		if !ok {
+			t.Errorf("Date(%q) failed", tt.in)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("Date(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "someday", "fri 25:00", "13pm", "at", "in 3", "2025-W54"} {
+		if got, ok := Date(bad, now); ok {
+			t.Errorf("Date(%q) = %v, want failure", bad, got)
+		}
+	}
+
+	// Month offsets stop at the end of a short month
+	if got, _ := Date("+1m", time.Date(2025, 1, 31, 9, 0, 0, 0, time.Local)); !got.Equal(day(2, 28)) {
+		t.Errorf("Date(+1m) from Jan 31 = %v, want Feb 28", got)
+	}
+
+	// FormatDate round-trips through Date
+	for _, want := range []time.Time{day(4, 1), at(4, 1, 8, 5)} {
+		if got, ok := Date(FormatDate(want), now); !ok || !got.Equal(want) {
+			t.Errorf("Date(FormatDate(%v)) = %v", want, got)
+		}
+	}
+
+	// FormatToken round-trips through quick add, next to other tokens
+	for _, want := range []time.Time{day(4, 1), at(4, 1, 8, 5)} {
+		got := QuickAdd("Call back due:"+FormatToken(want)+" ~1h start:"+FormatToken(day(3, 30)), now)
+		if got.Due == nil || !got.Due.Equal(want) || got.Title != "Call back" {
+			t.Errorf("QuickAdd with due:%s = %+v", FormatToken(want), got)
+		}
+	}
+}
+
+func TestSpan(t *testing.T) {
+	now := time.Date(2025, 3, 5, 10, 0, 0, 0, time.Local) // Wednesday
+	date := func(month time.Month, d int) time.Time {
+		return time.Date(2025, month, d, 0, 0, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		in         string
+		start, end time.Time
+	}{
+		{"today", date(3, 5), date(3, 6)},
+		{"yesterday", date(3, 4), date(3, 5)},
+		{"wed", date(3, 12), date(3, 13)},
+		{"next fri", date(3, 14), date(3, 15)},
+		{"eow", date(3, 9), date(3, 10)},
+		{"-2w", date(2, 19), date(2, 20)},
+		{"in 3 days", date(3, 8), date(3, 9)},
+		{"week", date(3, 3), date(3, 10)},
+		{"lastweek", date(2, 24), date(3, 3)},
+		{"nextweek", date(3, 10), date(3, 17)},
+		{"next week", date(3, 10), date(3, 17)},
+		{"month", date(3, 1), date(4, 1)},
+		{"next month", date(4, 1), date(5, 1)},
+		{"year", date(1, 1), time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local)},
+		{"fri 14:00", time.Date(2025, 3, 7, 14, 0, 0, 0, time.Local), time.Date(2025, 3, 7, 14, 1, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		start, end, ok := Span(tt.in, now)
+		if !ok {
+			t.Errorf("Span(%q) failed", tt.in)
+			continue
+		}
+		if !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("Span(%q) = %v to %v, want %v to %v", tt.in, start, end, tt.start, tt.end)
+		}
+	}
+
+	if _, _, ok := Span("someday", now); ok {
+		t.Error("Expected Span(someday) to fail")
+	}
+}
+
+func TestEndAt(t *testing.T) {
+	now := time.Date(2025, 3, 5, 10, 0, 0, 0, time.Local)
+	start := time.Date(2025, 3, 4, 16, 0, 0, 0, time.Local)
+	at := func(d, hour, min int) time.Time {
+		return time.Date(2025, 3, d, hour, min, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"17:30", at(4, 17, 30)},
+		{"9am", at(5, 9, 0)},
+		{"1h30m", at(4, 17, 30)},
+		{"+45m", at(4, 16, 45)},
+		{"90", at(4, 17, 30)},
+		{"2025-03-04 18:00", at(4, 18, 0)},
+	}
+	for _, tt := range tests {
+		got, ok := EndAt(tt.in, start, now)
+		if !ok {
+			t.Errorf("EndAt(%q) failed", tt.in)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("EndAt(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	// Before the start, after now, or not a time at all
+	for _, bad := range []string{"15:00", "24h", "tomorrow 9am", "-5m", "soon"} {
+		if got, ok := EndAt(bad, start, now); ok {
+			t.Errorf("EndAt(%q) = %v, want failure", bad, got)
+		}
+	}
+}
+
+func TestQuickAdd(t *testing.T) {
+	now := time.Date(2025, 3, 5, 10, 0, 0, 0, time.Local) // Wednesday
+
+	q := QuickAdd("Fix bug #work @urgent !high due:fri 14:00 ~1h30m", now)
+	if q.Title != "Fix bug" || q.Project != "work" || q.Priority != model.PriorityHigh {
+		t.Errorf("Unexpected parse %+v", q)
+	}
+	if len(q.Tags) != 1 || q.Tags[0] != "@urgent" {
+		t.Errorf("Tags = %v", q.Tags)
+	}
+	if q.Due == nil || !q.Due.Equal(time.Date(2025, 3, 7, 14, 0, 0, 0, time.Local)) {
+		t.Errorf("Due = %v", q.Due)
+	}
+	if q.Estimate == nil || *q.Estimate != 90 {
+		t.Errorf("Estimate = %v", q.Estimate)
+	}
+
+	// Dates run over several words, and stop where the title resumes
+	q = QuickAdd("Pay rent due:in 3 days then relax start:next mon", now)
+	if q.Title != "Pay rent then relax" {
+		t.Errorf("Title = %q", q.Title)
+	}
+	if q.Due == nil || !q.Due.Equal(time.Date(2025, 3, 8, 23, 59, 59, 0, time.Local)) {
+		t.Errorf("Due = %v", q.Due)
+	}
+	if q.Start == nil || !q.Start.Equal(time.Date(2025, 3, 10, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("Start = %v", q.Start)
+	}
+
+	// Tokens that don't parse stay in the title
+	q = QuickAdd("Say hi! due:someday ~forever #", now)
+	if q.Title != "Say hi! due:someday ~forever #" || q.HasFields() {
+		t.Errorf("Unexpected parse %+v", q)
+	}
+}
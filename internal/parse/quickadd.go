@@ -0,0 +1,174 @@
+package parse
+
+import (
+	"strings"
+	"time"
+
+	"github.com/dori/klonch/internal/model"
+)
+
+// Task is what a quick-add line asks for. Anything the line doesn't mention
+// is left zero, so an edit only changes the fields it names.
+type Task struct {
+	Title    string
+	Project  string         // Project name from #name
+	Tags     []string       // Tag names from @name, with the @
+	Priority model.Priority // Empty unless given with !
+	Due      *time.Time
+	Start    *time.Time
+	Estimate *int // Minutes
+}
+
+// maxDateWords is how many words a due: or start: value may run over, as
+// in "due:next monday 9 am"
+const maxDateWords = 4
+
+// QuickAdd splits a line such as "Fix bug #work @review !high due:fri 14:00
+// ~1h" into the title and the fields set by its tokens:
+//
+//	#project  @tag  !priority  due:date  start:date  ~estimate
+//
+// A date may spread over the following words ("due:in 3 days", "due:fri
+// 9am"); the longest run that reads as a date is taken. Words that look
+// like tokens but don't parse stay in the title.
+func QuickAdd(text string, now time.Time) Task {
+	var task Task
+	words := strings.Fields(text)
+	var titleParts []string
+
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		lower := strings.ToLower(word)
+		switch {
+		// Project (#work, #personal, etc.)
+		case strings.HasPrefix(word, "#") && len(word) > 1:
+			task.Project = word[1:]
+
+		// Tags (@home, @work, etc.)
+		case strings.HasPrefix(word, "@") && len(word) > 1:
+			task.Tags = append(task.Tags, word)
+
+		// Priority (!low, !high, etc.)
+		case strings.HasPrefix(word, "!"):
+			if priority, ok := Priority(word[1:]); ok {
+				task.Priority = priority
+			} else {
+				titleParts = append(titleParts, word)
+			}
+
+		// Due date (due:tomorrow, due:fri 14:00, due:in 3 days)
+		case strings.HasPrefix(lower, "due:"):
+			if due, used, ok := dateAt(words, i, len("due:"), now); ok {
+				task.Due = &due
+				i += used
+			} else {
+				titleParts = append(titleParts, word)
+			}
+
+		// Start date (start:monday); the task stays hidden until then
+		case strings.HasPrefix(lower, "start:"):
+			if start, used, ok := dateAt(words, i, len("start:"), now); ok {
+				start = StartOf(start)
+				task.Start = &start
+				i += used
+			} else {
+				titleParts = append(titleParts, word)
+			}
+
+		// Time estimate (~45m, ~2h, ~1h30m)
+		case strings.HasPrefix(word, "~"):
+			if minutes, err := model.ParseEstimate(word); err == nil {
+				task.Estimate = &minutes
+			} else {
+				titleParts = append(titleParts, word)
+			}
+
+		default:
+			titleParts = append(titleParts, word)
+		}
+	}
+
+	task.Title = strings.Join(titleParts, " ")
+	return task
+}
+
+// dateAt reads the date in words[i] after its prefix, taking in as many of
+// the following words as still make a date. It returns how many it took.
+func dateAt(words []string, i, prefix int, now time.Time) (time.Time, int, bool) {
+	value := words[i][prefix:]
+	var found time.Time
+	used, ok := 0, false
+	for n := 0; n < maxDateWords && i+n < len(words); n++ {
+		if n > 0 {
+			value += " " + words[i+n]
+		}
+		if t, parsed := Date(value, now); parsed {
+			found, used, ok = t, n, true
+		}
+	}
+	return found, used, ok
+}
+
+// StartOf turns a parsed date into the moment a deferred task appears: the
+// start of the day, unless a time was given
+func StartOf(t time.Time) time.Time {
+	if model.HasClock(t) {
+		return t
+	}
+	return model.StartOfDay(t)
+}
+
+// Priority accepts a priority name or its short form
+func Priority(s string) (model.Priority, bool) {
+	switch strings.ToLower(s) {
+	case "low", "l":
+		return model.PriorityLow, true
+	case "medium", "med", "m":
+		return model.PriorityMedium, true
+	case "high", "hi", "h":
+		return model.PriorityHigh, true
+	case "urgent", "u":
+		return model.PriorityUrgent, true
+	}
+	return "", false
+}
+
+// HasFields reports whether the line set anything besides the title
+func (t Task) HasFields() bool {
+	return t.Project != "" || len(t.Tags) > 0 || t.Priority != "" ||
+		t.Due != nil || t.Start != nil || t.Estimate != nil
+}
+
+// Summary lists the fields the line sets, for previewing it while typing
+func (t Task) Summary() string {
+	var parts []string
+	if t.Project != "" {
+		parts = append(parts, "#"+t.Project)
+	}
+	parts = append(parts, t.Tags...)
+	if t.Priority != "" {
+		parts = append(parts, "!"+string(t.Priority))
+	}
+	if t.Due != nil {
+		parts = append(parts, "due "+Describe(*t.Due))
+	}
+	if t.Start != nil {
+		parts = append(parts, "starts "+Describe(*t.Start))
+	}
+	if t.Estimate != nil {
+		parts = append(parts, "~"+model.FormatEstimate(*t.Estimate))
+	}
+	return strings.Join(parts, "  ")
+}
+
+// Describe writes a date in full for previews, so a misread is obvious
+func Describe(t time.Time) string {
+	layout := "Mon, Jan 2"
+	if t.Year() != time.Now().Year() {
+		layout = "Mon, Jan 2 2006"
+	}
+	if model.HasClock(t) {
+		layout += " 15:04"
+	}
+	return t.Format(layout)
+}
@@ -32,6 +32,7 @@ type KeyMap struct {
 	Schedule key.Binding
 	Recur    key.Binding
 	Undo     key.Binding
+	Redo     key.Binding
 
 	// Views
 	ListView       key.Binding
@@ -42,9 +43,12 @@ type KeyMap struct {
 	PlanningView   key.Binding
 	ReviewView     key.Binding
 	StatsView      key.Binding
+	TimesheetView  key.Binding
 
 	// Power User
 	Search       key.Binding
+	GlobalSearch key.Binding
+	ShowDeferred key.Binding
 	Command      key.Binding
 	Help         key.Binding
 	Focus        key.Binding
@@ -148,8 +152,12 @@ func DefaultKeyMap() KeyMap {
 			key.WithHelp("r", "recurrence"),
 		),
 		Undo: key.NewBinding(
-			key.WithKeys("u"),
-			key.WithHelp("u", "undo"),
+			key.WithKeys("ctrl+z"),
+			key.WithHelp("ctrl+z", "undo"),
+		),
+		Redo: key.NewBinding(
+			key.WithKeys("ctrl+y", "ctrl+shift+z"),
+			key.WithHelp("ctrl+y", "redo"),
 		),
 
 		// Views
@@ -185,12 +193,24 @@ func DefaultKeyMap() KeyMap {
 			key.WithKeys("8"),
 			key.WithHelp("8", "stats"),
 		),
+		TimesheetView: key.NewBinding(
+			key.WithKeys("9"),
+			key.WithHelp("9", "timesheet"),
+		),
 
 		// Power User
 		Search: key.NewBinding(
 			key.WithKeys("/"),
 			key.WithHelp("/", "search"),
 		),
+		GlobalSearch: key.NewBinding(
+			key.WithKeys("ctrl+f"),
+			key.WithHelp("C-f", "search all"),
+		),
+		ShowDeferred: key.NewBinding(
+			key.WithKeys("D"),
+			key.WithHelp("D", "deferred"),
+		),
 		Command: key.NewBinding(
 			key.WithKeys(":"),
 			key.WithHelp(":", "command"),
@@ -249,8 +269,8 @@ func (k KeyMap) FullHelp() [][]key.Binding {
 		{k.Add, k.Edit, k.Delete, k.Toggle},
 		{k.Move, k.Tag, k.Priority, k.Schedule},
 		{k.ListView, k.KanbanView, k.EisenhowerView, k.CalendarView},
-		{k.PomodoroView, k.PlanningView, k.ReviewView, k.StatsView},
-		{k.Search, k.Command, k.Focus, k.Undo},
+		{k.PomodoroView, k.PlanningView, k.ReviewView, k.StatsView, k.TimesheetView},
+		{k.Search, k.GlobalSearch, k.ShowDeferred, k.Command, k.Focus, k.Undo, k.Redo},
 		{k.Help, k.Quit},
 	}
 }
@@ -1,6 +1,9 @@
 package ui
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/dori/klonch/internal/model"
 )
 
@@ -16,6 +19,7 @@ const (
 	ViewPlanning
 	ViewReview
 	ViewStats
+	ViewTimesheet
 	ViewFocus
 	ViewHelp
 )
@@ -39,6 +43,8 @@ func (v View) String() string {
 		return "Review"
 	case ViewStats:
 		return "Stats"
+	case ViewTimesheet:
+		return "Timesheet"
 	case ViewFocus:
 		return "Focus"
 	case ViewHelp:
@@ -48,6 +54,25 @@ func (v View) String() string {
 	}
 }
 
+// ViewNames returns the names ParseView accepts, in tab order
+func ViewNames() []string {
+	var names []string
+	for v := ViewList; v < ViewHelp; v++ {
+		names = append(names, strings.ToLower(v.String()))
+	}
+	return names
+}
+
+// ParseView looks up a view by name, ignoring case
+func ParseView(name string) (View, error) {
+	for v := ViewList; v < ViewHelp; v++ {
+		if strings.EqualFold(v.String(), name) {
+			return v, nil
+		}
+	}
+	return ViewList, fmt.Errorf("unknown view %q (available: %s)", name, strings.Join(ViewNames(), ", "))
+}
+
 // Messages for inter-component communication
 
 // SwitchViewMsg requests a view change
@@ -108,6 +133,13 @@ type StatusMsg struct {
 	Message string
 }
 
+// HistoryMsg reports the result of an undo or redo
+type HistoryMsg struct {
+	Label string
+	Redo  bool
+	Err   error
+}
+
 // ThemeChangedMsg indicates the theme was changed
 type ThemeChangedMsg struct {
 	ThemeName string
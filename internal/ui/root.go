@@ -1,15 +1,21 @@
 package ui
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/dori/klonch/internal/app"
+	"github.com/dori/klonch/internal/db"
+	"github.com/dori/klonch/internal/idle"
+	"github.com/dori/klonch/internal/model"
+	"github.com/dori/klonch/internal/notify"
 	"github.com/dori/klonch/internal/ui/theme"
 	"github.com/dori/klonch/internal/ui/views"
 )
@@ -47,24 +53,93 @@ type RootModel struct {
 	planningView    views.PlanningView
 	reviewView      views.ReviewView
 	statsView       views.StatsView
+	timesheetView   views.TimesheetView
 	focusView       views.FocusView
 	helpVisible     bool
 
+	// Global search overlay, drawn over whichever view is open
+	searchView    views.SearchView
+	searchVisible bool
+
+	// The timer running in the database, shown in the header whichever
+	// view started it. timerTick tells the current tick loop from stale ones.
+	timer     views.RunningTimerMsg
+	timerTick int
+
+	// Asks what to do with a timer found running at startup
+	timerPrompt        views.TimerPrompt
+	timerPromptVisible bool
+
+	// Notices time away while a timer runs, and asks what to do with it
+	idleWatch         idle.Watch
+	idleSource        *idle.Desktop
+	idlePrompt        views.IdlePrompt
+	idlePromptVisible bool
+
 	// Status message
 	statusMsg   string
 	errorMsg    string
+
+	// Setting changes, delivered as db.SettingChange messages
+	settingsCh <-chan db.SettingChange
+
+	// Last seen data_version; a change means another process wrote to the
+	// database. staleView defers the reload while the user is typing.
+	dataVersion int64
+	staleView   bool
+}
+
+// Options controls how the TUI starts. Empty fields fall back to the saved settings.
+type Options struct {
+	View      string      // Starting view name, see ParseView
+	FocusTask *model.Task // Start in focus mode on this task
+	Theme     string      // Theme for this session; not saved
 }
 
 // NewRootModel creates a new root model
-func NewRootModel(application *app.App) RootModel {
+func NewRootModel(application *app.App, opts Options) RootModel {
 	h := help.New()
 	h.ShowAll = false
 
+	// Restore the saved theme and the view that was open last, unless the
+	// command line asked for something else
+	themeName := opts.Theme
+	if themeName == "" {
+		themeName, _ = application.DB.GetSetting(db.SettingTheme)
+	}
+	if t, ok := theme.ByName(themeName); ok {
+		theme.SetTheme(t)
+	}
+
+	startView := ViewList
+	if opts.FocusTask != nil {
+		startView = ViewFocus
+	} else if opts.View != "" {
+		if v, err := ParseView(opts.View); err == nil {
+			startView = v
+		}
+	} else if name, err := application.DB.GetSetting(db.SettingLastView); err == nil {
+		for v, n := range persistedViews {
+			if n == name {
+				startView = v
+			}
+		}
+	}
+
+	focusView := views.NewFocusView(application.DB, application.Notifier)
+	if opts.FocusTask != nil {
+		focusView = focusView.SetTask(opts.FocusTask)
+	}
+
+	dataVersion, _ := application.DB.DataVersion()
+
 	return RootModel{
 		app:            application,
+		dataVersion:    dataVersion,
 		keys:           DefaultKeyMap(),
 		help:           h,
-		currentView:    ViewList,
+		currentView:    startView,
+		settingsCh:     application.DB.SubscribeSettings(),
 		listView:       views.NewListView(application.DB),
 		kanbanView:     views.NewKanbanView(application.DB),
 		eisenhowerView: views.NewEisenhowerView(application.DB),
@@ -73,16 +148,23 @@ func NewRootModel(application *app.App) RootModel {
 		planningView:   views.NewPlanningView(application.DB),
 		reviewView:     views.NewReviewView(application.DB),
 		statsView:      views.NewStatsView(application.DB),
-		focusView:      views.NewFocusView(application.DB, application.Notifier),
+		timesheetView:  views.NewTimesheetView(application.DB),
+		focusView:      focusView,
+		searchView:     views.NewSearchView(application.DB),
+		timerPrompt:    views.NewTimerPrompt(application.DB),
+		idleSource:     idle.NewDesktop(),
+		idlePrompt:     views.NewIdlePrompt(application.DB),
 	}
 }
 
 // Init initializes the model
 func (m RootModel) Init() tea.Cmd {
 	// Initialize the current view
-	cmd := m.listView.Init()
+	cmd := m.reloadView()
 	rootDebugf("RootModel.Init() returning cmd: %v", cmd != nil)
-	return cmd
+	return tea.Batch(cmd, waitForSettingChange(m.settingsCh), watchDataVersion(m.app.DB),
+		checkReminders(m.app.DB, m.app.Notifier, 0), views.LoadRunningTimer(m.app.DB, true),
+		checkIdle(m.app.DB, m.app.Notifier, m.idleSource, 0))
 }
 
 // Update handles messages
@@ -107,36 +189,56 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.planningView = m.planningView.SetSize(m.width, contentHeight)
 		m.reviewView = m.reviewView.SetSize(m.width, contentHeight)
 		m.statsView = m.statsView.SetSize(m.width, contentHeight)
+		m.timesheetView = m.timesheetView.SetSize(m.width, contentHeight)
 		m.focusView = m.focusView.SetSize(m.width, contentHeight)
+		m.searchView = m.searchView.SetSize(m.width, contentHeight)
+		m.timerPrompt = m.timerPrompt.SetSize(m.width, contentHeight)
+		m.idlePrompt = m.idlePrompt.SetSize(m.width, contentHeight)
 
 	case tea.KeyMsg:
 		// Clear status/error on any keypress
 		m.statusMsg = ""
 		m.errorMsg = ""
 
-		// Check if current view is in input mode
-		isInputMode := false
-		switch m.currentView {
-		case ViewList:
-			isInputMode = m.listView.IsInputMode()
-		case ViewKanban:
-			isInputMode = m.kanbanView.IsInputMode()
-		case ViewEisenhower:
-			isInputMode = m.eisenhowerView.IsInputMode()
-		case ViewCalendar:
-			isInputMode = m.calendarView.IsInputMode()
-		case ViewPomodoro:
-			isInputMode = m.pomodoroView.IsInputMode()
-		case ViewPlanning:
-			isInputMode = m.planningView.IsInputMode()
-		case ViewReview:
-			isInputMode = m.reviewView.IsInputMode()
-		case ViewStats:
-			isInputMode = m.statsView.IsInputMode()
-		case ViewFocus:
-			isInputMode = m.focusView.IsInputMode()
+		// Coming back to a running timer asks about the time away; the key
+		// that noticed only closes the gap
+		if away, ok := m.idleWatch.Input(time.Now()); ok && m.promptIdle(away) {
+			return m, nil
+		}
+
+		// The search overlay takes every key while it is open
+		if m.searchVisible {
+			if msg.String() == "ctrl+c" {
+				return m, tea.Quit
+			}
+			var cmd tea.Cmd
+			m.searchView, cmd = m.searchView.Update(msg)
+			return m, cmd
+		}
+
+		// So does the running timer prompt
+		if m.timerPromptVisible {
+			if msg.String() == "ctrl+c" {
+				return m, tea.Quit
+			}
+			var cmd tea.Cmd
+			m.timerPrompt, cmd = m.timerPrompt.Update(msg)
+			return m, cmd
+		}
+
+		// And the idle prompt
+		if m.idlePromptVisible {
+			if msg.String() == "ctrl+c" {
+				return m, tea.Quit
+			}
+			var cmd tea.Cmd
+			m.idlePrompt, cmd = m.idlePrompt.Update(msg)
+			return m, cmd
 		}
 
+		// Check if current view is in input mode
+		isInputMode := m.isInputMode()
+
 		// Global keybindings
 		switch {
 		case key.Matches(msg, m.keys.Quit):
@@ -148,8 +250,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		case key.Matches(msg, m.keys.ThemeCycle):
 			// ctrl+t always works (unlikely to type)
-			m.cycleTheme()
-			return m, nil
+			return m, m.cycleTheme()
 		}
 
 		// Skip other global keys when in input mode
@@ -164,31 +265,52 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.help.ShowAll = m.helpVisible
 			return m, nil
 
-		// View switching (1-8 keys)
+		case key.Matches(msg, m.keys.GlobalSearch):
+			var cmd tea.Cmd
+			m.searchVisible = true
+			m.helpVisible = false
+			m.searchView, cmd = m.searchView.Open()
+			return m, cmd
+
+		case key.Matches(msg, m.keys.ShowDeferred):
+			shown, _ := m.app.DB.GetBoolSetting(db.SettingShowDeferred)
+			show := !shown
+			if show {
+				m.statusMsg = "Showing deferred tasks"
+			} else {
+				m.statusMsg = "Hiding deferred tasks"
+			}
+			return m, m.saveSetting(db.SettingShowDeferred, db.FormatBoolSetting(show))
+
+		case key.Matches(msg, m.keys.Undo):
+			return m, m.undo(false)
+		case key.Matches(msg, m.keys.Redo):
+			return m, m.undo(true)
+
+		// View switching (1-9 keys)
 		case key.Matches(msg, m.keys.ListView):
-			m.currentView = ViewList
-			return m, m.listView.Init() // Reload tasks when switching to list
+			return m.switchView(ViewList) // Reload tasks when switching to list
 		case key.Matches(msg, m.keys.KanbanView):
-			m.currentView = ViewKanban
-			return m, m.kanbanView.Init()
+			return m.switchView(ViewKanban)
 		case key.Matches(msg, m.keys.EisenhowerView):
-			m.currentView = ViewEisenhower
-			return m, m.eisenhowerView.Init()
+			return m.switchView(ViewEisenhower)
 		case key.Matches(msg, m.keys.CalendarView):
-			m.currentView = ViewCalendar
-			return m, m.calendarView.Init()
+			return m.switchView(ViewCalendar)
 		case key.Matches(msg, m.keys.PomodoroView):
-			m.currentView = ViewPomodoro
-			return m, m.pomodoroView.Init()
+			return m.switchView(ViewPomodoro)
 		case key.Matches(msg, m.keys.PlanningView):
-			m.currentView = ViewPlanning
-			return m, m.planningView.Init()
+			return m.switchView(ViewPlanning)
 		case key.Matches(msg, m.keys.ReviewView):
-			m.currentView = ViewReview
-			return m, m.reviewView.Init()
+			return m.switchView(ViewReview)
 		case key.Matches(msg, m.keys.StatsView):
-			m.currentView = ViewStats
-			return m, m.statsView.Init()
+			return m.switchView(ViewStats)
+		case key.Matches(msg, m.keys.TimesheetView):
+			return m.switchView(ViewTimesheet)
+		}
+
+	case tea.MouseMsg:
+		if away, ok := m.idleWatch.Input(time.Now()); ok && m.promptIdle(away) {
+			return m, nil
 		}
 
 	case ErrorMsg:
@@ -199,6 +321,97 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.statusMsg = msg.Message
 		return m, nil
 
+	case dataVersionMsg:
+		if msg.err == nil && msg.version != m.dataVersion {
+			m.dataVersion = msg.version
+			m.staleView = true
+		}
+		cmd := watchDataVersion(m.app.DB)
+		if m.staleView {
+			// Another process, e.g. klonch timer stop, may have changed the timer
+			cmd = tea.Batch(cmd, views.LoadRunningTimer(m.app.DB, false))
+		}
+		if m.staleView && !m.isInputMode() {
+			m.staleView = false
+			cmd = tea.Batch(cmd, m.reloadView())
+		}
+		return m, cmd
+
+	case remindersMsg:
+		cmd := checkReminders(m.app.DB, m.app.Notifier, reminderCheckInterval)
+		switch {
+		case msg.err != nil:
+			m.errorMsg = "Reminders: " + msg.err.Error()
+		case len(msg.missed) > 0:
+			m.statusMsg = missedRemindersStatus(msg.missed)
+		}
+		return m, cmd
+
+	case HistoryMsg:
+		switch {
+		case msg.Err == db.ErrNothingToUndo:
+			m.statusMsg = "Nothing to undo"
+			return m, nil
+		case msg.Err == db.ErrNothingToRedo:
+			m.statusMsg = "Nothing to redo"
+			return m, nil
+		case msg.Err != nil:
+			m.errorMsg = msg.Err.Error()
+			return m, nil
+		case msg.Redo:
+			m.statusMsg = "Redid: " + msg.Label
+		default:
+			m.statusMsg = "Undid: " + msg.Label
+		}
+		// The journal may have touched anything, so reload what's on screen
+		return m, tea.Batch(m.reloadView(), views.LoadRunningTimer(m.app.DB, false))
+
+	case views.TimerChangedMsg:
+		return m, views.LoadRunningTimer(m.app.DB, false)
+
+	case views.RunningTimerMsg:
+		return m.followTimer(msg)
+
+	case timerTickMsg:
+		if msg.tick != m.timerTick || m.timer.Entry == nil {
+			return m, nil
+		}
+		return m, timerTick(m.timerTick)
+
+	case idleMsg:
+		return m.handleIdle(msg)
+
+	case views.EditorClosedMsg:
+		// Time spent in the editor isn't time away; the view saves the edit
+		m.idleWatch.Reset(time.Now())
+
+	case views.IdlePromptClosedMsg:
+		m.idlePromptVisible = false
+		if msg.Err != nil {
+			m.errorMsg = "Timer: " + msg.Err.Error()
+		} else {
+			m.statusMsg = msg.Status
+		}
+		return m, views.LoadRunningTimer(m.app.DB, false)
+
+	case views.TimerPromptClosedMsg:
+		m.timerPromptVisible = false
+		switch {
+		case msg.Err != nil:
+			m.errorMsg = "Timer: " + msg.Err.Error()
+		case msg.Resume && msg.Task != nil:
+			// Carry on where the timer can be paused and stopped
+			m.statusMsg = "Timer resumed"
+			m.focusView = m.focusView.SetTask(msg.Task)
+			m.currentView = ViewFocus
+			return m, m.focusView.Init()
+		case msg.Resume:
+			m.statusMsg = "Timer resumed"
+		default:
+			m.statusMsg = msg.Status
+		}
+		return m, views.LoadRunningTimer(m.app.DB, false)
+
 	case ThemeChangedMsg:
 		m.statusMsg = fmt.Sprintf("Theme: %s", msg.ThemeName)
 		return m, nil
@@ -214,26 +427,62 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.currentView = ViewFocus
 		return m, m.focusView.Init()
 
+	case views.SearchClosedMsg:
+		m.searchVisible = false
+		return m, nil
+
+	case views.SearchJumpRequest:
+		m.searchVisible = false
+		return m.jumpToTask(msg.Task, msg.Ancestors)
+
 	case views.BackToListMsg:
 		// Return from focus view to list view
 		m.currentView = ViewList
 		return m, m.listView.Init()
 
 	case SwitchViewMsg:
-		m.currentView = msg.View
-		switch msg.View {
-		case ViewList:
-			return m, m.listView.Init()
-		case ViewKanban:
-			return m, m.kanbanView.Init()
-		case ViewEisenhower:
-			return m, m.eisenhowerView.Init()
-		case ViewCalendar:
-			return m, m.calendarView.Init()
-		case ViewStats:
-			return m, m.statsView.Init()
+		return m.switchView(msg.View)
+
+	case db.SettingChange:
+		// Re-arm the subscription, apply global settings and keep the list
+		// view in sync even when it isn't on screen
+		cmds = append(cmds, waitForSettingChange(m.settingsCh))
+		switch msg.Key {
+		case db.SettingTheme:
+			if t, ok := theme.ByName(msg.Value); ok {
+				theme.SetTheme(t)
+			}
+		case db.SettingMouse:
+			if msg.Value == "on" {
+				cmds = append(cmds, tea.EnableMouseCellMotion)
+			} else {
+				cmds = append(cmds, tea.DisableMouse)
+			}
+		case db.SettingShowDeferred:
+			if m.currentView != ViewList {
+				cmds = append(cmds, m.reloadView())
+			}
+		case db.SettingNotifyBackends, db.SettingNotifyCommand, db.SettingNotifyURL, db.SettingNotifyToken:
+			if err := m.app.Notifier.Configure(app.NotifyConfig(m.app.DB, m.app.Terminal())); err != nil {
+				m.errorMsg = "Notifications: " + err.Error()
+			}
 		}
-		return m, nil
+		if strings.HasPrefix(msg.Key, "pomodoro.") {
+			newPomodoroView, cmd := m.pomodoroView.Update(msg)
+			m.pomodoroView = newPomodoroView.(views.PomodoroView)
+			cmds = append(cmds, cmd)
+		}
+		newListView, cmd := m.listView.Update(msg)
+		m.listView = newListView.(views.ListView)
+		cmds = append(cmds, cmd)
+		return m, tea.Batch(cmds...)
+	}
+
+	// Search results and cursor blinks for the overlay
+	if m.searchVisible {
+		var cmd tea.Cmd
+		m.searchView, cmd = m.searchView.Update(msg)
+		cmds = append(cmds, cmd)
 	}
 
 	// Delegate to current view
@@ -273,15 +522,84 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		newStatsView, cmd := m.statsView.Update(msg)
 		m.statsView = newStatsView.(views.StatsView)
 		cmds = append(cmds, cmd)
+	case ViewTimesheet:
+		newTimesheetView, cmd := m.timesheetView.Update(msg)
+		m.timesheetView = newTimesheetView.(views.TimesheetView)
+		cmds = append(cmds, cmd)
 	case ViewFocus:
 		newFocusView, cmd := m.focusView.Update(msg)
 		m.focusView = newFocusView.(views.FocusView)
 		cmds = append(cmds, cmd)
 	}
 
+	// Running timers keep ticking, and Pomodoro sessions keep ending on
+	// time, while their view is hidden
+	switch msg.(type) {
+	case tea.KeyMsg, tea.MouseMsg:
+	default:
+		if m.currentView != ViewPomodoro && m.pomodoroView.IsTimerActive() {
+			newPomodoroView, cmd := m.pomodoroView.Update(msg)
+			m.pomodoroView = newPomodoroView.(views.PomodoroView)
+			cmds = append(cmds, cmd)
+		}
+		if m.currentView != ViewFocus && m.focusView.IsTimerRunning() {
+			newFocusView, cmd := m.focusView.Update(msg)
+			m.focusView = newFocusView.(views.FocusView)
+			cmds = append(cmds, cmd)
+		}
+	}
+
 	return m, tea.Batch(cmds...)
 }
 
+// followTimer records the running timer for the header and hands it to the
+// views that run timers, so they follow it whichever view started it. A
+// timer found at startup resumes in the Pomodoro view if it is a session,
+// and otherwise asks whether it should still be running.
+func (m RootModel) followTimer(msg views.RunningTimerMsg) (tea.Model, tea.Cmd) {
+	if msg.Err != nil {
+		m.errorMsg = "Timer: " + msg.Err.Error()
+		return m, nil
+	}
+
+	var cmds []tea.Cmd
+	if m.timer.Entry == nil && msg.Entry != nil {
+		m.timerTick++
+		cmds = append(cmds, timerTick(m.timerTick))
+		m.idleWatch.Reset(time.Now())
+	}
+	m.timer = msg
+
+	if msg.Restored && msg.Entry != nil {
+		if msg.Entry.IsPomodoro {
+			m.currentView = ViewPomodoro
+			m.statusMsg = "Pomodoro still running since " + msg.Entry.StartedAt.Format("15:04")
+			cmds = append(cmds, m.pomodoroView.Init())
+		} else {
+			m.timerPrompt = m.timerPrompt.Open(msg.Entry, msg.Task)
+			m.timerPromptVisible = true
+			m.helpVisible = false
+		}
+	}
+
+	newPomodoroView, cmd := m.pomodoroView.Update(msg)
+	m.pomodoroView = newPomodoroView.(views.PomodoroView)
+	cmds = append(cmds, cmd)
+	newFocusView, cmd := m.focusView.Update(msg)
+	m.focusView = newFocusView.(views.FocusView)
+	cmds = append(cmds, cmd)
+	return m, tea.Batch(cmds...)
+}
+
+// timerTickMsg redraws the header timer
+type timerTickMsg struct{ tick int }
+
+func timerTick(tick int) tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg {
+		return timerTickMsg{tick: tick}
+	})
+}
+
 // View renders the UI
 func (m RootModel) View() string {
 	if m.width == 0 || m.height == 0 {
@@ -303,7 +621,13 @@ func (m RootModel) View() string {
 	}
 	var content string
 
-	if m.helpVisible {
+	if m.timerPromptVisible {
+		content = m.timerPrompt.View()
+	} else if m.idlePromptVisible {
+		content = m.idlePrompt.View()
+	} else if m.searchVisible {
+		content = m.searchView.View()
+	} else if m.helpVisible {
 		content = m.renderHelp(contentHeight)
 	} else {
 		switch m.currentView {
@@ -323,6 +647,8 @@ func (m RootModel) View() string {
 			content = m.reviewView.View()
 		case ViewStats:
 			content = m.statsView.View()
+		case ViewTimesheet:
+			content = m.timesheetView.View()
 		case ViewFocus:
 			content = m.focusView.View()
 		default:
@@ -363,6 +689,9 @@ func (m RootModel) renderHeader() string {
 	// Combine header elements
 	leftSide := lipgloss.JoinHorizontal(lipgloss.Center, title, viewIndicator)
 	rightSide := themeIndicator
+	if timer := m.renderTimer(); timer != "" {
+		rightSide = timer + themeIndicator
+	}
 
 	gap := m.width - lipgloss.Width(leftSide) - lipgloss.Width(rightSide)
 	if gap < 0 {
@@ -373,6 +702,36 @@ func (m RootModel) renderHeader() string {
 	return header
 }
 
+// renderTimer shows the running timer: elapsed time, or what's left of a
+// Pomodoro session, and its task
+func (m RootModel) renderTimer() string {
+	e := m.timer.Entry
+	if e == nil {
+		return ""
+	}
+	t := theme.Current.Theme
+
+	elapsed := e.Elapsed(time.Now())
+	text := "⏱ " + views.FormatTimer(elapsed)
+	color := t.Success
+	if e.IsPomodoro && m.timer.Length > 0 {
+		text = "🍅 " + views.FormatTimer(m.timer.Length-elapsed)
+		color = t.Error
+	}
+	if m.timer.Task != nil {
+		title := m.timer.Task.Title
+		if len([]rune(title)) > 24 {
+			title = string([]rune(title)[:23]) + "…"
+		}
+		text += " " + title
+	}
+	if e.IsPaused() {
+		text += " (paused)"
+		color = t.Warning
+	}
+	return lipgloss.NewStyle().Foreground(color).Padding(0, 1).Render(text)
+}
+
 // renderFooter renders the footer/status bar
 func (m RootModel) renderFooter() string {
 	styles := theme.Current.Styles
@@ -398,7 +757,10 @@ func (m RootModel) renderFooter() string {
 	switch m.currentView {
 	case ViewList:
 		// Check if list view is in a special mode
-		if m.listView.IsInputMode() {
+		if m.listView.IsEditingNotes() {
+			line1 = key("ctrl+s", "save") + sep + key("ctrl+e", "$EDITOR") + sep + key("esc", "cancel")
+			line2 = ""
+		} else if m.listView.IsInputMode() {
 			line1 = key("enter", "confirm") + sep + key("esc", "cancel")
 			line2 = ""
 		} else {
@@ -407,6 +769,7 @@ func (m RootModel) renderFooter() string {
 				key("enter", "edit") + sep +
 				key("tab", "done") + sep +
 				key("d", "del") + sep +
+				key("c", "comment") + sep +
 				key("^z/^y", "undo") + sep +
 				key(":", "cmd")
 			// Secondary actions
@@ -414,6 +777,7 @@ func (m RootModel) renderFooter() string {
 				key("m", "move") + sep +
 				key("t", "tag") + sep +
 				key("s/P", "sub/parent") + sep +
+				key("i/n/e", "details/notes/editor") + sep +
 				key("?", "help")
 		}
 
@@ -422,8 +786,10 @@ func (m RootModel) renderFooter() string {
 			key("j/k", "navigate") + sep +
 			key("H/L", "move task") + sep +
 			key("enter", "toggle done")
-		line2 = key("1-4", "views") + sep +
-			key("ctrl+t", "theme") + sep +
+		line2 = key("w", "swimlanes") + sep +
+			key("z/Z", "fold lanes") + sep +
+			key("W", "WIP limit") + sep +
+			key("1-4", "views") + sep +
 			key("?", "help")
 
 	case ViewEisenhower:
@@ -449,7 +815,7 @@ func (m RootModel) renderFooter() string {
 			key("B", "long break")
 		line2 = key("j/k", "select task") + sep +
 			key("enter", "pick task") + sep +
-			key("1-8", "views") + sep +
+			key("1-9", "views") + sep +
 			key("?", "help")
 
 	case ViewPlanning:
@@ -460,7 +826,7 @@ func (m RootModel) renderFooter() string {
 		line2 = key("tab", "section") + sep +
 			key("space", "select") + sep +
 			key("j/k", "navigate") + sep +
-			key("1-8", "views")
+			key("1-9", "views")
 
 	case ViewReview:
 		line1 = key("n", "next week") + sep +
@@ -471,21 +837,43 @@ func (m RootModel) renderFooter() string {
 		line2 = key("tab", "section") + sep +
 			key("space", "select") + sep +
 			key("j/k", "navigate") + sep +
-			key("1-8", "views")
+			key("1-9", "views")
 
 	case ViewStats:
 		line1 = key("w", "week") + sep +
 			key("m", "month") + sep +
 			key("y", "year") + sep +
-			key("r", "refresh")
-		line2 = key("1-8", "views") + sep +
+			key("r", "refresh") + sep +
+			key("tab", "flow")
+		line2 = key("1-9", "views") + sep +
 			key("ctrl+t", "theme") + sep +
 			key("?", "help")
 
+	case ViewTimesheet:
+		if m.timesheetView.IsInputMode() {
+			line1 = key("enter", "confirm") + sep + key("esc", "cancel")
+			line2 = ""
+		} else {
+			line1 = key("e", "edit") + sep +
+				key("a", "add") + sep +
+				key("m", "move") + sep +
+				key("s", "split") + sep +
+				key("d", "delete")
+			line2 = key("h/l", "prev/next") + sep +
+				key("w", "day/week") + sep +
+				key("t", "today") + sep +
+				key("tab", "totals") + sep +
+				key("1-9", "views")
+		}
+
 	case ViewFocus:
+		if m.focusView.IsCommenting() {
+			line1 = key("enter", "add comment") + sep + key("esc", "cancel")
+			break
+		}
 		if m.focusView.IsTimerRunning() {
 			line1 = key("space", "pause") + sep +
-				key("s", "stop+save") + sep +
+				key("S", "stop+save") + sep +
 				key("x", "discard")
 		} else {
 			line1 = key("space", "start") + sep +
@@ -494,8 +882,10 @@ func (m RootModel) renderFooter() string {
 		}
 		line2 = key("tab", "done") + sep +
 			key("j/k", "subtasks") + sep +
+			key("e", "edit") + sep +
+			key("c", "comment") + sep +
 			key("esc", "back") + sep +
-			key("1-8", "views")
+			key("1-9", "views")
 
 	default:
 		line1 = key("1-5", "views") + sep + key("?", "help")
@@ -588,6 +978,10 @@ func (m RootModel) renderHelp(height int) string {
 	actionKeys := [][]string{
 		{"a", "Add new task"},
 		{"enter", "Edit task"},
+		{"e", "Edit task and notes in $EDITOR"},
+		{"n", "Write notes (ctrl+s saves, ctrl+e opens $EDITOR)"},
+		{"i", "Show/hide the detail pane"},
+		{"c", "Comment on task"},
 		{"tab", "Toggle done/pending"},
 		{"d", "Delete task(s)"},
 		{"p", "Cycle priority"},
@@ -595,9 +989,9 @@ func (m RootModel) renderHelp(height int) string {
 		{"t", "Add/remove tags"},
 		{"b", "Set dependency (blocked by)"},
 		{"f", "Focus mode"},
-		{"r", "Refresh tasks"},
-		{"ctrl+z", "Undo"},
-		{"ctrl+y", "Redo"},
+		{"r", "Edit recurrence"},
+		{"R", "Refresh tasks"},
+		{"J / K", "Move task down/up (manual order)"},
 	}
 	for _, kv := range actionKeys {
 		b.WriteString(keyStyle.Render(kv[0]))
@@ -628,10 +1022,12 @@ func (m RootModel) renderHelp(height int) string {
 	b.WriteString("\n")
 	filterKeys := [][]string{
 		{"/", "Text search"},
-		{"M", "Filter by project"},
+		{"ctrl+f", "Search all tasks, including done and archived"},
+		{"M", "Filter by project or smart list"},
 		{"T", "Filter by tag(s)"},
 		{"A", "Toggle active/all tasks"},
 		{"H", "Cycle views (all/active/recent)"},
+		{"D", "Show/hide deferred tasks"},
 		{"w", "Toggle text wrap"},
 		{"esc", "Clear filters"},
 	}
@@ -645,7 +1041,7 @@ func (m RootModel) renderHelp(height int) string {
 	b.WriteString(sectionStyle.Render("Views"))
 	b.WriteString("\n")
 	viewKeys := [][]string{
-		{"1-8", "Switch views (list, kanban, eisenhower...)"},
+		{"1-9", "Switch views (list, kanban, eisenhower...)"},
 		{":", "Command palette"},
 		{"?", "Toggle this help"},
 	}
@@ -655,10 +1051,46 @@ func (m RootModel) renderHelp(height int) string {
 		b.WriteString("\n")
 	}
 
+	// Kanban section
+	b.WriteString(sectionStyle.Render("Kanban (2)"))
+	b.WriteString("\n")
+	kanbanKeys := [][]string{
+		{"H / L", "Move task to the previous/next column"},
+		{"w", "Swimlanes: none, project, priority, tag, parent"},
+		{"z / Z", "Fold the current lane, or all lanes"},
+		{"W", "Set the column's WIP limit (0 for none)"},
+	}
+	for _, kv := range kanbanKeys {
+		b.WriteString(keyStyle.Render(kv[0]))
+		b.WriteString(descStyle.Render(kv[1]))
+		b.WriteString("\n")
+	}
+
+	// Timesheet section
+	b.WriteString(sectionStyle.Render("Timesheet (9)"))
+	b.WriteString("\n")
+	timesheetKeys := [][]string{
+		{"h / l", "Previous/next day or week"},
+		{"w / t", "Toggle day/week, go to today"},
+		{"e / enter", "Edit start, end, duration and description"},
+		{"a", "Add an entry"},
+		{"m", "Move entry to another task"},
+		{"s", "Split entry in two"},
+		{"d", "Delete entry"},
+		{"tab", "Totals by project and task"},
+	}
+	for _, kv := range timesheetKeys {
+		b.WriteString(keyStyle.Render(kv[0]))
+		b.WriteString(descStyle.Render(kv[1]))
+		b.WriteString("\n")
+	}
+
 	// System section
 	b.WriteString(sectionStyle.Render("System"))
 	b.WriteString("\n")
 	sysKeys := [][]string{
+		{"ctrl+z", "Undo last change (kept across restarts)"},
+		{"ctrl+y", "Redo"},
 		{"ctrl+t", "Cycle theme"},
 		{"q / ctrl+c", "Quit"},
 	}
@@ -678,10 +1110,13 @@ func (m RootModel) renderHelp(height int) string {
 	b.WriteString("\n")
 	taskCmds := [][]string{
 		{":due <date>", "Set due date (tomorrow, fri, 2024-01-15)"},
+		{":defer <date>", "Hide until a start date (none clears it)"},
+		{":estimate <time>", "Set time estimate (45m, 1h30m, none)"},
 		{":priority <p>", "Set priority (low/medium/high/urgent)"},
 		{":tag <name>", "Add tag to task(s)"},
 		{":project <name>", "Move to project"},
 		{":parent", "Set parent task"},
+		{":repeat <rule>", "Set recurrence (weekly on mon, monthly on the 15th)"},
 		{":done", "Toggle done status"},
 		{":archive", "Archive task(s)"},
 	}
@@ -695,10 +1130,13 @@ func (m RootModel) renderHelp(height int) string {
 	b.WriteString(sectionStyle.Render("Filter Commands"))
 	b.WriteString("\n")
 	filterCmds := [][]string{
-		{":filter <text>", "Text search"},
-		{":filterproject", "Filter by project"},
+		{":filter <query>", "Filter with a query (#work @review !high due<+3d)"},
+		{":savelist <name>", "Save the current query as a smart list"},
+		{":deletelist <name>", "Delete a smart list"},
+		{":lists", "Show smart lists"},
+		{":filterproject", "Filter by project or smart list"},
 		{":filtertag", "Filter by tag(s)"},
-		{":sort <field>", "Sort by priority/due/title/status"},
+		{":sort <fields>", "Sort, e.g. due, priority asc (saved per project)"},
 		{":clear", "Clear all filters"},
 	}
 	for _, kv := range filterCmds {
@@ -716,6 +1154,8 @@ func (m RootModel) renderHelp(height int) string {
 		{":projects", "List all projects"},
 		{":tags", "List all tags"},
 		{":theme <name>", "Change theme"},
+		{":set <key> <value>", "Change a setting (list.wrap on, last_view kanban)"},
+		{":settings", "Show all settings"},
 	}
 	for _, kv := range mgmtCmds {
 		b.WriteString(cmdKeyStyle.Render(kv[0]))
@@ -729,7 +1169,7 @@ func (m RootModel) renderHelp(height int) string {
 	timeCmds := [][]string{
 		{":starttime", "Start time tracking"},
 		{":stoptime", "Stop time tracking"},
-		{":addtime <dur>", "Log time (30m, 1h30m)"},
+		{":addtime <dur>", "Log time (30m, 1h30m), then an optional description"},
 	}
 	for _, kv := range timeCmds {
 		b.WriteString(cmdKeyStyle.Render(kv[0]))
@@ -758,8 +1198,99 @@ func (m RootModel) renderHelp(height int) string {
 	return b.String()
 }
 
-// cycleTheme cycles through available themes
-func (m *RootModel) cycleTheme() {
+// undo reverts (or with redo, reapplies) the last journaled change
+func (m RootModel) undo(redo bool) tea.Cmd {
+	database := m.app.DB
+	return func() tea.Msg {
+		var label string
+		var err error
+		if redo {
+			label, err = database.Redo()
+		} else {
+			label, err = database.Undo()
+		}
+		return HistoryMsg{Label: label, Redo: redo, Err: err}
+	}
+}
+
+// reloadView re-initializes the current view so it picks up external changes
+func (m RootModel) reloadView() tea.Cmd {
+	switch m.currentView {
+	case ViewList:
+		return m.listView.Init()
+	case ViewKanban:
+		return m.kanbanView.Init()
+	case ViewEisenhower:
+		return m.eisenhowerView.Init()
+	case ViewCalendar:
+		return m.calendarView.Init()
+	case ViewPomodoro:
+		return m.pomodoroView.Init()
+	case ViewPlanning:
+		return m.planningView.Init()
+	case ViewReview:
+		return m.reviewView.Init()
+	case ViewStats:
+		return m.statsView.Init()
+	case ViewTimesheet:
+		return m.timesheetView.Init()
+	case ViewFocus:
+		return m.focusView.Init()
+	}
+	return nil
+}
+
+// jumpToTask shows a task found by search in the list, with its parents
+// expanded. Archived tasks aren't in the list, so they open in focus mode.
+func (m RootModel) jumpToTask(task model.Task, ancestors []model.Task) (tea.Model, tea.Cmd) {
+	archived := task.Status == model.StatusArchived
+	for _, a := range ancestors {
+		archived = archived || a.Status == model.StatusArchived
+	}
+	if archived {
+		m.focusView = m.focusView.SetTask(&task)
+		m.currentView = ViewFocus
+		return m, m.focusView.Init()
+	}
+
+	var cmd tea.Cmd
+	m.currentView = ViewList
+	m.listView, cmd = m.listView.RevealTask(task, ancestors)
+	return m, tea.Batch(cmd, m.saveSetting(db.SettingLastView, persistedViews[ViewList]))
+}
+
+// isInputMode reports whether the current view is capturing text input
+func (m RootModel) isInputMode() bool {
+	if m.searchVisible || m.timerPromptVisible || m.idlePromptVisible {
+		return true
+	}
+	switch m.currentView {
+	case ViewList:
+		return m.listView.IsInputMode()
+	case ViewKanban:
+		return m.kanbanView.IsInputMode()
+	case ViewEisenhower:
+		return m.eisenhowerView.IsInputMode()
+	case ViewCalendar:
+		return m.calendarView.IsInputMode()
+	case ViewPomodoro:
+		return m.pomodoroView.IsInputMode()
+	case ViewPlanning:
+		return m.planningView.IsInputMode()
+	case ViewReview:
+		return m.reviewView.IsInputMode()
+	case ViewStats:
+		return m.statsView.IsInputMode()
+	case ViewTimesheet:
+		return m.timesheetView.IsInputMode()
+	case ViewFocus:
+		return m.focusView.IsInputMode()
+	}
+	return false
+}
+
+// cycleTheme cycles through available themes and saves the choice
+func (m *RootModel) cycleTheme() tea.Cmd {
 	themes := theme.Available()
 	current := theme.Current.Theme.Name
 
@@ -768,7 +1299,212 @@ func (m *RootModel) cycleTheme() {
 			next := themes[(i+1)%len(themes)]
 			theme.SetTheme(next)
 			m.statusMsg = fmt.Sprintf("Theme: %s", next.Name)
-			return
+			return m.saveSetting(db.SettingTheme, next.Name)
+		}
+	}
+	return nil
+}
+
+// switchView shows a view, reloads its data and remembers it for next launch
+func (m RootModel) switchView(v View) (tea.Model, tea.Cmd) {
+	m.currentView = v
+	cmd := m.reloadView()
+	if name, ok := persistedViews[v]; ok {
+		cmd = tea.Batch(cmd, m.saveSetting(db.SettingLastView, name))
+	}
+	return m, cmd
+}
+
+// persistedViews are the views that can be restored on startup, by setting value.
+// Focus mode is left out because it needs a task.
+var persistedViews = map[View]string{
+	ViewList:       "list",
+	ViewKanban:     "kanban",
+	ViewEisenhower: "eisenhower",
+	ViewCalendar:   "calendar",
+	ViewPomodoro:   "pomodoro",
+	ViewPlanning:   "planning",
+	ViewReview:     "review",
+	ViewStats:      "stats",
+	ViewTimesheet:  "timesheet",
+}
+
+// saveSetting persists a preference in the background
+func (m RootModel) saveSetting(key, value string) tea.Cmd {
+	database := m.app.DB
+	return func() tea.Msg {
+		if err := database.SetSetting(key, value); err != nil {
+			return ErrorMsg{Err: err}
+		}
+		return nil
+	}
+}
+
+// dataVersionPollInterval is how often the TUI checks for writes from other processes
+const dataVersionPollInterval = time.Second
+
+// dataVersionMsg carries the latest data_version
+type dataVersionMsg struct {
+	version int64
+	err     error
+}
+
+// watchDataVersion polls data_version once after the interval
+func watchDataVersion(database *db.DB) tea.Cmd {
+	return tea.Tick(dataVersionPollInterval, func(time.Time) tea.Msg {
+		version, err := database.DataVersion()
+		return dataVersionMsg{version: version, err: err}
+	})
+}
+
+// waitForSettingChange delivers the next setting change as a message
+func waitForSettingChange(ch <-chan db.SettingChange) tea.Cmd {
+	return func() tea.Msg {
+		return <-ch
+	}
+}
+
+// reminderCheckInterval is how often the TUI looks for reminders to send
+const reminderCheckInterval = 30 * time.Second
+
+// remindersMsg reports a reminder check: reminders that went off while
+// klonch wasn't running, and the first failure
+type remindersMsg struct {
+	missed []db.Reminder
+	err    error
+}
+
+// checkReminders sends the reminders that have gone off, after a delay.
+// Missed ones are left for the status bar.
+func checkReminders(database *db.DB, notifier notify.Notifier, delay time.Duration) tea.Cmd {
+	check := func(now time.Time) tea.Msg {
+		reminders, err := database.ClaimReminders(now)
+		if err != nil {
+			return remindersMsg{err: err}
 		}
+		var msg remindersMsg
+		for _, r := range reminders {
+			if r.Missed {
+				msg.missed = append(msg.missed, r)
+				continue
+			}
+			if err := notifier.Send(notify.DueReminder(r.Task.Title, r.Task.DueDate.Sub(now))); err != nil && msg.err == nil {
+				msg.err = err
+			}
+		}
+		return msg
+	}
+	if delay == 0 {
+		return func() tea.Msg { return check(time.Now()) }
+	}
+	return tea.Tick(delay, check)
+}
+
+// idleCheckInterval is how often the TUI asks the desktop how long it has
+// been idle while a timer runs, and looks for timers running too long
+const idleCheckInterval = 15 * time.Second
+
+// idleMsg carries the timer settings, the desktop's idle time if it was
+// asked, and a timer found running too long
+type idleMsg struct {
+	at      time.Time
+	cfg     db.TimerConfig
+	asked   bool
+	idle    time.Duration
+	idleErr error
+	long    *db.TimesheetEntry
+	err     error
+}
+
+// checkIdle asks the desktop how long it has been idle while a timer runs,
+// and warns about a timer running longer than timer.long_after, after a
+// delay. The desktop is only asked with timer.idle_source set to auto.
+func checkIdle(database *db.DB, notifier notify.Notifier, source idle.Source, delay time.Duration) tea.Cmd {
+	check := func(now time.Time) tea.Msg {
+		msg := idleMsg{at: now}
+		if msg.cfg, msg.err = database.TimerConfig(); msg.err != nil {
+			return msg
+		}
+		running, err := database.RunningTimer()
+		if err != nil || running == nil {
+			msg.err = err
+			return msg
+		}
+		if msg.cfg.IdleAfter > 0 && msg.cfg.IdleSource == db.IdleSourceAuto {
+			msg.asked = true
+			msg.idle, msg.idleErr = source.Idle()
+		}
+		if msg.cfg.LongAfter > 0 {
+			msg.long, msg.err = database.ClaimLongTimer(msg.cfg.LongAfter, now)
+			if msg.long != nil {
+				msg.err = notifier.Send(notify.LongTimer(msg.long.TaskTitle, msg.long.Elapsed(now)))
+			}
+		}
+		return msg
+	}
+	if delay == 0 {
+		return func() tea.Msg { return check(time.Now()) }
+	}
+	return tea.Tick(delay, check)
+}
+
+// handleIdle follows the desktop's idle time where there is one, falling
+// back to input to klonch where there isn't, and reports long timers
+func (m RootModel) handleIdle(msg idleMsg) (tea.Model, tea.Cmd) {
+	cmd := checkIdle(m.app.DB, m.app.Notifier, m.idleSource, idleCheckInterval)
+	m.idleWatch.After = msg.cfg.IdleAfter
+	switch {
+	case msg.cfg.IdleSource != db.IdleSourceAuto || errors.Is(msg.idleErr, idle.ErrUnavailable):
+		m.idleWatch.Desktop = false
+	case msg.asked && msg.idleErr == nil:
+		m.idleWatch.Desktop = true
+		if away, ok := m.idleWatch.Idle(msg.idle, msg.at); ok {
+			m.promptIdle(away)
+		}
+	}
+
+	switch {
+	case msg.err != nil:
+		m.errorMsg = "Timer: " + msg.err.Error()
+	case msg.long != nil:
+		m.statusMsg = "Timer running for " + model.FormatEstimate(int(msg.long.Elapsed(msg.at).Minutes()))
+	}
+	return m, cmd
+}
+
+// promptIdle asks what to do with time away, if a timer outside the
+// Pomodoro view counted at least timer.idle_after of it
+func (m *RootModel) promptIdle(away idle.Away) bool {
+	e := m.timer.Entry
+	if e == nil || e.IsPomodoro || e.IsPaused() || m.timerPromptVisible || m.idlePromptVisible {
+		return false
+	}
+	if away.From.Before(e.StartedAt) {
+		away.From = e.StartedAt
+	}
+	if away.Duration() < m.idleWatch.After {
+		return false
+	}
+	m.idlePrompt = m.idlePrompt.Open(e, m.timer.Task, away)
+	m.idlePromptVisible = true
+	m.helpVisible = false
+	m.searchVisible = false
+	return true
+}
+
+// missedRemindersStatus names the tasks whose reminders were missed
+func missedRemindersStatus(missed []db.Reminder) string {
+	const shown = 3
+	var titles []string
+	for i, r := range missed {
+		if i == shown {
+			titles = append(titles, fmt.Sprintf("+%d more", len(missed)-shown))
+			break
+		}
+		titles = append(titles, r.Task.Title)
+	}
+	if len(missed) == 1 {
+		return "Missed reminder: " + titles[0]
 	}
+	return fmt.Sprintf("%d missed reminders: %s", len(missed), strings.Join(titles, ", "))
 }
@@ -62,9 +62,8 @@ func (v CalendarView) SetSize(width, height int) CalendarView {
 // loadTasks loads tasks for the current month
 func (v CalendarView) loadTasks() tea.Cmd {
 	return func() tea.Msg {
-		// Get first and last day of month
 		firstDay := time.Date(v.year, v.month, 1, 0, 0, 0, 0, time.Local)
-		lastDay := firstDay.AddDate(0, 1, 0).Add(-time.Second)
+		nextMonth := firstDay.AddDate(0, 1, 0)
 
 		rows, err := v.db.Query(`
 			SELECT id, title, description, status, priority, due_date
@@ -72,10 +71,9 @@ func (v CalendarView) loadTasks() tea.Cmd {
 			WHERE parent_id IS NULL
 			  AND status != 'archived'
 			  AND due_date IS NOT NULL
-			  AND due_date >= ?
-			  AND due_date <= ?
+			  AND `+db.InRange("due_date")+`
 			ORDER BY due_date, priority DESC
-		`, firstDay.Format("2006-01-02"), lastDay.Format("2006-01-02 23:59:59"))
+		`, db.Timestamp(firstDay), db.Timestamp(nextMonth))
 		if err != nil {
 			return calendarErrorMsg{err: err}
 		}
@@ -93,12 +91,7 @@ func (v CalendarView) loadTasks() tea.Cmd {
 				t.Description = *desc
 			}
 
-			// Parse due date
-			if parsed, err := time.Parse("2006-01-02 15:04:05", dueDate); err == nil {
-				t.DueDate = &parsed
-				day := parsed.Day()
-				tasksByDay[day] = append(tasksByDay[day], t)
-			} else if parsed, err := time.Parse("2006-01-02", dueDate); err == nil {
+			if parsed, ok := db.ParseTimestamp(dueDate); ok {
 				t.DueDate = &parsed
 				day := parsed.Day()
 				tasksByDay[day] = append(tasksByDay[day], t)
@@ -394,6 +387,9 @@ func (v CalendarView) renderTaskList(width, height int) string {
 			}
 
 			line := fmt.Sprintf("%s %s %s", checkbox, priorityChar, taskStyle.Render(title))
+			if task.DueDate != nil && model.HasClock(*task.DueDate) {
+				line += " " + lipgloss.NewStyle().Foreground(t.Subtle).Render(task.DueDate.Format("15:04"))
+			}
 			lines = append(lines, line)
 		}
 	}
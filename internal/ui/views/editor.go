@@ -0,0 +1,71 @@
+package views
+
+import (
+	"fmt"
+	"os"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/dori/klonch/internal/app"
+	"github.com/dori/klonch/internal/db"
+)
+
+// EditorClosedMsg is sent when the editor opened on a task exits. The root
+// model hands it to the view that opened the editor.
+type EditorClosedMsg struct {
+	TaskID   string
+	Document bool   // The whole task was edited, not only its notes
+	Text     string // What the editor saved
+	Changed  bool   // Text differs from what the editor was given
+	Path     string // The file, left in place until the edit is saved
+	Err      error
+}
+
+// EditTaskDocument suspends the TUI to edit a task as a document in the
+// user's editor: the fields as front matter, then the description
+func EditTaskDocument(database *db.DB, taskID string) tea.Cmd {
+	doc, err := database.TaskDocument(taskID)
+	if err != nil {
+		return func() tea.Msg { return EditorClosedMsg{TaskID: taskID, Document: true, Err: err} }
+	}
+	return openEditor(taskID, doc, true)
+}
+
+// openEditor suspends the TUI to edit text in the user's editor
+func openEditor(taskID, text string, document bool) tea.Cmd {
+	path, err := app.WriteTempDocument(text)
+	if err != nil {
+		return func() tea.Msg { return EditorClosedMsg{TaskID: taskID, Document: document, Err: err} }
+	}
+	return tea.ExecProcess(app.EditorCommand(path), func(err error) tea.Msg {
+		msg := EditorClosedMsg{TaskID: taskID, Document: document, Path: path}
+		if err != nil {
+			msg.Err = fmt.Errorf("editor: %w", err)
+			return msg
+		}
+		edited, err := os.ReadFile(path)
+		if err != nil {
+			msg.Err = err
+			return msg
+		}
+		msg.Text = string(edited)
+		msg.Changed = msg.Text != text
+		return msg
+	})
+}
+
+// saveTaskDocument saves an edited task document, returning a status
+// message. On failure the file is kept, and the error says where.
+func saveTaskDocument(database *db.DB, msg EditorClosedMsg) (string, error) {
+	if msg.Err != nil {
+		return "", msg.Err
+	}
+	if !msg.Changed {
+		os.Remove(msg.Path)
+		return "No changes", nil
+	}
+	if err := database.ApplyTaskDocument(msg.TaskID, msg.Text); err != nil {
+		return "", fmt.Errorf("%w (your edits are in %s)", err, msg.Path)
+	}
+	os.Remove(msg.Path)
+	return "Task updated", nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/dori/klonch/internal/db"
@@ -42,13 +43,25 @@ type EisenhowerView struct {
 
 	// Status message
 	statusMsg string
+
+	// Filtering
+	filtering   bool
+	filterInput textinput.Model
+	filterQuery *db.Query
+	filterErr   error
 }
 
 // NewEisenhowerView creates a new Eisenhower view
 func NewEisenhowerView(database *db.DB) EisenhowerView {
+	ti := textinput.New()
+	ti.Prompt = ""
+	ti.Placeholder = "e.g. #work @review due<+3d"
+	ti.CharLimit = 256
+
 	return EisenhowerView{
-		db:       database,
-		selected: make(map[string]bool),
+		db:          database,
+		selected:    make(map[string]bool),
+		filterInput: ti,
 	}
 }
 
@@ -66,13 +79,22 @@ func (v EisenhowerView) SetSize(width, height int) EisenhowerView {
 
 // loadTasks loads tasks from database and organizes by quadrant
 func (v EisenhowerView) loadTasks() tea.Cmd {
+	filter, args := "1 = 1", []interface{}(nil)
+	if v.filterQuery != nil {
+		filter, args = v.filterQuery.Condition("id")
+	}
+
 	return func() tea.Msg {
+		if !showsDeferred(v.db, v.filterQuery) {
+			filter += " AND " + db.NotDeferred("")
+		}
 		rows, err := v.db.Query(`
 			SELECT id, title, description, status, priority, urgency, importance, project_id
 			FROM tasks
 			WHERE parent_id IS NULL AND status != 'archived' AND status != 'done'
+			  AND `+filter+`
 			ORDER BY priority DESC, created_at
-		`)
+		`, args...)
 		if err != nil {
 			return eisenhowerErrorMsg{err: err}
 		}
@@ -110,13 +132,36 @@ func (v EisenhowerView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case eisenhowerLoadedMsg:
 		v.quadrants = msg.quadrants
+		v.clampCursor()
 		return v, nil
 
 	case taskUpdatedMsg:
 		return v, v.loadTasks()
 
 	case tea.KeyMsg:
+		if v.filtering {
+			return v.handleFilterInput(msg)
+		}
+
 		switch msg.String() {
+		// Filter with a query
+		case "/":
+			v.filtering = true
+			v.filterErr = nil
+			if v.filterQuery != nil {
+				v.filterInput.SetValue(v.filterQuery.String())
+			} else {
+				v.filterInput.SetValue("")
+			}
+			return v, v.filterInput.Focus()
+
+		case "esc":
+			if v.filterQuery != nil {
+				v.filterQuery = nil
+				return v, v.loadTasks()
+			}
+			return v, nil
+
 		// Quadrant navigation (2x2 grid)
 		case "h", "left":
 			if v.currentQuadrant == QuadrantDelegate {
@@ -190,9 +235,43 @@ func (v EisenhowerView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 	}
 
+	if v.filtering {
+		var cmd tea.Cmd
+		v.filterInput, cmd = v.filterInput.Update(msg)
+		return v, cmd
+	}
 	return v, nil
 }
 
+// handleFilterInput handles keys while typing a filter query
+func (v EisenhowerView) handleFilterInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		v.filtering = false
+		v.filterInput.Blur()
+		return v, nil
+	case "enter":
+		var q *db.Query
+		if text := strings.TrimSpace(v.filterInput.Value()); text != "" {
+			parsed, err := db.ParseQuery(text)
+			if err != nil {
+				v.filterErr = err
+				return v, nil
+			}
+			q = parsed
+		}
+		v.filterQuery = q
+		v.filtering = false
+		v.filterInput.Blur()
+		v.cursorRow = 0
+		return v, v.loadTasks()
+	}
+
+	var cmd tea.Cmd
+	v.filterInput, cmd = v.filterInput.Update(msg)
+	return v, cmd
+}
+
 // clampCursor ensures cursor is valid for current quadrant
 func (v *EisenhowerView) clampCursor() {
 	quad := v.quadrants[v.currentQuadrant]
@@ -227,11 +306,7 @@ func (v EisenhowerView) setQuadrant(target Quadrant) tea.Cmd {
 	}
 
 	return func() tea.Msg {
-		_, err := v.db.Exec(`
-			UPDATE tasks SET urgency = ?, importance = ?, updated_at = datetime('now')
-			WHERE id = ?
-		`, urgency, importance, task.ID)
-		if err != nil {
+		if err := v.db.UpdateTaskEisenhower(task.ID, urgency, importance); err != nil {
 			return eisenhowerErrorMsg{err: err}
 		}
 		return taskUpdatedMsg{}
@@ -248,11 +323,7 @@ func (v EisenhowerView) toggleCurrentTask() tea.Cmd {
 	task := quad[v.cursorRow]
 
 	return func() tea.Msg {
-		_, err := v.db.Exec(`
-			UPDATE tasks SET status = 'done', completed_at = datetime('now'), updated_at = datetime('now')
-			WHERE id = ?
-		`, task.ID)
-		if err != nil {
+		if err := v.db.SetTaskStatus(task.ID, model.StatusDone); err != nil {
 			return eisenhowerErrorMsg{err: err}
 		}
 		return taskUpdatedMsg{}
@@ -297,10 +368,22 @@ func (v EisenhowerView) View() string {
 	bottomRow := lipgloss.JoinHorizontal(lipgloss.Top, quads[2], quads[3])
 	matrix := lipgloss.JoinVertical(lipgloss.Left, topRow, bottomRow)
 
-	// Footer with hints
-	hints := lipgloss.NewStyle().Foreground(t.Subtle).Render(
-		"h/j/k/l: navigate • 1-4: set quadrant • enter: complete task",
-	)
+	// Footer with hints, the filter being typed, or the active filter
+	var hints string
+	switch {
+	case v.filtering:
+		hints = lipgloss.NewStyle().Foreground(t.Primary).Render("Filter: ") + v.filterInput.View()
+		if v.filterErr != nil {
+			hints += "  " + lipgloss.NewStyle().Foreground(t.Error).Render(v.filterErr.Error())
+		}
+	case v.filterQuery != nil:
+		hints = lipgloss.NewStyle().Foreground(t.Info).Render("[Filter: "+v.filterQuery.String()+"] ") +
+			lipgloss.NewStyle().Foreground(t.Subtle).Render("/: edit • esc: clear")
+	default:
+		hints = lipgloss.NewStyle().Foreground(t.Subtle).Render(
+			"h/j/k/l: navigate • 1-4: set quadrant • enter: complete task • /: filter",
+		)
+	}
 
 	return lipgloss.JoinVertical(lipgloss.Left, matrix, hints)
 }
@@ -393,5 +476,5 @@ func (v EisenhowerView) renderQuadrant(index int, label string, color lipgloss.C
 
 // IsInputMode returns whether the view is in input mode
 func (v EisenhowerView) IsInputMode() bool {
-	return false
+	return v.filtering
 }
@@ -5,13 +5,13 @@ import (
 	"strings"
 	"time"
 
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/dori/klonch/internal/db"
 	"github.com/dori/klonch/internal/model"
 	"github.com/dori/klonch/internal/notify"
 	"github.com/dori/klonch/internal/ui/theme"
-	"github.com/google/uuid"
 )
 
 // FocusState represents the timer state in focus mode
@@ -26,7 +26,7 @@ const (
 // FocusView represents the focus mode for a single task
 type FocusView struct {
 	db       *db.DB
-	notifier *notify.Notifier
+	notifier notify.Notifier
 	width    int
 	height   int
 
@@ -35,6 +35,8 @@ type FocusView struct {
 	subtasks []model.Task
 	project  *model.Project
 	tags     []model.Tag
+	comments []model.Comment
+	activity []model.Activity
 
 	// Time tracking
 	timeLogged    int // Total minutes already logged
@@ -46,15 +48,24 @@ type FocusView struct {
 	// Subtask navigation
 	subtaskCursor int
 
+	// Comment being written
+	commenting bool
+	comment    textinput.Model
+
 	// Status
 	statusMsg string
 }
 
 // NewFocusView creates a new focus view
-func NewFocusView(database *db.DB, notifier *notify.Notifier) FocusView {
+func NewFocusView(database *db.DB, notifier notify.Notifier) FocusView {
+	ti := textinput.New()
+	ti.Placeholder = "Add a comment..."
+	ti.CharLimit = 1000
+
 	return FocusView{
 		db:       database,
 		notifier: notifier,
+		comment:  ti,
 	}
 }
 
@@ -63,7 +74,7 @@ func (v FocusView) Init() tea.Cmd {
 	if v.task == nil {
 		return nil
 	}
-	return v.loadTaskDetails()
+	return tea.Batch(v.loadTaskDetails(), LoadRunningTimer(v.db, false))
 }
 
 // SetTask sets the task to focus on
@@ -71,7 +82,10 @@ func (v FocusView) SetTask(task *model.Task) FocusView {
 	v.task = task
 	v.timerState = FocusIdle
 	v.timerElapsed = 0
+	v.timeEntryID = "" // A running timer is picked up again by Init
 	v.subtaskCursor = 0
+	v.commenting = false
+	v.comments, v.activity = nil, nil
 	return v
 }
 
@@ -166,11 +180,22 @@ func (v FocusView) loadTaskDetails() tea.Cmd {
 		`, taskID)
 		row.Scan(&timeLogged)
 
+		comments, err := v.db.TaskComments(taskID)
+		if err != nil {
+			return focusErrorMsg{err: err}
+		}
+		activity, err := v.db.TaskActivity(taskID)
+		if err != nil {
+			return focusErrorMsg{err: err}
+		}
+
 		return focusLoadedMsg{
 			subtasks:   subtasks,
 			project:    project,
 			tags:       tags,
 			timeLogged: timeLogged,
+			comments:   comments,
+			activity:   activity,
 		}
 	}
 }
@@ -181,6 +206,8 @@ type focusLoadedMsg struct {
 	project    *model.Project
 	tags       []model.Tag
 	timeLogged int
+	comments   []model.Comment
+	activity   []model.Activity
 }
 type focusTickMsg struct{}
 
@@ -202,6 +229,8 @@ func (v FocusView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		v.project = msg.project
 		v.tags = msg.tags
 		v.timeLogged = msg.timeLogged
+		v.comments = msg.comments
+		v.activity = msg.activity
 		return v, nil
 
 	case focusErrorMsg:
@@ -216,38 +245,79 @@ func (v FocusView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return v, nil
 
 	case taskUpdatedMsg:
+		if msg.err != nil {
+			v.statusMsg = fmt.Sprintf("Error: %v", msg.err)
+		}
 		return v, v.loadTaskDetails()
 
+	case EditorClosedMsg:
+		if v.task == nil || msg.TaskID != v.task.ID {
+			return v, nil
+		}
+		status, err := saveTaskDocument(v.db, msg)
+		if err != nil {
+			v.statusMsg = fmt.Sprintf("Error: %v", err)
+			return v, nil
+		}
+		v.statusMsg = status
+		if task, err := v.db.GetTask(v.task.ID); err == nil && task != nil {
+			v.task = task
+		}
+		return v, v.loadTaskDetails()
+
+	case RunningTimerMsg:
+		return v.followTimer(msg)
+
 	case tea.KeyMsg:
+		if v.commenting {
+			return v.handleCommentKey(msg)
+		}
 		switch msg.String() {
 		// Timer controls
 		case "s", " ": // Start/pause timer
 			switch v.timerState {
 			case FocusIdle:
-				return v, v.startTimer()
+				cmd := v.startTimer()
+				return v, cmd
 			case FocusRunning:
+				now := time.Now()
+				v.timerElapsed = now.Sub(v.timerStart)
 				v.timerState = FocusPaused
 				v.statusMsg = "Timer paused"
-				return v, nil
+				if err := v.db.PauseTimer(v.timeEntryID, now); err != nil && err != db.ErrTimerNotRunning {
+					v.statusMsg = fmt.Sprintf("Error: %v", err)
+				}
+				return v, timerChanged
 			case FocusPaused:
 				// Resume
-				v.timerStart = time.Now().Add(-v.timerElapsed)
+				now := time.Now()
+				v.timerStart = now.Add(-v.timerElapsed)
 				v.timerState = FocusRunning
 				v.statusMsg = "Timer resumed"
-				return v, focusTickCmd()
+				if err := v.db.ResumeTimer(v.timeEntryID, now); err != nil && err != db.ErrTimerNotRunning {
+					v.statusMsg = fmt.Sprintf("Error: %v", err)
+				}
+				return v, tea.Batch(focusTickCmd(), timerChanged)
 			}
 
-		case "r": // Reset timer
+		case "r", "x": // Reset timer, discarding the time
 			if v.timerState != FocusIdle {
+				var cmd tea.Cmd
+				if v.timeEntryID != "" {
+					v.db.DiscardTimer(v.timeEntryID)
+					v.timeEntryID = ""
+					cmd = timerChanged
+				}
 				v.timerState = FocusIdle
 				v.timerElapsed = 0
 				v.statusMsg = "Timer reset"
+				return v, cmd
 			}
 			return v, nil
 
 		case "S": // Stop and save time
 			if v.timerState != FocusIdle {
-				return v, v.stopAndSaveTimer()
+				return v, tea.Sequence(v.stopAndSaveTimer(), timerChanged)
 			}
 			return v, nil
 
@@ -277,16 +347,65 @@ func (v FocusView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "p": // Cycle priority
 			return v, v.cyclePriority()
 
+		case "e": // Edit the task and its notes in $EDITOR
+			if v.task != nil {
+				return v, EditTaskDocument(v.db, v.task.ID)
+			}
+			return v, nil
+
+		case "c": // Comment on the task
+			if v.task != nil {
+				v.commenting = true
+				v.comment.SetValue("")
+				v.comment.Width = min(80, v.width-4) - 4
+				v.comment.Focus()
+				return v, textinput.Blink
+			}
+			return v, nil
+
 		case "escape", "esc", "q": // Return to list view
 			return v, func() tea.Msg { return BackToListMsg{} }
 		}
 	}
 
+	if v.commenting {
+		var cmd tea.Cmd
+		v.comment, cmd = v.comment.Update(msg)
+		return v, cmd
+	}
 	return v, nil
 }
 
-// startTimer starts the focus timer
-func (v FocusView) startTimer() tea.Cmd {
+// handleCommentKey handles keypresses while a comment is being written
+func (v FocusView) handleCommentKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		body := strings.TrimSpace(v.comment.Value())
+		v.commenting = false
+		v.comment.Blur()
+		if body == "" {
+			return v, nil
+		}
+		v.statusMsg = "Comment added"
+		return v, addComment(v.db, v.task.ID, body)
+	case "esc":
+		v.commenting = false
+		v.comment.Blur()
+		return v, nil
+	}
+
+	var cmd tea.Cmd
+	v.comment, cmd = v.comment.Update(msg)
+	return v, cmd
+}
+
+// IsCommenting returns whether a comment is being written
+func (v FocusView) IsCommenting() bool {
+	return v.commenting
+}
+
+// startTimer starts the focus timer. Any other timer stops.
+func (v *FocusView) startTimer() tea.Cmd {
 	v.timerState = FocusRunning
 	v.timerStart = time.Now()
 	v.timerElapsed = 0
@@ -294,20 +413,52 @@ func (v FocusView) startTimer() tea.Cmd {
 
 	// Create time entry
 	if v.task != nil {
-		v.timeEntryID = uuid.New().String()
-		now := time.Now()
-		v.db.Exec(`
-			INSERT INTO time_entries (id, task_id, started_at, is_pomodoro, created_at)
-			VALUES (?, ?, ?, 0, ?)
-		`, v.timeEntryID, v.task.ID, now, now)
+		v.timeEntryID, _ = v.db.StartTimeEntry(v.task.ID, v.timerStart, false)
 	}
 
-	return focusTickCmd()
+	return tea.Batch(focusTickCmd(), timerChanged)
+}
+
+// followTimer picks up a timer for this task started before a restart or
+// elsewhere, and lets go of this view's timer once it stops elsewhere. Its
+// own timer is synced too, as time away may have been taken out of it.
+func (v FocusView) followTimer(msg RunningTimerMsg) (tea.Model, tea.Cmd) {
+	e := msg.Entry
+	ours := e != nil && !e.IsPomodoro && v.task != nil && e.TaskID == v.task.ID
+	if !ours {
+		if v.timeEntryID != "" {
+			v.timeEntryID = ""
+			v.timerState = FocusIdle
+			v.timerElapsed = 0
+			v.statusMsg = "Timer stopped"
+			return v, v.loadTaskDetails()
+		}
+		return v, nil
+	}
+	// A timer split into another entry has logged the time before it
+	var reload tea.Cmd
+	if v.timeEntryID != "" && e.ID != v.timeEntryID {
+		reload = v.loadTaskDetails()
+	}
+
+	ticking := v.timerState == FocusRunning
+	now := time.Now()
+	v.timeEntryID = e.ID
+	v.timerElapsed = e.Elapsed(now)
+	v.timerStart = now.Add(-v.timerElapsed)
+	if e.IsPaused() {
+		v.timerState = FocusPaused
+		return v, reload
+	}
+	v.timerState = FocusRunning
+	if ticking {
+		return v, reload
+	}
+	return v, tea.Batch(reload, focusTickCmd())
 }
 
 // stopAndSaveTimer stops the timer and saves the time entry
 func (v FocusView) stopAndSaveTimer() tea.Cmd {
-	duration := int(v.timerElapsed.Minutes())
 	entryID := v.timeEntryID
 
 	v.timerState = FocusIdle
@@ -315,12 +466,10 @@ func (v FocusView) stopAndSaveTimer() tea.Cmd {
 	v.timeEntryID = ""
 
 	return func() tea.Msg {
-		if entryID != "" && duration > 0 {
-			now := time.Now()
-			v.db.Exec(`
-				UPDATE time_entries SET ended_at = ?, duration = ?
-				WHERE id = ?
-			`, now, duration, entryID)
+		if entryID != "" {
+			if _, err := v.db.StopTimer(entryID, time.Now()); err != nil && err != db.ErrTimerNotRunning {
+				return focusErrorMsg{err: err}
+			}
 		}
 		return taskUpdatedMsg{}
 	}
@@ -339,22 +488,8 @@ func (v FocusView) toggleSubtask() tea.Cmd {
 	}
 
 	return func() tea.Msg {
-		if newStatus == model.StatusDone {
-			_, err := v.db.Exec(`
-				UPDATE tasks SET status = ?, completed_at = datetime('now'), updated_at = datetime('now')
-				WHERE id = ?
-			`, newStatus, subtask.ID)
-			if err != nil {
-				return focusErrorMsg{err: err}
-			}
-		} else {
-			_, err := v.db.Exec(`
-				UPDATE tasks SET status = ?, completed_at = NULL, updated_at = datetime('now')
-				WHERE id = ?
-			`, newStatus, subtask.ID)
-			if err != nil {
-				return focusErrorMsg{err: err}
-			}
+		if err := v.db.SetTaskStatus(subtask.ID, newStatus); err != nil {
+			return focusErrorMsg{err: err}
 		}
 		return taskUpdatedMsg{}
 	}
@@ -368,17 +503,13 @@ func (v FocusView) markTaskDone() tea.Cmd {
 
 	taskID := v.task.ID
 	return func() tea.Msg {
-		_, err := v.db.Exec(`
-			UPDATE tasks SET status = 'done', completed_at = datetime('now'), updated_at = datetime('now')
-			WHERE id = ?
-		`, taskID)
-		if err != nil {
+		if err := v.db.SetTaskStatus(taskID, model.StatusDone); err != nil {
 			return focusErrorMsg{err: err}
 		}
 
 		// Send notification
 		if v.notifier != nil {
-			v.notifier.SendSimple("Task Complete!", v.task.Title)
+			v.notifier.Send(notify.Simple("Task Complete!", v.task.Title))
 		}
 
 		return taskUpdatedMsg{}
@@ -410,11 +541,7 @@ func (v FocusView) cyclePriority() tea.Cmd {
 
 	taskID := v.task.ID
 	return func() tea.Msg {
-		_, err := v.db.Exec(`
-			UPDATE tasks SET priority = ?, updated_at = datetime('now')
-			WHERE id = ?
-		`, newPriority, taskID)
-		if err != nil {
+		if err := v.db.UpdateTaskPriority(taskID, newPriority); err != nil {
 			return focusErrorMsg{err: err}
 		}
 		return taskUpdatedMsg{}
@@ -467,7 +594,7 @@ func (v FocusView) View() string {
 			BorderStyle(lipgloss.RoundedBorder()).
 			BorderForeground(t.Border)
 
-		sections = append(sections, descStyle.Render(v.task.Description))
+		sections = append(sections, descStyle.Render(renderMarkdown(v.task.Description, containerWidth-4)))
 		sections = append(sections, "")
 	}
 
@@ -482,6 +609,25 @@ func (v FocusView) View() string {
 	metaSection := v.renderMetadata(containerWidth)
 	sections = append(sections, metaSection)
 
+	// Comment being written
+	if v.commenting {
+		inputStyle := lipgloss.NewStyle().
+			Width(containerWidth).
+			Padding(0, 1).
+			BorderStyle(lipgloss.RoundedBorder()).
+			BorderForeground(t.Primary)
+		sections = append(sections, "", inputStyle.Render(v.comment.View()))
+	}
+
+	// Comments and activity fill the space left, if there's enough of it
+	used := lipgloss.Height(strings.Join(sections, "\n"))
+	if v.statusMsg != "" {
+		used += 2
+	}
+	if lines := v.height - used - 3; lines >= 3 {
+		sections = append(sections, "", v.renderHistory(containerWidth, lines))
+	}
+
 	// Status message
 	if v.statusMsg != "" {
 		statusStyle := lipgloss.NewStyle().
@@ -705,10 +851,16 @@ func (v FocusView) renderMetadata(width int) string {
 	// Due date
 	if v.task.DueDate != nil {
 		dueStr := v.task.DueDate.Format("Mon, Jan 2")
-		daysUntil := int(time.Until(*v.task.DueDate).Hours() / 24)
+		if model.HasClock(*v.task.DueDate) {
+			dueStr += v.task.DueDate.Format(" 15:04")
+		}
+		daysUntil := model.DaysBetween(time.Now(), *v.task.DueDate)
 
 		dueLabelStyle := valueStyle
-		if daysUntil < 0 {
+		if v.task.IsOverdue() && daysUntil == 0 {
+			dueLabelStyle = lipgloss.NewStyle().Foreground(t.Error)
+			dueStr += " (overdue)"
+		} else if daysUntil < 0 {
 			dueLabelStyle = lipgloss.NewStyle().Foreground(t.Error)
 			dueStr += fmt.Sprintf(" (%d days overdue)", -daysUntil)
 		} else if daysUntil == 0 {
@@ -740,6 +892,23 @@ func (v FocusView) renderMetadata(width int) string {
 		Render(content)
 }
 
+// renderHistory renders the task's comments and activity side by side in
+// lines rows
+func (v FocusView) renderHistory(width, lines int) string {
+	t := theme.Current.Theme
+	boxWidth := (width - 1) / 2
+	boxStyle := lipgloss.NewStyle().
+		Width(boxWidth - 2).
+		Padding(0, 1).
+		BorderStyle(lipgloss.RoundedBorder()).
+		BorderForeground(t.Border)
+
+	inner := boxWidth - 4
+	comments := boxStyle.Render(renderComments(v.comments, inner, lines))
+	activity := boxStyle.Render(renderActivity(v.activity, inner, lines))
+	return lipgloss.JoinHorizontal(lipgloss.Top, comments, " ", activity)
+}
+
 // IsInputMode returns whether the view is in input mode
 // Returns true to prevent global 'q' from quitting - focus view handles its own exit
 func (v FocusView) IsInputMode() bool {
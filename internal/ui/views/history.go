@@ -0,0 +1,127 @@
+package views
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/dori/klonch/internal/db"
+	"github.com/dori/klonch/internal/model"
+	"github.com/dori/klonch/internal/ui/theme"
+)
+
+// A task's history is its comments and its activity stream, shown under
+// the notes in focus mode and the list's detail pane.
+
+// taskHistoryMsg carries a task's comments and activity
+type taskHistoryMsg struct {
+	taskID   string
+	comments []model.Comment
+	activity []model.Activity
+	err      error
+}
+
+// loadTaskHistory loads a task's comments and activity
+func loadTaskHistory(database *db.DB, taskID string) tea.Cmd {
+	return func() tea.Msg {
+		msg := taskHistoryMsg{taskID: taskID}
+		msg.comments, msg.err = database.TaskComments(taskID)
+		if msg.err == nil {
+			msg.activity, msg.err = database.TaskActivity(taskID)
+		}
+		return msg
+	}
+}
+
+// addComment saves a comment on a task
+func addComment(database *db.DB, taskID, body string) tea.Cmd {
+	return func() tea.Msg {
+		_, err := database.AddComment(taskID, body)
+		return taskUpdatedMsg{err: err}
+	}
+}
+
+// renderComments renders comments oldest first, each under its time. When
+// they don't fit in maxLines the latest are kept.
+func renderComments(comments []model.Comment, width, maxLines int) string {
+	t := theme.Current.Theme
+	header := lipgloss.NewStyle().Bold(true).Foreground(t.Secondary).
+		Render(fmt.Sprintf("Comments (%d)", len(comments)))
+	when := lipgloss.NewStyle().Foreground(t.Subtle)
+
+	var blocks [][]string
+	for _, c := range comments {
+		body := renderMarkdown(c.Body, width-2)
+		lines := []string{when.Render(formatWhen(c.CreatedAt))}
+		for _, line := range strings.Split(body, "\n") {
+			lines = append(lines, "  "+line)
+		}
+		blocks = append(blocks, lines)
+	}
+	return header + "\n" + latestLines(blocks, maxLines-1, width)
+}
+
+// renderActivity renders a task's activity stream oldest first, one entry
+// a line. When it doesn't fit in maxLines the latest entries are kept.
+func renderActivity(activity []model.Activity, width, maxLines int) string {
+	t := theme.Current.Theme
+	header := lipgloss.NewStyle().Bold(true).Foreground(t.Secondary).Render("Activity")
+	when := lipgloss.NewStyle().Foreground(t.Subtle)
+	text := lipgloss.NewStyle().Foreground(t.Foreground)
+
+	var blocks [][]string
+	for _, a := range activity {
+		stamp := formatWhen(a.CreatedAt)
+		line := when.Render(stamp+"  ") + text.Render(a.Summary())
+		line = lipgloss.NewStyle().MaxWidth(width).Render(line)
+		blocks = append(blocks, []string{line})
+	}
+	return header + "\n" + latestLines(blocks, maxLines-1, width)
+}
+
+// latestLines joins blocks of lines, dropping the oldest blocks that don't
+// fit in maxLines behind a line saying how many were left out
+func latestLines(blocks [][]string, maxLines, width int) string {
+	t := theme.Current.Theme
+	subtle := lipgloss.NewStyle().Foreground(t.Subtle).Italic(true)
+	if len(blocks) == 0 {
+		return subtle.Render("None yet")
+	}
+
+	used, first := 0, len(blocks)
+	for first > 0 && used+len(blocks[first-1]) <= maxLines {
+		used += len(blocks[first-1])
+		first--
+	}
+	if first > 0 {
+		// Make room for the note about the rest
+		for first < len(blocks) && used+1 > maxLines {
+			used -= len(blocks[first])
+			first++
+		}
+	}
+
+	var lines []string
+	if first > 0 {
+		lines = append(lines, subtle.MaxWidth(width).Render(fmt.Sprintf("… %d earlier", first)))
+	}
+	for _, block := range blocks[first:] {
+		lines = append(lines, block...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatWhen formats the time of a comment or activity entry: the time of
+// day for today, and the date before that
+func formatWhen(t time.Time) string {
+	now := time.Now()
+	switch {
+	case model.DaysBetween(t, now) == 0:
+		return t.Format("15:04")
+	case t.Year() == now.Year():
+		return t.Format("Jan 2 15:04")
+	}
+	return t.Format("Jan 2 2006")
+}
@@ -1,7 +1,9 @@
 package views
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -10,8 +12,8 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/dori/klonch/internal/db"
 	"github.com/dori/klonch/internal/model"
+	"github.com/dori/klonch/internal/parse"
 	"github.com/dori/klonch/internal/ui/theme"
-	"github.com/google/uuid"
 )
 
 // Local message types for kanban view
@@ -26,33 +28,43 @@ const (
 	KanbanModeEdit
 	KanbanModeSearch
 	KanbanModeConfirmDelete
+	KanbanModeWIPLimit
 )
 
-// KanbanColumn represents a column in the kanban board
+// KanbanColumn represents a column in the kanban board, a state of the
+// board's workflow
 type KanbanColumn int
 
-const (
-	ColumnBacklog KanbanColumn = iota
-	ColumnTodo
-	ColumnInProgress
-	ColumnDone
-)
-
 // KanbanView represents the kanban board view
 type KanbanView struct {
 	db     *db.DB
 	width  int
 	height int
 
+	// The board's columns: the filtered project's workflow, or the default
+	// one when showing every project
+	workflow model.Workflow
+
 	// Tasks organized by column
-	columns [4][]model.Task
+	columns [][]model.Task
 
 	// Navigation state
 	currentColumn KanbanColumn
 	cursorRow     int
 
 	// Per-column scroll offset
-	columnScroll [4]int
+	columnScroll []int
+
+	// Swimlanes: how tasks are grouped, the lanes folded away by key, and
+	// the first line of the board shown, as lanes scroll together
+	swimlanes      string
+	collapsedLanes map[string]bool
+	laneScroll     int
+
+	// For swimlanes by tag and by parent: map[taskID] -> tag IDs, and
+	// map[parentID] -> title
+	taskTags     map[string][]string
+	parentTitles map[string]string
 
 	// Selected tasks
 	selected map[string]bool
@@ -78,7 +90,10 @@ type KanbanView struct {
 	tags             []model.Tag
 
 	// Filtering
-	searchFilter    string
+	searchFilter    string          // Query typed after /
+	filterQuery     *db.Query       // Parsed searchFilter
+	queryMatches    map[string]bool // IDs of tasks the query matched at last load
+	filterErr       error           // Why the typed query didn't parse
 	filterProjectID string
 
 	// Subtask counts: map[taskID] -> [total, done]
@@ -92,10 +107,11 @@ func NewKanbanView(database *db.DB) KanbanView {
 	ti.CharLimit = 256
 
 	return KanbanView{
-		db:            database,
-		selected:      make(map[string]bool),
-		textInput:     ti,
-		subtaskCounts: make(map[string][2]int),
+		db:             database,
+		selected:       make(map[string]bool),
+		textInput:      ti,
+		subtaskCounts:  make(map[string][2]int),
+		collapsedLanes: make(map[string]bool),
 	}
 }
 
@@ -111,16 +127,38 @@ func (v KanbanView) SetSize(width, height int) KanbanView {
 	return v
 }
 
-// loadTasks loads tasks from database and organizes by status
+// loadTasks loads tasks from database and organizes them by workflow state
 func (v KanbanView) loadTasks() tea.Cmd {
+	filterProjectID := v.filterProjectID
 	return func() tea.Msg {
+		workflow, err := v.db.DefaultWorkflow()
+		if err != nil {
+			return kanbanErrorMsg{err: err}
+		}
+		if filterProjectID != "" && filterProjectID != "selecting" {
+			if workflow, err = v.db.GetWorkflow(filterProjectID); err != nil {
+				return kanbanErrorMsg{err: err}
+			}
+		}
+		swimlanes, _ := v.db.GetSetting(db.SettingKanbanSwimlanes)
+
+		started := "1 = 1"
+		if !showsDeferred(v.db, v.filterQuery) {
+			started = db.NotDeferred("t.")
+		}
+		// Subtasks only come onto the board in the lanes of their parents
+		topLevel := "t.parent_id IS NULL"
+		if swimlanes == db.SwimlanesParent {
+			topLevel = "1 = 1"
+		}
 		rows, err := v.db.Query(`
 			SELECT
-				t.id, t.title, t.description, t.status, t.priority, t.project_id, t.due_date,
+				t.id, t.title, t.description, t.status, t.priority, t.project_id, t.due_date, t.time_estimate, t.state_id,
+				t.parent_id, (SELECT p.title FROM tasks p WHERE p.id = t.parent_id),
 				(SELECT COUNT(*) FROM tasks st WHERE st.parent_id = t.id) as subtask_total,
 				(SELECT COUNT(*) FROM tasks st WHERE st.parent_id = t.id AND st.status = 'done') as subtask_done
 			FROM tasks t
-			WHERE t.parent_id IS NULL AND t.status != 'archived'
+			WHERE `+topLevel+` AND t.status != 'archived' AND `+started+`
 			ORDER BY t.position, t.created_at
 		`)
 		if err != nil {
@@ -128,17 +166,23 @@ func (v KanbanView) loadTasks() tea.Cmd {
 		}
 		defer rows.Close()
 
-		columns := [4][]model.Task{}
+		columns := make([][]model.Task, len(workflow))
 		subtaskCounts := make(map[string][2]int)
+		parentTitles := make(map[string]string)
 
 		for rows.Next() {
 			var t model.Task
 			var desc, projectID *string
 			var dueDate *string
+			var parentTitle *string
 			var subtaskTotal, subtaskDone int
-			if err := rows.Scan(&t.ID, &t.Title, &desc, &t.Status, &t.Priority, &projectID, &dueDate, &subtaskTotal, &subtaskDone); err != nil {
+			if err := rows.Scan(&t.ID, &t.Title, &desc, &t.Status, &t.Priority, &projectID, &dueDate, &t.TimeEstimate, &t.StateID,
+				&t.ParentID, &parentTitle, &subtaskTotal, &subtaskDone); err != nil {
 				continue
 			}
+			if t.ParentID != nil && parentTitle != nil {
+				parentTitles[*t.ParentID] = *parentTitle
+			}
 			if desc != nil {
 				t.Description = *desc
 			}
@@ -149,28 +193,56 @@ func (v KanbanView) loadTasks() tea.Cmd {
 				subtaskCounts[t.ID] = [2]int{subtaskTotal, subtaskDone}
 			}
 
-			// Assign to appropriate column based on status
-			switch t.Status {
-			case model.StatusBacklog:
-				columns[ColumnBacklog] = append(columns[ColumnBacklog], t)
-			case model.StatusPending:
-				columns[ColumnTodo] = append(columns[ColumnTodo], t)
-			case model.StatusInProgress:
-				columns[ColumnInProgress] = append(columns[ColumnInProgress], t)
-			case model.StatusDone:
-				columns[ColumnDone] = append(columns[ColumnDone], t)
+			// Assign to the column of its state, or of its status on
+			// boards it has no state of its own on
+			if col := workflow.StateOf(t.StateID, t.Status); col >= 0 {
+				columns[col] = append(columns[col], t)
+			}
+		}
+
+		rows.Close()
+
+		taskTags := make(map[string][]string)
+		if swimlanes == db.SwimlanesTag {
+			rows, err := v.db.Query(`SELECT tt.task_id, tt.tag_id FROM task_tags tt JOIN tags g ON g.id = tt.tag_id ORDER BY g.name`)
+			if err != nil {
+				return kanbanErrorMsg{err: err}
+			}
+			for rows.Next() {
+				var taskID, tagID string
+				if err := rows.Scan(&taskID, &tagID); err == nil {
+					taskTags[taskID] = append(taskTags[taskID], tagID)
+				}
+			}
+			rows.Close()
+		}
+
+		var queryMatches map[string]bool
+		if v.filterQuery != nil {
+			queryMatches, err = v.db.MatchingTaskIDs(v.filterQuery)
+			if err != nil {
+				return kanbanErrorMsg{err: err}
 			}
 		}
 
-		return kanbanLoadedMsg{columns: columns, subtaskCounts: subtaskCounts}
+		return kanbanLoadedMsg{workflow: workflow, columns: columns, subtaskCounts: subtaskCounts, queryMatches: queryMatches,
+			swimlanes: swimlanes, taskTags: taskTags, parentTitles: parentTitles}
 	}
 }
 
 type kanbanLoadedMsg struct {
-	columns       [4][]model.Task
+	workflow      model.Workflow
+	columns       [][]model.Task
 	subtaskCounts map[string][2]int
+	queryMatches  map[string]bool
+	swimlanes     string
+	taskTags      map[string][]string
+	parentTitles  map[string]string
 }
 
+// kanbanStatusMsg reports on an action, such as a move a WIP limit refused
+type kanbanStatusMsg struct{ text string }
+
 // kanbanProjectsLoadedMsg is sent when projects are loaded
 type kanbanProjectsLoadedMsg struct {
 	projects []model.Project
@@ -181,8 +253,20 @@ type kanbanProjectsLoadedMsg struct {
 func (v KanbanView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case kanbanLoadedMsg:
+		v.workflow = msg.workflow
 		v.columns = msg.columns
+		v.swimlanes = msg.swimlanes
+		v.taskTags = msg.taskTags
+		v.parentTitles = msg.parentTitles
+		if len(v.columnScroll) != len(v.columns) {
+			v.columnScroll = make([]int, len(v.columns))
+		}
+		if int(v.currentColumn) >= len(v.columns) {
+			v.currentColumn = KanbanColumn(len(v.columns) - 1)
+		}
 		v.subtaskCounts = msg.subtaskCounts
+		v.queryMatches = msg.queryMatches
+		v.clampCursor()
 		return v, nil
 
 	case kanbanProjectsLoadedMsg:
@@ -193,6 +277,14 @@ func (v KanbanView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case taskUpdatedMsg:
 		return v, v.loadTasks()
 
+	case kanbanStatusMsg:
+		v.statusMsg = msg.text
+		return v, v.loadTasks()
+
+	case kanbanErrorMsg:
+		v.statusMsg = "Error: " + msg.err.Error()
+		return v, nil
+
 	case tea.KeyMsg:
 		// Handle different modes
 		switch v.mode {
@@ -204,6 +296,8 @@ func (v KanbanView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return v.handleSearchMode(msg)
 		case KanbanModeConfirmDelete:
 			return v.handleConfirmDeleteMode(msg)
+		case KanbanModeWIPLimit:
+			return v.handleWIPLimitMode(msg)
 		default:
 			// Handle selectors
 			if v.selectingProject {
@@ -217,7 +311,7 @@ func (v KanbanView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	}
 
 	// Update text input if in input mode
-	if v.mode == KanbanModeAdd || v.mode == KanbanModeEdit || v.mode == KanbanModeSearch {
+	if v.mode == KanbanModeAdd || v.mode == KanbanModeEdit || v.mode == KanbanModeSearch || v.mode == KanbanModeWIPLimit {
 		var cmd tea.Cmd
 		v.textInput, cmd = v.textInput.Update(msg)
 		return v, cmd
@@ -228,6 +322,7 @@ func (v KanbanView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 // handleNormalMode handles keys in normal mode
 func (v KanbanView) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	v.statusMsg = ""
 	switch msg.String() {
 	// Column navigation
 	case "h", "left":
@@ -238,7 +333,7 @@ func (v KanbanView) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return v, nil
 
 	case "l", "right":
-		if v.currentColumn < 3 {
+		if int(v.currentColumn) < len(v.columns)-1 {
 			v.currentColumn++
 			v.clampCursor()
 		}
@@ -273,7 +368,10 @@ func (v KanbanView) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 	case "g":
 		v.cursorRow = 0
-		v.columnScroll[v.currentColumn] = 0
+		if int(v.currentColumn) < len(v.columnScroll) {
+			v.columnScroll[v.currentColumn] = 0
+		}
+		v.laneScroll = 0
 		return v, nil
 
 	case "G":
@@ -348,11 +446,47 @@ func (v KanbanView) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 		return v, nil
 
+	// Swimlanes
+	case "w":
+		return v, v.cycleSwimlanes()
+
+	case "z":
+		if key := v.currentLane(); key != nil {
+			v.collapsedLanes[*key] = true
+			v.clampCursor()
+		}
+		return v, nil
+
+	case "Z":
+		if len(v.collapsedLanes) > 0 {
+			v.collapsedLanes = make(map[string]bool)
+		} else {
+			for _, lane := range v.lanes() {
+				v.collapsedLanes[lane.key] = true
+			}
+		}
+		v.clampCursor()
+		return v, nil
+
+	// WIP limit of the current column
+	case "W":
+		if int(v.currentColumn) < len(v.workflow) {
+			v.mode = KanbanModeWIPLimit
+			v.textInput.SetValue("")
+			if limit := v.workflow[v.currentColumn].WIPLimit; limit > 0 {
+				v.textInput.SetValue(fmt.Sprint(limit))
+			}
+			v.textInput.Placeholder = "0 for no limit"
+			v.textInput.Focus()
+			v.textInput.CursorEnd()
+		}
+		return v, nil
+
 	// Search
 	case "/":
 		v.mode = KanbanModeSearch
 		v.textInput.SetValue(v.searchFilter)
-		v.textInput.Placeholder = "Search..."
+		v.textInput.Placeholder = "Filter, e.g. #work @review !high due<+3d"
 		v.textInput.Focus()
 		return v, nil
 
@@ -360,8 +494,11 @@ func (v KanbanView) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case "esc":
 		if v.searchFilter != "" || v.filterProjectID != "" {
 			v.searchFilter = ""
+			v.filterQuery = nil
+			v.queryMatches = nil
 			v.filterProjectID = ""
 			v.statusMsg = "Filters cleared"
+			return v, v.loadTasks()
 		}
 		return v, nil
 	}
@@ -373,11 +510,11 @@ func (v KanbanView) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 func (v KanbanView) handleAddMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "enter":
-		title := strings.TrimSpace(v.textInput.Value())
-		if title != "" {
+		text := strings.TrimSpace(v.textInput.Value())
+		if parse.QuickAdd(text, time.Now()).Title != "" {
 			v.mode = KanbanModeNormal
 			v.textInput.Blur()
-			return v, v.createTask(title)
+			return v, v.createTask(text)
 		}
 		return v, nil
 	case "esc":
@@ -395,13 +532,13 @@ func (v KanbanView) handleAddMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 func (v KanbanView) handleEditMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "enter":
-		title := strings.TrimSpace(v.textInput.Value())
-		if title != "" && v.editTaskID != "" {
+		text := strings.TrimSpace(v.textInput.Value())
+		if parse.QuickAdd(text, time.Now()).Title != "" && v.editTaskID != "" {
 			v.mode = KanbanModeNormal
 			v.textInput.Blur()
 			taskID := v.editTaskID
 			v.editTaskID = ""
-			return v, v.updateTaskTitle(taskID, title)
+			return v, v.updateTaskTitle(taskID, text)
 		}
 		return v, nil
 	case "esc":
@@ -420,7 +557,27 @@ func (v KanbanView) handleEditMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 func (v KanbanView) handleSearchMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "enter", "esc":
-		v.searchFilter = strings.TrimSpace(v.textInput.Value())
+		filter := strings.TrimSpace(v.textInput.Value())
+		var q *db.Query
+		if filter != "" {
+			parsed, err := db.ParseQuery(filter)
+			if err != nil && msg.String() == "esc" {
+				// Leave the previous filter in place
+				v.filterErr = nil
+				v.mode = KanbanModeNormal
+				v.textInput.Blur()
+				return v, nil
+			}
+			if err != nil {
+				v.filterErr = err
+				return v, nil
+			}
+			q = parsed
+		}
+		v.searchFilter = filter
+		v.filterQuery = q
+		v.queryMatches = nil
+		v.filterErr = nil
 		v.mode = KanbanModeNormal
 		v.textInput.Blur()
 		// Reset cursor positions when filter changes
@@ -428,6 +585,39 @@ func (v KanbanView) handleSearchMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		for i := range v.columnScroll {
 			v.columnScroll[i] = 0
 		}
+		return v, v.loadTasks()
+	}
+
+	var cmd tea.Cmd
+	v.textInput, cmd = v.textInput.Update(msg)
+	return v, cmd
+}
+
+// handleWIPLimitMode handles keys while entering a column's WIP limit
+func (v KanbanView) handleWIPLimitMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		text := strings.TrimSpace(v.textInput.Value())
+		limit := 0
+		if text != "" {
+			n, err := strconv.Atoi(text)
+			if err != nil || n < 0 {
+				v.statusMsg = "A WIP limit is a whole number, 0 for none"
+				return v, nil
+			}
+			limit = n
+		}
+		v.mode = KanbanModeNormal
+		v.textInput.Blur()
+		v.statusMsg = ""
+		if int(v.currentColumn) < len(v.workflow) {
+			return v, v.setWIPLimit(v.workflow[v.currentColumn], limit)
+		}
+		return v, nil
+	case "esc":
+		v.mode = KanbanModeNormal
+		v.textInput.Blur()
+		v.statusMsg = ""
 		return v, nil
 	}
 
@@ -476,6 +666,8 @@ func (v KanbanView) handleProjectSelector(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 					v.columnScroll[i] = 0
 				}
 				v.statusMsg = fmt.Sprintf("Filtering by: %s", project.Name)
+				// The board takes on the project's workflow
+				return v, v.loadTasks()
 			} else {
 				// Assign task to project
 				col := v.filteredColumn(int(v.currentColumn))
@@ -543,6 +735,13 @@ func (v *KanbanView) ensureCursorVisible() {
 	}
 
 	col := int(v.currentColumn)
+	if col >= len(v.columnScroll) {
+		return
+	}
+	if v.swimlanes != "" && v.swimlanes != db.SwimlanesNone {
+		v.ensureLaneCursorVisible(visibleItems)
+		return
+	}
 
 	// Scroll down if cursor is below visible area
 	if v.cursorRow >= v.columnScroll[col]+visibleItems {
@@ -576,44 +775,85 @@ func (v KanbanView) moveTask(direction int) tea.Cmd {
 	}
 
 	newColumn := int(v.currentColumn) + direction
-	if newColumn < 0 || newColumn > 3 {
+	if newColumn < 0 || newColumn >= len(v.workflow) {
 		return nil
 	}
 
 	task := col[v.cursorRow]
-	var newStatus model.Status
-
-	switch KanbanColumn(newColumn) {
-	case ColumnBacklog:
-		newStatus = model.StatusBacklog
-	case ColumnTodo:
-		newStatus = model.StatusPending
-	case ColumnInProgress:
-		newStatus = model.StatusInProgress
-	case ColumnDone:
-		newStatus = model.StatusDone
+	state := v.workflow[newColumn]
+
+	// A column at its WIP limit takes no more when kanban.wip_block is
+	// on, and otherwise warns; subtasks don't count towards limits
+	count := v.wipCount(newColumn)
+	full := state.WIPLimit > 0 && task.ParentID == nil && count >= state.WIPLimit
+	boardProjectID := ""
+	if v.filterProjectID != "selecting" {
+		boardProjectID = v.filterProjectID
 	}
 
 	return func() tea.Msg {
-		_, err := v.db.Exec(`
-			UPDATE tasks SET status = ?, updated_at = datetime('now')
-			WHERE id = ?
-		`, newStatus, task.ID)
-		if err != nil {
+		var wipErr *db.WIPLimitError
+		if err := v.db.CheckWIPLimit(boardProjectID, task.ID, state); errors.As(err, &wipErr) {
+			return kanbanStatusMsg{text: wipErr.Error()}
+		} else if err != nil {
 			return kanbanErrorMsg{err: err}
 		}
 
-		// If marked done, set completed_at
-		if newStatus == model.StatusDone {
-			v.db.Exec(`UPDATE tasks SET completed_at = datetime('now') WHERE id = ?`, task.ID)
-		} else {
-			v.db.Exec(`UPDATE tasks SET completed_at = NULL WHERE id = ?`, task.ID)
+		// A state of another category changes the status, and marking done
+		// also sets completed_at and rolls recurring tasks forward
+		if err := v.db.SetTaskState(task.ID, state); err != nil {
+			return kanbanErrorMsg{err: err}
 		}
 
+		if full {
+			return kanbanStatusMsg{text: fmt.Sprintf("%s is over its WIP limit (%d/%d)", state.Name, count+1, state.WIPLimit)}
+		}
 		return taskUpdatedMsg{}
 	}
 }
 
+// setWIPLimit sets the WIP limit of a column: the state's own on a
+// project's workflow, or the setting shared by every board on the default
+// one
+func (v KanbanView) setWIPLimit(state model.WorkflowState, limit int) tea.Cmd {
+	return func() tea.Msg {
+		var err error
+		if state.ID != "" {
+			err = v.db.SetWorkflowStateLimit(state.ID, limit)
+		} else {
+			err = v.db.SetSetting(db.WIPSettings[state.Status], fmt.Sprint(limit))
+		}
+		if err != nil {
+			return kanbanErrorMsg{err: err}
+		}
+		if limit == 0 {
+			return kanbanStatusMsg{text: fmt.Sprintf("%s has no WIP limit", state.Name)}
+		}
+		return kanbanStatusMsg{text: fmt.Sprintf("%s holds at most %d tasks", state.Name, limit)}
+	}
+}
+
+// cycleSwimlanes switches to the next way of grouping tasks into lanes and
+// saves it
+func (v KanbanView) cycleSwimlanes() tea.Cmd {
+	modes := []string{db.SwimlanesNone, db.SwimlanesProject, db.SwimlanesPriority, db.SwimlanesTag, db.SwimlanesParent}
+	next := modes[0]
+	for i, mode := range modes {
+		if mode == v.swimlanes {
+			next = modes[(i+1)%len(modes)]
+		}
+	}
+	return func() tea.Msg {
+		if err := v.db.SetSetting(db.SettingKanbanSwimlanes, next); err != nil {
+			return kanbanErrorMsg{err: err}
+		}
+		if next == db.SwimlanesNone {
+			return kanbanStatusMsg{text: "Swimlanes off"}
+		}
+		return kanbanStatusMsg{text: "Swimlanes by " + next}
+	}
+}
+
 // toggleCurrentTask toggles the done status of the current task
 func (v KanbanView) toggleCurrentTask() tea.Cmd {
 	col := v.filteredColumn(int(v.currentColumn))
@@ -631,40 +871,45 @@ func (v KanbanView) toggleCurrentTask() tea.Cmd {
 	}
 
 	return func() tea.Msg {
-		_, err := v.db.Exec(`
-			UPDATE tasks SET status = ?, updated_at = datetime('now')
-			WHERE id = ?
-		`, newStatus, task.ID)
-		if err != nil {
+		if err := v.db.SetTaskStatus(task.ID, newStatus); err != nil {
 			return kanbanErrorMsg{err: err}
 		}
 
-		if newStatus == model.StatusDone {
-			v.db.Exec(`UPDATE tasks SET completed_at = datetime('now') WHERE id = ?`, task.ID)
-		} else {
-			v.db.Exec(`UPDATE tasks SET completed_at = NULL WHERE id = ?`, task.ID)
-		}
-
 		return taskUpdatedMsg{}
 	}
 }
 
-// filteredColumn returns tasks for a column after applying filters
+// filteredColumn returns tasks for a column after applying filters, in
+// the order shown: lane by lane, leaving out collapsed lanes, when the
+// board has swimlanes
 func (v *KanbanView) filteredColumn(colIndex int) []model.Task {
+	if v.swimlanes == "" || v.swimlanes == db.SwimlanesNone {
+		return v.matchingColumn(colIndex)
+	}
+	var tasks []model.Task
+	for _, lane := range v.lanes() {
+		if !v.collapsedLanes[lane.key] {
+			tasks = append(tasks, lane.tasks[colIndex]...)
+		}
+	}
+	return tasks
+}
+
+// matchingColumn returns the tasks of a column that match the filters
+func (v *KanbanView) matchingColumn(colIndex int) []model.Task {
+	if colIndex >= len(v.columns) {
+		return nil
+	}
 	tasks := v.columns[colIndex]
 	if v.searchFilter == "" && v.filterProjectID == "" {
 		return tasks
 	}
 
 	var filtered []model.Task
-	searchLower := strings.ToLower(v.searchFilter)
-
 	for _, task := range tasks {
-		// Apply search filter
-		if v.searchFilter != "" {
-			if !strings.Contains(strings.ToLower(task.Title), searchLower) {
-				continue
-			}
+		// Apply query filter
+		if v.filterQuery != nil && !v.queryMatches[task.ID] {
+			continue
 		}
 
 		// Apply project filter
@@ -679,44 +924,37 @@ func (v *KanbanView) filteredColumn(colIndex int) []model.Task {
 	return filtered
 }
 
-// createTask creates a new task in the current column
-func (v KanbanView) createTask(title string) tea.Cmd {
-	// Determine status based on current column
-	var status model.Status
-	switch v.currentColumn {
-	case ColumnBacklog:
-		status = model.StatusBacklog
-	case ColumnTodo:
-		status = model.StatusPending
-	case ColumnInProgress:
-		status = model.StatusInProgress
-	case ColumnDone:
-		status = model.StatusDone
+// createTask creates a new task in the current column from a quick-add line
+func (v KanbanView) createTask(text string) tea.Cmd {
+	if int(v.currentColumn) >= len(v.workflow) {
+		return nil
 	}
 
-	return func() tea.Msg {
-		id := uuid.New().String()
-		now := time.Now()
+	// The column's state, in the project the board is filtered to
+	state := v.workflow[v.currentColumn]
+	defaults := model.Task{Status: state.Status}
+	if v.filterProjectID != "" && v.filterProjectID != "selecting" {
+		projectID := v.filterProjectID
+		defaults.ProjectID = &projectID
+	}
+	if state.ID != "" {
+		defaults.StateID = &state.ID
+	}
 
-		_, err := v.db.Exec(`
-			INSERT INTO tasks (id, title, status, priority, project_id, created_at, updated_at)
-			VALUES (?, ?, ?, 'medium', 'inbox', ?, ?)
-		`, id, title, status, now, now)
-		if err != nil {
+	parsed := parse.QuickAdd(text, time.Now())
+	return func() tea.Msg {
+		if _, err := v.db.Group("Add task").AddQuickTask(parsed, defaults, nil); err != nil {
 			return kanbanErrorMsg{err: err}
 		}
 		return taskUpdatedMsg{}
 	}
 }
 
-// updateTaskTitle updates a task's title
-func (v KanbanView) updateTaskTitle(taskID, title string) tea.Cmd {
+// updateTaskTitle retitles a task and applies any quick-add tokens in text
+func (v KanbanView) updateTaskTitle(taskID, text string) tea.Cmd {
+	parsed := parse.QuickAdd(text, time.Now())
 	return func() tea.Msg {
-		_, err := v.db.Exec(`
-			UPDATE tasks SET title = ?, updated_at = datetime('now')
-			WHERE id = ?
-		`, title, taskID)
-		if err != nil {
+		if err := v.db.Group("Edit task").EditQuickTask(taskID, parsed); err != nil {
 			return kanbanErrorMsg{err: err}
 		}
 		return taskUpdatedMsg{}
@@ -726,8 +964,7 @@ func (v KanbanView) updateTaskTitle(taskID, title string) tea.Cmd {
 // deleteTask deletes a task
 func (v KanbanView) deleteTask(taskID string) tea.Cmd {
 	return func() tea.Msg {
-		_, err := v.db.Exec(`DELETE FROM tasks WHERE id = ?`, taskID)
-		if err != nil {
+		if err := v.db.DeleteTask(taskID); err != nil {
 			return kanbanErrorMsg{err: err}
 		}
 		return taskUpdatedMsg{}
@@ -759,11 +996,7 @@ func (v KanbanView) cyclePriority() tea.Cmd {
 	}
 
 	return func() tea.Msg {
-		_, err := v.db.Exec(`
-			UPDATE tasks SET priority = ?, updated_at = datetime('now')
-			WHERE id = ?
-		`, newPriority, task.ID)
-		if err != nil {
+		if err := v.db.UpdateTaskPriority(task.ID, newPriority); err != nil {
 			return kanbanErrorMsg{err: err}
 		}
 		return taskUpdatedMsg{}
@@ -773,11 +1006,7 @@ func (v KanbanView) cyclePriority() tea.Cmd {
 // assignProject assigns a task to a project
 func (v KanbanView) assignProject(taskID, projectID string) tea.Cmd {
 	return func() tea.Msg {
-		_, err := v.db.Exec(`
-			UPDATE tasks SET project_id = ?, updated_at = datetime('now')
-			WHERE id = ?
-		`, projectID, taskID)
-		if err != nil {
+		if err := v.db.UpdateTaskProject(taskID, projectID); err != nil {
 			return kanbanErrorMsg{err: err}
 		}
 		return taskUpdatedMsg{}
@@ -798,10 +1027,10 @@ func (v KanbanView) toggleTag(taskID, tagID string) tea.Cmd {
 
 		if count > 0 {
 			// Remove tag
-			_, err = v.db.Exec(`DELETE FROM task_tags WHERE task_id = ? AND tag_id = ?`, taskID, tagID)
+			err = v.db.RemoveTagFromTask(taskID, tagID)
 		} else {
 			// Add tag
-			_, err = v.db.Exec(`INSERT INTO task_tags (task_id, tag_id) VALUES (?, ?)`, taskID, tagID)
+			err = v.db.AddTagToTask(taskID, tagID)
 		}
 
 		if err != nil {
@@ -862,24 +1091,36 @@ func (v KanbanView) View() string {
 
 	t := theme.Current.Theme
 
-	// Column headers
-	columnNames := []string{"Backlog", "Todo", "In Progress", "Done"}
-	columnColors := []lipgloss.Color{t.Subtle, t.Info, t.Warning, t.Success}
+	if len(v.columns) == 0 {
+		return "Loading..."
+	}
 
-	// Responsive layout: show 2 columns when narrow, 4 when wide
-	numVisibleCols := 4
-	if v.width < 120 {
-		numVisibleCols = 2
+	// Column headers, colored by the status of the state's tasks
+	columnColors := map[model.Status]lipgloss.Color{
+		model.StatusBacklog:    t.Subtle,
+		model.StatusPending:    t.Info,
+		model.StatusInProgress: t.Warning,
+		model.StatusDone:       t.Success,
 	}
 
-	// Calculate which columns to show (centered on current column)
-	startCol := 0
-	if numVisibleCols == 2 {
-		// Show pair containing current column: 0-1 or 2-3
-		if v.currentColumn >= 2 {
-			startCol = 2
+	// Responsive layout: show 2 columns when narrow, as many as fit when
+	// wide, at least the default board's 4
+	numVisibleCols := 2
+	if v.width >= 120 {
+		numVisibleCols = (v.width - 4) / 28
+		if numVisibleCols < 4 {
+			numVisibleCols = 4
 		}
 	}
+	if numVisibleCols > len(v.columns) {
+		numVisibleCols = len(v.columns)
+	}
+
+	// Calculate which columns to show: the page containing the current column
+	startCol := int(v.currentColumn) / numVisibleCols * numVisibleCols
+	if startCol+numVisibleCols > len(v.columns) {
+		startCol = len(v.columns) - numVisibleCols
+	}
 	endCol := startCol + numVisibleCols
 
 	// Calculate column width based on visible columns
@@ -888,11 +1129,24 @@ func (v KanbanView) View() string {
 		colWidth = 25
 	}
 
+	// A column at its WIP limit shows it; one over it shows it loudly
+	wipColor := func(i int) (lipgloss.Color, bool) {
+		limit := v.workflow[i].WIPLimit
+		switch count := v.wipCount(i); {
+		case limit == 0 || count < limit:
+			return columnColors[v.workflow[i].Status], false
+		case count == limit:
+			return t.Warning, false
+		}
+		return t.Error, true
+	}
+
 	// Style for column headers
 	headerStyle := func(i int, active bool) lipgloss.Style {
+		color, _ := wipColor(i)
 		s := lipgloss.NewStyle().
 			Bold(true).
-			Foreground(columnColors[i]).
+			Foreground(color).
 			Width(colWidth).
 			Align(lipgloss.Center)
 		if active {
@@ -916,24 +1170,39 @@ func (v KanbanView) View() string {
 
 	var headers []string
 	for i := startCol; i < endCol; i++ {
-		name := columnNames[i]
-		tasks := v.filteredColumn(i)
+		name := v.workflow[i].Name
+		tasks := v.matchingColumn(i)
 		totalTasks := len(v.columns[i])
 		header := fmt.Sprintf("%s (%d)", name, len(tasks))
 		if len(tasks) != totalTasks && filterIndicator != "" {
 			header = fmt.Sprintf("%s (%d/%d)", name, len(tasks), totalTasks)
 		}
+		if limit := v.workflow[i].WIPLimit; limit > 0 {
+			header += fmt.Sprintf(" ≤%d", limit)
+			if _, over := wipColor(i); over {
+				header = "! " + header
+			}
+		}
 		headers = append(headers, headerStyle(i, i == int(v.currentColumn)).Render(header))
 	}
 	headerRow := lipgloss.JoinHorizontal(lipgloss.Top, headers...)
 
 	// Render columns using filtered tasks
 	visibleItems := v.visibleItemCount()
+	var lanes []kanbanLane
+	if v.hasLanes() {
+		lanes = v.lanes()
+	}
 	var cols []string
 	for i := startCol; i < endCol; i++ {
 		tasks := v.filteredColumn(i)
 		isActiveCol := i == int(v.currentColumn)
 		scrollOffset := v.columnScroll[i]
+		if lanes != nil {
+			// Lanes scroll together, so the cursor's row is in view
+			// in every column
+			scrollOffset, tasks = 0, nil
+		}
 
 		// Calculate visible range
 		startIdx := scrollOffset
@@ -961,82 +1230,7 @@ func (v KanbanView) View() string {
 			task := tasks[j]
 			isSelected := isActiveCol && j == v.cursorRow
 
-			// Task card style
-			cardStyle := lipgloss.NewStyle().
-				Width(colWidth - 4).
-				Padding(0, 1)
-
-			if isSelected {
-				cardStyle = cardStyle.
-					Background(t.Highlight).
-					Foreground(t.Foreground)
-			} else {
-				cardStyle = cardStyle.
-					Foreground(t.Foreground)
-			}
-
-			// Project name (inline, with color)
-			var projectStr string
-			if task.ProjectID != nil && *task.ProjectID != "inbox" {
-				project := v.getProjectByID(*task.ProjectID)
-				if project != nil {
-					projectStyle := lipgloss.NewStyle().Foreground(t.Secondary)
-					if project.Color != "" {
-						projectStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(project.Color))
-					}
-					projectStr = projectStyle.Render("[" + project.Name + "] ")
-				}
-			}
-
-			// Priority indicator
-			priorityChar := ""
-			priorityStyle := lipgloss.NewStyle()
-			switch task.Priority {
-			case model.PriorityUrgent:
-				priorityChar = priorityStyle.Foreground(t.PriorityUrgent).Render("!")
-			case model.PriorityHigh:
-				priorityChar = priorityStyle.Foreground(t.PriorityHigh).Render("▲")
-			case model.PriorityMedium:
-				priorityChar = priorityStyle.Foreground(t.PriorityMedium).Render("●")
-			case model.PriorityLow:
-				priorityChar = priorityStyle.Foreground(t.PriorityLow).Render("▽")
-			}
-
-			// Subtask indicator (done/total)
-			var subtaskStr string
-			subtaskLen := 0
-			if counts, ok := v.subtaskCounts[task.ID]; ok {
-				total, done := counts[0], counts[1]
-				subtaskStyle := lipgloss.NewStyle().Foreground(t.Subtle)
-				if done == total {
-					subtaskStyle = lipgloss.NewStyle().Foreground(t.Success)
-				}
-				subtaskStr = subtaskStyle.Render(fmt.Sprintf(" (%d/%d)", done, total))
-				subtaskLen = len(fmt.Sprintf(" (%d/%d)", done, total))
-			}
-
-			// Truncate title to fit (account for project name and subtask indicator length)
-			title := task.Title
-			projectLen := 0
-			if projectStr != "" {
-				// Rough estimate of visible chars in project string
-				if task.ProjectID != nil {
-					if p := v.getProjectByID(*task.ProjectID); p != nil {
-						projectLen = len(p.Name) + 3 // brackets + space
-					}
-				}
-			}
-			maxTitleLen := colWidth - 8 - projectLen - subtaskLen
-			if maxTitleLen < 10 {
-				maxTitleLen = 10
-			}
-			if len(title) > maxTitleLen {
-				title = title[:maxTitleLen-3] + "..."
-			}
-
-			// Build card: priority + project + title + subtasks (single line)
-			cardContent := fmt.Sprintf("%s %s%s%s", priorityChar, projectStr, title, subtaskStr)
-			items = append(items, cardStyle.Render(cardContent))
+			items = append(items, v.renderCard(task, colWidth, isSelected))
 		}
 
 		// Show scroll indicator at bottom if more items below
@@ -1049,8 +1243,12 @@ func (v KanbanView) View() string {
 			items = append(items, scrollIndicator)
 		}
 
+		if lanes != nil {
+			items = v.renderLaneColumn(lanes, i, colWidth, visibleItems, isActiveCol)
+		}
+
 		content := strings.Join(items, "\n")
-		if len(tasks) == 0 {
+		if len(items) == 0 {
 			content = lipgloss.NewStyle().
 				Foreground(t.Subtle).
 				Italic(true).
@@ -1062,6 +1260,9 @@ func (v KanbanView) View() string {
 		if isActiveCol {
 			cs = cs.BorderForeground(t.Primary)
 		}
+		if _, over := wipColor(i); over {
+			cs = cs.BorderForeground(t.Error)
+		}
 
 		cols = append(cols, cs.Render(content))
 	}
@@ -1076,12 +1277,22 @@ func (v KanbanView) View() string {
 		Width(v.width - 4)
 
 	switch v.mode {
-	case KanbanModeAdd:
-		footer = inputStyle.Render("Add task: " + v.textInput.View())
-	case KanbanModeEdit:
-		footer = inputStyle.Render("Edit: " + v.textInput.View())
+	case KanbanModeAdd, KanbanModeEdit:
+		prompt := "Add task: "
+		if v.mode == KanbanModeEdit {
+			prompt = "Edit: "
+		}
+		prompt += v.textInput.View()
+		if parsed := parse.QuickAdd(v.textInput.Value(), time.Now()); parsed.HasFields() {
+			prompt += "\n" + lipgloss.NewStyle().Foreground(t.Subtle).Render("→ "+parsed.Summary())
+		}
+		footer = inputStyle.Render(prompt)
 	case KanbanModeSearch:
-		footer = inputStyle.Render("Search: " + v.textInput.View())
+		prompt := "Filter: " + v.textInput.View()
+		if v.filterErr != nil {
+			prompt += "\n" + lipgloss.NewStyle().Foreground(t.Error).Render(v.filterErr.Error())
+		}
+		footer = inputStyle.Render(prompt)
 	case KanbanModeConfirmDelete:
 		// Find task title for confirmation
 		taskTitle := ""
@@ -1093,6 +1304,9 @@ func (v KanbanView) View() string {
 			Foreground(t.Error).
 			Bold(true)
 		footer = confirmStyle.Render(fmt.Sprintf("Delete '%s'? (y/n)", taskTitle))
+	case KanbanModeWIPLimit:
+		prompt := fmt.Sprintf("WIP limit for %s (0 for none): ", v.workflow[v.currentColumn].Name)
+		footer = inputStyle.Render(prompt + v.textInput.View())
 	default:
 		// Show selector popup or normal hints
 		if v.selectingProject {
@@ -1103,7 +1317,7 @@ func (v KanbanView) View() string {
 			// Show filter status and hints
 			var filterStatus string
 			if v.searchFilter != "" {
-				filterStatus += fmt.Sprintf("Search: %s", v.searchFilter)
+				filterStatus += fmt.Sprintf("Filter: %s", v.searchFilter)
 			}
 			if v.filterProjectID != "" && v.filterProjectID != "selecting" {
 				for _, p := range v.projects {
@@ -1117,18 +1331,16 @@ func (v KanbanView) View() string {
 				}
 			}
 
-			// Show column position indicator for 2-column mode
+			// Show column position indicator when not all columns fit
 			var colIndicator string
-			if numVisibleCols == 2 {
-				if startCol == 0 {
-					colIndicator = "[1-2/4] "
-				} else {
-					colIndicator = "[3-4/4] "
-				}
+			if numVisibleCols < len(v.columns) {
+				colIndicator = fmt.Sprintf("[%d-%d/%d] ", startCol+1, endCol, len(v.columns))
 			}
 
-			hints := "h/l: column • j/k: nav • H/L: move • a: add • enter: edit • d: del • p: priority • m: project • /: search"
-			if filterStatus != "" {
+			hints := "h/l: column • j/k: nav • H/L: move • a: add • enter: edit • d: del • p: priority • m: project • /: filter • w: lanes • z/Z: fold • W: WIP"
+			if v.statusMsg != "" {
+				hints = lipgloss.NewStyle().Foreground(t.Info).Render(v.statusMsg)
+			} else if filterStatus != "" {
 				filterStatus = lipgloss.NewStyle().Foreground(t.Info).Render("[" + filterStatus + "] ")
 				hints = filterStatus + "esc: clear"
 			} else if colIndicator != "" {
@@ -1141,6 +1353,97 @@ func (v KanbanView) View() string {
 	return lipgloss.JoinVertical(lipgloss.Left, headerRow, columnsRow, footer)
 }
 
+// renderCard renders a task as a one-line card for a column of the given width
+func (v KanbanView) renderCard(task model.Task, colWidth int, isSelected bool) string {
+	t := theme.Current.Theme
+
+	// Task card style
+	cardStyle := lipgloss.NewStyle().
+		Width(colWidth - 4).
+		Padding(0, 1)
+
+	if isSelected {
+		cardStyle = cardStyle.
+			Background(t.Highlight).
+			Foreground(t.Foreground)
+	} else {
+		cardStyle = cardStyle.
+			Foreground(t.Foreground)
+	}
+
+	// Project name (inline, with color)
+	var projectStr string
+	if task.ProjectID != nil && *task.ProjectID != "inbox" {
+		project := v.getProjectByID(*task.ProjectID)
+		if project != nil {
+			projectStyle := lipgloss.NewStyle().Foreground(t.Secondary)
+			if project.Color != "" {
+				projectStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(project.Color))
+			}
+			projectStr = projectStyle.Render("[" + project.Name + "] ")
+		}
+	}
+
+	// Priority indicator
+	priorityChar := ""
+	priorityStyle := lipgloss.NewStyle()
+	switch task.Priority {
+	case model.PriorityUrgent:
+		priorityChar = priorityStyle.Foreground(t.PriorityUrgent).Render("!")
+	case model.PriorityHigh:
+		priorityChar = priorityStyle.Foreground(t.PriorityHigh).Render("▲")
+	case model.PriorityMedium:
+		priorityChar = priorityStyle.Foreground(t.PriorityMedium).Render("●")
+	case model.PriorityLow:
+		priorityChar = priorityStyle.Foreground(t.PriorityLow).Render("▽")
+	}
+
+	// Subtask indicator (done/total)
+	var subtaskStr string
+	subtaskLen := 0
+	if counts, ok := v.subtaskCounts[task.ID]; ok {
+		total, done := counts[0], counts[1]
+		subtaskStyle := lipgloss.NewStyle().Foreground(t.Subtle)
+		if done == total {
+			subtaskStyle = lipgloss.NewStyle().Foreground(t.Success)
+		}
+		subtaskStr = subtaskStyle.Render(fmt.Sprintf(" (%d/%d)", done, total))
+		subtaskLen = len(fmt.Sprintf(" (%d/%d)", done, total))
+	}
+
+	// Time estimate
+	var estimateStr string
+	estimateLen := 0
+	if task.TimeEstimate != nil {
+		estimateText := " ~" + model.FormatEstimate(*task.TimeEstimate)
+		estimateStr = lipgloss.NewStyle().Foreground(t.Subtle).Render(estimateText)
+		estimateLen = len(estimateText)
+	}
+
+	// Truncate title to fit (account for project name, subtask indicator and estimate length)
+	title := task.Title
+	projectLen := 0
+	if projectStr != "" {
+		// Rough estimate of visible chars in project string
+		if task.ProjectID != nil {
+			if p := v.getProjectByID(*task.ProjectID); p != nil {
+				projectLen = len(p.Name) + 3 // brackets + space
+			}
+		}
+	}
+	maxTitleLen := colWidth - 8 - projectLen - subtaskLen - estimateLen
+	if maxTitleLen < 10 {
+		maxTitleLen = 10
+	}
+	if len(title) > maxTitleLen {
+		title = title[:maxTitleLen-3] + "..."
+	}
+
+	// Build card: priority + project + title + subtasks + estimate (single line)
+	cardContent := fmt.Sprintf("%s %s%s%s%s", priorityChar, projectStr, title, subtaskStr, estimateStr)
+	return cardStyle.Render(cardContent)
+}
+
 // renderProjectSelector renders the project selector popup
 func (v KanbanView) renderProjectSelector(colWidth int) string {
 	t := theme.Current.Theme
@@ -1199,6 +1502,7 @@ func (v KanbanView) IsInputMode() bool {
 		v.mode == KanbanModeEdit ||
 		v.mode == KanbanModeSearch ||
 		v.mode == KanbanModeConfirmDelete ||
+		v.mode == KanbanModeWIPLimit ||
 		v.selectingProject ||
 		v.selectingTag
 }
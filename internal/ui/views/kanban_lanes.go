@@ -0,0 +1,242 @@
+package views
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/dori/klonch/internal/db"
+	"github.com/dori/klonch/internal/model"
+	"github.com/dori/klonch/internal/ui/theme"
+)
+
+// kanbanLane is a horizontal swimlane across the board: the tasks of one
+// project, priority, tag or parent in every column
+type kanbanLane struct {
+	key   string // Unique across grouping modes, so folds don't carry over
+	title string
+	color lipgloss.Color
+	rank  int
+	tasks [][]model.Task // By column
+}
+
+// hasLanes reports whether the board is split into swimlanes
+func (v *KanbanView) hasLanes() bool {
+	return v.swimlanes != "" && v.swimlanes != db.SwimlanesNone
+}
+
+// lanes groups the tasks matching the filters into swimlanes, in order.
+// Lanes without tasks are left out; with lanes by tag a task is in the
+// lane of each of its tags.
+func (v *KanbanView) lanes() []kanbanLane {
+	byKey := make(map[string]*kanbanLane)
+	var order []*kanbanLane
+	for col := range v.columns {
+		for _, task := range v.matchingColumn(col) {
+			for _, l := range v.lanesOf(task, len(order)) {
+				lane, ok := byKey[l.key]
+				if !ok {
+					lane = &l
+					lane.tasks = make([][]model.Task, len(v.columns))
+					byKey[l.key] = lane
+					order = append(order, lane)
+				}
+				lane.tasks[col] = append(lane.tasks[col], task)
+			}
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool { return order[i].rank < order[j].rank })
+
+	lanes := make([]kanbanLane, len(order))
+	for i, lane := range order {
+		lanes[i] = *lane
+	}
+	return lanes
+}
+
+// lanesOf returns the lanes a task goes in, without their tasks. Lanes
+// ranked by first appearance take seen, the number of lanes so far.
+func (v *KanbanView) lanesOf(task model.Task, seen int) []kanbanLane {
+	t := theme.Current.Theme
+	key := v.swimlanes + ":"
+
+	switch v.swimlanes {
+	case db.SwimlanesProject:
+		id := "inbox"
+		if task.ProjectID != nil {
+			id = *task.ProjectID
+		}
+		for i, p := range v.projects {
+			if p.ID == id {
+				return []kanbanLane{{key: key + id, title: p.Name, color: lipgloss.Color(p.Color), rank: i}}
+			}
+		}
+		return []kanbanLane{{key: key + id, title: "Inbox", color: t.Subtle, rank: len(v.projects)}}
+
+	case db.SwimlanesPriority:
+		priorities := []model.Priority{model.PriorityUrgent, model.PriorityHigh, model.PriorityMedium, model.PriorityLow}
+		colors := []lipgloss.Color{t.PriorityUrgent, t.PriorityHigh, t.PriorityMedium, t.PriorityLow}
+		for i, p := range priorities {
+			if task.Priority == p {
+				name := string(p)
+				return []kanbanLane{{key: key + name, title: strings.ToUpper(name[:1]) + name[1:], color: colors[i], rank: i}}
+			}
+		}
+		return []kanbanLane{{key: key, title: "No priority", color: t.Subtle, rank: len(priorities)}}
+
+	case db.SwimlanesTag:
+		var lanes []kanbanLane
+		for _, id := range v.taskTags[task.ID] {
+			for i, tag := range v.tags {
+				if tag.ID == id {
+					lanes = append(lanes, kanbanLane{key: key + id, title: tag.DisplayName(), color: lipgloss.Color(tag.Color), rank: i})
+				}
+			}
+		}
+		if len(lanes) == 0 {
+			lanes = append(lanes, kanbanLane{key: key, title: "No tag", color: t.Subtle, rank: math.MaxInt})
+		}
+		return lanes
+
+	case db.SwimlanesParent:
+		if task.ParentID == nil {
+			return []kanbanLane{{key: key, title: "No parent", color: t.Subtle, rank: math.MaxInt}}
+		}
+		return []kanbanLane{{key: key + *task.ParentID, title: v.parentTitles[*task.ParentID], color: t.Secondary, rank: seen}}
+	}
+	return nil
+}
+
+// laneHeight is the number of rows below a lane's header: the most tasks
+// it has in any column, or none while collapsed
+func (v *KanbanView) laneHeight(lane kanbanLane) int {
+	if v.collapsedLanes[lane.key] {
+		return 0
+	}
+	height := 0
+	for _, tasks := range lane.tasks {
+		height = max(height, len(tasks))
+	}
+	return height
+}
+
+// currentLane returns the key of the lane the cursor is in, or nil
+func (v *KanbanView) currentLane() *string {
+	if !v.hasLanes() {
+		return nil
+	}
+	row := v.cursorRow
+	for _, lane := range v.lanes() {
+		if v.collapsedLanes[lane.key] {
+			continue
+		}
+		n := len(lane.tasks[v.currentColumn])
+		if row < n {
+			return &lane.key
+		}
+		row -= n
+	}
+	return nil
+}
+
+// wipCount counts the tasks in a column towards its WIP limit: the
+// top-level ones on the board, whatever the query filter hides
+func (v *KanbanView) wipCount(col int) int {
+	if col >= len(v.columns) {
+		return 0
+	}
+	count := 0
+	for _, task := range v.columns[col] {
+		if task.ParentID != nil {
+			continue
+		}
+		if v.filterProjectID != "" && v.filterProjectID != "selecting" {
+			if task.ProjectID == nil || *task.ProjectID != v.filterProjectID {
+				continue
+			}
+		}
+		count++
+	}
+	return count
+}
+
+// ensureLaneCursorVisible scrolls the lanes, which scroll together across
+// the columns, so that the cursor's row is among the visible lines, along
+// with its lane's header when it is the lane's first task
+func (v *KanbanView) ensureLaneCursorVisible(visible int) {
+	line, row := 0, v.cursorRow
+	for _, lane := range v.lanes() {
+		header := line
+		line++
+		if v.collapsedLanes[lane.key] {
+			continue
+		}
+		if n := len(lane.tasks[v.currentColumn]); row >= n {
+			row -= n
+			line += v.laneHeight(lane)
+			continue
+		}
+		cursor, top := line+row, line+row
+		if row == 0 {
+			top = header
+		}
+		if cursor >= v.laneScroll+visible {
+			v.laneScroll = cursor - visible + 1
+		}
+		if top < v.laneScroll {
+			v.laneScroll = top
+		}
+		return
+	}
+}
+
+// renderLaneColumn renders the visible lines of a column split into
+// swimlanes. Every column has the same lines, so lanes line up across
+// the board.
+func (v KanbanView) renderLaneColumn(lanes []kanbanLane, col, colWidth, visible int, isActiveCol bool) []string {
+	t := theme.Current.Theme
+
+	var lines []string
+	row := 0
+	for _, lane := range lanes {
+		tasks := lane.tasks[col]
+		marker := "▾"
+		if v.collapsedLanes[lane.key] {
+			marker = "▸"
+		}
+		header := fmt.Sprintf("%s %s (%d)", marker, lane.title, len(tasks))
+		lines = append(lines, lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lane.color).
+			MaxWidth(colWidth-2).
+			Render(header))
+
+		height := v.laneHeight(lane)
+		for i := 0; i < height; i++ {
+			if i >= len(tasks) {
+				lines = append(lines, "")
+				continue
+			}
+			lines = append(lines, v.renderCard(tasks[i], colWidth, isActiveCol && row+i == v.cursorRow))
+		}
+		if height > 0 {
+			row += len(tasks)
+		}
+	}
+
+	scroll := max(0, min(v.laneScroll, len(lines)-visible))
+	end := min(scroll+visible, len(lines))
+
+	indicator := lipgloss.NewStyle().Foreground(t.Subtle).Italic(true)
+	var shown []string
+	if scroll > 0 {
+		shown = append(shown, indicator.Render("  ↑ more"))
+	}
+	shown = append(shown, lines[scroll:end]...)
+	if end < len(lines) {
+		shown = append(shown, indicator.Render("  ↓ more"))
+	}
+	return shown
+}
@@ -6,13 +6,14 @@ import (
 	"strings"
 	"time"
 
+	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/dori/klonch/internal/db"
 	"github.com/dori/klonch/internal/model"
+	"github.com/dori/klonch/internal/parse"
 	"github.com/dori/klonch/internal/ui/theme"
-	"github.com/google/uuid"
 )
 
 // Debug logging (enable by setting KLONCH_DEBUG=1)
@@ -39,11 +40,14 @@ const (
 	ListModeAdd
 	ListModeAddSubtask
 	ListModeEdit
+	ListModeRecurrence
 	ListModeSearch
 	ListModeCommand
 	ListModeConfirmDelete
 	ListModeConfirmDeleteProject
 	ListModeConfirmDeleteTag
+	ListModeNotes
+	ListModeComment
 )
 
 // ListViewMode represents what tasks are shown
@@ -68,25 +72,16 @@ func (m ListViewMode) String() string {
 	}
 }
 
-// UndoActionType represents the type of action for undo/redo
-type UndoActionType int
-
-const (
-	UndoActionCreate UndoActionType = iota
-	UndoActionDelete
-	UndoActionUpdate
-	UndoActionToggleStatus
-	UndoActionSetParent
-)
-
-// UndoAction represents an undoable action
-type UndoAction struct {
-	Type        UndoActionType
-	TaskID      string
-	Task        *model.Task // For create/delete - the full task
-	OldTask     *model.Task // For update - the old state
-	NewTask     *model.Task // For update - the new state
-	Description string      // Human-readable description
+// parseListViewMode maps a stored setting value back to a view mode
+func parseListViewMode(value string) ListViewMode {
+	switch value {
+	case "active":
+		return ViewModeActive
+	case "recent":
+		return ViewModeRecent
+	default:
+		return ViewModeAll
+	}
 }
 
 // projectColors is a palette of distinct colors for projects
@@ -141,6 +136,9 @@ type CommandDef struct {
 // allCommands is the list of available commands
 var allCommands = []CommandDef{
 	{Name: "due", Aliases: []string{"d"}, Description: "Set due date", Usage: "due tomorrow", HasArgs: true},
+	{Name: "defer", Aliases: []string{"snooze"}, Description: "Hide task(s) until a start date", Usage: "defer monday", HasArgs: true},
+	{Name: "estimate", Aliases: []string{"est"}, Description: "Set time estimate", Usage: "estimate 1h30m", HasArgs: true},
+	{Name: "remind", Aliases: []string{"reminders"}, Description: "Set reminders before due (none, default)", Usage: "remind 1d,1h", HasArgs: true},
 	{Name: "priority", Aliases: []string{"pri", "p"}, Description: "Set priority", Usage: "priority high", HasArgs: true},
 	{Name: "tag", Aliases: []string{"t"}, Description: "Add tag to task", Usage: "tag @work", HasArgs: true},
 	{Name: "project", Aliases: []string{"proj", "mv", "move"}, Description: "Move to project", Usage: "project inbox", HasArgs: true},
@@ -157,19 +155,25 @@ var allCommands = []CommandDef{
 	{Name: "colors", Aliases: []string{"lsc"}, Description: "List available colors", Usage: "colors", HasArgs: false},
 	{Name: "recolortags", Aliases: []string{}, Description: "Reassign colors to all tags", Usage: "recolortags", HasArgs: false},
 	{Name: "done", Aliases: []string{"complete", "finish"}, Description: "Toggle done status", Usage: "done", HasArgs: false},
+	{Name: "repeat", Aliases: []string{"recur", "every"}, Description: "Set recurrence (empty/none clears)", Usage: "repeat every 2 weeks on mon,fri", HasArgs: true},
 	{Name: "archive", Aliases: []string{"arch"}, Description: "Archive task(s)", Usage: "archive", HasArgs: false},
 	{Name: "delete", Aliases: []string{"del", "rm"}, Description: "Delete task(s)", Usage: "delete", HasArgs: false},
 	{Name: "theme", Aliases: []string{}, Description: "Change theme", Usage: "theme nord", HasArgs: true},
-	{Name: "sort", Aliases: []string{}, Description: "Sort tasks", Usage: "sort priority", HasArgs: true},
-	{Name: "filter", Aliases: []string{"f"}, Description: "Filter tasks by text", Usage: "filter @work", HasArgs: true},
+	{Name: "set", Aliases: []string{}, Description: "Change a setting", Usage: "set list.wrap on", HasArgs: true},
+	{Name: "settings", Aliases: []string{"prefs"}, Description: "Show all settings", Usage: "settings", HasArgs: false},
+	{Name: "sort", Aliases: []string{}, Description: "Sort tasks (saved per project)", Usage: "sort due, priority asc", HasArgs: true},
+	{Name: "filter", Aliases: []string{"f"}, Description: "Filter tasks with a query", Usage: "filter #work and (@review or priority>=high)", HasArgs: true},
 	{Name: "filterproject", Aliases: []string{"fp"}, Description: "Filter by project", Usage: "filterproject", HasArgs: false},
 	{Name: "filtertag", Aliases: []string{"ft"}, Description: "Filter by tag", Usage: "filtertag", HasArgs: false},
 	{Name: "clear", Aliases: []string{}, Description: "Clear all filters", Usage: "clear", HasArgs: false},
+	{Name: "savelist", Aliases: []string{"sl"}, Description: "Save the filter query as a smart list", Usage: "savelist Due soon", HasArgs: true},
+	{Name: "deletelist", Aliases: []string{"dl", "rmlist"}, Description: "Delete a smart list", Usage: "deletelist Due soon", HasArgs: true},
+	{Name: "lists", Aliases: []string{"lsl"}, Description: "List smart lists", Usage: "lists", HasArgs: false},
 	{Name: "projects", Aliases: []string{"lsp"}, Description: "List all projects", Usage: "projects", HasArgs: false},
 	{Name: "tags", Aliases: []string{"lst"}, Description: "List all tags", Usage: "tags", HasArgs: false},
 	{Name: "starttime", Aliases: []string{"start", "track"}, Description: "Start time tracking", Usage: "starttime", HasArgs: false},
 	{Name: "stoptime", Aliases: []string{"stop"}, Description: "Stop time tracking", Usage: "stoptime", HasArgs: false},
-	{Name: "addtime", Aliases: []string{"logtime"}, Description: "Log time manually", Usage: "addtime 30m", HasArgs: true},
+	{Name: "addtime", Aliases: []string{"logtime"}, Description: "Log time manually, with an optional description", Usage: "addtime 30m Code review", HasArgs: true},
 	{Name: "help", Aliases: []string{"h", "?"}, Description: "Show available commands", Usage: "help", HasArgs: false},
 }
 
@@ -191,18 +195,26 @@ type ListView struct {
 	taskDepth    map[string]int    // Depth level of each task (0 = top-level)
 	textWrap     bool              // Whether to wrap long task titles
 	mouseEnabled bool              // Whether mouse capture is enabled
+	showDetails  bool              // Whether the detail pane is beside the list
 
 	mode           ListMode
 	input          textinput.Model
+	notes          textarea.Model // Description editor in the detail pane
+	history        taskHistoryMsg // Comments and activity of the task in the detail pane
+	historyFor     string         // Task whose history was last asked for
 	editingID      string
-	editingOldTask *model.Task // Original task state before editing (for undo)
+	editingEstimate *int // Estimate when editing began, to spot changes
 	parentID       string      // For creating subtasks
 	searchFilter string // Current search filter
 	statusMsg    string // Status message to display
 
 	// Structured filters (combine with AND logic)
-	filterProjectID string   // Filter by specific project (empty = all)
-	filterTagIDs    []string // Filter by tags (all must match)
+	filterProjectID string          // Filter by specific project (empty = all)
+	filterTagIDs    []string        // Filter by tags (all must match)
+	filterQuery     *db.Query       // Filter by query (:filter or a smart list)
+	filterListName  string          // Smart list the query came from, if any
+	queryMatches    map[string]bool // IDs of tasks the query matched at last load
+	smartLists      []model.SmartList
 
 	// For project/tag selection
 	selectingProject bool
@@ -235,11 +247,6 @@ type ListView struct {
 	cmdSuggestions []CommandDef // Filtered command suggestions
 	cmdCursor      int          // Selected suggestion index
 
-	// For time tracking
-	activeTimeEntryID string    // Currently active time entry ID (empty if not tracking)
-	activeTaskID      string    // Task being tracked
-	trackingStarted   time.Time // When tracking started
-
 	// For deferred sorting (e.g., after priority change)
 	deferResortTaskID string // Task ID that was modified; resort when cursor moves away
 
@@ -249,9 +256,8 @@ type ListView struct {
 	// View mode filter
 	viewMode ListViewMode // What tasks to show (All, Active, Recent, etc.)
 
-	// Undo/redo history
-	undoStack []UndoAction
-	redoStack []UndoAction
+	listSort     model.SortOrder // Order when no project is chosen (list.sort)
+	showDeferred bool            // Show tasks whose start date is still ahead
 }
 
 // NewListView creates a new list view
@@ -260,14 +266,37 @@ func NewListView(database *db.DB) ListView {
 	ti.Placeholder = "New task..."
 	ti.CharLimit = 256
 
+	// Restore saved preferences
+	mode, _ := database.GetSetting(db.SettingListViewMode)
+	wrap, _ := database.GetBoolSetting(db.SettingListWrap)
+	mouse, err := database.GetBoolSetting(db.SettingMouse)
+	if err != nil {
+		mouse = true
+	}
+	sortSpec, _ := database.GetSetting(db.SettingListSort)
+	listSort, _ := model.ParseSortOrder(sortSpec)
+	showDeferred, _ := database.GetBoolSetting(db.SettingShowDeferred)
+	details, _ := database.GetBoolSetting(db.SettingListDetails)
+
+	notes := textarea.New()
+	notes.Placeholder = "Notes in Markdown..."
+	notes.ShowLineNumbers = false
+	notes.CharLimit = 0
+
 	return ListView{
 		db:           database,
 		selected:     make(map[string]bool),
 		expanded:     make(map[string]bool),
 		blocked:      make(map[string]bool),
 		taskDepth:    make(map[string]int),
-		mouseEnabled: true,
+		textWrap:     wrap,
+		mouseEnabled: mouse,
+		viewMode:     parseListViewMode(mode),
+		listSort:     listSort,
+		showDeferred: showDeferred,
+		showDetails:  details,
 		input:        ti,
+		notes:        notes,
 	}
 }
 
@@ -277,26 +306,85 @@ func (v ListView) Init() tea.Cmd {
 	return v.loadTasks
 }
 
+// RevealTask clears filters, expands the task's parents and, once tasks
+// reload, puts the cursor on it. Completed tasks switch the view mode to All
+// for this session without saving it.
+func (v ListView) RevealTask(task model.Task, ancestors []model.Task) (ListView, tea.Cmd) {
+	v.mode = ListModeNormal
+	v.clearFilters()
+
+	hidden := task.Status == model.StatusDone
+	for _, a := range ancestors {
+		v.expanded[a.ID] = true
+		if a.Status == model.StatusDone {
+			hidden = true
+		}
+	}
+	if hidden {
+		v.viewMode = ViewModeAll
+	}
+
+	v.focusAfterLoadTaskID = task.ID
+	return v, v.loadTasks
+}
+
 // IsInputMode returns true when the view is capturing text input
 // (add, edit, subtask, search, command modes or any selector is active)
 func (v ListView) IsInputMode() bool {
-	if v.mode == ListModeAdd || v.mode == ListModeEdit || v.mode == ListModeAddSubtask || v.mode == ListModeSearch || v.mode == ListModeCommand {
+	if v.mode == ListModeAdd || v.mode == ListModeEdit || v.mode == ListModeAddSubtask || v.mode == ListModeSearch || v.mode == ListModeCommand || v.mode == ListModeRecurrence || v.mode == ListModeComment {
 		return true
 	}
 	if v.selectingProject || v.selectingTag || v.selectingDep || v.selectingProjectFilter || v.selectingTagFilter || v.selectingParent {
 		return true
 	}
-	if v.mode == ListModeConfirmDelete {
+	if v.mode == ListModeConfirmDelete || v.mode == ListModeNotes {
 		return true
 	}
 	return false
 }
 
+// IsEditingNotes returns true while the description editor is open
+func (v ListView) IsEditingNotes() bool {
+	return v.mode == ListModeNotes
+}
+
 // SetSize updates the view dimensions
 func (v ListView) SetSize(width, height int) ListView {
 	v.width = width
 	v.height = height
 	v.input.Width = width - 4
+	return v.sizeNotes()
+}
+
+// detailWidth returns the width of the detail pane, or 0 when it is hidden.
+// On a narrow terminal the pane takes the whole width.
+func (v ListView) detailWidth() int {
+	if !v.showDetails && v.mode != ListModeNotes {
+		return 0
+	}
+	if v.width < 80 {
+		return v.width
+	}
+	return min(max(v.width*2/5, 36), 64)
+}
+
+// detailHeight returns the height of the detail pane, leaving a line for
+// the root model's status message
+func (v ListView) detailHeight() int {
+	return max(v.height-1, 6)
+}
+
+// sizeNotes fits the description editor to the detail pane, below the
+// task's title and fields
+func (v ListView) sizeNotes() ListView {
+	width := max(v.detailWidth(), 20) - 4
+	v.notes.SetWidth(width)
+	header := 2
+	if task := v.findTask(v.editingID); task != nil {
+		header = lipgloss.Height(v.renderDetailHeader(*task, width))
+	}
+	// The border and the blank line under the header take 3 lines
+	v.notes.SetHeight(max(v.detailHeight()-header-3, 3))
 	return v
 }
 
@@ -339,9 +427,35 @@ func (v *ListView) ensureCursorVisible() {
 
 // Update handles messages for the list view
 func (v ListView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	m, cmd := v.update(msg)
+	return m.(ListView).followDetails(cmd)
+}
+
+// followDetails loads the history of the task in the detail pane once the
+// cursor lands on another task
+func (v ListView) followDetails(cmd tea.Cmd) (tea.Model, tea.Cmd) {
+	if v.detailWidth() == 0 || v.mode == ListModeNotes || len(v.tasks) == 0 {
+		return v, cmd
+	}
+	taskID := v.tasks[v.cursor].ID
+	if taskID == v.historyFor {
+		return v, cmd
+	}
+	v.historyFor = taskID
+	return v, tea.Batch(cmd, loadTaskHistory(v.db, taskID))
+}
+
+func (v ListView) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
 
 	switch msg := msg.(type) {
+	case taskHistoryMsg:
+		if msg.err != nil {
+			v.statusMsg = fmt.Sprintf("Error: %v", msg.err)
+		}
+		v.history = msg
+		return v, nil
+
 	case tasksLoadedMsg:
 		debugf("tasksLoadedMsg received, err=%v, count=%d", msg.err, len(msg.tasks))
 		if msg.err != nil {
@@ -354,7 +468,10 @@ func (v ListView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		v.projects = msg.projects
 		v.tags = msg.tags
 		v.blocked = msg.blocked
+		v.smartLists = msg.smartLists
+		v.queryMatches = msg.queryMatches
 		v.applyFilter() // Apply hideDone and searchFilter
+		v.historyFor = "" // The history may have changed too
 		v.statusMsg = fmt.Sprintf("Loaded %d tasks", len(v.tasks))
 		debugf("v.tasks now has %d items (flattened)", len(v.tasks))
 
@@ -369,6 +486,7 @@ func (v ListView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 			}
 			v.focusAfterLoadTaskID = ""
+			v.ensureCursorVisible()
 		} else if v.cursor >= len(v.tasks) {
 			v.cursor = max(0, len(v.tasks)-1)
 		}
@@ -380,18 +498,22 @@ func (v ListView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return errorMsg{err: msg.err}
 			}
 		}
-		// Record undo action for task creation
-		task := msg.task
-		v.pushUndo(UndoAction{
-			Type:        UndoActionCreate,
-			TaskID:      task.ID,
-			Task:        &task,
-			Description: fmt.Sprintf("Create \"%s\"", task.Title),
-		})
 		// Focus on the new task after reload so user can adjust priority
 		v.focusAfterLoadTaskID = msg.task.ID
 		return v, v.loadTasks
 
+	case db.SettingChange:
+		return v.applySetting(msg), nil
+
+	case settingSavedMsg:
+		if msg.err != nil {
+			v.statusMsg = fmt.Sprintf("Error: %v", msg.err)
+			return v, nil
+		}
+		value, _ := v.db.GetSetting(msg.key)
+		v.statusMsg = fmt.Sprintf("%s = %s", msg.key, db.DisplaySetting(msg.key, value))
+		return v, nil
+
 	case taskUpdatedMsg:
 		if msg.err != nil {
 			return v, func() tea.Msg {
@@ -428,13 +550,20 @@ func (v ListView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return v, nil
 
 	case timeTrackingStoppedMsg:
+		if msg.duration < 0 {
+			v.statusMsg = "No active time tracking"
+			return v, nil
+		}
 		v.statusMsg = fmt.Sprintf("Stopped tracking: %d minutes logged", msg.duration)
-		return v, nil
+		return v, timerChanged
 
 	case timeAddedMsg:
 		v.statusMsg = fmt.Sprintf("Added %d minutes to task", msg.minutes)
 		return v, nil
 
+	case EditorClosedMsg:
+		return v.handleEditorClosed(msg)
+
 	case tea.MouseMsg:
 		// Handle mouse wheel scrolling
 		if v.mode == ListModeNormal {
@@ -462,6 +591,10 @@ func (v ListView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return v.handleAddSubtaskMode(msg)
 		case ListModeEdit:
 			return v.handleEditMode(msg)
+		case ListModeRecurrence:
+			return v.handleRecurrenceMode(msg)
+		case ListModeComment:
+			return v.handleCommentMode(msg)
 		case ListModeSearch:
 			return v.handleSearchMode(msg)
 		case ListModeCommand:
@@ -472,17 +605,24 @@ func (v ListView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return v.handleDeleteProjectConfirm(msg)
 		case ListModeConfirmDeleteTag:
 			return v.handleDeleteTagConfirm(msg)
+		case ListModeNotes:
+			return v.handleNotesMode(msg)
 		default:
 			return v.handleNormalMode(msg)
 		}
 	}
 
 	// Update text input if in input mode
-	if v.mode == ListModeAdd || v.mode == ListModeAddSubtask || v.mode == ListModeEdit || v.mode == ListModeSearch || v.mode == ListModeCommand {
+	if v.mode == ListModeAdd || v.mode == ListModeAddSubtask || v.mode == ListModeEdit || v.mode == ListModeSearch || v.mode == ListModeCommand || v.mode == ListModeRecurrence || v.mode == ListModeComment {
 		var cmd tea.Cmd
 		v.input, cmd = v.input.Update(msg)
 		cmds = append(cmds, cmd)
 	}
+	if v.mode == ListModeNotes {
+		var cmd tea.Cmd
+		v.notes, cmd = v.notes.Update(msg)
+		cmds = append(cmds, cmd)
+	}
 
 	return v, tea.Batch(cmds...)
 }
@@ -611,9 +751,7 @@ func (v ListView) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		if len(v.selected) > 0 {
 			v.selected = make(map[string]bool)
 		} else if v.hasActiveFilters() {
-			v.searchFilter = ""
-			v.filterProjectID = ""
-			v.filterTagIDs = nil
+			v.clearFilters()
 			v.applyFilter()
 		} else if len(v.expanded) > 0 {
 			// Collapse all expanded tasks
@@ -632,53 +770,49 @@ func (v ListView) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case "enter":
 		if len(v.tasks) > 0 {
 			task := v.tasks[v.cursor]
-			taskCopy := task
 			v.mode = ListModeEdit
 			v.editingID = task.ID
-			v.editingOldTask = &taskCopy // Save for undo
-			v.input.SetValue(task.Title)
+			v.editingEstimate = task.TimeEstimate
+			text := task.Title
+			if task.TimeEstimate != nil {
+				text += " ~" + model.FormatEstimate(*task.TimeEstimate)
+			}
+			v.input.SetValue(text)
 			v.input.Focus()
 			return v, textinput.Blink
 		}
 
 	case "tab":
-		// Toggle done - capture old state for undo
-		var targetTasks []model.Task
-		if len(v.selected) > 0 {
-			for id := range v.selected {
-				for _, task := range v.tasks {
-					if task.ID == id {
-						taskCopy := task
-						targetTasks = append(targetTasks, taskCopy)
-						break
-					}
-				}
-			}
-		} else if len(v.tasks) > 0 {
-			taskCopy := v.tasks[v.cursor]
-			targetTasks = append(targetTasks, taskCopy)
+		// Toggle done
+		return v, v.toggleSelected()
+
+	case "i":
+		// Toggle the detail pane
+		v.showDetails = !v.showDetails
+		return v, v.saveSetting(db.SettingListDetails, db.FormatBoolSetting(v.showDetails))
+
+	case "n":
+		// Write notes in the detail pane
+		if len(v.tasks) > 0 {
+			return v.startNotes(v.tasks[v.cursor])
 		}
-		// Record undo for each task
-		for _, task := range targetTasks {
-			oldTask := task
-			newTask := task
-			if task.Status == model.StatusDone {
-				newTask.Status = model.StatusPending
-				newTask.CompletedAt = nil
-			} else {
-				newTask.Status = model.StatusDone
-				now := time.Now()
-				newTask.CompletedAt = &now
-			}
-			v.pushUndo(UndoAction{
-				Type:        UndoActionToggleStatus,
-				TaskID:      task.ID,
-				OldTask:     &oldTask,
-				NewTask:     &newTask,
-				Description: fmt.Sprintf("Toggle \"%s\"", task.Title),
-			})
+
+	case "e":
+		// Edit the whole task in $EDITOR
+		if len(v.tasks) > 0 {
+			return v, EditTaskDocument(v.db, v.tasks[v.cursor].ID)
+		}
+
+	case "c":
+		// Comment on the task
+		if len(v.tasks) > 0 {
+			v.mode = ListModeComment
+			v.editingID = v.tasks[v.cursor].ID
+			v.input.SetValue("")
+			v.input.Placeholder = "Add a comment..."
+			v.input.Focus()
+			return v, textinput.Blink
 		}
-		return v, v.toggleSelected()
 
 	case "d":
 		// Delete
@@ -695,32 +829,7 @@ func (v ListView) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 
 	case "p":
-		// Cycle priority - capture old state for undo
-		if len(v.tasks) > 0 {
-			task := v.tasks[v.cursor]
-			oldTask := task
-			newTask := task
-			// Calculate new priority
-			switch task.Priority {
-			case model.PriorityLow:
-				newTask.Priority = model.PriorityMedium
-			case model.PriorityMedium:
-				newTask.Priority = model.PriorityHigh
-			case model.PriorityHigh:
-				newTask.Priority = model.PriorityUrgent
-			case model.PriorityUrgent:
-				newTask.Priority = model.PriorityLow
-			default:
-				newTask.Priority = model.PriorityMedium
-			}
-			v.pushUndo(UndoAction{
-				Type:        UndoActionUpdate,
-				TaskID:      task.ID,
-				OldTask:     &oldTask,
-				NewTask:     &newTask,
-				Description: fmt.Sprintf("Priority %s → %s", oldTask.Priority, newTask.Priority),
-			})
-		}
+		// Cycle priority
 		return v, v.cyclePriority()
 
 	case "/":
@@ -944,9 +1053,22 @@ func (v ListView) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return v, nil
 
 	case "r":
+		// Edit recurrence rule
+		if len(v.tasks) > 0 {
+			return v.startRecurrenceEdit(v.tasks[v.cursor])
+		}
+		return v, nil
+
+	case "R":
 		// Refresh/reload tasks
 		return v, v.loadTasks
 
+	case "J":
+		return v.moveTask(1)
+
+	case "K":
+		return v.moveTask(-1)
+
 	case "H":
 		// Cycle through view modes: All -> Active -> Recent -> All
 		switch v.viewMode {
@@ -959,7 +1081,7 @@ func (v ListView) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 		v.applyFilter()
 		v.statusMsg = fmt.Sprintf("View: %s (H to cycle)", v.viewMode.String())
-		return v, nil
+		return v, v.saveSetting(db.SettingListViewMode, strings.ToLower(v.viewMode.String()))
 
 	case "A":
 		// Quick toggle between Active and All
@@ -971,7 +1093,7 @@ func (v ListView) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			v.statusMsg = "View: Active tasks only"
 		}
 		v.applyFilter()
-		return v, nil
+		return v, v.saveSetting(db.SettingListViewMode, strings.ToLower(v.viewMode.String()))
 
 	case "w":
 		// Toggle text wrap
@@ -981,26 +1103,18 @@ func (v ListView) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		} else {
 			v.statusMsg = "Text wrap: OFF"
 		}
-		return v, nil
-
-	case "ctrl+z":
-		// Undo
-		return v.undo()
-
-	case "ctrl+y", "ctrl+shift+z":
-		// Redo
-		return v.redo()
+		return v, v.saveSetting(db.SettingListWrap, db.FormatBoolSetting(v.textWrap))
 
 	case "X":
-		// Toggle mouse capture (disable for copy-paste)
+		// Toggle mouse capture (disable for copy-paste); the root model
+		// applies the change to the terminal when the setting is saved
 		v.mouseEnabled = !v.mouseEnabled
 		if v.mouseEnabled {
 			v.statusMsg = "Mouse enabled"
-			return v, tea.EnableMouseCellMotion
 		} else {
 			v.statusMsg = "Mouse disabled (select text now)"
-			return v, tea.DisableMouse
 		}
+		return v, v.saveSetting(db.SettingMouse, db.FormatBoolSetting(v.mouseEnabled))
 	}
 
 	return v, nil
@@ -1010,11 +1124,11 @@ func (v ListView) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 func (v ListView) handleAddMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "enter":
-		title := strings.TrimSpace(v.input.Value())
-		if title != "" {
+		text := strings.TrimSpace(v.input.Value())
+		if parse.QuickAdd(text, time.Now()).Title != "" {
 			v.mode = ListModeNormal
 			v.input.Blur()
-			return v, v.createTask(title)
+			return v, v.createTask(text)
 		}
 	case "esc":
 		v.mode = ListModeNormal
@@ -1031,11 +1145,11 @@ func (v ListView) handleAddMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 func (v ListView) handleAddSubtaskMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "enter":
-		title := strings.TrimSpace(v.input.Value())
-		if title != "" {
+		text := strings.TrimSpace(v.input.Value())
+		if parse.QuickAdd(text, time.Now()).Title != "" {
 			v.mode = ListModeNormal
 			v.input.Blur()
-			return v, v.createSubtask(title, v.parentID)
+			return v, v.createSubtask(text, v.parentID)
 		}
 	case "esc":
 		v.mode = ListModeNormal
@@ -1053,29 +1167,148 @@ func (v ListView) handleAddSubtaskMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 func (v ListView) handleEditMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "enter":
-		title := strings.TrimSpace(v.input.Value())
-		if title != "" && v.editingOldTask != nil {
-			// Only record undo if title actually changed
-			if title != v.editingOldTask.Title {
-				newTask := *v.editingOldTask
-				newTask.Title = title
-				v.pushUndo(UndoAction{
-					Type:        UndoActionUpdate,
-					TaskID:      v.editingID,
-					OldTask:     v.editingOldTask,
-					NewTask:     &newTask,
-					Description: fmt.Sprintf("Edit \"%s\"", v.editingOldTask.Title),
-				})
-			}
+		text := strings.TrimSpace(v.input.Value())
+		if parse.QuickAdd(text, time.Now()).Title != "" {
 			v.mode = ListModeNormal
 			v.input.Blur()
-			v.editingOldTask = nil
-			return v, v.updateTaskTitle(v.editingID, title)
+			return v, v.updateTaskTitle(v.editingID, text, v.editingEstimate)
+		}
+	case "esc":
+		v.mode = ListModeNormal
+		v.input.Blur()
+		return v, nil
+	}
+
+	var cmd tea.Cmd
+	v.input, cmd = v.input.Update(msg)
+	return v, cmd
+}
+
+// startNotes opens the description editor in the detail pane
+func (v ListView) startNotes(task model.Task) (tea.Model, tea.Cmd) {
+	v.mode = ListModeNotes
+	v.editingID = task.ID
+	v.notes.SetValue(task.Description)
+	v.notes.Focus()
+	v = v.sizeNotes()
+	return v, textarea.Blink
+}
+
+// handleNotesMode handles keypresses in the description editor. Ctrl+E
+// carries the draft over to $EDITOR and brings it back for saving.
+func (v ListView) handleNotesMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+s":
+		v.mode = ListModeNormal
+		v.notes.Blur()
+		v.statusMsg = "Notes saved"
+		return v, v.setDescription(v.editingID, strings.TrimSpace(v.notes.Value()))
+	case "ctrl+e":
+		text := v.notes.Value()
+		if text != "" && !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		return v, openEditor(v.editingID, text, false)
+	case "esc":
+		v.mode = ListModeNormal
+		v.notes.Blur()
+		return v, nil
+	}
+
+	var cmd tea.Cmd
+	v.notes, cmd = v.notes.Update(msg)
+	return v, cmd
+}
+
+// handleEditorClosed saves what came back from $EDITOR: a whole task
+// document, or a draft of the notes for the description editor
+func (v ListView) handleEditorClosed(msg EditorClosedMsg) (tea.Model, tea.Cmd) {
+	if !msg.Document {
+		if msg.Err != nil {
+			v.statusMsg = fmt.Sprintf("Error: %v", msg.Err)
+			return v, nil
+		}
+		os.Remove(msg.Path)
+		if v.mode == ListModeNotes && v.editingID == msg.TaskID {
+			v.notes.SetValue(strings.TrimRight(msg.Text, "\n"))
+		}
+		return v, nil
+	}
+
+	status, err := saveTaskDocument(v.db, msg)
+	if err != nil {
+		v.statusMsg = fmt.Sprintf("Error: %v", err)
+		return v, nil
+	}
+	v.statusMsg = status
+	if !msg.Changed {
+		return v, nil
+	}
+	return v, v.loadTasks
+}
+
+// startRecurrenceEdit opens the recurrence editor for a task
+func (v ListView) startRecurrenceEdit(task model.Task) (tea.Model, tea.Cmd) {
+	v.mode = ListModeRecurrence
+	v.editingID = task.ID
+	v.input.SetValue("")
+	if rule := task.RecurrenceRule(); rule != nil {
+		v.input.SetValue(rule.String())
+	}
+	v.input.Placeholder = "daily | every 2 weeks on mon,fri | monthly on the last fri after completion | yearly until 2030-01-01"
+	v.input.CursorEnd()
+	v.input.Focus()
+	return v, textinput.Blink
+}
+
+// handleRecurrenceMode handles keypresses in the recurrence editor
+func (v ListView) handleRecurrenceMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		spec := strings.TrimSpace(v.input.Value())
+		var rule *model.Recurrence
+		if spec != "" && spec != "none" && spec != "never" {
+			parsed, err := model.ParseRecurrenceSpec(spec)
+			if err != nil {
+				v.statusMsg = fmt.Sprintf("Recurrence: %v", err)
+				return v, nil
+			}
+			rule = parsed
+		}
+		v.mode = ListModeNormal
+		v.input.Blur()
+		if rule == nil {
+			v.statusMsg = "Recurrence cleared"
+		} else {
+			v.statusMsg = "Repeats " + rule.String()
+		}
+		return v, v.setRecurrence(v.editingID, rule)
+	case "esc":
+		v.mode = ListModeNormal
+		v.input.Blur()
+		return v, nil
+	}
+
+	var cmd tea.Cmd
+	v.input, cmd = v.input.Update(msg)
+	return v, cmd
+}
+
+// handleCommentMode handles keypresses while a comment is written
+func (v ListView) handleCommentMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		body := strings.TrimSpace(v.input.Value())
+		v.mode = ListModeNormal
+		v.input.Blur()
+		if body == "" {
+			return v, nil
 		}
+		v.statusMsg = "Comment added"
+		return v, addComment(v.db, v.editingID, body)
 	case "esc":
 		v.mode = ListModeNormal
 		v.input.Blur()
-		v.editingOldTask = nil
 		return v, nil
 	}
 
@@ -1234,6 +1467,12 @@ func (v ListView) executeCommand(command string) (tea.Model, tea.Cmd) {
 	switch cmd {
 	case "due", "d":
 		return v.cmdSetDue(args)
+	case "defer", "snooze":
+		return v.cmdDefer(args)
+	case "estimate", "est":
+		return v.cmdSetEstimate(args)
+	case "remind", "reminders":
+		return v.cmdSetReminders(args)
 	case "priority", "pri", "p":
 		return v.cmdSetPriority(args)
 	case "tag", "t":
@@ -1268,12 +1507,21 @@ func (v ListView) executeCommand(command string) (tea.Model, tea.Cmd) {
 		return v.cmdListProjects()
 	case "tags", "lst":
 		return v.cmdListTags()
+	case "repeat", "recur", "every":
+		if cmd == "every" {
+			args = append([]string{"every"}, args...)
+		}
+		return v.cmdSetRecurrence(args)
 	case "archive", "arch":
 		return v.cmdArchive()
 	case "done", "complete":
 		return v.cmdToggleDone()
 	case "theme":
 		return v.cmdSetTheme(args)
+	case "set":
+		return v.cmdSet(args)
+	case "settings", "prefs":
+		return v.cmdShowSettings()
 	case "starttime", "start", "track":
 		return v.cmdStartTime()
 	case "stoptime", "stop":
@@ -1290,6 +1538,12 @@ func (v ListView) executeCommand(command string) (tea.Model, tea.Cmd) {
 		return v.cmdFilterTag()
 	case "clear":
 		return v.cmdClearFilters()
+	case "savelist", "sl":
+		return v.cmdSaveList(args)
+	case "deletelist", "dl", "rmlist":
+		return v.cmdDeleteList(args)
+	case "lists", "lsl":
+		return v.cmdListSmartLists()
 	case "sort":
 		return v.cmdSort(args)
 	default:
@@ -1301,13 +1555,13 @@ func (v ListView) executeCommand(command string) (tea.Model, tea.Cmd) {
 // cmdSetDue sets the due date for selected/current task
 func (v ListView) cmdSetDue(args []string) (tea.Model, tea.Cmd) {
 	if len(args) == 0 {
-		v.statusMsg = "Usage: due <date> (e.g., due tomorrow, due friday, due 2024-01-15)"
+		v.statusMsg = "Usage: due <date> [time] (e.g., due tomorrow, due fri 14:00, due in 3 days, due eow)"
 		return v, nil
 	}
 
 	dateStr := strings.Join(args, " ")
-	parsed := parseNaturalDate(dateStr)
-	if parsed == nil {
+	parsed, ok := parse.Date(dateStr, time.Now())
+	if !ok {
 		v.statusMsg = fmt.Sprintf("Could not parse date: %s", dateStr)
 		return v, nil
 	}
@@ -1318,7 +1572,7 @@ func (v ListView) cmdSetDue(args []string) (tea.Model, tea.Cmd) {
 		return v, nil
 	}
 
-	return v, v.setDueDate(taskIDs, *parsed)
+	return v, v.setDueDate(taskIDs, parsed)
 }
 
 // cmdSetPriority sets the priority for selected/current task
@@ -1353,6 +1607,50 @@ func (v ListView) cmdSetPriority(args []string) (tea.Model, tea.Cmd) {
 	return v, v.setPriority(taskIDs, p)
 }
 
+// cmdSetRecurrence sets or clears the recurrence rule for selected/current task
+func (v ListView) cmdSetRecurrence(args []string) (tea.Model, tea.Cmd) {
+	if len(args) == 0 {
+		v.statusMsg = "Usage: repeat <daily|weekly on mon,fri|monthly on the 15th|yearly> [after completion] [until DATE] [for N times] | none"
+		return v, nil
+	}
+
+	var rule *model.Recurrence
+	spec := strings.Join(args, " ")
+	if spec != "none" && spec != "never" {
+		parsed, err := model.ParseRecurrenceSpec(spec)
+		if err != nil {
+			v.statusMsg = fmt.Sprintf("Recurrence: %v", err)
+			return v, nil
+		}
+		rule = parsed
+	}
+
+	taskIDs := v.getTargetTaskIDs()
+	if len(taskIDs) == 0 {
+		v.statusMsg = "No task selected"
+		return v, nil
+	}
+
+	if rule == nil {
+		v.statusMsg = "Recurrence cleared"
+	} else {
+		v.statusMsg = "Repeats " + rule.String()
+	}
+	return v, func() tea.Msg {
+		for _, id := range taskIDs {
+			var r *model.Recurrence
+			if rule != nil {
+				copied := *rule
+				r = &copied
+			}
+			if err := v.db.SetTaskRecurrence(id, r); err != nil {
+				return taskUpdatedMsg{err: err}
+			}
+		}
+		return taskUpdatedMsg{}
+	}
+}
+
 // cmdAddTag adds a tag to selected/current task
 func (v ListView) cmdAddTag(args []string) (tea.Model, tea.Cmd) {
 	if len(args) == 0 {
@@ -1426,12 +1724,8 @@ func (v ListView) cmdNewProject(args []string) (tea.Model, tea.Cmd) {
 	color := projectColors[len(v.projects)%len(projectColors)]
 
 	// Create new project
-	projectID := uuid.New().String()
 	return v, func() tea.Msg {
-		_, err := v.db.Exec(`
-			INSERT INTO projects (id, name, color, position, created_at, updated_at)
-			VALUES (?, ?, ?, ?, datetime('now'), datetime('now'))
-		`, projectID, projectName, color, len(v.projects))
+		_, err := v.db.CreateProject(projectName, color)
 		if err != nil {
 			return taskUpdatedMsg{err: err}
 		}
@@ -1615,10 +1909,10 @@ func (v ListView) cmdRecolorProjects() (tea.Model, tea.Cmd) {
 	}
 
 	return v, func() tea.Msg {
+		db := v.db.Group("Recolor projects")
 		for i, p := range v.projects {
 			color := projectColors[i%len(projectColors)]
-			_, err := v.db.Exec(`UPDATE projects SET color = ? WHERE id = ?`, color, p.ID)
-			if err != nil {
+			if err := db.UpdateProject(p.ID, p.Name, color); err != nil {
 				return taskUpdatedMsg{err: err}
 			}
 		}
@@ -1638,8 +1932,8 @@ func (v ListView) cmdNewTag(args []string) (tea.Model, tea.Cmd) {
 
 	// Check if tag already exists
 	for _, t := range v.tags {
-		if strings.ToLower(t.Name) == strings.ToLower(tagName) {
-			v.statusMsg = fmt.Sprintf("Tag already exists: @%s", t.Name)
+		if strings.ToLower(strings.TrimPrefix(t.Name, "@")) == strings.ToLower(tagName) {
+			v.statusMsg = fmt.Sprintf("Tag already exists: @%s", strings.TrimPrefix(t.Name, "@"))
 			return v, nil
 		}
 	}
@@ -1648,12 +1942,8 @@ func (v ListView) cmdNewTag(args []string) (tea.Model, tea.Cmd) {
 	color := tagColors[len(v.tags)%len(tagColors)]
 
 	// Create new tag
-	tagID := uuid.New().String()
 	return v, func() tea.Msg {
-		_, err := v.db.Exec(`
-			INSERT INTO tags (id, name, color, created_at)
-			VALUES (?, ?, ?, datetime('now'))
-		`, tagID, tagName, color)
+		_, err := v.db.CreateTag(tagName, color)
 		if err != nil {
 			return taskUpdatedMsg{err: err}
 		}
@@ -1674,7 +1964,7 @@ func (v ListView) cmdRenameTag(args []string) (tea.Model, tea.Cmd) {
 	// Find the old tag
 	var oldTag *model.Tag
 	for i := range v.tags {
-		if strings.ToLower(v.tags[i].Name) == strings.ToLower(oldName) {
+		if strings.ToLower(strings.TrimPrefix(v.tags[i].Name, "@")) == strings.ToLower(oldName) {
 			oldTag = &v.tags[i]
 			break
 		}
@@ -1692,8 +1982,8 @@ func (v ListView) cmdRenameTag(args []string) (tea.Model, tea.Cmd) {
 
 	// Check if new name already exists
 	for _, t := range v.tags {
-		if strings.ToLower(t.Name) == strings.ToLower(newName) && t.ID != oldTag.ID {
-			v.statusMsg = fmt.Sprintf("Tag already exists: @%s", t.Name)
+		if strings.ToLower(strings.TrimPrefix(t.Name, "@")) == strings.ToLower(newName) && t.ID != oldTag.ID {
+			v.statusMsg = fmt.Sprintf("Tag already exists: @%s", strings.TrimPrefix(t.Name, "@"))
 			return v, nil
 		}
 	}
@@ -1720,7 +2010,7 @@ func (v ListView) cmdDeleteTag(args []string) (tea.Model, tea.Cmd) {
 	// Find the tag
 	var tag *model.Tag
 	for i := range v.tags {
-		if strings.ToLower(v.tags[i].Name) == strings.ToLower(tagName) {
+		if strings.ToLower(strings.TrimPrefix(v.tags[i].Name, "@")) == strings.ToLower(tagName) {
 			tag = &v.tags[i]
 			break
 		}
@@ -1752,7 +2042,7 @@ func (v ListView) cmdColorTag(args []string) (tea.Model, tea.Cmd) {
 	// Find the tag
 	var tag *model.Tag
 	for i := range v.tags {
-		if strings.ToLower(v.tags[i].Name) == strings.ToLower(tagName) {
+		if strings.ToLower(strings.TrimPrefix(v.tags[i].Name, "@")) == strings.ToLower(tagName) {
 			tag = &v.tags[i]
 			break
 		}
@@ -1823,10 +2113,10 @@ func (v ListView) cmdRecolorTags() (tea.Model, tea.Cmd) {
 	}
 
 	return v, func() tea.Msg {
+		db := v.db.Group("Recolor tags")
 		for i, t := range v.tags {
 			color := tagColors[i%len(tagColors)]
-			_, err := v.db.Exec(`UPDATE tags SET color = ? WHERE id = ?`, color, t.ID)
-			if err != nil {
+			if err := db.UpdateTag(t.ID, t.Name, color); err != nil {
 				return taskUpdatedMsg{err: err}
 			}
 		}
@@ -1858,7 +2148,7 @@ func (v ListView) cmdListTags() (tea.Model, tea.Cmd) {
 
 	var names []string
 	for _, t := range v.tags {
-		names = append(names, "@"+t.Name)
+		names = append(names, "@"+strings.TrimPrefix(t.Name, "@"))
 	}
 	v.statusMsg = fmt.Sprintf("Tags: %s", strings.Join(names, ", "))
 	return v, nil
@@ -1900,25 +2190,113 @@ func (v ListView) cmdSetTheme(args []string) (tea.Model, tea.Cmd) {
 	if t, ok := theme.ByName(themeName); ok {
 		theme.SetTheme(t)
 		v.statusMsg = fmt.Sprintf("Theme set to: %s", t.Name)
-	} else {
-		v.statusMsg = fmt.Sprintf("Unknown theme: %s", themeName)
+		return v, v.saveSetting(db.SettingTheme, t.Name)
+	}
+	v.statusMsg = fmt.Sprintf("Unknown theme: %s", themeName)
+	return v, nil
+}
+
+// cmdSet changes a setting, or shows its value when no value is given
+func (v ListView) cmdSet(args []string) (tea.Model, tea.Cmd) {
+	if len(args) == 0 {
+		return v.cmdShowSettings()
+	}
+
+	key := strings.ToLower(args[0])
+	def, ok := db.LookupSetting(key)
+	if !ok {
+		keys := make([]string, len(db.SettingDefs))
+		for i, d := range db.SettingDefs {
+			keys[i] = d.Key
+		}
+		v.statusMsg = fmt.Sprintf("Unknown setting: %s (try %s)", key, strings.Join(keys, ", "))
+		return v, nil
+	}
+
+	if len(args) == 1 {
+		value, err := v.db.GetSetting(key)
+		if err != nil {
+			v.statusMsg = fmt.Sprintf("Error: %v", err)
+			return v, nil
+		}
+		choices := ""
+		if def.Bool {
+			choices = " (on|off)"
+		} else if len(def.Choices) > 0 {
+			choices = fmt.Sprintf(" (%s)", strings.Join(def.Choices, "|"))
+		}
+		v.statusMsg = fmt.Sprintf("%s = %s%s — %s", key, db.DisplaySetting(key, value), choices, def.Description)
+		return v, nil
+	}
+
+	value := strings.Join(args[1:], " ")
+	if key == db.SettingTheme {
+		return v.cmdSetTheme(args[1:])
+	}
+
+	return v, func() tea.Msg {
+		err := v.db.SetSetting(key, value)
+		return settingSavedMsg{key: key, err: err}
+	}
+}
+
+// cmdShowSettings lists every setting with its current value
+func (v ListView) cmdShowSettings() (tea.Model, tea.Cmd) {
+	values, err := v.db.Settings()
+	if err != nil {
+		v.statusMsg = fmt.Sprintf("Error: %v", err)
+		return v, nil
+	}
+
+	parts := make([]string, len(db.SettingDefs))
+	for i, def := range db.SettingDefs {
+		parts[i] = fmt.Sprintf("%s=%s", def.Key, db.DisplaySetting(def.Key, values[def.Key]))
 	}
+	v.statusMsg = "Settings: " + strings.Join(parts, ", ")
 	return v, nil
 }
 
+// saveSetting persists a preference in the background
+func (v ListView) saveSetting(key, value string) tea.Cmd {
+	return func() tea.Msg {
+		if err := v.db.SetSetting(key, value); err != nil {
+			return settingSavedMsg{key: key, err: err}
+		}
+		return nil
+	}
+}
+
+// applySetting updates the view when a setting changes, e.g. through :set
+func (v ListView) applySetting(change db.SettingChange) ListView {
+	switch change.Key {
+	case db.SettingListViewMode:
+		v.viewMode = parseListViewMode(change.Value)
+		v.applyFilter()
+	case db.SettingListWrap:
+		v.textWrap = change.Value == "on"
+	case db.SettingListDetails:
+		v.showDetails = change.Value == "on"
+	case db.SettingMouse:
+		v.mouseEnabled = change.Value == "on"
+	case db.SettingListSort:
+		v.listSort, _ = model.ParseSortOrder(change.Value)
+		v.applyFilter()
+	case db.SettingShowDeferred:
+		v.showDeferred = change.Value == "on"
+		v.applyFilter()
+	}
+	return v
+}
+
 // cmdShowHelp shows available commands
 func (v ListView) cmdShowHelp() (tea.Model, tea.Cmd) {
 	v.statusMsg = "Commands: due, priority, tag, project, archive, done, theme, help"
 	return v, nil
 }
 
-// cmdStartTime starts time tracking for current/selected task
+// cmdStartTime starts time tracking for current/selected task. Whatever
+// timer was running, here or in another view, stops.
 func (v ListView) cmdStartTime() (tea.Model, tea.Cmd) {
-	// Stop any active tracking first
-	if v.activeTimeEntryID != "" {
-		v.cmdStopTime()
-	}
-
 	taskIDs := v.getTargetTaskIDs()
 	if len(taskIDs) == 0 {
 		v.statusMsg = "No task selected to track time"
@@ -1926,12 +2304,10 @@ func (v ListView) cmdStartTime() (tea.Model, tea.Cmd) {
 	}
 
 	taskID := taskIDs[0] // Only track one task at a time
-	entryID := uuid.New().String()
-	now := time.Now()
-
-	v.activeTimeEntryID = entryID
-	v.activeTaskID = taskID
-	v.trackingStarted = now
+	if _, err := v.db.StartTimeEntry(taskID, time.Now(), false); err != nil {
+		v.statusMsg = fmt.Sprintf("Error: %v", err)
+		return v, nil
+	}
 
 	// Find task title for status message
 	var taskTitle string
@@ -1942,39 +2318,22 @@ func (v ListView) cmdStartTime() (tea.Model, tea.Cmd) {
 		}
 	}
 
-	return v, func() tea.Msg {
-		_, err := v.db.Exec(`
-			INSERT INTO time_entries (id, task_id, started_at, is_pomodoro, created_at)
-			VALUES (?, ?, ?, 0, ?)
-		`, entryID, taskID, now, now)
-		if err != nil {
-			return taskUpdatedMsg{err: err}
-		}
+	return v, tea.Batch(timerChanged, func() tea.Msg {
 		return timeTrackingStartedMsg{taskID: taskID, taskTitle: taskTitle}
-	}
+	})
 }
 
-// cmdStopTime stops the active time tracking
+// cmdStopTime stops the running timer, whichever view started it
 func (v ListView) cmdStopTime() (tea.Model, tea.Cmd) {
-	if v.activeTimeEntryID == "" {
-		v.statusMsg = "No active time tracking"
-		return v, nil
-	}
-
-	entryID := v.activeTimeEntryID
-	now := time.Now()
-	duration := int(now.Sub(v.trackingStarted).Minutes())
-
-	// Reset tracking state
-	v.activeTimeEntryID = ""
-	v.activeTaskID = ""
-	v.trackingStarted = time.Time{}
-
 	return v, func() tea.Msg {
-		_, err := v.db.Exec(`
-			UPDATE time_entries SET ended_at = ?, duration = ?
-			WHERE id = ?
-		`, now, duration, entryID)
+		entry, err := v.db.RunningTimer()
+		if err != nil {
+			return taskUpdatedMsg{err: err}
+		}
+		if entry == nil {
+			return timeTrackingStoppedMsg{duration: -1}
+		}
+		duration, err := v.db.StopTimer(entry.ID, time.Now())
 		if err != nil {
 			return taskUpdatedMsg{err: err}
 		}
@@ -1985,7 +2344,7 @@ func (v ListView) cmdStopTime() (tea.Model, tea.Cmd) {
 // cmdAddTime adds a manual time entry
 func (v ListView) cmdAddTime(args []string) (tea.Model, tea.Cmd) {
 	if len(args) == 0 {
-		v.statusMsg = "Usage: addtime <duration> (e.g., addtime 30m, addtime 1h30m)"
+		v.statusMsg = "Usage: addtime <duration> [description] (e.g., addtime 30m, addtime 1h30m code review)"
 		return v, nil
 	}
 
@@ -2003,30 +2362,90 @@ func (v ListView) cmdAddTime(args []string) (tea.Model, tea.Cmd) {
 	}
 
 	taskID := taskIDs[0]
-	entryID := uuid.New().String()
-	now := time.Now()
+	description := strings.Join(args[1:], " ")
 
 	return v, func() tea.Msg {
-		_, err := v.db.Exec(`
-			INSERT INTO time_entries (id, task_id, started_at, ended_at, duration, is_pomodoro, created_at)
-			VALUES (?, ?, ?, ?, ?, 0, ?)
-		`, entryID, taskID, now.Add(-time.Duration(minutes)*time.Minute), now, minutes, now)
-		if err != nil {
+		if _, err := v.db.AddTimeEntry(taskID, time.Now(), minutes, description); err != nil {
 			return taskUpdatedMsg{err: err}
 		}
 		return timeAddedMsg{minutes: minutes}
 	}
 }
 
-// cmdFilter sets the text search filter
+// cmdFilter filters tasks with a query
 func (v ListView) cmdFilter(args []string) (tea.Model, tea.Cmd) {
 	if len(args) == 0 {
-		v.statusMsg = "Usage: filter <text> (e.g., filter @work)"
+		v.statusMsg = "Usage: filter <query> (e.g., filter #work and (@review or priority>=high) and due<+3d)"
 		return v, nil
 	}
-	v.searchFilter = strings.Join(args, " ")
-	v.applyFilter()
-	v.statusMsg = fmt.Sprintf("Filter: %s", v.searchFilter)
+	q, err := db.ParseQuery(strings.Join(args, " "))
+	if err != nil {
+		v.statusMsg = fmt.Sprintf("Filter: %v", err)
+		return v, nil
+	}
+	v.filterQuery = q
+	v.filterListName = ""
+	v.statusMsg = fmt.Sprintf("Filter: %s", q)
+	return v, v.loadTasks
+}
+
+// cmdSaveList saves the current filter query as a smart list
+func (v ListView) cmdSaveList(args []string) (tea.Model, tea.Cmd) {
+	if len(args) == 0 {
+		v.statusMsg = "Usage: savelist <name> (saves the current :filter query)"
+		return v, nil
+	}
+	if v.filterQuery == nil {
+		v.statusMsg = "No filter query to save (set one with :filter)"
+		return v, nil
+	}
+
+	name := strings.Join(args, " ")
+	query := v.filterQuery.String()
+	v.filterListName = name
+	return v, func() tea.Msg {
+		if _, err := v.db.SaveSmartList(name, query); err != nil {
+			return taskUpdatedMsg{err: err}
+		}
+		return taskUpdatedMsg{}
+	}
+}
+
+// cmdDeleteList deletes a smart list by name
+func (v ListView) cmdDeleteList(args []string) (tea.Model, tea.Cmd) {
+	if len(args) == 0 {
+		v.statusMsg = "Usage: deletelist <name>"
+		return v, nil
+	}
+
+	name := strings.Join(args, " ")
+	for _, l := range v.smartLists {
+		if strings.EqualFold(l.Name, name) {
+			if strings.EqualFold(v.filterListName, l.Name) {
+				v.filterListName = ""
+			}
+			v.statusMsg = fmt.Sprintf("Deleted smart list: %s", l.Name)
+			id := l.ID
+			return v, func() tea.Msg {
+				return taskUpdatedMsg{err: v.db.DeleteSmartList(id)}
+			}
+		}
+	}
+	v.statusMsg = fmt.Sprintf("No smart list named %q", name)
+	return v, nil
+}
+
+// cmdListSmartLists shows every smart list with its query
+func (v ListView) cmdListSmartLists() (tea.Model, tea.Cmd) {
+	if len(v.smartLists) == 0 {
+		v.statusMsg = "No smart lists (save one with :filter <query> then :savelist <name>)"
+		return v, nil
+	}
+	parts := make([]string, len(v.smartLists))
+	for i, l := range v.smartLists {
+		parts[i] = fmt.Sprintf("%s: %s", l.Name, l.Query)
+	}
+	v.statusMsg = "Smart lists: " + strings.Join(parts, " | ")
 	return v, nil
 }
 
@@ -2073,34 +2492,227 @@ func (v ListView) cmdSetParent() (tea.Model, tea.Cmd) {
 
 // cmdClearFilters clears all active filters
 func (v ListView) cmdClearFilters() (tea.Model, tea.Cmd) {
-	v.searchFilter = ""
-	v.filterProjectID = ""
-	v.filterTagIDs = nil
+	v.clearFilters()
 	v.applyFilter()
 	v.statusMsg = "Filters cleared"
 	return v, nil
 }
 
-// cmdSort sorts tasks by the given field
+// cmdSort sets the task order, saved for the filtered project or, with no
+// project chosen, as list.sort
 func (v ListView) cmdSort(args []string) (tea.Model, tea.Cmd) {
 	if len(args) == 0 {
-		v.statusMsg = "Usage: sort <priority|due|title|status>"
+		current := v.sortOrder().String()
+		if current == "" {
+			current = "default"
+		}
+		names := make([]string, len(model.SortFields))
+		for i, f := range model.SortFields {
+			names[i] = string(f)
+		}
+		v.statusMsg = fmt.Sprintf("Sort: %s (usage: sort <%s> [asc|desc], ... or sort default)",
+			current, strings.Join(names, "|"))
 		return v, nil
 	}
-	field := strings.ToLower(args[0])
-	switch field {
-	case "priority", "pri", "p":
-		v.statusMsg = "Sorted by priority"
-	case "due", "d":
-		v.statusMsg = "Sorted by due date"
-	case "title", "t":
-		v.statusMsg = "Sorted by title"
-	case "status", "s":
-		v.statusMsg = "Sorted by status"
+
+	var order model.SortOrder
+	spec := strings.Join(args, " ")
+	switch strings.ToLower(spec) {
+	case "default", "reset", "none":
 	default:
-		v.statusMsg = fmt.Sprintf("Unknown sort field: %s", field)
+		parsed, err := model.ParseSortOrder(spec)
+		if err != nil {
+			v.statusMsg = fmt.Sprintf("Sort: %v", err)
+			return v, nil
+		}
+		order = parsed
 	}
-	return v, nil
+
+	v.setSortOrder(order)
+	v.applyFilter()
+	if len(order) == 0 {
+		v.statusMsg = "Default order" + v.sortScope()
+	} else {
+		v.statusMsg = "Sorted by " + order.String() + v.sortScope()
+	}
+
+	projectID := v.filterProjectID
+	return v, func() tea.Msg {
+		var err error
+		if projectID != "" {
+			err = v.db.SetProjectSortOrder(projectID, order)
+		} else {
+			err = v.db.SetSetting(db.SettingListSort, order.String())
+		}
+		if err != nil {
+			return errorMsg{err: err}
+		}
+		return nil
+	}
+}
+
+// sortOrder is the order saved for the filtered project, else list.sort
+func (v ListView) sortOrder() model.SortOrder {
+	if v.filterProjectID != "" {
+		for _, p := range v.projects {
+			if p.ID == v.filterProjectID && p.SortOrder != "" {
+				if order, err := model.ParseSortOrder(p.SortOrder); err == nil {
+					return order
+				}
+			}
+		}
+	}
+	return v.listSort
+}
+
+// setSortOrder updates the loaded copy of the order sortOrder reads
+func (v *ListView) setSortOrder(order model.SortOrder) {
+	if v.filterProjectID == "" {
+		v.listSort = order
+		return
+	}
+	for i := range v.projects {
+		if v.projects[i].ID == v.filterProjectID {
+			v.projects[i].SortOrder = order.String()
+		}
+	}
+}
+
+// sortScope names where a sort order is saved, for status messages
+func (v ListView) sortScope() string {
+	if v.filterProjectID == "" {
+		return " for all tasks"
+	}
+	for _, p := range v.projects {
+		if p.ID == v.filterProjectID {
+			return " for " + p.Name
+		}
+	}
+	return ""
+}
+
+// moveTask moves the task under the cursor past its next visible sibling
+// and saves the result as manual positions. Under any other order the shown
+// order becomes the manual one first, so only the moved task changes place.
+func (v ListView) moveTask(delta int) (tea.Model, tea.Cmd) {
+	if len(v.tasks) == 0 {
+		return v, nil
+	}
+	task := v.tasks[v.cursor]
+	order := v.sortOrder()
+
+	// Positions are shared by every view, so only renumber the tasks of the
+	// project being shown
+	tree := v.allTasks
+	if v.filterProjectID != "" {
+		tree = nil
+		for _, t := range v.allTasks {
+			if t.ProjectID != nil && *t.ProjectID == v.filterProjectID {
+				tree = append(tree, t)
+			}
+		}
+	}
+	tree = model.SortTasks(tree, order)
+
+	siblings := tree
+	if task.ParentID != nil {
+		parent := findTask(tree, *task.ParentID)
+		if parent == nil {
+			return v, nil
+		}
+		siblings = parent.Subtasks
+	}
+
+	visible := make(map[string]bool, len(v.tasks))
+	for _, t := range v.tasks {
+		visible[t.ID] = true
+	}
+	from := -1
+	for i, t := range siblings {
+		if t.ID == task.ID {
+			from = i
+		}
+	}
+	if from < 0 {
+		return v, nil
+	}
+	to := from + delta
+	for to >= 0 && to < len(siblings) && !visible[siblings[to].ID] {
+		to += delta
+	}
+	if to < 0 || to >= len(siblings) {
+		if delta < 0 {
+			v.statusMsg = "Already at the top"
+		} else {
+			v.statusMsg = "Already at the bottom"
+		}
+		return v, nil
+	}
+
+	ids := make([]string, 0, len(siblings))
+	for _, t := range siblings {
+		if t.ID != task.ID {
+			ids = append(ids, t.ID)
+		}
+	}
+	ids = append(ids[:to], append([]string{task.ID}, ids[to:]...)...)
+
+	// Everything else keeps the order it is shown in
+	groups := [][]string{ids}
+	manual := model.SortOrder{{Field: model.SortManual}}
+	switching := !order.IsManual()
+	if switching {
+		groups = append(groups, siblingGroups(tree, siblings[0].ID)...)
+		v.setSortOrder(manual)
+	}
+
+	v.focusAfterLoadTaskID = task.ID
+	projectID := v.filterProjectID
+	return v, func() tea.Msg {
+		group := v.db.Group("Move task")
+		for _, ids := range groups {
+			if err := group.SetTaskPositions(ids); err != nil {
+				return taskUpdatedMsg{err: err}
+			}
+		}
+		if !switching {
+			return taskUpdatedMsg{}
+		}
+		if projectID != "" {
+			return taskUpdatedMsg{err: group.SetProjectSortOrder(projectID, manual)}
+		}
+		return taskUpdatedMsg{err: v.db.SetSetting(db.SettingListSort, manual.String())}
+	}
+}
+
+// findTask finds a task anywhere in a tree of tasks
+func findTask(tasks []model.Task, id string) *model.Task {
+	for i := range tasks {
+		if tasks[i].ID == id {
+			return &tasks[i]
+		}
+		if t := findTask(tasks[i].Subtasks, id); t != nil {
+			return t
+		}
+	}
+	return nil
+}
+
+// siblingGroups lists the IDs of each set of siblings in a tree, in order,
+// skipping the set that starts with skipID
+func siblingGroups(tasks []model.Task, skipID string) [][]string {
+	var groups [][]string
+	if len(tasks) > 0 && tasks[0].ID != skipID {
+		ids := make([]string, len(tasks))
+		for i, t := range tasks {
+			ids[i] = t.ID
+		}
+		groups = append(groups, ids)
+	}
+	for _, t := range tasks {
+		groups = append(groups, siblingGroups(t.Subtasks, skipID)...)
+	}
+	return groups
 }
 
 // parseTimeInput parses time input like "30m", "1h", "1h30m"
@@ -2153,7 +2765,7 @@ type timeTrackingStartedMsg struct {
 }
 
 type timeTrackingStoppedMsg struct {
-	duration int
+	duration int // Minutes logged; negative when no timer was running
 }
 
 type timeAddedMsg struct {
@@ -2172,13 +2784,140 @@ func (v ListView) getTargetTaskIDs() []string {
 	return ids
 }
 
+// cmdDefer hides the selected/current tasks until a start date
+func (v ListView) cmdDefer(args []string) (tea.Model, tea.Cmd) {
+	if len(args) == 0 {
+		v.statusMsg = "Usage: defer <date> (e.g., defer monday, defer 2024-01-15) | none"
+		return v, nil
+	}
+
+	var start *time.Time
+	dateStr := strings.Join(args, " ")
+	if dateStr != "none" && dateStr != "clear" {
+		parsed, ok := parse.Date(dateStr, time.Now())
+		if !ok {
+			v.statusMsg = fmt.Sprintf("Could not parse date: %s", dateStr)
+			return v, nil
+		}
+		parsed = parse.StartOf(parsed)
+		start = &parsed
+	}
+
+	taskIDs := v.getTargetTaskIDs()
+	if len(taskIDs) == 0 {
+		v.statusMsg = "No task selected"
+		return v, nil
+	}
+
+	if start == nil {
+		v.statusMsg = "Start date cleared"
+	} else if v.showDeferred {
+		v.statusMsg = fmt.Sprintf("Starts %s", formatDate(*start))
+	} else {
+		v.statusMsg = fmt.Sprintf("Hidden until %s (D shows deferred tasks)", formatDate(*start))
+	}
+	return v, func() tea.Msg {
+		db := v.db.Group("Defer tasks")
+		for _, id := range taskIDs {
+			if err := db.SetTaskStartDate(id, start); err != nil {
+				return taskUpdatedMsg{err: err}
+			}
+		}
+		return taskUpdatedMsg{}
+	}
+}
+
+// cmdSetEstimate sets or clears the time estimate of the selected/current tasks
+func (v ListView) cmdSetEstimate(args []string) (tea.Model, tea.Cmd) {
+	if len(args) == 0 {
+		v.statusMsg = "Usage: estimate <time> (e.g., estimate 45m, estimate 1h30m) | none"
+		return v, nil
+	}
+
+	var estimate *int
+	value := strings.Join(args, "")
+	if value != "none" && value != "clear" {
+		minutes, err := model.ParseEstimate(value)
+		if err != nil {
+			v.statusMsg = fmt.Sprintf("Estimate: %v", err)
+			return v, nil
+		}
+		estimate = &minutes
+	}
+
+	taskIDs := v.getTargetTaskIDs()
+	if len(taskIDs) == 0 {
+		v.statusMsg = "No task selected"
+		return v, nil
+	}
+
+	if estimate == nil {
+		v.statusMsg = "Estimate cleared"
+	} else {
+		v.statusMsg = fmt.Sprintf("Estimated at %s", model.FormatEstimate(*estimate))
+	}
+	return v, func() tea.Msg {
+		db := v.db.Group("Set estimate")
+		for _, id := range taskIDs {
+			if err := db.SetTaskEstimate(id, estimate); err != nil {
+				return taskUpdatedMsg{err: err}
+			}
+		}
+		return taskUpdatedMsg{}
+	}
+}
+
+// cmdSetReminders sets the reminder offsets of the selected/current tasks,
+// or puts them back on the default policy
+func (v ListView) cmdSetReminders(args []string) (tea.Model, tea.Cmd) {
+	if len(args) == 0 {
+		v.statusMsg = "Usage: remind <offsets> (e.g., remind 1d,1h, remind 30m 0) | none | default"
+		return v, nil
+	}
+
+	var reminders *string
+	value := strings.Join(args, " ")
+	if !strings.EqualFold(value, "default") {
+		offsets, err := model.ParseReminders(value)
+		if err != nil {
+			v.statusMsg = fmt.Sprintf("Remind: %v", err)
+			return v, nil
+		}
+		formatted := model.FormatReminders(offsets)
+		reminders = &formatted
+	}
+
+	taskIDs := v.getTargetTaskIDs()
+	if len(taskIDs) == 0 {
+		v.statusMsg = "No task selected"
+		return v, nil
+	}
+
+	switch {
+	case reminders == nil:
+		v.statusMsg = "Reminders follow the default"
+	case *reminders == "none":
+		v.statusMsg = "Reminders off"
+	default:
+		v.statusMsg = "Reminders: " + *reminders + " before due"
+	}
+	return v, func() tea.Msg {
+		db := v.db.Group("Set reminders")
+		for _, id := range taskIDs {
+			if err := db.SetTaskReminders(id, reminders); err != nil {
+				return taskUpdatedMsg{err: err}
+			}
+		}
+		return taskUpdatedMsg{}
+	}
+}
+
 // Helper command functions
 func (v ListView) setDueDate(taskIDs []string, dueDate time.Time) tea.Cmd {
 	return func() tea.Msg {
+		db := v.db.Group("Set due date")
 		for _, id := range taskIDs {
-			_, err := v.db.Exec(`UPDATE tasks SET due_date = ?, updated_at = ? WHERE id = ?`,
-				dueDate.Format(time.RFC3339), time.Now(), id)
-			if err != nil {
+			if err := db.SetTaskDueDate(id, &dueDate); err != nil {
 				return taskUpdatedMsg{err: err}
 			}
 		}
@@ -2188,8 +2927,9 @@ func (v ListView) setDueDate(taskIDs []string, dueDate time.Time) tea.Cmd {
 
 func (v ListView) setPriority(taskIDs []string, priority model.Priority) tea.Cmd {
 	return func() tea.Msg {
+		db := v.db.Group("Set priority")
 		for _, id := range taskIDs {
-			err := v.db.UpdateTaskPriority(id, priority)
+			err := db.UpdateTaskPriority(id, priority)
 			if err != nil {
 				return taskUpdatedMsg{err: err}
 			}
@@ -2200,16 +2940,18 @@ func (v ListView) setPriority(taskIDs []string, priority model.Priority) tea.Cmd
 
 func (v ListView) addTagToTasks(taskIDs []string, tagName string) tea.Cmd {
 	return func() tea.Msg {
-		now := time.Now()
-		tagID := strings.ToLower(tagName)
+		db := v.db.Group("Tag @" + tagName)
 
 		// Ensure tag exists
-		v.db.Exec(`INSERT OR IGNORE INTO tags (id, name, created_at) VALUES (?, ?, ?)`,
-			tagID, "@"+tagName, now)
+		tag, err := db.GetOrCreateTag(tagName, "")
+		if err != nil {
+			return taskUpdatedMsg{err: err}
+		}
 
 		for _, taskID := range taskIDs {
-			v.db.Exec(`INSERT OR IGNORE INTO task_tags (task_id, tag_id) VALUES (?, ?)`,
-				taskID, tagID)
+			if err := db.AddTagToTask(taskID, tag.ID); err != nil {
+				return taskUpdatedMsg{err: err}
+			}
 		}
 		return taskUpdatedMsg{}
 	}
@@ -2217,8 +2959,9 @@ func (v ListView) addTagToTasks(taskIDs []string, tagName string) tea.Cmd {
 
 func (v ListView) moveToProject(taskIDs []string, projectID string) tea.Cmd {
 	return func() tea.Msg {
+		db := v.db.Group("Move to project")
 		for _, id := range taskIDs {
-			err := v.db.UpdateTaskProject(id, projectID)
+			err := db.UpdateTaskProject(id, projectID)
 			if err != nil {
 				return taskUpdatedMsg{err: err}
 			}
@@ -2229,10 +2972,9 @@ func (v ListView) moveToProject(taskIDs []string, projectID string) tea.Cmd {
 
 func (v ListView) archiveTasks(taskIDs []string) tea.Cmd {
 	return func() tea.Msg {
-		now := time.Now()
+		db := v.db.Group("Archive tasks")
 		for _, id := range taskIDs {
-			_, err := v.db.Exec(`UPDATE tasks SET status = 'archived', updated_at = ? WHERE id = ?`, now, id)
-			if err != nil {
+			if err := db.SetTaskStatus(id, model.StatusArchived); err != nil {
 				return taskUpdatedMsg{err: err}
 			}
 		}
@@ -2240,72 +2982,6 @@ func (v ListView) archiveTasks(taskIDs []string) tea.Cmd {
 	}
 }
 
-// parseNaturalDate parses natural language dates
-func parseNaturalDate(s string) *time.Time {
-	now := time.Now()
-	today := time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 0, now.Location())
-
-	s = strings.ToLower(strings.TrimSpace(s))
-
-	switch s {
-	case "today":
-		return &today
-	case "tomorrow", "tom":
-		t := today.AddDate(0, 0, 1)
-		return &t
-	case "monday", "mon":
-		return nextWeekday(time.Monday)
-	case "tuesday", "tue":
-		return nextWeekday(time.Tuesday)
-	case "wednesday", "wed":
-		return nextWeekday(time.Wednesday)
-	case "thursday", "thu":
-		return nextWeekday(time.Thursday)
-	case "friday", "fri":
-		return nextWeekday(time.Friday)
-	case "saturday", "sat":
-		return nextWeekday(time.Saturday)
-	case "sunday", "sun":
-		return nextWeekday(time.Sunday)
-	case "next week", "nextweek":
-		t := today.AddDate(0, 0, 7)
-		return &t
-	}
-
-	// Try parsing as date
-	formats := []string{
-		"2006-01-02",
-		"01/02/2006",
-		"01-02-2006",
-		"Jan 2",
-		"Jan 2, 2006",
-	}
-
-	for _, format := range formats {
-		if t, err := time.Parse(format, s); err == nil {
-			if t.Year() == 0 {
-				t = time.Date(now.Year(), t.Month(), t.Day(), 23, 59, 59, 0, now.Location())
-			}
-			return &t
-		}
-	}
-
-	return nil
-}
-
-func nextWeekday(day time.Weekday) *time.Time {
-	now := time.Now()
-	today := time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 0, now.Location())
-
-	daysUntil := int(day - now.Weekday())
-	if daysUntil <= 0 {
-		daysUntil += 7
-	}
-
-	t := today.AddDate(0, 0, daysUntil)
-	return &t
-}
-
 // checkDeferredResort checks if cursor moved away from a task with deferred resort
 // Returns a loadTasks command if resort is needed, nil otherwise
 func (v *ListView) checkDeferredResort(oldCursor int) tea.Cmd {
@@ -2341,13 +3017,23 @@ func (v *ListView) updateLocalTaskPriority(taskID string, newPriority model.Prio
 	}
 }
 
+// findTask returns the listed task with the given ID, or nil
+func (v ListView) findTask(id string) *model.Task {
+	for i := range v.tasks {
+		if v.tasks[i].ID == id {
+			return &v.tasks[i]
+		}
+	}
+	return nil
+}
+
 // applyFilter filters tasks based on the current viewMode and searchFilter
 func (v *ListView) applyFilter() {
 	var filtered []model.Task
 	now := time.Now()
 	sevenDaysAgo := now.AddDate(0, 0, -7)
 
-	for _, task := range v.allTasks {
+	for _, task := range model.SortTasks(v.allTasks, v.sortOrder()) {
 		// Apply view mode filter
 		switch v.viewMode {
 		case ViewModeActive:
@@ -2365,6 +3051,10 @@ func (v *ListView) applyFilter() {
 		// ViewModeAll: show everything
 		}
 
+		if v.hidesDeferred() && !task.IsVisible() {
+			continue
+		}
+
 		// Apply project filter if set
 		if v.filterProjectID != "" {
 			if task.ProjectID == nil || *task.ProjectID != v.filterProjectID {
@@ -2387,6 +3077,11 @@ func (v *ListView) applyFilter() {
 			}
 		}
 
+		// Apply query filter if set
+		if v.filterQuery != nil && !v.matchesQuery(task) {
+			continue
+		}
+
 		filtered = append(filtered, task)
 	}
 
@@ -2401,6 +3096,12 @@ func (v *ListView) applyFilter() {
 	v.ensureCursorVisible()
 }
 
+// hidesDeferred reports whether tasks that haven't started yet are left out.
+// A query about start dates shows them regardless.
+func (v ListView) hidesDeferred() bool {
+	return !v.showDeferred && (v.filterQuery == nil || !v.filterQuery.Uses("start"))
+}
+
 // matchesFilter returns true if task matches the search filter
 func (v ListView) matchesFilter(task model.Task, filter string) bool {
 	// Match against title
@@ -2432,25 +3133,48 @@ func (v ListView) matchesFilter(task model.Task, filter string) bool {
 		return true
 	}
 
-	// Match against priority (support "!high" syntax)
-	priority := strings.ToLower(string(task.Priority))
-	if strings.Contains(priority, strings.TrimPrefix(filter, "!")) {
+	// Match against priority (support "!high" syntax)
+	priority := strings.ToLower(string(task.Priority))
+	if strings.Contains(priority, strings.TrimPrefix(filter, "!")) {
+		return true
+	}
+
+	// Check subtasks
+	for _, subtask := range task.Subtasks {
+		if v.matchesFilter(subtask, filter) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesQuery returns true if the query matched the task or one of its subtasks
+func (v ListView) matchesQuery(task model.Task) bool {
+	if v.queryMatches[task.ID] {
 		return true
 	}
-
-	// Check subtasks
 	for _, subtask := range task.Subtasks {
-		if v.matchesFilter(subtask, filter) {
+		if v.matchesQuery(subtask) {
 			return true
 		}
 	}
-
 	return false
 }
 
 // hasActiveFilters returns true if any filter is active
 func (v ListView) hasActiveFilters() bool {
-	return v.searchFilter != "" || v.filterProjectID != "" || len(v.filterTagIDs) > 0
+	return v.searchFilter != "" || v.filterProjectID != "" || len(v.filterTagIDs) > 0 || v.filterQuery != nil
+}
+
+// clearFilters drops every filter; callers re-apply or reload
+func (v *ListView) clearFilters() {
+	v.searchFilter = ""
+	v.filterProjectID = ""
+	v.filterTagIDs = nil
+	v.filterQuery = nil
+	v.filterListName = ""
+	v.queryMatches = nil
 }
 
 // formatActiveFilters returns a formatted string of all active filters
@@ -2488,6 +3212,13 @@ func (v ListView) formatActiveFilters() string {
 		parts = append(parts, fmt.Sprintf("Text: %s", v.searchFilter))
 	}
 
+	// Query filter
+	if v.filterListName != "" {
+		parts = append(parts, fmt.Sprintf("List: %s", v.filterListName))
+	} else if v.filterQuery != nil {
+		parts = append(parts, fmt.Sprintf("Query: %s", v.filterQuery))
+	}
+
 	return "Filters: " + strings.Join(parts, " | ")
 }
 
@@ -2513,21 +3244,6 @@ func (v ListView) handleDeleteConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "y", "Y":
 		v.mode = ListModeNormal
-		// Capture tasks for undo before deleting
-		for _, id := range v.deleteIDs {
-			for _, task := range v.tasks {
-				if task.ID == id {
-					taskCopy := task
-					v.pushUndo(UndoAction{
-						Type:        UndoActionDelete,
-						TaskID:      id,
-						Task:        &taskCopy,
-						Description: fmt.Sprintf("Delete \"%s\"", task.Title),
-					})
-					break
-				}
-			}
-		}
 		return v, v.deleteTasks(v.deleteIDs)
 	case "n", "N", "esc":
 		v.mode = ListModeNormal
@@ -2683,6 +3399,21 @@ func (v ListView) handleDependencySelector(msg tea.KeyMsg) (tea.Model, tea.Cmd)
 	return v, nil
 }
 
+// getFilteredSmartLists returns smart lists matching the current selector search
+func (v ListView) getFilteredSmartLists() []model.SmartList {
+	if v.selectorSearch == "" {
+		return v.smartLists
+	}
+	search := strings.ToLower(v.selectorSearch)
+	var filtered []model.SmartList
+	for _, l := range v.smartLists {
+		if strings.Contains(strings.ToLower(l.Name), search) {
+			filtered = append(filtered, l)
+		}
+	}
+	return filtered
+}
+
 // getFilteredProjects returns projects matching the current selector search
 func (v ListView) getFilteredProjects() []model.Project {
 	if v.selectorSearch == "" {
@@ -2698,63 +3429,70 @@ func (v ListView) getFilteredProjects() []model.Project {
 	return filtered
 }
 
-// handleProjectFilterSelector handles project filter selection with type-to-filter
+// handleProjectFilterSelector handles project filter selection with type-to-filter.
+// Smart lists follow the projects.
 func (v ListView) handleProjectFilterSelector(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	filtered := v.getFilteredProjects()
+	lists := v.getFilteredSmartLists()
 	// Include "All" option at index 0 (only when not searching)
 	hasAllOption := v.selectorSearch == ""
-	maxIndex := len(filtered)
+	count := len(filtered) + len(lists)
 	if hasAllOption {
-		maxIndex = len(filtered) // "All" is at 0, projects are 1..len
-	} else {
-		maxIndex = len(filtered) - 1 // No "All" option when filtering
-		if maxIndex < 0 {
-			maxIndex = 0
-		}
+		count++
 	}
 
 	switch msg.String() {
 	case "up", "k":
 		if v.selectorCursor > 0 {
 			v.selectorCursor--
-		} else {
-			if hasAllOption {
-				v.selectorCursor = len(filtered) // Wrap to bottom
-			} else if len(filtered) > 0 {
-				v.selectorCursor = len(filtered) - 1
-			}
+		} else if count > 0 {
+			v.selectorCursor = count - 1 // Wrap to bottom
 		}
 	case "down", "j":
-		limit := len(filtered)
-		if hasAllOption {
-			limit = len(filtered) // Can go from 0 to len(filtered)
-		} else {
-			limit = len(filtered) - 1
-		}
-		if v.selectorCursor < limit {
+		if v.selectorCursor < count-1 {
 			v.selectorCursor++
 		} else {
 			v.selectorCursor = 0 // Wrap to top
 		}
 	case "enter":
 		v.selectingProjectFilter = false
+		v.selectorSearch = ""
+		idx := v.selectorCursor
+		// Projects and smart lists replace each other; a :filter query stays
+		if v.filterListName != "" {
+			v.filterQuery = nil
+			v.filterListName = ""
+		}
 		if hasAllOption {
-			if v.selectorCursor == 0 {
+			if idx == 0 {
 				// "All" selected - clear project filter
 				v.filterProjectID = ""
 				v.statusMsg = "Showing all projects"
-			} else if v.selectorCursor <= len(filtered) {
-				project := filtered[v.selectorCursor-1]
-				v.filterProjectID = project.ID
-				v.statusMsg = fmt.Sprintf("Filtering by project: %s", project.Name)
+				v.applyFilter()
+				return v, nil
 			}
-		} else if len(filtered) > 0 && v.selectorCursor < len(filtered) {
-			project := filtered[v.selectorCursor]
+			idx--
+		}
+		if idx < len(filtered) {
+			project := filtered[idx]
 			v.filterProjectID = project.ID
 			v.statusMsg = fmt.Sprintf("Filtering by project: %s", project.Name)
+			v.applyFilter()
+			return v, nil
+		}
+		if idx -= len(filtered); idx < len(lists) {
+			list := lists[idx]
+			q, err := db.ParseQuery(list.Query)
+			if err != nil {
+				v.statusMsg = fmt.Sprintf("Smart list %s: %v", list.Name, err)
+				return v, nil
+			}
+			v.filterProjectID = ""
+			v.filterQuery = q
+			v.filterListName = list.Name
+			v.statusMsg = fmt.Sprintf("Smart list: %s", list.Name)
+			return v, v.loadTasks
 		}
-		v.selectorSearch = ""
-		v.applyFilter()
 	case "esc":
 		v.selectingProjectFilter = false
 		v.selectorSearch = ""
@@ -3044,16 +3782,11 @@ func (v ListView) handleParentSelector(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 // setTaskParent updates a task's parent in the database
 func (v ListView) setTaskParent(taskID, parentID string) tea.Cmd {
 	return func() tea.Msg {
-		var err error
-		if parentID == "" {
-			// Remove parent
-			_, err = v.db.Exec(`UPDATE tasks SET parent_id = NULL, updated_at = ? WHERE id = ?`,
-				time.Now(), taskID)
-		} else {
-			// Set parent
-			_, err = v.db.Exec(`UPDATE tasks SET parent_id = ?, updated_at = ? WHERE id = ?`,
-				parentID, time.Now(), taskID)
+		var parent *string
+		if parentID != "" {
+			parent = &parentID
 		}
+		err := v.db.SetTaskParent(taskID, parent)
 		// Return taskUpdatedMsg to trigger reload
 		return taskUpdatedMsg{err: err}
 	}
@@ -3064,182 +3797,27 @@ func (v ListView) unparentTask(taskID string) tea.Cmd {
 	return v.setTaskParent(taskID, "")
 }
 
-// pushUndo adds an action to the undo stack and clears the redo stack
-func (v *ListView) pushUndo(action UndoAction) {
-	v.undoStack = append(v.undoStack, action)
-	// Limit stack size to prevent memory issues
-	if len(v.undoStack) > 50 {
-		v.undoStack = v.undoStack[1:]
-	}
-	// Clear redo stack when new action is performed
-	v.redoStack = nil
-}
-
-// undo reverts the last action
-func (v ListView) undo() (tea.Model, tea.Cmd) {
-	if len(v.undoStack) == 0 {
-		v.statusMsg = "Nothing to undo"
-		return v, nil
-	}
-
-	// Pop from undo stack
-	action := v.undoStack[len(v.undoStack)-1]
-	v.undoStack = v.undoStack[:len(v.undoStack)-1]
-
-	// Push to redo stack
-	v.redoStack = append(v.redoStack, action)
-
-	// Execute the undo
-	return v.executeUndo(action)
-}
-
-// redo reapplies the last undone action
-func (v ListView) redo() (tea.Model, tea.Cmd) {
-	if len(v.redoStack) == 0 {
-		v.statusMsg = "Nothing to redo"
-		return v, nil
-	}
-
-	// Pop from redo stack
-	action := v.redoStack[len(v.redoStack)-1]
-	v.redoStack = v.redoStack[:len(v.redoStack)-1]
-
-	// Push back to undo stack
-	v.undoStack = append(v.undoStack, action)
-
-	// Execute the redo
-	return v.executeRedo(action)
-}
-
-// executeUndo performs the undo for a given action
-func (v ListView) executeUndo(action UndoAction) (tea.Model, tea.Cmd) {
-	switch action.Type {
-	case UndoActionCreate:
-		// Undo create = delete the task
-		v.statusMsg = fmt.Sprintf("Undo: removed \"%s\"", action.Task.Title)
-		return v, v.deleteTaskByID(action.TaskID)
-
-	case UndoActionDelete:
-		// Undo delete = recreate the task
-		v.statusMsg = fmt.Sprintf("Undo: restored \"%s\"", action.Task.Title)
-		return v, v.restoreTask(action.Task)
-
-	case UndoActionUpdate:
-		// Undo update = restore old values
-		v.statusMsg = fmt.Sprintf("Undo: reverted \"%s\"", action.OldTask.Title)
-		return v, v.restoreTaskState(action.OldTask)
-
-	case UndoActionToggleStatus:
-		// Undo status toggle = restore old status
-		v.statusMsg = fmt.Sprintf("Undo: status reverted for \"%s\"", action.OldTask.Title)
-		return v, v.restoreTaskState(action.OldTask)
-
-	case UndoActionSetParent:
-		// Undo parent change = restore old parent
-		var oldParentID string
-		if action.OldTask != nil && action.OldTask.ParentID != nil {
-			oldParentID = *action.OldTask.ParentID
-		}
-		v.statusMsg = "Undo: parent reverted"
-		return v, v.setTaskParent(action.TaskID, oldParentID)
-	}
-
-	return v, nil
-}
-
-// executeRedo reapplies the action
-func (v ListView) executeRedo(action UndoAction) (tea.Model, tea.Cmd) {
-	switch action.Type {
-	case UndoActionCreate:
-		// Redo create = recreate the task
-		v.statusMsg = fmt.Sprintf("Redo: restored \"%s\"", action.Task.Title)
-		return v, v.restoreTask(action.Task)
-
-	case UndoActionDelete:
-		// Redo delete = delete again
-		v.statusMsg = fmt.Sprintf("Redo: removed \"%s\"", action.Task.Title)
-		return v, v.deleteTaskByID(action.TaskID)
-
-	case UndoActionUpdate:
-		// Redo update = apply new values
-		v.statusMsg = fmt.Sprintf("Redo: updated \"%s\"", action.NewTask.Title)
-		return v, v.restoreTaskState(action.NewTask)
-
-	case UndoActionToggleStatus:
-		// Redo status toggle = apply new status
-		v.statusMsg = fmt.Sprintf("Redo: status updated for \"%s\"", action.NewTask.Title)
-		return v, v.restoreTaskState(action.NewTask)
-
-	case UndoActionSetParent:
-		// Redo parent change = apply new parent
-		var newParentID string
-		if action.NewTask != nil && action.NewTask.ParentID != nil {
-			newParentID = *action.NewTask.ParentID
-		}
-		v.statusMsg = "Redo: parent updated"
-		return v, v.setTaskParent(action.TaskID, newParentID)
-	}
-
-	return v, nil
-}
-
-// deleteTaskByID deletes a task by ID (for undo of create)
-func (v ListView) deleteTaskByID(taskID string) tea.Cmd {
-	return func() tea.Msg {
-		_, err := v.db.Exec(`DELETE FROM tasks WHERE id = ?`, taskID)
-		return taskDeletedMsg{ids: []string{taskID}, err: err}
+// View renders the list view
+func (v ListView) View() string {
+	paneWidth := v.detailWidth()
+	if paneWidth == 0 {
+		return v.viewList()
 	}
-}
-
-// restoreTask recreates a deleted task
-func (v ListView) restoreTask(task *model.Task) tea.Cmd {
-	return func() tea.Msg {
-		var dueDate, completedAt interface{}
-		if task.DueDate != nil {
-			dueDate = task.DueDate.Format(time.RFC3339)
-		}
-		if task.CompletedAt != nil {
-			completedAt = task.CompletedAt.Format(time.RFC3339)
-		}
-
-		_, err := v.db.Exec(`
-			INSERT INTO tasks (id, title, description, status, priority, project_id, parent_id, due_date, completed_at, position, created_at, updated_at)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		`, task.ID, task.Title, task.Description, task.Status, task.Priority,
-			task.ProjectID, task.ParentID, dueDate, completedAt, task.Position,
-			task.CreatedAt, time.Now())
-
-		return taskUpdatedMsg{err: err}
+	pane := v.renderDetails(paneWidth)
+	if paneWidth == v.width {
+		return pane
 	}
-}
 
-// restoreTaskState updates a task to match the given state
-func (v ListView) restoreTaskState(task *model.Task) tea.Cmd {
-	return func() tea.Msg {
-		var dueDate, completedAt interface{}
-		if task.DueDate != nil {
-			dueDate = task.DueDate.Format(time.RFC3339)
-		}
-		if task.CompletedAt != nil {
-			completedAt = task.CompletedAt.Format(time.RFC3339)
-		}
-
-		_, err := v.db.Exec(`
-			UPDATE tasks SET
-				title = ?, description = ?, status = ?, priority = ?,
-				project_id = ?, parent_id = ?, due_date = ?, completed_at = ?,
-				updated_at = ?
-			WHERE id = ?
-		`, task.Title, task.Description, task.Status, task.Priority,
-			task.ProjectID, task.ParentID, dueDate, completedAt,
-			time.Now(), task.ID)
-
-		return taskUpdatedMsg{err: err}
-	}
+	// The list keeps what's left, with long lines cut off
+	list := v
+	list.width = v.width - paneWidth - 1
+	body := lipgloss.NewStyle().MaxWidth(list.width).Render(list.viewList())
+	body = lipgloss.NewStyle().Width(list.width).Render(body)
+	return lipgloss.JoinHorizontal(lipgloss.Top, body, " ", pane)
 }
 
-// View renders the list view
-func (v ListView) View() string {
+// viewList renders the task list with its inputs and selectors
+func (v ListView) viewList() string {
 	debugf("ListView.View() called, len(v.tasks)=%d", len(v.tasks))
 	styles := theme.Current.Styles
 	t := theme.Current.Theme
@@ -3247,10 +3825,26 @@ func (v ListView) View() string {
 	var b strings.Builder
 
 	// Input field (if in add/edit/addsubtask mode)
-	if v.mode == ListModeAdd || v.mode == ListModeAddSubtask || v.mode == ListModeEdit {
+	if v.mode == ListModeAdd || v.mode == ListModeAddSubtask || v.mode == ListModeEdit || v.mode == ListModeRecurrence || v.mode == ListModeComment {
+		if v.mode == ListModeRecurrence {
+			b.WriteString(lipgloss.NewStyle().Foreground(t.Subtle).Render("Repeat (empty to clear):"))
+			b.WriteString("\n")
+		}
+		if v.mode == ListModeComment {
+			title := "task"
+			if task := v.findTask(v.editingID); task != nil {
+				title = task.Title
+			}
+			b.WriteString(lipgloss.NewStyle().Foreground(t.Subtle).Render("Comment on " + title + ":"))
+			b.WriteString("\n")
+		}
 		inputStyle := styles.InputFocused
 		b.WriteString(inputStyle.Render(v.input.View()))
-		b.WriteString("\n\n")
+		b.WriteString("\n")
+		if v.mode != ListModeRecurrence && v.mode != ListModeComment {
+			b.WriteString(v.renderQuickAddPreview(v.input.Value()))
+		}
+		b.WriteString("\n")
 	}
 
 	// Search bar
@@ -3281,6 +3875,10 @@ func (v ListView) View() string {
 		b.WriteString(cmdStyle.Render(":"))
 		b.WriteString(v.input.View())
 		b.WriteString("\n")
+		if preview := v.renderDatePreview(v.input.Value()); preview != "" {
+			b.WriteString(preview)
+			b.WriteString("\n")
+		}
 
 		// Render command suggestions
 		if len(v.cmdSuggestions) > 0 {
@@ -3460,6 +4058,99 @@ func (v ListView) View() string {
 	return b.String()
 }
 
+// renderDetails renders the detail pane: the task under the cursor with
+// its description rendered from Markdown, its comments and activity, or
+// the description editor
+func (v ListView) renderDetails(width int) string {
+	t := theme.Current.Theme
+	height := v.detailHeight()
+	inner := width - 4 // Border and padding
+
+	paneStyle := lipgloss.NewStyle().
+		BorderStyle(lipgloss.RoundedBorder()).
+		BorderForeground(t.Border).
+		Padding(0, 1).
+		Width(width - 2).
+		Height(height - 2)
+	subtle := lipgloss.NewStyle().Foreground(t.Subtle).Italic(true)
+
+	var task *model.Task
+	if v.mode == ListModeNotes {
+		task = v.findTask(v.editingID)
+		paneStyle = paneStyle.BorderForeground(t.Primary)
+	} else if len(v.tasks) > 0 {
+		task = &v.tasks[v.cursor]
+	}
+	if task == nil {
+		return paneStyle.Render(subtle.Render("No task selected"))
+	}
+
+	sections := []string{v.renderDetailHeader(*task, inner), ""}
+	switch {
+	case v.mode == ListModeNotes:
+		sections = append(sections, v.notes.View())
+	case task.Description != "":
+		sections = append(sections, renderMarkdown(task.Description, inner))
+	default:
+		sections = append(sections, subtle.Render("No notes. n to write some, e to edit the task in $EDITOR."))
+	}
+
+	// Comments and activity go below the notes, given at least half the pane
+	avail := height - 2
+	lines := strings.Split(strings.Join(sections, "\n"), "\n")
+	var history []string
+	if v.mode != ListModeNotes && v.history.taskID == task.ID {
+		room := max(avail-len(lines)-1, avail/2)
+		activityNeeds := 2 + max(len(v.history.activity), 1) // Blank line, header and entries
+		comments := renderComments(v.history.comments, inner, max(room-1-activityNeeds, room/2))
+		history = append([]string{""}, strings.Split(comments, "\n")...)
+		if left := room - len(history) - 1; left >= 2 {
+			history = append(history, "")
+			history = append(history, strings.Split(renderActivity(v.history.activity, inner, left), "\n")...)
+		}
+	}
+
+	// Long notes are cut off to make room
+	if len(lines)+len(history) > avail {
+		keep := max(avail-len(history)-1, 0)
+		lines = append(lines[:min(keep, len(lines))], subtle.Render("… e to read it all in $EDITOR"))
+	}
+	lines = append(lines, history...)
+	if len(lines) > avail {
+		lines = lines[:avail]
+	}
+	return paneStyle.Render(strings.Join(lines, "\n"))
+}
+
+// renderDetailHeader renders a task's title and fields for the detail pane
+func (v ListView) renderDetailHeader(task model.Task, width int) string {
+	t := theme.Current.Theme
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(t.Primary).Width(width)
+	fieldStyle := lipgloss.NewStyle().Foreground(t.Subtle)
+
+	fields := []string{strings.ReplaceAll(string(task.Status), "_", " "), string(task.Priority)}
+	if task.Project != nil && !task.Project.IsInbox() {
+		fields = append(fields, task.Project.Name)
+	}
+	for _, tag := range task.Tags {
+		fields = append(fields, tag.DisplayName())
+	}
+	if task.DueDate != nil {
+		fields = append(fields, "due "+formatDate(*task.DueDate))
+	}
+	if !task.IsVisible() {
+		fields = append(fields, "starts "+formatDate(*task.StartDate))
+	}
+	if task.TimeEstimate != nil {
+		fields = append(fields, "~"+model.FormatEstimate(*task.TimeEstimate))
+	}
+	if rule := task.RecurrenceRule(); rule != nil {
+		fields = append(fields, "↻ "+rule.String())
+	}
+
+	return titleStyle.Render(task.Title) + "\n" + fieldStyle.Width(width).Render(strings.Join(fields, " · "))
+}
+
 // renderProjectSelector renders the project selection popup
 func (v ListView) renderProjectSelector() string {
 	t := theme.Current.Theme
@@ -3643,7 +4334,7 @@ func (v ListView) renderProjectFilterSelector() string {
 			allStyle = allStyle.Bold(true)
 		}
 		checkMark := " "
-		if v.filterProjectID == "" {
+		if v.filterProjectID == "" && v.filterListName == "" {
 			checkMark = "●"
 		}
 		b.WriteString(fmt.Sprintf("%s%s %s\n", cursor, checkMark, allStyle.Render("All Projects")))
@@ -3681,8 +4372,39 @@ func (v ListView) renderProjectFilterSelector() string {
 		b.WriteString("\n")
 	}
 
+	// Smart lists follow the projects
+	lists := v.getFilteredSmartLists()
+	for i, list := range lists {
+		cursorIdx := len(filtered) + i
+		if hasAllOption {
+			cursorIdx++
+		}
+
+		cursor := "  "
+		if cursorIdx == v.selectorCursor {
+			cursor = "> "
+		}
+
+		checkMark := " "
+		if v.filterListName != "" && strings.EqualFold(v.filterListName, list.Name) {
+			checkMark = "●"
+		}
+
+		listStyle := lipgloss.NewStyle().Foreground(t.Info)
+		if cursorIdx == v.selectorCursor {
+			listStyle = listStyle.Bold(true)
+		}
+
+		b.WriteString(cursor)
+		b.WriteString(checkMark)
+		b.WriteString(" ")
+		b.WriteString(listStyle.Render("★ " + list.Name))
+		b.WriteString(lipgloss.NewStyle().Foreground(t.Subtle).Render("  " + list.Query))
+		b.WriteString("\n")
+	}
+
 	// Show "no matches" if filtered is empty while searching
-	if v.selectorSearch != "" && len(filtered) == 0 {
+	if v.selectorSearch != "" && len(filtered) == 0 && len(lists) == 0 {
 		noMatchStyle := lipgloss.NewStyle().Foreground(t.Subtle).Italic(true)
 		b.WriteString(noMatchStyle.Render("  No matching projects"))
 		b.WriteString("\n")
@@ -3986,6 +4708,19 @@ func (v ListView) renderTask(task model.Task, isCursor, isSelected bool) string
 	if dueStr != "" {
 		metadata = append(metadata, dueStr)
 	}
+	if !task.IsVisible() {
+		startStyle := lipgloss.NewStyle().Foreground(t.Subtle).Italic(true)
+		metadata = append(metadata, startStyle.Render("starts "+formatDate(*task.StartDate)))
+	}
+	if task.TimeEstimate != nil {
+		metadata = append(metadata, lipgloss.NewStyle().Foreground(t.Subtle).Render("~"+model.FormatEstimate(*task.TimeEstimate)))
+	}
+	if task.IsRecurring() {
+		metadata = append(metadata, lipgloss.NewStyle().Foreground(t.Subtle).Render("↻"))
+	}
+	if task.Description != "" {
+		metadata = append(metadata, lipgloss.NewStyle().Foreground(t.Subtle).Render("≡"))
+	}
 	if v.blocked[task.ID] {
 		blockedStyle := lipgloss.NewStyle().Foreground(t.Warning).Bold(true)
 		metadata = append(metadata, blockedStyle.Render("⊘ BLOCKED"))
@@ -4090,11 +4825,13 @@ func wrapText(text string, maxWidth int) string {
 // Database commands
 
 type tasksLoadedMsg struct {
-	tasks    []model.Task
-	projects []model.Project
-	tags     []model.Tag
-	blocked  map[string]bool
-	err      error
+	tasks        []model.Task
+	projects     []model.Project
+	tags         []model.Tag
+	smartLists   []model.SmartList
+	queryMatches map[string]bool
+	blocked      map[string]bool
+	err          error
 }
 
 type taskCreatedMsg struct {
@@ -4123,6 +4860,12 @@ type errorMsg struct {
 	err error
 }
 
+// settingSavedMsg reports the result of :set
+type settingSavedMsg struct {
+	key string
+	err error
+}
+
 func (v ListView) loadTasks() tea.Msg {
 	debugf("=== loadTasks() START ===")
 	debugf("loadTasks() called, db=%v", v.db != nil)
@@ -4146,6 +4889,20 @@ func (v ListView) loadTasks() tea.Msg {
 	}
 	debugf("Loaded %d tags", len(tags))
 
+	smartLists, err := v.db.GetSmartLists()
+	if err != nil {
+		return tasksLoadedMsg{err: err}
+	}
+
+	// Relative dates in the query move with the clock, so match on every load
+	var queryMatches map[string]bool
+	if v.filterQuery != nil {
+		queryMatches, err = v.db.MatchingTaskIDs(v.filterQuery)
+		if err != nil {
+			return tasksLoadedMsg{err: err}
+		}
+	}
+
 	// Build project lookup
 	projectMap := make(map[string]model.Project)
 	for _, p := range projects {
@@ -4155,7 +4912,7 @@ func (v ListView) loadTasks() tea.Msg {
 	rows, err := v.db.Query(`
 		SELECT id, title, description, status, priority, urgency, importance,
 		       project_id, parent_id, due_date, start_date, completed_at,
-		       time_estimate, recurrence, position, gcal_event_id,
+		       time_estimate, recurrence, reminders, position, gcal_event_id,
 		       created_at, updated_at
 		FROM tasks
 		WHERE status != 'archived' AND parent_id IS NULL
@@ -4183,7 +4940,7 @@ func (v ListView) loadTasks() tea.Msg {
 	for rows.Next() {
 		debugf("Processing row...")
 		var t model.Task
-		var description, projectID, parentID, dueDate, startDate, completedAt, recurrence, gcalID *string
+		var description, projectID, parentID, dueDate, startDate, completedAt, recurrence, reminders, gcalID *string
 		var timeEstimate, position *int
 		var urgency, importance int
 
@@ -4191,7 +4948,7 @@ func (v ListView) loadTasks() tea.Msg {
 			&t.ID, &t.Title, &description, &t.Status, &t.Priority,
 			&urgency, &importance, &projectID, &parentID,
 			&dueDate, &startDate, &completedAt, &timeEstimate,
-			&recurrence, &position, &gcalID, &t.CreatedAt, &t.UpdatedAt,
+			&recurrence, &reminders, &position, &gcalID, &t.CreatedAt, &t.UpdatedAt,
 		)
 		if err != nil {
 			return tasksLoadedMsg{err: err}
@@ -4206,26 +4963,29 @@ func (v ListView) loadTasks() tea.Msg {
 		t.ParentID = parentID
 		t.TimeEstimate = timeEstimate
 		t.Recurrence = recurrence
+		t.Reminders = reminders
 		t.GCalEventID = gcalID
 		if position != nil {
 			t.Position = *position
 		}
 
 		if dueDate != nil {
-			if parsed, err := time.Parse(time.RFC3339, *dueDate); err == nil {
+			if parsed, ok := db.ParseTimestamp(*dueDate); ok {
 				t.DueDate = &parsed
 			}
 		}
 		if startDate != nil {
-			if parsed, err := time.Parse(time.RFC3339, *startDate); err == nil {
+			if parsed, ok := db.ParseTimestamp(*startDate); ok {
 				t.StartDate = &parsed
 			}
 		}
 		if completedAt != nil {
-			if parsed, err := time.Parse(time.RFC3339, *completedAt); err == nil {
+			if parsed, ok := db.ParseTimestamp(*completedAt); ok {
 				t.CompletedAt = &parsed
 			}
 		}
+		t.CreatedAt = t.CreatedAt.Local()
+		t.UpdatedAt = t.UpdatedAt.Local()
 
 		// Enrich with project (from in-memory map, no DB call)
 		if t.ProjectID != nil {
@@ -4263,103 +5023,117 @@ func (v ListView) loadTasks() tea.Msg {
 	}
 
 	debugf("loadTasks returning %d tasks, %d projects, %d tags", len(tasks), len(projects), len(tags))
-	msg := tasksLoadedMsg{tasks: tasks, projects: projects, tags: tags, blocked: blockedMap}
+	msg := tasksLoadedMsg{
+		tasks: tasks, projects: projects, tags: tags, smartLists: smartLists,
+		queryMatches: queryMatches, blocked: blockedMap,
+	}
 	debugf("Created tasksLoadedMsg, returning it now")
 	return msg
 }
 
-func (v ListView) createTask(title string) tea.Cmd {
+func (v ListView) createTask(text string) tea.Cmd {
 	// Use filtered project and tags if active
 	projectID := v.filterProjectID
 	tagIDs := make([]string, len(v.filterTagIDs))
 	copy(tagIDs, v.filterTagIDs)
+	parsed := parse.QuickAdd(text, time.Now())
 
 	return func() tea.Msg {
-		id := uuid.New().String()
-		now := time.Now()
-
-		var err error
+		var base model.Task
 		if projectID != "" {
-			_, err = v.db.Exec(`
-				INSERT INTO tasks (id, title, status, priority, project_id, created_at, updated_at)
-				VALUES (?, ?, 'pending', 'medium', ?, ?, ?)
-			`, id, title, projectID, now, now)
-		} else {
-			_, err = v.db.Exec(`
-				INSERT INTO tasks (id, title, status, priority, created_at, updated_at)
-				VALUES (?, ?, 'pending', 'medium', ?, ?)
-			`, id, title, now, now)
+			base.ProjectID = &projectID
 		}
 
+		// Add filtered tags to the new task
+		task, err := v.db.Group("Add task").AddQuickTask(parsed, base, tagIDs)
 		if err != nil {
 			return taskCreatedMsg{err: err}
 		}
+		return taskCreatedMsg{task: *task}
+	}
+}
 
-		// Add filtered tags to the new task
-		for _, tagID := range tagIDs {
-			v.db.Exec(`INSERT OR IGNORE INTO task_tags (task_id, tag_id) VALUES (?, ?)`, id, tagID)
+func (v ListView) createSubtask(text, parentID string) tea.Cmd {
+	parsed := parse.QuickAdd(text, time.Now())
+	return func() tea.Msg {
+		// Subtasks stay in their parent's project unless the line names one
+		var base model.Task
+		base.ParentID = &parentID
+		if parent, err := v.db.GetTask(parentID); err == nil && parent != nil {
+			base.ProjectID = parent.ProjectID
 		}
 
-		var projPtr *string
-		if projectID != "" {
-			projPtr = &projectID
+		task, err := v.db.Group("Add subtask").AddQuickTask(parsed, base, nil)
+		if err != nil {
+			return taskCreatedMsg{err: err}
 		}
-
-		return taskCreatedMsg{task: model.Task{
-			ID:        id,
-			Title:     title,
-			Status:    model.StatusPending,
-			Priority:  model.PriorityMedium,
-			ProjectID: projPtr,
-			CreatedAt: now,
-			UpdatedAt: now,
-		}}
+		return taskCreatedMsg{task: *task}
 	}
 }
 
-func (v ListView) createSubtask(title, parentID string) tea.Cmd {
+func (v ListView) updateTaskTitle(id, text string, oldEstimate *int) tea.Cmd {
+	parsed := parse.QuickAdd(text, time.Now())
 	return func() tea.Msg {
-		id := uuid.New().String()
-		now := time.Now()
-
-		// Get parent's project_id
-		var projectID *string
-		v.db.QueryRow("SELECT project_id FROM tasks WHERE id = ?", parentID).Scan(&projectID)
+		db := v.db.Group("Edit task")
+		if err := db.EditQuickTask(id, parsed); err != nil {
+			return taskUpdatedMsg{err: err}
+		}
+		// The estimate is part of the edit text, so taking it out clears it
+		if parsed.Estimate == nil && oldEstimate != nil {
+			if err := db.SetTaskEstimate(id, nil); err != nil {
+				return taskUpdatedMsg{err: err}
+			}
+		}
 
-		_, err := v.db.Exec(`
-			INSERT INTO tasks (id, title, status, priority, project_id, parent_id, created_at, updated_at)
-			VALUES (?, ?, 'pending', 'medium', ?, ?, ?, ?)
-		`, id, title, projectID, parentID, now, now)
+		return taskUpdatedMsg{task: model.Task{ID: id, Title: parsed.Title}}
+	}
+}
 
-		if err != nil {
-			return taskCreatedMsg{err: err}
-		}
+// renderQuickAddPreview shows what a quick-add line will set besides the
+// title, so a date that reads differently than meant is caught before enter
+func (v ListView) renderQuickAddPreview(text string) string {
+	parsed := parse.QuickAdd(text, time.Now())
+	if !parsed.HasFields() {
+		return ""
+	}
+	t := theme.Current.Theme
+	return lipgloss.NewStyle().Foreground(t.Subtle).Render("  → " + parsed.Summary())
+}
 
-		return taskCreatedMsg{task: model.Task{
-			ID:        id,
-			Title:     title,
-			Status:    model.StatusPending,
-			Priority:  model.PriorityMedium,
-			ParentID:  &parentID,
-			ProjectID: projectID,
-			CreatedAt: now,
-			UpdatedAt: now,
-		}}
+// renderDatePreview shows the date a :due or :defer command will set
+func (v ListView) renderDatePreview(command string) string {
+	name, arg, _ := strings.Cut(strings.TrimSpace(command), " ")
+	label := "due "
+	switch name {
+	case "due", "d":
+	case "defer", "snooze":
+		label = "starts "
+	default:
+		return ""
 	}
+	date, ok := parse.Date(arg, time.Now())
+	if !ok {
+		return ""
+	}
+	if label == "starts " {
+		date = parse.StartOf(date)
+	}
+	t := theme.Current.Theme
+	return lipgloss.NewStyle().Foreground(t.Subtle).Render("  → " + label + parse.Describe(date))
 }
 
-func (v ListView) updateTaskTitle(id, title string) tea.Cmd {
+// setRecurrence sets or clears a task's recurrence rule
+func (v ListView) setDescription(id, description string) tea.Cmd {
 	return func() tea.Msg {
-		now := time.Now()
-		_, err := v.db.Exec(`
-			UPDATE tasks SET title = ?, updated_at = ? WHERE id = ?
-		`, title, now, id)
-
-		if err != nil {
-			return taskUpdatedMsg{err: err}
-		}
+		err := v.db.UpdateTaskDescription(id, description)
+		return taskUpdatedMsg{err: err}
+	}
+}
 
-		return taskUpdatedMsg{task: model.Task{ID: id, Title: title}}
+func (v ListView) setRecurrence(id string, rule *model.Recurrence) tea.Cmd {
+	return func() tea.Msg {
+		err := v.db.SetTaskRecurrence(id, rule)
+		return taskUpdatedMsg{err: err}
 	}
 }
 
@@ -4378,25 +5152,11 @@ func (v ListView) toggleSelected() tea.Cmd {
 			return nil
 		}
 
-		now := time.Now()
+		db := v.db.Group("Toggle done")
 		for _, id := range ids {
-			// Find current status
-			var status string
-			v.db.QueryRow("SELECT status FROM tasks WHERE id = ?", id).Scan(&status)
-
-			var newStatus string
-			var completedAt interface{}
-			if status == string(model.StatusDone) {
-				newStatus = string(model.StatusPending)
-				completedAt = nil
-			} else {
-				newStatus = string(model.StatusDone)
-				completedAt = now
+			if err := db.ToggleTaskStatus(id); err != nil {
+				return taskUpdatedMsg{err: err}
 			}
-
-			v.db.Exec(`
-				UPDATE tasks SET status = ?, completed_at = ?, updated_at = ? WHERE id = ?
-			`, newStatus, completedAt, now, id)
 		}
 
 		return taskUpdatedMsg{}
@@ -4405,9 +5165,9 @@ func (v ListView) toggleSelected() tea.Cmd {
 
 func (v ListView) deleteTasks(ids []string) tea.Cmd {
 	return func() tea.Msg {
+		db := v.db.Group("Delete tasks")
 		for _, id := range ids {
-			_, err := v.db.Exec("DELETE FROM tasks WHERE id = ?", id)
-			if err != nil {
+			if err := db.DeleteTask(id); err != nil {
 				return taskDeletedMsg{err: err}
 			}
 		}
@@ -4437,12 +5197,7 @@ func (v ListView) cyclePriority() tea.Cmd {
 			newPriority = model.PriorityMedium
 		}
 
-		now := time.Now()
-		_, err := v.db.Exec(`
-			UPDATE tasks SET priority = ?, updated_at = ? WHERE id = ?
-		`, newPriority, now, task.ID)
-
-		if err != nil {
+		if err := v.db.UpdateTaskPriority(task.ID, newPriority); err != nil {
 			return priorityChangedLocalMsg{taskID: task.ID, err: err}
 		}
 
@@ -4532,6 +5287,9 @@ func (v *ListView) flattenTasks(tasks []model.Task) []model.Task {
 
 func (v *ListView) flattenTasksRecursive(tasks []model.Task, depth int, result *[]model.Task) {
 	for _, task := range tasks {
+		if depth > 0 && v.hidesDeferred() && !task.IsVisible() {
+			continue
+		}
 		v.taskDepth[task.ID] = depth
 		*result = append(*result, task)
 		// If this task is expanded, add its subtasks recursively
@@ -4572,36 +5330,31 @@ func (v *ListView) expandAllRecursive(tasks []model.Task) int {
 	return count
 }
 
+// formatDate shows a date relative to today, with its time when it has one
 func formatDate(t time.Time) string {
 	now := time.Now()
-	diff := t.Sub(now)
-
-	if t.Year() == now.Year() && t.YearDay() == now.YearDay() {
-		return "today"
-	}
-
-	tomorrow := now.AddDate(0, 0, 1)
-	if t.Year() == tomorrow.Year() && t.YearDay() == tomorrow.YearDay() {
-		return "tomorrow"
-	}
-
-	if diff < 0 {
-		days := int(-diff.Hours() / 24)
-		if days == 1 {
-			return "1 day ago"
-		}
-		return fmt.Sprintf("%d days ago", days)
-	}
-
-	if diff.Hours() < 24*7 {
-		return t.Format("Mon")
-	}
-
-	if t.Year() == now.Year() {
-		return t.Format("Jan 2")
-	}
-
-	return t.Format("Jan 2, 2006")
+	days := model.DaysBetween(now, t)
+
+	clock := ""
+	if model.HasClock(t) {
+		clock = t.Format(" 15:04")
+	}
+
+	switch {
+	case days == 0:
+		return "today" + clock
+	case days == 1:
+		return "tomorrow" + clock
+	case days == -1:
+		return "1 day ago"
+	case days < 0:
+		return fmt.Sprintf("%d days ago", -days)
+	case days < 7:
+		return t.Format("Mon") + clock
+	case t.Year() == now.Year():
+		return t.Format("Jan 2") + clock
+	}
+	return t.Format("Jan 2, 2006") + clock
 }
 
 func max(a, b int) int {
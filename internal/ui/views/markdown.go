@@ -0,0 +1,192 @@
+package views
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/dori/klonch/internal/ui/theme"
+)
+
+// Markdown in task descriptions is rendered for the terminal rather than
+// shown raw. Line breaks are kept as written, as in issue trackers, and the
+// usual blocks are recognised: headings, lists and checkboxes, quotes,
+// fenced code and rules, with bold, italic, code and links inside them.
+
+var (
+	mdHeading  = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	mdRule     = regexp.MustCompile(`^(\*\s*){3,}$|^(-\s*){3,}$|^(_\s*){3,}$`)
+	mdCheckbox = regexp.MustCompile(`^[-*+]\s+\[([ xX])\]\s+(.*)$`)
+	mdBullet   = regexp.MustCompile(`^[-*+]\s+(.*)$`)
+	mdNumbered = regexp.MustCompile(`^(\d{1,9}[.)])\s+(.*)$`)
+)
+
+// renderMarkdown renders Markdown text wrapped to width
+func renderMarkdown(text string, width int) string {
+	t := theme.Current.Theme
+	width = max(width, 10)
+	base := lipgloss.NewStyle().Foreground(t.Foreground)
+	code := lipgloss.NewStyle().Foreground(t.Secondary)
+	subtle := lipgloss.NewStyle().Foreground(t.Subtle)
+
+	var out []string
+	inFence := false
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line = strings.ReplaceAll(line, "\t", "    ")
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			out = append(out, code.Width(width).Render("  "+line))
+			continue
+		}
+		if trimmed == "" {
+			out = append(out, "")
+			continue
+		}
+
+		// Nested lists are indented by two spaces a level
+		indent := min((len(line)-len(strings.TrimLeft(line, " ")))/2*2, width/2)
+
+		switch {
+		case mdRule.MatchString(trimmed):
+			out = append(out, subtle.Render(strings.Repeat("─", width)))
+
+		case mdHeading.MatchString(trimmed):
+			m := mdHeading.FindStringSubmatch(trimmed)
+			style := base.Bold(true)
+			if len(m[1]) <= 2 {
+				style = style.Foreground(t.Primary)
+			}
+			out = append(out, wrapMarkdown(renderInline(m[2], style), width, "", ""))
+
+		case strings.HasPrefix(trimmed, ">"):
+			quote := strings.TrimSpace(strings.TrimLeft(trimmed, ">"))
+			bar := subtle.Render("│ ")
+			out = append(out, wrapMarkdown(renderInline(quote, base.Italic(true)), width, bar, bar))
+
+		case mdCheckbox.MatchString(trimmed):
+			m := mdCheckbox.FindStringSubmatch(trimmed)
+			box, style := lipgloss.NewStyle().Foreground(t.Subtle).Render("☐ "), base
+			if m[1] != " " {
+				box = lipgloss.NewStyle().Foreground(t.Success).Render("☑ ")
+				style = subtle.Strikethrough(true)
+			}
+			pad := strings.Repeat(" ", indent)
+			out = append(out, wrapMarkdown(renderInline(m[2], style), width, pad+box, pad+"  "))
+
+		case mdBullet.MatchString(trimmed):
+			m := mdBullet.FindStringSubmatch(trimmed)
+			pad := strings.Repeat(" ", indent)
+			bullet := subtle.Render("• ")
+			out = append(out, wrapMarkdown(renderInline(m[1], base), width, pad+bullet, pad+"  "))
+
+		case mdNumbered.MatchString(trimmed):
+			m := mdNumbered.FindStringSubmatch(trimmed)
+			pad := strings.Repeat(" ", indent)
+			number := subtle.Render(m[1] + " ")
+			hang := strings.Repeat(" ", len(m[1])+1)
+			out = append(out, wrapMarkdown(renderInline(m[2], base), width, pad+number, pad+hang))
+
+		default:
+			out = append(out, wrapMarkdown(renderInline(trimmed, base), width, "", ""))
+		}
+	}
+
+	// Runs of blank lines count as one, and none are kept at the ends
+	var lines []string
+	for _, line := range out {
+		if line == "" && (len(lines) == 0 || lines[len(lines)-1] == "") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// wrapMarkdown wraps rendered text to width after a prefix on the first
+// line, indenting the lines after it by rest
+func wrapMarkdown(text string, width int, first, rest string) string {
+	indent := max(lipgloss.Width(first), lipgloss.Width(rest))
+	wrapped := lipgloss.NewStyle().Width(max(width-indent, 1)).Render(text)
+	lines := strings.Split(wrapped, "\n")
+	for i, line := range lines {
+		prefix := rest
+		if i == 0 {
+			prefix = first
+		}
+		lines[i] = prefix + strings.TrimRight(line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderInline styles bold, italic, code spans and links. Each word is
+// styled on its own, so that wrapping between words never splits a style.
+func renderInline(s string, base lipgloss.Style) string {
+	t := theme.Current.Theme
+	var b strings.Builder
+	plain := 0 // Start of the text not yet written
+
+	emit := func(text string, style lipgloss.Style) {
+		words := strings.Split(text, " ")
+		for i, word := range words {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			if word != "" {
+				b.WriteString(style.Render(word))
+			}
+		}
+	}
+
+	for i := 0; i < len(s); {
+		var text, after string
+		var style lipgloss.Style
+		var n int
+		switch {
+		case strings.HasPrefix(s[i:], "**") || strings.HasPrefix(s[i:], "__"):
+			if end := strings.Index(s[i+2:], s[i:i+2]); end > 0 {
+				text, style, n = s[i+2:i+2+end], base.Bold(true), end+4
+			}
+		case (s[i] == '*' || (s[i] == '_' && (i == 0 || s[i-1] == ' '))) && i+1 < len(s) && s[i+1] != ' ':
+			if end := strings.IndexByte(s[i+1:], s[i]); end > 0 {
+				text, style, n = s[i+1:i+1+end], base.Italic(true), end+2
+			}
+		case s[i] == '`':
+			if end := strings.IndexByte(s[i+1:], '`'); end > 0 {
+				text, style, n = s[i+1:i+1+end], lipgloss.NewStyle().Foreground(t.Secondary), end+2
+			}
+		case s[i] == '[':
+			if mid := strings.Index(s[i:], "]("); mid > 1 {
+				if end := strings.IndexByte(s[i+mid:], ')'); end > 0 {
+					text, style = s[i+1:i+mid], base.Underline(true).Foreground(t.Info)
+					url := s[i+mid+2 : i+mid+end]
+					if url != text {
+						after = " " + url
+					}
+					n = mid + end + 1
+				}
+			}
+		}
+		if n == 0 {
+			i++
+			continue
+		}
+
+		emit(s[plain:i], base)
+		emit(text, style)
+		if after != "" {
+			emit(after, lipgloss.NewStyle().Foreground(t.Subtle))
+		}
+		i += n
+		plain = i
+	}
+	emit(s[plain:], base)
+	return b.String()
+}
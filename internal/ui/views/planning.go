@@ -2,6 +2,7 @@ package views
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -35,6 +36,10 @@ type PlanningView struct {
 	undatedTasks  []model.Task
 	todayTasks    []model.Task
 
+	// Capacity planning, in minutes of estimated work
+	capacity int
+	fits     map[string]bool // Undated tasks that fit in what's left of today
+
 	// Navigation
 	currentSection PlanningSection
 	cursor         int
@@ -64,129 +69,106 @@ func (v PlanningView) SetSize(width, height int) PlanningView {
 	return v
 }
 
-// loadTasks loads tasks for daily planning
+// loadTasks loads tasks for daily planning. Each section is a query the user
+// can change with :set planning.overdue and friends.
 func (v PlanningView) loadTasks() tea.Cmd {
 	return func() tea.Msg {
-		now := time.Now()
-		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
-		tomorrow := today.AddDate(0, 0, 1)
-
-		// Load overdue tasks
-		overdueRows, err := v.db.Query(`
-			SELECT id, title, description, status, priority, due_date, project_id
-			FROM tasks
-			WHERE parent_id IS NULL
-			  AND status IN ('pending', 'in_progress')
-			  AND due_date IS NOT NULL
-			  AND due_date < ?
-			ORDER BY due_date, priority DESC
-		`, today.Format("2006-01-02"))
+		hide := !showsDeferred(v.db, nil)
+		overdueTasks, err := loadSectionTasks(v.db, db.SettingPlanningOverdue, hide)
 		if err != nil {
 			return planningErrorMsg{err: err}
 		}
-		defer overdueRows.Close()
+		sortTasksByDue(overdueTasks)
 
-		var overdueTasks []model.Task
-		for overdueRows.Next() {
-			t := scanPlanningTask(overdueRows)
-			if t != nil {
-				overdueTasks = append(overdueTasks, *t)
-			}
-		}
-
-		// Load undated tasks (no due date)
-		undatedRows, err := v.db.Query(`
-			SELECT id, title, description, status, priority, due_date, project_id
-			FROM tasks
-			WHERE parent_id IS NULL
-			  AND status IN ('pending', 'in_progress')
-			  AND due_date IS NULL
-			ORDER BY
-				CASE priority
-					WHEN 'urgent' THEN 1
-					WHEN 'high' THEN 2
-					WHEN 'medium' THEN 3
-					WHEN 'low' THEN 4
-				END,
-				created_at DESC
-			LIMIT 30
-		`)
+		undatedTasks, err := loadSectionTasks(v.db, db.SettingPlanningUndated, hide)
 		if err != nil {
 			return planningErrorMsg{err: err}
 		}
-		defer undatedRows.Close()
-
-		var undatedTasks []model.Task
-		for undatedRows.Next() {
-			t := scanPlanningTask(undatedRows)
-			if t != nil {
-				undatedTasks = append(undatedTasks, *t)
-			}
+		if len(undatedTasks) > 30 {
+			undatedTasks = undatedTasks[:30]
 		}
 
-		// Load today's tasks
-		todayRows, err := v.db.Query(`
-			SELECT id, title, description, status, priority, due_date, project_id
-			FROM tasks
-			WHERE parent_id IS NULL
-			  AND status IN ('pending', 'in_progress')
-			  AND due_date >= ?
-			  AND due_date < ?
-			ORDER BY
-				CASE priority
-					WHEN 'urgent' THEN 1
-					WHEN 'high' THEN 2
-					WHEN 'medium' THEN 3
-					WHEN 'low' THEN 4
-				END,
-				created_at
-		`, today.Format("2006-01-02"), tomorrow.Format("2006-01-02"))
+		todayTasks, err := loadSectionTasks(v.db, db.SettingPlanningToday, hide)
 		if err != nil {
 			return planningErrorMsg{err: err}
 		}
-		defer todayRows.Close()
 
-		var todayTasks []model.Task
-		for todayRows.Next() {
-			t := scanPlanningTask(todayRows)
-			if t != nil {
-				todayTasks = append(todayTasks, *t)
-			}
+		capacity, err := v.db.GetDurationSetting(db.SettingPlanningCapacity)
+		if err != nil {
+			return planningErrorMsg{err: err}
 		}
 
 		return planningLoadedMsg{
-			overdue: overdueTasks,
-			undated: undatedTasks,
-			today:   todayTasks,
+			overdue:  overdueTasks,
+			undated:  undatedTasks,
+			today:    todayTasks,
+			capacity: capacity,
 		}
 	}
 }
 
-// scanPlanningTask scans a task row for planning view
-func scanPlanningTask(rows interface{ Scan(...interface{}) error }) *model.Task {
-	var t model.Task
-	var desc, dueDate, projectID *string
-	if err := rows.Scan(&t.ID, &t.Title, &desc, &t.Status, &t.Priority, &dueDate, &projectID); err != nil {
-		return nil
+// loadSectionTasks returns the top-level tasks matching a query setting,
+// leaving out tasks that haven't started yet if hideDeferred is set
+func loadSectionTasks(database *db.DB, key string, hideDeferred bool) ([]model.Task, error) {
+	q, err := database.GetQuerySetting(key)
+	if err != nil {
+		return nil, err
 	}
-	if desc != nil {
-		t.Description = *desc
+	return database.ListTasks(db.TaskFilter{Query: q, TopLevel: true, HideDeferred: hideDeferred})
+}
+
+// showsDeferred reports whether a view should include tasks whose start
+// date is still ahead: when show_deferred is on, or the view's filter query
+// asks about start dates
+func showsDeferred(database *db.DB, q *db.Query) bool {
+	if q != nil && q.Uses("start") {
+		return true
 	}
-	if dueDate != nil {
-		if parsed, err := time.Parse("2006-01-02 15:04:05", *dueDate); err == nil {
-			t.DueDate = &parsed
-		} else if parsed, err := time.Parse("2006-01-02", *dueDate); err == nil {
-			t.DueDate = &parsed
+	show, _ := database.GetBoolSetting(db.SettingShowDeferred)
+	return show
+}
+
+// sortTasksByDue orders tasks by due date, undated last
+func sortTasksByDue(tasks []model.Task) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		a, b := tasks[i].DueDate, tasks[j].DueDate
+		if a == nil || b == nil {
+			return a != nil
 		}
+		return a.Before(*b)
+	})
+}
+
+// plannedMinutes sums the estimates of tasks and counts those without one
+func plannedMinutes(tasks []model.Task) (minutes, unestimated int) {
+	for _, task := range tasks {
+		if task.TimeEstimate == nil {
+			unestimated++
+			continue
+		}
+		minutes += *task.TimeEstimate
 	}
-	t.ProjectID = projectID
-	return &t
+	return minutes, unestimated
+}
+
+// fittingTasks picks estimated tasks, in order, while they still fit in the
+// minutes left
+func fittingTasks(tasks []model.Task, left int) map[string]bool {
+	fits := make(map[string]bool)
+	for _, task := range tasks {
+		if task.TimeEstimate != nil && *task.TimeEstimate <= left {
+			fits[task.ID] = true
+			left -= *task.TimeEstimate
+		}
+	}
+	return fits
 }
 
 type planningLoadedMsg struct {
-	overdue []model.Task
-	undated []model.Task
-	today   []model.Task
+	overdue  []model.Task
+	undated  []model.Task
+	today    []model.Task
+	capacity int
 }
 
 // Update handles messages
@@ -196,6 +178,9 @@ func (v PlanningView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		v.overdueTasks = msg.overdue
 		v.undatedTasks = msg.undated
 		v.todayTasks = msg.today
+		v.capacity = msg.capacity
+		planned, _ := plannedMinutes(v.todayTasks)
+		v.fits = fittingTasks(v.undatedTasks, v.capacity-planned)
 		v.clampCursor()
 		return v, nil
 
@@ -401,16 +386,12 @@ func (v PlanningView) assignToToday() tea.Cmd {
 		return nil
 	}
 
-	today := time.Now()
-	today = time.Date(today.Year(), today.Month(), today.Day(), 12, 0, 0, 0, time.Local)
+	today := model.EndOfDay(time.Now())
 
 	return func() tea.Msg {
+		db := v.db.Group("Plan for today")
 		for _, id := range ids {
-			_, err := v.db.Exec(`
-				UPDATE tasks SET due_date = ?, updated_at = datetime('now')
-				WHERE id = ?
-			`, today.Format("2006-01-02 15:04:05"), id)
-			if err != nil {
+			if err := db.SetTaskDueDate(id, &today); err != nil {
 				return planningErrorMsg{err: err}
 			}
 		}
@@ -425,16 +406,12 @@ func (v PlanningView) assignToTomorrow() tea.Cmd {
 		return nil
 	}
 
-	tomorrow := time.Now().AddDate(0, 0, 1)
-	tomorrow = time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 12, 0, 0, 0, time.Local)
+	tomorrow := model.EndOfDay(time.Now().AddDate(0, 0, 1))
 
 	return func() tea.Msg {
+		db := v.db.Group("Plan for tomorrow")
 		for _, id := range ids {
-			_, err := v.db.Exec(`
-				UPDATE tasks SET due_date = ?, updated_at = datetime('now')
-				WHERE id = ?
-			`, tomorrow.Format("2006-01-02 15:04:05"), id)
-			if err != nil {
+			if err := db.SetTaskDueDate(id, &tomorrow); err != nil {
 				return planningErrorMsg{err: err}
 			}
 		}
@@ -450,12 +427,9 @@ func (v PlanningView) removeDueDate() tea.Cmd {
 	}
 
 	return func() tea.Msg {
+		db := v.db.Group("Remove due date")
 		for _, id := range ids {
-			_, err := v.db.Exec(`
-				UPDATE tasks SET due_date = NULL, updated_at = datetime('now')
-				WHERE id = ?
-			`, id)
-			if err != nil {
+			if err := db.SetTaskDueDate(id, nil); err != nil {
 				return planningErrorMsg{err: err}
 			}
 		}
@@ -471,12 +445,9 @@ func (v PlanningView) markDone() tea.Cmd {
 	}
 
 	return func() tea.Msg {
+		db := v.db.Group("Complete tasks")
 		for _, id := range ids {
-			_, err := v.db.Exec(`
-				UPDATE tasks SET status = 'done', completed_at = datetime('now'), updated_at = datetime('now')
-				WHERE id = ?
-			`, id)
-			if err != nil {
+			if err := db.SetTaskStatus(id, model.StatusDone); err != nil {
 				return planningErrorMsg{err: err}
 			}
 		}
@@ -506,13 +477,23 @@ func (v PlanningView) View() string {
 
 	// Summary line
 	summaryStyle := lipgloss.NewStyle().Foreground(t.Subtle)
+	starting := 0
+	for _, task := range v.todayTasks {
+		if task.StartsToday() && !task.IsDueToday() {
+			starting++
+		}
+	}
 	summary := fmt.Sprintf("%d overdue • %d undated • %d planned for today",
 		len(v.overdueTasks), len(v.undatedTasks), len(v.todayTasks))
+	if starting > 0 {
+		summary += fmt.Sprintf(" (%d starting today)", starting)
+	}
 	sections = append(sections, summaryStyle.Render(summary))
+	sections = append(sections, v.renderCapacity())
 	sections = append(sections, "")
 
 	// Calculate section height
-	availableHeight := v.height - 8 // Reserve space for title, summary, status, hints
+	availableHeight := v.height - 9 // Reserve space for title, summary, capacity, status, hints
 	sectionHeight := availableHeight / 3
 
 	// Render three columns side by side
@@ -534,6 +515,34 @@ func (v PlanningView) View() string {
 	return strings.Join(sections, "\n")
 }
 
+// renderCapacity renders today's estimated work against the daily capacity
+func (v PlanningView) renderCapacity() string {
+	t := theme.Current.Theme
+
+	planned, unestimated := plannedMinutes(v.todayTasks)
+	line := fmt.Sprintf("Today: %s of %s estimated", model.FormatEstimate(planned), model.FormatEstimate(v.capacity))
+	if planned == 0 {
+		line = fmt.Sprintf("Today: nothing estimated of %s", model.FormatEstimate(v.capacity))
+	}
+	if unestimated == 1 {
+		line += " • 1 task without an estimate"
+	} else if unestimated > 1 {
+		line += fmt.Sprintf(" • %d tasks without an estimate", unestimated)
+	}
+
+	if planned > v.capacity {
+		line += fmt.Sprintf(" • overcommitted by %s", model.FormatEstimate(planned-v.capacity))
+		return lipgloss.NewStyle().Foreground(t.Error).Bold(true).Render(line)
+	}
+	if len(v.fits) == 1 {
+		line += fmt.Sprintf(" • 1 undated task marked + fits in the %s left", model.FormatEstimate(v.capacity-planned))
+	} else if len(v.fits) > 1 {
+		line += fmt.Sprintf(" • %d undated tasks marked + fit in the %s left",
+			len(v.fits), model.FormatEstimate(v.capacity-planned))
+	}
+	return lipgloss.NewStyle().Foreground(t.Subtle).Render(line)
+}
+
 // renderSection renders a section of tasks
 func (v PlanningView) renderSection(title string, tasks []model.Task, section PlanningSection, width, height int, accentColor lipgloss.Color) string {
 	t := theme.Current.Theme
@@ -607,12 +616,27 @@ func (v PlanningView) renderSection(title string, tasks []model.Task, section Pl
 				priorityChar = lipgloss.NewStyle().Foreground(t.PriorityLow).Render("▽")
 			}
 
-			// Truncate title
+			// Truncate title, leaving room for the estimate
 			titleText := task.Title
-			maxLen := width - 12
+			var estimateText string
+			if task.TimeEstimate != nil {
+				estimateText = " ~" + model.FormatEstimate(*task.TimeEstimate)
+			}
+			maxLen := width - 12 - len(estimateText)
 			if len(titleText) > maxLen {
 				titleText = titleText[:maxLen-3] + "..."
 			}
+			if estimateText != "" {
+				titleText += lipgloss.NewStyle().Foreground(t.Subtle).Render(estimateText)
+			}
+
+			// Tasks that just came off the tickler, and undated tasks that
+			// would fit in today's remaining capacity
+			if task.StartsToday() && !task.IsDueToday() {
+				titleText = lipgloss.NewStyle().Foreground(t.Info).Render("▸ ") + titleText
+			} else if section == SectionUndated && v.fits[task.ID] {
+				titleText = lipgloss.NewStyle().Foreground(t.Success).Render("+ ") + titleText
+			}
 
 			line := fmt.Sprintf("%s %s %s", checkbox, priorityChar, titleText)
 			lines = append(lines, itemStyle.Render(line))
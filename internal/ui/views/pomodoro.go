@@ -11,14 +11,6 @@ import (
 	"github.com/dori/klonch/internal/model"
 	"github.com/dori/klonch/internal/notify"
 	"github.com/dori/klonch/internal/ui/theme"
-	"github.com/google/uuid"
-)
-
-// Timer durations
-const (
-	PomodoroWork       = 25 * time.Minute
-	PomodoroShortBreak = 5 * time.Minute
-	PomodoroLongBreak  = 15 * time.Minute
 )
 
 // PomodoroState represents the timer state
@@ -34,7 +26,7 @@ const (
 // PomodoroView represents the Pomodoro timer view
 type PomodoroView struct {
 	db       *db.DB
-	notifier *notify.Notifier
+	notifier notify.Notifier
 	width    int
 	height   int
 
@@ -43,6 +35,9 @@ type PomodoroView struct {
 	taskCursor  int
 	selectedTask *model.Task
 
+	// Lengths, cycle and goal from the pomodoro.* settings
+	cfg db.PomodoroConfig
+
 	// Timer state
 	state        PomodoroState
 	duration     time.Duration // Total duration for current session
@@ -51,7 +46,9 @@ type PomodoroView struct {
 	pausedAt     time.Time     // When paused (for resume calculation)
 
 	// Session tracking
-	completedPomodoros int
+	completedPomodoros int    // Sessions completed today
+	sinceLongBreak     int    // Sessions completed since the last long break
+	longBreak          bool   // The break running is a long one
 	currentEntryID     string // ID of current time entry being recorded
 
 	// Status
@@ -59,19 +56,21 @@ type PomodoroView struct {
 }
 
 // NewPomodoroView creates a new Pomodoro view
-func NewPomodoroView(database *db.DB, notifier *notify.Notifier) PomodoroView {
+func NewPomodoroView(database *db.DB, notifier notify.Notifier) PomodoroView {
+	cfg, _ := database.PomodoroConfig()
 	return PomodoroView{
 		db:        database,
 		notifier:  notifier,
-		duration:  PomodoroWork,
-		remaining: PomodoroWork,
+		cfg:       cfg,
+		duration:  cfg.Work,
+		remaining: cfg.Work,
 		state:     PomodoroIdle,
 	}
 }
 
 // Init initializes the Pomodoro view
 func (v PomodoroView) Init() tea.Cmd {
-	return v.loadTasks()
+	return tea.Batch(v.loadTasks(), v.loadProgress(), LoadRunningTimer(v.db, false))
 }
 
 // SetSize sets the view dimensions
@@ -119,8 +118,20 @@ func (v PomodoroView) loadTasks() tea.Cmd {
 	}
 }
 
+// loadProgress counts the sessions completed today
+func (v PomodoroView) loadProgress() tea.Cmd {
+	return func() tea.Msg {
+		n, err := v.db.CountPomodoros(model.StartOfDay(time.Now()))
+		if err != nil {
+			return pomodoroErrorMsg{err: err}
+		}
+		return pomodoroProgressMsg{completed: n}
+	}
+}
+
 type pomodoroErrorMsg struct{ err error }
 type pomodoroTasksLoadedMsg struct{ tasks []model.Task }
+type pomodoroProgressMsg struct{ completed int }
 type pomodoroTickMsg struct{}
 type pomodoroCompleteMsg struct{}
 
@@ -138,6 +149,24 @@ func (v PomodoroView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		v.tasks = msg.tasks
 		return v, nil
 
+	case pomodoroProgressMsg:
+		v.completedPomodoros = msg.completed
+		return v, nil
+
+	case RunningTimerMsg:
+		return v.followTimer(msg)
+
+	case db.SettingChange:
+		if strings.HasPrefix(msg.Key, "pomodoro.") {
+			if cfg, err := v.db.PomodoroConfig(); err == nil {
+				v.cfg = cfg
+			}
+			if v.state == PomodoroIdle {
+				v.resetTimer()
+			}
+		}
+		return v, nil
+
 	case pomodoroTickMsg:
 		if v.state == PomodoroRunning || v.state == PomodoroBreak {
 			elapsed := time.Since(v.startedAt)
@@ -152,37 +181,53 @@ func (v PomodoroView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return v, nil
 
 	case pomodoroCompleteMsg:
+		var cmds []tea.Cmd
 		if v.state == PomodoroRunning {
 			// Completed a work session
+			v.recordTimeEntry()
+			cmds = append(cmds, timerChanged)
 			v.completedPomodoros++
-			v.state = PomodoroIdle
-			v.statusMsg = fmt.Sprintf("Pomodoro #%d complete! Take a break.", v.completedPomodoros)
-
-			// Record time entry
-			if v.selectedTask != nil {
-				v.recordTimeEntry()
+			if n, err := v.db.CountPomodoros(model.StartOfDay(time.Now())); err == nil {
+				v.completedPomodoros = n
 			}
+			v.sinceLongBreak++
 
 			// Send notification
-			if v.notifier != nil {
-				taskTitle := ""
-				if v.selectedTask != nil {
-					taskTitle = v.selectedTask.Title
-				}
-				v.notifier.SendPomodoroComplete(taskTitle, int(PomodoroWork.Minutes()))
+			taskTitle := ""
+			if v.selectedTask != nil {
+				taskTitle = v.selectedTask.Title
+			}
+			cmds = append(cmds, sendNotification(v.notifier, notify.PomodoroComplete(taskTitle)))
+
+			long := v.cfg.LongBreakDue(v.sinceLongBreak)
+			done := fmt.Sprintf("Pomodoro #%d complete!", v.completedPomodoros)
+			switch {
+			case v.cfg.AutoBreak:
+				cmds = append(cmds, v.startBreak(long))
+				v.statusMsg = done + " " + v.statusMsg
+			case long:
+				v.state = PomodoroIdle
+				v.resetTimer()
+				v.statusMsg = done + " Time for a long break (B)."
+			default:
+				v.state = PomodoroIdle
+				v.resetTimer()
+				v.statusMsg = done + " Take a break (b)."
 			}
 		} else if v.state == PomodoroBreak {
-			v.state = PomodoroIdle
-			v.statusMsg = "Break over! Ready for next pomodoro."
-
 			// Send notification
-			if v.notifier != nil {
-				v.notifier.SendBreakComplete()
+			cmds = append(cmds, sendNotification(v.notifier, notify.BreakComplete()))
+
+			if v.cfg.AutoWork {
+				cmds = append(cmds, v.startTimer())
+				v.statusMsg = "Break over! Next pomodoro started."
+			} else {
+				v.state = PomodoroIdle
+				v.resetTimer()
+				v.statusMsg = "Break over! Ready for next pomodoro."
 			}
 		}
-		v.remaining = PomodoroWork
-		v.duration = PomodoroWork
-		return v, nil
+		return v, tea.Batch(cmds...)
 
 	case taskUpdatedMsg:
 		return v, v.loadTasks()
@@ -212,36 +257,50 @@ func (v PomodoroView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "s", " ": // Start/pause
 			switch v.state {
 			case PomodoroIdle:
-				return v, v.startTimer(PomodoroWork)
+				cmd := v.startTimer()
+				return v, cmd
 			case PomodoroRunning:
 				v.state = PomodoroPaused
 				v.pausedAt = time.Now()
 				v.statusMsg = "Paused"
-				return v, nil
+				if err := v.db.PauseTimer(v.currentEntryID, v.pausedAt); err != nil && err != db.ErrTimerNotRunning {
+					v.statusMsg = fmt.Sprintf("Error: %v", err)
+				}
+				return v, timerChanged
 			case PomodoroPaused:
 				// Resume: adjust startedAt by pause duration
-				pauseDuration := time.Since(v.pausedAt)
-				v.startedAt = v.startedAt.Add(pauseDuration)
+				now := time.Now()
+				v.startedAt = v.startedAt.Add(now.Sub(v.pausedAt))
 				v.state = PomodoroRunning
 				v.statusMsg = "Resumed"
-				return v, tickCmd()
+				if err := v.db.ResumeTimer(v.currentEntryID, now); err != nil && err != db.ErrTimerNotRunning {
+					v.statusMsg = fmt.Sprintf("Error: %v", err)
+				}
+				return v, tea.Batch(tickCmd(), timerChanged)
 			}
 
-		case "r": // Reset
+		case "r": // Reset, dropping the unfinished session
+			var cmd tea.Cmd
+			if v.currentEntryID != "" {
+				v.db.DiscardTimer(v.currentEntryID)
+				v.currentEntryID = ""
+				cmd = timerChanged
+			}
 			v.state = PomodoroIdle
-			v.remaining = PomodoroWork
-			v.duration = PomodoroWork
+			v.resetTimer()
 			v.statusMsg = "Timer reset"
-			return v, nil
+			return v, cmd
 
 		case "b": // Short break
 			if v.state == PomodoroIdle {
-				return v, v.startBreak(PomodoroShortBreak)
+				cmd := v.startBreak(false)
+				return v, cmd
 			}
 
 		case "B": // Long break
 			if v.state == PomodoroIdle {
-				return v, v.startBreak(PomodoroLongBreak)
+				cmd := v.startBreak(true)
+				return v, cmd
 			}
 
 		case "c": // Clear selected task
@@ -265,39 +324,95 @@ func (v PomodoroView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 // startTimer starts a work session
-func (v PomodoroView) startTimer(duration time.Duration) tea.Cmd {
+func (v *PomodoroView) startTimer() tea.Cmd {
 	v.state = PomodoroRunning
-	v.duration = duration
-	v.remaining = duration
+	v.duration = v.cfg.Work
+	v.remaining = v.cfg.Work
 	v.startedAt = time.Now()
 	v.statusMsg = "Focus time started!"
 
-	// Create time entry
+	// Create time entry, against no task if none was picked. It stops any
+	// other timer.
+	taskID := ""
 	if v.selectedTask != nil {
-		v.currentEntryID = uuid.New().String()
-		v.db.Exec(`
-			INSERT INTO time_entries (id, task_id, started_at, is_pomodoro)
-			VALUES (?, ?, ?, 1)
-		`, v.currentEntryID, v.selectedTask.ID, v.startedAt)
+		taskID = v.selectedTask.ID
 	}
+	v.currentEntryID, _ = v.db.StartTimeEntry(taskID, v.startedAt, true)
 
-	return tickCmd()
+	return tea.Batch(tickCmd(), timerChanged)
+}
+
+// followTimer picks up a work session started before a restart or in
+// another klonch, and lets go of one stopped elsewhere
+func (v PomodoroView) followTimer(msg RunningTimerMsg) (tea.Model, tea.Cmd) {
+	e := msg.Entry
+	if e == nil || !e.IsPomodoro {
+		if v.currentEntryID != "" {
+			v.currentEntryID = ""
+			v.state = PomodoroIdle
+			v.resetTimer()
+			v.statusMsg = "Pomodoro stopped"
+		}
+		return v, nil
+	}
+	if e.ID == v.currentEntryID {
+		return v, nil
+	}
+
+	ticking := v.state == PomodoroRunning || v.state == PomodoroBreak
+	now := time.Now()
+	v.currentEntryID = e.ID
+	v.selectedTask = msg.Task
+	v.duration = v.cfg.Work
+	if msg.Length > 0 {
+		v.duration = msg.Length
+	}
+	// Pauses push the end of the session back, as resuming here does
+	v.startedAt = e.StartedAt.Add(time.Duration(e.PausedSeconds) * time.Second)
+	v.remaining = v.duration - e.Elapsed(now)
+	if e.IsPaused() {
+		v.state = PomodoroPaused
+		v.pausedAt = *e.PausedAt
+		v.statusMsg = "Paused"
+		return v, nil
+	}
+	v.state = PomodoroRunning
+	v.statusMsg = "Pomodoro resumed"
+	if ticking {
+		return v, nil
+	}
+	return v, tickCmd()
+}
+
+// IsTimerActive reports whether a session or break is counting down, so it
+// needs ticks even while another view is open
+func (v PomodoroView) IsTimerActive() bool {
+	return v.state == PomodoroRunning || v.state == PomodoroBreak
 }
 
-// startBreak starts a break session
-func (v PomodoroView) startBreak(duration time.Duration) tea.Cmd {
+// startBreak starts a short or long break. A long break starts the count
+// towards the next one afresh.
+func (v *PomodoroView) startBreak(long bool) tea.Cmd {
 	v.state = PomodoroBreak
-	v.duration = duration
-	v.remaining = duration
-	v.startedAt = time.Now()
-	if duration == PomodoroShortBreak {
-		v.statusMsg = "Short break started"
-	} else {
+	v.longBreak = long
+	v.duration = v.cfg.ShortBreak
+	v.statusMsg = "Short break started"
+	if long {
+		v.duration = v.cfg.LongBreak
+		v.sinceLongBreak = 0
 		v.statusMsg = "Long break started"
 	}
+	v.remaining = v.duration
+	v.startedAt = time.Now()
 	return tickCmd()
 }
 
+// resetTimer shows a full work session, ready to start
+func (v *PomodoroView) resetTimer() {
+	v.duration = v.cfg.Work
+	v.remaining = v.cfg.Work
+}
+
 // completeSession handles session completion
 func (v PomodoroView) completeSession() tea.Cmd {
 	return func() tea.Msg {
@@ -305,20 +420,26 @@ func (v PomodoroView) completeSession() tea.Cmd {
 	}
 }
 
-// recordTimeEntry saves the completed time entry
+// sendNotification delivers a notification in the background, so a slow
+// backend doesn't hold up the timer
+func sendNotification(notifier notify.Notifier, notification notify.Notification) tea.Cmd {
+	if notifier == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		notifier.Send(notification)
+		return nil
+	}
+}
+
+// recordTimeEntry saves the completed time entry. It ends when the session
+// did, which is earlier than now if klonch wasn't running at the time.
 func (v *PomodoroView) recordTimeEntry() {
 	if v.currentEntryID == "" {
 		return
 	}
 
-	now := time.Now()
-	duration := int(PomodoroWork.Minutes())
-
-	v.db.Exec(`
-		UPDATE time_entries
-		SET ended_at = ?, duration = ?
-		WHERE id = ?
-	`, now, duration, v.currentEntryID)
+	v.db.StopTimer(v.currentEntryID, v.startedAt.Add(v.duration))
 
 	v.currentEntryID = ""
 }
@@ -352,16 +473,6 @@ func (v PomodoroView) View() string {
 		sections = append(sections, taskStyle.Render(fmt.Sprintf("Working on: %s", v.selectedTask.Title)))
 	}
 
-	// Session stats
-	statsStyle := lipgloss.NewStyle().
-		Foreground(t.Subtle).
-		MarginTop(1)
-	tomatoes := strings.Repeat("🍅", v.completedPomodoros)
-	if tomatoes == "" {
-		tomatoes = "(none yet)"
-	}
-	sections = append(sections, statsStyle.Render(fmt.Sprintf("Completed today: %s", tomatoes)))
-
 	// Task list (when idle)
 	if v.state == PomodoroIdle && len(v.tasks) > 0 {
 		taskList := v.renderTaskList()
@@ -421,7 +532,10 @@ func (v PomodoroView) renderTimer() string {
 		BorderForeground(color)
 
 	// Progress bar
-	progress := 1.0 - (float64(v.remaining) / float64(v.duration))
+	progress := 0.0
+	if v.duration > 0 {
+		progress = 1.0 - (float64(v.remaining) / float64(v.duration))
+	}
 	barWidth := 30
 	filled := int(progress * float64(barWidth))
 	if filled > barWidth {
@@ -437,7 +551,10 @@ func (v PomodoroView) renderTimer() string {
 	case PomodoroRunning:
 		stateLabel = "FOCUS"
 	case PomodoroBreak:
-		stateLabel = "BREAK"
+		stateLabel = "SHORT BREAK"
+		if v.longBreak {
+			stateLabel = "LONG BREAK"
+		}
 	case PomodoroPaused:
 		stateLabel = "PAUSED"
 	default:
@@ -448,13 +565,74 @@ func (v PomodoroView) renderTimer() string {
 		Bold(true).
 		Foreground(color)
 
+	subtleStyle := lipgloss.NewStyle().Foreground(t.Subtle)
+	lengths := fmt.Sprintf("%s focus • %s break • %s long break",
+		model.FormatEstimate(int(v.cfg.Work.Minutes())),
+		model.FormatEstimate(int(v.cfg.ShortBreak.Minutes())),
+		model.FormatEstimate(int(v.cfg.LongBreak.Minutes())))
+
 	return lipgloss.JoinVertical(lipgloss.Center,
 		labelStyle.Render(stateLabel),
 		bigTime.Render(timeStyle.Render(timeStr)),
 		barStyle.Render(bar),
+		"",
+		v.renderProgress(),
+		subtleStyle.Render(lengths),
 	)
 }
 
+// renderProgress shows the sessions done today against the daily goal, and
+// how far the cycle is towards a long break
+func (v PomodoroView) renderProgress() string {
+	t := theme.Current.Theme
+
+	const maxTomatoes = 12
+	shown := v.completedPomodoros
+	if shown > maxTomatoes {
+		shown = maxTomatoes
+	}
+	today := strings.Repeat("🍅", shown)
+	if v.cfg.DailyGoal > shown && v.cfg.DailyGoal <= maxTomatoes {
+		today += strings.Repeat("·", v.cfg.DailyGoal-shown)
+	}
+
+	var goal string
+	switch {
+	case v.cfg.DailyGoal == 0:
+		goal = fmt.Sprintf("Today: %d", v.completedPomodoros)
+	case v.completedPomodoros >= v.cfg.DailyGoal:
+		goal = fmt.Sprintf("Today: %d/%d, goal reached!", v.completedPomodoros, v.cfg.DailyGoal)
+	default:
+		goal = fmt.Sprintf("Today: %d/%d", v.completedPomodoros, v.cfg.DailyGoal)
+	}
+	goalStyle := lipgloss.NewStyle().Foreground(t.Foreground)
+	if v.cfg.DailyGoal > 0 && v.completedPomodoros >= v.cfg.DailyGoal {
+		goalStyle = goalStyle.Foreground(t.Success).Bold(true)
+	}
+	lines := []string{goalStyle.Render(strings.TrimSpace(today + " " + goal))}
+
+	// One dot per session in the cycle, filled for those done
+	if every := v.cfg.LongBreakEvery; every > 0 {
+		done := v.sinceLongBreak
+		if done > every {
+			done = every
+		}
+		var cycle string
+		if every <= maxTomatoes {
+			cycle = strings.Repeat("●", done) + strings.Repeat("○", every-done) + "  "
+		}
+		var next string
+		if left := every - v.sinceLongBreak; left > 0 {
+			next = fmt.Sprintf("long break after %d more", left)
+		} else {
+			next = "long break due"
+		}
+		lines = append(lines, lipgloss.NewStyle().Foreground(t.Subtle).Render(cycle+next))
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Center, lines...)
+}
+
 // renderTaskList renders the task selection list
 func (v PomodoroView) renderTaskList() string {
 	t := theme.Current.Theme
@@ -538,4 +716,4 @@ func (v PomodoroView) renderControls() string {
 // IsInputMode returns whether the view is in input mode
 func (v PomodoroView) IsInputMode() bool {
 	return false
-}
+}
\ No newline at end of file
@@ -2,6 +2,7 @@ package views
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -83,85 +84,42 @@ func (v ReviewView) loadTasks() tea.Cmd {
 		weekStart := time.Date(now.Year(), now.Month(), now.Day()-weekday+1, 0, 0, 0, 0, time.Local)
 		weekEnd := weekStart.AddDate(0, 0, 7)
 
-		// Two weeks ago for stale detection
-		twoWeeksAgo := now.AddDate(0, 0, -14)
-
-		// Load completed tasks this week
-		completedRows, err := v.db.Query(`
-			SELECT id, title, description, status, priority, completed_at, project_id
-			FROM tasks
-			WHERE parent_id IS NULL
-			  AND status = 'done'
-			  AND completed_at >= ?
-			  AND completed_at < ?
-			ORDER BY completed_at DESC
-		`, weekStart.Format("2006-01-02"), weekEnd.Format("2006-01-02"))
+		// Sections are queries the user can change with :set review.stale etc.
+		completedTasks, err := loadSectionTasks(v.db, db.SettingReviewCompleted, false)
 		if err != nil {
 			return reviewErrorMsg{err: err}
 		}
-		defer completedRows.Close()
-
-		var completedTasks []model.Task
-		for completedRows.Next() {
-			t := scanReviewTask(completedRows)
-			if t != nil {
-				completedTasks = append(completedTasks, *t)
+		sort.SliceStable(completedTasks, func(i, j int) bool {
+			a, b := completedTasks[i].CompletedAt, completedTasks[j].CompletedAt
+			if a == nil || b == nil {
+				return a != nil
 			}
-		}
+			return a.After(*b)
+		})
 
-		// Load overdue tasks
-		overdueRows, err := v.db.Query(`
-			SELECT id, title, description, status, priority, due_date, project_id
-			FROM tasks
-			WHERE parent_id IS NULL
-			  AND status IN ('pending', 'in_progress')
-			  AND due_date IS NOT NULL
-			  AND due_date < ?
-			ORDER BY due_date
-		`, now.Format("2006-01-02"))
+		overdueTasks, err := loadSectionTasks(v.db, db.SettingReviewOverdue, false)
 		if err != nil {
 			return reviewErrorMsg{err: err}
 		}
-		defer overdueRows.Close()
-
-		var overdueTasks []model.Task
-		for overdueRows.Next() {
-			t := scanReviewTask(overdueRows)
-			if t != nil {
-				overdueTasks = append(overdueTasks, *t)
-			}
-		}
+		sortTasksByDue(overdueTasks)
 
-		// Load stale tasks (pending for >2 weeks, no recent updates)
-		staleRows, err := v.db.Query(`
-			SELECT id, title, description, status, priority, created_at, project_id
-			FROM tasks
-			WHERE parent_id IS NULL
-			  AND status IN ('pending', 'in_progress')
-			  AND created_at < ?
-			  AND updated_at < ?
-			ORDER BY created_at
-			LIMIT 20
-		`, twoWeeksAgo.Format("2006-01-02"), twoWeeksAgo.Format("2006-01-02"))
+		staleTasks, err := loadSectionTasks(v.db, db.SettingReviewStale, false)
 		if err != nil {
 			return reviewErrorMsg{err: err}
 		}
-		defer staleRows.Close()
-
-		var staleTasks []model.Task
-		for staleRows.Next() {
-			t := scanReviewTask(staleRows)
-			if t != nil {
-				staleTasks = append(staleTasks, *t)
-			}
+		sort.SliceStable(staleTasks, func(i, j int) bool {
+			return staleTasks[i].CreatedAt.Before(staleTasks[j].CreatedAt)
+		})
+		if len(staleTasks) > 20 {
+			staleTasks = staleTasks[:20]
 		}
 
 		// Get total time logged this week
 		var totalTime int
 		row := v.db.QueryRow(`
 			SELECT COALESCE(SUM(duration), 0) FROM time_entries
-			WHERE started_at >= ? AND started_at < ?
-		`, weekStart.Format("2006-01-02"), weekEnd.Format("2006-01-02"))
+			WHERE `+db.InRange("started_at")+`
+		`, db.Timestamp(weekStart), db.Timestamp(weekEnd))
 		row.Scan(&totalTime)
 
 		return reviewLoadedMsg{
@@ -176,35 +134,6 @@ func (v ReviewView) loadTasks() tea.Cmd {
 	}
 }
 
-// scanReviewTask scans a task row for review view
-func scanReviewTask(rows interface{ Scan(...interface{}) error }) *model.Task {
-	var t model.Task
-	var desc, dateCol, projectID *string
-	if err := rows.Scan(&t.ID, &t.Title, &desc, &t.Status, &t.Priority, &dateCol, &projectID); err != nil {
-		return nil
-	}
-	if desc != nil {
-		t.Description = *desc
-	}
-	if dateCol != nil {
-		if parsed, err := time.Parse("2006-01-02 15:04:05", *dateCol); err == nil {
-			if t.Status == model.StatusDone {
-				t.CompletedAt = &parsed
-			} else {
-				t.DueDate = &parsed
-			}
-		} else if parsed, err := time.Parse("2006-01-02", *dateCol); err == nil {
-			if t.Status == model.StatusDone {
-				t.CompletedAt = &parsed
-			} else {
-				t.DueDate = &parsed
-			}
-		}
-	}
-	t.ProjectID = projectID
-	return &t
-}
-
 type reviewLoadedMsg struct {
 	completed       []model.Task
 	overdue         []model.Task
@@ -425,15 +354,12 @@ func (v ReviewView) rescheduleNextWeek() tea.Cmd {
 	if daysUntilMonday == 0 {
 		daysUntilMonday = 7
 	}
-	nextMonday := time.Date(now.Year(), now.Month(), now.Day()+daysUntilMonday, 12, 0, 0, 0, time.Local)
+	nextMonday := model.EndOfDay(now.AddDate(0, 0, daysUntilMonday))
 
 	return func() tea.Msg {
+		db := v.db.Group("Reschedule to next week")
 		for _, id := range ids {
-			_, err := v.db.Exec(`
-				UPDATE tasks SET due_date = ?, updated_at = datetime('now')
-				WHERE id = ?
-			`, nextMonday.Format("2006-01-02 15:04:05"), id)
-			if err != nil {
+			if err := db.SetTaskDueDate(id, &nextMonday); err != nil {
 				return reviewErrorMsg{err: err}
 			}
 		}
@@ -448,16 +374,12 @@ func (v ReviewView) rescheduleToday() tea.Cmd {
 		return nil
 	}
 
-	today := time.Now()
-	today = time.Date(today.Year(), today.Month(), today.Day(), 12, 0, 0, 0, time.Local)
+	today := model.EndOfDay(time.Now())
 
 	return func() tea.Msg {
+		db := v.db.Group("Reschedule to today")
 		for _, id := range ids {
-			_, err := v.db.Exec(`
-				UPDATE tasks SET due_date = ?, updated_at = datetime('now')
-				WHERE id = ?
-			`, today.Format("2006-01-02 15:04:05"), id)
-			if err != nil {
+			if err := db.SetTaskDueDate(id, &today); err != nil {
 				return reviewErrorMsg{err: err}
 			}
 		}
@@ -473,12 +395,9 @@ func (v ReviewView) archiveTasks() tea.Cmd {
 	}
 
 	return func() tea.Msg {
+		db := v.db.Group("Archive tasks")
 		for _, id := range ids {
-			_, err := v.db.Exec(`
-				UPDATE tasks SET status = 'archived', updated_at = datetime('now')
-				WHERE id = ?
-			`, id)
-			if err != nil {
+			if err := db.SetTaskStatus(id, model.StatusArchived); err != nil {
 				return reviewErrorMsg{err: err}
 			}
 		}
@@ -494,12 +413,9 @@ func (v ReviewView) uncheckTasks() tea.Cmd {
 	}
 
 	return func() tea.Msg {
+		db := v.db.Group("Reopen tasks")
 		for _, id := range ids {
-			_, err := v.db.Exec(`
-				UPDATE tasks SET status = 'pending', completed_at = NULL, updated_at = datetime('now')
-				WHERE id = ?
-			`, id)
-			if err != nil {
+			if err := db.SetTaskStatus(id, model.StatusPending); err != nil {
 				return reviewErrorMsg{err: err}
 			}
 		}
@@ -515,12 +431,9 @@ func (v ReviewView) removeDueDate() tea.Cmd {
 	}
 
 	return func() tea.Msg {
+		db := v.db.Group("Remove due date")
 		for _, id := range ids {
-			_, err := v.db.Exec(`
-				UPDATE tasks SET due_date = NULL, updated_at = datetime('now')
-				WHERE id = ?
-			`, id)
-			if err != nil {
+			if err := db.SetTaskDueDate(id, nil); err != nil {
 				return reviewErrorMsg{err: err}
 			}
 		}
@@ -536,9 +449,9 @@ func (v ReviewView) deleteTasks() tea.Cmd {
 	}
 
 	return func() tea.Msg {
+		db := v.db.Group("Delete tasks")
 		for _, id := range ids {
-			_, err := v.db.Exec(`DELETE FROM tasks WHERE id = ?`, id)
-			if err != nil {
+			if err := db.DeleteTask(id); err != nil {
 				return reviewErrorMsg{err: err}
 			}
 		}
@@ -681,8 +594,10 @@ func (v ReviewView) renderSection(title string, tasks []model.Task, section Revi
 			if section == SectionCompleted && task.CompletedAt != nil {
 				dateInfo = task.CompletedAt.Format("Mon")
 			} else if section == SectionOverdueReview && task.DueDate != nil {
-				daysOverdue := int(time.Since(*task.DueDate).Hours() / 24)
-				if daysOverdue == 1 {
+				daysOverdue := model.DaysBetween(*task.DueDate, time.Now())
+				if daysOverdue == 0 {
+					dateInfo = task.DueDate.Format("15:04")
+				} else if daysOverdue == 1 {
 					dateInfo = "1d ago"
 				} else {
 					dateInfo = fmt.Sprintf("%dd ago", daysOverdue)
@@ -0,0 +1,286 @@
+package views
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/dori/klonch/internal/db"
+	"github.com/dori/klonch/internal/model"
+	"github.com/dori/klonch/internal/ui/theme"
+)
+
+// SearchJumpRequest is sent when the user picks a search result
+type SearchJumpRequest struct {
+	Task      model.Task
+	Ancestors []model.Task
+}
+
+// SearchClosedMsg is sent when the search overlay is dismissed
+type SearchClosedMsg struct{}
+
+// searchResultsMsg carries results for the query that produced them
+type searchResultsMsg struct {
+	query   string
+	results []db.SearchResult
+	err     error
+}
+
+// SearchView is the global search overlay. It searches every task in the
+// database, not just what the current view has loaded.
+type SearchView struct {
+	db     *db.DB
+	width  int
+	height int
+
+	input    textinput.Model
+	results  []db.SearchResult
+	projects map[string]model.Project
+	cursor   int
+	err      error
+}
+
+// NewSearchView creates a new search overlay
+func NewSearchView(database *db.DB) SearchView {
+	ti := textinput.New()
+	ti.Placeholder = "Search titles, descriptions and tags..."
+	ti.Prompt = "/ "
+	ti.CharLimit = 256
+
+	return SearchView{
+		db:    database,
+		input: ti,
+	}
+}
+
+// Open clears the previous search and focuses the input
+func (v SearchView) Open() (SearchView, tea.Cmd) {
+	v.input.SetValue("")
+	v.results = nil
+	v.cursor = 0
+	v.err = nil
+
+	v.projects = make(map[string]model.Project)
+	if projects, err := v.db.GetProjects(); err == nil {
+		for _, p := range projects {
+			v.projects[p.ID] = p
+		}
+	}
+
+	return v, v.input.Focus()
+}
+
+// Init initializes the view
+func (v SearchView) Init() tea.Cmd {
+	return nil
+}
+
+// IsInputMode is always true: every key goes to the search box
+func (v SearchView) IsInputMode() bool {
+	return true
+}
+
+// SetSize sets the view dimensions
+func (v SearchView) SetSize(width, height int) SearchView {
+	v.width = width
+	v.height = height
+	v.input.Width = width - 8
+	return v
+}
+
+// Update handles messages
+func (v SearchView) Update(msg tea.Msg) (SearchView, tea.Cmd) {
+	switch msg := msg.(type) {
+	case searchResultsMsg:
+		// Drop results for queries the user has already typed past
+		if msg.query != v.input.Value() {
+			return v, nil
+		}
+		v.results = msg.results
+		v.err = msg.err
+		v.cursor = 0
+		return v, nil
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "esc":
+			return v, func() tea.Msg { return SearchClosedMsg{} }
+		case "enter":
+			if v.cursor < len(v.results) {
+				r := v.results[v.cursor]
+				return v, func() tea.Msg {
+					return SearchJumpRequest{Task: r.Task, Ancestors: r.Ancestors}
+				}
+			}
+			return v, nil
+		case "up", "ctrl+p":
+			if v.cursor > 0 {
+				v.cursor--
+			}
+			return v, nil
+		case "down", "ctrl+n":
+			if v.cursor < len(v.results)-1 {
+				v.cursor++
+			}
+			return v, nil
+		}
+
+		before := v.input.Value()
+		var cmd tea.Cmd
+		v.input, cmd = v.input.Update(msg)
+		if query := v.input.Value(); query != before {
+			return v, tea.Batch(cmd, v.search(query))
+		}
+		return v, cmd
+	}
+
+	var cmd tea.Cmd
+	v.input, cmd = v.input.Update(msg)
+	return v, cmd
+}
+
+// search runs a query in the background
+func (v SearchView) search(query string) tea.Cmd {
+	database := v.db
+	return func() tea.Msg {
+		results, err := database.SearchTasks(query)
+		return searchResultsMsg{query: query, results: results, err: err}
+	}
+}
+
+// View renders the overlay
+func (v SearchView) View() string {
+	t := theme.Current.Theme
+	width := v.width - 4
+	if width < 20 {
+		width = 20
+	}
+
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(t.Primary)
+	subtleStyle := lipgloss.NewStyle().Foreground(t.Subtle)
+	matchStyle := lipgloss.NewStyle().Bold(true).Foreground(t.Warning)
+
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Search all tasks"))
+	b.WriteString("\n\n")
+	b.WriteString(v.input.View())
+	b.WriteString("\n\n")
+
+	query := strings.TrimSpace(v.input.Value())
+	switch {
+	case v.err != nil:
+		b.WriteString(lipgloss.NewStyle().Foreground(t.Error).Render("Search failed: " + v.err.Error()))
+		b.WriteString("\n")
+	case query != "" && len(v.results) == 0:
+		b.WriteString(subtleStyle.Italic(true).Render("  No matching tasks"))
+		b.WriteString("\n")
+	}
+
+	// Each result takes two lines: title, then where it lives and the excerpt
+	visible := (v.height - 8) / 2
+	if visible < 1 {
+		visible = 1
+	}
+	start := 0
+	if v.cursor >= visible {
+		start = v.cursor - visible + 1
+	}
+
+	for i := start; i < len(v.results) && i < start+visible; i++ {
+		r := v.results[i]
+
+		cursor := "  "
+		lineStyle := lipgloss.NewStyle().Foreground(t.Foreground)
+		if i == v.cursor {
+			cursor = "> "
+			lineStyle = lineStyle.Bold(true)
+		}
+		if r.Task.Status == model.StatusDone || r.Task.Status == model.StatusArchived {
+			lineStyle = lineStyle.Foreground(t.Subtle)
+		}
+
+		b.WriteString(cursor)
+		b.WriteString(searchStatusIcon(r.Task.Status))
+		b.WriteString(" ")
+		b.WriteString(renderHighlights(r.Title, lineStyle, matchStyle))
+		b.WriteString("\n")
+
+		b.WriteString("    ")
+		b.WriteString(subtleStyle.Render(v.breadcrumb(r)))
+		if r.Snippet != "" && r.Snippet != r.Title {
+			b.WriteString(subtleStyle.Render(" — "))
+			snippet := strings.Join(strings.Fields(r.Snippet), " ")
+			b.WriteString(renderHighlights(snippet, subtleStyle, matchStyle))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	hint := "(Type to search, ↑/↓ to choose, Enter to jump, Esc to close)"
+	if len(v.results) > 0 {
+		hint = fmt.Sprintf("%d found  %s", len(v.results), hint)
+	}
+	b.WriteString(subtleStyle.Italic(true).Render(hint))
+
+	return lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(t.Primary).
+		Padding(0, 1).
+		Width(width).
+		Render(b.String())
+}
+
+// breadcrumb shows the project and parent chain a result lives under
+func (v SearchView) breadcrumb(r db.SearchResult) string {
+	var parts []string
+	if r.Task.ProjectID != nil {
+		if p, ok := v.projects[*r.Task.ProjectID]; ok {
+			parts = append(parts, p.Name)
+		}
+	}
+	for _, a := range r.Ancestors {
+		parts = append(parts, a.Title)
+	}
+	if r.Task.Status == model.StatusArchived {
+		parts = append(parts, "archived")
+	}
+	return strings.Join(parts, " › ")
+}
+
+func searchStatusIcon(status model.Status) string {
+	switch status {
+	case model.StatusDone:
+		return "✓"
+	case model.StatusInProgress:
+		return "◐"
+	case model.StatusArchived:
+		return "▪"
+	default:
+		return "○"
+	}
+}
+
+// renderHighlights styles the text between search marks and strips the
+// marks, which are control characters and must not reach the terminal
+func renderHighlights(text string, normal, match lipgloss.Style) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(text, db.SearchMarkStart)
+		if start < 0 {
+			break
+		}
+		end := strings.Index(text[start:], db.SearchMarkEnd)
+		if end < 0 {
+			break
+		}
+		end += start
+		b.WriteString(normal.Render(text[:start]))
+		b.WriteString(match.Render(text[start+len(db.SearchMarkStart) : end]))
+		text = text[end+len(db.SearchMarkEnd):]
+	}
+	text = strings.NewReplacer(db.SearchMarkStart, "", db.SearchMarkEnd, "").Replace(text)
+	b.WriteString(normal.Render(text))
+	return b.String()
+}
@@ -8,6 +8,7 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/dori/klonch/internal/db"
+	"github.com/dori/klonch/internal/model"
 	"github.com/dori/klonch/internal/ui/theme"
 )
 
@@ -32,6 +33,9 @@ type StatsView struct {
 	// Selected time period
 	period TimePeriod
 
+	// Whether the Flow page is showing instead of the overview
+	showFlow bool
+
 	// Stats data
 	tasksCompleted   int
 	tasksCreated     int
@@ -50,6 +54,12 @@ type StatsView struct {
 	currentStreak int
 	longestStreak int
 
+	// Estimates against tracked time for tasks finished in the period
+	estimates db.EstimateAccuracy
+
+	// Lead and cycle times, throughput and cumulative flow
+	flow db.FlowMetrics
+
 	// Status message
 	statusMsg string
 }
@@ -90,22 +100,22 @@ func (v StatsView) loadStats() tea.Cmd {
 			startDate = now.AddDate(-1, 0, 0)
 		}
 
-		startDateStr := startDate.Format("2006-01-02")
+		since := db.Timestamp(model.StartOfDay(startDate))
 
 		// Count completed tasks
 		var completed int
 		row := v.db.QueryRow(`
 			SELECT COUNT(*) FROM tasks
-			WHERE status = 'done' AND completed_at >= ?
-		`, startDateStr)
+			WHERE status = 'done' AND julianday(completed_at) >= julianday(?)
+		`, since)
 		row.Scan(&completed)
 
 		// Count created tasks
 		var created int
 		row = v.db.QueryRow(`
 			SELECT COUNT(*) FROM tasks
-			WHERE created_at >= ?
-		`, startDateStr)
+			WHERE julianday(created_at) >= julianday(?)
+		`, since)
 		row.Scan(&created)
 
 		// Count pending tasks
@@ -120,16 +130,16 @@ func (v StatsView) loadStats() tea.Cmd {
 		var pomodoros int
 		row = v.db.QueryRow(`
 			SELECT COUNT(*) FROM time_entries
-			WHERE is_pomodoro = 1 AND started_at >= ?
-		`, startDateStr)
+			WHERE is_pomodoro = 1 AND julianday(started_at) >= julianday(?)
+		`, since)
 		row.Scan(&pomodoros)
 
 		// Total time tracked
 		var totalMins int
 		row = v.db.QueryRow(`
 			SELECT COALESCE(SUM(duration), 0) FROM time_entries
-			WHERE started_at >= ?
-		`, startDateStr)
+			WHERE julianday(started_at) >= julianday(?)
+		`, since)
 		row.Scan(&totalMins)
 
 		// Calculate average per day
@@ -146,10 +156,10 @@ func (v StatsView) loadStats() tea.Cmd {
 			FROM time_entries te
 			LEFT JOIN tasks t ON te.task_id = t.id
 			LEFT JOIN projects p ON t.project_id = p.id
-			WHERE te.started_at >= ?
+			WHERE julianday(te.started_at) >= julianday(?)
 			GROUP BY p.name
 			ORDER BY SUM(te.duration) DESC
-		`, startDateStr)
+		`, since)
 		if err == nil {
 			defer rows.Close()
 			for rows.Next() {
@@ -165,15 +175,14 @@ func (v StatsView) loadStats() tea.Cmd {
 		dailyCompletions := make([]int, 7)
 		for i := 6; i >= 0; i-- {
 			day := now.AddDate(0, 0, -i)
-			dayStart := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+			dayStart := model.StartOfDay(day)
 			dayEnd := dayStart.AddDate(0, 0, 1)
 
 			var count int
 			row = v.db.QueryRow(`
 				SELECT COUNT(*) FROM tasks
-				WHERE status = 'done'
-				AND completed_at >= ? AND completed_at < ?
-			`, dayStart.Format("2006-01-02"), dayEnd.Format("2006-01-02"))
+				WHERE status = 'done' AND `+db.InRange("completed_at")+`
+			`, db.Timestamp(dayStart), db.Timestamp(dayEnd))
 			row.Scan(&count)
 			dailyCompletions[6-i] = count
 		}
@@ -185,15 +194,14 @@ func (v StatsView) loadStats() tea.Cmd {
 
 		for i := 0; i < 30; i++ {
 			day := now.AddDate(0, 0, -i)
-			dayStart := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+			dayStart := model.StartOfDay(day)
 			dayEnd := dayStart.AddDate(0, 0, 1)
 
 			var count int
 			row = v.db.QueryRow(`
 				SELECT COUNT(*) FROM tasks
-				WHERE status = 'done'
-				AND completed_at >= ? AND completed_at < ?
-			`, dayStart.Format("2006-01-02"), dayEnd.Format("2006-01-02"))
+				WHERE status = 'done' AND `+db.InRange("completed_at")+`
+			`, db.Timestamp(dayStart), db.Timestamp(dayEnd))
 			row.Scan(&count)
 
 			if count > 0 {
@@ -212,7 +220,12 @@ func (v StatsView) loadStats() tea.Cmd {
 			}
 		}
 
+		estimates, _ := v.db.GetEstimateAccuracy(startDate)
+		flow, _ := v.db.GetFlowMetrics(model.StartOfDay(startDate), now)
+
 		return statsLoadedMsg{
+			estimates:        estimates,
+			flow:             flow,
 			completed:        completed,
 			created:          created,
 			pending:          pending,
@@ -228,6 +241,8 @@ func (v StatsView) loadStats() tea.Cmd {
 }
 
 type statsLoadedMsg struct {
+	estimates        db.EstimateAccuracy
+	flow             db.FlowMetrics
 	completed        int
 	created          int
 	pending          int
@@ -254,6 +269,8 @@ func (v StatsView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		v.dailyCompletions = msg.dailyCompletions
 		v.currentStreak = msg.currentStreak
 		v.longestStreak = msg.longestStreak
+		v.estimates = msg.estimates
+		v.flow = msg.flow
 		return v, nil
 
 	case taskUpdatedMsg:
@@ -272,6 +289,9 @@ func (v StatsView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return v, v.loadStats()
 		case "r":
 			return v, v.loadStats()
+		case "tab":
+			v.showFlow = !v.showFlow
+			return v, nil
 		}
 	}
 
@@ -292,6 +312,23 @@ func (v StatsView) View() string {
 	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(t.Primary)
 	periodLabels := []string{"Week", "Month", "Year"}
 	periodStr := periodLabels[v.period]
+	hintStyle := lipgloss.NewStyle().Foreground(t.Subtle)
+	if v.showFlow {
+		sections = append(sections, titleStyle.Render(fmt.Sprintf("Flow ─ %s", periodStr)))
+		sections = append(sections, "")
+		chartHeight := v.height - flowHeight - 4
+		if chartHeight > 12 {
+			chartHeight = 12
+		}
+		if chartHeight < 4 {
+			chartHeight = 4
+		}
+		sections = append(sections, v.renderFlow(chartHeight))
+		sections = append(sections, "")
+		sections = append(sections, hintStyle.Render("w: week • m: month • y: year • r: refresh • tab: overview"))
+		return strings.Join(sections, "\n")
+	}
+
 	sections = append(sections, titleStyle.Render(fmt.Sprintf("Statistics ─ %s", periodStr)))
 	sections = append(sections, "")
 
@@ -342,9 +379,15 @@ func (v StatsView) View() string {
 		sections = append(sections, projectSection)
 	}
 
+	// Estimate accuracy
+	if v.estimates.Tasks > 0 && v.estimates.Estimated > 0 {
+		sections = append(sections, v.renderEstimates())
+		sections = append(sections, "")
+	}
+
 	// Footer hints
-	hints := lipgloss.NewStyle().Foreground(t.Subtle).Render(
-		"w: week • m: month • y: year • r: refresh",
+	hints := hintStyle.Render(
+		"w: week • m: month • y: year • r: refresh • tab: flow",
 	)
 	sections = append(sections, hints)
 
@@ -473,6 +516,43 @@ func (v StatsView) renderProjectTime() string {
 	return strings.Join(lines, "\n")
 }
 
+// renderEstimates compares estimates with the time tracked on finished tasks
+func (v StatsView) renderEstimates() string {
+	t := theme.Current.Theme
+	e := v.estimates
+
+	headerStyle := lipgloss.NewStyle().Bold(true).Foreground(t.Secondary)
+
+	var lines []string
+	lines = append(lines, headerStyle.Render("Estimates vs Actual"))
+
+	ratio := float64(e.Actual) / float64(e.Estimated)
+	ratioStyle := lipgloss.NewStyle().Bold(true).Foreground(t.Success)
+	var verdict string
+	switch {
+	case ratio > 1.25:
+		ratioStyle = ratioStyle.Foreground(t.Error)
+		verdict = "tasks take longer than estimated"
+	case ratio < 0.8:
+		ratioStyle = ratioStyle.Foreground(t.Warning)
+		verdict = "tasks take less time than estimated"
+	default:
+		verdict = "estimates are on target"
+	}
+
+	tasksWord := "tasks"
+	if e.Tasks == 1 {
+		tasksWord = "task"
+	}
+	lines = append(lines, fmt.Sprintf("%d %s: %s estimated, %s tracked (%s) — %s",
+		e.Tasks, tasksWord, model.FormatEstimate(e.Estimated), model.FormatEstimate(e.Actual),
+		ratioStyle.Render(fmt.Sprintf("%.0f%%", ratio*100)), verdict))
+	lines = append(lines, lipgloss.NewStyle().Foreground(t.Subtle).Render(
+		fmt.Sprintf("%d of %d ran over their estimate", e.Over, e.Tasks)))
+
+	return strings.Join(lines, "\n")
+}
+
 // IsInputMode returns whether the view is in input mode
 func (v StatsView) IsInputMode() bool {
 	return false
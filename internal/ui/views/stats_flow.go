@@ -0,0 +1,254 @@
+package views
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/dori/klonch/internal/db"
+	"github.com/dori/klonch/internal/model"
+	"github.com/dori/klonch/internal/ui/theme"
+)
+
+// The Flow page of Stats shows how tasks move through the Kanban columns,
+// from the status transitions recorded for every change.
+
+// flowColor is the color a status is drawn in on the cumulative flow
+func flowColor(status model.Status) lipgloss.Color {
+	t := theme.Current.Theme
+	switch status {
+	case model.StatusBacklog:
+		return t.Subtle
+	case model.StatusPending:
+		return t.StatusPending
+	case model.StatusInProgress:
+		return t.StatusInProgress
+	}
+	return t.StatusDone
+}
+
+// renderFlow renders lead and cycle times, time in each column, weekly
+// throughput and the cumulative flow, the chart taking the given height
+func (v StatsView) renderFlow(chartHeight int) string {
+	t := theme.Current.Theme
+	headerStyle := lipgloss.NewStyle().Bold(true).Foreground(t.Secondary)
+	labelStyle := lipgloss.NewStyle().Foreground(t.Subtle)
+	m := v.flow
+
+	var lines []string
+	lines = append(lines, headerStyle.Render("Lead and Cycle Time"))
+	lines = append(lines, fmt.Sprintf("%s %s", labelStyle.Render(fmt.Sprintf("%-13s", "Lead time")), formatDurationStats(m.LeadTime)))
+	lines = append(lines, fmt.Sprintf("%s %s", labelStyle.Render(fmt.Sprintf("%-13s", "Cycle time")), formatDurationStats(m.CycleTime)))
+	lines = append(lines, labelStyle.Render("Lead time runs from creation to done, cycle time from first started to done"))
+	lines = append(lines, "")
+
+	// Every board's columns, the stays in columns of the same name added
+	// up; done columns are where tasks end up rather than a wait. The rows
+	// are fixed so the chart below keeps its height.
+	lines = append(lines, headerStyle.Render("Time in Column"))
+	var waits []db.ColumnTime
+	for _, c := range m.TimeInColumn {
+		if c.Category != model.CategoryDone {
+			waits = append(waits, c)
+		}
+	}
+	for i := 0; i < flowColumnRows; i++ {
+		switch {
+		case i < len(waits) && i == flowColumnRows-1 && len(waits) > flowColumnRows:
+			lines = append(lines, labelStyle.Render(fmt.Sprintf("%-13s and %d more", "", len(waits)-i)))
+		case i < len(waits):
+			name := []rune(waits[i].Name)
+			if len(name) > 13 {
+				name = append(name[:12], '…')
+			}
+			styled := lipgloss.NewStyle().Foreground(flowColor(waits[i].Category.Status())).Render(fmt.Sprintf("%-13s", string(name)))
+			lines = append(lines, fmt.Sprintf("%s %s", styled, formatDurationStats(waits[i].DurationStats)))
+		case i == 0:
+			lines = append(lines, formatDurationStats(db.DurationStats{}))
+		default:
+			lines = append(lines, "")
+		}
+	}
+	lines = append(lines, "")
+
+	lines = append(lines, headerStyle.Render("Throughput per Week"))
+	lines = append(lines, v.renderThroughput())
+	lines = append(lines, "")
+
+	lines = append(lines, headerStyle.Render("Cumulative Flow"))
+	lines = append(lines, v.renderCumulativeFlow(chartHeight))
+
+	return strings.Join(lines, "\n")
+}
+
+// flowHeight is the number of lines renderFlow takes besides the chart,
+// flowColumnRows of them for the time in each column
+const (
+	flowColumnRows = 4
+	flowHeight     = 19
+)
+
+// formatDurationStats writes the median and mean of a set of durations
+func formatDurationStats(s db.DurationStats) string {
+	t := theme.Current.Theme
+	if s.Count == 0 {
+		return lipgloss.NewStyle().Foreground(t.Subtle).Italic(true).Render("no data yet")
+	}
+	value := lipgloss.NewStyle().Bold(true).Foreground(t.Primary)
+	tasks := "tasks"
+	if s.Count == 1 {
+		tasks = "task"
+	}
+	return fmt.Sprintf("%s median, %s mean %s",
+		value.Render(formatSpan(s.Median)), value.Render(formatSpan(s.Mean)),
+		lipgloss.NewStyle().Foreground(t.Subtle).Render(fmt.Sprintf("(%d %s)", s.Count, tasks)))
+}
+
+// formatSpan writes a duration in days and hours, or hours and minutes
+// when under a day
+func formatSpan(d time.Duration) string {
+	if d < 24*time.Hour {
+		return model.FormatEstimate(int(d.Minutes()))
+	}
+	days, hours := int(d/(24*time.Hour)), int(d%(24*time.Hour)/time.Hour)
+	if hours == 0 {
+		return fmt.Sprintf("%dd", days)
+	}
+	return fmt.Sprintf("%dd%dh", days, hours)
+}
+
+// renderThroughput renders tasks finished per week as a sparkline
+func (v StatsView) renderThroughput() string {
+	t := theme.Current.Theme
+	weeks := v.flow.Throughput
+	if len(weeks) == 0 {
+		return ""
+	}
+
+	maxCount, total := 0, 0
+	for _, w := range weeks {
+		total += w.Count
+		if w.Count > maxCount {
+			maxCount = w.Count
+		}
+	}
+
+	// Keep the latest weeks when they don't all fit
+	if room := v.width - 2; len(weeks) > room && room > 0 {
+		weeks = weeks[len(weeks)-room:]
+	}
+	bars := []rune("▁▂▃▄▅▆▇█")
+	var spark strings.Builder
+	for _, w := range weeks {
+		level := 0
+		if maxCount > 0 {
+			level = w.Count * (len(bars) - 1) / maxCount
+		}
+		spark.WriteRune(bars[level])
+	}
+
+	weeksWord := "weeks"
+	if len(v.flow.Throughput) == 1 {
+		weeksWord = "week"
+	}
+	summary := fmt.Sprintf("%d finished over %d %s, %.1f a week, %d at most",
+		total, len(v.flow.Throughput), weeksWord, float64(total)/float64(len(v.flow.Throughput)), maxCount)
+	return lipgloss.NewStyle().Foreground(t.Success).Render(spark.String()) + "\n" +
+		lipgloss.NewStyle().Foreground(t.Subtle).Render(summary)
+}
+
+// renderCumulativeFlow draws the tasks in each column day by day as
+// stacked bands, Done at the bottom, squeezing the days to fit the width
+func (v StatsView) renderCumulativeFlow(height int) string {
+	t := theme.Current.Theme
+	days := v.flow.Flow
+	if len(days) == 0 {
+		return ""
+	}
+
+	maxTotal := 0
+	for _, d := range days {
+		total := 0
+		for _, status := range db.FlowStatuses {
+			total += d.Counts[status]
+		}
+		if total > maxTotal {
+			maxTotal = total
+		}
+	}
+	if maxTotal == 0 {
+		return lipgloss.NewStyle().Foreground(t.Subtle).Italic(true).Render("No tasks on the board yet")
+	}
+
+	axisWidth := len(fmt.Sprint(maxTotal)) + 1
+	room := v.width - axisWidth - 2
+	if room < 1 {
+		room = 1
+	}
+
+	// One column per day where they fit, stretched when there's room to
+	// spare, or the last day of each stretch of days when they don't
+	columns := len(days)
+	if columns > room {
+		columns = room
+	}
+	cellWidth := room / columns
+	if cellWidth > 6 {
+		cellWidth = 6
+	}
+	dayAt := func(col int) db.FlowDay {
+		return days[(col+1)*len(days)/columns-1]
+	}
+
+	axis := lipgloss.NewStyle().Foreground(t.Subtle)
+	var lines []string
+	for row := height; row >= 1; row-- {
+		// The middle of the row, in tasks
+		level := (float64(row) - 0.5) / float64(height) * float64(maxTotal)
+		label := ""
+		switch row {
+		case height:
+			label = fmt.Sprint(maxTotal)
+		case 1:
+			label = "0"
+		}
+		var line strings.Builder
+		line.WriteString(axis.Render(fmt.Sprintf("%*s│", axisWidth, label)))
+		for col := 0; col < columns; col++ {
+			counts := dayAt(col).Counts
+			cell := strings.Repeat(" ", cellWidth)
+			stacked := 0
+			for i := len(db.FlowStatuses) - 1; i >= 0; i-- {
+				status := db.FlowStatuses[i]
+				stacked += counts[status]
+				if level < float64(stacked) {
+					cell = lipgloss.NewStyle().Foreground(flowColor(status)).Render(strings.Repeat("█", cellWidth))
+					break
+				}
+			}
+			line.WriteString(cell)
+		}
+		lines = append(lines, line.String())
+	}
+
+	// Dates at either end of the axis
+	first, last := days[0].Day.Format("Jan 2"), days[len(days)-1].Day.Format("Jan 2")
+	if days[0].Day.Year() != days[len(days)-1].Day.Year() {
+		first, last = days[0].Day.Format("Jan 2 2006"), days[len(days)-1].Day.Format("Jan 2 2006")
+	}
+	gap := columns*cellWidth - len(first) - len(last)
+	if gap < 1 {
+		gap = 1
+	}
+	lines = append(lines, axis.Render(strings.Repeat(" ", axisWidth)+"└"+strings.Repeat("─", columns*cellWidth)))
+	lines = append(lines, axis.Render(strings.Repeat(" ", axisWidth+1)+first+strings.Repeat(" ", gap)+last))
+
+	var legend []string
+	for _, status := range db.FlowStatuses {
+		legend = append(legend, lipgloss.NewStyle().Foreground(flowColor(status)).Render("█ "+model.DefaultStateName(status)))
+	}
+	lines = append(lines, strings.Repeat(" ", axisWidth+1)+strings.Join(legend, "  "))
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,331 @@
+package views
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/dori/klonch/internal/db"
+	"github.com/dori/klonch/internal/idle"
+	"github.com/dori/klonch/internal/model"
+	"github.com/dori/klonch/internal/parse"
+	"github.com/dori/klonch/internal/ui/theme"
+)
+
+// RunningTimerMsg carries the timer running in the database, if any. The
+// root model sends it to every view that runs timers, so they all follow
+// the one timer whichever view started it.
+type RunningTimerMsg struct {
+	Entry    *model.TimeEntry // nil when no timer runs
+	Task     *model.Task      // The entry's task, if it has one
+	Length   time.Duration    // Work session length, for Pomodoro entries
+	Restored bool             // Found running when klonch started
+	Err      error
+}
+
+// TimerChangedMsg is sent after a view starts, stops or pauses a timer
+type TimerChangedMsg struct{}
+
+// LoadRunningTimer reads the running timer in the background
+func LoadRunningTimer(database *db.DB, restored bool) tea.Cmd {
+	return func() tea.Msg {
+		msg := RunningTimerMsg{Restored: restored}
+		msg.Entry, msg.Err = database.RunningTimer()
+		if msg.Entry == nil {
+			return msg
+		}
+		if msg.Entry.TaskID != "" {
+			msg.Task, _ = database.GetTask(msg.Entry.TaskID)
+		}
+		if msg.Entry.IsPomodoro {
+			cfg, _ := database.PomodoroConfig()
+			msg.Length = cfg.Work
+		}
+		return msg
+	}
+}
+
+func timerChanged() tea.Msg {
+	return TimerChangedMsg{}
+}
+
+// FormatTimer shows a timer's reading as h:mm:ss
+func FormatTimer(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	s := int(d.Seconds())
+	return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+}
+
+// TimerPromptClosedMsg is sent when the running timer prompt is dismissed.
+// Resume means the timer was left running.
+type TimerPromptClosedMsg struct {
+	Resume bool
+	Task   *model.Task
+	Status string
+	Err    error
+}
+
+// TimerPrompt asks what to do with a timer that was still running when
+// klonch started, which usually means klonch quit or crashed without
+// stopping it
+type TimerPrompt struct {
+	db    *db.DB
+	width int
+
+	entry *model.TimeEntry
+	task  *model.Task
+
+	// Asking when the timer should have stopped
+	askingEnd bool
+	input     textinput.Model
+	err       string
+}
+
+// NewTimerPrompt creates the running timer prompt
+func NewTimerPrompt(database *db.DB) TimerPrompt {
+	ti := textinput.New()
+	ti.Placeholder = "17:30 or 1h30m"
+	ti.Prompt = "Stopped at: "
+	ti.CharLimit = 32
+	return TimerPrompt{db: database, input: ti}
+}
+
+// Open shows the prompt for a running timer
+func (p TimerPrompt) Open(entry *model.TimeEntry, task *model.Task) TimerPrompt {
+	p.entry = entry
+	p.task = task
+	p.askingEnd = false
+	p.err = ""
+	p.input.SetValue("")
+	p.input.Blur()
+	return p
+}
+
+// SetSize sets the prompt width
+func (p TimerPrompt) SetSize(width, height int) TimerPrompt {
+	p.width = width
+	return p
+}
+
+// Update handles messages
+func (p TimerPrompt) Update(msg tea.Msg) (TimerPrompt, tea.Cmd) {
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		if p.askingEnd {
+			var cmd tea.Cmd
+			p.input, cmd = p.input.Update(msg)
+			return p, cmd
+		}
+		return p, nil
+	}
+
+	if p.askingEnd {
+		switch key.String() {
+		case "esc":
+			p.askingEnd = false
+			p.err = ""
+			p.input.Blur()
+			return p, nil
+		case "enter":
+			now := time.Now()
+			end, ok := parse.EndAt(p.input.Value(), p.entry.StartedAt, now)
+			if !ok {
+				p.err = fmt.Sprintf("Enter a time between %s and now, or how long it ran",
+					p.entry.StartedAt.Format("Jan 2 15:04"))
+				return p, nil
+			}
+			return p, p.stop(end)
+		}
+		var cmd tea.Cmd
+		p.input, cmd = p.input.Update(msg)
+		return p, cmd
+	}
+
+	switch key.String() {
+	case "enter", "r", "esc":
+		task := p.task
+		return p, func() tea.Msg { return TimerPromptClosedMsg{Resume: true, Task: task} }
+	case "s":
+		return p, p.stop(time.Now())
+	case "t":
+		p.askingEnd = true
+		p.err = ""
+		return p, p.input.Focus()
+	case "x":
+		database, id := p.db, p.entry.ID
+		return p, func() tea.Msg {
+			if err := database.DiscardTimer(id); err != nil {
+				return TimerPromptClosedMsg{Err: err}
+			}
+			return TimerPromptClosedMsg{Status: "Timer discarded"}
+		}
+	}
+	return p, nil
+}
+
+// stop ends the timer at the given moment
+func (p TimerPrompt) stop(end time.Time) tea.Cmd {
+	database, id := p.db, p.entry.ID
+	return func() tea.Msg {
+		minutes, err := database.StopTimer(id, end)
+		if err != nil {
+			return TimerPromptClosedMsg{Err: err}
+		}
+		return TimerPromptClosedMsg{Status: fmt.Sprintf("Timer stopped at %s: %d minutes logged",
+			end.Format("15:04"), minutes)}
+	}
+}
+
+// View renders the prompt
+func (p TimerPrompt) View() string {
+	t := theme.Current.Theme
+	width := p.width - 4
+	if width < 20 {
+		width = 20
+	}
+
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(t.Warning)
+	subtleStyle := lipgloss.NewStyle().Foreground(t.Subtle)
+
+	what := "A timer"
+	if p.task != nil {
+		what = fmt.Sprintf("The timer for %q", p.task.Title)
+	}
+	started := p.entry.StartedAt.Format("15:04")
+	if !model.SameDay(p.entry.StartedAt, time.Now()) {
+		started = p.entry.StartedAt.Format("Mon Jan 2 15:04")
+	}
+
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Timer still running"))
+	b.WriteString("\n\n")
+	b.WriteString(fmt.Sprintf("%s has been running since %s (%s",
+		what, started, FormatTimer(p.entry.Elapsed(time.Now()))))
+	if p.entry.IsPaused() {
+		b.WriteString(", paused")
+	}
+	b.WriteString(").\nklonch may have quit without stopping it.\n\n")
+
+	if p.askingEnd {
+		b.WriteString(p.input.View())
+		b.WriteString("\n")
+		if p.err != "" {
+			b.WriteString(lipgloss.NewStyle().Foreground(t.Error).Render(p.err))
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+		b.WriteString(subtleStyle.Italic(true).Render("(A time of day, or how long it ran; Enter to stop, Esc to go back)"))
+	} else {
+		b.WriteString(subtleStyle.Italic(true).Render("enter/r resume · s stop now · t stop at… · x discard"))
+	}
+
+	return lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(t.Warning).
+		Padding(0, 1).
+		Width(width).
+		Render(b.String())
+}
+
+// IdlePromptClosedMsg is sent when the idle prompt is answered
+type IdlePromptClosedMsg struct {
+	Status string
+	Err    error
+}
+
+// IdlePrompt asks what to do with time spent away while a timer ran: keep
+// it, discard it, or split it into an entry of its own
+type IdlePrompt struct {
+	db    *db.DB
+	width int
+
+	entry *model.TimeEntry
+	task  *model.Task
+	away  idle.Away
+}
+
+// NewIdlePrompt creates the idle prompt
+func NewIdlePrompt(database *db.DB) IdlePrompt {
+	return IdlePrompt{db: database}
+}
+
+// Open shows the prompt for time away from a running timer
+func (p IdlePrompt) Open(entry *model.TimeEntry, task *model.Task, away idle.Away) IdlePrompt {
+	p.entry = entry
+	p.task = task
+	p.away = away
+	return p
+}
+
+// SetSize sets the prompt width
+func (p IdlePrompt) SetSize(width, height int) IdlePrompt {
+	p.width = width
+	return p
+}
+
+// Update handles messages
+func (p IdlePrompt) Update(msg tea.Msg) (IdlePrompt, tea.Cmd) {
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return p, nil
+	}
+
+	database, id, away := p.db, p.entry.ID, p.away
+	length := model.FormatEstimate(int(away.Duration().Minutes()))
+	switch key.String() {
+	case "enter", "k", "esc":
+		return p, func() tea.Msg { return IdlePromptClosedMsg{Status: "Kept " + length + " away"} }
+	case "d":
+		return p, func() tea.Msg {
+			if err := database.DiscardIdle(id, away.From, away.To); err != nil {
+				return IdlePromptClosedMsg{Err: err}
+			}
+			return IdlePromptClosedMsg{Status: "Discarded " + length + " away"}
+		}
+	case "s":
+		return p, func() tea.Msg {
+			if _, err := database.SplitIdle(id, away.From, away.To); err != nil {
+				return IdlePromptClosedMsg{Err: err}
+			}
+			return IdlePromptClosedMsg{Status: "Split off " + length + " away; move or delete it in the timesheet"}
+		}
+	}
+	return p, nil
+}
+
+// View renders the prompt
+func (p IdlePrompt) View() string {
+	t := theme.Current.Theme
+	width := p.width - 4
+	if width < 20 {
+		width = 20
+	}
+
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(t.Warning)
+	subtleStyle := lipgloss.NewStyle().Foreground(t.Subtle)
+
+	what := "a timer"
+	if p.task != nil {
+		what = fmt.Sprintf("the timer for %q", p.task.Title)
+	}
+
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Welcome back"))
+	b.WriteString("\n\n")
+	b.WriteString(fmt.Sprintf("You were away from %s to %s (%s) while %s was running.\n\n",
+		p.away.From.Format("15:04"), p.away.To.Format("15:04"),
+		model.FormatEstimate(int(p.away.Duration().Minutes())), what))
+	b.WriteString(subtleStyle.Italic(true).Render("enter/k keep · d discard · s split into its own entry"))
+
+	return lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(t.Warning).
+		Padding(0, 1).
+		Width(width).
+		Render(b.String())
+}
@@ -0,0 +1,978 @@
+package views
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/dori/klonch/internal/db"
+	"github.com/dori/klonch/internal/model"
+	"github.com/dori/klonch/internal/parse"
+	"github.com/dori/klonch/internal/ui/theme"
+)
+
+// timesheetLoadedMsg carries the entries of the period starting at from
+type timesheetLoadedMsg struct {
+	from     time.Time
+	entries  []db.TimesheetEntry
+	rounding db.Rounding
+	err      error
+}
+
+// timesheetSavedMsg reports a change to an entry. The cursor moves to
+// selectID, and edit opens the editor on it.
+type timesheetSavedMsg struct {
+	status   string
+	selectID string
+	edit     bool
+	timer    bool // The running timer changed
+	err      error
+}
+
+// timesheetSearchMsg carries task picker results for the query that
+// produced them
+type timesheetSearchMsg struct {
+	query   string
+	results []db.SearchResult
+	err     error
+}
+
+// timesheetMode is what the timesheet is asking for
+type timesheetMode int
+
+const (
+	timesheetBrowse timesheetMode = iota
+	timesheetEdit
+	timesheetPickAdd  // Choosing the task for a new entry
+	timesheetPickMove // Choosing the task to move an entry to
+	timesheetSplit
+	timesheetConfirmDelete
+)
+
+// Editor fields
+const (
+	editStart = iota
+	editEnd
+	editDuration
+	editDescription
+)
+
+// TimesheetView lists time entries by day or week with totals by project
+// and task, and edits them
+type TimesheetView struct {
+	db     *db.DB
+	width  int
+	height int
+
+	// The period shown: the day of anchor, or its week starting on Monday
+	anchor time.Time
+	week   bool
+
+	entries  []db.TimesheetEntry
+	overlaps map[string]bool
+	rounding db.Rounding
+	cursor   int
+	totals   bool // Showing totals instead of entries
+
+	mode timesheetMode
+
+	// Entry editor
+	inputs   []textinput.Model
+	field    int
+	editing  db.TimesheetEntry
+	duration string // Duration as first shown, to tell whether it was changed
+
+	// Entry to move the cursor to once loaded, and whether to edit it
+	selectID string
+	editNext bool
+
+	// Task picker
+	query   textinput.Model
+	results []db.SearchResult
+	picked  int
+
+	// Split prompt
+	splitInput textinput.Model
+
+	statusMsg string
+	errMsg    string
+}
+
+// NewTimesheetView creates a new timesheet view
+func NewTimesheetView(database *db.DB) TimesheetView {
+	labels := []string{"Start:       ", "End:         ", "Duration:    ", "Description: "}
+	placeholders := []string{"9:00", "17:30", "1h30m", "What was done"}
+	inputs := make([]textinput.Model, len(labels))
+	for i := range inputs {
+		inputs[i] = textinput.New()
+		inputs[i].Prompt = labels[i]
+		inputs[i].Placeholder = placeholders[i]
+		inputs[i].CharLimit = 32
+	}
+	inputs[editDescription].CharLimit = 256
+
+	query := textinput.New()
+	query.Prompt = "Task: "
+	query.Placeholder = "Search tasks..."
+	query.CharLimit = 256
+
+	split := textinput.New()
+	split.Prompt = "Split at: "
+	split.Placeholder = "12:00"
+	split.CharLimit = 32
+
+	return TimesheetView{
+		db:         database,
+		anchor:     model.StartOfDay(time.Now()),
+		week:       true,
+		inputs:     inputs,
+		query:      query,
+		splitInput: split,
+	}
+}
+
+// Init initializes the timesheet view
+func (v TimesheetView) Init() tea.Cmd {
+	return v.load()
+}
+
+// SetSize sets the view dimensions
+func (v TimesheetView) SetSize(width, height int) TimesheetView {
+	v.width = width
+	v.height = height
+	for i := range v.inputs {
+		v.inputs[i].Width = width - 24
+	}
+	v.query.Width = width - 16
+	return v
+}
+
+// IsInputMode returns whether the view is capturing text input
+func (v TimesheetView) IsInputMode() bool {
+	return v.mode != timesheetBrowse
+}
+
+// period returns the start and end of the period shown
+func (v TimesheetView) period() (from, to time.Time) {
+	from = model.StartOfDay(v.anchor)
+	if !v.week {
+		return from, from.AddDate(0, 0, 1)
+	}
+	from = from.AddDate(0, 0, -((int(from.Weekday()) + 6) % 7))
+	return from, from.AddDate(0, 0, 7)
+}
+
+// load reads the period's entries in the background
+func (v TimesheetView) load() tea.Cmd {
+	database := v.db
+	from, to := v.period()
+	return func() tea.Msg {
+		entries, err := database.GetTimesheet(from, to)
+		if err != nil {
+			return timesheetLoadedMsg{from: from, err: err}
+		}
+		rounding, err := database.TimesheetRounding()
+		return timesheetLoadedMsg{from: from, entries: entries, rounding: rounding, err: err}
+	}
+}
+
+// current returns the entry under the cursor
+func (v TimesheetView) current() *db.TimesheetEntry {
+	if v.cursor < 0 || v.cursor >= len(v.entries) {
+		return nil
+	}
+	return &v.entries[v.cursor]
+}
+
+// Update handles messages
+func (v TimesheetView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case timesheetLoadedMsg:
+		if from, _ := v.period(); !msg.from.Equal(from) {
+			return v, nil // The user has moved on to another period
+		}
+		if msg.err != nil {
+			v.errMsg = msg.err.Error()
+			return v, nil
+		}
+		selected := v.selectID
+		if e := v.current(); selected == "" && e != nil {
+			selected = e.ID
+		}
+		v.entries = msg.entries
+		v.rounding = msg.rounding
+		entries := make([]*model.TimeEntry, len(v.entries))
+		for i := range v.entries {
+			entries[i] = &v.entries[i].TimeEntry
+		}
+		v.overlaps = model.Overlapping(entries, time.Now())
+		v.selectEntry(selected)
+
+		edit := v.editNext
+		v.selectID, v.editNext = "", false
+		if e := v.current(); edit && e != nil && e.ID == selected {
+			return v.openEditor()
+		}
+		return v, nil
+
+	case timesheetSavedMsg:
+		if msg.err != nil {
+			v.errMsg = msg.err.Error()
+			return v, v.load()
+		}
+		v.statusMsg = msg.status
+		v.selectID, v.editNext = msg.selectID, msg.edit
+		cmds := []tea.Cmd{v.load()}
+		if msg.timer {
+			cmds = append(cmds, timerChanged)
+		}
+		return v, tea.Batch(cmds...)
+
+	case timesheetSearchMsg:
+		if msg.query != v.query.Value() {
+			return v, nil
+		}
+		v.results = msg.results
+		v.picked = 0
+		if msg.err != nil {
+			v.errMsg = msg.err.Error()
+		}
+		return v, nil
+
+	case tea.KeyMsg:
+		v.statusMsg = ""
+		v.errMsg = ""
+		switch v.mode {
+		case timesheetEdit:
+			return v.updateEditor(msg)
+		case timesheetPickAdd, timesheetPickMove:
+			return v.updatePicker(msg)
+		case timesheetSplit:
+			return v.updateSplit(msg)
+		case timesheetConfirmDelete:
+			return v.updateConfirmDelete(msg)
+		}
+		return v.updateBrowse(msg)
+	}
+
+	cmd := v.updateInput(msg)
+	return v, cmd
+}
+
+// updateInput passes cursor blinks to the focused input
+func (v *TimesheetView) updateInput(msg tea.Msg) tea.Cmd {
+	var cmd tea.Cmd
+	switch v.mode {
+	case timesheetEdit:
+		v.inputs[v.field], cmd = v.inputs[v.field].Update(msg)
+	case timesheetPickAdd, timesheetPickMove:
+		v.query, cmd = v.query.Update(msg)
+	case timesheetSplit:
+		v.splitInput, cmd = v.splitInput.Update(msg)
+	}
+	return cmd
+}
+
+// selectEntry moves the cursor to an entry, or keeps it in range if the
+// entry isn't shown
+func (v *TimesheetView) selectEntry(id string) {
+	for i, e := range v.entries {
+		if e.ID == id {
+			v.cursor = i
+			return
+		}
+	}
+	if v.cursor >= len(v.entries) {
+		v.cursor = len(v.entries) - 1
+	}
+	if v.cursor < 0 {
+		v.cursor = 0
+	}
+}
+
+// updateBrowse handles keys while moving around the timesheet
+func (v TimesheetView) updateBrowse(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "j", "down":
+		if v.cursor < len(v.entries)-1 {
+			v.cursor++
+		}
+	case "k", "up":
+		if v.cursor > 0 {
+			v.cursor--
+		}
+	case "g", "home":
+		v.cursor = 0
+	case "G", "end":
+		if len(v.entries) > 0 {
+			v.cursor = len(v.entries) - 1
+		}
+	case "h", "left":
+		return v.shift(-1)
+	case "l", "right":
+		return v.shift(1)
+	case "t":
+		v.anchor = model.StartOfDay(time.Now())
+		v.cursor = 0
+		return v, v.load()
+	case "w":
+		v.week = !v.week
+		v.cursor = 0
+		return v, v.load()
+	case "tab":
+		v.totals = !v.totals
+	case "r":
+		return v, v.load()
+	case "e", "enter":
+		if v.current() != nil && !v.totals {
+			return v.openEditor()
+		}
+	case "a":
+		return v.openPicker(timesheetPickAdd)
+	case "m":
+		if v.current() != nil && !v.totals {
+			return v.openPicker(timesheetPickMove)
+		}
+	case "s":
+		e := v.current()
+		if e == nil || v.totals {
+			return v, nil
+		}
+		if e.IsRunning() {
+			v.errMsg = "Stop the timer before splitting its entry"
+			return v, nil
+		}
+		middle := e.StartedAt.Add(e.EndedAt.Sub(e.StartedAt) / 2)
+		v.splitInput.SetValue(middle.Format("15:04"))
+		v.splitInput.CursorEnd()
+		v.mode = timesheetSplit
+		return v, v.splitInput.Focus()
+	case "d", "x":
+		if v.current() != nil && !v.totals {
+			v.mode = timesheetConfirmDelete
+		}
+	}
+	return v, nil
+}
+
+// shift moves to the previous or next day or week
+func (v TimesheetView) shift(n int) (tea.Model, tea.Cmd) {
+	if v.week {
+		n *= 7
+	}
+	v.anchor = v.anchor.AddDate(0, 0, n)
+	v.cursor = 0
+	return v, v.load()
+}
+
+// openEditor starts editing the entry under the cursor
+func (v TimesheetView) openEditor() (tea.Model, tea.Cmd) {
+	e := v.current()
+	if e == nil {
+		return v, nil
+	}
+	v.editing = *e
+	v.duration = model.FormatEstimate(e.CalculatedDuration())
+
+	v.inputs[editStart].SetValue(e.StartedAt.Format("15:04"))
+	v.inputs[editEnd].SetValue("")
+	v.inputs[editDuration].SetValue("")
+	if !e.IsRunning() {
+		v.inputs[editEnd].SetValue(e.EndedAt.Format("15:04"))
+		v.inputs[editDuration].SetValue(v.duration)
+	}
+	v.inputs[editDescription].SetValue(e.Description)
+	for i := range v.inputs {
+		v.inputs[i].CursorEnd()
+		v.inputs[i].Blur()
+	}
+
+	v.mode = timesheetEdit
+	v.field = editStart
+	return v, v.inputs[v.field].Focus()
+}
+
+// editFields are the editor fields in tab order. A running entry has no end
+// or duration yet.
+func (v TimesheetView) editFields() []int {
+	if v.editing.IsRunning() {
+		return []int{editStart, editDescription}
+	}
+	return []int{editStart, editEnd, editDuration, editDescription}
+}
+
+// updateEditor handles keys in the entry editor
+func (v TimesheetView) updateEditor(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		v.mode = timesheetBrowse
+		v.inputs[v.field].Blur()
+		return v, nil
+	case "enter":
+		return v.saveEdit()
+	case "tab", "down", "shift+tab", "up":
+		fields := v.editFields()
+		step := 1
+		if s := msg.String(); s == "shift+tab" || s == "up" {
+			step = len(fields) - 1
+		}
+		for i, f := range fields {
+			if f == v.field {
+				v.inputs[v.field].Blur()
+				v.field = fields[(i+step)%len(fields)]
+				break
+			}
+		}
+		return v, v.inputs[v.field].Focus()
+	}
+	var cmd tea.Cmd
+	v.inputs[v.field], cmd = v.inputs[v.field].Update(msg)
+	return v, cmd
+}
+
+// saveEdit checks the editor's fields and saves the entry. A changed
+// duration wins over the end and moves it.
+func (v TimesheetView) saveEdit() (tea.Model, tea.Cmd) {
+	e := v.editing
+	start, ok := entryTime(v.inputs[editStart].Value(), e.StartedAt)
+	if !ok {
+		v.errMsg = "Start: enter a time such as 9:30, or a date and time"
+		return v, nil
+	}
+
+	var end *time.Time
+	if !e.IsRunning() {
+		t, ok := entryTime(v.inputs[editEnd].Value(), start)
+		if !ok {
+			v.errMsg = "End: enter a time such as 17:30, or a date and time"
+			return v, nil
+		}
+		if t.Before(start) && model.SameDay(t, start) {
+			t = t.AddDate(0, 0, 1) // Ran past midnight
+		}
+		if d := strings.TrimSpace(v.inputs[editDuration].Value()); d != v.duration {
+			minutes, err := model.ParseEstimate(d)
+			if err != nil {
+				v.errMsg = "Duration: " + err.Error()
+				return v, nil
+			}
+			t = start.Add(time.Duration(minutes) * time.Minute)
+		}
+		end = &t
+	}
+
+	description := strings.TrimSpace(v.inputs[editDescription].Value())
+	v.mode = timesheetBrowse
+	v.inputs[v.field].Blur()
+
+	database, id, running := v.db, e.ID, e.IsRunning()
+	return v, func() tea.Msg {
+		err := database.UpdateTimeEntry(id, start, end, description)
+		return timesheetSavedMsg{status: "Time entry saved", selectID: id, timer: running, err: err}
+	}
+}
+
+// entryTime reads a time for an entry: a time of day on the given day, or
+// a date and time as parse.Date reads them
+func entryTime(s string, day time.Time) (time.Time, bool) {
+	if hour, min, ok := parse.Clock(s); ok {
+		return time.Date(day.Year(), day.Month(), day.Day(), hour, min, 0, 0, day.Location()), true
+	}
+	return parse.Date(s, time.Now())
+}
+
+// openPicker asks for the task to add an entry to or move one to
+func (v TimesheetView) openPicker(mode timesheetMode) (tea.Model, tea.Cmd) {
+	v.mode = mode
+	v.query.SetValue("")
+	v.results = nil
+	v.picked = 0
+	return v, v.query.Focus()
+}
+
+// updatePicker handles keys in the task picker. Enter without a query
+// means no task.
+func (v TimesheetView) updatePicker(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		v.mode = timesheetBrowse
+		v.query.Blur()
+		return v, nil
+	case "up", "ctrl+p":
+		if v.picked > 0 {
+			v.picked--
+		}
+		return v, nil
+	case "down", "ctrl+n":
+		if v.picked < len(v.results)-1 {
+			v.picked++
+		}
+		return v, nil
+	case "enter":
+		taskID := ""
+		if strings.TrimSpace(v.query.Value()) != "" {
+			if v.picked >= len(v.results) {
+				return v, nil
+			}
+			taskID = v.results[v.picked].Task.ID
+		}
+		mode := v.mode
+		v.mode = timesheetBrowse
+		v.query.Blur()
+		if mode == timesheetPickAdd {
+			return v, v.addEntry(taskID)
+		}
+		database, e := v.db, v.current()
+		id, running := e.ID, e.IsRunning()
+		return v, func() tea.Msg {
+			err := database.MoveTimeEntry(id, taskID)
+			return timesheetSavedMsg{status: "Time entry moved", selectID: id, timer: running, err: err}
+		}
+	}
+
+	before := v.query.Value()
+	var cmd tea.Cmd
+	v.query, cmd = v.query.Update(msg)
+	if query := v.query.Value(); query != before {
+		database := v.db
+		return v, tea.Batch(cmd, func() tea.Msg {
+			results, err := database.SearchTasks(query)
+			return timesheetSearchMsg{query: query, results: results, err: err}
+		})
+	}
+	return v, cmd
+}
+
+// addEntry logs half an hour to a task, ending now when adding to today and
+// at 9:30 on other days, and opens the editor on it
+func (v TimesheetView) addEntry(taskID string) tea.Cmd {
+	day := v.anchor
+	if e := v.current(); e != nil && !v.totals {
+		day = e.StartedAt
+	} else if from, to := v.period(); v.week {
+		day = from
+		if now := time.Now(); !now.Before(from) && now.Before(to) {
+			day = now
+		}
+	}
+
+	end := time.Date(day.Year(), day.Month(), day.Day(), 9, 30, 0, 0, day.Location())
+	if now := time.Now(); model.SameDay(day, now) {
+		end = now.Truncate(time.Minute)
+	}
+
+	database := v.db
+	return func() tea.Msg {
+		id, err := database.AddTimeEntry(taskID, end, 30, "")
+		return timesheetSavedMsg{status: "Time entry added", selectID: id, edit: true, err: err}
+	}
+}
+
+// updateSplit handles keys in the split prompt
+func (v TimesheetView) updateSplit(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		v.mode = timesheetBrowse
+		v.splitInput.Blur()
+		return v, nil
+	case "enter":
+		e := v.current()
+		at, ok := entryTime(v.splitInput.Value(), e.StartedAt)
+		if !ok {
+			v.errMsg = "Enter a time such as 12:00"
+			return v, nil
+		}
+		if at.Before(e.StartedAt) && model.SameDay(at, e.StartedAt) {
+			at = at.AddDate(0, 0, 1)
+		}
+		v.mode = timesheetBrowse
+		v.splitInput.Blur()
+		database, id := v.db, e.ID
+		return v, func() tea.Msg {
+			newID, err := database.SplitTimeEntry(id, at)
+			return timesheetSavedMsg{status: "Time entry split at " + at.Format("15:04"), selectID: newID, err: err}
+		}
+	}
+	var cmd tea.Cmd
+	v.splitInput, cmd = v.splitInput.Update(msg)
+	return v, cmd
+}
+
+// updateConfirmDelete handles keys while confirming a delete
+func (v TimesheetView) updateConfirmDelete(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	v.mode = timesheetBrowse
+	if s := msg.String(); s != "y" && s != "Y" {
+		return v, nil
+	}
+	database, e := v.db, v.current()
+	id, running := e.ID, e.IsRunning()
+	return v, func() tea.Msg {
+		err := database.DeleteTimeEntry(id)
+		return timesheetSavedMsg{status: "Time entry deleted", timer: running, err: err}
+	}
+}
+
+// timesheetTotal is the time tracked against a project or task
+type timesheetTotal struct {
+	name    string
+	tracked int
+	billed  int
+	tasks   []timesheetTotal
+}
+
+// computeTotals adds up the period by project, then task. Billed time is
+// rounded entry by entry, the way it is invoiced.
+func (v TimesheetView) computeTotals() (all timesheetTotal, projects []timesheetTotal) {
+	byProject := make(map[string]*timesheetTotal)
+	byTask := make(map[string]map[string]*timesheetTotal)
+	for i := range v.entries {
+		e := &v.entries[i]
+		minutes := e.CalculatedDuration()
+		billed := v.rounding.Apply(minutes)
+		all.tracked += minutes
+		all.billed += billed
+
+		project := e.ProjectName
+		if project == "" {
+			project = "No project"
+		}
+		task := e.TaskTitle
+		if task == "" {
+			task = "No task"
+		}
+		p, ok := byProject[project]
+		if !ok {
+			p = &timesheetTotal{name: project}
+			byProject[project] = p
+			byTask[project] = make(map[string]*timesheetTotal)
+		}
+		p.tracked += minutes
+		p.billed += billed
+		t, ok := byTask[project][task]
+		if !ok {
+			t = &timesheetTotal{name: task}
+			byTask[project][task] = t
+		}
+		t.tracked += minutes
+		t.billed += billed
+	}
+
+	for name, p := range byProject {
+		for _, t := range byTask[name] {
+			p.tasks = append(p.tasks, *t)
+		}
+		sortTotals(p.tasks)
+		projects = append(projects, *p)
+	}
+	sortTotals(projects)
+	return all, projects
+}
+
+// sortTotals puts the most time first
+func sortTotals(totals []timesheetTotal) {
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].tracked != totals[j].tracked {
+			return totals[i].tracked > totals[j].tracked
+		}
+		return totals[i].name < totals[j].name
+	})
+}
+
+// View renders the timesheet view
+func (v TimesheetView) View() string {
+	if v.width == 0 || v.height == 0 {
+		return "Loading..."
+	}
+	t := theme.Current.Theme
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(t.Primary)
+	subtleStyle := lipgloss.NewStyle().Foreground(t.Subtle)
+
+	from, to := v.period()
+	title := "Timesheet ─ " + from.Format("Mon Jan 2, 2006")
+	if v.week {
+		title = fmt.Sprintf("Timesheet ─ Week of %s – %s", from.Format("Jan 2"), to.AddDate(0, 0, -1).Format("Jan 2, 2006"))
+	}
+	all, projects := v.computeTotals()
+	summary := "Total " + model.FormatEstimate(all.tracked)
+	if v.rounding.To > 1 {
+		summary += fmt.Sprintf(" · billed %s (rounded %s)", model.FormatEstimate(all.billed), v.rounding)
+	}
+	if n := len(v.overlaps); n > 0 {
+		summary += fmt.Sprintf(" · %d overlapping", n)
+	}
+	header := titleStyle.Render(title) + "  " + subtleStyle.Render(summary)
+
+	var footer []string
+	if v.errMsg != "" {
+		footer = append(footer, lipgloss.NewStyle().Foreground(t.Error).Render(v.errMsg))
+	} else if v.statusMsg != "" {
+		footer = append(footer, lipgloss.NewStyle().Foreground(t.Info).Render(v.statusMsg))
+	}
+	switch v.mode {
+	case timesheetEdit:
+		footer = append(footer, v.renderEditor())
+	case timesheetPickAdd, timesheetPickMove:
+		footer = append(footer, v.renderPicker())
+	case timesheetSplit:
+		footer = append(footer, v.splitInput.View(),
+			subtleStyle.Italic(true).Render("(A time within the entry; Enter to split, Esc to cancel)"))
+	case timesheetConfirmDelete:
+		footer = append(footer, lipgloss.NewStyle().Foreground(t.Warning).Render("Delete this time entry? (y/n)"))
+	}
+	bottom := strings.Join(footer, "\n")
+
+	height := v.height - 2
+	if bottom != "" {
+		height -= lipgloss.Height(bottom)
+	}
+	if height < 3 {
+		height = 3
+	}
+
+	var body string
+	if v.totals {
+		body = v.renderTotals(projects, height)
+	} else {
+		body = v.renderEntries(height)
+	}
+
+	sections := []string{header, "", body}
+	if bottom != "" {
+		sections = append(sections, bottom)
+	}
+	return strings.Join(sections, "\n")
+}
+
+// renderEntries lists the entries under a heading for each day, scrolled to
+// keep the cursor in view
+func (v TimesheetView) renderEntries(height int) string {
+	t := theme.Current.Theme
+	subtleStyle := lipgloss.NewStyle().Foreground(t.Subtle)
+	dayStyle := lipgloss.NewStyle().Bold(true).Foreground(t.Secondary)
+
+	if len(v.entries) == 0 {
+		return subtleStyle.Italic(true).Render("  No time tracked. Press a to add an entry.")
+	}
+
+	now := time.Now()
+	var lines []string
+	cursorLine := 0
+	for i := range v.entries {
+		e := &v.entries[i]
+		if i == 0 || !model.SameDay(e.StartedAt, v.entries[i-1].StartedAt) {
+			tracked, billed := v.dayTotals(e.StartedAt)
+			total := model.FormatEstimate(tracked)
+			if v.rounding.To > 1 {
+				total += " · billed " + model.FormatEstimate(billed)
+			}
+			if i > 0 {
+				lines = append(lines, "")
+			}
+			lines = append(lines, dayStyle.Render(e.StartedAt.Format("Mon Jan 2"))+"  "+subtleStyle.Render(total))
+		}
+		if i == v.cursor {
+			cursorLine = len(lines)
+		}
+		lines = append(lines, v.renderEntry(e, i == v.cursor, now))
+	}
+
+	start := 0
+	if cursorLine >= height {
+		start = cursorLine - height + 1
+	}
+	end := start + height
+	if end > len(lines) {
+		end = len(lines)
+	}
+	return strings.Join(lines[start:end], "\n")
+}
+
+// dayTotals adds up the tracked and billed minutes of a day
+func (v TimesheetView) dayTotals(day time.Time) (tracked, billed int) {
+	for i := range v.entries {
+		if model.SameDay(v.entries[i].StartedAt, day) {
+			minutes := v.entries[i].CalculatedDuration()
+			tracked += minutes
+			billed += v.rounding.Apply(minutes)
+		}
+	}
+	return tracked, billed
+}
+
+// renderEntry renders one entry: when it ran, for how long, what it was
+// for and any warnings
+func (v TimesheetView) renderEntry(e *db.TimesheetEntry, selected bool, now time.Time) string {
+	t := theme.Current.Theme
+	subtleStyle := lipgloss.NewStyle().Foreground(t.Subtle)
+	lineStyle := lipgloss.NewStyle().Foreground(t.Foreground)
+
+	cursor := "  "
+	if selected {
+		cursor = "> "
+		lineStyle = lineStyle.Bold(true)
+	}
+
+	end := "…"
+	if e.EndedAt != nil {
+		end = e.EndedAt.Format("15:04")
+		if !model.SameDay(*e.EndedAt, e.StartedAt) {
+			end += "+1"
+		}
+	}
+	minutes := e.CalculatedDuration()
+	span := fmt.Sprintf("%s–%-8s %7s", e.StartedAt.Format("15:04"), end, model.FormatEstimate(minutes))
+	if v.rounding.To > 1 {
+		span += subtleStyle.Render(fmt.Sprintf(" %7s", "≈"+model.FormatEstimate(v.rounding.Apply(minutes))))
+	}
+
+	what := e.TaskTitle
+	if what == "" {
+		what = "No task"
+	}
+	if e.ProjectName != "" {
+		what = e.ProjectName + " › " + what
+	}
+
+	var b strings.Builder
+	b.WriteString(cursor)
+	b.WriteString(lineStyle.Render(span))
+	b.WriteString("  ")
+	b.WriteString(lineStyle.Render(what))
+	if e.Description != "" {
+		b.WriteString(subtleStyle.Render(" — " + e.Description))
+	}
+	if e.IsPomodoro {
+		b.WriteString(" 🍅")
+	}
+	switch {
+	case e.IsPaused():
+		b.WriteString(lipgloss.NewStyle().Foreground(t.Warning).Render(" (paused)"))
+	case e.IsRunning():
+		b.WriteString(lipgloss.NewStyle().Foreground(t.Success).Render(" ● running " + FormatTimer(e.Elapsed(now))))
+	}
+	if v.overlaps[e.ID] {
+		b.WriteString(lipgloss.NewStyle().Foreground(t.Error).Render(" ⚠ overlaps"))
+	}
+	return b.String()
+}
+
+// renderTotals renders the time by project and task
+func (v TimesheetView) renderTotals(projects []timesheetTotal, height int) string {
+	t := theme.Current.Theme
+	subtleStyle := lipgloss.NewStyle().Foreground(t.Subtle)
+	projectStyle := lipgloss.NewStyle().Bold(true).Foreground(t.Secondary)
+
+	if len(projects) == 0 {
+		return subtleStyle.Italic(true).Render("  No time tracked.")
+	}
+
+	nameWidth := v.width - 24
+	if nameWidth < 20 {
+		nameWidth = 20
+	}
+	row := func(name string, total timesheetTotal) string {
+		if len([]rune(name)) > nameWidth {
+			name = string([]rune(name)[:nameWidth-1]) + "…"
+		}
+		line := fmt.Sprintf("%-*s %9s", nameWidth, name, model.FormatEstimate(total.tracked))
+		if v.rounding.To > 1 {
+			line += fmt.Sprintf(" %9s", model.FormatEstimate(total.billed))
+		}
+		return line
+	}
+
+	heading := fmt.Sprintf("%-*s %9s", nameWidth, "Project / task", "Tracked")
+	if v.rounding.To > 1 {
+		heading += fmt.Sprintf(" %9s", "Billed")
+	}
+	lines := []string{subtleStyle.Render(heading)}
+	for _, p := range projects {
+		lines = append(lines, projectStyle.Render(row(p.name, p)))
+		for _, task := range p.tasks {
+			lines = append(lines, row("  "+task.name, task))
+		}
+	}
+	if len(lines) > height {
+		lines = append(lines[:height-1], subtleStyle.Render(fmt.Sprintf("… %d more", len(lines)-height+1)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderEditor renders the entry editor
+func (v TimesheetView) renderEditor() string {
+	t := theme.Current.Theme
+	subtleStyle := lipgloss.NewStyle().Foreground(t.Subtle)
+
+	title := "Edit time entry"
+	if v.editing.TaskTitle != "" {
+		title += ": " + v.editing.TaskTitle
+	}
+	lines := []string{lipgloss.NewStyle().Bold(true).Foreground(t.Primary).Render(title)}
+	for _, f := range v.editFields() {
+		lines = append(lines, v.inputs[f].View())
+	}
+	hint := "(Times of day, or dates with times; a new duration moves the end. Tab to move, Enter to save, Esc to cancel)"
+	if v.editing.IsRunning() {
+		hint = "(The timer is running; stop it to set its end. Tab to move, Enter to save, Esc to cancel)"
+	}
+	lines = append(lines, subtleStyle.Italic(true).Render(hint))
+
+	return lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(t.Primary).
+		Padding(0, 1).
+		Width(v.width - 4).
+		Render(strings.Join(lines, "\n"))
+}
+
+// renderPicker renders the task picker
+func (v TimesheetView) renderPicker() string {
+	t := theme.Current.Theme
+	subtleStyle := lipgloss.NewStyle().Foreground(t.Subtle)
+	matchStyle := lipgloss.NewStyle().Bold(true).Foreground(t.Warning)
+
+	title := "Add time to"
+	if v.mode == timesheetPickMove {
+		title = "Move time entry to"
+	}
+	lines := []string{lipgloss.NewStyle().Bold(true).Foreground(t.Primary).Render(title), v.query.View()}
+
+	const shown = 5
+	start := 0
+	if v.picked >= shown {
+		start = v.picked - shown + 1
+	}
+	for i := start; i < len(v.results) && i < start+shown; i++ {
+		r := v.results[i]
+		cursor := "  "
+		lineStyle := lipgloss.NewStyle().Foreground(t.Foreground)
+		if i == v.picked {
+			cursor = "> "
+			lineStyle = lineStyle.Bold(true)
+		}
+		line := cursor + renderHighlights(r.Title, lineStyle, matchStyle)
+		if len(r.Ancestors) > 0 {
+			var parents []string
+			for _, a := range r.Ancestors {
+				parents = append(parents, a.Title)
+			}
+			line += subtleStyle.Render("  in " + strings.Join(parents, " › "))
+		}
+		lines = append(lines, line)
+	}
+	if strings.TrimSpace(v.query.Value()) != "" && len(v.results) == 0 {
+		lines = append(lines, subtleStyle.Italic(true).Render("  No matching tasks"))
+	}
+	lines = append(lines, subtleStyle.Italic(true).Render("(Type to search, ↑/↓ to choose, Enter to pick; Enter with no search means no task)"))
+
+	return lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(t.Primary).
+		Padding(0, 1).
+		Width(v.width - 4).
+		Render(strings.Join(lines, "\n"))
+}